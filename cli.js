@@ -0,0 +1,29 @@
+/* eslint-disable max-len */
+'use strict';
+const {COMMANDS, parseArgs, formatUsage} = require('./lib/cli');
+const {init} = require('./setup');
+
+/**
+ * Runs one of the subcommands, e.g. `check`, `diff`, `history`, `restore`,
+ * `preview`, or `post`. See `formatUsage()` for the full list.
+ *
+ * Usage: node cli.js <command> [arguments]
+ */
+(async () => {
+  const [name, ...args] = process.argv.slice(2);
+  const command = COMMANDS[name];
+  if (!command) {
+    console.error(formatUsage());
+    process.exit(name ? 1 : 0);
+  }
+  if (name === 'check') {
+    require('./index').start(); // the notifier itself, which handles its own flags and shutdown
+    return;
+  }
+  await init(); // connect to HCP Vault Secrets and populate environment variables
+  const exitCode = await command.run(parseArgs(args, command.flags));
+  if (exitCode === 2) {
+    console.error(formatUsage(name));
+  }
+  process.exit(exitCode);
+})();
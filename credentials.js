@@ -0,0 +1,23 @@
+/* eslint-disable max-len */
+'use strict';
+const {CREDENTIAL_SETS, verifyCredentials, getCredentialAlerts} = require('./lib/credentials');
+const {init} = require('./setup');
+
+/**
+ * Verifies the credentials right away (without posting anything), and
+ * prints their health and anything that needs attention.
+ *
+ * Usage: node credentials.js
+ */
+(async () => {
+  await init(); // connect to HCP Vault Secrets and populate environment variables
+  const health = await verifyCredentials(CREDENTIAL_SETS);
+  for (const [name, entry] of Object.entries(health)) {
+    console.log(`${name}: ${entry.lastError ? `FAILED (${entry.lastError})` : 'ok'}, first seen ${entry.firstSeenAt}, last worked ${entry.lastSuccessAt || 'never'}`);
+  }
+  const alerts = getCredentialAlerts(health);
+  for (const alert of alerts) {
+    console.log(`ALERT: ${alert}`);
+  }
+  process.exit(alerts.length ? 1 : 0);
+})();
@@ -0,0 +1,23 @@
+/* eslint-disable max-len */
+'use strict';
+const {buildDigest, sendDigest} = require('./lib/digest');
+const {init} = require('./setup');
+
+/**
+ * Prints the weekly ops digest (runs, failures, durations, quota usage, and
+ * expiring credentials), or emails it to the admin with `--send`.
+ *
+ * Usage: node digest.js [--send]
+ */
+(async () => {
+  await init(); // connect to HCP Vault Secrets and populate environment variables
+  if (process.argv.includes('--send')) {
+    const sent = await sendDigest();
+    console.log(sent ? 'Sent the ops digest' : 'Unable to send the ops digest');
+    process.exit(sent ? 0 : 1);
+  }
+  const digest = await buildDigest();
+  console.log(digest.subject);
+  console.log();
+  console.log(digest.text);
+})();
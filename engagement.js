@@ -0,0 +1,29 @@
+/* eslint-disable max-len */
+'use strict';
+const config = require('./config');
+const {getEngagementReport} = require('./lib/link_tracking');
+const {getExperimentReport, formatExperimentReport} = require('./lib/experiments');
+const {init} = require('./setup');
+
+/**
+ * Reports how many times the tracked links in the notifications were
+ * clicked, so admins know whether anyone actually reads the alerts.
+ *
+ * Usage: node engagement.js [team id]
+ */
+(async () => {
+  await init(); // connect to HCP Vault Secrets and populate environment variables
+  const teamId = process.argv[2] || config.teams[0].id;
+  const report = await getEngagementReport(teamId);
+  console.log(`Engagement for ${teamId}: ${report.clicks} click(s) across ${report.notifications} notification(s)`);
+  for (const [channel, clicks] of Object.entries(report.clicksByChannel)) {
+    console.log(`  ${channel}: ${clicks} click(s)`);
+  }
+  for (const link of report.links) {
+    console.log(`  ${link.createdAt} [${link.channel}${link.experiment ? `, ${link.experiment.variant}` : ''}] ${link.clicks} click(s)`);
+  }
+  const experiments = await getExperimentReport(teamId);
+  if (experiments.length) {
+    console.log(formatExperimentReport(experiments));
+  }
+})();
@@ -1,124 +1,722 @@
 /* eslint-disable max-len */
 /* eslint-disable require-jsdoc */
 'use strict';
-const puppeteer = require('puppeteer');
-const {TwitterApi} = require('twitter-api-v2');
 const config = require('./config');
-const moment = require('moment-timezone');
-const cheerio = require('cheerio');
 const {
-  parseSchedule,
   getTimestampedFilename,
   diffSchedule,
   serializeSchedule,
+  deserializeSchedule,
+  canonicalizeSchedule,
 } = require('./lib/helper_functions');
-const {
-  uploadFileToS3,
-} = require('./lib/aws');
-const {init} = require('./setup');
+const {getStore, getShareUrl} = require('./lib/storage');
+const {loadOverrides, applyOverrides, hasManualCorrections} = require('./lib/overrides');
+const {getBlueskySettings, postScreenshotToBluesky} = require('./lib/bluesky');
+const {getMastodonSettings, postScreenshotToMastodon} = require('./lib/mastodon');
+const {getFacebookSettings, postPhotoToFacebook} = require('./lib/facebook');
+const {getTelegramSettings, postScreenshotToTelegram} = require('./lib/telegram');
+const {getExperiment, assignVariant} = require('./lib/experiments');
+const {getSlackSettings, buildSlackMessage, postToSlackChannel} = require('./lib/slack');
+const {publishStatusSite} = require('./lib/status_site');
+const {publishScheduleSnapshot} = require('./lib/schedule_api');
+const {reportRunHealth} = require('./lib/healthcheck');
+const {alertTeamFailure} = require('./lib/admin_notifier');
+const {ScheduleSanityError, checkScheduleSanity} = require('./lib/sanity');
+const {acquireTeamLock, releaseTeamLock} = require('./lib/team_lock');
+const {applyRunMode} = require('./lib/event_detail');
+const {getPostingWindow, getMinutesUntilPostingWindow} = require('./lib/posting_window');
+const {buildPreviewHtml} = require('./lib/preview');
+const {LocalArtifactWriter, DryRunStore, writeDryRunArtifacts} = require('./lib/artifacts');
+const {sendHtmlEmail} = require('./lib/email');
+const {beginPendingPost, savePendingPost, completePendingStep, getMinutesUntilSettled, queuePendingPost, commitPendingPost} = require('./lib/pending_post');
+const {hashScheduleContent, hashTeamState, loadContentCache, saveContentCache, precheckPage, isPageUnchanged} = require('./lib/content_cache');
+const {archiveScreenshot} = require('./lib/screenshot_archive');
+const {recordNetChanges} = require('./lib/baseline');
+const {checkChannels} = require('./lib/channel_health');
+const {pruneArchive} = require('./lib/retention');
+const {signArchivedFiles} = require('./lib/signing');
+const {getSeasonMetadata, recordSnapshotMetadata} = require('./lib/season');
+const {crossCheckSchedule, recordCrossCheck, alertCrossCheck} = require('./lib/cross_check');
+const {StageTracker, createRunId} = require('./lib/pipeline_events');
+const {formatRunResultsTable, recordRunResults, hasFailedResults} = require('./lib/run_results');
+const {sendSms} = require('./lib/sms');
+const {validatePost, loadRecentPosts, recordRecentPost} = require('./lib/content_validator');
+const {classifyChanges, getChannelsForSeverity, capSeverity} = require('./lib/severity');
+const {loadTeamBranding, composePreviewImage, watermarkImage, renderScheduleImage, formatImageForChannel} = require('./lib/image');
+const {getJitteredDelay} = require('./lib/jitter');
+const {createTrackedLink, startLinkTrackingServer} = require('./lib/link_tracking');
+const {CostTracker, TrackedStore, formatCostSummary, recordMonthlyCosts} = require('./lib/cost');
+const {raceAbort, createDeadlineSignal, sleep, AbortableStore} = require('./lib/abort');
+const {getMaintenanceStatus, formatMaintenanceStatus} = require('./lib/maintenance');
+const {getDiffer} = require('./lib/differ');
+const {buildChangeEvent, sendWebhooks} = require('./lib/webhook');
+const {buildScheduleChangedEvent, publishScheduleChanged} = require('./lib/events');
+const {recordRunSummary, isDigestDue, sendDigest} = require('./lib/digest');
+const {monitorCredentials} = require('./lib/credentials');
+const {TeamScheduler} = require('./lib/scheduler');
+const {parseArgs, selectTeams} = require('./lib/cli');
+const {TwitterError, callWithRateLimit, createTwitterClient, getTwitterClient, uploadMedia} = require('./lib/twitter');
+const {checkBrowser, checkStorage, checkTwitter, runWarmupChecks, formatWarmupResults} = require('./lib/warmup');
+const {createLazyBrowser, createSharedBrowser, getScrapeSettings, createPageScraper, getHighlights} = require('./lib/scrape');
+const {getScheduleSourceText, getExtractionStrategy, isFallbackExtraction} = require('./lib/parsers');
+const {logger} = require('./lib/logger');
+const {buildParseQualityReport, formatParseQualitySummary, hasParseQualityIssues, recordParseQualityReport} = require('./lib/parse_quality');
+const {metrics} = require('./lib/metrics');
+const {getSqliteMirror} = require('./lib/sqlite');
+const {formatChangeList, buildAltText} = require('./lib/summary');
+const {loadRunState, recordRun, recordPost, detectOutage, getCatchUpDiff} = require('./lib/recovery');
+const {getChangeSummary, getLeadLine, getTweetText, formatTimestamp, getTeamName} = require('./lib/format');
+const {checkVisualDrift, resetVisualBaseline, alertVisualDrift} = require('./lib/visual_drift');
+const {init, refreshSecrets} = require('./setup');
 
-function logMessage(message) {
-  const timestamp = moment().tz(config.display_time_zone).format('dddd, MMMM Do YYYY, h:mm:ss a');
-  console.log(`INFO: ${timestamp} - ${message}`);
-}
+async function tweetScreenshot(imageBuffer, text, tracker, signal, replies = [], altText = '', client = createTwitterClient()) {
+  // First, post all your images to Twitter
+  const mediaIds = await raceAbort(Promise.all([
+    uploadMedia(imageBuffer, client, signal, altText),
+  ]), signal);
 
-async function tweetScreenshot(imageBuffer) {
-  const client = new TwitterApi({
-    appKey: config.consumer_key,
-    appSecret: config.consumer_secret,
-    accessToken: config.access_token_key,
-    accessSecret: config.access_token_secret,
-  });
+  // Don't tweet if we were cancelled while uploading
+  signal.throwIfAborted();
 
-  // First, post all your images to Twitter
-  const mediaIds = await Promise.all([
-    // file path
-    client.v1.uploadMedia(Buffer.from(imageBuffer), {
-      type: 'png',
-    }),
-  ]);
-
-  const timestamp = moment().tz(config.display_time_zone).format('dddd, MMMM Do YYYY, h:mm:ss a');
   // mediaIds is a string[], can be given to .tweet
-  await client.v2.tweet({
-    text: `Latest Bandits 12U Schedule as of ${timestamp}. https://www.brooklinebaseball.net/bandits12u #bandits12u`,
+  const tweet = await raceAbort(callWithRateLimit(() => client.v2.tweet({
+    text,
     media: {media_ids: mediaIds},
-  });
+  }), signal), signal);
+  tracker.record('twitterCall', mediaIds.length + 1);
+
+  logger.info(`Your image tweet has successfully posted`);
+
+  // Thread the rest of the changes under the screenshot tweet
+  let replyToId = tweet.data.id;
+  for (const reply of replies) {
+    signal.throwIfAborted();
+    const result = await raceAbort(callWithRateLimit(() => client.v2.tweet({
+      text: reply,
+      reply: {in_reply_to_tweet_id: replyToId},
+    }), signal), signal);
+    tracker.record('twitterCall');
+    replyToId = result.data.id;
+  }
+  if (replies.length) {
+    logger.info(`Threaded ${replies.length} replies with the rest of the changes`);
+  }
+  return tweet.data.id;
+}
+
+async function postToBluesky(team, imageBuffer, text, signal, altText = '') {
+  if (!getBlueskySettings(team)) {
+    return; // Bluesky is optional, so skip when it isn't configured for the team
+  }
+  const result = await postScreenshotToBluesky(imageBuffer, text, signal, altText, team);
+  if (!result) {
+    logger.error('Unable to post to Bluesky');
+    return;
+  }
+  logger.info(`Your image post has successfully posted to Bluesky at ${result.uri}`);
+}
+
+async function postToMastodon(team, imageBuffer, text, signal, altText = '') {
+  if (!getMastodonSettings(team)) {
+    return; // Mastodon is optional, so skip when it isn't configured for the team
+  }
+  const result = await postScreenshotToMastodon(imageBuffer, text, signal, altText, team);
+  if (!result) {
+    logger.error('Unable to post to Mastodon');
+    return;
+  }
+  logger.info(`Your image status has successfully posted to Mastodon at ${result.url}`);
+}
+
+async function postToFacebook(team, previewBuffer, text, signal) {
+  if (!getFacebookSettings(team)) {
+    return; // Facebook is optional, so skip when the team has no Page
+  }
+  const result = await postPhotoToFacebook(previewBuffer, text, team, signal);
+  if (!result) {
+    logger.error('Unable to post to Facebook');
+    return;
+  }
+  logger.info(`Your preview image has successfully posted to Facebook as ${result.post_id || result.id}`);
+}
+
+async function postToTelegram(team, imageBuffer, text, signal) {
+  if (!getTelegramSettings(team)) {
+    return; // Telegram is optional, so skip when the team has no chat
+  }
+  const result = await postScreenshotToTelegram(imageBuffer, text, team, signal);
+  if (!result) {
+    logger.error('Unable to post to Telegram');
+    return;
+  }
+  logger.info(`Your image has successfully posted to Telegram as message ${result.message_id}`);
+}
+
+async function publishSnapshot(team, schedule, changeEvent, store, signal) {
+  if (!config.schedule_api_bucket) {
+    return; // The JSON snapshot is optional, so skip when there's no bucket
+  }
+  // The snapshot is a convenience, so failing to publish it doesn't fail the run
+  try {
+    const key = await publishScheduleSnapshot(team, schedule, changeEvent, store);
+    if (key) {
+      logger.info(`Published the schedule to ${key}`);
+    }
+  } catch (e) {
+    signal.throwIfAborted();
+    logger.warn(`Unable to publish the schedule snapshot: ${e.message}`);
+  }
+}
+
+async function postToSlack(team, imageBuffer, scheduleDiff, link, screenshotKey, store, altText, signal) {
+  const settings = getSlackSettings(team);
+  if (!settings) {
+    return; // Slack is optional, so skip when the team has no channel
+  }
+  const title = `${getTeamName(team)} schedule update${hasManualCorrections(scheduleDiff) ? ' (manually corrected)' : ''}`;
+  // An incoming webhook can't upload the screenshot, so it's linked instead
+  const imageUrl = settings.webhookUrl ? await getShareUrl(store, screenshotKey) : null;
+  const message = buildSlackMessage(title, getLeadLine(scheduleDiff) || `${getChangeSummary(scheduleDiff)}.`, scheduleDiff, link, imageUrl, altText);
+  const result = await postToSlackChannel(settings.webhookUrl ? null : imageBuffer, message, settings, title, altText, signal);
+  if (!result) {
+    logger.error('Unable to post to Slack');
+    return;
+  }
+  logger.info(`Your schedule update has successfully posted to Slack${result.ts ? ` at ${result.channel}/${result.ts}` : ''}`);
+}
+
+async function sendTextMessages(team, scheduleDiff, screenshotKey, store, tracker, signal) {
+  if (!config.sms_phone_numbers.length) {
+    return; // SMS is optional, so skip when there is nobody to text
+  }
+  const correction = hasManualCorrections(scheduleDiff) ? ' (manually corrected)' : '';
+  const link = await createTrackedLink(team.id, team.url, 'sms', store);
+  let message = `${getTeamName(team)} schedule update${correction}: ${getLeadLine(scheduleDiff) || `${getChangeSummary(scheduleDiff)}.`} See ${link}`;
+  if (config.sms_include_screenshot_link) {
+    const screenshotUrl = await getShareUrl(store, screenshotKey);
+    if (screenshotUrl) {
+      message += ` Screenshot: ${screenshotUrl}`;
+    }
+  }
+  const results = await sendSms(message, signal);
+  const sent = results.filter((result) => result).length;
+  tracker.record('sms', sent);
+  logger.info(`Sent ${sent} of ${results.length} text messages via ${config.sms_provider}`);
+}
+
+async function recordUnchangedRun(team, store, signal) {
+  // Still a run, so that an outage isn't detected
+  await recordRun(team.id, store);
+  if (config.schedule_api_bucket) {
+    await publishSnapshot(team, await deserializeSchedule(`${team.id}/previousSchedule.json`, store), null, store, signal);
+  }
+}
 
-  logMessage(`Your image tweet has successfully posted`);
+// Catches the changes to the page that the parser misses (e.g. a note added above the schedule),
+// by comparing the screenshot with the last one while the parsed schedule stays the same
+async function checkPageLooksSame(team, scraper, store, signal) {
+  // The check is informational, so failing it doesn't fail the run
+  try {
+    const screenshot = await scraper.screenshot(team, signal);
+    const drift = await checkVisualDrift(team.id, screenshot, store);
+    if (drift.status === 'drifted') {
+      await alertVisualDrift(team, drift, screenshot);
+    }
+  } catch (e) {
+    signal.throwIfAborted();
+    logger.warn(`Unable to check the page of ${team.id} for visual changes: ${e.message}`);
+  }
 }
 
-async function main() {
-  const browser = await puppeteer.launch({
-    headless: 'new',
-    args: ['--no-sandbox', '--disable-setuid-sandbox'],
-  });
+// The scraper and Twitter client can be swapped out, e.g. for the fakes in the tests. With an
+// artifact writer (see `LocalArtifactWriter`), it's a dry run: what would be archived and posted
+// is written with it instead, and the team's state is left as it was.
+async function processTeam(browser, untrackedStore, team, runSignal, createScraper = createPageScraper, twitterClient = undefined, artifacts = null) {
+  if (artifacts) {
+    untrackedStore = new DryRunStore(untrackedStore);
+  }
+  // Each team gets a deadline, so that a hung page can't stall the whole run
+  const signal = createDeadlineSignal(runSignal, config.teamTimeout * 1000);
+  const tracker = new CostTracker();
+  const runId = createRunId();
+  const metadata = getSeasonMetadata(team);
+  const log = logger.with({team: team.id, mode: getScrapeSettings(team).scraper, run_id: runId, ...(metadata ? {season: metadata.season, age_group: metadata.ageGroup} : {})});
+  // Log an event per stage, for querying the runs in CloudWatch Logs Insights
+  const stages = new StageTracker(log, team.id, runId);
+  const store = new AbortableStore(new TrackedStore(untrackedStore, tracker), signal);
+  let scraper = null;
+  let lock = null;
+  let outcome = 'changed';
+  let error = null;
+  // The team's result, for the summary of the run
+  const result = {team: team.id, url: team.url, outcome, changes: 0, postedId: null, error, errorType: null};
   try {
-    const page = await browser.newPage();
-    await page.goto('https://www.brooklinebaseball.net/bandits12u');
-    // Grab the page's HTML data
-    const pageData = await page.evaluate(() => {
-      return {html: document.documentElement.innerHTML};
-    });
-    // Parse the data with "cheerio" library
-    const $ = cheerio.load(pageData.html);
-    const scheduleNode = $('h5:contains("Winter Practices")').parent(); // contains the entire schedule section
-    const schedule = parseSchedule(scheduleNode.text());
-    const scheduleDiff = await diffSchedule(schedule);
-    if (!scheduleDiff.added.size && !scheduleDiff.deleted.size && !scheduleDiff.modified.size) {
+    // Don't let an overlapping run (e.g. a manual run during the scheduled one) interleave its writes to the team's state
+    if (config.team_lock) {
+      lock = await acquireTeamLock(team.id, untrackedStore);
+      if (!lock) {
+        outcome = 'locked';
+        return result;
+      }
+    }
+    stages.enter('scrape');
+    // Skip the work when the page is the same as when it was last found unchanged (if enabled)
+    const contentCache = config.content_cache && !artifacts ? await loadContentCache(team.id, store) : null;
+    const stateHash = contentCache ? await hashTeamState(team.id, store) : null;
+    const validators = contentCache && config.content_precheck ? await precheckPage(team, signal) : null;
+    if (validators && contentCache.stateHash === stateHash && isPageUnchanged(contentCache, validators)) {
+      log.info(`Page unchanged since ${contentCache.checkedAt}, skipping the scrape`);
+      outcome = 'unchanged';
+      await recordUnchangedRun(team, store, signal);
+      return result;
+    }
+    scraper = createScraper(team, browser.get);
+    const scrapeStart = Date.now();
+    const scrapedSchedule = await scraper.scrape(team, signal);
+    metrics.observe('scrape_duration_seconds', {team: team.id}, (Date.now() - scrapeStart) / 1000);
+    const contentHash = contentCache && scraper.content ? hashScheduleContent(scraper.content, getScrapeSettings(team)) : null;
+    if (contentHash && contentCache.stateHash === stateHash && contentCache.contentHash === contentHash) {
+      log.info(`Schedule section unchanged since ${contentCache.checkedAt}, skipping the diff`);
+      outcome = 'unchanged';
+      await recordUnchangedRun(team, store, signal);
+      return result;
+    }
+    stages.enter('parse');
+    // Track how well the page parsed (before any overrides), so that layout changes show up before the parse fails
+    const extraction = scraper.content ? getExtractionStrategy(scraper.content, getScrapeSettings(team)) : null;
+    const quality = buildParseQualityReport(scrapedSchedule, scraper.content ? getScheduleSourceText(scraper.content, getScrapeSettings(team)) : null, new Date(), extraction);
+    await recordParseQualityReport(team.id, quality, store);
+    if (hasParseQualityIssues(quality)) {
+      log.warn(`Parse quality: ${formatParseQualitySummary(quality)}`, {lowConfidence: quality.lowConfidence.map((entry) => `${entry.key} (${entry.reasons.join(', ')})`), unmatched: quality.unmatchedLines || []});
+    } else {
+      log.info(`Parse quality: ${formatParseQualitySummary(quality)}`);
+    }
+    // Canonicalize the schedule before it's stored or compared, so that cosmetic changes to the page don't register
+    const schedule = canonicalizeSchedule(applyOverrides(scrapedSchedule, await loadOverrides(team.id, store)));
+    metrics.set('schedule_entries', {team: team.id}, schedule.size);
+    stages.enter('diff');
+    const runState = await loadRunState(team.id, store);
+    const differ = getDiffer();
+    let scheduleDiff = await diffSchedule(schedule, team.id, store, differ);
+    // Don't post (or overwrite the previous schedule) when the schedule looks like a broken scrape
+    const sanityFailure = checkScheduleSanity(scrapedSchedule, scheduleDiff);
+    if (sanityFailure) {
+      throw new ScheduleSanityError(sanityFailure);
+    }
+    if (detectOutage(runState)) {
+      // After an outage, report everything since the last post in one go,
+      // rather than diffing against whatever the last run happened to see
+      const catchUpDiff = await getCatchUpDiff(schedule, runState, team.id, store, differ);
+      if (catchUpDiff) {
+        log.info(`Outage detected for ${team.id} (last run ${runState.lastRunAt}), catching up on changes since ${runState.lastPostedAt}`);
+        scheduleDiff = catchUpDiff;
+      }
+    }
+    await recordRun(team.id, store);
+    // Track the net changes since the baseline (N days ago), for the weekly digest
+    const netChanges = await recordNetChanges(team.id, schedule, store);
+    if (netChanges) {
+      log.info(`Net changes since ${netChanges.baselineAt}: ${netChanges.summary}`);
+    }
+    const mirror = artifacts ? null : getSqliteMirror();
+    const changeCount = scheduleDiff.added.size + scheduleDiff.deleted.size + scheduleDiff.modified.size;
+    if (!changeCount) {
       // If there are no changes, then we don't need to do anything.
-      logMessage(`No differences detected.`);
-      return;
+      log.info(`No differences detected for ${team.id}.`);
+      outcome = 'unchanged';
+      if (artifacts) {
+        await writeDryRunArtifacts(artifacts, team, schedule, scheduleDiff);
+        return result;
+      }
+      if (config.visual_drift_check) {
+        await checkPageLooksSame(team, scraper, store, signal);
+      }
+      await publishSnapshot(team, schedule, null, store, signal);
+      if (contentCache) {
+        await saveContentCache(team.id, {contentHash, stateHash: await hashTeamState(team.id, store), ...validators}, store);
+      }
+      if (mirror) {
+        mirror.recordRun(team.id, 0);
+      }
+      return result;
     }
 
-    // Below here, a difference was detected, so we take a screenshot.
+    for (const type of ['added', 'deleted', 'modified']) {
+      metrics.increment('schedule_changes_total', {team: team.id, type}, scheduleDiff[type].size);
+    }
+    result.changes = changeCount;
+    const classification = classifyChanges(scheduleDiff.previousSchedule, scheduleDiff);
+    let severity = classification.severity;
+    if (isFallbackExtraction(extraction)) {
+      // The schedule section wasn't found as configured, so don't trust the changes as much
+      severity = capSeverity(severity, config.fallback_extraction_severity);
+      log.warn(`Changes came from a ${extraction} fallback extraction, routing them as ${severity}`);
+    }
+    // The run's mode (e.g. `no-tweet` from the EventBridge rule) can leave out some of the channels
+    const channels = applyRunMode(getChannelsForSeverity(severity), team.mode);
+    if (mirror) {
+      mirror.recordSchedule(team.id, schedule);
+      mirror.recordDiff(team.id, scheduleDiff, classification);
+      mirror.recordRun(team.id, changeCount, classification.severity, channels);
+    }
+    log.info(`Detected ${classification.severity} changes (${classification.changes.map((change) => `${change.key}: ${change.category}${change.manuallyCorrected ? ' (manually corrected)' : ''}`).join(', ')}), notifying via ${channels.join(', ')}`);
 
-    // Grab only the screen part relevant to the schedule
-    await page.setViewport({width: 1200, height: 800, deviceScaleFactor: 2});
+    // Below here, a difference was detected, so we take a screenshot.
+    stages.enter('screenshot');
 
     const screenshotFilenameBase = getTimestampedFilename('schedule-screenshot', 'png');
     const scheduleFilenameBase = screenshotFilenameBase.replace(/.png$/, '.json').replace(/-screenshot/, '');
-    // Take the screenshot of the portion of the screen with the schedule
-    const imageBuffer = await page.screenshot({
-      type: 'png',
-      //      path: screenshotFilename,
-      clip: {
-        height: 470,
-        width: 340,
-        x: 150,
-        y: 200,
-      },
-      omitBackground: true,
-    });
+    // Take the screenshot of the portion of the screen with the schedule, or
+    // draw the schedule from the parsed data
+    const branding = await loadTeamBranding(team, store);
+    let imageBuffer;
+    if ((team.screenshot || config.screenshot_mode) === 'rendered') {
+      imageBuffer = await renderScheduleImage(await browser.get(), schedule, scheduleDiff, getTeamName(team), branding);
+    } else {
+      imageBuffer = await scraper.screenshot(team, signal, config.screenshot_highlight ? getHighlights(scheduleDiff) : []);
+    }
+
+    // Check the extraction against the page fetched directly, so that a page
+    // that changed mid-scrape doesn't post a screenshot contradicting the text
+    if (config.cross_check && !artifacts && getScrapeSettings(team).scraper === 'browser') {
+      const check = await crossCheckSchedule(team, scrapedSchedule, signal);
+      const decision = await recordCrossCheck(team.id, check, store);
+      await alertCrossCheck(team, check, decision);
+      if (decision.delayed) {
+        log.warn(`The extractions disagree on ${check.disagreements.join(', ')}, delaying the post (${decision.delays} of ${config.cross_check_max_delays} runs)`);
+        outcome = 'delayed';
+        return result;
+      }
+    }
+
+    // Stamp the screenshot that gets posted with a watermark, if enabled
+    let postedImageBuffer = imageBuffer;
+    if (team.watermark ?? config.watermark_enabled) {
+      const timestamp = formatTimestamp(new Date(), config.display_time_zone, 'M/D/YYYY h:mm a');
+      postedImageBuffer = await watermarkImage(await browser.get(), imageBuffer, `${getTeamName(team)} · ${timestamp} · via @${config.twitterUserHandle}`);
+    }
+
+    // Composite the screenshot with a banner summarizing the changes
+    const previewBuffer = await composePreviewImage(await browser.get(), postedImageBuffer, `Schedule Update: ${getChangeSummary(scheduleDiff)}`, branding);
+    const previewFilenameBase = screenshotFilenameBase.replace(/-screenshot/, '-preview');
+    if (artifacts) {
+      const paths = await writeDryRunArtifacts(artifacts, team, schedule, scheduleDiff, postedImageBuffer, previewBuffer);
+      log.info(`Dry run, wrote ${paths.join(', ')} instead of archiving and posting`);
+      outcome = 'dry-run';
+      return result;
+    }
 
     // Since a diff was detected, we want to:
-    // - upload the latest screenshot to the archive
-    // - serialize the schedule json
+    // - upload the latest screenshot and preview image to the archive
     // - copy the schedule json to the archive
-    // - tweet out the latest screenshot
-    await uploadFileToS3(imageBuffer, `${config.twitterUserHandle}/archive/${screenshotFilenameBase}`);
-    await serializeSchedule(schedule, `${config.twitterUserHandle}/previousSchedule.json`);
-    await serializeSchedule(schedule, `${config.twitterUserHandle}/archive/${scheduleFilenameBase}`);
-    await tweetScreenshot(imageBuffer);
+    // - tweet out the latest screenshot, and cross-post to Bluesky and
+    //   Mastodon (if configured), unless the changes are too minor
+    // - text a summary of the changes, if the changes are critical
+    // - serialize the schedule json, once the notifications went out
+    // (unless posting is paused for maintenance)
+    stages.enter('archive');
+    if (config.visual_drift_check) {
+      await resetVisualBaseline(team.id, store); // the page looks different for a reason
+    }
+    // Until the post is committed, the next run detects the same changes and resumes the post where this one stopped
+    const pending = await beginPendingPost(team.id, schedule, store);
+    if (pending.archived) {
+      log.info(`Resuming the post of the changes (attempt ${pending.attempts}), already archived as ${pending.archived.screenshotKey}`);
+    } else {
+      // The screenshot is only archived when it looks different from the last one
+      const archived = await archiveScreenshot(team.id, `${team.id}/archive/${screenshotFilenameBase}`, imageBuffer, store);
+      if (archived.deduplicated) {
+        log.info(`Screenshot unchanged since ${archived.key}, archived a pointer to it`);
+      }
+      await store.upload(`${team.id}/archive/${previewFilenameBase}`, previewBuffer);
+      await serializeSchedule(schedule, `${team.id}/archive/${scheduleFilenameBase}`, store);
+      // Keep the season with the snapshot, so that the history of a reused page can be filtered by season
+      const metadataKey = await recordSnapshotMetadata(`${team.id}/archive/${scheduleFilenameBase}`, metadata, store);
+      // Sign what was archived (if enabled), as evidence that it isn't altered later
+      const screenshotArchiveKey = `${team.id}/archive/${screenshotFilenameBase}${archived.deduplicated ? '.pointer' : ''}`;
+      await signArchivedFiles([`${team.id}/archive/${scheduleFilenameBase}`, screenshotArchiveKey, `${team.id}/archive/${previewFilenameBase}`, ...(metadataKey ? [metadataKey] : [])], store);
+      pending.archived = {screenshotKey: archived.key, scheduleKey: `${team.id}/archive/${scheduleFilenameBase}`};
+      await savePendingPost(team.id, pending, store);
+    }
+    const screenshotKey = pending.archived.screenshotKey;
+    signal.throwIfAborted(); // don't start notifying once cancelled
+    stages.enter('notify');
+    const maintenance = await getMaintenanceStatus(store);
+    if (maintenance.paused) {
+      log.info(`Posting for ${team.id} skipped: ${formatMaintenanceStatus(maintenance)}`);
+      await commitPendingPost(team.id, schedule, store);
+      return result;
+    }
+    // Outside of the team's posting window (e.g. overnight), the changes stay pending until the first run inside of it
+    const postingWindow = getPostingWindow(team);
+    const minutesUntilWindow = postingWindow ? getMinutesUntilPostingWindow(postingWindow) : 0;
+    if (minutesUntilWindow) {
+      log.info(`Outside of the posting window, queued the changes for the first run in ${minutesUntilWindow} minutes`);
+      await queuePendingPost(team.id, pending, store);
+      outcome = 'queued';
+      return result;
+    }
+    // Wait for the page to settle (if enabled), so that several edits in a row go out as one post
+    const minutesUntilSettled = getMinutesUntilSettled(pending, team.debounceMinutes ?? config.post_debounce_minutes);
+    if (minutesUntilSettled) {
+      log.info(`The page last changed at ${pending.startedAt}, queued the changes until it's been the same for ${minutesUntilSettled} more minutes`);
+      await queuePendingPost(team.id, pending, store);
+      outcome = 'queued';
+      return result;
+    }
+    if (channels.includes('social') && 'social' in pending.completed) {
+      result.postedId = pending.completed.social;
+      log.info('Skipped the social posts, which went out on an earlier attempt');
+    } else if (channels.includes('social')) {
+      const recentPostsFilename = `${team.id}/recentPosts.json`;
+      // Split the posts between the formats of the team's experiment, if any, tagging the links to compare their clicks
+      const experiment = getExperiment(team);
+      const variant = experiment ? await assignVariant(team.id, experiment, store) : null;
+      if (variant) {
+        log.info(`Posting variant ${variant} of experiment ${experiment.name}`);
+      }
+      const link = await createTrackedLink(team.id, team.url, 'social', store, new Date(), variant ? {name: experiment.name, variant} : null);
+      const status = getTweetText(scheduleDiff, link, team, variant || config.tweet_summary_style);
+      const validation = validatePost(status.text, {recentPosts: await loadRecentPosts(recentPostsFilename, store)});
+      // Describe the screenshot for screen readers
+      const altText = buildAltText(schedule, `${getTeamName(team)} schedule`);
+      validation.adjustments.forEach((adjustment) => log.info(`Adjusted post: ${adjustment}`));
+      if (validation.valid) {
+        try {
+          result.postedId = await tweetScreenshot(await formatImageForChannel(await browser.get(), postedImageBuffer, 'twitter'), validation.text, tracker, signal, status.replies, altText, twitterClient || await getTwitterClient(store));
+          metrics.increment('posts_total', {team: team.id, channel: 'twitter', result: 'success'});
+        } catch (e) {
+          if (e.type !== 'duplicate') {
+            metrics.increment('posts_total', {team: team.id, channel: 'twitter', result: 'failure'});
+            if (!e.retryable && pending.attempts >= config.post_max_attempts) {
+              // Retrying won't get the post through, so stop detecting the changes again
+              await commitPendingPost(team.id, schedule, store);
+              log.error(`Tweeting failed (${e.type}) ${pending.attempts} times, giving up on posting the changes`);
+            } else {
+              log.warn(`Tweeting failed (${e.type}), the changes will be posted on the next run`);
+            }
+            throw e;
+          }
+          // The same status was already posted (e.g. by an earlier run), so there's nothing left to tweet
+          metrics.increment('posts_total', {team: team.id, channel: 'twitter', result: 'duplicate'});
+          log.warn(`Skipped the tweet: ${e.message}`);
+        }
+        await postToBluesky(team, await formatImageForChannel(await browser.get(), postedImageBuffer, 'bluesky'), validation.text, signal, altText);
+        await postToMastodon(team, await formatImageForChannel(await browser.get(), postedImageBuffer, 'mastodon'), validation.text, signal, altText);
+        await postToTelegram(team, await formatImageForChannel(await browser.get(), postedImageBuffer, 'telegram'), validation.text, signal);
+        await postToSlack(team, await formatImageForChannel(await browser.get(), postedImageBuffer, 'slack'), scheduleDiff, link, screenshotKey, store, altText, signal);
+        // The preview (the screenshot with the summary banner) reads better in a feed than the bare screenshot
+        await postToFacebook(team, previewBuffer, validation.text, signal);
+        await recordRecentPost(validation.text, recentPostsFilename, store);
+      } else {
+        log.error(`Post blocked by content validation: ${validation.errors.join('; ')}`);
+      }
+      await completePendingStep(team.id, pending, 'social', result.postedId, store);
+    }
+    if (channels.includes('sms') && !('sms' in pending.completed)) {
+      await sendTextMessages(team, scheduleDiff, screenshotKey, store, tracker, signal);
+      await completePendingStep(team.id, pending, 'sms', true, store);
+    }
+    if (channels.includes('email') && config.admin_email && !('email' in pending.completed)) {
+      // The same report as `preview --html`, with the preview image (the screenshot with the summary banner) attached inline
+      const html = buildPreviewHtml(team, schedule, scheduleDiff, 'cid:preview.png');
+      await sendHtmlEmail(config.admin_email, `${getTeamName(team)} schedule update: ${getChangeSummary(scheduleDiff)}`, `${getChangeSummary(scheduleDiff)}: ${formatChangeList(scheduleDiff)}\n\n${team.url}`, html, [{filename: 'preview.png', contentType: 'image/png', content: previewBuffer}]);
+      await completePendingStep(team.id, pending, 'email', true, store);
+    }
+    if (channels.includes('webhook') && config.webhooks.length && !('webhook' in pending.completed)) {
+      const results = await sendWebhooks(buildChangeEvent(team, scheduleDiff, classification, getChangeSummary(scheduleDiff)), config.webhooks, signal);
+      log.info(`Sent the change event to ${results.filter((result) => result).length} of ${results.length} webhooks`);
+      await completePendingStep(team.id, pending, 'webhook', true, store);
+    }
+    if ((config.aws_sns_topic_arn || config.aws_sqs_queue_url) && !('events' in pending.completed)) {
+      // Let other systems (e.g. reminders or data pipelines) react to every change, regardless of severity
+      const event = buildScheduleChangedEvent(buildChangeEvent(team, scheduleDiff, classification, getChangeSummary(scheduleDiff)), screenshotKey);
+      const published = await publishScheduleChanged(event);
+      log.info(`Published the ScheduleChanged event to ${published.length ? published.join(', ') : 'nothing (see errors above)'}`);
+      await completePendingStep(team.id, pending, 'events', true, store);
+    }
+    // Every notification went out, so the changes are no longer pending
+    await commitPendingPost(team.id, schedule, store);
+    await publishSnapshot(team, schedule, buildChangeEvent(team, scheduleDiff, classification, getChangeSummary(scheduleDiff)), store, signal);
+    if (config.status_site_bucket) {
+      // The status page is a convenience, so failing to publish it doesn't fail the run
+      try {
+        const published = await publishStatusSite(team, store);
+        if (published) {
+          log.info(`Published ${published.published.length} files to the status site${published.failed.length ? `, ${published.failed.length} failed` : ''}`);
+        }
+      } catch (e) {
+        signal.throwIfAborted();
+        log.warn(`Unable to publish the status site: ${e.message}`);
+      }
+    }
+    if (channels.length) {
+      await recordPost(schedule, team.id, store);
+    }
   } catch (e) {
-    logMessage('ERROR: Uncaught exception occurred');
-    console.log(e);
+    outcome = signal.aborted ? 'cancelled' : 'failed';
+    error = signal.aborted ? (signal.reason && signal.reason.message) : e.message;
+    result.errorType = e instanceof TwitterError ? e.type : null;
+    if (signal.aborted) {
+      log.error(`Processing ${team.id} was cancelled: ${signal.reason && signal.reason.message}`);
+    } else {
+      log.error(`Uncaught exception occurred while processing ${team.id}`, {error: e});
+      if (!artifacts && (config.admin_failure_alerts || e instanceof ScheduleSanityError)) {
+        try {
+          const sent = await alertTeamFailure(team, e, stages.stage, store);
+          if (sent) {
+            log.info(`Alerted the admins via ${sent.length ? sent.join(', ') : 'nothing (see errors above)'}`);
+          }
+        } catch (alertError) {
+          log.warn(`Unable to alert the admins: ${alertError.message}`);
+        }
+      }
+    }
   } finally {
-    await browser.close();
+    if (scraper) {
+      await scraper.close();
+    }
+    if (lock) {
+      await releaseTeamLock(team.id, lock, untrackedStore);
+    }
+    tracker.finish();
+    stages.finish(outcome, error);
+    Object.assign(result, {outcome, error});
+    metrics.increment('runs_total', {team: team.id, outcome});
+    metrics.flushEmf({team: team.id});
+    await recordRunSummary(team.id, {startedAt: tracker.startTime.toISOString(), durationMs: tracker.endTime - tracker.startTime, outcome, error}, untrackedStore);
+    const monthlyCosts = await recordMonthlyCosts(untrackedStore, team.id, tracker);
+    log.info(`Estimated cost of run for ${team.id}: ${formatCostSummary(tracker)}, $${monthlyCosts.total.toFixed(4)} so far in ${monthlyCosts.month}`, {outcome, durationMs: tracker.endTime - tracker.startTime});
   }
+  return result;
 }
 
-function sleep(ms) {
-  return new Promise((resolve) => {
-    setTimeout(resolve, ms);
-  });
+// Chrome is only launched once a team needs it (the Lambda passes its shared browser, which stays running)
+async function main(signal, teams = config.teams, artifacts = null, browser = createLazyBrowser()) {
+  // A dry run (see `processTeam()`) leaves the state as it was, including the pruning and the run results
+  const store = artifacts ? new DryRunStore(getStore()) : getStore();
+  const results = [];
+  try {
+    for (let i = 0; i < teams.length; i++) {
+      if (i > 0) {
+        // Stagger the scrapes so that teams hosted on the same site aren't hit all at once
+        await sleep(getJitteredDelay(config.scrapeStaggerInterval, config.scrapeJitter), signal);
+      }
+      results.push(await processTeam(browser, store, teams[i], signal, undefined, undefined, artifacts));
+      if (config.archive_max_age_days || config.archive_max_versions) {
+        const {pruned} = await pruneArchive(teams[i].id, store);
+        if (pruned.length) {
+          logger.info(`Pruned ${pruned.length} archived files of ${teams[i].id} past the retention policy`);
+        }
+      }
+    }
+  } catch (e) {
+    if (!signal.aborted) {
+      logger.error('Uncaught exception occurred', {error: e});
+    }
+  } finally {
+    await browser.close();
+  }
+  if (results.length && !artifacts) {
+    await recordRunResults(results, store);
+    // Alert about the teams that keep failing, and ping the healthcheck, so that a broken scraper doesn't go unnoticed
+    await reportRunHealth(results, store);
+  }
+  return results;
 }
 
-(async () => {
+async function start() {
   await init(); // connect to HCP Vault Secrets and populate environment variables
 
-  while (true) {
-    await main();
-    await sleep(config.runInterval * 1000); // multiply by 1000 as sleep takes milliseconds
+  // --only (or --url) processes just the given teams, e.g. to debug one team's page or re-post after a failure
+  const {flags} = parseArgs(process.argv.slice(2), ['once']);
+  const only = flags.only || flags.url;
+  const getTeams = () => selectTeams(config.teams, only);
+  if (!getTeams().length) {
+    logger.error(`No configured team matches ${only}`);
+    process.exit(1);
+  }
+  // --dry-run <directory> checks the teams once, writing what would be posted to the directory instead
+  const artifacts = flags['dry-run'] ? new LocalArtifactWriter(flags['dry-run']) : null;
+  const once = !!flags.once || !!artifacts;
+
+  // Cancel the current run cleanly when the container is stopped
+  const controller = new AbortController();
+  const shutdown = (signalName) => {
+    logger.info(`Received ${signalName}, shutting down`);
+    controller.abort(new Error(`Received ${signalName}`));
+  };
+  process.once('SIGTERM', shutdown);
+  process.once('SIGINT', shutdown);
+
+  // Chrome is started by the warmup check and kept running for the runs, rather than started by each one
+  const browser = createSharedBrowser();
+  // Surface browser, storage, or credential problems at startup, rather than on the first change
+  logger.info(`Warmup: ${formatWarmupResults(await runWarmupChecks({browser: () => checkBrowser(browser), storage: () => checkStorage(), twitter: () => checkTwitter()}))}`);
+  // Surface dead notification channels (e.g. a deleted webhook) before a change needs to go out
+  if (config.channel_self_test) {
+    const channels = await checkChannels();
+    logger.info(`Channels: ${channels.map((channel) => `${channel.name} ${channel.status}`).join(', ')}`);
+    channels.filter((channel) => channel.status === 'failed').forEach((channel) => logger.warn(`Channel ${channel.name} isn't ready: ${channel.detail}`));
   }
-})();
+
+  let linkTrackingServer = null;
+  if (config.link_tracking_base_url || config.metrics_endpoint || config.history_pages) {
+    linkTrackingServer = startLinkTrackingServer(getStore(), config.link_tracking_port);
+    logger.info(`Link tracking server listening on port ${config.link_tracking_port}`);
+  }
+
+  // Each team is checked on its own schedule (RUN_SCHEDULE or the team's `schedule`), or every RUN_INTERVAL by default
+  const scheduler = new TeamScheduler(config.run_schedule || `${config.runInterval}`, config.display_time_zone);
+  while (!controller.signal.aborted) {
+    if (await refreshSecrets()) {
+      logger.info('Secrets were rotated, picked up the new versions');
+    }
+    const teams = once ? getTeams() : scheduler.getDueTeams(getTeams());
+    if (teams.length) {
+      const results = await main(controller.signal, teams, artifacts, browser);
+      scheduler.markRun(teams);
+      if (once) {
+        // Print what happened to every team, since cron output is all there is to go on
+        console.log(formatRunResultsTable(results));
+        if (hasFailedResults(results)) {
+          process.exitCode = 1;
+        }
+      }
+    }
+    if (!artifacts) {
+      await monitorCredentials(); // verifies the credentials when due, alerting before they stop working
+    }
+    if (config.admin_email && !artifacts && await isDigestDue()) {
+      if (await sendDigest()) {
+        logger.info(`Sent the ops digest to ${config.admin_email}`);
+      } else {
+        logger.error('Unable to send the ops digest');
+      }
+    }
+    if (once) {
+      break;
+    }
+    const delay = scheduler.getDelayUntilNextRun(getTeams());
+    try {
+      await sleep(getJitteredDelay(delay === null ? config.runInterval : delay / 1000, config.runJitter), controller.signal);
+    } catch (e) {
+      break; // the sleep was cancelled by the shutdown
+    }
+  }
+
+  if (linkTrackingServer) {
+    linkTrackingServer.close();
+  }
+  await browser.shutdown();
+}
+
+module.exports = {
+  processTeam,
+  main,
+  start,
+};
+
+if (require.main === module) {
+  start();
+}
@@ -0,0 +1,90 @@
+/* eslint-disable max-len */
+'use strict';
+const config = require('./config');
+const {main, processTeam} = require('./index');
+const {init, refreshSecrets} = require('./setup');
+const {createDeadlineSignal} = require('./lib/abort');
+const {buildAdhocTeam, validatePayload, processPayload} = require('./lib/adhoc');
+const {runPipelineStage} = require('./lib/pipeline');
+const {isHttpEvent, handleHttpEvent} = require('./lib/http_trigger');
+const {parseEventDetail} = require('./lib/event_detail');
+const {selectTeams} = require('./lib/cli');
+const {createSharedBrowser} = require('./lib/scrape');
+const {checkBrowser, checkStorage, checkTwitter, runWarmupChecks, formatWarmupResults} = require('./lib/warmup');
+const {getStore} = require('./lib/storage');
+const {logger} = require('./lib/logger');
+
+// Time to leave for recording the results, before Lambda times out the invocation
+const SHUTDOWN_MARGIN_MS = 10 * 1000;
+
+let initialized = false;
+
+// Chrome is shared by the invocations of the container, rather than started by each one
+const browser = createSharedBrowser();
+if (process.env.AWS_LAMBDA_FUNCTION_NAME && config.chrome_warm_start) {
+  // Start Chrome in the init phase, so that the first invocation doesn't wait for it
+  browser.get().catch((e) => logger.warn(`Unable to start Chrome ahead of the first invocation: ${e.message}`));
+}
+
+/**
+ * The AWS Lambda handler. A scheduled event (e.g. from EventBridge) checks
+ * every configured team once, like `node index.js --once`, or the teams in
+ * the event's `detail`, e.g. `{"urls": ["BlineBanditsBot"], "mode":
+ * "no-tweet"}`, see `parseEventDetail()`. Other systems can reuse the
+ * parsing and diffing as a service, with an event that carries a page
+ * outside the configured list:
+ * - `{html}` or `{url}`: parses the page and diffs it against the `previous`
+ *   schedule (or the stored schedule of the `id`), without saving or posting
+ *   anything
+ * - `{url, id, notify: true}`: checks the page like a configured team, i.e.
+ *   saving its state under the `id` and posting the changes
+ * - `{stage, input}`: runs a stage of the pipeline mode, as invoked by the
+ *   Step Functions state machine, see `runPipelineStage()`
+ * - an HTTP request (from API Gateway or a function URL): checks a team on
+ *   demand, or reports the last run, see `handleHttpEvent()`
+ * - `{warmup: true}`: starts Chrome and runs the warmup checks, without
+ *   processing any teams, e.g. for a warmer that keeps the container warm
+ *
+ * @param {Object} event the Lambda event
+ * @param {Object} context the Lambda context
+ * @return {Object} the per-team `results`, the ad-hoc `result`, the `warmup` results, the output of the stage, the HTTP response, or the `error` for an invalid payload
+ */
+exports.handler = async (event = {}, context = {}) => {
+  if (!initialized) {
+    await init(); // connect to HCP Vault Secrets and populate environment variables
+    initialized = true;
+  } else if (await refreshSecrets()) {
+    logger.info('Secrets were rotated, picked up the new versions');
+  }
+  if (event.warmup) {
+    // A warmer (or a provisioned concurrency ping) only starts Chrome and checks the connections, without processing any teams
+    const results = await runWarmupChecks({browser: () => checkBrowser(browser), storage: () => checkStorage(getStore()), twitter: () => checkTwitter()});
+    logger.info(`Warmup: ${formatWarmupResults(results)}`);
+    return {warmup: results};
+  }
+  const timeoutMs = context.getRemainingTimeInMillis ? context.getRemainingTimeInMillis() - SHUTDOWN_MARGIN_MS : config.teamTimeout * 1000;
+  const signal = createDeadlineSignal(null, Math.max(timeoutMs, 1000));
+  if (isHttpEvent(event)) {
+    return await handleHttpEvent(event, (teams) => main(signal, teams, null, browser), getStore());
+  }
+  if (event.stage) {
+    return await runPipelineStage(event.stage, event.input || {}, processTeam, getStore(), signal, browser);
+  }
+  if (!event.html && !event.url) {
+    const selection = parseEventDetail(event.detail || {}, config.teams);
+    if (selection.error) {
+      return {error: selection.error};
+    }
+    return {results: await main(signal, selection.teams, null, browser)};
+  }
+  const error = validatePayload(event);
+  if (error) {
+    return {error};
+  }
+  if (event.notify) {
+    // A configured team keeps its settings, otherwise the page is checked with the payload's
+    const [team] = selectTeams(config.teams, event.url);
+    return {results: await main(signal, [team || buildAdhocTeam(event)], null, browser)};
+  }
+  return {result: await processPayload(event, browser.get, getStore(), signal)};
+};
@@ -0,0 +1,135 @@
+/* eslint-disable max-len */
+
+/**
+ * Races the promise against the signal, rejecting with the signal's reason
+ * as soon as it is aborted. This is for operations that can't be cancelled
+ * themselves, so that the caller at least stops waiting on them.
+ *
+ * @param {Promise} promise the operation to wait on
+ * @param {AbortSignal} signal the signal that cancels the wait
+ * @return {Promise} resolves/rejects with the operation, or rejects when aborted
+ */
+function raceAbort(promise, signal) {
+  if (!signal) {
+    return promise;
+  }
+  if (signal.aborted) {
+    return Promise.reject(signal.reason);
+  }
+  return new Promise((resolve, reject) => {
+    const onAbort = () => reject(signal.reason);
+    signal.addEventListener('abort', onAbort, {once: true});
+    promise.then((value) => {
+      signal.removeEventListener('abort', onAbort);
+      resolve(value);
+    }, (e) => {
+      signal.removeEventListener('abort', onAbort);
+      reject(e);
+    });
+  });
+}
+
+/**
+ * Creates a signal that is aborted when either the parent signal is aborted
+ * or the deadline passes, whichever comes first.
+ *
+ * @param {AbortSignal} parent the parent signal (e.g. for the whole run)
+ * @param {Integer} timeoutMs # of milliseconds until the deadline
+ * @return {AbortSignal} the combined signal
+ */
+function createDeadlineSignal(parent, timeoutMs) {
+  const deadline = AbortSignal.timeout(timeoutMs);
+  return parent ? AbortSignal.any([parent, deadline]) : deadline;
+}
+
+/**
+ * Waits for the given number of milliseconds, waking up early (and
+ * rejecting) when the signal is aborted.
+ *
+ * @param {Integer} ms number of milliseconds to wait
+ * @param {AbortSignal} signal the signal that cancels the wait
+ * @return {Promise} resolves once the time has elapsed
+ */
+function sleep(ms, signal) {
+  return raceAbort(new Promise((resolve) => {
+    const timer = setTimeout(resolve, ms);
+    if (signal) {
+      signal.addEventListener('abort', () => clearTimeout(timer), {once: true});
+    }
+  }), signal);
+}
+
+/**
+ * Wraps a store so that every storage request respects the signal: no new
+ * requests are started once it's aborted, and in-flight requests stop being
+ * waited on.
+ *
+ * @class AbortableStore
+ * @typedef {AbortableStore}
+ */
+class AbortableStore {
+  /**
+   * Creates an instance of AbortableStore.
+   *
+   * @constructor
+   * @param {Object} store the store being wrapped
+   * @param {AbortSignal} signal the signal that cancels the requests
+   */
+  constructor(store, signal) {
+    this.store = store;
+    this.signal = signal;
+  }
+
+  /**
+   * Calls the method on the wrapped store, respecting the signal.
+   *
+   * @async
+   * @param {String} method the name of the method
+   * @param {Array} args the arguments of the method
+   * @return {*} the result of the method
+   */
+  async call(method, args) {
+    this.signal.throwIfAborted();
+    return await raceAbort(this.store[method](...args), this.signal);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async upload(...args) {
+    return await this.call('upload', args);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async download(...args) {
+    return await this.call('download', args);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async exists(...args) {
+    return await this.call('exists', args);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async delete(...args) {
+    return await this.call('delete', args);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async list(...args) {
+    return await this.call('list', args);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async getShareUrl(...args) {
+    if (typeof this.store.getShareUrl !== 'function') {
+      return null;
+    }
+    return await this.call('getShareUrl', args);
+  }
+}
+
+module.exports = {
+  raceAbort,
+  createDeadlineSignal,
+  sleep,
+  AbortableStore,
+};
@@ -0,0 +1,114 @@
+/* eslint-disable max-len */
+const fs = require('fs');
+const net = require('net');
+const config = require('../config');
+const {logger} = require('./logger');
+
+/**
+ * Builds the allowlist from CIDR ranges (or single addresses), e.g.
+ * `192.168.1.0/24` or `fd00::/8`. Invalid entries are logged and skipped.
+ *
+ * @param {Array} cidrs the list of CIDR ranges
+ * @return {net.BlockList} the allowlist, or null when there aren't any ranges (i.e. everything is allowed)
+ */
+function createAllowlist(cidrs = config.admin_allowlist) {
+  if (!cidrs || !cidrs.length) {
+    return null;
+  }
+  const allowlist = new net.BlockList();
+  for (const cidr of cidrs) {
+    const [address, prefix] = cidr.split('/');
+    const type = net.isIPv6(address) ? 'ipv6' : 'ipv4';
+    if (!net.isIP(address)) {
+      logger.warn(`Skipping invalid address in the admin allowlist: ${cidr}`);
+      continue;
+    }
+    if (prefix === undefined) {
+      allowlist.addAddress(address, type);
+      continue;
+    }
+    const bits = parseInt(prefix);
+    if (isNaN(bits) || bits < 0 || bits > (type === 'ipv6' ? 128 : 32)) {
+      logger.warn(`Skipping invalid address in the admin allowlist: ${cidr}`);
+      continue;
+    }
+    allowlist.addSubnet(address, bits, type);
+  }
+  return allowlist;
+}
+
+/**
+ * Determines whether the address is in the allowlist. IPv4 addresses that
+ * arrive as IPv6 (e.g. `::ffff:192.168.1.5`) are checked as IPv4.
+ *
+ * @param {String} address the remote address
+ * @param {net.BlockList} allowlist the allowlist from `createAllowlist()`
+ * @return {Boolean} true if the address is allowed
+ */
+function isAddressAllowed(address, allowlist) {
+  if (!allowlist) {
+    return true;
+  }
+  if (!address) {
+    return false;
+  }
+  const mapped = address.match(/^::ffff:(\d+\.\d+\.\d+\.\d+)$/i);
+  if (mapped) {
+    return allowlist.check(mapped[1], 'ipv4');
+  }
+  return allowlist.check(address, net.isIPv6(address) ? 'ipv6' : 'ipv4');
+}
+
+/**
+ * Loads the TLS options for the server. When a client CA is configured,
+ * clients are asked for a certificate, which the admin endpoints require
+ * (see `isAdminRequestAuthorized()`). Certificates aren't rejected during
+ * the handshake, so that the public endpoints keep working without one.
+ *
+ * @param {String} keyPath path to the server's private key (PEM)
+ * @param {String} certPath path to the server's certificate (PEM)
+ * @param {String} clientCaPath path to the CA that signs the client certificates (PEM)
+ * @return {Object} the options for `https.createServer()`, or null when TLS isn't configured
+ */
+function loadTlsOptions(keyPath = config.server_tls_key, certPath = config.server_tls_cert, clientCaPath = config.server_client_ca) {
+  if (!keyPath || !certPath) {
+    return null;
+  }
+  const options = {
+    key: fs.readFileSync(keyPath),
+    cert: fs.readFileSync(certPath),
+  };
+  if (clientCaPath) {
+    options.ca = fs.readFileSync(clientCaPath);
+    options.requestCert = true;
+    options.rejectUnauthorized = false;
+  }
+  return options;
+}
+
+/**
+ * Determines whether the request may use the admin endpoints, i.e. it comes
+ * from an allowed address and, when client certificates are required, it
+ * presented a certificate signed by the client CA.
+ *
+ * @param {http.IncomingMessage} req the request
+ * @param {net.BlockList} allowlist the allowlist from `createAllowlist()`
+ * @param {Boolean} requireClientCert whether a client certificate is required
+ * @return {Boolean} true if the request is authorized
+ */
+function isAdminRequestAuthorized(req, allowlist, requireClientCert = !!config.server_client_ca) {
+  if (!isAddressAllowed(req.socket.remoteAddress, allowlist)) {
+    return false;
+  }
+  if (requireClientCert && !req.socket.authorized) {
+    return false;
+  }
+  return true;
+}
+
+module.exports = {
+  createAllowlist,
+  isAddressAllowed,
+  loadTlsOptions,
+  isAdminRequestAuthorized,
+};
@@ -0,0 +1,111 @@
+/* eslint-disable max-len */
+const {canonicalizeSchedule, deserializeSchedule} = require('./helper_functions');
+const {getStore} = require('./storage');
+const {getDiffer} = require('./differ');
+const {getScrapeSettings, getPageContent, createPageScraper} = require('./scrape');
+const {parseSchedulePage, getExtractionStrategy} = require('./parsers');
+
+/**
+ * Builds the team for an ad-hoc payload, i.e. a page that isn't in the
+ * configured list of teams.
+ *
+ * @param {Object} payload the payload, i.e. `{html}` or `{url}`, with the optional `id` and `scrape` settings
+ * @return {Object} the team, e.g. `{id: 'adhoc', url, scrape}`
+ */
+function buildAdhocTeam(payload) {
+  return {id: payload.id || 'adhoc', url: payload.url || null, scrape: payload.scrape || {}};
+}
+
+/**
+ * Checks that the payload carries a page to process.
+ *
+ * @param {Object} payload the payload
+ * @return {String} the problem with the payload, or null if it's valid
+ */
+function validatePayload(payload) {
+  if (!payload || (!payload.html && !payload.url)) {
+    return 'Expected either `html` or `url`';
+  }
+  if (payload.url && !/^https?:\/\//.test(payload.url)) {
+    return `Expected an http(s) URL, got ${payload.url}`;
+  }
+  if (payload.notify && (!payload.url || !payload.id)) {
+    return 'Expected `url` and `id` (the prefix for its state) to notify';
+  }
+  if (payload.previous && typeof payload.previous !== 'object') {
+    return 'Expected `previous` to be a schedule, i.e. an object of entries by day';
+  }
+  return null;
+}
+
+/**
+ * Loads the schedule to compare the payload's page against: the payload's
+ * `previous` schedule, or the stored schedule of the `id` if there is one.
+ *
+ * @async
+ * @param {Object} payload the payload
+ * @param {Object} store the storage that the state is kept in
+ * @return {Map} the previous schedule, empty if there isn't one
+ */
+async function loadPreviousSchedule(payload, store = getStore()) {
+  if (payload.previous) {
+    return canonicalizeSchedule(new Map(Object.entries(payload.previous)));
+  }
+  const previousKey = `${payload.id}/previousSchedule.json`;
+  if (payload.id && await store.exists(previousKey)) {
+    return await deserializeSchedule(previousKey, store);
+  }
+  return new Map();
+}
+
+/**
+ * Parses and diffs the page of an ad-hoc payload, either the raw `html` or
+ * a `url` to scrape, so that other systems can reuse the parsing and diffing
+ * as a service. Nothing is saved or posted.
+ *
+ * @async
+ * @param {Object} payload the payload, i.e. `{html}` or `{url}`, with the optional `id` (whose stored schedule is compared against), `previous` schedule, and `scrape` settings
+ * @param {Function} getBrowser retrieves the puppeteer browser, see `createLazyBrowser()`
+ * @param {Object} store the storage that the state is kept in
+ * @param {AbortSignal} signal the signal that cancels the scrape
+ * @return {Object} `{schedule, extraction, summary, changes}`, with the keys of the `added`, `deleted`, and `modified` entries
+ */
+async function processPayload(payload, getBrowser, store = getStore(), signal = undefined) {
+  const team = buildAdhocTeam(payload);
+  const settings = getScrapeSettings(team);
+  let content;
+  let schedule;
+  if (payload.html) {
+    content = getPageContent(payload.html, 'text/html');
+    schedule = parseSchedulePage(content, settings);
+  } else {
+    const scraper = createPageScraper(team, getBrowser);
+    try {
+      schedule = await scraper.scrape(team, signal);
+      content = scraper.content;
+    } finally {
+      await scraper.close();
+    }
+  }
+  schedule = canonicalizeSchedule(schedule);
+  const previousSchedule = await loadPreviousSchedule(payload, store);
+  const differ = getDiffer();
+  const scheduleDiff = {...differ.diff(previousSchedule, schedule), previousSchedule};
+  return {
+    schedule: Object.fromEntries(schedule),
+    extraction: content ? getExtractionStrategy(content, settings) : null,
+    summary: differ.summarize(scheduleDiff),
+    changes: {
+      added: [...scheduleDiff.added.keys()],
+      deleted: [...scheduleDiff.deleted.keys()],
+      modified: [...scheduleDiff.modified.keys()],
+    },
+  };
+}
+
+module.exports = {
+  buildAdhocTeam,
+  validatePayload,
+  loadPreviousSchedule,
+  processPayload,
+};
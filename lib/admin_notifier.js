@@ -0,0 +1,182 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const config = require('../config');
+const {getStore, getShareUrl} = require('./storage');
+const {sendEmail, sendEmailWithAttachments} = require('./email');
+const {listScheduleSnapshots} = require('./timeline');
+const {getSnapshotScreenshotKey} = require('./history');
+const {resolveScreenshotKey} = require('./screenshot_archive');
+const {TwitterError, getTwitterClient, uploadMedia} = require('./twitter');
+const {ScheduleSanityError} = require('./sanity');
+const {logger} = require('./logger');
+
+// Tracks the last failure that the admins were alerted about, so that a failure that repeats every run isn't alerted every run
+const FAILURE_ALERT_FILENAME = 'failureAlert.json';
+
+/**
+ * Emails the alert, with the screenshot attached when there's one.
+ *
+ * @async
+ * @param {String} to the email address of the recipient
+ * @param {String} subject the subject of the email
+ * @param {String} text the body of the email
+ * @param {Array} attachments list of `{filename, contentType, content}`
+ * @return {String} the SES message id, or null on failure
+ */
+async function sendAlertEmail(to, subject, text, attachments = []) {
+  return attachments.length ? await sendEmailWithAttachments(to, subject, text, attachments) : await sendEmail(to, subject, text);
+}
+
+/**
+ * Sends the alert as a direct message from the bot's account to the
+ * `ADMIN_TWITTER_USER_ID`, with the screenshot when there's one.
+ *
+ * @async
+ * @param {String} text the alert
+ * @param {Buffer} screenshot the screenshot, or null
+ * @param {Object} client the Twitter client, or undefined for the bot's account
+ * @return {Boolean} true if the message was sent
+ */
+async function sendTwitterDm(text, screenshot = null, client = undefined) {
+  try {
+    const twitterClient = client || await getTwitterClient();
+    const message = {text: text.slice(0, 10000)};
+    if (screenshot) {
+      message.attachments = [{media_id: await uploadMedia(screenshot, twitterClient)}];
+    }
+    await twitterClient.v2.sendDmToParticipant(config.admin_twitter_user_id, message);
+    return true;
+  } catch (e) {
+    logger.error(`Unable to send the Twitter DM: ${e instanceof TwitterError ? `${e.type}, ${e.message}` : e.message}`);
+  }
+  return false;
+}
+
+/**
+ * Alerts the admins on each of the configured channels: by email (to the
+ * `ADMIN_EMAIL`), in Slack (to the `ADMIN_SLACK_WEBHOOK_URL`), and by
+ * Twitter direct message (to the `ADMIN_TWITTER_USER_ID`). The screenshot
+ * is attached to the email and the DM, and linked in Slack, whose incoming
+ * webhooks can't upload files.
+ *
+ * @async
+ * @param {String} subject the subject of the alert
+ * @param {String} text the alert
+ * @param {Object} screenshot `{content, url}` of the screenshot, or null
+ * @param {Function} send sends the email, see `sendAlertEmail()`
+ * @param {Object} http the HTTP client, i.e. axios
+ * @param {Function} sendDm sends the Twitter DM, see `sendTwitterDm()`
+ * @return {Array} the channels that the alert was sent to
+ */
+async function notifyAdmins(subject, text, screenshot = null, send = sendAlertEmail, http = axios, sendDm = sendTwitterDm) {
+  const sent = [];
+  const attachments = screenshot && screenshot.content ? [{filename: 'screenshot.png', contentType: 'image/png', content: screenshot.content}] : [];
+  if (config.admin_email && await send(config.admin_email, subject, text, attachments)) {
+    sent.push('email');
+  }
+  if (config.admin_slack_webhook_url) {
+    try {
+      const link = screenshot && screenshot.url ? `\n<${screenshot.url}|Last screenshot>` : '';
+      await http.post(config.admin_slack_webhook_url, {text: `*${subject}*\n${text}${link}`}, {headers: {'content-type': 'application/json'}});
+      sent.push('slack');
+    } catch (e) {
+      // The webhook URL is a secret, so only the message is logged
+      logger.error(`Unable to alert in Slack: ${e.message}`);
+    }
+  }
+  if (config.admin_twitter_user_id && await sendDm(`${subject}\n\n${text}`, screenshot && screenshot.content)) {
+    sent.push('twitter');
+  }
+  return sent;
+}
+
+/**
+ * Retrieves the team's last archived screenshot, i.e. what the page looked
+ * like the last time it changed, with a link to it when the storage can
+ * share it.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the archive is kept in
+ * @return {Object} `{key, content, url}`, or null if nothing has been archived
+ */
+async function getLastScreenshot(prefix, store = getStore()) {
+  const snapshots = await listScheduleSnapshots(prefix, store);
+  if (!snapshots.length) {
+    return null;
+  }
+  const key = await resolveScreenshotKey(getSnapshotScreenshotKey(snapshots[snapshots.length - 1].key), store);
+  if (!key) {
+    return null;
+  }
+  return {key, content: await store.download(key), url: await getShareUrl(store, key)};
+}
+
+/**
+ * Classifies the failure of the team's run for the alert: the `credentials`
+ * that Twitter rejected, a schedule that failed the `sanity` checks, or
+ * else the stage it failed in (e.g. `scrape`).
+ *
+ * @param {Error} error the error
+ * @param {String} stage the stage that the run failed in, see `StageTracker`
+ * @return {String} the kind of failure
+ */
+function classifyFailure(error, stage) {
+  if (error instanceof TwitterError && error.type === 'unauthorized') {
+    return 'credentials';
+  }
+  if (error instanceof ScheduleSanityError) {
+    return 'sanity';
+  }
+  return stage || 'run';
+}
+
+/**
+ * Alerts the admins that the team's run failed, with the error and the last
+ * screenshot. The same error isn't alerted again until it's been
+ * `ADMIN_ALERT_REPEAT_HOURS`, so that a page that's down doesn't alert on
+ * every run.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {Error} error the error that the run failed with
+ * @param {String} stage the stage that the run failed in, see `StageTracker`
+ * @param {Object} store the storage that the state and archive are kept in
+ * @param {Function} notify alerts the admins, see `notifyAdmins()`
+ * @param {Date} now the current date
+ * @return {Array} the channels that the alert was sent to, or null if it wasn't sent
+ */
+async function alertTeamFailure(team, error, stage, store = getStore(), notify = notifyAdmins, now = new Date()) {
+  const filepath = `${team.id}/${FAILURE_ALERT_FILENAME}`;
+  const kind = classifyFailure(error, stage);
+  const data = await store.download(filepath);
+  if (data) {
+    try {
+      const last = JSON.parse(data);
+      if (last.error === error.message && now - new Date(last.alertedAt) < config.admin_alert_repeat_hours * 60 * 60 * 1000) {
+        return null;
+      }
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  const hints = {
+    credentials: ' Twitter rejected the credentials, so they need to be rotated.',
+    sanity: ' Nothing was posted, and the previous schedule was kept.',
+  };
+  const hint = hints[kind] || '';
+  const text = `${team.id} (${team.url}) failed (${kind}): ${error.message}.${hint}`;
+  const sent = await notify(`Bandits notification: ${team.id} failed (${kind})`, text, await getLastScreenshot(team.id, store));
+  await store.upload(filepath, JSON.stringify({error: error.message, kind, alertedAt: now.toISOString()}));
+  return sent;
+}
+
+module.exports = {
+  FAILURE_ALERT_FILENAME,
+  sendAlertEmail,
+  sendTwitterDm,
+  notifyAdmins,
+  getLastScreenshot,
+  classifyFailure,
+  alertTeamFailure,
+};
@@ -0,0 +1,152 @@
+/* eslint-disable max-len */
+const fs = require('fs');
+const path = require('path');
+const {EJSON} = require('bson');
+const {getDiffer} = require('./differ');
+const {formatChangeList} = require('./summary');
+const {buildPreviewHtml, toDataUrl} = require('./preview');
+
+/**
+ * Writes the artifacts of a dry run (the screenshot, the preview, the
+ * schedule, and the HTML report) to a local directory, one subdirectory per
+ * team. Any object with `write(name, contents)` can stand in for it, e.g. to
+ * collect the artifacts in the tests.
+ *
+ * @class LocalArtifactWriter
+ * @typedef {LocalArtifactWriter}
+ */
+class LocalArtifactWriter {
+  /**
+   * Creates an instance of LocalArtifactWriter.
+   *
+   * @constructor
+   * @param {String} directory the directory that the artifacts are written to
+   */
+  constructor(directory) {
+    this.directory = directory;
+    this.written = [];
+  }
+
+  /**
+   * Writes the artifact, creating its directory if needed.
+   *
+   * @async
+   * @param {String} name the name of the artifact, relative to the directory, e.g. `<team id>/schedule.json`
+   * @param {Buffer|String} contents the contents of the artifact
+   * @return {String} the path of the artifact
+   */
+  async write(name, contents) {
+    const filename = path.join(this.directory, name);
+    await fs.promises.mkdir(path.dirname(filename), {recursive: true});
+    await fs.promises.writeFile(filename, contents);
+    this.written.push(filename);
+    return filename;
+  }
+}
+
+/**
+ * Wraps a store so that a dry run can read the state, but not change it:
+ * the writes (and deletes) are kept in memory, and read back from there, so
+ * that the run behaves as it would without touching the real state.
+ *
+ * @class DryRunStore
+ * @typedef {DryRunStore}
+ */
+class DryRunStore {
+  /**
+   * Creates an instance of DryRunStore.
+   *
+   * @constructor
+   * @param {Object} store the store being wrapped
+   */
+  constructor(store) {
+    this.store = store;
+    this.files = new Map(); // by key, or null when deleted
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async upload(key, contents) {
+    this.files.set(key, {contents: Buffer.from(contents), lastModified: new Date()});
+    return true;
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async create(key, contents) {
+    if (await this.exists(key)) {
+      return false;
+    }
+    return await this.upload(key, contents);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async download(key) {
+    if (this.files.has(key)) {
+      return this.files.get(key) ? this.files.get(key).contents : null;
+    }
+    return await this.store.download(key);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async exists(key) {
+    if (this.files.has(key)) {
+      return !!this.files.get(key);
+    }
+    return await this.store.exists(key);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async delete(key) {
+    this.files.set(key, null);
+    return true;
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async list(prefix) {
+    const listed = (await this.store.list(prefix)).filter((object) => !this.files.has(object.key));
+    const written = [...this.files.entries()]
+        .filter(([key, file]) => file && key.startsWith(prefix))
+        .map(([key, file]) => ({key, lastModified: file.lastModified, size: file.contents.length}));
+    return [...listed, ...written];
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async getShareUrl() {
+    return null; // nothing is shared from a dry run
+  }
+}
+
+/**
+ * Writes what a run would have archived and posted, in place of archiving
+ * and posting it: the schedule, the HTML report, a summary of the changes,
+ * and (when there are changes) the screenshot and the preview image.
+ *
+ * @async
+ * @param {Object} artifacts the artifact writer, see `LocalArtifactWriter`
+ * @param {Object} team the team
+ * @param {Map} schedule the new schedule
+ * @param {Object} scheduleDiff the differences, with the `previousSchedule`
+ * @param {Buffer} screenshot the screenshot that would be posted, or null when nothing changed
+ * @param {Buffer} preview the preview image that would be archived, or null when nothing changed
+ * @return {Array} the paths of the artifacts
+ */
+async function writeDryRunArtifacts(artifacts, team, schedule, scheduleDiff, screenshot = null, preview = null) {
+  const changeList = formatChangeList(scheduleDiff);
+  const paths = [
+    await artifacts.write(`${team.id}/schedule.json`, EJSON.stringify(schedule)),
+    await artifacts.write(`${team.id}/report.html`, buildPreviewHtml(team, schedule, scheduleDiff, screenshot ? toDataUrl(screenshot) : null)),
+    await artifacts.write(`${team.id}/changes.txt`, `${getDiffer().summarize(scheduleDiff)}${changeList ? `: ${changeList}` : ''}\n`),
+  ];
+  if (screenshot) {
+    paths.push(await artifacts.write(`${team.id}/screenshot.png`, screenshot));
+  }
+  if (preview) {
+    paths.push(await artifacts.write(`${team.id}/preview.png`, preview));
+  }
+  return paths;
+}
+
+module.exports = {
+  LocalArtifactWriter,
+  DryRunStore,
+  writeDryRunArtifacts,
+};
@@ -1,8 +1,10 @@
 const config = require('../config');
+const {logger} = require('./logger');
+const {metrics} = require('./metrics');
 // Load the SDK for JavaScript
 const AWS = require('aws-sdk');
 AWS.config.update({region: config.aws_default_region}); // Set the Region
-AWS.config.logger = console; // log API calls to the console
+AWS.config.logger = {log: (message) => logger.debug(message)}; // log API calls at the debug level
 const {Readable} = require('stream');
 
 /**
@@ -30,7 +32,8 @@ async function uploadFileToS3(contents, filename) {
     // call S3 to upload file to specified bucket
     data = await s3.upload(uploadParams).promise();
   } catch (e) {
-    console.error(e);
+    logger.error(e);
+    metrics.increment('storage_errors_total', {operation: 'upload'});
   }
   return data;
 }
@@ -59,15 +62,305 @@ async function getFileFromS3(filename) {
   } catch (e) {
     if (e.code !== 'NoSuchKey') {
       // Only log if it's actually something we need to worry about.
-      console.error(e);
+      logger.error(e);
+      metrics.increment('storage_errors_total', {operation: 'download'});
     }
     return null;
   }
   return data.Body;
 }
 
+/**
+ * Lists all of the S3 objects under the prefix using `listObjectsV2`,
+ * following the continuation tokens until every page has been retrieved.
+ *
+ * @async
+ * @param {String} prefix the prefix of the `Key` for the S3 objects to list
+ * @return {Array} list of objects with `Key`, `LastModified`, and `Size`
+ */
+async function listFilesInS3(prefix) {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01'});
+
+  const files = [];
+  let continuationToken = undefined;
+  try {
+    do {
+      const data = await s3.listObjectsV2({
+        Bucket: config.aws_s3_bucket,
+        Prefix: prefix,
+        ContinuationToken: continuationToken,
+      }).promise();
+      files.push(...data.Contents);
+      continuationToken = data.IsTruncated ? data.NextContinuationToken : undefined;
+    } while (continuationToken);
+  } catch (e) {
+    logger.error(e);
+    metrics.increment('storage_errors_total', {operation: 'list'});
+  }
+  return files;
+}
+
+/**
+ * Checks whether an S3 object exists using `headObject`
+ *
+ * @async
+ * @param {String} filename `Key` for the S3 object to check
+ * @return {Boolean} true if the object exists
+ */
+async function existsInS3(filename) {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01'});
+
+  try {
+    await s3.headObject({
+      Bucket: config.aws_s3_bucket,
+      Key: filename,
+    }).promise();
+  } catch (e) {
+    if (e.code !== 'NotFound') {
+      // Only log if it's actually something we need to worry about.
+      logger.error(e);
+      metrics.increment('storage_errors_total', {operation: 'exists'});
+    }
+    return false;
+  }
+  return true;
+}
+
+/**
+ * Deletes an S3 object using `deleteObject`
+ *
+ * @async
+ * @param {String} filename `Key` for the S3 object to delete
+ * @return {Boolean} true if the object was deleted
+ */
+async function deleteFileFromS3(filename) {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01'});
+
+  try {
+    await s3.deleteObject({
+      Bucket: config.aws_s3_bucket,
+      Key: filename,
+    }).promise();
+  } catch (e) {
+    logger.error(e);
+    metrics.increment('storage_errors_total', {operation: 'delete'});
+    return false;
+  }
+  return true;
+}
+
+/**
+ * Creates an S3 object using a conditional `putObject` (`If-None-Match: *`),
+ * which fails when the object already exists.
+ *
+ * @async
+ * @param {*} contents the contents of the file
+ * @param {String} filename `Key` for the S3 object to create
+ * @return {Boolean} true if the object was created, false if it already exists (or the upload failed)
+ */
+async function createFileInS3(contents, filename) {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01'});
+
+  try {
+    await s3.putObject({
+      Bucket: config.aws_s3_bucket,
+      Key: filename,
+      Body: contents,
+      IfNoneMatch: '*',
+    }).promise();
+  } catch (e) {
+    // 412 when the object exists, 409 when a concurrent conditional write won the race
+    if (e.code !== 'PreconditionFailed' && e.code !== 'ConditionalRequestConflict') {
+      logger.error(e);
+      metrics.increment('storage_errors_total', {operation: 'upload'});
+    }
+    return false;
+  }
+  return true;
+}
+
+/**
+ * Lists all of the versions of an S3 object using `listObjectVersions`. This
+ * requires versioning to be enabled on the bucket.
+ *
+ * @async
+ * @param {String} filename `Key` for the S3 object
+ * @return {Array} list of versions with `VersionId`, `LastModified`, and `IsLatest`, newest first
+ */
+async function listFileVersionsInS3(filename) {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01'});
+
+  const versions = [];
+  let keyMarker = undefined;
+  let versionIdMarker = undefined;
+  try {
+    do {
+      const data = await s3.listObjectVersions({
+        Bucket: config.aws_s3_bucket,
+        Prefix: filename,
+        KeyMarker: keyMarker,
+        VersionIdMarker: versionIdMarker,
+      }).promise();
+      // The prefix can match other keys, so only keep the exact key
+      versions.push(...data.Versions.filter((version) => version.Key === filename));
+      keyMarker = data.IsTruncated ? data.NextKeyMarker : undefined;
+      versionIdMarker = data.IsTruncated ? data.NextVersionIdMarker : undefined;
+    } while (keyMarker);
+  } catch (e) {
+    logger.error(e);
+    metrics.increment('storage_errors_total', {operation: 'listVersions'});
+  }
+  return versions;
+}
+
+/**
+ * Retrieves the contents of a specific version of an S3 object
+ *
+ * @async
+ * @param {String} filename `Key` for the S3 object to retrieve
+ * @param {String} versionId the version of the S3 object to retrieve
+ * @return {*} contents of the file, or null if it can't be retrieved
+ */
+async function getFileVersionFromS3(filename, versionId) {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01'});
+
+  try {
+    const data = await s3.getObject({
+      Bucket: config.aws_s3_bucket,
+      Key: filename,
+      VersionId: versionId,
+    }).promise();
+    return data.Body;
+  } catch (e) {
+    logger.error(e);
+    metrics.increment('storage_errors_total', {operation: 'downloadVersion'});
+  }
+  return null;
+}
+
+/**
+ * Generates a pre-signed URL for an S3 object, so that it can be viewed
+ * without the bucket being public. The URL expires after the given time.
+ *
+ * @async
+ * @param {String} filename `Key` for the S3 object to share
+ * @param {Integer} expiresInSeconds # of seconds until the URL expires (max of 7 days)
+ * @return {String} the pre-signed URL, or null if it can't be generated
+ */
+async function getSignedUrlForS3(filename, expiresInSeconds) {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01', signatureVersion: 'v4'});
+
+  try {
+    return await s3.getSignedUrlPromise('getObject', {
+      Bucket: config.aws_s3_bucket,
+      Key: filename,
+      Expires: expiresInSeconds,
+    });
+  } catch (e) {
+    logger.error(e);
+    metrics.increment('storage_errors_total', {operation: 'sign'});
+  }
+  return null;
+}
+
+/**
+ * Uploads a file of a static website into S3, with the content type and
+ * cache control that the browsers are served it with.
+ *
+ * @async
+ * @param {*} contents the contents of the file
+ * @param {String} filename `Key` for the S3 object
+ * @param {String} contentType the content type, e.g. `text/html; charset=utf-8`
+ * @param {String} bucket the bucket that hosts the website
+ * @param {String} cacheControl the cache control, e.g. `max-age=60`
+ * @return {Object} Object with `ETag`, or null if the upload failed
+ */
+async function uploadWebsiteFileToS3(contents, filename, contentType, bucket, cacheControl = 'max-age=60') {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01'});
+
+  try {
+    return await s3.putObject({
+      Bucket: bucket,
+      Key: filename,
+      Body: contents,
+      ContentType: contentType,
+      CacheControl: cacheControl,
+    }).promise();
+  } catch (e) {
+    logger.error(e);
+    metrics.increment('storage_errors_total', {operation: 'upload'});
+  }
+  return null;
+}
+
+/**
+ * Enables static website hosting on the bucket, serving `index.html` for
+ * the directories.
+ *
+ * @async
+ * @param {String} bucket the bucket that hosts the website
+ * @return {Boolean} true if website hosting was enabled
+ */
+async function configureWebsiteBucket(bucket) {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01'});
+
+  try {
+    await s3.putBucketWebsite({
+      Bucket: bucket,
+      WebsiteConfiguration: {IndexDocument: {Suffix: 'index.html'}},
+    }).promise();
+    return true;
+  } catch (e) {
+    logger.error(e);
+  }
+  return false;
+}
+
+/**
+ * Allows browsers on any site to read the bucket's files (e.g. a widget on
+ * the team's website fetching the schedule).
+ *
+ * @async
+ * @param {String} bucket the bucket that the files are published to
+ * @return {Boolean} true if CORS was configured
+ */
+async function configureBucketCors(bucket) {
+  // Create S3 service object
+  const s3 = new AWS.S3({apiVersion: '2006-03-01'});
+
+  try {
+    await s3.putBucketCors({
+      Bucket: bucket,
+      CORSConfiguration: {CORSRules: [{AllowedMethods: ['GET', 'HEAD'], AllowedOrigins: ['*'], AllowedHeaders: ['*'], MaxAgeSeconds: 3600}]},
+    }).promise();
+    return true;
+  } catch (e) {
+    logger.error(e);
+  }
+  return false;
+}
+
 module.exports = {
   uploadFileToS3,
   getFileFromS3,
+  listFilesInS3,
+  existsInS3,
+  deleteFileFromS3,
+  createFileInS3,
+  listFileVersionsInS3,
+  getFileVersionFromS3,
+  getSignedUrlForS3,
+  uploadWebsiteFileToS3,
+  configureWebsiteBucket,
+  configureBucketCors,
   AWS, // export the entire AWS file so it can be re-used
 };
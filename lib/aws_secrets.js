@@ -0,0 +1,168 @@
+/* eslint-disable max-len */
+const AWS = require('aws-sdk');
+const {parseYaml, flattenConfig} = require('./config_file');
+const {logger} = require('./logger');
+
+/**
+ * Parses the contents of a secret into the secrets it holds. The contents
+ * can be a JSON object of key/value pairs (the default of the AWS console),
+ * or the contents of a YAML config file (e.g. `secrets.yaml`), whose nested
+ * keys are joined into the names, e.g. `twitter: {consumer_key: ...}` holds
+ * `TWITTER_CONSUMER_KEY` (see `flattenConfig()`).
+ *
+ * @param {String} contents the contents of the secret
+ * @return {Object} the secrets, by name
+ */
+function parseSecretContents(contents) {
+  let parsed;
+  try {
+    parsed = JSON.parse(contents);
+  } catch (e) {
+    parsed = parseYaml(contents, {});
+  }
+  return flattenConfig(parsed !== null && typeof parsed === 'object' ? parsed : {});
+}
+
+/**
+ * Reads the secrets from a single secret in AWS Secrets Manager, which holds
+ * all of them (see `parseSecretContents()`). It has the same interface as the
+ * HCP Vault Secrets client (see `lib/vault.js`), so that it can be cached by
+ * `SecretCache`. AWS authenticates with the credentials of the environment
+ * (e.g. the role of the Lambda function), so no API token is needed.
+ *
+ * @class SecretsManagerSource
+ * @typedef {SecretsManagerSource}
+ */
+class SecretsManagerSource {
+  /**
+   * Creates an instance of SecretsManagerSource.
+   *
+   * @constructor
+   * @param {String} secretId the name or ARN of the secret
+   * @param {Object} client the AWS Secrets Manager client
+   */
+  constructor(secretId, client = new AWS.SecretsManager({apiVersion: '2017-10-17'})) {
+    this.secretId = secretId;
+    this.client = client;
+  }
+
+  /**
+   * No API token is needed, since the requests are signed with the AWS credentials.
+   *
+   * @async
+   * @return {Boolean} always true
+   */
+  async retrieveApiToken() {
+    return true;
+  }
+
+  /**
+   * Retrieves the secrets, each with the version of the secret that holds them.
+   *
+   * @async
+   * @return {Map} map of secret name to `{value, version}`, or null on failure
+   */
+  async retrieveSecrets() {
+    try {
+      const result = await this.client.getSecretValue({SecretId: this.secretId}).promise();
+      const contents = result.SecretString !== undefined ? result.SecretString : Buffer.from(result.SecretBinary, 'base64').toString('utf8');
+      return new Map(Object.entries(parseSecretContents(contents)).map(([name, value]) => [name, {value, version: result.VersionId}]));
+    } catch (e) {
+      logger.error(e);
+    }
+    return null;
+  }
+
+  /**
+   * Retrieves the version of each of the secrets, i.e. the current version
+   * of the secret that holds them, to check whether it was rotated.
+   *
+   * @async
+   * @return {Map} map of secret name to the latest version, or null on failure
+   */
+  async retrieveSecretVersions() {
+    const secrets = await this.retrieveSecrets();
+    return secrets ? new Map([...secrets].map(([name, secret]) => [name, secret.version])) : null;
+  }
+}
+
+/**
+ * Reads the secrets from the parameters under a path in AWS Systems Manager
+ * Parameter Store, e.g. `/banditsNotification/TWITTER_CONSUMER_KEY`. Each
+ * parameter holds a single secret, named after the rest of its path (with
+ * `/` as `_`), except for the parameters ending with `.yaml` or `.json`,
+ * which hold several (see `parseSecretContents()`). SecureString parameters
+ * are decrypted. It has the same interface as the HCP Vault Secrets client.
+ *
+ * @class ParameterStoreSource
+ * @typedef {ParameterStoreSource}
+ */
+class ParameterStoreSource {
+  /**
+   * Creates an instance of ParameterStoreSource.
+   *
+   * @constructor
+   * @param {String} path the path of the parameters, e.g. `/banditsNotification`
+   * @param {Object} client the AWS SSM client
+   */
+  constructor(path, client = new AWS.SSM({apiVersion: '2014-11-06'})) {
+    this.path = path.replace(/\/+$/, '') || '/';
+    this.client = client;
+  }
+
+  /**
+   * No API token is needed, since the requests are signed with the AWS credentials.
+   *
+   * @async
+   * @return {Boolean} always true
+   */
+  async retrieveApiToken() {
+    return true;
+  }
+
+  /**
+   * Retrieves the secrets, each with the version of the parameter that holds it.
+   *
+   * @async
+   * @return {Map} map of secret name to `{value, version}`, or null on failure
+   */
+  async retrieveSecrets() {
+    try {
+      const secrets = new Map();
+      let nextToken = undefined;
+      do {
+        const result = await this.client.getParametersByPath({Path: this.path, Recursive: true, WithDecryption: true, NextToken: nextToken}).promise();
+        for (const parameter of result.Parameters) {
+          const name = parameter.Name.slice(this.path.length).replace(/^\/+/, '');
+          const values = /\.(ya?ml|json)$/i.test(name) ? parseSecretContents(parameter.Value) : flattenConfig({[name]: parameter.Value});
+          for (const [secretName, value] of Object.entries(values)) {
+            secrets.set(secretName, {value, version: `${parameter.Name}:${parameter.Version}`});
+          }
+        }
+        nextToken = result.NextToken;
+      } while (nextToken);
+      return secrets;
+    } catch (e) {
+      logger.error(e);
+    }
+    return null;
+  }
+
+  /**
+   * Retrieves the version of each of the secrets, i.e. the version of the
+   * parameter that holds it, to check whether it was rotated.
+   *
+   * @async
+   * @return {Map} map of secret name to the latest version, or null on failure
+   */
+  async retrieveSecretVersions() {
+    const secrets = await this.retrieveSecrets();
+    return secrets ? new Map([...secrets].map(([name, secret]) => [name, secret.version])) : null;
+  }
+}
+
+module.exports = {
+  parseSecretContents,
+  SecretsManagerSource,
+  ParameterStoreSource,
+};
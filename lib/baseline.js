@@ -0,0 +1,98 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {getScheduleAsOf} = require('./history');
+const {getDiffer} = require('./differ');
+const {formatChangeList} = require('./summary');
+const {logger} = require('./logger');
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+/**
+ * Keeps the details of a schedule entry that are compared, for the artifact.
+ *
+ * @param {Object} entry the schedule entry
+ * @return {Object} Object with the `location` and `timeBlock`
+ */
+function getEntryDetails(entry) {
+  return {location: entry['location'], timeBlock: entry['timeBlock']};
+}
+
+/**
+ * Builds the net changes between the baseline (the schedule as of N days
+ * ago) and the current schedule, i.e. what changed over the period once the
+ * changes that were undone are cancelled out.
+ *
+ * @param {Object} baseline the baseline, with its `timestamp` and `schedule`, see `getScheduleAsOf()`
+ * @param {Map} schedule the current schedule
+ * @param {Date} now the current date
+ * @param {Integer} days # of days back that the baseline was taken from
+ * @param {Object} differ the differ, see `getDiffer()`
+ * @return {Object} the net changes, with the `summary`, `changes` (as a list), and the `added`, `deleted`, and `modified` entries
+ */
+function buildNetChanges(baseline, schedule, now = new Date(), days = config.baseline_days, differ = getDiffer()) {
+  const scheduleDiff = {...differ.diff(baseline.schedule, schedule), previousSchedule: baseline.schedule};
+  return {
+    generatedAt: now.toISOString(),
+    days,
+    baselineAt: baseline.timestamp.toISOString(),
+    summary: differ.summarize(scheduleDiff),
+    changes: formatChangeList(scheduleDiff, Infinity, now),
+    added: [...scheduleDiff.added].map(([key, entry]) => ({key, ...getEntryDetails(entry)})),
+    deleted: [...scheduleDiff.deleted].map(([key, entry]) => ({key, ...getEntryDetails(entry)})),
+    modified: [...scheduleDiff.modified].map(([key, entry]) => ({key, previous: getEntryDetails(baseline.schedule.get(key)), current: getEntryDetails(entry)})),
+  };
+}
+
+/**
+ * Compares the current schedule against the archived schedule as of N days
+ * ago (rather than the previous run's), and saves the net changes to
+ * `<prefix>/netChanges.json`, for the weekly digest.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Map} schedule the current schedule
+ * @param {Object} store the storage that the archive is kept in
+ * @param {Date} now the current date
+ * @param {Integer} days # of days back to take the baseline from, or null to skip
+ * @return {Object} the net changes, see `buildNetChanges()`, or null if there's no baseline
+ */
+async function recordNetChanges(prefix, schedule, store = getStore(), now = new Date(), days = config.baseline_days) {
+  if (!days) {
+    return null;
+  }
+  const baseline = await getScheduleAsOf(prefix, new Date(now - days * DAY_MS), store);
+  if (!baseline) {
+    return null;
+  }
+  const netChanges = buildNetChanges(baseline, schedule, now, days);
+  await store.upload(`${prefix}/netChanges.json`, JSON.stringify(netChanges));
+  return netChanges;
+}
+
+/**
+ * Loads the team's latest net changes, see `recordNetChanges()`.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the net changes are kept in
+ * @return {Object} the net changes, or null if there are none
+ */
+async function loadNetChanges(prefix, store = getStore()) {
+  const data = await store.download(`${prefix}/netChanges.json`);
+  if (!data) {
+    return null;
+  }
+  try {
+    return JSON.parse(data);
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+module.exports = {
+  buildNetChanges,
+  recordNetChanges,
+  loadNetChanges,
+};
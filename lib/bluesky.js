@@ -0,0 +1,223 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const config = require('../config');
+const {logger} = require('./logger');
+
+/**
+ * Retrieves the Bluesky account that the team's updates are posted from: the
+ * team's `bluesky` in `TEAMS` (e.g. `{"handle": "bandits10u.bsky.social",
+ * "appPassword": "..."}`, optionally with its own `service`), or else
+ * `BLUESKY_HANDLE` and `BLUESKY_APP_PASSWORD`.
+ *
+ * @param {Object} team the team
+ * @return {Object} `{handle, appPassword, service}`, or null if Bluesky isn't configured for the team
+ */
+function getBlueskySettings(team) {
+  const settings = (team && team.bluesky) || {};
+  const handle = settings.handle || config.bluesky_handle;
+  const appPassword = settings.appPassword || config.bluesky_app_password;
+  return handle && appPassword ? {handle, appPassword, service: settings.service || config.bluesky_service} : null;
+}
+
+/**
+ * Creates a session against the Bluesky PDS (Personal Data Server) using the
+ * account handle and an app password.
+ *
+ * @async
+ * @param {String} handle the Bluesky handle, e.g. `banditsbot.bsky.social`
+ * @param {String} appPassword the app password generated in Bluesky settings
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @param {String} service the URL of the PDS
+ * @return {Object} Object with `accessJwt`, `did`, and `service`, or null on failure
+ */
+async function createSession(handle = config.bluesky_handle, appPassword = config.bluesky_app_password, signal = undefined, service = config.bluesky_service) {
+  try {
+    const result = await axios.post('/xrpc/com.atproto.server.createSession', {
+      identifier: handle,
+      password: appPassword,
+    },
+    {
+      baseURL: service,
+      headers: {'content-type': 'application/json'},
+      signal,
+    });
+    if (result.status !== 200) {
+      return null;
+    }
+    return {
+      accessJwt: result.data.accessJwt,
+      did: result.data.did,
+      service,
+    };
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Uploads binary data (i.e. the screenshot) as a blob. The returned blob
+ * reference is what gets embedded into the post record.
+ *
+ * @async
+ * @param {Object} session the session returned by `createSession()`
+ * @param {Buffer} contents the binary contents of the blob
+ * @param {String} mimeType the mime type of the blob
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @return {Object} the blob reference, or null on failure
+ */
+async function uploadBlob(session, contents, mimeType = 'image/png', signal = undefined) {
+  try {
+    const result = await axios.post('/xrpc/com.atproto.repo.uploadBlob', Buffer.from(contents), {
+      baseURL: session.service || config.bluesky_service,
+      headers: {
+        'content-type': mimeType,
+        'Authorization': `Bearer ${session.accessJwt}`,
+      },
+      signal,
+    });
+    if (result.status !== 200) {
+      return null;
+    }
+    return result.data.blob;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Bluesky does not automatically turn URLs in the text into links. Instead,
+ * they have to be described as "facets" which reference the UTF-8 byte
+ * offsets of the link within the text.
+ *
+ * @param {String} text the text of the post
+ * @return {Array} the list of link facets found in the text
+ */
+function detectLinkFacets(text) {
+  const facets = [];
+  const urlRegex = /https?:\/\/[^\s]+/g;
+  let match;
+  while ((match = urlRegex.exec(text)) !== null) {
+    const byteStart = Buffer.byteLength(text.slice(0, match.index), 'utf8');
+    const byteEnd = byteStart + Buffer.byteLength(match[0], 'utf8');
+    facets.push({
+      index: {byteStart, byteEnd},
+      features: [{
+        $type: 'app.bsky.richtext.facet#link',
+        uri: match[0],
+      }],
+    });
+  }
+  return facets;
+}
+
+/**
+ * Creates a post record, optionally embedding previously uploaded images.
+ *
+ * @async
+ * @param {Object} session the session returned by `createSession()`
+ * @param {String} text the text of the post
+ * @param {Array} images list of blob references returned by `uploadBlob()`
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @param {String} altText the alt text of the images, or empty for none
+ * @return {Object} Object with `uri` and `cid` of the post, or null on failure
+ */
+async function createPost(session, text, images = [], signal = undefined, altText = '') {
+  const record = {
+    $type: 'app.bsky.feed.post',
+    text,
+    createdAt: new Date().toISOString(),
+    facets: detectLinkFacets(text),
+  };
+  if (images.length) {
+    record.embed = {
+      $type: 'app.bsky.embed.images',
+      images: images.map((image) => ({alt: altText, image})),
+    };
+  }
+
+  try {
+    const result = await axios.post('/xrpc/com.atproto.repo.createRecord', {
+      repo: session.did,
+      collection: 'app.bsky.feed.post',
+      record,
+    },
+    {
+      baseURL: session.service || config.bluesky_service,
+      headers: {
+        'content-type': 'application/json',
+        'Authorization': `Bearer ${session.accessJwt}`,
+      },
+      signal,
+    });
+    if (result.status !== 200) {
+      return null;
+    }
+    return result.data;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Posts the screenshot to Bluesky along with the given text. This goes through
+ * the full flow of creating a session, uploading the blob, and creating the
+ * post record.
+ *
+ * @async
+ * @param {Buffer} imageBuffer the screenshot to be posted
+ * @param {String} text the text of the post
+ * @param {AbortSignal} signal the signal that cancels the requests
+ * @param {String} altText the alt text of the screenshot, or empty for none
+ * @param {Object} team the team, whose account is posted from, see `getBlueskySettings()`
+ * @return {Object} Object with `uri` and `cid` of the post, or null on failure
+ */
+async function postScreenshotToBluesky(imageBuffer, text, signal = undefined, altText = '', team = null) {
+  const settings = getBlueskySettings(team);
+  if (!settings) {
+    return null;
+  }
+  const session = await createSession(settings.handle, settings.appPassword, signal, settings.service);
+  if (!session) {
+    return null;
+  }
+  const blob = await uploadBlob(session, imageBuffer, 'image/png', signal);
+  if (!blob) {
+    return null;
+  }
+  return await createPost(session, text, [blob], signal, altText);
+}
+
+/**
+ * Checks that the accounts that the teams' updates are posted from can sign
+ * in, without posting anything.
+ *
+ * @async
+ * @param {Array} teams the configured teams
+ * @param {Function} signIn creates a session, see `createSession()`
+ * @return {String} the handles of the accounts
+ */
+async function checkBluesky(teams = config.teams, signIn = createSession) {
+  const accounts = new Map();
+  [...teams, null].map(getBlueskySettings).filter((settings) => settings).forEach((settings) => accounts.set(`${settings.service} ${settings.handle}`, settings));
+  const handles = [];
+  for (const settings of accounts.values()) {
+    if (!await signIn(settings.handle, settings.appPassword, undefined, settings.service)) {
+      throw new Error(`Unable to create a session for ${settings.handle}`);
+    }
+    handles.push(settings.handle);
+  }
+  return handles.join(', ');
+}
+
+module.exports = {
+  getBlueskySettings,
+  createSession,
+  uploadBlob,
+  detectLinkFacets,
+  createPost,
+  postScreenshotToBluesky,
+  checkBluesky,
+};
@@ -0,0 +1,159 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const config = require('../config');
+const {AWS} = require('./aws');
+const {checkTwitter, runWarmupChecks} = require('./warmup');
+const {getTwitterCredentials} = require('./twitter');
+const {getBlueskySettings, checkBluesky} = require('./bluesky');
+const {getMastodonSettings, checkMastodon} = require('./mastodon');
+const {getTelegramSettings, checkTelegram} = require('./telegram');
+const {getFacebookSettings, checkFacebook} = require('./facebook');
+const {getSlackSettings, checkSlack} = require('./slack');
+
+/**
+ * Checks that the Twilio account is active, without sending anything.
+ *
+ * @async
+ * @param {Object} http the HTTP client
+ * @return {String} the status of the account
+ */
+async function checkTwilio(http = axios) {
+  const result = await http.get(`/2010-04-01/Accounts/${config.twilio_account_sid}.json`, {
+    baseURL: 'https://api.twilio.com',
+    auth: {username: config.twilio_account_sid, password: config.twilio_auth_token},
+  });
+  if (result.data.status !== 'active') {
+    throw new Error(`The account is ${result.data.status}`);
+  }
+  return `account ${result.data.status}`;
+}
+
+/**
+ * Checks that each webhook still exists, with a HEAD request (e.g. a deleted
+ * Discord webhook responds with 404). A webhook that doesn't allow HEAD
+ * (405) is still reachable.
+ *
+ * @async
+ * @param {Array} webhooks the webhooks, see `config.webhooks`
+ * @param {Object} http the HTTP client
+ * @return {String} the # of webhooks that are reachable
+ */
+async function checkWebhooks(webhooks = config.webhooks, http = axios) {
+  const failures = [];
+  for (const webhook of webhooks) {
+    const host = new URL(webhook.url).host;
+    try {
+      const result = await http.head(webhook.url, {validateStatus: () => true});
+      if (result.status >= 400 && result.status !== 405) {
+        failures.push(`${host} responded ${result.status}`);
+      }
+    } catch (e) {
+      failures.push(`${host} ${e.message}`);
+    }
+  }
+  if (failures.length) {
+    throw new Error(`${failures.length} of ${webhooks.length} webhooks unreachable: ${failures.join('; ')}`);
+  }
+  return `${webhooks.length} reachable`;
+}
+
+/**
+ * Checks that SES can send, and whether the account is still in the
+ * sandbox, where only verified addresses receive email.
+ *
+ * @async
+ * @param {Object} ses the SES (v2) client
+ * @return {String} whether the account is in production or the sandbox
+ */
+async function checkEmail(ses = new AWS.SESV2({apiVersion: '2019-09-27'})) {
+  const account = await ses.getAccount({}).promise();
+  if (!account.SendingEnabled) {
+    throw new Error('Sending is disabled for the account');
+  }
+  return account.ProductionAccessEnabled ? 'production' : `sandbox, ${config.admin_email} must be verified`;
+}
+
+/**
+ * The notification channels whose readiness is checked at startup: whether
+ * each is configured, and the check that verifies it without side effects.
+ */
+const CHANNELS = {
+  twitter: {
+    configured: () => getTwitterCredentials().every((value) => value),
+    check: () => checkTwitter(),
+  },
+  bluesky: {
+    configured: () => [...config.teams, null].some((team) => getBlueskySettings(team)),
+    check: () => checkBluesky(),
+  },
+  mastodon: {
+    configured: () => [...config.teams, null].some((team) => getMastodonSettings(team)),
+    check: () => checkMastodon(),
+  },
+  telegram: {
+    configured: () => [...config.teams, null].some((team) => getTelegramSettings(team)),
+    check: () => checkTelegram(),
+  },
+  slack: {
+    configured: () => [...config.teams, null].some((team) => getSlackSettings(team)),
+    check: () => checkSlack(),
+  },
+  facebook: {
+    configured: () => [...config.teams, null].some((team) => getFacebookSettings(team)),
+    check: () => checkFacebook(),
+  },
+  sms: {
+    configured: () => config.sms_phone_numbers.length > 0,
+    check: async () => config.sms_provider === 'twilio' ? await checkTwilio() : `${config.sms_provider}, ${config.sms_phone_numbers.length} numbers`,
+  },
+  webhook: {
+    configured: () => config.webhooks.length > 0,
+    check: () => checkWebhooks(),
+  },
+  email: {
+    configured: () => !!(config.admin_email && config.email_from),
+    check: () => checkEmail(),
+  },
+};
+
+/**
+ * Checks the readiness of each notification channel, so that a dead sink
+ * (e.g. a deleted webhook, or revoked token) is discovered before a change
+ * needs to go out, rather than when it does.
+ *
+ * @async
+ * @param {Object} channels the channels, see `CHANNELS`
+ * @return {Array} list of `{name, status, detail}`, where the status is `ready`, `failed`, or `not configured`
+ */
+async function checkChannels(channels = CHANNELS) {
+  const configured = Object.entries(channels).filter(([name, channel]) => channel.configured());
+  const results = await runWarmupChecks(Object.fromEntries(configured.map(([name, channel]) => [name, channel.check])));
+  return Object.keys(channels).map((name) => {
+    const result = results.find((candidate) => candidate.name === name);
+    if (!result) {
+      return {name, status: 'not configured', detail: null};
+    }
+    return {name, status: result.ok ? 'ready' : 'failed', detail: result.detail};
+  });
+}
+
+/**
+ * Formats the readiness of the channels as a matrix, one channel per line.
+ *
+ * @param {Array} results the results, see `checkChannels()`
+ * @return {String} the matrix
+ */
+function formatChannelMatrix(results) {
+  const width = Math.max(...results.map((result) => result.name.length));
+  return results.map((result) => `${result.name.padEnd(width)}  ${result.status}${result.detail ? ` (${result.detail})` : ''}`).join('\n');
+}
+
+module.exports = {
+  CHANNELS,
+  checkMastodon,
+  checkTwilio,
+  checkWebhooks,
+  checkEmail,
+  checkChannels,
+  formatChannelMatrix,
+};
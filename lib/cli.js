@@ -0,0 +1,490 @@
+/* eslint-disable max-len */
+const fs = require('fs');
+const moment = require('moment-timezone');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {compareSchedules, deserializeSchedule, canonicalizeSchedule} = require('./helper_functions');
+const {listScheduleSnapshots, getEventTimeline, formatTimeline} = require('./timeline');
+const {parseAsOf, getScheduleAsOf, getSnapshotScreenshotKey} = require('./history');
+const {resolveScreenshotKey} = require('./screenshot_archive');
+const {restorePreviousSchedule} = require('./restore');
+const {withTeamLock} = require('./team_lock');
+const {getDiffer} = require('./differ');
+const {formatChangeList} = require('./summary');
+const {createLazyBrowser, createPageScraper, getHighlights} = require('./scrape');
+const {getTwitterClient, postTweet, deleteTweet} = require('./twitter');
+const {startOAuth2Login, completeOAuth2Login} = require('./twitter_oauth2');
+const {parseCsv, validateTeams, formatOnboardingReport} = require('./onboarding');
+const {checkChannels, formatChannelMatrix} = require('./channel_health');
+const {pruneArchive} = require('./retention');
+const {loadVerifyKey, verifyArchive} = require('./signing');
+const {INSIGHTS_QUERIES, formatInsightsQueries} = require('./pipeline_events');
+const {publishStatusSite} = require('./status_site');
+const {configureWebsiteBucket, configureBucketCors} = require('./aws');
+const {publishScheduleSnapshot} = require('./schedule_api');
+const {migrateStorage, verifyMigration} = require('./migrate_storage');
+const {buildStateMachineDefinition} = require('./pipeline');
+const {buildPreviewHtml, toDataUrl} = require('./preview');
+const {formatTimestamp} = require('./format');
+
+/**
+ * Parses the command line arguments into the flags (e.g. `--url <team id>`)
+ * and the remaining positional arguments.
+ *
+ * @param {Array} args the arguments, after the subcommand
+ * @param {Array} booleanFlags the flags that don't take a value
+ * @return {Object} Object with `flags` (by name, without the dashes) and `positionals`
+ */
+function parseArgs(args, booleanFlags = []) {
+  const flags = {};
+  const positionals = [];
+  for (let i = 0; i < args.length; i++) {
+    const match = args[i].match(/^--([a-z-]+)(?:=(.*))?$/);
+    if (!match) {
+      positionals.push(args[i]);
+    } else if (match[2] !== undefined) {
+      flags[match[1]] = match[2];
+    } else if (booleanFlags.includes(match[1])) {
+      flags[match[1]] = true;
+    } else {
+      flags[match[1]] = args[++i];
+    }
+  }
+  return {flags, positionals};
+}
+
+/**
+ * Finds the configured team by its id or URL. An unconfigured URL is
+ * treated as a one-off team, so that any page can be previewed.
+ *
+ * @param {String} value the team id or URL, or undefined for the first team
+ * @param {Array} teams the configured teams
+ * @return {Object} the team, or null if it isn't configured
+ */
+function resolveTeam(value, teams = config.teams) {
+  if (!value) {
+    return teams[0];
+  }
+  const team = teams.find((candidate) => candidate.id === value || candidate.url === value);
+  if (team) {
+    return team;
+  }
+  return /^https?:\/\//.test(value) ? {id: 'preview', url: value} : null;
+}
+
+/**
+ * Selects the configured teams to process, by their ids or URLs, so that a
+ * single team can be debugged or re-posted without running all of them.
+ *
+ * @param {Array} teams the configured teams
+ * @param {String} only the comma separated team ids or URLs, or undefined for every team
+ * @return {Array} the selected teams
+ */
+function selectTeams(teams, only = undefined) {
+  if (!only) {
+    return teams;
+  }
+  const identifiers = only.split(',').map((identifier) => identifier.trim()).filter((identifier) => identifier);
+  return teams.filter((team) => identifiers.includes(team.id) || identifiers.includes(team.url));
+}
+
+/**
+ * Formats a date for display, in the display time zone.
+ *
+ * @param {Date} date the date
+ * @return {String} the formatted date
+ */
+function formatDate(date) {
+  return formatTimestamp(date);
+}
+
+/**
+ * The subcommands, each with its `usage`, `description`, boolean `flags`,
+ * and `run`, which is called with the parsed arguments and returns the exit
+ * code (2 when the arguments are invalid). `check` runs the notifier itself,
+ * see `index.js`.
+ */
+const COMMANDS = {
+  check: {
+    usage: 'check [--once] [--only <team ids or URLs>] [--dry-run <directory>]',
+    description: 'Checks the schedules and posts the changes (the default behavior), optionally for only some of the teams, or once without saving or posting anything, writing the screenshot, preview, schedule, and report of each team to the directory instead',
+    flags: ['once'],
+  },
+  diff: {
+    usage: 'diff [--url <team id>] <from> <to>',
+    description: 'Compares the archived schedules as of two dates, e.g. 2023-10-01 2023-10-08',
+    run: async ({flags, positionals}, store = getStore(), output = console.log) => {
+      const team = resolveTeam(flags.url);
+      const [from, to] = positionals.map((value) => parseAsOf(value));
+      if (!team || !from || !to) {
+        return 2;
+      }
+      const before = await getScheduleAsOf(team.id, from, store);
+      const after = await getScheduleAsOf(team.id, to, store);
+      if (!after) {
+        output(`No schedule was archived for ${team.id} by ${formatDate(to)}.`);
+        return 1;
+      }
+      const previousSchedule = before ? before.schedule : new Map();
+      const scheduleDiff = {...compareSchedules(previousSchedule, after.schedule), previousSchedule};
+      output(`${team.id}: ${before ? formatDate(before.timestamp) : '(nothing archived)'} → ${formatDate(after.timestamp)}`);
+      output(`${getDiffer().summarize(scheduleDiff)}${formatChangeList(scheduleDiff) ? `: ${formatChangeList(scheduleDiff)}` : ''}`);
+      return 0;
+    },
+  },
+  history: {
+    usage: 'history [--url <team id>] [--season <season>] [--from <#> --to <#>] ["SATURDAY, 9/6"]',
+    description: 'Lists the archived schedules and screenshots (of a season, if given), compares two of them, or shows how a specific event changed across them',
+    run: async ({flags, positionals}, store = getStore(), output = console.log) => {
+      const team = resolveTeam(flags.url);
+      if (!team) {
+        return 2;
+      }
+      const key = positionals.join(' ').trim();
+      if (key) {
+        output(formatTimeline(key.toUpperCase(), await getEventTimeline(key, team.id, store, flags.season || null)));
+        return 0;
+      }
+      const snapshots = await listScheduleSnapshots(team.id, store, flags.season || null);
+      if (flags.from || flags.to) {
+        // Compare two of the archived versions, by their # in the list
+        const [before, after] = [flags.from, flags.to].map((value) => snapshots[parseInt(value) - 1]);
+        if (!before || !after) {
+          return 2;
+        }
+        const previousSchedule = await deserializeSchedule(before.key, store, before.timestamp);
+        const scheduleDiff = {...compareSchedules(previousSchedule, await deserializeSchedule(after.key, store, after.timestamp)), previousSchedule};
+        output(`${team.id}: #${flags.from} ${formatDate(before.timestamp)} → #${flags.to} ${formatDate(after.timestamp)}`);
+        output(`${getDiffer().summarize(scheduleDiff)}${formatChangeList(scheduleDiff) ? `: ${formatChangeList(scheduleDiff)}` : ''}`);
+        return 0;
+      }
+      const screenshotKeys = snapshots.map((snapshot) => getSnapshotScreenshotKey(snapshot.key));
+      let previousSchedule = null;
+      for (const [index, snapshot] of snapshots.entries()) {
+        const schedule = await deserializeSchedule(snapshot.key, store, snapshot.timestamp);
+        // Screenshots that looked the same as an earlier one point to it (see `lib/screenshot_archive.js`)
+        const screenshotKey = await resolveScreenshotKey(screenshotKeys[index], store);
+        let screenshot = 'no screenshot';
+        if (screenshotKey === screenshotKeys[index]) {
+          screenshot = `screenshot ${screenshotKey}`;
+        } else if (screenshotKey) {
+          screenshot = screenshotKeys.includes(screenshotKey) ? `screenshot same as #${screenshotKeys.indexOf(screenshotKey) + 1}` : `screenshot ${screenshotKey}`;
+        }
+        output(`#${index + 1} ${formatDate(snapshot.timestamp)} - ${schedule.size} entries, ${getDiffer().summarize(compareSchedules(previousSchedule, schedule)).toLowerCase()}, ${screenshot}`);
+        previousSchedule = schedule;
+      }
+      return 0;
+    },
+  },
+  restore: {
+    usage: 'restore [--url <team id>] --at <timestamp, e.g. 2023-10-06T16:00>',
+    description: 'Restores the previous schedule to how it was at an earlier time, to roll back a bad parse',
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      const at = moment.tz(flags.at, moment.ISO_8601, true, config.display_time_zone);
+      const team = resolveTeam(flags.url);
+      if (!flags.at || !at.isValid() || !team) {
+        return 2;
+      }
+      let result;
+      try {
+        // Don't restore in the middle of a run, which would overwrite it
+        result = await withTeamLock(team.id, () => restorePreviousSchedule(team.id, at.toDate(), store), store);
+      } catch (e) {
+        output(e.message);
+        return 1;
+      }
+      if (!result) {
+        output(`Nothing to restore for ${team.id} at or before ${at.format()}.`);
+        return 1;
+      }
+      output(`Restored ${team.id}/previousSchedule.json from ${result.source} ${result.id} (${moment(result.timestamp).tz(config.display_time_zone).format()}).`);
+      return 0;
+    },
+  },
+  prune: {
+    usage: 'prune [--url <team id>] [--max-age <days>] [--max-versions <count>] [--dry-run]',
+    description: 'Deletes the archived schedules and screenshots past the retention policy (ARCHIVE_MAX_AGE_DAYS and ARCHIVE_MAX_VERSIONS by default)',
+    flags: ['dry-run'],
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      const team = resolveTeam(flags.url);
+      const maxAgeDays = flags['max-age'] ? parseInt(flags['max-age']) : config.archive_max_age_days;
+      const maxVersions = flags['max-versions'] ? parseInt(flags['max-versions']) : config.archive_max_versions;
+      if (!team || Number.isNaN(maxAgeDays) || Number.isNaN(maxVersions) || (!maxAgeDays && !maxVersions)) {
+        return 2;
+      }
+      const {versions, pruned} = await pruneArchive(team.id, store, new Date(), maxAgeDays, maxVersions, !!flags['dry-run']);
+      pruned.forEach((key) => output(`${flags['dry-run'] ? 'Would delete' : 'Deleted'} ${key}`));
+      output(`${flags['dry-run'] ? 'Would prune' : 'Pruned'} ${pruned.length} files of the ${versions} archived versions of ${team.id}.`);
+      return 0;
+    },
+  },
+  'verify-archive': {
+    usage: 'verify-archive [--url <team id>] [--key <public key PEM file>]',
+    description: 'Verifies the archived schedules and screenshots against their signatures (ARCHIVE_SIGNING_KEY), to prove they weren\'t altered',
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      const team = resolveTeam(flags.url);
+      const publicKey = flags.key ? loadVerifyKey(fs.readFileSync(flags.key, 'utf8')) : loadVerifyKey();
+      if (!team || !publicKey) {
+        return 2;
+      }
+      const results = await verifyArchive(team.id, store, publicKey);
+      results.filter((result) => result.status !== 'verified').forEach((result) => output(`${result.status === 'tampered' ? 'TAMPERED' : 'unsigned'} ${result.key}${result.detail ? ` (${result.detail})` : ''}`));
+      const count = (status) => results.filter((result) => result.status === status).length;
+      output(`${team.id}: ${count('verified')} verified, ${count('tampered')} tampered, ${count('unsigned')} unsigned.`);
+      return count('tampered') ? 1 : 0;
+    },
+  },
+  preview: {
+    usage: 'preview [--url <team id or URL>] [--out <screenshot.png>] [--html <report.html>]',
+    description: 'Scrapes a page and shows the changes that would be posted, without saving or posting anything, optionally as an HTML report with the screenshot and the schedules side by side',
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      const team = resolveTeam(flags.url);
+      if (!team) {
+        return 2;
+      }
+      const browser = createLazyBrowser();
+      const scraper = createPageScraper(team, browser.get);
+      try {
+        const schedule = canonicalizeSchedule(await scraper.scrape(team));
+        const previousKey = `${team.id}/previousSchedule.json`;
+        const previousSchedule = await store.exists(previousKey) ? await deserializeSchedule(previousKey, store) : new Map();
+        const scheduleDiff = {...getDiffer().diff(previousSchedule, schedule), previousSchedule};
+        output(`Scraped ${schedule.size} entries from ${team.url}`);
+        output(`${getDiffer().summarize(scheduleDiff)}${formatChangeList(scheduleDiff) ? `: ${formatChangeList(scheduleDiff)}` : ''}`);
+        const screenshot = flags.out || flags.html ? await scraper.screenshot(team, undefined, getHighlights(scheduleDiff)) : null;
+        if (flags.out) {
+          fs.writeFileSync(flags.out, screenshot);
+          output(`Saved the screenshot to ${flags.out}`);
+        }
+        if (flags.html) {
+          fs.writeFileSync(flags.html, buildPreviewHtml(team, schedule, scheduleDiff, toDataUrl(screenshot)));
+          output(`Saved the report to ${flags.html}`);
+        }
+      } finally {
+        await scraper.close();
+        await browser.close();
+      }
+      return 0;
+    },
+  },
+  post: {
+    usage: 'post [--image <screenshot.png> [--alt <alt text>]] <text>',
+    description: 'Posts a tweet manually from the bot\'s account',
+    run: async ({flags, positionals}, store = getStore(), output = console.log) => {
+      const text = positionals.join(' ').trim();
+      if (!text) {
+        return 2;
+      }
+      const id = await postTweet(text, flags.image ? fs.readFileSync(flags.image) : null, await getTwitterClient(store), flags.alt || '');
+      output(`Posted https://twitter.com/${config.twitterUserHandle}/status/${id}`);
+      return 0;
+    },
+  },
+  'delete-tweet': {
+    usage: 'delete-tweet <tweet id>',
+    description: 'Deletes a tweet from the bot\'s account, e.g. one posted from a bad parse',
+    run: async ({positionals}, store = getStore(), output = console.log) => {
+      if (positionals.length !== 1 || !/^\d+$/.test(positionals[0])) {
+        return 2;
+      }
+      if (!await deleteTweet(positionals[0], await getTwitterClient(store))) {
+        output(`Tweet ${positionals[0]} wasn't deleted.`);
+        return 1;
+      }
+      output(`Deleted tweet ${positionals[0]}.`);
+      return 0;
+    },
+  },
+  'twitter-login': {
+    usage: 'twitter-login [--code <code> --state <state>]',
+    description: 'Logs the bot in to Twitter with OAuth2 (TWITTER_AUTH=oauth2): prints the URL to authorize the app at, then completes the login with the code and state it redirects with',
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      if (!config.twitter_client_id || !!flags.code !== !!flags.state) {
+        return 2;
+      }
+      if (!flags.code) {
+        output(`Authorize the app while logged in as @${config.twitterUserHandle}:\n${await startOAuth2Login(store)}`);
+        output('Then run this again with the `code` and `state` from the URL that it redirects to.');
+        return 0;
+      }
+      const token = await completeOAuth2Login(flags.code, flags.state, store);
+      output(`Logged in, the token (${token.scope.join(' ')}) is refreshed automatically.`);
+      return 0;
+    },
+  },
+  'publish-site': {
+    usage: 'publish-site [--url <team id>] [--configure]',
+    description: 'Publishes the status page of each team (or only one) to the STATUS_SITE_BUCKET, optionally enabling website hosting on the bucket first',
+    flags: ['configure'],
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      const teams = flags.url ? [resolveTeam(flags.url)] : config.teams;
+      if (!config.status_site_bucket || teams.some((team) => !team)) {
+        return 2;
+      }
+      if (flags.configure) {
+        if (!await configureWebsiteBucket(config.status_site_bucket)) {
+          output(`Unable to enable website hosting on ${config.status_site_bucket}.`);
+          return 1;
+        }
+        output(`Enabled website hosting on ${config.status_site_bucket}.`);
+      }
+      let failures = 0;
+      for (const team of teams) {
+        const result = await publishStatusSite(team, store);
+        if (!result) {
+          output(`${team.id}: nothing archived yet.`);
+          continue;
+        }
+        failures += result.failed.length;
+        output(`${team.id}: published ${result.published.join(', ')}${result.failed.length ? `, failed ${result.failed.join(', ')}` : ''}`);
+      }
+      return failures ? 1 : 0;
+    },
+  },
+  'publish-api': {
+    usage: 'publish-api [--url <team id>] [--configure]',
+    description: 'Publishes the latest.json of each team (or only one) to the SCHEDULE_API_BUCKET, optionally allowing browsers on other sites to read it first',
+    flags: ['configure'],
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      const teams = flags.url ? [resolveTeam(flags.url)] : config.teams;
+      if (!config.schedule_api_bucket || teams.some((team) => !team)) {
+        return 2;
+      }
+      if (flags.configure) {
+        if (!await configureBucketCors(config.schedule_api_bucket)) {
+          output(`Unable to configure CORS on ${config.schedule_api_bucket}.`);
+          return 1;
+        }
+        output(`Configured CORS on ${config.schedule_api_bucket}.`);
+      }
+      let failures = 0;
+      for (const team of teams) {
+        const filepath = `${team.id}/previousSchedule.json`;
+        if (!await store.exists(filepath)) {
+          output(`${team.id}: nothing scraped yet.`);
+          continue;
+        }
+        const key = await publishScheduleSnapshot(team, await deserializeSchedule(filepath, store), null, store);
+        failures += key ? 0 : 1;
+        output(`${team.id}: ${key ? `published ${key}` : 'failed'}`);
+      }
+      return failures ? 1 : 0;
+    },
+  },
+  'migrate-storage': {
+    usage: 'migrate-storage [--to <s3|local|dynamodb|postgres>] [--canonicalize] [--dry-run] [--verify]',
+    description: 'Copies the state and archive from the STORAGE_BACKEND to another backend, resuming where an interrupted migration stopped, optionally upgrading the stored schedules to the canonical format, then verifying the copy',
+    flags: ['canonicalize', 'dry-run', 'verify'],
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      const backend = flags.to || config.storage_backend;
+      if (!['s3', 'local', 'dynamodb', 'postgres'].includes(backend) || (backend === config.storage_backend && !flags.canonicalize)) {
+        return 2;
+      }
+      const target = backend === config.storage_backend ? store : getStore(backend);
+      const options = {canonicalize: !!flags.canonicalize, dryRun: !!flags['dry-run']};
+      if (!flags.verify) {
+        const result = await migrateStorage(store, target, {...options, onProgress: (done, total, key) => {
+          if (done % 100 === 0 || done === total) {
+            output(`${done}/${total} ${key}`);
+          }
+        }});
+        const summary = `${result.migrated} of ${result.total} key(s)${result.resumed ? ` (${result.resumed} already migrated)` : ''}, ${result.transformed} canonicalized`;
+        output(`${options.dryRun ? 'Would migrate' : 'Migrated'} ${summary} to ${backend}.`);
+        if (result.failed.length) {
+          output(`Failed to migrate ${result.failed.join(', ')}; run it again to resume.`);
+          return 1;
+        }
+        if (options.dryRun) {
+          return 0;
+        }
+      }
+      const problems = await verifyMigration(store, target, options);
+      problems.forEach((problem) => output(`${problem.key}: ${problem.problem}`));
+      output(problems.length ? `${problems.length} key(s) don't match in ${backend}.` : `Verified every key in ${backend}.`);
+      return problems.length ? 1 : 0;
+    },
+  },
+  channels: {
+    usage: 'channels',
+    description: 'Checks the readiness of each notification channel, without posting anything',
+    run: async (args, store = getStore(), output = console.log) => {
+      const results = await checkChannels();
+      output(formatChannelMatrix(results));
+      return results.some((result) => result.status === 'failed') ? 1 : 0;
+    },
+  },
+  'state-machine': {
+    usage: 'state-machine --arn <Lambda function ARN>',
+    description: 'Prints the Step Functions state machine definition that runs the Lambda in stages (scrape, diff, and notify)',
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      if (!flags.arn) {
+        return 2;
+      }
+      output(JSON.stringify(buildStateMachineDefinition(flags.arn), null, 2));
+      return 0;
+    },
+  },
+  queries: {
+    usage: 'queries [--name <query>] [--run <run id>]',
+    description: 'Prints the canned CloudWatch Logs Insights queries over the stage events (with LOG_FORMAT=json)',
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      const queries = formatInsightsQueries(flags.name, flags.run);
+      if (!queries) {
+        output(`Unknown query ${flags.name}, expected one of ${Object.keys(INSIGHTS_QUERIES).join(', ')}`);
+        return 2;
+      }
+      output(queries);
+      return 0;
+    },
+  },
+  onboard: {
+    usage: 'onboard --csv <teams.csv>',
+    description: 'Validates the teams in a CSV (name, url, handle, schedule, screenshot, watermark, parser, scraper) and prints the TEAMS config',
+    run: async ({flags}, store = getStore(), output = console.log) => {
+      if (!flags.csv) {
+        return 2;
+      }
+      const existingTeams = config.teams.filter((team) => team.id && team.url);
+      const browser = createLazyBrowser();
+      try {
+        const results = await validateTeams(parseCsv(fs.readFileSync(flags.csv, 'utf8')), async (team) => {
+          const scraper = createPageScraper(team, browser.get);
+          try {
+            return await scraper.scrape(team);
+          } finally {
+            await scraper.close();
+          }
+        }, existingTeams);
+        output(formatOnboardingReport(results, existingTeams));
+        return results.every((result) => !result.errors.length) ? 0 : 1;
+      } finally {
+        await browser.close();
+      }
+    },
+  },
+};
+
+/**
+ * Formats the usage of the subcommands.
+ *
+ * @param {String} name the subcommand, or undefined for all of them
+ * @return {String} the usage
+ */
+function formatUsage(name = undefined) {
+  if (name && COMMANDS[name]) {
+    return `Usage: node cli.js ${COMMANDS[name].usage}`;
+  }
+  const lines = ['Usage: node cli.js <command>', '', 'Commands:'];
+  for (const command of Object.values(COMMANDS)) {
+    lines.push(`  ${command.usage}`, `      ${command.description}`);
+  }
+  return lines.join('\n');
+}
+
+module.exports = {
+  COMMANDS,
+  parseArgs,
+  resolveTeam,
+  selectTeams,
+  formatUsage,
+};
@@ -0,0 +1,259 @@
+/* eslint-disable max-len */
+const fs = require('fs');
+
+// Environment variables with this prefix override the config file, with `__`
+// separating the nested keys, e.g. `BANDITS_AWS__S3_BUCKET` sets `AWS_S3_BUCKET`
+const OVERRIDE_PREFIX = 'BANDITS_';
+
+/**
+ * Replaces the `${NAME}` and `${NAME:-default}` references in the text with
+ * the values of the environment variables.
+ *
+ * @param {String} text the text
+ * @param {Object} env the environment variables
+ * @return {String} the text with the references replaced
+ */
+function interpolate(text, env = process.env) {
+  return text.replace(/\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}/g, (match, name, fallback) => env[name] !== undefined && env[name] !== '' ? env[name] : (fallback || ''));
+}
+
+/**
+ * Removes the comment from a line of YAML, leaving `#` within quotes alone.
+ *
+ * @param {String} line the line
+ * @return {String} the line without the comment
+ */
+function stripComment(line) {
+  let quote = null;
+  for (let i = 0; i < line.length; i++) {
+    const char = line[i];
+    if (quote) {
+      quote = char === quote ? null : quote;
+    } else if (char === '"' || char === '\'') {
+      quote = char;
+    } else if (char === '#' && (i === 0 || /\s/.test(line[i - 1]))) {
+      return line.slice(0, i);
+    }
+  }
+  return line;
+}
+
+/**
+ * Checks a value of a line of YAML for the syntax that isn't supported by
+ * `parseYaml()`, so that it's rejected rather than silently misread.
+ *
+ * @param {String} text the value, as written in the file
+ * @return {String} what isn't supported, or null if the value is supported
+ */
+function getUnsupportedSyntax(text) {
+  const value = text.trim();
+  if (/^[&*]/.test(value)) {
+    return 'anchors and aliases aren\'t supported';
+  }
+  if (/^!/.test(value)) {
+    return 'tags aren\'t supported';
+  }
+  if (/^[|>][-+0-9]*$/.test(value)) {
+    return 'multi-line strings aren\'t supported';
+  }
+  if (/^["']/.test(value) && !/^("(?:[^"\\]|\\.)*"|'(?:[^']|'')*')$/.test(value)) {
+    return 'quoted strings must be on a single line';
+  }
+  return null;
+}
+
+/**
+ * Parses a YAML scalar, after interpolating the environment variables. Flow
+ * collections (e.g. `{"parser": "text"}`) are parsed as JSON.
+ *
+ * @param {String} text the scalar
+ * @param {Object} env the environment variables
+ * @return {*} the value
+ * @throws {Error} when a flow collection isn't JSON
+ */
+function parseScalar(text, env) {
+  const value = interpolate(text.trim(), env);
+  if (/^".*"$/.test(value)) {
+    return JSON.parse(value);
+  }
+  if (/^'.*'$/.test(value)) {
+    return value.slice(1, -1).replace(/''/g, '\'');
+  }
+  if (/^[[{]/.test(value)) {
+    try {
+      return JSON.parse(value);
+    } catch (e) {
+      throw new Error(`flow collections must be JSON, e.g. ["a", "b"]: ${value}`);
+    }
+  }
+  if (/^(true|false)$/i.test(value)) {
+    return value.toLowerCase() === 'true';
+  }
+  if (/^(null|~)?$/.test(value)) {
+    return null;
+  }
+  if (/^-?\d+(\.\d+)?$/.test(value)) {
+    return parseFloat(value);
+  }
+  return value;
+}
+
+/**
+ * Parses the subset of YAML used by config files: nested mappings,
+ * sequences (of scalars or mappings), comments, and quoted or flow (JSON)
+ * scalars. `${NAME}` references to environment variables are interpolated.
+ * Anything else (e.g. quoted keys, anchors, or multi-line strings) is
+ * rejected, rather than misread.
+ *
+ * @param {String} text the YAML
+ * @param {Object} env the environment variables
+ * @return {Object} the parsed config
+ * @throws {Error} when the YAML is invalid or uses unsupported syntax
+ */
+function parseYaml(text, env = process.env) {
+  const lines = [];
+  text.split(/\r?\n/).forEach((raw, index) => {
+    const line = stripComment(raw).replace(/\s+$/, '');
+    if (line.trim() && line.trim() !== '---') {
+      lines.push({indent: line.length - line.trimStart().length, content: line.trim(), number: index + 1});
+    }
+  });
+  let i = 0;
+  const isSequenceItem = (line) => line.content === '-' || line.content.startsWith('- ');
+
+  const parseValue = (text, line) => {
+    const unsupported = getUnsupportedSyntax(text);
+    if (unsupported) {
+      throw new Error(`Unsupported YAML at line ${line.number} (${unsupported}): ${line.content}`);
+    }
+    try {
+      return parseScalar(text, env);
+    } catch (e) {
+      throw new Error(`Invalid YAML at line ${line.number}: ${e.message}`);
+    }
+  };
+
+  const parseBlock = (indent) => isSequenceItem(lines[i]) ? parseSequence(indent) : parseMapping(indent);
+
+  const parseMapping = (indent) => {
+    const mapping = {};
+    while (i < lines.length && lines[i].indent === indent && !isSequenceItem(lines[i])) {
+      if (/^["'?]/.test(lines[i].content)) {
+        throw new Error(`Unsupported YAML at line ${lines[i].number} (quoted and complex keys aren't supported): ${lines[i].content}`);
+      }
+      const match = lines[i].content.match(/^([^:]+?)\s*:(?:\s+(.*))?$/);
+      if (!match) {
+        throw new Error(`Invalid YAML at line ${lines[i].number}: ${lines[i].content}`);
+      }
+      const key = match[1];
+      const line = lines[i];
+      i++;
+      if (match[2] !== undefined) {
+        mapping[key] = parseValue(match[2], line);
+      } else if (i < lines.length && (lines[i].indent > indent || (lines[i].indent === indent && isSequenceItem(lines[i])))) {
+        mapping[key] = parseBlock(lines[i].indent);
+      } else {
+        mapping[key] = null;
+      }
+    }
+    if (i < lines.length && lines[i].indent > indent) {
+      throw new Error(`Invalid YAML indentation at line ${lines[i].number}: ${lines[i].content}`);
+    }
+    return mapping;
+  };
+
+  const parseSequence = (indent) => {
+    const sequence = [];
+    while (i < lines.length && lines[i].indent === indent && isSequenceItem(lines[i])) {
+      const rest = lines[i].content.slice(1).trim();
+      if (!rest) {
+        i++;
+        sequence.push(i < lines.length && lines[i].indent > indent ? parseBlock(lines[i].indent) : null);
+      } else if (/^[A-Za-z0-9_-]+\s*:(\s|$)/.test(rest)) {
+        // A mapping that starts on the same line as the dash, e.g. `- id: BlineBanditsBot`
+        lines[i] = {...lines[i], indent: indent + lines[i].content.indexOf(rest), content: rest};
+        sequence.push(parseMapping(lines[i].indent));
+      } else {
+        sequence.push(parseValue(rest, lines[i]));
+        i++;
+      }
+    }
+    return sequence;
+  };
+
+  return lines.length ? parseBlock(lines[0].indent) : {};
+}
+
+/**
+ * Flattens the config into environment variable names and values, e.g.
+ * `aws: {s3_bucket: ...}` into `AWS_S3_BUCKET`. Sequences of mappings are
+ * kept as JSON (e.g. `teams` into `TEAMS`), and other sequences are comma
+ * separated. Empty values are left out.
+ *
+ * @param {Object} config the parsed config
+ * @param {String} prefix the prefix of the names, for the nested keys
+ * @return {Object} the environment variables
+ */
+function flattenConfig(config, prefix = '') {
+  const variables = {};
+  for (const [key, value] of Object.entries(config || {})) {
+    const name = `${prefix}${key.toUpperCase().replace(/[^A-Z0-9]+/g, '_')}`;
+    if (value === null) {
+      continue;
+    } else if (Array.isArray(value)) {
+      // Lists of values are comma separated, like SMS_PHONE_NUMBERS, and lists of mappings are JSON, like TEAMS
+      variables[name] = value.some((item) => item !== null && typeof item === 'object') ? JSON.stringify(value) : value.join(',');
+    } else if (typeof value === 'object') {
+      Object.assign(variables, flattenConfig(value, `${name}_`));
+    } else {
+      variables[name] = `${value}`;
+    }
+  }
+  return variables;
+}
+
+/**
+ * Loads the plain YAML config file into the environment variables, which
+ * the config is read from. The environment variables that are already set
+ * (e.g. from `.env`) take precedence over the file, and the
+ * `BANDITS_`-prefixed ones (e.g. `BANDITS_AWS__S3_BUCKET`) take precedence
+ * over both, so that containers can override single settings.
+ *
+ * @param {String} filepath the path of the config file
+ * @param {Object} env the environment variables to populate
+ * @param {Boolean} required whether a missing file is an error
+ * @return {Object} the variables that were set from the file and overrides
+ */
+function loadConfigFile(filepath, env = process.env, required = false) {
+  const applied = {};
+  if (fs.existsSync(filepath)) {
+    try {
+      const variables = flattenConfig(parseYaml(fs.readFileSync(filepath, 'utf8'), env));
+      for (const [name, value] of Object.entries(variables)) {
+        if (env[name] === undefined) {
+          env[name] = value;
+          applied[name] = value;
+        }
+      }
+    } catch (e) {
+      console.error(`Unable to load the config file ${filepath}: ${e.message}`);
+    }
+  } else if (required) {
+    console.error(`The config file ${filepath} doesn't exist`);
+  }
+  for (const [name, value] of Object.entries(env)) {
+    if (name.startsWith(OVERRIDE_PREFIX) && name.length > OVERRIDE_PREFIX.length) {
+      const target = name.slice(OVERRIDE_PREFIX.length).replace(/__/g, '_');
+      env[target] = value;
+      applied[target] = value;
+    }
+  }
+  return applied;
+}
+
+module.exports = {
+  interpolate,
+  parseYaml,
+  flattenConfig,
+  loadConfigFile,
+};
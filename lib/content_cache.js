@@ -0,0 +1,147 @@
+/* eslint-disable max-len */
+const crypto = require('crypto');
+const axios = require('axios');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {getScheduleSourceText} = require('./parsers');
+const {logger} = require('./logger');
+
+// What the page looked like the last time it was checked and found unchanged
+const CONTENT_CACHE_FILENAME = 'contentCache.json';
+
+/**
+ * Hashes the parts with SHA-256.
+ *
+ * @param {Array} parts the strings or buffers to hash
+ * @return {String} the hex digest
+ */
+function hashParts(parts) {
+  const hash = crypto.createHash('sha256');
+  parts.forEach((part) => hash.update(part === null || part === undefined ? '' : part).update('\0'));
+  return hash.digest('hex');
+}
+
+/**
+ * Hashes the schedule section of the page (or the whole page, for the
+ * parsers that don't extract a section), along with the scrape settings, so
+ * that changing how the page is parsed doesn't count as unchanged.
+ *
+ * @param {Object} content the page's content, i.e. `{html, text}`
+ * @param {Object} settings the scrape settings, see `getScrapeSettings()`
+ * @return {String} the hash
+ */
+function hashScheduleContent(content, settings) {
+  const sourceText = getScheduleSourceText(content, settings);
+  return hashParts([JSON.stringify(settings), sourceText === null ? (content.html || content.text) : sourceText]);
+}
+
+/**
+ * Hashes the team's state that the diff depends on besides the page, i.e.
+ * the previous schedule and the manual overrides, so that a restore or a
+ * new override is never skipped.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ * @return {String} the hash
+ */
+async function hashTeamState(prefix, store = getStore()) {
+  return hashParts([await store.download(`${prefix}/previousSchedule.json`), await store.download(`${prefix}/overrides.json`)]);
+}
+
+/**
+ * Loads what the team's page looked like when it was last found unchanged.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ * @return {Object} `{contentHash, stateHash, etag, lastModified, pageHash, checkedAt}`, empty if there's none
+ */
+async function loadContentCache(prefix, store = getStore()) {
+  const data = await store.download(`${prefix}/${CONTENT_CACHE_FILENAME}`);
+  if (data) {
+    try {
+      return JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  return {};
+}
+
+/**
+ * Saves what the team's page looks like, once a run found it unchanged. It's
+ * only saved then, so that a run that fails (or posts) after the scrape is
+ * never skipped over.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} cache `{contentHash, stateHash, etag, lastModified, pageHash}`
+ * @param {Object} store the storage that the state is kept in
+ * @param {Date} now the current date
+ */
+async function saveContentCache(prefix, cache, store = getStore(), now = new Date()) {
+  await store.upload(`${prefix}/${CONTENT_CACHE_FILENAME}`, JSON.stringify({...cache, checkedAt: now.toISOString()}));
+}
+
+/**
+ * Checks the team's page with a plain HTTP request, before Chrome is
+ * launched: a `HEAD` for its `ETag` and `Last-Modified`, or, when the server
+ * sends neither, a `GET` of the page to hash. Pages that embed something
+ * different in every response (e.g. a nonce) never match, which only costs
+ * the request.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {AbortSignal} signal the signal that cancels the requests
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Object} `{etag, lastModified, pageHash}`, or null if the page couldn't be checked
+ */
+async function precheckPage(team, signal = undefined, http = axios) {
+  const options = {timeout: config.teamTimeout * 1000, signal};
+  try {
+    const head = await http.head(team.url, options);
+    const etag = head.headers['etag'] || null;
+    const lastModified = head.headers['last-modified'] || null;
+    if (etag || lastModified) {
+      return {etag, lastModified, pageHash: null};
+    }
+    const page = await http.get(team.url, {...options, responseType: 'text', transformResponse: (data) => data});
+    return {etag: null, lastModified: null, pageHash: hashParts([page.data])};
+  } catch (e) {
+    signal?.throwIfAborted();
+    logger.warn(`Unable to precheck ${team.url}: ${e.message}`);
+  }
+  return null;
+}
+
+/**
+ * Determines whether the page is unchanged since it was cached, by the
+ * strongest validator that both have: the `ETag`, then the `Last-Modified`,
+ * then the hash of the page.
+ *
+ * @param {Object} cache the cache, see `loadContentCache()`
+ * @param {Object} validators the page's validators, see `precheckPage()`
+ * @return {Boolean} true if the page is unchanged
+ */
+function isPageUnchanged(cache, validators) {
+  if (!validators) {
+    return false;
+  }
+  for (const name of ['etag', 'lastModified', 'pageHash']) {
+    if (cache[name] && validators[name]) {
+      return cache[name] === validators[name];
+    }
+  }
+  return false;
+}
+
+module.exports = {
+  CONTENT_CACHE_FILENAME,
+  hashScheduleContent,
+  hashTeamState,
+  loadContentCache,
+  saveContentCache,
+  precheckPage,
+  isPageUnchanged,
+};
@@ -0,0 +1,161 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+
+// Twitter counts every URL as 23 characters, regardless of its actual length
+const URL_WEIGHTED_LENGTH = 23;
+const URL_REGEX = /https?:\/\/[^\s]+/g;
+
+/**
+ * Calculates the length of the post the way the platforms count it, where
+ * each URL counts as a fixed number of characters.
+ *
+ * @param {String} text the text of the post
+ * @return {Integer} the weighted length of the post
+ */
+function getWeightedLength(text) {
+  const urls = text.match(URL_REGEX) || [];
+  const withoutUrls = text.replace(URL_REGEX, '');
+  return [...withoutUrls].length + urls.length * URL_WEIGHTED_LENGTH;
+}
+
+/**
+ * Normalizes the post text for duplicate detection, so that whitespace and
+ * casing differences don't hide a duplicate.
+ *
+ * @param {String} text the text of the post
+ * @return {String} the normalized text
+ */
+function normalizePostText(text) {
+  return `${text}`.toLowerCase().replace(/\s+/g, ' ').trim();
+}
+
+/**
+ * Shortens the post so that it fits within the maximum length. The URLs and
+ * hashtags at the end of the post are preserved, and the rest of the text is
+ * truncated with an ellipsis.
+ *
+ * @param {String} text the text of the post
+ * @param {Integer} maxLength the maximum weighted length
+ * @return {String} the shortened text, or null if it can't be shortened
+ */
+function shortenPost(text, maxLength) {
+  const suffixMatch = text.match(/(\s+(https?:\/\/[^\s]+|#\w+))+$/);
+  const suffix = suffixMatch ? suffixMatch[0] : '';
+  const body = [...text.slice(0, text.length - suffix.length)];
+  const available = maxLength - getWeightedLength(suffix) - 1; // 1 for the ellipsis
+  if (available <= 0) {
+    return null;
+  }
+  return `${body.slice(0, available).join('').trimEnd()}…${suffix}`;
+}
+
+/**
+ * Validates the post before it is sent, so that posts which are likely to be
+ * rejected by the platform's duplicate/spam filters are blocked or adjusted.
+ *
+ * @param {String} text the text of the post
+ * @param {Object} options the `maxLength`, `maxUrls`, `bannedWords`,
+ * `recentPosts` (list of `{text, timestamp}`), `duplicateWindowHours`, and `now`
+ * @return {Object} Object with `valid`, the (possibly adjusted) `text`,
+ * the list of `errors` that block the post, and the list of `adjustments`
+ */
+function validatePost(text, options = {}) {
+  const {
+    maxLength = config.post_max_length,
+    maxUrls = config.post_max_urls,
+    bannedWords = config.post_banned_words,
+    recentPosts = [],
+    duplicateWindowHours = config.post_duplicate_window_hours,
+    now = new Date(),
+  } = options;
+  const errors = [];
+  const adjustments = [];
+
+  if (!text || !text.trim()) {
+    errors.push('Post is empty');
+    return {valid: false, text, errors, adjustments};
+  }
+
+  const urlCount = (text.match(URL_REGEX) || []).length;
+  if (urlCount > maxUrls) {
+    errors.push(`Post contains ${urlCount} URLs, exceeding the maximum of ${maxUrls}`);
+  }
+
+  const lowercaseText = text.toLowerCase();
+  const foundWords = bannedWords.filter((word) => lowercaseText.includes(word.toLowerCase()));
+  if (foundWords.length) {
+    errors.push(`Post contains banned words: ${foundWords.join(', ')}`);
+  }
+
+  let adjustedText = text;
+  const length = getWeightedLength(text);
+  if (length > maxLength) {
+    adjustedText = shortenPost(text, maxLength);
+    if (adjustedText) {
+      adjustments.push(`Post shortened from ${length} to ${getWeightedLength(adjustedText)} characters`);
+    } else {
+      adjustedText = text;
+      errors.push(`Post is ${length} characters, exceeding the maximum of ${maxLength}`);
+    }
+  }
+
+  const windowStart = now.getTime() - duplicateWindowHours * 60 * 60 * 1000;
+  const normalizedText = normalizePostText(adjustedText);
+  const duplicate = recentPosts.find((post) => new Date(post.timestamp).getTime() >= windowStart && normalizePostText(post.text) === normalizedText);
+  if (duplicate) {
+    errors.push(`Post duplicates a post from ${duplicate.timestamp}, within the ${duplicateWindowHours} hour window`);
+  }
+
+  return {valid: errors.length === 0, text: adjustedText, errors, adjustments};
+}
+
+/**
+ * Retrieves the list of recent posts from storage, used for duplicate detection.
+ *
+ * @async
+ * @param {String} filepath the key of the recent posts file
+ * @param {Object} store the storage that the recent posts are kept in
+ * @return {Array} list of `{text, timestamp}` objects
+ */
+async function loadRecentPosts(filepath = `${config.twitterUserHandle}/recentPosts.json`, store = getStore()) {
+  const data = await store.download(filepath);
+  if (!data) {
+    return [];
+  }
+  try {
+    return JSON.parse(data);
+  } catch (e) {
+    logger.error(e);
+  }
+  return [];
+}
+
+/**
+ * Records the post in the list of recent posts in storage. Posts older than
+ * the duplicate window are pruned from the list.
+ *
+ * @async
+ * @param {String} text the text of the post that was sent
+ * @param {String} filepath the key of the recent posts file
+ * @param {Object} store the storage that the recent posts are kept in
+ * @param {Date} now the current date
+ * @return {Array} the updated list of recent posts
+ */
+async function recordRecentPost(text, filepath = `${config.twitterUserHandle}/recentPosts.json`, store = getStore(), now = new Date()) {
+  const windowStart = now.getTime() - config.post_duplicate_window_hours * 60 * 60 * 1000;
+  const recentPosts = (await loadRecentPosts(filepath, store)).filter((post) => new Date(post.timestamp).getTime() >= windowStart);
+  recentPosts.push({text, timestamp: now.toISOString()});
+  await store.upload(filepath, JSON.stringify(recentPosts));
+  return recentPosts;
+}
+
+module.exports = {
+  getWeightedLength,
+  normalizePostText,
+  shortenPost,
+  validatePost,
+  loadRecentPosts,
+  recordRecentPost,
+};
@@ -0,0 +1,182 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {logger} = require('./logger');
+
+/**
+ * Keeps track of the billable operations performed during a run, so that
+ * the cost of the run can be estimated.
+ *
+ * @class CostTracker
+ * @typedef {CostTracker}
+ */
+class CostTracker {
+  /**
+   * Creates an instance of CostTracker, starting the clock for the run.
+   *
+   * @constructor
+   * @param {Date} now the start of the run
+   */
+  constructor(now = new Date()) {
+    this.startTime = now;
+    this.endTime = null;
+    this.counts = {};
+  }
+
+  /**
+   * Records that a billable operation was performed.
+   *
+   * @param {String} operation one of `storageRead`, `storageWrite`, `twitterCall`, or `sms`
+   * @param {Integer} count the number of times the operation was performed
+   */
+  record(operation, count = 1) {
+    this.counts[operation] = (this.counts[operation] || 0) + count;
+  }
+
+  /**
+   * Stops the clock for the run, recording the compute time used.
+   *
+   * @param {Date} now the end of the run
+   */
+  finish(now = new Date()) {
+    this.endTime = now;
+    this.record('computeSecond', (this.endTime - this.startTime) / 1000);
+  }
+
+  /**
+   * Estimates the cost of the operations that were recorded.
+   *
+   * @param {Object} prices mapping of operation to price (in USD) per operation
+   * @return {Object} Object with the `total` cost and the cost `breakdown` per operation
+   */
+  estimate(prices = config.cost_prices) {
+    return estimateCost(this.counts, prices);
+  }
+}
+
+/**
+ * Estimates the cost of the given counts of operations.
+ *
+ * @param {Object} counts mapping of operation to the number of times it was performed
+ * @param {Object} prices mapping of operation to price (in USD) per operation
+ * @return {Object} Object with the `total` cost and the cost `breakdown` per operation
+ */
+function estimateCost(counts, prices = config.cost_prices) {
+  const breakdown = {};
+  let total = 0;
+  for (const [operation, count] of Object.entries(counts)) {
+    breakdown[operation] = count * (prices[operation] || 0);
+    total += breakdown[operation];
+  }
+  return {total, breakdown};
+}
+
+/**
+ * Wraps a store so that every storage request is recorded with the tracker.
+ *
+ * @class TrackedStore
+ * @typedef {TrackedStore}
+ */
+class TrackedStore {
+  /**
+   * Creates an instance of TrackedStore.
+   *
+   * @constructor
+   * @param {Object} store the store being wrapped
+   * @param {CostTracker} tracker the tracker that the requests are recorded with
+   */
+  constructor(store, tracker) {
+    this.store = store;
+    this.tracker = tracker;
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async upload(key, contents) {
+    this.tracker.record('storageWrite');
+    return await this.store.upload(key, contents);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async download(key) {
+    this.tracker.record('storageRead');
+    return await this.store.download(key);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async exists(key) {
+    this.tracker.record('storageRead');
+    return await this.store.exists(key);
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async delete(key) {
+    return await this.store.delete(key); // deletes are free
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async getShareUrl(key, expiresInSeconds) {
+    if (typeof this.store.getShareUrl !== 'function') {
+      return null;
+    }
+    return await this.store.getShareUrl(key, expiresInSeconds); // signing happens locally, so it's free
+  }
+
+  // eslint-disable-next-line require-jsdoc
+  async list(prefix) {
+    this.tracker.record('storageWrite'); // LIST requests are billed like PUT requests
+    return await this.store.list(prefix);
+  }
+}
+
+/**
+ * Formats the cost summary of the run for the logs.
+ *
+ * @param {CostTracker} tracker the tracker for the run
+ * @return {String} the cost summary, e.g. `$0.000021 (storageRead: 3, storageWrite: 4)`
+ */
+function formatCostSummary(tracker) {
+  const {total} = tracker.estimate();
+  const counts = Object.entries(tracker.counts)
+      .filter(([operation]) => operation !== 'computeSecond')
+      .map(([operation, count]) => `${operation}: ${count}`);
+  const seconds = tracker.counts.computeSecond || 0;
+  return `$${total.toFixed(6)} (${[...counts, `${seconds.toFixed(1)}s compute`].join(', ')})`;
+}
+
+/**
+ * Adds the counts of the run to the team's running total for the month, kept
+ * in storage at `<prefix>/costs/<YYYY-MM>.json`.
+ *
+ * @async
+ * @param {Object} store the storage that the totals are kept in
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {CostTracker} tracker the tracker for the run
+ * @return {Object} the monthly totals with `month`, `runs`, `counts`, and `total`
+ */
+async function recordMonthlyCosts(store, prefix, tracker) {
+  const month = tracker.startTime.toISOString().slice(0, 7);
+  const filepath = `${prefix}/costs/${month}.json`;
+  let totals = {month, runs: 0, counts: {}};
+  const data = await store.download(filepath);
+  if (data) {
+    try {
+      totals = JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  totals.runs += 1;
+  for (const [operation, count] of Object.entries(tracker.counts)) {
+    totals.counts[operation] = (totals.counts[operation] || 0) + count;
+  }
+  totals.total = estimateCost(totals.counts).total;
+  await store.upload(filepath, JSON.stringify(totals));
+  return totals;
+}
+
+module.exports = {
+  CostTracker,
+  TrackedStore,
+  estimateCost,
+  formatCostSummary,
+  recordMonthlyCosts,
+};
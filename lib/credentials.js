@@ -0,0 +1,188 @@
+/* eslint-disable max-len */
+const crypto = require('crypto');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+const {checkStorage, checkTwitter} = require('./warmup');
+const {getTwitterCredentials} = require('./twitter');
+const {createSession} = require('./bluesky');
+const {getExpiringCredentials} = require('./digest');
+const {sendEmail} = require('./email');
+
+/**
+ * The credentials are shared by all of the teams, so their health is kept at
+ * the top level of the storage rather than under a team's prefix.
+ */
+const CREDENTIALS_FILENAME = 'credentials.json';
+
+/**
+ * The credential sets that are monitored: the config values that make up
+ * each set (to notice when it's rotated), and the check that verifies it
+ * without side effects. Sets that aren't configured are skipped.
+ */
+const CREDENTIAL_SETS = {
+  twitter: {
+    values: () => getTwitterCredentials(),
+    check: () => checkTwitter(),
+  },
+  aws: {
+    values: () => [config.aws_access_token_id, config.aws_access_token_secret],
+    check: () => checkStorage(),
+  },
+  bluesky: {
+    values: () => [config.bluesky_handle, config.bluesky_app_password],
+    check: async () => {
+      if (!await createSession()) {
+        throw new Error('Unable to create a session');
+      }
+      return config.bluesky_handle;
+    },
+  },
+};
+
+/**
+ * Fingerprints the values of a credential set, so that a rotation can be
+ * noticed without keeping the secrets themselves in storage.
+ *
+ * @param {Array} values the values of the credential set
+ * @return {String} the fingerprint
+ */
+function fingerprintCredentials(values) {
+  return crypto.createHash('sha256').update(values.join('\n')).digest('hex').slice(0, 12);
+}
+
+/**
+ * Loads the health of the credentials, i.e. per credential set, when it was
+ * first seen (its age), last checked, last succeeded, and last failed.
+ *
+ * @async
+ * @param {Object} store the storage that the health is kept in
+ * @return {Object} mapping of the credential set's name to its health
+ */
+async function loadCredentialHealth(store = getStore()) {
+  try {
+    const data = await store.download(CREDENTIALS_FILENAME);
+    if (data) {
+      return JSON.parse(data);
+    }
+  } catch (e) {
+    logger.error(e);
+  }
+  return {};
+}
+
+/**
+ * Verifies the configured credential sets, and records their health. A set
+ * whose values changed since the last check (i.e. it was rotated) starts
+ * aging again.
+ *
+ * @async
+ * @param {Object} sets the credential sets, see `CREDENTIAL_SETS`
+ * @param {Object} store the storage that the health is kept in
+ * @param {Date} now the current date
+ * @return {Object} the updated health
+ */
+async function verifyCredentials(sets = CREDENTIAL_SETS, store = getStore(), now = new Date()) {
+  const health = await loadCredentialHealth(store);
+  for (const [name, set] of Object.entries(sets)) {
+    const values = set.values();
+    if (values.some((value) => !value)) {
+      continue; // not configured
+    }
+    const fingerprint = fingerprintCredentials(values);
+    let entry = health[name];
+    if (!entry || entry.fingerprint !== fingerprint) {
+      entry = {fingerprint, firstSeenAt: now.toISOString(), lastCheckedAt: null, lastSuccessAt: null, lastFailureAt: null, lastError: null};
+    }
+    entry.lastCheckedAt = now.toISOString();
+    try {
+      await set.check();
+      entry.lastSuccessAt = now.toISOString();
+      entry.lastError = null;
+    } catch (e) {
+      entry.lastFailureAt = now.toISOString();
+      entry.lastError = e.message;
+    }
+    health[name] = entry;
+  }
+  await store.upload(CREDENTIALS_FILENAME, JSON.stringify(health));
+  return health;
+}
+
+/**
+ * Determines what needs attention: credential sets that failed their last
+ * check, that are older than the maximum age (i.e. due for rotation), or
+ * that expire soon (see `CREDENTIAL_EXPIRATIONS`).
+ *
+ * @param {Object} health the health, see `verifyCredentials()`
+ * @param {Date} now the current date
+ * @param {Integer} maxAgeDays # of days after which a credential set is due for rotation (0 to never)
+ * @param {Object} expirations mapping of credential name to expiration date
+ * @return {Array} the alerts, as text
+ */
+function getCredentialAlerts(health, now = new Date(), maxAgeDays = config.credential_max_age, expirations = config.credential_expirations) {
+  const alerts = [];
+  for (const [name, entry] of Object.entries(health)) {
+    if (entry.lastError && entry.lastFailureAt === entry.lastCheckedAt) {
+      alerts.push(`${name} failed verification at ${entry.lastFailureAt}: ${entry.lastError} (last worked ${entry.lastSuccessAt || 'never'})`);
+    }
+    const ageDays = Math.floor((now - new Date(entry.firstSeenAt)) / (24 * 60 * 60 * 1000));
+    if (maxAgeDays && ageDays >= maxAgeDays) {
+      alerts.push(`${name} is ${ageDays} days old, and is due for rotation`);
+    }
+  }
+  for (const credential of getExpiringCredentials(expirations, now)) {
+    alerts.push(`${credential.name} ${credential.days < 0 ? 'expired' : `expires in ${credential.days} days`} (${credential.expiresAt.toISOString().slice(0, 10)})`);
+  }
+  return alerts;
+}
+
+/**
+ * Checks whether the credentials are due to be verified again.
+ *
+ * @param {Object} health the health, see `loadCredentialHealth()`
+ * @param {Date} now the current date
+ * @param {Integer} intervalSeconds # of seconds between the verifications
+ * @return {Boolean} true if the credentials are due to be verified
+ */
+function isCredentialCheckDue(health, now = new Date(), intervalSeconds = config.credential_check_interval) {
+  const checkedAt = Object.values(health).map((entry) => new Date(entry.lastCheckedAt)).filter((date) => !isNaN(date));
+  if (!checkedAt.length) {
+    return true;
+  }
+  return now - Math.min(...checkedAt) >= intervalSeconds * 1000;
+}
+
+/**
+ * Verifies the credentials when they're due, and alerts the admin (by email,
+ * when configured) about anything that needs attention, so that expired
+ * tokens are found before a change fails to post.
+ *
+ * @async
+ * @param {Object} store the storage that the health is kept in
+ * @param {Date} now the current date
+ * @param {Function} send sends the email, see `sendEmail()`
+ * @return {Array} the alerts, or null if the credentials weren't due to be verified
+ */
+async function monitorCredentials(store = getStore(), now = new Date(), send = sendEmail) {
+  if (!isCredentialCheckDue(await loadCredentialHealth(store), now)) {
+    return null;
+  }
+  const alerts = getCredentialAlerts(await verifyCredentials(CREDENTIAL_SETS, store, now), now);
+  alerts.forEach((alert) => logger.warn(`Credential alert: ${alert}`));
+  if (alerts.length && config.admin_email) {
+    await send(config.admin_email, `Bandits notification: ${alerts.length} credential alert(s)`, alerts.join('\n'));
+  }
+  return alerts;
+}
+
+module.exports = {
+  CREDENTIALS_FILENAME,
+  CREDENTIAL_SETS,
+  fingerprintCredentials,
+  loadCredentialHealth,
+  verifyCredentials,
+  getCredentialAlerts,
+  isCredentialCheckDue,
+  monitorCredentials,
+};
@@ -0,0 +1,132 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+const {sendEmail} = require('./email');
+const {canonicalizeSchedule, compareSchedules} = require('./helper_functions');
+const {HttpScraper} = require('./scrape');
+
+// Tracks the consecutive runs that the team's post was delayed for
+const CROSS_CHECK_FILENAME = 'crossCheck.json';
+
+/**
+ * Fetches the team's page with a plain HTTP request (rather than the
+ * browser) and parses the schedule, as the second opinion on the schedule.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @return {Map} the canonical schedule
+ */
+async function fetchLiveSchedule(team, signal = undefined) {
+  return canonicalizeSchedule(await new HttpScraper(null).scrape(team, signal));
+}
+
+/**
+ * Finds the entries that the two extractions of the schedule disagree on.
+ *
+ * @param {Map} extracted the schedule extracted in the browser
+ * @param {Map} live the schedule fetched with a plain HTTP request
+ * @return {Array} the keys of the entries that are missing from either, or that differ
+ */
+function findDisagreements(extracted, live) {
+  const {added, deleted, modified} = compareSchedules(canonicalizeSchedule(extracted), canonicalizeSchedule(live));
+  return [...added.keys(), ...deleted.keys(), ...modified.keys()].sort();
+}
+
+/**
+ * Checks the schedule extracted in the browser against the page fetched
+ * with a plain HTTP request, right before posting. When the page can't be
+ * parsed without the browser (e.g. it renders client-side), there's nothing
+ * to check against.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {Map} extracted the schedule extracted in the browser (before any overrides)
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @param {Function} fetch fetches the schedule, see `fetchLiveSchedule()`
+ * @param {Integer} tolerance the # of entries that can disagree
+ * @return {Object} `{status, disagreements}`, where the status is `agreed`, `disagreed`, or `unavailable`
+ */
+async function crossCheckSchedule(team, extracted, signal = undefined, fetch = fetchLiveSchedule, tolerance = config.cross_check_tolerance) {
+  let live;
+  try {
+    live = await fetch(team, signal);
+  } catch (e) {
+    signal?.throwIfAborted();
+    logger.warn(`Unable to cross-check the schedule of ${team.id}: ${e.message}`);
+    return {status: 'unavailable', disagreements: []};
+  }
+  if (!live.size) {
+    return {status: 'unavailable', disagreements: []};
+  }
+  const disagreements = findDisagreements(extracted, live);
+  return {status: disagreements.length > tolerance ? 'disagreed' : 'agreed', disagreements};
+}
+
+/**
+ * Records the outcome of the cross-check, and determines whether the post is
+ * delayed: it is when the extractions disagree, for up to the max # of
+ * consecutive runs, after which it's posted regardless.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} check the outcome of the cross-check, see `crossCheckSchedule()`
+ * @param {Object} store the storage that the state is kept in
+ * @param {Integer} maxDelays the max # of consecutive runs to delay the post for
+ * @param {Date} now the current date
+ * @return {Object} `{delayed, delays}`, with the # of consecutive runs that the post has been delayed for
+ */
+async function recordCrossCheck(prefix, check, store = getStore(), maxDelays = config.cross_check_max_delays, now = new Date()) {
+  const filepath = `${prefix}/${CROSS_CHECK_FILENAME}`;
+  if (check.status !== 'disagreed') {
+    if (await store.exists(filepath)) {
+      await store.delete(filepath);
+    }
+    return {delayed: false, delays: 0};
+  }
+  const data = await store.download(filepath);
+  const state = data ? JSON.parse(data) : {delays: 0, firstDelayedAt: now.toISOString()};
+  if (state.delays >= maxDelays) {
+    await store.delete(filepath);
+    return {delayed: false, delays: state.delays};
+  }
+  state.delays++;
+  state.disagreements = check.disagreements;
+  await store.upload(filepath, JSON.stringify(state));
+  return {delayed: true, delays: state.delays};
+}
+
+/**
+ * Alerts the admin (by email, when configured) that the extractions of the
+ * team's schedule disagree, once when the post is first delayed, and again
+ * when it's posted regardless.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {Object} check the outcome of the cross-check, see `crossCheckSchedule()`
+ * @param {Object} decision the decision, see `recordCrossCheck()`
+ * @param {Function} send sends the email, see `sendEmail()`
+ * @return {String} the alert, or null if there was nothing new to alert about
+ */
+async function alertCrossCheck(team, check, decision, send = sendEmail) {
+  if (check.status !== 'disagreed' || (decision.delayed && decision.delays > 1)) {
+    return null;
+  }
+  const action = decision.delayed ? 'The post is delayed until they agree' : `Posting anyway after ${decision.delays} delayed runs`;
+  const alert = `The schedule extracted in the browser for ${team.id} disagrees with the page fetched directly on ${check.disagreements.join(', ')}. ${action}.`;
+  logger.warn(`Cross-check alert: ${alert}`);
+  if (config.admin_email) {
+    await send(config.admin_email, `Bandits notification: ${team.id} schedule cross-check failed`, alert);
+  }
+  return alert;
+}
+
+module.exports = {
+  CROSS_CHECK_FILENAME,
+  fetchLiveSchedule,
+  findDisagreements,
+  crossCheckSchedule,
+  recordCrossCheck,
+  alertCrossCheck,
+};
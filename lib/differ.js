@@ -0,0 +1,229 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {compareSchedules, summarizeChanges, getKeyLabel} = require('./helper_functions');
+
+/**
+ * Determines whether two schedule entries have the same details, i.e. the
+ * same location and time block.
+ *
+ * @param {Object} a the first schedule entry
+ * @param {Object} b the second schedule entry
+ * @return {Boolean} true if the details are the same
+ */
+function sameDetails(a, b) {
+  return a['location'] === b['location'] && a['timeBlock'] === b['timeBlock'];
+}
+
+/**
+ * Splits the location of an entry, e.g. `Practice, Warren`, into the kind
+ * of event (`Practice`) and the place (`Warren`).
+ *
+ * @param {String} location the location of the schedule entry
+ * @return {Object} Object with `kind` and `place`
+ */
+function splitLocation(location) {
+  const parts = `${location}`.split(/, */);
+  if (parts.length < 2) {
+    return {kind: null, place: location};
+  }
+  return {kind: parts[0], place: parts.slice(1).join(', ')};
+}
+
+/**
+ * The default differ, which compares the schedules entry by entry, and
+ * summarizes the number of added, modified, and removed entries.
+ *
+ * @class EntryDiffer
+ * @typedef {EntryDiffer}
+ */
+class EntryDiffer {
+  /**
+   * Compares the previous schedule with the current schedule.
+   *
+   * @param {Map} previousSchedule the previous schedule
+   * @param {Map} schedule the current schedule
+   * @return {Object} Object with the `added`, `deleted`, `modified`, and `unchanged` entries
+   */
+  diff(previousSchedule, schedule) {
+    return compareSchedules(previousSchedule, schedule);
+  }
+
+  /**
+   * Summarizes the changes, e.g. `2 added, 1 modified`.
+   *
+   * @param {Object} scheduleDiff the output of `diff()`
+   * @return {String} the summary of the changes
+   */
+  summarize(scheduleDiff) {
+    return summarizeChanges(scheduleDiff);
+  }
+}
+
+/**
+ * A differ that understands how schedules are usually changed, and reports
+ * the changes at a higher level than individual entries:
+ * - reschedules, where an entry moved to another day as is
+ * - swaps, where two days exchanged their details
+ * - series changes, where several entries changed the same way, e.g. all
+ *   practices moved from Warren to Downes
+ *
+ * The entry level changes are still included, so anything that depends on
+ * them (e.g. severity classification) keeps working.
+ *
+ * @class SemanticDiffer
+ * @typedef {SemanticDiffer}
+ */
+class SemanticDiffer extends EntryDiffer {
+  /**
+   * Compares the previous schedule with the current schedule.
+   *
+   * @param {Map} previousSchedule the previous schedule
+   * @param {Map} schedule the current schedule
+   * @return {Object} Object with the `added`, `deleted`, `modified`, and `unchanged` entries,
+   * along with the higher level `semanticChanges`
+   */
+  diff(previousSchedule, schedule) {
+    const scheduleDiff = compareSchedules(previousSchedule, schedule);
+    const semanticChanges = [];
+    if (!previousSchedule) {
+      scheduleDiff.semanticChanges = semanticChanges;
+      return scheduleDiff;
+    }
+
+    // Reschedules: a removed entry that shows up as is on another day
+    const matchedAdded = new Set();
+    scheduleDiff.deleted.forEach((entry, from) => {
+      for (const [to, addedEntry] of scheduleDiff.added) {
+        if (to !== from && !matchedAdded.has(to) && sameDetails(entry, addedEntry)) {
+          matchedAdded.add(to);
+          semanticChanges.push({type: 'reschedule', keys: [from, to], from, to, location: entry['location']});
+          break;
+        }
+      }
+    });
+
+    // Swaps: two modified entries that exchanged their details
+    const swapped = new Set();
+    const modifiedKeys = [...scheduleDiff.modified.keys()];
+    modifiedKeys.forEach((a, i) => {
+      modifiedKeys.slice(i + 1).forEach((b) => {
+        if (swapped.has(a) || swapped.has(b)) {
+          return;
+        }
+        if (sameDetails(scheduleDiff.modified.get(a), previousSchedule.get(b)) && sameDetails(scheduleDiff.modified.get(b), previousSchedule.get(a))) {
+          swapped.add(a);
+          swapped.add(b);
+          semanticChanges.push({type: 'swap', keys: [a, b]});
+        }
+      });
+    });
+
+    // Series changes: several entries where only the location (or only the
+    // time) changed, in the same way
+    const series = new Map();
+    scheduleDiff.modified.forEach((entry, key) => {
+      if (swapped.has(key)) {
+        return;
+      }
+      const previous = previousSchedule.get(key);
+      let field = null;
+      if (previous['timeBlock'] === entry['timeBlock']) {
+        field = 'location';
+      } else if (previous['location'] === entry['location']) {
+        field = 'timeBlock';
+      } else {
+        return;
+      }
+      const groupKey = `${field}\u0000${previous[field]}\u0000${entry[field]}`;
+      if (!series.has(groupKey)) {
+        series.set(groupKey, {type: 'series', field, from: previous[field], to: entry[field], keys: []});
+      }
+      series.get(groupKey).keys.push(key);
+    });
+    series.forEach((change) => {
+      if (change.keys.length < 2) {
+        return;
+      }
+      // It's "all" of them when no entry is left with the old value
+      change.all = ![...schedule.values()].some((entry) => entry[change.field] === change.from);
+      semanticChanges.push(change);
+    });
+
+    scheduleDiff.semanticChanges = semanticChanges;
+    return scheduleDiff;
+  }
+
+  /**
+   * Describes a single semantic change, e.g. `All practices moved from
+   * Warren to Downes`.
+   *
+   * @param {Object} change the semantic change
+   * @param {Object} scheduleDiff the output of `diff()`
+   * @return {String} the description of the change
+   */
+  describe(change, scheduleDiff) {
+    if (change.type === 'reschedule') {
+      return `${change.location} moved from ${getKeyLabel(change.from)} to ${getKeyLabel(change.to)}`;
+    }
+    if (change.type === 'swap') {
+      return `${getKeyLabel(change.keys[0])} and ${getKeyLabel(change.keys[1])} swapped`;
+    }
+    const count = change.all ? 'All' : `${change.keys.length}`;
+    if (change.field === 'location') {
+      const from = splitLocation(change.from);
+      const to = splitLocation(change.to);
+      if (from.kind && from.kind === to.kind) {
+        return `${count} ${from.kind.toLowerCase()}s moved from ${from.place} to ${to.place}`;
+      }
+      return `${count} entries moved from ${change.from} to ${change.to}`;
+    }
+    const kinds = new Set(change.keys.map((key) => splitLocation(scheduleDiff.modified.get(key)['location']).kind));
+    const kind = kinds.size === 1 ? [...kinds][0] : null;
+    return `${count} ${kind ? `${kind.toLowerCase()}s` : 'entries'} moved from ${change.from} to ${change.to}`;
+  }
+
+  /**
+   * Summarizes the changes, leading with the semantic changes, followed by
+   * the number of entries that aren't covered by them, e.g. `All practices
+   * moved from Warren to Downes; 1 added`.
+   *
+   * @param {Object} scheduleDiff the output of `diff()`
+   * @return {String} the summary of the changes
+   */
+  summarize(scheduleDiff) {
+    const semanticChanges = scheduleDiff.semanticChanges || [];
+    if (!semanticChanges.length) {
+      return summarizeChanges(scheduleDiff);
+    }
+    const covered = new Set(semanticChanges.flatMap((change) => change.keys));
+    const remaining = {};
+    ['added', 'modified', 'deleted'].forEach((type) => {
+      remaining[type] = new Map([...scheduleDiff[type]].filter(([key]) => !covered.has(key)));
+    });
+    const parts = semanticChanges.map((change) => this.describe(change, scheduleDiff));
+    if (remaining.added.size || remaining.modified.size || remaining.deleted.size) {
+      parts.push(summarizeChanges(remaining));
+    }
+    return parts.join('; ');
+  }
+}
+
+/**
+ * Retrieves the differ for the configured diff algorithm (`entry` or
+ * `semantic`).
+ *
+ * @param {String} algorithm the diff algorithm
+ * @return {Object} the differ
+ */
+function getDiffer(algorithm = config.diff_algorithm) {
+  if (algorithm === 'semantic') {
+    return new SemanticDiffer();
+  }
+  return new EntryDiffer();
+}
+
+module.exports = {
+  EntryDiffer,
+  SemanticDiffer,
+  getDiffer,
+};
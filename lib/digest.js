@@ -0,0 +1,211 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {sendEmail} = require('./email');
+const {loadNetChanges} = require('./baseline');
+const {logger} = require('./logger');
+
+/**
+ * The digest covers all of the teams, so when it was last sent is kept at
+ * the top level of the storage rather than under a team's prefix.
+ */
+const DIGEST_FILENAME = 'digest.json';
+
+/**
+ * Records the summary of a run, in the team's run history for the day at
+ * `<prefix>/runs/<YYYY-MM-DD>.json`.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} summary Object with `startedAt`, `durationMs`, `outcome` (`unchanged`, `changed`, `failed`, or `cancelled`), and `error`
+ * @param {Object} store the storage that the run history is kept in
+ * @return {Array} the run history for the day
+ */
+async function recordRunSummary(prefix, summary, store = getStore()) {
+  const filepath = `${prefix}/runs/${summary.startedAt.slice(0, 10)}.json`;
+  let runs = [];
+  const data = await store.download(filepath);
+  if (data) {
+    try {
+      runs = JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  runs.push(summary);
+  await store.upload(filepath, JSON.stringify(runs));
+  return runs;
+}
+
+/**
+ * Loads the summaries of the team's runs since the given date.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Date} since the start of the period
+ * @param {Object} store the storage that the run history is kept in
+ * @return {Array} the run summaries, oldest first
+ */
+async function loadRunSummaries(prefix, since, store = getStore()) {
+  const runs = [];
+  const sinceDay = since.toISOString().slice(0, 10);
+  const files = (await store.list(`${prefix}/runs/`)).filter((file) => file.key.slice(-15, -5) >= sinceDay);
+  files.sort((a, b) => a.key.localeCompare(b.key));
+  for (const file of files) {
+    const data = await store.download(file.key);
+    if (!data) {
+      continue;
+    }
+    try {
+      runs.push(...JSON.parse(data).filter((run) => new Date(run.startedAt) >= since));
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  return runs;
+}
+
+/**
+ * Determines which credentials expire soon, from the configured expiration
+ * dates (most APIs don't report when their tokens expire).
+ *
+ * @param {Object} expirations mapping of credential name to expiration date, e.g. `{"twitter": "2024-01-31"}`
+ * @param {Date} now the current date
+ * @param {Integer} withinDays # of days ahead to look
+ * @return {Array} list of objects with `name`, `expiresAt`, and `days` left (negative when expired), soonest first
+ */
+function getExpiringCredentials(expirations = config.credential_expirations, now = new Date(), withinDays = 30) {
+  return Object.entries(expirations)
+      .map(([name, date]) => ({name, expiresAt: new Date(date), days: Math.floor((new Date(date) - now) / (24 * 60 * 60 * 1000))}))
+      .filter((credential) => !isNaN(credential.expiresAt) && credential.days <= withinDays)
+      .sort((a, b) => a.expiresAt - b.expiresAt);
+}
+
+/**
+ * Builds the ops digest for the past week: the runs executed, failures, and
+ * average durations per team, the quota usage for the month, and the
+ * credentials that expire soon.
+ *
+ * @async
+ * @param {Array} teams the teams, see `config.teams`
+ * @param {Object} store the storage that the run history and costs are kept in
+ * @param {Date} now the current date
+ * @param {Integer} days # of days that the digest covers
+ * @return {Object} Object with the `subject` and `text` of the digest
+ */
+async function buildDigest(teams = config.teams, store = getStore(), now = new Date(), days = 7) {
+  const since = new Date(now - days * 24 * 60 * 60 * 1000);
+  const month = now.toISOString().slice(0, 7);
+  const lines = [`Runs since ${since.toISOString().slice(0, 10)}:`];
+  let failures = 0;
+  for (const team of teams) {
+    const runs = await loadRunSummaries(team.id, since, store);
+    const failed = runs.filter((run) => run.outcome === 'failed' || run.outcome === 'cancelled');
+    failures += failed.length;
+    const averageSeconds = runs.length ? runs.reduce((total, run) => total + run.durationMs, 0) / runs.length / 1000 : 0;
+    lines.push(`- ${team.id}: ${runs.length} run(s), ${runs.filter((run) => run.outcome === 'changed').length} with changes, ${failed.length} failed, ${averageSeconds.toFixed(1)}s on average`);
+    if (failed.length) {
+      const last = failed[failed.length - 1];
+      lines.push(`  Last failure at ${last.startedAt}: ${last.error || last.outcome}`);
+    }
+    if (!runs.length) {
+      failures++; // no runs at all is the quietest failure of them all
+    }
+  }
+
+  // The net changes to each schedule, when tracked (see `BASELINE_DAYS`)
+  const netChanges = [];
+  for (const team of teams) {
+    const changes = await loadNetChanges(team.id, store);
+    if (changes && new Date(changes.generatedAt) >= since) {
+      netChanges.push(`- ${team.id}: ${changes.summary}${changes.changes ? ` (${changes.changes})` : ''}`);
+    }
+  }
+  if (netChanges.length) {
+    lines.push('', 'Net schedule changes:', ...netChanges);
+  }
+
+  lines.push('', `Quota usage for ${month}:`);
+  const counts = {};
+  for (const team of teams) {
+    const data = await store.download(`${team.id}/costs/${month}.json`);
+    if (!data) {
+      continue;
+    }
+    try {
+      for (const [operation, count] of Object.entries(JSON.parse(data).counts)) {
+        counts[operation] = (counts[operation] || 0) + count;
+      }
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  for (const operation of Object.keys(counts).filter((operation) => operation !== 'computeSecond').sort()) {
+    const limit = config.quota_limits[operation];
+    lines.push(`- ${operation}: ${Math.round(counts[operation])}${limit ? ` of ${limit} (${Math.round(counts[operation] / limit * 100)}%)` : ''}`);
+  }
+
+  const expiring = getExpiringCredentials(config.credential_expirations, now);
+  lines.push('', 'Credentials expiring in the next 30 days:');
+  if (!expiring.length) {
+    lines.push('- None');
+  }
+  for (const credential of expiring) {
+    lines.push(`- ${credential.name}: ${credential.days < 0 ? 'expired' : 'expires'} on ${credential.expiresAt.toISOString().slice(0, 10)}`);
+  }
+
+  const attention = failures + expiring.length;
+  return {
+    subject: `Bandits notification weekly digest: ${attention ? `${attention} item(s) need attention` : 'all healthy'}`,
+    text: lines.join('\n'),
+  };
+}
+
+/**
+ * Checks whether the digest is due, i.e. it hasn't been sent within the
+ * digest interval.
+ *
+ * @async
+ * @param {Object} store the storage that the digest state is kept in
+ * @param {Date} now the current date
+ * @return {Boolean} true if the digest is due
+ */
+async function isDigestDue(store = getStore(), now = new Date()) {
+  try {
+    const data = await store.download(DIGEST_FILENAME);
+    if (data) {
+      return now - new Date(JSON.parse(data).lastSentAt) >= config.digest_interval * 1000;
+    }
+  } catch (e) {
+    logger.error(e);
+  }
+  return true;
+}
+
+/**
+ * Builds and emails the digest to the admin, recording when it was sent.
+ *
+ * @async
+ * @param {Object} store the storage that the run history and digest state are kept in
+ * @param {Date} now the current date
+ * @param {Function} send sends the email, see `sendEmail()`
+ * @return {Boolean} true if the digest was sent
+ */
+async function sendDigest(store = getStore(), now = new Date(), send = sendEmail) {
+  const digest = await buildDigest(config.teams, store, now);
+  if (!await send(config.admin_email, digest.subject, digest.text)) {
+    return false;
+  }
+  await store.upload(DIGEST_FILENAME, JSON.stringify({lastSentAt: now.toISOString()}));
+  return true;
+}
+
+module.exports = {
+  DIGEST_FILENAME,
+  recordRunSummary,
+  loadRunSummaries,
+  getExpiringCredentials,
+  buildDigest,
+  isDigestDue,
+  sendDigest,
+};
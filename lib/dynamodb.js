@@ -0,0 +1,275 @@
+/* eslint-disable max-len */
+const path = require('path');
+const {AWS} = require('./aws');
+const {logger} = require('./logger');
+
+/**
+ * Storage that keeps the state (e.g. `previousSchedule.json`) and the archive
+ * metadata in a DynamoDB table, while the archived files themselves are kept
+ * in the blob store (i.e. S3), since they can exceed the DynamoDB item size.
+ *
+ * The table has a partition key `pk` (the directory of the key) and a sort
+ * key `sk` (the full key). Every write is conditional on the version that was
+ * last read, so that overlapping runs for the same team can't clobber each
+ * other's state.
+ *
+ * @class DynamoStore
+ * @typedef {DynamoStore}
+ */
+class DynamoStore {
+  /**
+   * Creates an instance of DynamoStore.
+   *
+   * @constructor
+   * @param {String} tableName the name of the DynamoDB table
+   * @param {Object} blobStore the store that the archived files are kept in
+   * @param {Object} client the DynamoDB DocumentClient
+   */
+  constructor(tableName, blobStore, client = new AWS.DynamoDB.DocumentClient({apiVersion: '2012-08-10'})) {
+    this.tableName = tableName;
+    this.blobStore = blobStore;
+    this.client = client;
+    this.versions = new Map(); // versions of the items that were read, used for the conditional writes
+  }
+
+  /**
+   * Determines the DynamoDB primary key for the key.
+   *
+   * @param {String} key the key (i.e. filename)
+   * @return {Object} Object with `pk` and `sk`
+   */
+  getPrimaryKey(key) {
+    return {pk: path.posix.dirname(key), sk: key};
+  }
+
+  /**
+   * Checks whether the key is part of the archive, in which case the file
+   * itself is kept in the blob store.
+   *
+   * @param {String} key the key (i.e. filename)
+   * @return {Boolean} true if the key is part of the archive
+   */
+  isArchiveKey(key) {
+    return key.includes('/archive/');
+  }
+
+  /**
+   * Retrieves the item for the key, remembering its version.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename)
+   * @return {Object} the item, or null if it doesn't exist
+   */
+  async getItem(key) {
+    const result = await this.client.get({
+      TableName: this.tableName,
+      Key: this.getPrimaryKey(key),
+      ConsistentRead: true,
+    }).promise();
+    const item = result.Item || null;
+    this.versions.set(key, item ? item.version : 0);
+    return item;
+  }
+
+  /**
+   * Uploads the contents to the given key. Writes are conditional on the
+   * version that was last read, and fail when another run wrote in between.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to upload to
+   * @param {*} contents the contents of the file
+   * @return {Boolean} true if the upload succeeded
+   */
+  async upload(key, contents) {
+    const item = {
+      ...this.getPrimaryKey(key),
+      updatedAt: new Date().toISOString(),
+    };
+    if (this.isArchiveKey(key)) {
+      if (!await this.blobStore.upload(key, contents)) {
+        return false;
+      }
+      item.kind = 'archive';
+      item.size = Buffer.byteLength(contents);
+    } else {
+      item.kind = 'state';
+      item.contents = typeof contents === 'string' ? contents : Buffer.from(contents);
+    }
+
+    const params = {TableName: this.tableName, Item: item};
+    if (this.versions.has(key)) {
+      const expectedVersion = this.versions.get(key);
+      item.version = expectedVersion + 1;
+      if (expectedVersion === 0) {
+        params.ConditionExpression = 'attribute_not_exists(sk)';
+      } else {
+        params.ConditionExpression = 'version = :expectedVersion';
+        params.ExpressionAttributeValues = {':expectedVersion': expectedVersion};
+      }
+    } else {
+      // Never read, so there's nothing to be conditional on
+      item.version = 1;
+    }
+
+    try {
+      await this.client.put(params).promise();
+    } catch (e) {
+      if (e.code === 'ConditionalCheckFailedException') {
+        logger.warn(`Concurrent write detected for ${key}, skipping the write`);
+      } else {
+        logger.error(e);
+      }
+      return false;
+    }
+    this.versions.set(key, item.version);
+    return true;
+  }
+
+  /**
+   * Downloads the contents of the given key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to download
+   * @return {Buffer} the contents, or null if the key doesn't exist
+   */
+  async download(key) {
+    let item = null;
+    try {
+      item = await this.getItem(key);
+    } catch (e) {
+      logger.error(e);
+      return null;
+    }
+    if (!item) {
+      return null;
+    }
+    if (item.kind === 'archive') {
+      return await this.blobStore.download(key);
+    }
+    return Buffer.from(item.contents);
+  }
+
+  /**
+   * Checks whether the given key exists.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to check
+   * @return {Boolean} true if the key exists
+   */
+  async exists(key) {
+    try {
+      return (await this.getItem(key)) !== null;
+    } catch (e) {
+      logger.error(e);
+    }
+    return false;
+  }
+
+  /**
+   * Deletes the given key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to delete
+   * @return {Boolean} true if the key was deleted
+   */
+  async delete(key) {
+    try {
+      await this.client.delete({
+        TableName: this.tableName,
+        Key: this.getPrimaryKey(key),
+      }).promise();
+    } catch (e) {
+      logger.error(e);
+      return false;
+    }
+    this.versions.delete(key);
+    if (this.isArchiveKey(key)) {
+      return await this.blobStore.delete(key);
+    }
+    return true;
+  }
+
+  /**
+   * Uploads the contents to the given key, unless the key already exists.
+   * Only the state (i.e. not the archive) can be created this way.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to create
+   * @param {*} contents the contents of the file
+   * @return {Boolean} true if the key was created, false if it already exists
+   */
+  async create(key, contents) {
+    const item = {
+      ...this.getPrimaryKey(key),
+      updatedAt: new Date().toISOString(),
+      kind: 'state',
+      contents: typeof contents === 'string' ? contents : Buffer.from(contents),
+      version: 1,
+    };
+    try {
+      await this.client.put({TableName: this.tableName, Item: item, ConditionExpression: 'attribute_not_exists(sk)'}).promise();
+    } catch (e) {
+      if (e.code !== 'ConditionalCheckFailedException') {
+        logger.error(e);
+      }
+      return false;
+    }
+    this.versions.set(key, item.version);
+    return true;
+  }
+
+  /**
+   * Generates a signed, expiring URL for an archived file, through the blob
+   * store. The state kept in the table can't be shared.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to share
+   * @param {Integer} expiresInSeconds # of seconds until the URL expires
+   * @return {String} the URL, or null if the key can't be shared
+   */
+  async getShareUrl(key, expiresInSeconds) {
+    if (!this.isArchiveKey(key) || typeof this.blobStore.getShareUrl !== 'function') {
+      return null;
+    }
+    return await this.blobStore.getShareUrl(key, expiresInSeconds);
+  }
+
+  /**
+   * Lists all of the keys that start with the prefix. Only the keys within
+   * the prefix's directory are listed (i.e. it is not recursive).
+   *
+   * @async
+   * @param {String} prefix the prefix of the keys to list
+   * @return {Array} list of objects with `key`, `lastModified`, and `size`
+   */
+  async list(prefix) {
+    const directory = prefix.endsWith('/') ? prefix.slice(0, -1) : path.posix.dirname(prefix);
+    const files = [];
+    let exclusiveStartKey = undefined;
+    try {
+      do {
+        const result = await this.client.query({
+          TableName: this.tableName,
+          KeyConditionExpression: 'pk = :pk AND begins_with(sk, :prefix)',
+          ExpressionAttributeValues: {':pk': directory, ':prefix': prefix},
+          ExclusiveStartKey: exclusiveStartKey,
+        }).promise();
+        for (const item of result.Items) {
+          files.push({
+            key: item.sk,
+            lastModified: new Date(item.updatedAt),
+            size: item.kind === 'archive' ? item.size : Buffer.byteLength(item.contents),
+          });
+        }
+        exclusiveStartKey = result.LastEvaluatedKey;
+      } while (exclusiveStartKey);
+    } catch (e) {
+      logger.error(e);
+    }
+    return files;
+  }
+}
+
+module.exports = {
+  DynamoStore,
+};
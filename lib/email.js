@@ -0,0 +1,147 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {AWS} = require('./aws');
+const {logger} = require('./logger');
+
+/**
+ * Sends a plain text email through AWS SES.
+ *
+ * @async
+ * @param {String} to the email address of the recipient
+ * @param {String} subject the subject of the email
+ * @param {String} text the body of the email
+ * @param {String} from the verified email address of the sender
+ * @param {Object} ses the SES client
+ * @return {String} the SES message id, or null on failure
+ */
+async function sendEmail(to, subject, text, from = config.email_from, ses = new AWS.SES({apiVersion: '2010-12-01'})) {
+  try {
+    const result = await ses.sendEmail({
+      Source: from,
+      Destination: {ToAddresses: [to]},
+      Message: {
+        Subject: {Data: subject, Charset: 'UTF-8'},
+        Body: {Text: {Data: text, Charset: 'UTF-8'}},
+      },
+    }).promise();
+    return result.MessageId;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Sends a plain text email with attachments (e.g. a screenshot) through AWS
+ * SES, as a raw MIME message.
+ *
+ * @async
+ * @param {String} to the email address of the recipient
+ * @param {String} subject the subject of the email
+ * @param {String} text the body of the email
+ * @param {Array} attachments list of `{filename, contentType, content}`
+ * @param {String} from the verified email address of the sender
+ * @param {Object} ses the SES client
+ * @return {String} the SES message id, or null on failure
+ */
+async function sendEmailWithAttachments(to, subject, text, attachments, from = config.email_from, ses = new AWS.SES({apiVersion: '2010-12-01'})) {
+  const boundary = `bandits-${Date.now().toString(36)}`;
+  const parts = [
+    `Content-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: base64\r\n\r\n${Buffer.from(text).toString('base64')}`,
+    ...attachments.map((attachment) => [
+      `Content-Type: ${attachment.contentType}; name="${attachment.filename}"`,
+      `Content-Disposition: attachment; filename="${attachment.filename}"`,
+      'Content-Transfer-Encoding: base64',
+      '',
+      Buffer.from(attachment.content).toString('base64').replace(/(.{76})/g, '$1\r\n'),
+    ].join('\r\n')),
+  ];
+  const message = [
+    `From: ${from}`,
+    `To: ${to}`,
+    `Subject: =?UTF-8?B?${Buffer.from(subject).toString('base64')}?=`,
+    'MIME-Version: 1.0',
+    `Content-Type: multipart/mixed; boundary="${boundary}"`,
+    '',
+    ...parts.map((part) => `--${boundary}\r\n${part}`),
+    `--${boundary}--`,
+  ].join('\r\n');
+  try {
+    const result = await ses.sendRawEmail({
+      Source: from,
+      Destinations: [to],
+      RawMessage: {Data: message},
+    }).promise();
+    return result.MessageId;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Sends an HTML email (with the plain text as the alternative) through AWS
+ * SES, as a raw MIME message. The inline images are referenced from the
+ * HTML by their content id, e.g. `<img src="cid:screenshot.png">`, since
+ * most email clients block `data:` URLs.
+ *
+ * @async
+ * @param {String} to the email address of the recipient
+ * @param {String} subject the subject of the email
+ * @param {String} text the plain text body of the email
+ * @param {String} html the HTML body of the email
+ * @param {Array} inlineImages list of `{filename, contentType, content}`, where the filename is the content id
+ * @param {String} from the verified email address of the sender
+ * @param {Object} ses the SES client
+ * @return {String} the SES message id, or null on failure
+ */
+async function sendHtmlEmail(to, subject, text, html, inlineImages = [], from = config.email_from, ses = new AWS.SES({apiVersion: '2010-12-01'})) {
+  const boundary = `bandits-${Date.now().toString(36)}`;
+  const alternative = `${boundary}-alt`;
+  const encode = (content) => Buffer.from(content).toString('base64').replace(/(.{76})/g, '$1\r\n');
+  const body = [
+    `Content-Type: multipart/alternative; boundary="${alternative}"`,
+    '',
+    `--${alternative}\r\nContent-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: base64\r\n\r\n${encode(text)}`,
+    `--${alternative}\r\nContent-Type: text/html; charset=UTF-8\r\nContent-Transfer-Encoding: base64\r\n\r\n${encode(html)}`,
+    `--${alternative}--`,
+  ].join('\r\n');
+  const parts = [
+    body,
+    ...inlineImages.map((image) => [
+      `Content-Type: ${image.contentType}; name="${image.filename}"`,
+      `Content-ID: <${image.filename}>`,
+      `Content-Disposition: inline; filename="${image.filename}"`,
+      'Content-Transfer-Encoding: base64',
+      '',
+      encode(image.content),
+    ].join('\r\n')),
+  ];
+  const message = [
+    `From: ${from}`,
+    `To: ${to}`,
+    `Subject: =?UTF-8?B?${Buffer.from(subject).toString('base64')}?=`,
+    'MIME-Version: 1.0',
+    `Content-Type: multipart/related; boundary="${boundary}"`,
+    '',
+    ...parts.map((part) => `--${boundary}\r\n${part}`),
+    `--${boundary}--`,
+  ].join('\r\n');
+  try {
+    const result = await ses.sendRawEmail({
+      Source: from,
+      Destinations: [to],
+      RawMessage: {Data: message},
+    }).promise();
+    return result.MessageId;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+module.exports = {
+  sendEmail,
+  sendEmailWithAttachments,
+  sendHtmlEmail,
+};
@@ -0,0 +1,58 @@
+/* eslint-disable max-len */
+const {selectTeams} = require('./cli');
+
+/**
+ * The modes that a run can be in, and the notification channels (see
+ * `SEVERITY_ROUTES`) that each one leaves out: `no-tweet` skips the social
+ * posts (Twitter and the cross-posts), and `silent` notifies no one, only
+ * archiving the changes (and publishing the change events, for the other
+ * systems).
+ */
+const RUN_MODES = {
+  'normal': [],
+  'no-tweet': ['social'],
+  'silent': ['social', 'sms', 'email', 'webhook'],
+};
+
+/**
+ * Leaves out the channels that the team's run mode skips.
+ *
+ * @param {Array} channels the channels for the severity of the changes, see `getChannelsForSeverity()`
+ * @param {String} mode the run mode, see `RUN_MODES`, or undefined for `normal`
+ * @return {Array} the channels to notify
+ */
+function applyRunMode(channels, mode = 'normal') {
+  const skipped = RUN_MODES[mode] || [];
+  return channels.filter((channel) => !skipped.includes(channel));
+}
+
+/**
+ * Parses the `detail` of an EventBridge event into the teams to check, so
+ * that separate rules can check different teams on different cadences, or
+ * in different modes, e.g. `{"urls": ["BlineBanditsBot"], "mode": "no-tweet"}`.
+ * Each of the `urls` is a team id or URL, as with `--only`.
+ *
+ * @param {Object} detail the `detail` of the event
+ * @param {Array} teams the configured teams
+ * @return {Object} `{teams}`, where each team carries its `mode`, or `{error}` for an invalid detail
+ */
+function parseEventDetail(detail, teams) {
+  if (detail.urls !== undefined && (!Array.isArray(detail.urls) || detail.urls.some((url) => typeof url !== 'string'))) {
+    return {error: 'Expected `urls` to be a list of team ids or URLs'};
+  }
+  if (detail.mode !== undefined && !(detail.mode in RUN_MODES)) {
+    return {error: `Expected \`mode\` to be one of ${Object.keys(RUN_MODES).join(', ')}`};
+  }
+  const selected = detail.urls ? selectTeams(teams, detail.urls.join(',')) : teams;
+  const unmatched = (detail.urls || []).filter((url) => !selected.some((team) => team.id === url || team.url === url));
+  if (unmatched.length) {
+    return {error: `No configured team matches ${unmatched.join(', ')}`};
+  }
+  return {teams: selected.map((team) => detail.mode ? {...team, mode: detail.mode} : team)};
+}
+
+module.exports = {
+  RUN_MODES,
+  applyRunMode,
+  parseEventDetail,
+};
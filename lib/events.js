@@ -0,0 +1,82 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {AWS} = require('./aws');
+const {logger} = require('./logger');
+
+/**
+ * Builds the ScheduleChanged event that is published after a change is
+ * detected, i.e. the change event (see `buildChangeEvent()`) along with
+ * where the screenshot was archived.
+ *
+ * @param {Object} changeEvent the output of `buildChangeEvent()`
+ * @param {String} screenshotKey the key of the archived screenshot
+ * @param {String} bucket the bucket that the screenshot is archived in
+ * @return {Object} the ScheduleChanged event
+ */
+function buildScheduleChangedEvent(changeEvent, screenshotKey, bucket = config.aws_s3_bucket) {
+  return {
+    ...changeEvent,
+    screenshot: {bucket: bucket || null, key: screenshotKey},
+  };
+}
+
+/**
+ * Builds the SNS message attributes for the event, so that subscribers can
+ * filter (e.g. only `critical` changes, or a single team).
+ *
+ * @param {Object} event the ScheduleChanged event
+ * @return {Object} the message attributes
+ */
+function getMessageAttributes(event) {
+  const attributes = {
+    eventType: {DataType: 'String', StringValue: 'ScheduleChanged'},
+    team: {DataType: 'String', StringValue: event.team},
+  };
+  if (event.severity) {
+    attributes.severity = {DataType: 'String', StringValue: event.severity};
+  }
+  return attributes;
+}
+
+/**
+ * Publishes the ScheduleChanged event to the SNS topic and/or SQS queue, so
+ * that other systems (e.g. reminders or data pipelines) can react to the
+ * change. Failures are logged, and don't stop the other target.
+ *
+ * @async
+ * @param {Object} event the ScheduleChanged event
+ * @param {String} topicArn the ARN of the SNS topic, if any
+ * @param {String} queueUrl the URL of the SQS queue, if any
+ * @param {Object} clients Object with the `sns` and `sqs` clients
+ * @return {Array} list of the targets that the event was published to
+ */
+async function publishScheduleChanged(event, topicArn = config.aws_sns_topic_arn, queueUrl = config.aws_sqs_queue_url, clients = {}) {
+  const body = JSON.stringify(event);
+  const attributes = getMessageAttributes(event);
+  const published = [];
+  if (topicArn) {
+    const sns = clients.sns || new AWS.SNS({apiVersion: '2010-03-31'});
+    try {
+      await sns.publish({TopicArn: topicArn, Message: body, MessageAttributes: attributes}).promise();
+      published.push(topicArn);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  if (queueUrl) {
+    const sqs = clients.sqs || new AWS.SQS({apiVersion: '2012-11-05'});
+    try {
+      await sqs.sendMessage({QueueUrl: queueUrl, MessageBody: body, MessageAttributes: attributes}).promise();
+      published.push(queueUrl);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  return published;
+}
+
+module.exports = {
+  buildScheduleChangedEvent,
+  getMessageAttributes,
+  publishScheduleChanged,
+};
@@ -0,0 +1,116 @@
+/* eslint-disable max-len */
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+const {getEngagementReport} = require('./link_tracking');
+
+// The formats that the posts can be split between, see `config.tweet_summary_style`
+const SUMMARY_STYLES = ['sentence', 'list', 'none'];
+
+// Tracks how many posts each variant of the team's experiment was assigned
+const EXPERIMENT_FILENAME = 'experiment.json';
+
+/**
+ * Retrieves the formatting experiment of the team, i.e. its `experiment` in
+ * `TEAMS`, e.g. `{"name": "summary-vs-image-only", "variants": ["sentence", "none"]}`,
+ * where the variants are summary styles (see `config.tweet_summary_style`).
+ *
+ * @param {Object} team the team
+ * @return {Object} `{name, variants}`, or null if the team has no (valid) experiment
+ */
+function getExperiment(team) {
+  const experiment = team && team.experiment;
+  if (!experiment) {
+    return null;
+  }
+  const variants = Array.isArray(experiment.variants) ? [...new Set(experiment.variants.map((variant) => `${variant}`.toLowerCase()))] : [];
+  if (!experiment.name || variants.length < 2 || !variants.every((variant) => SUMMARY_STYLES.includes(variant))) {
+    logger.warn(`Ignoring the experiment of ${team.id}: it needs a name and at least two variants of ${SUMMARY_STYLES.join(', ')}`);
+    return null;
+  }
+  return {name: `${experiment.name}`, variants};
+}
+
+/**
+ * Assigns the next post of the team to the variant that has been assigned
+ * the fewest posts so far, so that the split stays even however few posts
+ * there are. The counts start over when the experiment is renamed.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} experiment the experiment, see `getExperiment()`
+ * @param {Object} store the storage that the state is kept in
+ * @return {String} the variant, i.e. the summary style of the post
+ */
+async function assignVariant(prefix, experiment, store = getStore()) {
+  const filepath = `${prefix}/${EXPERIMENT_FILENAME}`;
+  let state = null;
+  const data = await store.download(filepath);
+  if (data) {
+    try {
+      state = JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  if (!state || state.name !== experiment.name) {
+    state = {name: experiment.name, assignments: {}};
+  }
+  const count = (variant) => state.assignments[variant] || 0;
+  const variant = experiment.variants.reduce((fewest, candidate) => count(candidate) < count(fewest) ? candidate : fewest);
+  state.assignments[variant] = count(variant) + 1;
+  await store.upload(filepath, JSON.stringify(state));
+  return variant;
+}
+
+/**
+ * Builds the report of the team's experiments from the tracked links: the
+ * # of posts of each variant, and how many times their links were clicked.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the links are kept in
+ * @return {Array} list of `{name, variants}`, with `{variant, notifications, clicks, clicksPerNotification}` per variant
+ */
+async function getExperimentReport(prefix, store = getStore()) {
+  const experiments = new Map();
+  for (const link of (await getEngagementReport(prefix, store)).links) {
+    if (!link.experiment) {
+      continue;
+    }
+    const {name, variant} = link.experiment;
+    if (!experiments.has(name)) {
+      experiments.set(name, new Map());
+    }
+    const variants = experiments.get(name);
+    const totals = variants.get(variant) || {variant, notifications: 0, clicks: 0};
+    totals.notifications++;
+    totals.clicks += link.clicks;
+    variants.set(variant, totals);
+  }
+  return [...experiments.entries()].map(([name, variants]) => ({
+    name,
+    variants: [...variants.values()].map((totals) => ({...totals, clicksPerNotification: totals.clicks / totals.notifications})),
+  }));
+}
+
+/**
+ * Formats the report of the experiments, one line per variant.
+ *
+ * @param {Array} report the report, see `getExperimentReport()`
+ * @return {String} the report
+ */
+function formatExperimentReport(report) {
+  return report.map((experiment) => [
+    `Experiment ${experiment.name}:`,
+    ...experiment.variants.map((totals) => `  ${totals.variant}: ${totals.clicks} click(s) across ${totals.notifications} notification(s), ${totals.clicksPerNotification.toFixed(2)} per notification`),
+  ].join('\n')).join('\n');
+}
+
+module.exports = {
+  SUMMARY_STYLES,
+  EXPERIMENT_FILENAME,
+  getExperiment,
+  assignVariant,
+  getExperimentReport,
+  formatExperimentReport,
+};
@@ -0,0 +1,88 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const config = require('../config');
+const {logger} = require('./logger');
+
+// The version of the Graph API that the photos are posted with
+const GRAPH_API_URL = 'https://graph.facebook.com/v18.0';
+
+/**
+ * Retrieves the Facebook Page that the team's updates are posted to: the
+ * team's `facebook` in `TEAMS` (e.g. `{"pageId": "1234567890",
+ * "accessToken": "..."}`), or else `FACEBOOK_PAGE_ID` and
+ * `FACEBOOK_PAGE_ACCESS_TOKEN`.
+ *
+ * @param {Object} team the team
+ * @return {Object} `{pageId, accessToken}`, or null if Facebook isn't configured for the team
+ */
+function getFacebookSettings(team) {
+  const settings = (team && team.facebook) || {};
+  const pageId = settings.pageId || config.facebook_page_id;
+  const accessToken = settings.accessToken || config.facebook_page_access_token;
+  return pageId && accessToken ? {pageId: `${pageId}`, accessToken} : null;
+}
+
+/**
+ * Posts the image (i.e. the composited preview, which reads better in a
+ * feed than the bare screenshot) to the team's Facebook Page, with the text
+ * as its caption.
+ *
+ * @async
+ * @param {Buffer} imageBuffer the image to be posted
+ * @param {String} text the caption of the photo
+ * @param {Object} team the team, whose Page is posted to, see `getFacebookSettings()`
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Object} Object with the `id` of the photo and the `post_id`, or null on failure
+ */
+async function postPhotoToFacebook(imageBuffer, text, team, signal = undefined, http = axios) {
+  const settings = getFacebookSettings(team);
+  if (!settings) {
+    return null;
+  }
+  try {
+    const form = new FormData();
+    form.append('source', new Blob([Buffer.from(imageBuffer)], {type: 'image/png'}), 'schedule.png');
+    form.append('caption', text);
+    form.append('access_token', settings.accessToken);
+    const result = await http.post(`${GRAPH_API_URL}/${settings.pageId}/photos`, form, {signal, validateStatus: () => true});
+    if (result.status !== 200 || !result.data || !result.data.id) {
+      logger.error(`Facebook rejected the photo: ${(result.data && result.data.error && result.data.error.message) || result.status}`);
+      return null;
+    }
+    return result.data;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Checks that the Pages that the teams' updates are posted to can still be
+ * reached with their tokens, without posting anything.
+ *
+ * @async
+ * @param {Array} teams the configured teams
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {String} the names of the Pages
+ */
+async function checkFacebook(teams = config.teams, http = axios) {
+  const pages = new Map();
+  [...teams, null].map(getFacebookSettings).filter((settings) => settings).forEach((settings) => pages.set(`${settings.pageId} ${settings.accessToken}`, settings));
+  const names = [];
+  for (const settings of pages.values()) {
+    const result = await http.get(`${GRAPH_API_URL}/${settings.pageId}`, {params: {fields: 'name', access_token: settings.accessToken}, validateStatus: () => true});
+    if (result.status !== 200 || !result.data || !result.data.name) {
+      throw new Error(`Page ${settings.pageId} was rejected: ${(result.data && result.data.error && result.data.error.message) || result.status}`);
+    }
+    names.push(result.data.name);
+  }
+  return names.join(', ');
+}
+
+module.exports = {
+  GRAPH_API_URL,
+  getFacebookSettings,
+  postPhotoToFacebook,
+  checkFacebook,
+};
@@ -0,0 +1,162 @@
+/* eslint-disable max-len */
+const moment = require('moment-timezone');
+const config = require('../config');
+const {getDiffer} = require('./differ');
+const {hasManualCorrections} = require('./overrides');
+const {summarizeInSentences, splitChangeList} = require('./summary');
+const {summarizeCatchUp} = require('./recovery');
+const {getWeightedLength} = require('./content_validator');
+
+// How the dates are displayed, e.g. "Saturday, October 7th 2023, 3:00 pm"
+const TIMESTAMP_FORMAT = 'dddd, MMMM Do YYYY, h:mm a';
+
+// The text of the post, after the summary of the changes (see `getTweetText()`)
+const DEFAULT_TWEET_TEMPLATE = 'Latest {name} Schedule as of {timestamp}{correction}. {link} {hashtags}';
+
+// The name and hashtags of the teams that don't set their own
+const DEFAULT_TEAM_NAME = 'Bandits 12U';
+const DEFAULT_HASHTAGS = ['bandits12u'];
+
+/**
+ * Formats the date for display, in the `DISPLAY_TIME_ZONE` (with the
+ * ordinal day, e.g. `7th`).
+ *
+ * @param {Date} date the date
+ * @param {String} timeZone the time zone that the date is displayed in
+ * @param {String} format the moment format, see `TIMESTAMP_FORMAT`
+ * @return {String} the formatted date
+ */
+function formatTimestamp(date = new Date(), timeZone = config.display_time_zone, format = TIMESTAMP_FORMAT) {
+  return moment(date).tz(timeZone).format(format);
+}
+
+/**
+ * Retrieves the team's display name, as used in the posts, the images, and
+ * the reports.
+ *
+ * @param {Object} team the team
+ * @return {String} the team's `name`, or the default
+ */
+function getTeamName(team = {}) {
+  return team.name || DEFAULT_TEAM_NAME;
+}
+
+/**
+ * Formats the team's hashtags for the posts, e.g. `#bandits12u #brookline`.
+ *
+ * @param {Object} team the team, with its `hashtags` as a list or a space separated string (with or without the `#`)
+ * @return {String} the hashtags
+ */
+function formatHashtags(team = {}) {
+  const hashtags = team.hashtags ?? DEFAULT_HASHTAGS;
+  return (Array.isArray(hashtags) ? hashtags : `${hashtags}`.split(/\s+/))
+      .map((hashtag) => hashtag.trim().replace(/^#/, ''))
+      .filter((hashtag) => hashtag)
+      .map((hashtag) => `#${hashtag}`)
+      .join(' ');
+}
+
+/**
+ * Fills in the `{placeholders}` of the template. Unknown placeholders are
+ * left as they are, so that a typo shows up in the post rather than
+ * disappearing.
+ *
+ * @param {String} template the template, e.g. `{name} schedule as of {timestamp}`
+ * @param {Object} values the values, by placeholder name
+ * @return {String} the text
+ */
+function renderTemplate(template, values) {
+  return template.replace(/\{(\w+)\}/g, (placeholder, name) => name in values ? `${values[name]}` : placeholder);
+}
+
+/**
+ * Retrieves the template of the team's posts: the team's `tweetTemplate`,
+ * the `TWEET_TEMPLATE`, or the default.
+ *
+ * @param {Object} team the team
+ * @return {String} the template, see `getTweetText()`
+ */
+function getTweetTemplate(team = {}) {
+  return team.tweetTemplate || config.tweet_template || DEFAULT_TWEET_TEMPLATE;
+}
+
+/**
+ * Summarizes the changes in a few words, e.g. `1 modified`, noting the
+ * outage that a catch-up diff covers.
+ *
+ * @param {Object} scheduleDiff the differences
+ * @return {String} the summary
+ */
+function getChangeSummary(scheduleDiff) {
+  const summary = getDiffer().summarize(scheduleDiff);
+  return scheduleDiff.catchUpSince ? summarizeCatchUp(scheduleDiff, summary) : summary;
+}
+
+/**
+ * Describes the changes in one or two sentences, e.g. "Saturday's game
+ * moved to 1pm; Tuesday practice cancelled."
+ *
+ * @param {Object} scheduleDiff the differences
+ * @return {String} the sentences
+ */
+function getLeadLine(scheduleDiff) {
+  const sentences = summarizeInSentences(scheduleDiff);
+  if (scheduleDiff.catchUpSince) {
+    return `${getChangeSummary(scheduleDiff)}.${sentences ? ` ${sentences}` : ''}`;
+  }
+  return sentences;
+}
+
+/**
+ * Builds the text of the post: the summary of the changes (in the given
+ * style), followed by the team's template (see `getTweetTemplate()`), with
+ * `{timestamp}`, `{correction}`, `{link}`, `{name}`, `{hashtags}`, and
+ * `{url}` filled in.
+ * A change list that doesn't fit is continued in the replies.
+ *
+ * @param {Object} scheduleDiff the differences
+ * @param {String} link the link to the page (or the tracked link)
+ * @param {Object} team the team
+ * @param {String} summaryStyle how the changes are summarized: `list`, `sentence`, or `none`
+ * @param {Date} now the time of the post
+ * @return {Object} `{text, replies}`
+ */
+function getTweetText(scheduleDiff, link, team = {}, summaryStyle = config.tweet_summary_style, now = new Date()) {
+  const status = renderTemplate(getTweetTemplate(team), {
+    timestamp: formatTimestamp(now, config.display_time_zone, 'dddd, MMMM Do YYYY, h:mm:ss a'),
+    correction: hasManualCorrections(scheduleDiff) ? ' (manually corrected)' : '',
+    link,
+    name: getTeamName(team),
+    hashtags: formatHashtags(team),
+    url: team.url || '',
+  });
+  let lead = null;
+  let replies = [];
+  if (summaryStyle === 'list') {
+    // The list is cut short to fit, rather than leaving it to the validator to truncate the post
+    const catchUp = scheduleDiff.catchUpSince ? `${getChangeSummary(scheduleDiff)}. ` : '';
+    const {list, remainder} = splitChangeList(scheduleDiff, config.post_max_length - getWeightedLength(`${catchUp} ${status}`));
+    lead = `${catchUp}${list || ''}`.trim();
+    if (config.tweet_thread_replies) {
+      replies = remainder;
+    }
+  } else if (summaryStyle === 'sentence') {
+    lead = getLeadLine(scheduleDiff);
+  } else if (scheduleDiff.catchUpSince) {
+    lead = `${getChangeSummary(scheduleDiff)}.`;
+  }
+  return {text: lead ? `${lead} ${status}` : status, replies};
+}
+
+module.exports = {
+  TIMESTAMP_FORMAT,
+  DEFAULT_TWEET_TEMPLATE,
+  formatTimestamp,
+  getTeamName,
+  formatHashtags,
+  renderTemplate,
+  getTweetTemplate,
+  getChangeSummary,
+  getLeadLine,
+  getTweetText,
+};
@@ -0,0 +1,133 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {sendAlertEmail, notifyAdmins} = require('./admin_notifier');
+const {metrics} = require('./metrics');
+const {formatRunResultsTable, hasFailedResults} = require('./run_results');
+const {logger} = require('./logger');
+
+// Tracks the team's consecutive failed runs, for alerting
+const HEALTH_FILENAME = 'health.json';
+
+/**
+ * Pings the healthcheck (e.g. Healthchecks.io or Cronitor) at the end of a
+ * run, so that missed runs are noticed by the absence of the ping. A run
+ * where a team failed pings the failure URL instead, with the results as
+ * the body.
+ *
+ * @async
+ * @param {Array} results the per-team results, see `processTeam()`
+ * @param {String} url the URL to ping, i.e. `HEALTHCHECK_URL`
+ * @param {String} failUrl the URL to ping when a team failed, defaulting to `<url>/fail` (as Healthchecks.io expects)
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Boolean} true if pinged, false if the ping failed, or null if there's no healthcheck
+ */
+async function pingHealthcheck(results, url = config.healthcheck_url, failUrl = config.healthcheck_fail_url, http = axios) {
+  if (!url) {
+    return null;
+  }
+  const target = hasFailedResults(results) ? failUrl || `${url.replace(/\/$/, '')}/fail` : url;
+  try {
+    await http.post(target, formatRunResultsTable(results), {headers: {'content-type': 'text/plain'}, timeout: 10000});
+    return true;
+  } catch (e) {
+    // The ping URL is a secret (anyone could ping it), so only the message is logged
+    logger.warn(`Unable to ping the healthcheck: ${e.message}`);
+  }
+  return false;
+}
+
+/**
+ * Records the heartbeat of the run, i.e. that it finished, and how many
+ * teams failed, as metrics. With `METRICS_EMF`, a CloudWatch alarm on the
+ * heartbeat (treating missing data as breaching) catches the missed runs.
+ *
+ * @param {Array} results the per-team results, see `processTeam()`
+ * @param {Date} now the time the run finished
+ */
+function recordHeartbeat(results, now = new Date()) {
+  metrics.increment('run_heartbeats_total');
+  metrics.set('run_failed_teams', {}, results.filter((result) => hasFailedResults([result])).length);
+  metrics.set('last_run_timestamp_seconds', {}, Math.floor(now.getTime() / 1000));
+  metrics.flushEmf();
+}
+
+/**
+ * Tracks the team's consecutive failed runs, and determines whether to
+ * alert: once when the failures reach the threshold, and once when the
+ * team recovers after that.
+ *
+ * @async
+ * @param {Object} result the team's result, see `processTeam()`
+ * @param {Object} store the storage that the state is kept in
+ * @param {Integer} threshold the # of consecutive failures to alert at
+ * @param {Date} now the time the run finished
+ * @return {Object} `{failures, since, lastError, alerted, transition}`, where the transition is `failing`, `recovered`, or null
+ */
+async function recordTeamHealth(result, store = getStore(), threshold = config.alert_failure_threshold, now = new Date()) {
+  const filepath = `${result.team}/${HEALTH_FILENAME}`;
+  let state = {failures: 0, since: null, lastError: null, alerted: false};
+  const data = await store.download(filepath);
+  if (data) {
+    try {
+      state = JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  let transition = null;
+  if (hasFailedResults([result])) {
+    state = {...state, failures: state.failures + 1, since: state.since || now.toISOString(), lastError: result.error};
+    if (state.failures >= threshold && !state.alerted) {
+      state.alerted = true;
+      transition = 'failing';
+    }
+  } else if (state.failures) {
+    transition = state.alerted ? 'recovered' : null;
+    state = {failures: 0, since: null, lastError: null, alerted: false};
+  } else {
+    return {...state, transition};
+  }
+  await store.upload(filepath, JSON.stringify(state));
+  return {...state, transition};
+}
+
+/**
+ * Reports the health of the run: alerts the admins about the teams that
+ * keep failing (or recovered), records the heartbeat, and pings the
+ * healthcheck. None of it fails the run.
+ *
+ * @async
+ * @param {Array} results the per-team results, see `processTeam()`
+ * @param {Object} store the storage that the state is kept in
+ * @param {Function} send sends the email, see `sendAlertEmail()`
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Array} the alerts that were sent
+ */
+async function reportRunHealth(results, store = getStore(), send = sendAlertEmail, http = axios) {
+  const alerts = [];
+  for (const result of results) {
+    const health = await recordTeamHealth(result, store);
+    if (health.transition === 'failing') {
+      const text = `${result.team} (${result.url}) has failed ${health.failures} runs in a row since ${health.since}. Last error: ${health.lastError}`;
+      logger.warn(`Health alert: ${text}`);
+      alerts.push({team: result.team, transition: health.transition, sent: await notifyAdmins(`Bandits notification: ${result.team} keeps failing`, text, null, send, http)});
+    } else if (health.transition === 'recovered') {
+      const text = `${result.team} (${result.url}) is running again (${result.outcome}).`;
+      logger.info(`Health alert: ${text}`);
+      alerts.push({team: result.team, transition: health.transition, sent: await notifyAdmins(`Bandits notification: ${result.team} recovered`, text, null, send, http)});
+    }
+  }
+  recordHeartbeat(results);
+  await pingHealthcheck(results, config.healthcheck_url, config.healthcheck_fail_url, http);
+  return alerts;
+}
+
+module.exports = {
+  HEALTH_FILENAME,
+  pingHealthcheck,
+  recordHeartbeat,
+  recordTeamHealth,
+  reportRunHealth,
+};
@@ -1,10 +1,9 @@
 /* eslint-disable require-jsdoc */
 /* eslint-disable max-len */
 const moment = require('moment-timezone');
-const chrono = require('chrono-node');
 const {EJSON} = require('bson');
 const config = require('../config');
-const {uploadFileToS3, getFileFromS3} = require('./aws');
+const {getStore} = require('./storage');
 
 /**
  * Eliminates two types of characters that are confusing/annoying.
@@ -24,45 +23,414 @@ function sanitizeText(text) {
   return text.replace(/[\u200B-\u200D\uFEFF]/g, '').replace(/–/, '-').trim();
 }
 
-function parseSchedule(text) {
+/**
+ * Determines whether a time is AM or PM. An explicit `am`/`pm` wins.
+ * Otherwise, the hours reflect when the team plays: 8-11 are morning games
+ * on the weekend, while everything else (including 12) is in the afternoon
+ * or evening.
+ *
+ * @param {Integer} hour the hour on a 12-hour clock
+ * @param {String} meridiem the explicit `a` or `p`, if any
+ * @return {Integer} the hour on a 24-hour clock
+ */
+function to24Hour(hour, meridiem) {
+  if (meridiem) {
+    return (hour % 12) + (meridiem === 'p' ? 12 : 0);
+  }
+  return hour >= 8 && hour <= 11 ? hour : (hour % 12) + 12;
+}
+
+/**
+ * Resolves the time block of a schedule entry, e.g. `3:30–6:00` or
+ * `10:30am`, into actual dates in the given time zone. The year is inferred
+ * from the day of the month (see `getEntryDate()`), and AM/PM from the
+ * season's playing hours when it isn't explicit. The end of a range always
+ * falls after its start.
+ *
+ * @param {String} dayOfMonth the day of the month, e.g. `10/3`
+ * @param {String} details the block of information for the day
+ * @param {Date} now the current date
+ * @param {String} timeZone the time zone that the schedule is in
+ * @return {Object} Object with `start` and `end` (Date, or null without a range), or null if there is no time
+ */
+function parseTime(dayOfMonth, details, now = new Date(), timeZone = config.display_time_zone) {
+  const entryDate = getEntryDate(dayOfMonth, now);
+  const match = `${details}`.match(/(\d{1,2}):(\d{2})\s*(?:([ap])\.?m\.?)?(?:\s*[-\u2010-\u2015\u2212]\s*(\d{1,2}):(\d{2})\s*(?:([ap])\.?m\.?)?)?/i);
+  if (!entryDate || !match) {
+    return null;
+  }
+  const [startHour, startMinute, endHour, endMinute] = [match[1], match[2], match[4], match[5]].map((value) => parseInt(value));
+  const startMeridiem = match[3] && match[3].toLowerCase();
+  const endMeridiem = match[6] && match[6].toLowerCase();
+  const toDate = (hour, minute) => moment.tz([entryDate.getFullYear(), entryDate.getMonth(), entryDate.getDate(), hour, minute], timeZone).toDate();
+
+  let start = to24Hour(startHour, startMeridiem);
+  if (!match[4]) {
+    return {start: toDate(start, startMinute), end: null};
+  }
+  let end = to24Hour(endHour, endMeridiem);
+  if (!startMeridiem && endMeridiem) {
+    // e.g. `4:30–6:30pm`, where the meridiem applies to both ends, unless
+    // that would put the start after the end (e.g. `11:00–1:00pm`)
+    start = (startHour % 12) + (endMeridiem === 'p' && (startHour % 12) * 60 + startMinute <= (endHour % 12) * 60 + endMinute ? 12 : 0);
+  }
+  if (!endMeridiem && end * 60 + endMinute <= start * 60 + startMinute) {
+    end = (endHour % 12) + 12; // e.g. `11:00–1:00` ends in the afternoon
+  }
+  return {start: toDate(start, startMinute), end: toDate(end, endMinute)};
+}
+
+// The types of events that the entries are sorted into (see `parseEventText()`)
+const EVENT_TYPES = {
+  PRACTICE: 'practice',
+  GAME: 'game',
+  TOURNAMENT: 'tournament',
+};
+
+/**
+ * Picks out what kind of event the text of an entry describes, and who it's
+ * against, e.g. `Game vs Tigers, Downes` is a home game against the Tigers
+ * and `Game @ Lions, Larz` an away game. Scrimmages and doubleheaders count
+ * as games, and so does anything with an opponent.
+ *
+ * @param {String} text the text of the entry, i.e. its location
+ * @return {Object} `{eventType, opponent, homeAway}`, any of which is null when the text doesn't say
+ */
+function parseEventText(text) {
+  const value = `${text || ''}`;
+  const kindMatch = value.match(/^(game|practice|scrimmage|tournament|doubleheader)s?\b/i);
+  const homeMatch = value.match(/\b(?:vs\.?|versus)\s+([^,;()]+)/i);
+  const awayMatch = value.match(/(?:^|\s)@\s*([^,;()]+)/);
+  const opponent = homeMatch || awayMatch ? (homeMatch || awayMatch)[1].trim() : null;
+  const kind = kindMatch ? kindMatch[1].toLowerCase() : null;
+  let eventType = null;
+  if (kind === 'practice' || kind === 'tournament') {
+    eventType = kind;
+  } else if (kind || opponent) {
+    eventType = EVENT_TYPES.GAME;
+  }
+  let homeAway = null;
+  if (/\baway\b/i.test(value) || (awayMatch && !homeMatch)) {
+    homeAway = 'away';
+  } else if (/\bhome\b/i.test(value) || homeMatch) {
+    homeAway = 'home';
+  }
+  return {eventType, opponent: opponent || null, homeAway};
+}
+
+/**
+ * Retrieves the event details of a schedule entry (see `parseEventText()`),
+ * parsing them from its location for the entries that were stored before
+ * they were kept.
+ *
+ * @param {Object} entry the schedule entry
+ * @return {Object} `{eventType, opponent, homeAway}`
+ */
+function getEventDetails(entry) {
+  if (entry && 'eventType' in entry) {
+    return {eventType: entry.eventType, opponent: entry.opponent || null, homeAway: entry.homeAway || null};
+  }
+  return parseEventText(entry && entry.location);
+}
+
+/**
+ * Parses the block of information for a single day of the schedule, e.g.
+ * `Practice, Warren, 4:45–6:45`, into a schedule entry.
+ *
+ * @param {String} dayOfWeek the day of the week, e.g. `TUESDAY`
+ * @param {String} dayOfMonth the day of the month, e.g. `10/3`
+ * @param {String} details the block of information for the day
+ * @param {Date} now the current date, used to infer the year
+ * @return {Object} the schedule entry
+ */
+function parseScheduleEntry(dayOfWeek, dayOfMonth, details, now = new Date()) {
+  const timeBlockMatch = details.match(/\d+:\d+(\s*[-\u2010-\u2015\u2212]\s*\d+:\d+)?/);
+  let timeBlock = null;
+  if (timeBlockMatch) {
+    timeBlock = timeBlockMatch[0];
+  }
+  let location = sanitizeText(details); // defaults to the entire block of information
+  if (timeBlock) {
+    // A timeblock exists, so location is before it.
+    location = details.split(timeBlock)[0].trim().replace(/, *$/, '');
+  }
+  const parsed = timeBlock ? parseTime(dayOfMonth, details, now) : null;
+  const entryDate = getEntryDate(dayOfMonth, now);
+  return {
+    dayOfWeek,
+    dayOfMonth,
+    date: entryDate ? [entryDate.getFullYear(), entryDate.getMonth() + 1, entryDate.getDate()].map((part) => `${part}`.padStart(2, '0')).join('-') : null,
+    location,
+    timeBlock,
+    parsed,
+    ...parseEventText(location),
+  };
+}
+
+function parseSchedule(text, now = new Date(), endMarkers = ['Schedule by Season', 'Spring Season']) {
   // Schedule starts with "Winter Practices" and is bookended by "Spring Season
-  const results = text.split(/(Schedule by Season)|(Spring Season)/);
-  const upcomingSchedule = results[0];
-  const entries = upcomingSchedule.split(/((SUNDAY|MONDAY|TUESDAY|WEDNESDAY|THURSDAY|FRIDAY|SATURDAY), +(\d+\/\d+))/).slice(1);
+  const upcomingSchedule = endMarkers.reduce((remaining, marker) => remaining.split(marker)[0], text);
+  const entries = upcomingSchedule.split(/((SUNDAY|MONDAY|TUESDAY|WEDNESDAY|THURSDAY|FRIDAY|SATURDAY),\s*(\d+\/\d+))/).slice(1);
   const schedule = new Map(); // map of days to schedule information
   for (let i = 0; i < entries.length; i += 4) {
-    const timeBlockMatch = entries[i + 3].match(/\d+:\d+([-–]\d+:\d+)?/);
-    let timeBlock = null;
-    if (timeBlockMatch) {
-      timeBlock = timeBlockMatch[0];
+    // The key is rebuilt, rather than taken as is, so that the whitespace in the markup doesn't matter
+    const entry = parseScheduleEntry(entries[i + 1], entries[i + 2], entries[i + 3], now);
+    schedule.set(getScheduleKey(entry, schedule), entry);
+  }
+  return schedule;
+}
+
+/**
+ * Builds the key of a schedule entry from its day and date, including the
+ * year when it's known, e.g. `SATURDAY, 10/7/2023`, so that the same day of
+ * another season is a different entry. When the day already has an entry
+ * (e.g. a doubleheader listed as two games), the later ones are keyed by
+ * their start time, e.g. `SATURDAY, 10/7/2023 @ 1:00`, or else numbered,
+ * e.g. `SATURDAY, 10/7/2023 #2`, so that they don't replace the first.
+ *
+ * @param {Object} entry the schedule entry, see `parseScheduleEntry()`
+ * @param {Map} schedule the schedule that the entry is added to
+ * @return {String} the key
+ */
+function getScheduleKey(entry, schedule = new Map()) {
+  const year = entry.date ? `${entry.date}`.slice(0, 4) : null;
+  const key = `${entry.dayOfWeek}, ${entry.dayOfMonth}${year ? `/${year}` : ''}`;
+  if (!schedule.has(key)) {
+    return key;
+  }
+  const start = `${entry.timeBlock || ''}`.match(/\d{1,2}:\d{2}/);
+  if (start && !schedule.has(`${key} @ ${start[0]}`)) {
+    return `${key} @ ${start[0]}`;
+  }
+  let number = 2;
+  while (schedule.has(`${key} #${number}`)) {
+    number++;
+  }
+  return `${key} #${number}`;
+}
+
+/**
+ * Retrieves the day of a schedule key, i.e. without the start time or
+ * number of the later entries of the day, e.g. `SATURDAY, 10/7/2023` for
+ * `SATURDAY, 10/7/2023 @ 1:00`.
+ *
+ * @param {String} key the key of the entry
+ * @return {String} the day
+ */
+function getKeyDay(key) {
+  return `${key}`.replace(/\s*(@\s*\d{1,2}:\d{2}|#\d+)\s*$/, '').trim();
+}
+
+/**
+ * Formats a schedule key for the notifications, i.e. without the year, e.g.
+ * `SATURDAY, 10/7 @ 1:00` for `SATURDAY, 10/7/2023 @ 1:00`.
+ *
+ * @param {String} key the key of the entry
+ * @return {String} the label of the entry
+ */
+function getKeyLabel(key) {
+  return `${key}`.replace(/^([^,]+,\s*\d{1,2}\/\d{1,2})\/\d{4}/, '$1');
+}
+
+/**
+ * Retrieves the day of the month of a schedule key, e.g. `10/7` for
+ * `SATURDAY, 10/7/2023 @ 1:00`.
+ *
+ * @param {String} key the key of the entry
+ * @return {String} the day of the month, or null if the key isn't a day and date
+ */
+function getKeyDayOfMonth(key) {
+  const match = getKeyDay(key).match(/,\s*(\d{1,2}\/\d{1,2})(\/\d{4})?$/);
+  return match ? match[1] : null;
+}
+
+/**
+ * Normalizes the text of a schedule entry for comparison, so that changes
+ * that only come from regenerated markup (e.g. when the page is republished
+ * as is) don't register as a change: whitespace, non-breaking spaces,
+ * invisible characters, and the different kinds of dashes. Changes to the
+ * actual text (e.g. casing or punctuation) still register.
+ *
+ * @param {String} text the text of the entry, e.g. the location
+ * @return {String} the normalized text
+ */
+function normalizeEntryText(text) {
+  if (!text) {
+    return '';
+  }
+  return `${text}`.normalize('NFKC')
+      .replace(/[\u200B-\u200D\uFEFF]/g, '')
+      .replace(/[\u2010-\u2015\u2212]/g, '-')
+      .replace(/\s+/g, ' ')
+      .replace(/ ?([,-]) ?/g, (match, punctuation) => punctuation === ',' ? ', ' : '-')
+      .trim();
+}
+
+/**
+ * Canonicalizes the key of a schedule entry, e.g. `Saturday, 10/7` becomes
+ * `SATURDAY, 10/07` (and `Saturday, 10/7/2023 @ 1:00` becomes
+ * `SATURDAY, 10/07/2023 @ 1:00`), so that the same day is always keyed the
+ * same way. Keys stored without a year (e.g. schedules saved before the year
+ * was kept) take the year of the entry's date, or else the year inferred
+ * from the day of the month (see `getEntryDate()`).
+ *
+ * @param {String} key the key of the entry
+ * @param {Object} entry the schedule entry, for the year, or null to leave the year out
+ * @param {Date} now the current date, used to infer the year
+ * @return {String} the canonical key, or the trimmed key if it isn't a day and date
+ */
+function canonicalizeScheduleKey(key, entry = null, now = new Date()) {
+  const match = `${key}`.match(/^\s*([A-Za-z]+)\s*,\s*(\d{1,2})\/(\d{1,2})(?:\/(\d{4}))?(?:\s*@\s*(\d{1,2}:\d{2}))?(?:\s*#(\d+))?\s*$/);
+  if (!match) {
+    return `${key}`.trim();
+  }
+  let year = match[4] || null;
+  if (!year && entry) {
+    year = /^\d{4}-/.test(entry.date) ? entry.date.slice(0, 4) : `${getEntryDate(`${match[2]}/${match[3]}`, now).getFullYear()}`;
+  }
+  return `${match[1].toUpperCase()}, ${canonicalizeDayOfMonth(`${match[2]}/${match[3]}`)}${year ? `/${year}` : ''}${match[5] ? ` @ ${match[5]}` : ''}${match[6] ? ` #${match[6]}` : ''}`;
+}
+
+/**
+ * Zero-pads the month and day of a day of the month, e.g. `9/3` becomes `09/03`.
+ *
+ * @param {String} dayOfMonth the day of the month
+ * @return {String} the padded day of the month, or as is if it isn't a date
+ */
+function canonicalizeDayOfMonth(dayOfMonth) {
+  const match = `${dayOfMonth}`.match(/^\s*(\d{1,2})\/(\d{1,2})\s*$/);
+  return match ? `${match[1].padStart(2, '0')}/${match[2].padStart(2, '0')}` : dayOfMonth;
+}
+
+/**
+ * Canonicalizes a value of a schedule entry (i.e. the location or time
+ * block): invisible characters are removed, dashes are unified, whitespace
+ * is collapsed, and trailing punctuation is stripped.
+ *
+ * @param {String} text the value
+ * @return {String} the canonical value, or the value as is if it's empty
+ */
+function canonicalizeEntryValue(text) {
+  if (!text) {
+    return text;
+  }
+  return `${text}`.replace(/[\u200B-\u200D\uFEFF]/g, '')
+      .replace(/[\u2010-\u2015\u2212]/g, '-')
+      .replace(/\s+/g, ' ')
+      .trim()
+      .replace(/[\s.,;:!]+$/, '');
+}
+
+/**
+ * Canonicalizes the keys and values of the schedule (see
+ * `canonicalizeScheduleKey()` and `canonicalizeEntryValue()`), so that
+ * cosmetic changes on the page never show up as changes. When two keys end
+ * up the same, the later entry (e.g. an override) wins. Only the keys are
+ * zero-padded; the day of the month of the entries stays as the page shows it.
+ *
+ * @param {Map} schedule the schedule
+ * @param {Date} now the current date, used to infer the year of the keys stored without one
+ * @return {Map} a new schedule with the canonical keys and values
+ */
+function canonicalizeSchedule(schedule, now = new Date()) {
+  const canonical = new Map();
+  schedule.forEach((entry, key) => {
+    canonical.set(canonicalizeScheduleKey(key, entry && typeof entry === 'object' ? entry : null, now), entry && typeof entry === 'object' ? {
+      ...entry,
+      dayOfWeek: entry.dayOfWeek ? `${entry.dayOfWeek}`.toUpperCase() : entry.dayOfWeek,
+      location: canonicalizeEntryValue(entry.location),
+      timeBlock: canonicalizeEntryValue(entry.timeBlock),
+    } : entry);
+  });
+  return canonical;
+}
+
+/**
+ * Prepares the text of a schedule entry for comparison, by normalizing it
+ * (see `normalizeEntryText()`) and applying the ignore rules.
+ *
+ * @param {String} text the text of the entry, e.g. the location
+ * @param {Object} rules the ignore rules, see `config.change_ignore_rules`
+ * @return {String} the text to compare
+ */
+function getComparableText(text, rules = config.change_ignore_rules) {
+  let comparable = `${text || ''}`;
+  for (const pattern of rules.patterns) {
+    comparable = comparable.replace(new RegExp(pattern, 'g'), '');
+  }
+  comparable = normalizeEntryText(comparable);
+  return rules.whitespace ? comparable.replace(/\s+/g, '') : comparable;
+}
+
+/**
+ * Determines whether two schedule entries have the same details for
+ * comparison, i.e. the same location and time, after the ignore rules.
+ *
+ * @param {Object} a the previous schedule entry
+ * @param {Object} b the current schedule entry
+ * @param {Object} rules the ignore rules, see `config.change_ignore_rules`
+ * @return {Boolean} true if the entry wasn't modified
+ */
+function isSameEntry(a, b, rules = config.change_ignore_rules) {
+  if (getComparableText(a['location'], rules) !== getComparableText(b['location'], rules)) {
+    return false;
+  }
+  if (getComparableText(a['timeBlock'], rules) === getComparableText(b['timeBlock'], rules)) {
+    return true;
+  }
+  // Times that resolve to the same start and end were only written differently
+  const time = (value) => value ? new Date(value).getTime() : null;
+  return rules.timeFormatting && !!a['parsed'] && !!b['parsed'] &&
+    time(a['parsed'].start) === time(b['parsed'].start) && time(a['parsed'].end) === time(b['parsed'].end);
+}
+
+/**
+ * Re-keys the entries of the previous schedule that are unchanged but keyed
+ * differently in the current one, e.g. the second game of a doubleheader
+ * that became the only entry of the day when the first game was dropped, so
+ * that the numbering of the later entries of a day doesn't show up as a
+ * change. The entries that they displace get a key of their own.
+ *
+ * @param {Map} a the previous schedule
+ * @param {Map} b the current schedule
+ * @param {Object} rules the ignore rules, see `config.change_ignore_rules`
+ * @return {Map} the previous schedule, keyed like the current one
+ */
+function alignScheduleKeys(a, b, rules = config.change_ignore_rules) {
+  const isPaired = (key) => a.has(key) && b.has(key) && isSameEntry(a.get(key), b.get(key), rules);
+  const moves = new Map();
+  a.forEach((value, key) => {
+    if (isPaired(key)) {
+      return;
     }
-    const dayOfWeek = entries[i + 1];
-    const dayOfMonth = entries[i + 2];
-    let location = sanitizeText(entries[i + 3]); // defaults to the entire block of information
-    if (timeBlock) {
-      // A timeblock exists, so location is before it.
-      location = entries[i + 3].split(timeBlock)[0].trim().replace(/, *$/, '');
+    for (const [bKey, bValue] of b) {
+      if (bKey !== key && getKeyDay(bKey) === getKeyDay(key) && !isPaired(bKey) && ![...moves.values()].includes(bKey) && isSameEntry(value, bValue, rules)) {
+        moves.set(key, bKey);
+        break;
+      }
     }
-    const parsed = timeBlock ? chrono.parse(`${dayOfMonth} ${timeBlock}pm`) : null;
-    const obj = {
-      dayOfWeek,
-      dayOfMonth,
-      location,
-      timeBlock,
-      parsed,
-    };
-    schedule.set(`${entries[i]}`, obj);
+  });
+  if (!moves.size) {
+    return a;
   }
-  return schedule;
+  const aligned = new Map();
+  moves.forEach((bKey, key) => aligned.set(bKey, a.get(key)));
+  a.forEach((value, key) => {
+    if (!moves.has(key)) {
+      aligned.set(aligned.has(key) ? getScheduleKey(value, new Map([...a, ...b, ...aligned])) : key, value);
+    }
+  });
+  return aligned;
 }
 
-function compareSchedules(a, b) {
+function compareSchedules(a, b, rules = config.change_ignore_rules) {
   // eslint-disable-next-line one-var, prefer-const
   let added = new Map(), deleted = new Map(), modified = new Map(), unchanged = new Map();
   if (!a) {
     // When "a" isn't valid, we just add everything into "added"
     added = new Map(b.entries());
   } else {
+    a = alignScheduleKeys(a, b, rules);
     a.forEach(function(value, key, map) {
       if (!b.has(key)) {
         deleted.set(key, value);
@@ -75,7 +443,7 @@ function compareSchedules(a, b) {
       }
       // If the key already exist, check if it was modified or unchanged.
       const aValue = a.get(key);
-      if (aValue['location'] !== value['location'] || aValue['timeBlock'] !== value['timeBlock']) {
+      if (!isSameEntry(aValue, value, rules)) {
         modified.set(key, value);
       } else {
         unchanged.set(key, value);
@@ -85,14 +453,14 @@ function compareSchedules(a, b) {
   return {added, deleted, modified, unchanged};
 }
 
-async function serializeSchedule(schedule, filepath) {
+async function serializeSchedule(schedule, filepath, store = getStore()) {
   const data = EJSON.stringify(schedule);
-  await uploadFileToS3(data, filepath);
+  await store.upload(filepath, data);
   return data;
 }
 
-async function deserializeSchedule(filepath) {
-  const data = await getFileFromS3(filepath);
+async function deserializeSchedule(filepath, store = getStore(), now = new Date()) {
+  const data = await store.download(filepath);
   const scheduleObject = EJSON.parse(data);
 
   // Convert the Object => Map
@@ -103,7 +471,53 @@ async function deserializeSchedule(filepath) {
     }
     schedule.set(key, scheduleObject[key]);
   }
-  return schedule;
+  // Schedules stored before the canonicalization are compared the same way as
+  // new ones, with the year of their keys inferred as of when they were stored
+  return canonicalizeSchedule(schedule, now);
+}
+
+/**
+ * Determines the date of a schedule entry from its day of the month, e.g.
+ * `10/3`. The entries don't include a year, so the year is the one that puts
+ * the date within six months of now, e.g. a date more than six months in the
+ * future is from the prior year, while January's winter practices posted in
+ * the fall are from the next year.
+ *
+ * @param {String} dayOfMonth the day of the month, e.g. `10/3`
+ * @param {Date} now the current date
+ * @return {Date} the (local) midnight of the entry's date, or null if it can't be determined
+ */
+function getEntryDate(dayOfMonth, now = new Date()) {
+  const match = `${dayOfMonth}`.match(/^(\d+)\/(\d+)$/);
+  if (!match) {
+    return null;
+  }
+  const today = new Date(now.getFullYear(), now.getMonth(), now.getDate());
+  const date = new Date(now.getFullYear(), parseInt(match[1]) - 1, parseInt(match[2]));
+  if (date - today > 183 * 24 * 60 * 60 * 1000) {
+    date.setFullYear(date.getFullYear() - 1);
+  } else if (today - date > 183 * 24 * 60 * 60 * 1000) {
+    date.setFullYear(date.getFullYear() + 1);
+  }
+  return date;
+}
+
+/**
+ * Determines the date of a schedule entry, from the date that it was parsed
+ * with (see `parseScheduleEntry()`) when it has one, so that an entry keeps
+ * its year across the turn of the year, or else from its day of the month
+ * (see `getEntryDate()`).
+ *
+ * @param {Object} entry the schedule entry
+ * @param {Date} now the current date
+ * @return {Date} the (local) midnight of the entry's date, or null if it can't be determined
+ */
+function getScheduledDate(entry, now = new Date()) {
+  const match = entry && entry.date && `${entry.date}`.match(/^(\d{4})-(\d{2})-(\d{2})$/);
+  if (match) {
+    return new Date(parseInt(match[1]), parseInt(match[2]) - 1, parseInt(match[3]));
+  }
+  return getEntryDate(entry && entry.dayOfMonth, now);
 }
 
 function getTimestampedFilename(filenameBase = 'schedule-screenshot', extension = 'png') {
@@ -122,26 +536,75 @@ function getTimestampedFilename(filenameBase = 'schedule-screenshot', extension
  * Compares the passed schedule with the prior schedule
  *
  * @param {Map} schedule the schedule Map object that should be compared
- * @return {Object} the output of comparing the schedule with the previous schedule
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {Object} store the storage that the state is kept in
+ * @param {Object} differ the differ that compares the schedules (see `lib/differ.js`),
+ * or null to compare them entry by entry
+ * @return {Object} the output of comparing the schedule with the previous schedule,
+ * along with the `previousSchedule` itself
  */
-async function diffSchedule(schedule) {
-  const PREVIOUS_SCHEDULE_FILENAME = `${config.twitterUserHandle}/previousSchedule.json`;
-  const existingSchedule = await getFileFromS3(PREVIOUS_SCHEDULE_FILENAME);
-  if (!existingSchedule) {
+async function diffSchedule(schedule, prefix = config.twitterUserHandle, store = getStore(), differ = null) {
+  const PREVIOUS_SCHEDULE_FILENAME = `${prefix}/previousSchedule.json`;
+  if (!await store.exists(PREVIOUS_SCHEDULE_FILENAME)) {
     // Usually, if the previous schedule doesn't exist, this is the first
     // time that this is running in the docker container. Will not need this
     // logic anymore once we move the previous blobs to S3
-    await serializeSchedule(schedule, PREVIOUS_SCHEDULE_FILENAME);
+    await serializeSchedule(schedule, PREVIOUS_SCHEDULE_FILENAME, store);
+  }
+  const previousSchedule = await deserializeSchedule(PREVIOUS_SCHEDULE_FILENAME, store); // deserialize actually constructs the necessary schedule Map
+  const current = canonicalizeSchedule(schedule);
+  const scheduleDiff = differ ? differ.diff(previousSchedule, current) : compareSchedules(previousSchedule, current);
+  scheduleDiff.previousSchedule = previousSchedule;
+  return scheduleDiff;
+}
+
+/**
+ * Generates a short summary of the changes, e.g. "2 added, 1 modified".
+ * Categories without any changes are left out of the summary.
+ *
+ * @param {Object} scheduleDiff the output of `compareSchedules()`
+ * @return {String} the summary of the changes
+ */
+function summarizeChanges(scheduleDiff) {
+  const parts = [];
+  if (scheduleDiff.added.size) {
+    parts.push(`${scheduleDiff.added.size} added`);
+  }
+  if (scheduleDiff.modified.size) {
+    parts.push(`${scheduleDiff.modified.size} modified`);
+  }
+  if (scheduleDiff.deleted.size) {
+    parts.push(`${scheduleDiff.deleted.size} removed`);
+  }
+  if (!parts.length) {
+    return 'No changes';
   }
-  const previousSchedule = await deserializeSchedule(PREVIOUS_SCHEDULE_FILENAME); // deserialize actually constructs the necessary schedule Map
-  return compareSchedules(previousSchedule, schedule);
+  return parts.join(', ');
 }
 
 module.exports = {
+  EVENT_TYPES,
+  parseTime,
+  parseEventText,
+  getEventDetails,
+  parseScheduleEntry,
   parseSchedule,
+  getScheduleKey,
+  getKeyDay,
+  getKeyLabel,
+  getKeyDayOfMonth,
+  normalizeEntryText,
+  canonicalizeScheduleKey,
+  canonicalizeEntryValue,
+  canonicalizeSchedule,
+  getComparableText,
+  isSameEntry,
   compareSchedules,
   serializeSchedule,
   deserializeSchedule,
+  getEntryDate,
+  getScheduledDate,
   getTimestampedFilename,
   diffSchedule,
+  summarizeChanges,
 };
@@ -0,0 +1,190 @@
+/* eslint-disable max-len */
+const moment = require('moment-timezone');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {deserializeSchedule, compareSchedules, getEntryDate} = require('./helper_functions');
+const {listScheduleSnapshots} = require('./timeline');
+const {loadSnapshotMetadata} = require('./season');
+const {escapeHtml} = require('./image');
+const {resolveScreenshotKey} = require('./screenshot_archive');
+const {formatTimestamp} = require('./format');
+
+/**
+ * Parses the date that the schedule is viewed as of. A date without a time,
+ * e.g. `2023-10-03`, means the end of that day in the time zone, i.e. what
+ * the schedule said on that day.
+ *
+ * @param {String} value the date, e.g. `2023-10-03` or `2023-10-03T18:00:00Z`
+ * @param {String} timeZone the time zone of dates without a time
+ * @param {Date} now the current date, used when no date is given
+ * @return {Date} the date, or null if it isn't valid
+ */
+function parseAsOf(value, timeZone = config.display_time_zone, now = new Date()) {
+  if (!value) {
+    return now;
+  }
+  const match = value.match(/^(\d{4})-(\d{1,2})-(\d{1,2})$/);
+  if (match) {
+    return moment.tz([parseInt(match[1]), parseInt(match[2]) - 1, parseInt(match[3]), 23, 59, 59], timeZone).toDate();
+  }
+  const date = new Date(value);
+  return isNaN(date) ? null : date;
+}
+
+/**
+ * Determines the archive key of the screenshot taken with the schedule
+ * snapshot. Both are archived with the same timestamp.
+ *
+ * @param {String} snapshotKey the key of the archived schedule, e.g. `team/archive/schedule-2023-10-6-1696600000000.json`
+ * @return {String} the key of the archived screenshot
+ */
+function getSnapshotScreenshotKey(snapshotKey) {
+  return snapshotKey.replace(/\/archive\/schedule-/, '/archive/schedule-screenshot-').replace(/\.json$/, '.png');
+}
+
+/**
+ * Retrieves the schedule as it was at a past date, i.e. the latest archived
+ * snapshot at or before the date, along with the neighbouring snapshots to
+ * navigate to and the changes from the previous snapshot.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Date} asOf the date to view the schedule as of
+ * @param {Object} store the storage that the archive is kept in
+ * @param {String} season the season to limit the snapshots to (see `lib/season.js`), or null for every snapshot
+ * @return {Object} Object with `timestamp`, `schedule`, `scheduleDiff`, `screenshotKey` (or null), `metadata` (the season and age group, or null), `season`, `previous`, and `next` (timestamps, or null), or null if there's no snapshot by then
+ */
+async function getScheduleAsOf(prefix, asOf, store = getStore(), season = null) {
+  const snapshots = await listScheduleSnapshots(prefix, store, season);
+  let index = -1;
+  while (index + 1 < snapshots.length && snapshots[index + 1].timestamp <= asOf) {
+    index++;
+  }
+  if (index < 0) {
+    return null;
+  }
+  const snapshot = snapshots[index];
+  const schedule = await deserializeSchedule(snapshot.key, store, snapshot.timestamp);
+  const previousSchedule = index > 0 ? await deserializeSchedule(snapshots[index - 1].key, store, snapshots[index - 1].timestamp) : null;
+  return {
+    timestamp: snapshot.timestamp,
+    schedule,
+    scheduleDiff: compareSchedules(previousSchedule, schedule),
+    screenshotKey: await resolveScreenshotKey(getSnapshotScreenshotKey(snapshot.key), store),
+    metadata: await loadSnapshotMetadata(snapshot.key, store),
+    season,
+    previous: index > 0 ? snapshots[index - 1].timestamp : null,
+    next: index + 1 < snapshots.length ? snapshots[index + 1].timestamp : null,
+  };
+}
+
+/**
+ * Builds the page showing the schedule as of a past date, with the
+ * screenshot taken at the time and links to the previous and next versions,
+ * so that the link can be shared to settle what the schedule said.
+ *
+ * @param {Object} team the team
+ * @param {Object} view the schedule as of the date, see `getScheduleAsOf()`, or null if there wasn't one
+ * @param {Date} asOf the date that the schedule is viewed as of
+ * @param {String} timeZone the time zone that the dates are displayed in
+ * @return {String} the HTML page
+ */
+function buildHistoryHtml(team, view, asOf, timeZone = config.display_time_zone) {
+  const format = (date) => formatTimestamp(date, timeZone);
+  const metadata = view && view.metadata;
+  const title = `${team.name || team.id} schedule${metadata && metadata.season ? ` (${metadata.season})` : ''}`;
+  const basePath = `/history/${encodeURIComponent(team.id)}`;
+  let body = `    <p>No schedule was archived by ${escapeHtml(format(asOf))}.</p>`;
+  if (view) {
+    const {added, modified, deleted} = view.scheduleDiff;
+    const rows = [...view.schedule.entries()].map(([key, entry]) => ({entry, change: added.has(key) ? 'added' : (modified.has(key) ? 'modified' : null)}));
+    for (const entry of deleted.values()) {
+      rows.push({entry, change: 'deleted'});
+    }
+    rows.sort((a, b) => (getEntryDate(a.entry.dayOfMonth) || 0) - (getEntryDate(b.entry.dayOfMonth) || 0));
+    const tableRows = rows.map(({entry, change}) => `      <tr${change ? ` class="${change}"` : ''}><td class="day">${escapeHtml(`${entry.dayOfWeek} ${entry.dayOfMonth}`)}</td><td>${escapeHtml(entry.location || '')}</td><td class="time">${escapeHtml(entry.timeBlock || '')}</td></tr>`);
+    const link = (timestamp, label) => timestamp ? `<a href="${basePath}?at=${encodeURIComponent(timestamp.toISOString())}${view.season ? `&amp;season=${encodeURIComponent(view.season)}` : ''}">${label}</a>` : `<span>${label}</span>`;
+    body = `    <p>As of ${escapeHtml(format(asOf))}, the schedule was last updated ${escapeHtml(format(view.timestamp))}.</p>
+    <nav>${link(view.previous, '&larr; Previous version')} | ${link(view.next, 'Next version &rarr;')}</nav>
+    <table>
+${tableRows.join('\n')}
+    </table>${view.screenshotKey ? `\n    <img src="${basePath}/screenshot/${view.timestamp.getTime()}.png" alt="Screenshot of the schedule page at the time" />` : ''}`;
+  }
+  return `<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8" />
+    <title>${escapeHtml(title)}</title>
+    <style>
+      body { font-family: Helvetica, Arial, sans-serif; max-width: 640px; margin: 20px auto; padding: 0 12px; }
+      table { width: 100%; border-collapse: collapse; font-size: 14px; margin: 12px 0; }
+      td { padding: 6px 8px; border-bottom: 1px solid #e0e0e0; vertical-align: top; }
+      .day { font-weight: bold; white-space: nowrap; }
+      .time { white-space: nowrap; text-align: right; }
+      .added, .modified { background: #fff3b0; }
+      .deleted { color: #999999; text-decoration: line-through; }
+      nav span { color: #999999; }
+      img { max-width: 100%; border: 1px solid #e0e0e0; }
+    </style>
+  </head>
+  <body>
+    <h1>${escapeHtml(title)}</h1>
+${body}
+  </body>
+</html>`;
+}
+
+/**
+ * Builds the response for the page showing the team's schedule as of a past
+ * date, see `buildHistoryHtml()`. Only the configured teams can be viewed.
+ *
+ * @async
+ * @param {String} teamId the team id
+ * @param {String} at the date to view the schedule as of, see `parseAsOf()`
+ * @param {Object} store the storage that the archive is kept in
+ * @param {Array} teams the configured teams
+ * @param {String} season the season to limit the snapshots to, or null for every snapshot
+ * @return {Object} the response, with `status`, `headers`, and `body`
+ */
+async function getHistoryPage(teamId, at, store = getStore(), teams = config.teams, season = null) {
+  const team = teams.find((candidate) => candidate.id === teamId);
+  if (!team) {
+    return {status: 404};
+  }
+  const asOf = parseAsOf(at);
+  if (!asOf) {
+    return {status: 400, headers: {'Content-Type': 'text/plain'}, body: 'Invalid date, e.g. ?at=2023-10-03'};
+  }
+  const view = await getScheduleAsOf(team.id, asOf, store, season);
+  return {status: 200, headers: {'Content-Type': 'text/html; charset=utf-8'}, body: buildHistoryHtml(team, view, asOf)};
+}
+
+/**
+ * Builds the response for the screenshot archived with the team's schedule
+ * snapshot. Only the configured teams can be viewed.
+ *
+ * @async
+ * @param {String} teamId the team id
+ * @param {Integer} timestamp the timestamp of the snapshot, in milliseconds since epoch
+ * @param {Object} store the storage that the archive is kept in
+ * @param {Array} teams the configured teams
+ * @return {Object} the response, with `status`, `headers`, and `body`
+ */
+async function getHistoryScreenshot(teamId, timestamp, store = getStore(), teams = config.teams) {
+  const team = teams.find((candidate) => candidate.id === teamId);
+  const view = team ? await getScheduleAsOf(team.id, new Date(timestamp), store) : null;
+  const image = view && view.timestamp.getTime() === timestamp && view.screenshotKey ? await store.download(view.screenshotKey) : null;
+  if (!image) {
+    return {status: 404};
+  }
+  return {status: 200, headers: {'Content-Type': 'image/png'}, body: image};
+}
+
+module.exports = {
+  parseAsOf,
+  getSnapshotScreenshotKey,
+  getScheduleAsOf,
+  buildHistoryHtml,
+  getHistoryPage,
+  getHistoryScreenshot,
+};
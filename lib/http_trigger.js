@@ -0,0 +1,111 @@
+/* eslint-disable max-len */
+const crypto = require('crypto');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {matchRoute} = require('./openapi');
+const {selectTeams} = require('./cli');
+const {loadLastRunResults} = require('./run_results');
+const {logger} = require('./logger');
+
+/**
+ * The routes of the HTTP trigger of the Lambda (API Gateway or a function
+ * URL), in the same shape as the server's `ROUTES` (see
+ * `lib/link_tracking.js`). `handle` is called with the parameters, the
+ * store, and the function that checks the teams, and returns the response,
+ * with `status`, `headers`, and `body`.
+ */
+const TRIGGER_ROUTES = [
+  {
+    method: 'POST',
+    path: '/check',
+    operationId: 'checkTeams',
+    summary: 'Checks the team\'s page now (or every team\'s) and posts the changes, e.g. after the page was edited',
+    parameters: [{name: 'url', in: 'query', description: 'The comma separated team ids or URLs, or every team when left out'}],
+    responses: {200: {description: 'The per-team results of the check', contentType: 'application/json'}, 404: {description: 'No configured team matches'}},
+    handle: async ({url}, store, runTeams) => {
+      const teams = selectTeams(config.teams, url);
+      if (!teams.length) {
+        return {status: 404, headers: {'Content-Type': 'application/json'}, body: JSON.stringify({error: `No configured team matches ${url}`})};
+      }
+      return {status: 200, headers: {'Content-Type': 'application/json'}, body: JSON.stringify({results: await runTeams(teams)})};
+    },
+  },
+  {
+    method: 'GET',
+    path: '/status',
+    operationId: 'getRunResults',
+    summary: 'Reports the per-team results of the last run',
+    responses: {200: {description: 'The results of the last run, with `finishedAt` and `results`, or null if there was none', contentType: 'application/json'}},
+    handle: async (params, store) => ({status: 200, headers: {'Content-Type': 'application/json'}, body: JSON.stringify(await loadLastRunResults(store))}),
+  },
+];
+
+/**
+ * Checks the bearer token of the request against the `TRIGGER_TOKEN`, in
+ * constant time.
+ *
+ * @param {String} authorization the `Authorization` header of the request
+ * @param {String} token the token, i.e. `TRIGGER_TOKEN`
+ * @return {Boolean} true if the request carries the token
+ */
+function isTokenAuthorized(authorization, token = config.trigger_token) {
+  const match = (authorization || '').match(/^Bearer\s+(.+)$/i);
+  if (!token || !match) {
+    return false;
+  }
+  // Compare the digests, so that the comparison doesn't leak the token's length
+  const digest = (value) => crypto.createHash('sha256').update(value).digest();
+  return crypto.timingSafeEqual(digest(match[1].trim()), digest(token));
+}
+
+/**
+ * Determines whether the Lambda event is an HTTP request, from API Gateway
+ * (the REST or HTTP API) or a function URL.
+ *
+ * @param {Object} event the Lambda event
+ * @return {Boolean} true if the event is an HTTP request
+ */
+function isHttpEvent(event) {
+  return !!((event.requestContext && event.requestContext.http) || event.httpMethod);
+}
+
+/**
+ * Handles an HTTP request to the Lambda, i.e. `POST /check?url=<team id>`
+ * to check a team's page on demand, or `GET /status` for the results of the
+ * last run. Both require the `TRIGGER_TOKEN`, without which the HTTP trigger
+ * is disabled.
+ *
+ * @async
+ * @param {Object} event the Lambda event, see `isHttpEvent()`
+ * @param {Function} runTeams checks the given teams, returning the per-team results, see `main()` in `index.js`
+ * @param {Object} store the storage that the state is kept in
+ * @param {String} token the token, i.e. `TRIGGER_TOKEN`
+ * @return {Object} the response, with `statusCode`, `headers`, and `body`
+ */
+async function handleHttpEvent(event, runTeams, store = getStore(), token = config.trigger_token) {
+  const method = event.requestContext && event.requestContext.http ? event.requestContext.http.method : event.httpMethod;
+  const query = event.rawQueryString !== undefined ? event.rawQueryString : new URLSearchParams(event.queryStringParameters || {}).toString();
+  const path = event.rawPath || event.path || '/';
+  const matched = token ? matchRoute(TRIGGER_ROUTES, method, `${path}${query ? `?${query}` : ''}`) : null;
+  if (!matched) {
+    return {statusCode: 404};
+  }
+  const headers = Object.fromEntries(Object.entries(event.headers || {}).map(([name, value]) => [name.toLowerCase(), value]));
+  if (!isTokenAuthorized(headers.authorization, token)) {
+    return {statusCode: 401, headers: {'WWW-Authenticate': 'Bearer'}};
+  }
+  try {
+    const response = await matched.route.handle(matched.params, store, runTeams);
+    return {statusCode: response.status, headers: response.headers, body: response.body};
+  } catch (e) {
+    logger.error(e);
+    return {statusCode: 500};
+  }
+}
+
+module.exports = {
+  TRIGGER_ROUTES,
+  isTokenAuthorized,
+  isHttpEvent,
+  handleHttpEvent,
+};
@@ -0,0 +1,375 @@
+/* eslint-disable max-len */
+const path = require('path');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {getEntryDate} = require('./helper_functions');
+const {logger} = require('./logger');
+
+// The content types of the logos, by extension, for embedding them as `data:` URLs
+const LOGO_CONTENT_TYPES = {
+  '.png': 'image/png',
+  '.jpg': 'image/jpeg',
+  '.jpeg': 'image/jpeg',
+  '.gif': 'image/gif',
+  '.svg': 'image/svg+xml',
+};
+
+/**
+ * Escapes text so that it can be safely embedded into the HTML template.
+ *
+ * @param {String} text the text to be escaped
+ * @return {String} the escaped text
+ */
+function escapeHtml(text) {
+  return `${text}`
+      .replace(/&/g, '&amp;')
+      .replace(/</g, '&lt;')
+      .replace(/>/g, '&gt;')
+      .replace(/"/g, '&quot;')
+      .replace(/'/g, '&#39;');
+}
+
+/**
+ * Retrieves the deployment's branding, i.e. the `BRAND_*` settings.
+ *
+ * @return {Object} Object with `primaryColor`, `textColor`, and `logoUrl`
+ */
+function getDefaultBranding() {
+  return {
+    primaryColor: config.brand_primary_color,
+    textColor: config.brand_text_color,
+    logoUrl: config.brand_logo_url,
+  };
+}
+
+/**
+ * Loads the team's branding: its `color`, and its logo from the storage
+ * (`logoKey`, e.g. `BlineBanditsBot/logo.png`), embedded as a `data:` URL so
+ * that the page rendering it doesn't need access to the bucket. Falls back
+ * to the deployment's branding for what the team doesn't set.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {Object} store the storage that the logo is kept in
+ * @return {Object} Object with `primaryColor`, `textColor`, and `logoUrl`
+ */
+async function loadTeamBranding(team, store = getStore()) {
+  const branding = getDefaultBranding();
+  if (team.color) {
+    branding.primaryColor = team.color;
+  }
+  if (team.logoKey) {
+    const logo = await store.download(team.logoKey);
+    if (logo) {
+      const contentType = LOGO_CONTENT_TYPES[path.extname(team.logoKey).toLowerCase()] || 'image/png';
+      branding.logoUrl = `data:${contentType};base64,${Buffer.from(logo).toString('base64')}`;
+    } else {
+      logger.warn(`The logo of ${team.id} is missing at ${team.logoKey}, using the default branding`);
+    }
+  }
+  return branding;
+}
+
+/**
+ * Builds the HTML document that lays out the preview image: a branded banner
+ * with the change summary on top, and the schedule screenshot below it.
+ *
+ * @param {Buffer} imageBuffer the PNG screenshot of the schedule
+ * @param {String} summary the change summary displayed in the banner
+ * @param {Object} branding Object with `primaryColor`, `textColor`, and `logoUrl`
+ * @return {String} the HTML for the preview
+ */
+function buildPreviewHtml(imageBuffer, summary, branding) {
+  const screenshot = `data:image/png;base64,${Buffer.from(imageBuffer).toString('base64')}`;
+  const logo = branding.logoUrl ? `<img class="logo" src="${escapeHtml(branding.logoUrl)}" />` : '';
+  return `<!DOCTYPE html>
+<html>
+  <head>
+    <style>
+      body { margin: 0; background: #ffffff; font-family: Helvetica, Arial, sans-serif; }
+      #preview { display: inline-block; }
+      .banner { display: flex; align-items: center; padding: 12px 16px; background: ${branding.primaryColor}; color: ${branding.textColor}; font-size: 18px; font-weight: bold; }
+      .logo { height: 32px; margin-right: 12px; }
+      .screenshot { display: block; width: 340px; }
+    </style>
+  </head>
+  <body>
+    <div id="preview">
+      <div class="banner">${logo}<span>${escapeHtml(summary)}</span></div>
+      <img class="screenshot" src="${screenshot}" />
+    </div>
+  </body>
+</html>`;
+}
+
+/**
+ * Renders a composited preview image consisting of the schedule screenshot
+ * and a banner summarizing the changes. This is used by the notification
+ * channels that benefit from a self-explanatory image (e.g. email).
+ *
+ * @async
+ * @param {Object} browser the puppeteer browser instance to render with
+ * @param {Buffer} imageBuffer the PNG screenshot of the schedule
+ * @param {String} summary the change summary displayed in the banner
+ * @param {Object} branding the branding of the banner, see `loadTeamBranding()`
+ * @return {Buffer} the PNG preview image
+ */
+async function composePreviewImage(browser, imageBuffer, summary, branding = getDefaultBranding()) {
+  const page = await browser.newPage();
+  try {
+    await page.setViewport({width: 1200, height: 800, deviceScaleFactor: 2});
+    await page.setContent(buildPreviewHtml(imageBuffer, summary, branding), {waitUntil: 'load'});
+    const element = await page.$('#preview');
+    return await element.screenshot({type: 'png'});
+  } finally {
+    await page.close();
+  }
+}
+
+/**
+ * Builds the HTML document that stamps a small watermark in the bottom right
+ * corner of the screenshot.
+ *
+ * @param {Buffer} imageBuffer the PNG screenshot of the schedule
+ * @param {String} text the watermark text
+ * @return {String} the HTML for the watermarked screenshot
+ */
+function buildWatermarkHtml(imageBuffer, text) {
+  const screenshot = `data:image/png;base64,${Buffer.from(imageBuffer).toString('base64')}`;
+  return `<!DOCTYPE html>
+<html>
+  <head>
+    <style>
+      body { margin: 0; }
+      #watermarked { display: inline-block; position: relative; }
+      .screenshot { display: block; width: 340px; }
+      .watermark { position: absolute; right: 4px; bottom: 4px; padding: 2px 4px; border-radius: 3px; background: rgba(255, 255, 255, 0.7); color: rgba(0, 0, 0, 0.6); font-family: Helvetica, Arial, sans-serif; font-size: 8px; }
+    </style>
+  </head>
+  <body>
+    <div id="watermarked">
+      <img class="screenshot" src="${screenshot}" />
+      <div class="watermark">${escapeHtml(text)}</div>
+    </div>
+  </body>
+</html>`;
+}
+
+/**
+ * Stamps the screenshot with a small watermark (e.g. team name, capture
+ * timestamp, and handle), so that re-shared images retain their provenance.
+ *
+ * @async
+ * @param {Object} browser the puppeteer browser instance to render with
+ * @param {Buffer} imageBuffer the PNG screenshot of the schedule
+ * @param {String} text the watermark text
+ * @return {Buffer} the watermarked PNG screenshot
+ */
+async function watermarkImage(browser, imageBuffer, text) {
+  const page = await browser.newPage();
+  try {
+    await page.setViewport({width: 1200, height: 800, deviceScaleFactor: 2});
+    await page.setContent(buildWatermarkHtml(imageBuffer, text), {waitUntil: 'load'});
+    const element = await page.$('#watermarked');
+    return await element.screenshot({type: 'png'});
+  } finally {
+    await page.close();
+  }
+}
+
+/**
+ * Builds the HTML document that draws the schedule as a table, from the
+ * parsed schedule rather than the live page. Added and modified entries are
+ * highlighted, and deleted entries are struck through.
+ *
+ * @param {Map} schedule the parsed schedule
+ * @param {Object} scheduleDiff the differences, see `diffSchedule()`
+ * @param {String} title the title above the table, e.g. the team name
+ * @param {Object} branding Object with `primaryColor`, `textColor`, and `logoUrl`
+ * @return {String} the HTML for the schedule
+ */
+function buildScheduleHtml(schedule, scheduleDiff, title, branding) {
+  const rows = [...schedule.entries()].map(([key, entry]) => ({key, entry, change: scheduleDiff.added.has(key) ? 'added' : (scheduleDiff.modified.has(key) ? 'modified' : null)}));
+  for (const [key, entry] of scheduleDiff.deleted) {
+    rows.push({key, entry, change: 'deleted'});
+  }
+  // Keep the deleted entries in date order, among the rest
+  rows.sort((a, b) => (getEntryDate(a.entry.dayOfMonth) || 0) - (getEntryDate(b.entry.dayOfMonth) || 0));
+  const logo = branding.logoUrl ? `<img class="logo" src="${escapeHtml(branding.logoUrl)}" />` : '';
+  const tableRows = rows.map(({entry, change}) => `        <tr${change ? ` class="${change}"` : ''}><td class="day">${escapeHtml(`${entry.dayOfWeek.slice(0, 3)} ${entry.dayOfMonth}`)}</td><td>${escapeHtml(entry.location || '')}</td><td class="time">${escapeHtml(entry.timeBlock || '')}</td></tr>`);
+  return `<!DOCTYPE html>
+<html>
+  <head>
+    <style>
+      body { margin: 0; background: #ffffff; font-family: Helvetica, Arial, sans-serif; }
+      #schedule { display: inline-block; width: 340px; }
+      .banner { display: flex; align-items: center; padding: 10px 12px; background: ${branding.primaryColor}; color: ${branding.textColor}; font-size: 16px; font-weight: bold; }
+      .logo { height: 28px; margin-right: 10px; }
+      table { width: 100%; border-collapse: collapse; font-size: 13px; }
+      td { padding: 6px 8px; border-bottom: 1px solid #e0e0e0; vertical-align: top; }
+      .day { font-weight: bold; white-space: nowrap; }
+      .time { white-space: nowrap; text-align: right; }
+      .added, .modified { background: #fff3b0; }
+      .deleted { color: #999999; text-decoration: line-through; }
+    </style>
+  </head>
+  <body>
+    <div id="schedule">
+      <div class="banner">${logo}<span>${escapeHtml(title)}</span></div>
+      <table>
+${tableRows.join('\n')}
+      </table>
+    </div>
+  </body>
+</html>`;
+}
+
+/**
+ * Renders the image of the schedule from the parsed schedule, so that the
+ * posted image is consistent even when the page's layout shifts, and can
+ * highlight the changed entries.
+ *
+ * @async
+ * @param {Object} browser the puppeteer browser instance to render with
+ * @param {Map} schedule the parsed schedule
+ * @param {Object} scheduleDiff the differences, see `diffSchedule()`
+ * @param {String} title the title above the table, e.g. the team name
+ * @param {Object} branding the branding of the banner, see `loadTeamBranding()`
+ * @return {Buffer} the PNG image of the schedule
+ */
+async function renderScheduleImage(browser, schedule, scheduleDiff, title, branding = getDefaultBranding()) {
+  const page = await browser.newPage();
+  try {
+    await page.setViewport({width: 1200, height: 800, deviceScaleFactor: 2});
+    await page.setContent(buildScheduleHtml(schedule, scheduleDiff, title, branding), {waitUntil: 'load'});
+    const element = await page.$('#schedule');
+    return await element.screenshot({type: 'png'});
+  } finally {
+    await page.close();
+  }
+}
+
+/**
+ * Reads the size of a PNG image from its header.
+ *
+ * @param {Buffer} imageBuffer the PNG image
+ * @return {Object} `{width, height}` in pixels, or null if it isn't a PNG
+ */
+function getPngSize(imageBuffer) {
+  const buffer = Buffer.from(imageBuffer);
+  if (buffer.length < 24 || buffer.toString('ascii', 1, 4) !== 'PNG') {
+    return null;
+  }
+  return {width: buffer.readUInt32BE(16), height: buffer.readUInt32BE(20)};
+}
+
+/**
+ * Parses an aspect ratio, e.g. `16:9`.
+ *
+ * @param {String} aspect the aspect ratio, as `<width>:<height>`
+ * @return {Number} the ratio of the width to the height, or null if it isn't valid
+ */
+function parseAspectRatio(aspect) {
+  const match = `${aspect}`.match(/^(\d+(?:\.\d+)?):(\d+(?:\.\d+)?)$/);
+  return match && parseFloat(match[1]) > 0 && parseFloat(match[2]) > 0 ? parseFloat(match[1]) / parseFloat(match[2]) : null;
+}
+
+/**
+ * Determines the size of the image once it's fit to the aspect ratio, by
+ * padding it (keeping all of the image) or cropping it (keeping the top,
+ * where the next entries of the schedule are).
+ *
+ * @param {Object} size the size of the image, see `getPngSize()`
+ * @param {Number} ratio the aspect ratio, see `parseAspectRatio()`
+ * @param {String} fit `pad` or `crop`
+ * @return {Object} `{width, height}` in pixels
+ */
+function getFittedSize(size, ratio, fit) {
+  const wider = size.width / size.height > ratio;
+  if ((fit === 'crop') === wider) {
+    return {width: Math.round(size.height * ratio), height: size.height};
+  }
+  return {width: size.width, height: Math.round(size.width / ratio)};
+}
+
+/**
+ * Builds the HTML document that fits the screenshot to a canvas of another
+ * aspect ratio, centered on the background when padded, or anchored to the
+ * top when cropped.
+ *
+ * @param {Buffer} imageBuffer the PNG screenshot of the schedule
+ * @param {Object} canvas the size of the canvas, see `getFittedSize()`
+ * @param {String} fit `pad` or `crop`
+ * @param {String} background the color of the padding
+ * @return {String} the HTML for the fitted screenshot
+ */
+function buildFittedHtml(imageBuffer, canvas, fit, background) {
+  const screenshot = `data:image/png;base64,${Buffer.from(imageBuffer).toString('base64')}`;
+  return `<!DOCTYPE html>
+<html>
+  <head>
+    <style>
+      body { margin: 0; }
+      #fitted { width: ${canvas.width}px; height: ${canvas.height}px; background: ${escapeHtml(background)}; }
+      .screenshot { display: block; width: 100%; height: 100%; object-fit: ${fit === 'crop' ? 'cover' : 'contain'}; object-position: ${fit === 'crop' ? 'top' : 'center'}; }
+    </style>
+  </head>
+  <body>
+    <div id="fitted">
+      <img class="screenshot" src="${screenshot}" />
+    </div>
+  </body>
+</html>`;
+}
+
+/**
+ * Fits the screenshot to the aspect ratio that the notification channel
+ * displays well (see `config.channel_image_formats`), e.g. padded to 16:9
+ * for Twitter cards, or cropped square, instead of being letterboxed by the
+ * channel. Images that already fit (or can't be read) are left as is.
+ *
+ * @async
+ * @param {Object} browser the puppeteer browser instance to render with
+ * @param {Buffer} imageBuffer the PNG screenshot of the schedule
+ * @param {String} channel the channel, e.g. `twitter`, `bluesky`, `mastodon`, `telegram`, or `slack`
+ * @param {Object} formats mapping of the channel to its format, i.e. `{aspect, fit, background}`
+ * @return {Buffer} the PNG image for the channel
+ */
+async function formatImageForChannel(browser, imageBuffer, channel, formats = config.channel_image_formats) {
+  const format = formats[channel];
+  const ratio = format ? parseAspectRatio(format.aspect) : null;
+  const size = getPngSize(imageBuffer);
+  if (!ratio || !size) {
+    return imageBuffer;
+  }
+  const canvas = getFittedSize(size, ratio, format.fit);
+  if (canvas.width === size.width && canvas.height === size.height) {
+    return imageBuffer;
+  }
+  const page = await browser.newPage();
+  try {
+    await page.setViewport({width: canvas.width, height: canvas.height, deviceScaleFactor: 1});
+    await page.setContent(buildFittedHtml(imageBuffer, canvas, format.fit, format.background || '#ffffff'), {waitUntil: 'load'});
+    const element = await page.$('#fitted');
+    return await element.screenshot({type: 'png'});
+  } finally {
+    await page.close();
+  }
+}
+
+module.exports = {
+  escapeHtml,
+  buildPreviewHtml,
+  getDefaultBranding,
+  loadTeamBranding,
+  composePreviewImage,
+  buildWatermarkHtml,
+  watermarkImage,
+  buildScheduleHtml,
+  renderScheduleImage,
+  getPngSize,
+  parseAspectRatio,
+  getFittedSize,
+  buildFittedHtml,
+  formatImageForChannel,
+};
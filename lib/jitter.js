@@ -0,0 +1,17 @@
+/**
+ * Calculates a delay with random jitter added on top of the base delay, so
+ * that scrapes don't happen at perfectly predictable times.
+ *
+ * @param {Number} baseSeconds the base delay, in seconds
+ * @param {Number} jitterSeconds the maximum random jitter added, in seconds
+ * @param {Function} random source of randomness in the range [0, 1)
+ * @return {Integer} the delay, in milliseconds
+ */
+function getJitteredDelay(baseSeconds, jitterSeconds = 0, random = Math.random) {
+  const jitter = Math.max(jitterSeconds, 0) * random();
+  return Math.round((Math.max(baseSeconds, 0) + jitter) * 1000);
+}
+
+module.exports = {
+  getJitteredDelay,
+};
@@ -0,0 +1,278 @@
+/* eslint-disable max-len */
+const http = require('http');
+const https = require('https');
+const crypto = require('crypto');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {getMaintenanceStatus, formatMaintenanceStatus} = require('./maintenance');
+const {createAllowlist, loadTlsOptions, isAdminRequestAuthorized} = require('./access_control');
+const {metrics} = require('./metrics');
+const {getHistoryPage, getHistoryScreenshot} = require('./history');
+const {matchRoute, buildOpenApiSpec} = require('./openapi');
+const {getSession, isRoleAuthorized, startLogin, completeLogin, logout} = require('./oidc');
+const {version} = require('../package.json');
+const {logger} = require('./logger');
+
+/**
+ * Creates a tracked link that redirects to the given URL, counting the
+ * clicks. When link tracking isn't configured, the URL is returned as is.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {String} url the URL that the link redirects to
+ * @param {String} channel the notification channel that the link is used in, e.g. `sms`
+ * @param {Object} store the storage that the links are kept in
+ * @param {Date} now the current date
+ * @param {Object} experiment the experiment that the notification is part of, i.e. `{name, variant}`, see `lib/experiments.js`
+ * @return {String} the tracked link
+ */
+async function createTrackedLink(prefix, url, channel, store = getStore(), now = new Date(), experiment = null) {
+  if (!config.link_tracking_base_url) {
+    return url;
+  }
+  const id = crypto.randomBytes(6).toString('base64url');
+  const link = {id, url, channel, createdAt: now.toISOString(), clicks: 0, lastClickedAt: null};
+  if (experiment) {
+    link.experiment = experiment;
+  }
+  await store.upload(`${prefix}/links/${id}.json`, JSON.stringify(link));
+  return `${config.link_tracking_base_url.replace(/\/$/, '')}/r/${encodeURIComponent(prefix)}/${id}`;
+}
+
+/**
+ * Records a click on the tracked link.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {String} id the id of the tracked link
+ * @param {Object} store the storage that the links are kept in
+ * @param {Date} now the current date
+ * @return {Object} the updated link, or null if the link doesn't exist
+ */
+async function recordClick(prefix, id, store = getStore(), now = new Date()) {
+  const filepath = `${prefix}/links/${id}.json`;
+  const data = await store.download(filepath);
+  if (!data) {
+    return null;
+  }
+  const link = JSON.parse(data);
+  link.clicks += 1;
+  link.lastClickedAt = now.toISOString();
+  await store.upload(filepath, JSON.stringify(link));
+  return link;
+}
+
+/**
+ * The routes of the server. Each route has its `method`, `path` (with
+ * `{name}` path parameters), and the `operationId`, `summary`,
+ * `parameters`, and `responses` that describe it in the OpenAPI document
+ * (see `lib/openapi.js`). `admin` routes are limited to the allowlist, and
+ * `enabled` routes are only served when configured. With OpenID Connect,
+ * `admin` routes also require the admin role, and `viewer` routes either
+ * role (see `lib/oidc.js`). `handle` is called with the parameters, the
+ * store, and the request, and returns the response, with `status`,
+ * `headers`, and `body`.
+ */
+const ROUTES = [
+  {
+    method: 'GET',
+    path: '/r/{teamId}/{linkId}',
+    operationId: 'followLink',
+    summary: 'Counts the click on a tracked link and redirects to its URL',
+    parameters: [
+      {name: 'teamId', in: 'path', description: 'The team id'},
+      {name: 'linkId', in: 'path', pattern: '[A-Za-z0-9_-]+', description: 'The id of the tracked link'},
+    ],
+    responses: {302: {description: 'Redirects to the URL of the link'}, 404: {description: 'The link doesn\'t exist'}},
+    handle: async ({teamId, linkId}, store) => {
+      const link = await recordClick(teamId, linkId, store);
+      return link ? {status: 302, headers: {Location: link.url}} : {status: 404};
+    },
+  },
+  {
+    method: 'GET',
+    path: '/status',
+    operationId: 'getStatus',
+    summary: 'Reports whether posting is paused for maintenance',
+    admin: true,
+    responses: {200: {description: 'The maintenance status', contentType: 'application/json', schema: {type: 'object', properties: {paused: {type: 'boolean'}, since: {type: 'string', nullable: true}, by: {type: 'string', nullable: true}, reason: {type: 'string', nullable: true}, source: {type: 'string', nullable: true}, message: {type: 'string'}}}}},
+    handle: async (params, store) => {
+      const status = await getMaintenanceStatus(store);
+      return {status: 200, headers: {'Content-Type': 'application/json'}, body: JSON.stringify({...status, message: formatMaintenanceStatus(status)})};
+    },
+  },
+  {
+    method: 'GET',
+    path: '/metrics',
+    operationId: 'getMetrics',
+    summary: 'Exposes the metrics for Prometheus',
+    admin: true,
+    enabled: () => config.metrics_endpoint,
+    responses: {200: {description: 'The metrics, in the Prometheus text format', contentType: 'text/plain'}},
+    handle: async () => ({status: 200, headers: {'Content-Type': 'text/plain; version=0.0.4'}, body: metrics.formatPrometheus()}),
+  },
+  {
+    method: 'GET',
+    path: '/history/{teamId}',
+    operationId: 'getScheduleHistory',
+    summary: 'Shows the archived schedule as of a past date, with links to the previous and next versions',
+    viewer: true,
+    enabled: () => config.history_pages,
+    parameters: [
+      {name: 'teamId', in: 'path', description: 'The team id'},
+      {name: 'at', in: 'query', description: 'The date (e.g. 2023-10-03, meaning the end of the day) or timestamp, or now by default'},
+      {name: 'season', in: 'query', description: 'The season to limit the archived schedules to (e.g. 2024 Spring), for teams that reuse the same page every season'},
+    ],
+    responses: {200: {description: 'The history page', contentType: 'text/html'}, 400: {description: 'The date isn\'t valid'}, 404: {description: 'The team isn\'t configured'}},
+    handle: async ({teamId, at, season}, store) => await getHistoryPage(teamId, at, store, config.teams, season || null),
+  },
+  {
+    method: 'GET',
+    path: '/history/{teamId}/screenshot/{timestamp}.png',
+    operationId: 'getScheduleHistoryScreenshot',
+    summary: 'Serves the screenshot archived with a schedule snapshot',
+    viewer: true,
+    enabled: () => config.history_pages,
+    parameters: [
+      {name: 'teamId', in: 'path', description: 'The team id'},
+      {name: 'timestamp', in: 'path', pattern: '\\d+', description: 'The timestamp of the snapshot, in milliseconds since epoch'},
+    ],
+    responses: {200: {description: 'The screenshot', contentType: 'image/png'}, 404: {description: 'There is no screenshot for the snapshot'}},
+    handle: async ({teamId, timestamp}, store) => await getHistoryScreenshot(teamId, parseInt(timestamp), store),
+  },
+  {
+    method: 'GET',
+    path: '/auth/login',
+    operationId: 'login',
+    summary: 'Starts logging in with OpenID Connect',
+    enabled: () => !!config.oidc_issuer,
+    parameters: [
+      {name: 'next', in: 'query', description: 'The path to return to once logged in'},
+    ],
+    responses: {302: {description: 'Redirects to the issuer'}},
+    handle: async ({next}) => await startLogin(next),
+  },
+  {
+    method: 'GET',
+    path: '/auth/callback',
+    operationId: 'completeLogin',
+    summary: 'Completes logging in with OpenID Connect, where the issuer redirects back to',
+    enabled: () => !!config.oidc_issuer,
+    parameters: [
+      {name: 'code', in: 'query', description: 'The authorization code'},
+      {name: 'state', in: 'query', description: 'The state of the login'},
+    ],
+    responses: {302: {description: 'Redirects back to where the login started'}, 400: {description: 'No login is in progress'}, 403: {description: 'The user has no role'}},
+    handle: async ({code, state}, store, req) => await completeLogin(code, state, req),
+  },
+  {
+    method: 'GET',
+    path: '/auth/logout',
+    operationId: 'logout',
+    summary: 'Logs out',
+    enabled: () => !!config.oidc_issuer,
+    responses: {200: {description: 'Logged out', contentType: 'text/plain'}},
+    handle: async () => logout(),
+  },
+  {
+    method: 'GET',
+    path: '/openapi.json',
+    operationId: 'getOpenApiSpec',
+    summary: 'Describes the API of the server',
+    responses: {200: {description: 'The OpenAPI document', contentType: 'application/json', schema: {type: 'object'}}},
+    handle: async () => ({status: 200, headers: {'Content-Type': 'application/json'}, body: JSON.stringify(buildOpenApiSpec(ROUTES, version, config.link_tracking_base_url))}),
+  },
+];
+
+/**
+ * Starts the HTTP server that handles the `ROUTES`, i.e. the tracked links
+ * at `GET /r/<team id>/<link id>`, which count the click and redirect. It
+ * also reports whether posting is paused at `GET /status`, the metrics for
+ * Prometheus at `GET /metrics` (when enabled), the archived schedule as of
+ * any past date at `GET /history/<team id>` (when enabled), and describes
+ * itself at `GET /openapi.json`. The admin endpoints are limited to the
+ * `ADMIN_ALLOWLIST` and, when a client CA is configured, to clients with a
+ * certificate. With OpenID Connect, the history pages and the admin
+ * endpoints also require logging in, except that clients with a certificate
+ * (e.g. Prometheus) may use the admin endpoints without. With a TLS key and
+ * certificate, the server is HTTPS.
+ *
+ * @param {Object} store the storage that the links are kept in
+ * @param {Integer} port the port to listen on
+ * @param {Object} tlsOptions the options for `https.createServer()`, or null for HTTP
+ * @param {net.BlockList} allowlist the allowlist for the admin endpoints, or null to allow every address
+ * @return {http.Server} the server
+ */
+function startLinkTrackingServer(store = getStore(), port = config.link_tracking_port, tlsOptions = loadTlsOptions(), allowlist = createAllowlist()) {
+  const handler = async (req, res) => {
+    const matched = matchRoute(ROUTES, req.method, req.url);
+    if (!matched) {
+      res.writeHead(404).end();
+      return;
+    }
+    if (matched.route.admin && !isAdminRequestAuthorized(req, allowlist, !!(tlsOptions && tlsOptions.requestCert))) {
+      res.writeHead(403).end();
+      return;
+    }
+    if (config.oidc_issuer && (matched.route.admin || matched.route.viewer)) {
+      const session = getSession(req);
+      const hasClientCert = !!(tlsOptions && tlsOptions.requestCert && req.socket.authorized);
+      if (!session && !(matched.route.admin && hasClientCert)) {
+        res.writeHead(302, {Location: `/auth/login?next=${encodeURIComponent(req.url)}`}).end();
+        return;
+      }
+      if (session && !isRoleAuthorized(matched.route, session.role) && !(matched.route.admin && hasClientCert)) {
+        res.writeHead(403).end();
+        return;
+      }
+    }
+    try {
+      const response = await matched.route.handle(matched.params, store, req);
+      res.writeHead(response.status, response.headers).end(response.body);
+    } catch (e) {
+      logger.error(e);
+      res.writeHead(500).end();
+    }
+  };
+  const server = tlsOptions ? https.createServer(tlsOptions, handler) : http.createServer(handler);
+  server.listen(port);
+  return server;
+}
+
+/**
+ * Builds the engagement report for the team's tracked links, i.e. how many
+ * times the links in the notifications were clicked.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the links are kept in
+ * @return {Object} Object with the `links`, total `notifications`, total `clicks`, and `clicksByChannel`
+ */
+async function getEngagementReport(prefix, store = getStore()) {
+  const links = [];
+  for (const file of await store.list(`${prefix}/links/`)) {
+    const data = await store.download(file.key);
+    if (data) {
+      links.push(JSON.parse(data));
+    }
+  }
+  links.sort((a, b) => a.createdAt.localeCompare(b.createdAt));
+  const clicksByChannel = {};
+  for (const link of links) {
+    clicksByChannel[link.channel] = (clicksByChannel[link.channel] || 0) + link.clicks;
+  }
+  return {
+    links,
+    notifications: links.length,
+    clicks: links.reduce((total, link) => total + link.clicks, 0),
+    clicksByChannel,
+  };
+}
+
+module.exports = {
+  ROUTES,
+  createTrackedLink,
+  recordClick,
+  startLinkTrackingServer,
+  getEngagementReport,
+};
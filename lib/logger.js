@@ -0,0 +1,115 @@
+/* eslint-disable max-len */
+const moment = require('moment-timezone');
+const config = require('../config');
+
+// Ordered from most to least verbose
+const LEVELS = ['debug', 'info', 'warn', 'error'];
+
+/**
+ * Structured logger with levels, which writes either human readable lines
+ * (`text`, the default) or one JSON object per line (`json`, e.g. for
+ * CloudWatch Logs Insights). Fields such as the team or the duration are
+ * attached to the log lines, rather than formatted into the message.
+ *
+ * @class Logger
+ * @typedef {Logger}
+ */
+class Logger {
+  /**
+   * Creates an instance of Logger.
+   *
+   * @constructor
+   * @param {Object} fields the fields attached to every log line
+   * @param {Object} output Object with `out` and `err` functions that write a line
+   */
+  constructor(fields = {}, output = {out: (line) => console.log(line), err: (line) => console.error(line)}) {
+    this.fields = fields;
+    this.output = output;
+  }
+
+  /**
+   * Creates a logger that attaches the given fields (in addition to this
+   * logger's fields) to every log line, e.g. `logger.with({team: 'BlineBanditsBot'})`.
+   *
+   * @param {Object} fields the fields
+   * @return {Logger} the logger
+   */
+  with(fields) {
+    return new Logger({...this.fields, ...fields}, this.output);
+  }
+
+  /**
+   * Writes the log line, if the level is enabled.
+   *
+   * @param {String} level one of `debug`, `info`, `warn`, or `error`
+   * @param {*} message the message, or an Error
+   * @param {Object} fields the fields of the log line
+   */
+  log(level, message, fields = {}) {
+    if (LEVELS.indexOf(level) < LEVELS.indexOf(config.log_level)) {
+      return;
+    }
+    const attributes = {...this.fields, ...fields};
+    if (message instanceof Error) {
+      attributes.error = message.stack || message.message;
+      message = message.message;
+    } else if (attributes.error instanceof Error) {
+      attributes.error = attributes.error.stack || attributes.error.message;
+    }
+    const write = LEVELS.indexOf(level) >= LEVELS.indexOf('warn') ? this.output.err : this.output.out;
+    if (config.log_format === 'json') {
+      write(JSON.stringify({time: new Date().toISOString(), level, msg: `${message}`, ...attributes}));
+      return;
+    }
+    const timestamp = moment().tz(config.display_time_zone).format('dddd, MMMM Do YYYY, h:mm:ss a');
+    const {error, ...rest} = attributes;
+    const pairs = Object.entries(rest).map(([key, value]) => ` ${key}=${typeof value === 'string' && !/\s/.test(value) ? value : JSON.stringify(value)}`).join('');
+    write(`${level.toUpperCase()}: ${timestamp} - ${message}${pairs}${error ? `\n${error}` : ''}`);
+  }
+
+  /**
+   * Logs at the debug level.
+   *
+   * @param {*} message the message, or an Error
+   * @param {Object} fields the fields of the log line
+   */
+  debug(message, fields) {
+    this.log('debug', message, fields);
+  }
+
+  /**
+   * Logs at the info level.
+   *
+   * @param {*} message the message, or an Error
+   * @param {Object} fields the fields of the log line
+   */
+  info(message, fields) {
+    this.log('info', message, fields);
+  }
+
+  /**
+   * Logs at the warn level.
+   *
+   * @param {*} message the message, or an Error
+   * @param {Object} fields the fields of the log line
+   */
+  warn(message, fields) {
+    this.log('warn', message, fields);
+  }
+
+  /**
+   * Logs at the error level.
+   *
+   * @param {*} message the message, or an Error
+   * @param {Object} fields the fields of the log line
+   */
+  error(message, fields) {
+    this.log('error', message, fields);
+  }
+}
+
+module.exports = {
+  LEVELS,
+  Logger,
+  logger: new Logger(),
+};
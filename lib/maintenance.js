@@ -0,0 +1,111 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+const {formatTimestamp} = require('./format');
+
+/**
+ * The maintenance flag applies to all of the teams, so it is kept at the top
+ * level of the storage rather than under a team's prefix.
+ */
+const MAINTENANCE_FILENAME = 'maintenance.json';
+
+/**
+ * Retrieves the maintenance status, i.e. whether posting is paused. Posting
+ * is paused either through the `MAINTENANCE_MODE` config, or through the
+ * maintenance flag in storage (set by `pauseNotifications()`). The config
+ * takes precedence, since it can't be cleared without a restart.
+ *
+ * @async
+ * @param {Object} store the storage that the maintenance flag is kept in
+ * @return {Object} Object with `paused`, `since`, `by`, `reason`, and `source` (`config` or `store`)
+ */
+async function getMaintenanceStatus(store = getStore()) {
+  if (config.maintenance_mode) {
+    return {
+      paused: true,
+      since: config.maintenance_since,
+      by: config.maintenance_by,
+      reason: config.maintenance_reason,
+      source: 'config',
+    };
+  }
+  try {
+    const data = await store.download(MAINTENANCE_FILENAME);
+    if (data) {
+      const flag = JSON.parse(data);
+      return {paused: true, since: flag.since, by: flag.by, reason: flag.reason, source: 'store'};
+    }
+  } catch (e) {
+    logger.error(e);
+  }
+  return {paused: false, since: null, by: null, reason: null, source: null};
+}
+
+/**
+ * Pauses posting for all of the teams, e.g. during a site migration or a
+ * credential rotation. Scraping and archiving carry on as usual.
+ *
+ * @async
+ * @param {String} by who paused posting
+ * @param {String} reason why posting was paused
+ * @param {Object} store the storage that the maintenance flag is kept in
+ * @param {Date} now the current date
+ * @return {Object} the maintenance flag that was saved
+ */
+async function pauseNotifications(by, reason = null, store = getStore(), now = new Date()) {
+  const flag = {since: now.toISOString(), by, reason};
+  await store.upload(MAINTENANCE_FILENAME, JSON.stringify(flag));
+  return flag;
+}
+
+/**
+ * Resumes posting, by clearing the maintenance flag in storage. This has no
+ * effect when posting is paused through the `MAINTENANCE_MODE` config.
+ *
+ * @async
+ * @param {Object} store the storage that the maintenance flag is kept in
+ * @return {Boolean} true if posting was paused
+ */
+async function resumeNotifications(store = getStore()) {
+  if (!await store.exists(MAINTENANCE_FILENAME)) {
+    return false;
+  }
+  await store.delete(MAINTENANCE_FILENAME);
+  return true;
+}
+
+/**
+ * Formats the maintenance status for display, e.g.
+ * `Paused since Monday, October 2nd 2023, 9:00 am by harvard (site migration)`.
+ *
+ * @param {Object} status the status returned by `getMaintenanceStatus()`
+ * @return {String} the formatted status
+ */
+function formatMaintenanceStatus(status) {
+  if (!status.paused) {
+    return 'Active';
+  }
+  let text = 'Paused';
+  if (status.since) {
+    text += ` since ${formatTimestamp(status.since)}`;
+  }
+  if (status.by) {
+    text += ` by ${status.by}`;
+  }
+  if (status.reason) {
+    text += ` (${status.reason})`;
+  }
+  if (status.source === 'config') {
+    text += ' [MAINTENANCE_MODE]';
+  }
+  return text;
+}
+
+module.exports = {
+  MAINTENANCE_FILENAME,
+  getMaintenanceStatus,
+  pauseNotifications,
+  resumeNotifications,
+  formatMaintenanceStatus,
+};
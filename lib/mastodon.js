@@ -0,0 +1,168 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const config = require('../config');
+const {sleep} = require('./abort');
+const {logger} = require('./logger');
+
+const VALID_VISIBILITIES = ['public', 'unlisted', 'private', 'direct'];
+
+/**
+ * Retrieves the Mastodon account that the team's updates are posted from:
+ * the team's `mastodon` in `TEAMS` (e.g. `{"instanceUrl":
+ * "https://mastodon.social", "accessToken": "..."}`, optionally with its own
+ * `visibility`), or else `MASTODON_INSTANCE_URL` and `MASTODON_ACCESS_TOKEN`.
+ *
+ * @param {Object} team the team
+ * @return {Object} `{instanceUrl, accessToken, visibility}`, or null if Mastodon isn't configured for the team
+ */
+function getMastodonSettings(team) {
+  const settings = (team && team.mastodon) || {};
+  const instanceUrl = settings.instanceUrl || config.mastodon_instance_url;
+  const accessToken = settings.accessToken || config.mastodon_access_token;
+  return instanceUrl && accessToken ? {instanceUrl, accessToken, visibility: settings.visibility || config.mastodon_visibility} : null;
+}
+
+/**
+ * Uploads the image to the Mastodon instance. Larger media is processed
+ * asynchronously by the instance (HTTP 202), in which case this polls until
+ * the media is ready, since a status can't reference unprocessed media.
+ *
+ * @async
+ * @param {Buffer} imageBuffer the binary contents of the image
+ * @param {String} description alt text for the image
+ * @param {AbortSignal} signal the signal that cancels the requests
+ * @param {Object} settings the account, see `getMastodonSettings()`
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {String} the media id, or null on failure
+ */
+async function uploadMedia(imageBuffer, description = '', signal = undefined, settings = getMastodonSettings(null), http = axios) {
+  const headers = {'Authorization': `Bearer ${settings.accessToken}`};
+  try {
+    const form = new FormData();
+    form.append('file', new Blob([Buffer.from(imageBuffer)], {type: 'image/png'}), 'schedule.png');
+    if (description) {
+      form.append('description', description);
+    }
+    const result = await http.post('/api/v2/media', form, {
+      baseURL: settings.instanceUrl,
+      headers,
+      signal,
+    });
+    if (result.status !== 200 && result.status !== 202) {
+      return null;
+    }
+    const mediaId = result.data.id;
+    let url = result.data.url;
+    for (let attempt = 0; !url && attempt < 10; attempt++) {
+      await sleep(1000, signal);
+      const status = await http.get(`/api/v1/media/${mediaId}`, {
+        baseURL: settings.instanceUrl,
+        headers,
+        signal,
+        validateStatus: (code) => code === 200 || code === 206,
+      });
+      url = status.data.url;
+    }
+    return url ? mediaId : null;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Posts a status to the Mastodon instance with the given media attached.
+ *
+ * @async
+ * @param {String} text the text of the status
+ * @param {Array} mediaIds list of media ids returned by `uploadMedia()`
+ * @param {String} visibility one of `public`, `unlisted`, `private`, `direct`
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @param {Object} settings the account, see `getMastodonSettings()`
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Object} the created status, or null on failure
+ */
+async function postStatus(text, mediaIds = [], visibility = config.mastodon_visibility, signal = undefined, settings = getMastodonSettings(null), http = axios) {
+  if (!VALID_VISIBILITIES.includes(visibility)) {
+    logger.warn(`Invalid Mastodon visibility "${visibility}", expected one of ${VALID_VISIBILITIES.join(', ')}`);
+    return null;
+  }
+  try {
+    const result = await http.post('/api/v1/statuses', {
+      status: text,
+      media_ids: mediaIds,
+      visibility,
+    },
+    {
+      baseURL: settings.instanceUrl,
+      headers: {
+        'content-type': 'application/json',
+        'Authorization': `Bearer ${settings.accessToken}`,
+      },
+      signal,
+    });
+    if (result.status !== 200) {
+      return null;
+    }
+    return result.data;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Posts the screenshot to Mastodon along with the given text.
+ *
+ * @async
+ * @param {Buffer} imageBuffer the screenshot to be posted
+ * @param {String} text the text of the status
+ * @param {AbortSignal} signal the signal that cancels the requests
+ * @param {String} altText the alt text of the screenshot, or empty for none
+ * @param {Object} team the team, whose account is posted from, see `getMastodonSettings()`
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Object} the created status, or null on failure
+ */
+async function postScreenshotToMastodon(imageBuffer, text, signal = undefined, altText = '', team = null, http = axios) {
+  const settings = getMastodonSettings(team);
+  if (!settings) {
+    return null;
+  }
+  const mediaId = await uploadMedia(imageBuffer, altText, signal, settings, http);
+  if (!mediaId) {
+    return null;
+  }
+  return await postStatus(text, [mediaId], settings.visibility, signal, settings, http);
+}
+
+/**
+ * Checks that the access tokens that the teams' updates are posted with
+ * work, without posting anything.
+ *
+ * @async
+ * @param {Array} teams the configured teams
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {String} the accounts of the tokens
+ */
+async function checkMastodon(teams = config.teams, http = axios) {
+  const accounts = new Map();
+  [...teams, null].map(getMastodonSettings).filter((settings) => settings).forEach((settings) => accounts.set(`${settings.instanceUrl} ${settings.accessToken}`, settings));
+  const handles = [];
+  for (const settings of accounts.values()) {
+    const result = await http.get('/api/v1/accounts/verify_credentials', {
+      baseURL: settings.instanceUrl,
+      headers: {'Authorization': `Bearer ${settings.accessToken}`},
+    });
+    handles.push(`@${result.data.acct}`);
+  }
+  return handles.join(', ');
+}
+
+module.exports = {
+  VALID_VISIBILITIES,
+  getMastodonSettings,
+  uploadMedia,
+  postStatus,
+  postScreenshotToMastodon,
+  checkMastodon,
+};
@@ -0,0 +1,178 @@
+/* eslint-disable max-len */
+const config = require('../config');
+
+// The help text of the metrics, for the Prometheus endpoint
+const METRICS = {
+  scrape_duration_seconds: {type: 'summary', help: 'Time taken to load and parse the team\'s page'},
+  schedule_entries: {type: 'gauge', help: 'Number of entries in the parsed schedule'},
+  schedule_changes_total: {type: 'counter', help: 'Number of changed schedule entries, by type'},
+  posts_total: {type: 'counter', help: 'Number of posts, by channel and result'},
+  storage_errors_total: {type: 'counter', help: 'Number of failed storage (S3) requests, by operation'},
+  runs_total: {type: 'counter', help: 'Number of team runs, by outcome'},
+  run_heartbeats_total: {type: 'counter', help: 'Number of runs that finished, for alarming on missed runs'},
+  run_failed_teams: {type: 'gauge', help: 'Number of teams that failed in the last run'},
+  last_run_timestamp_seconds: {type: 'gauge', help: 'Time that the last run finished'},
+};
+
+/**
+ * Serializes the labels into the key that the values are kept under.
+ *
+ * @param {String} name the name of the metric
+ * @param {Object} labels the labels, e.g. `{team: 'BlineBanditsBot'}`
+ * @return {String} the key
+ */
+function getKey(name, labels) {
+  return `${name}${JSON.stringify(Object.entries(labels).sort(([a], [b]) => a.localeCompare(b)))}`;
+}
+
+/**
+ * Records the metrics of the runs: counters, gauges, and summaries (sum and
+ * count, e.g. for durations). The totals are exposed in the Prometheus text
+ * format (see `formatPrometheus()`), and the values recorded since the last
+ * flush can be emitted as CloudWatch Embedded Metric Format (EMF) log lines
+ * (see `flushEmf()`).
+ *
+ * @class Metrics
+ * @typedef {Metrics}
+ */
+class Metrics {
+  /**
+   * Creates an instance of Metrics.
+   *
+   * @constructor
+   */
+  constructor() {
+    this.values = new Map(); // totals since the process started, by name and labels
+    this.pending = new Map(); // values since the last EMF flush, by name and labels
+  }
+
+  /**
+   * Updates the value of the metric.
+   *
+   * @param {String} name the name of the metric
+   * @param {Object} labels the labels
+   * @param {Function} update turns the current value (or undefined) into the new one
+   */
+  update(name, labels, update) {
+    for (const values of [this.values, this.pending]) {
+      const key = getKey(name, labels);
+      const current = values.get(key);
+      values.set(key, {name, labels, value: update(current ? current.value : undefined)});
+    }
+  }
+
+  /**
+   * Increments the counter.
+   *
+   * @param {String} name the name of the metric, e.g. `posts_total`
+   * @param {Object} labels the labels, e.g. `{channel: 'twitter', result: 'success'}`
+   * @param {Number} value the amount to increment by
+   */
+  increment(name, labels = {}, value = 1) {
+    this.update(name, labels, (current) => (current || 0) + value);
+  }
+
+  /**
+   * Sets the gauge.
+   *
+   * @param {String} name the name of the metric, e.g. `schedule_entries`
+   * @param {Object} labels the labels
+   * @param {Number} value the value
+   */
+  set(name, labels = {}, value = 0) {
+    this.update(name, labels, () => value);
+  }
+
+  /**
+   * Records an observation in the summary, e.g. a duration.
+   *
+   * @param {String} name the name of the metric, e.g. `scrape_duration_seconds`
+   * @param {Object} labels the labels
+   * @param {Number} value the observed value
+   */
+  observe(name, labels = {}, value = 0) {
+    this.update(name, labels, (current) => ({sum: (current ? current.sum : 0) + value, count: (current ? current.count : 0) + 1}));
+  }
+
+  /**
+   * Formats the totals in the Prometheus text exposition format.
+   *
+   * @return {String} the metrics
+   */
+  formatPrometheus() {
+    const lines = [];
+    const formatLabels = (labels) => {
+      const pairs = Object.entries(labels).map(([key, value]) => `${key}="${`${value}`.replace(/\\/g, '\\\\').replace(/"/g, '\\"').replace(/\n/g, '\\n')}"`);
+      return pairs.length ? `{${pairs.join(',')}}` : '';
+    };
+    for (const [name, metric] of Object.entries(METRICS)) {
+      const series = [...this.values.values()].filter((item) => item.name === name);
+      if (!series.length) {
+        continue;
+      }
+      lines.push(`# HELP ${name} ${metric.help}`, `# TYPE ${name} ${metric.type}`);
+      for (const item of series) {
+        if (metric.type === 'summary') {
+          lines.push(`${name}_sum${formatLabels(item.labels)} ${item.value.sum}`, `${name}_count${formatLabels(item.labels)} ${item.value.count}`);
+        } else {
+          lines.push(`${name}${formatLabels(item.labels)} ${item.value}`);
+        }
+      }
+    }
+    return `${lines.join('\n')}\n`;
+  }
+
+  /**
+   * Builds the EMF document for the values recorded since the last flush,
+   * and clears them. The `team` label is the dimension, while the other
+   * labels are folded into the metric name, e.g. `posts_total_twitter_success`.
+   *
+   * @param {Object} dimensions the dimensions of the document, e.g. `{team: 'BlineBanditsBot'}`
+   * @param {String} namespace the CloudWatch namespace
+   * @param {Date} now the current date
+   * @return {Object} the EMF document, or null if nothing was recorded
+   */
+  buildEmf(dimensions = {}, namespace = config.metrics_namespace, now = new Date()) {
+    const document = {...dimensions};
+    const definitions = [];
+    for (const item of this.pending.values()) {
+      const {team, ...rest} = item.labels;
+      const name = [item.name, ...Object.values(rest)].join('_');
+      const value = typeof item.value === 'object' ? item.value.sum : item.value;
+      document[name] = (document[name] || 0) + value;
+      if (!definitions.some((definition) => definition.Name === name)) {
+        definitions.push({Name: name, Unit: item.name.endsWith('_seconds') ? 'Seconds' : 'Count'});
+      }
+    }
+    this.pending.clear();
+    if (!definitions.length) {
+      return null;
+    }
+    document._aws = {
+      Timestamp: now.getTime(),
+      CloudWatchMetrics: [{Namespace: namespace, Dimensions: [Object.keys(dimensions)], Metrics: definitions}],
+    };
+    return document;
+  }
+
+  /**
+   * Writes the values recorded since the last flush as an EMF log line,
+   * which CloudWatch (e.g. from Lambda or the CloudWatch agent) turns into
+   * metrics. Without EMF enabled, the values are just cleared.
+   *
+   * @param {Object} dimensions the dimensions of the document, e.g. `{team: 'BlineBanditsBot'}`
+   * @param {Function} write writes the log line
+   */
+  flushEmf(dimensions = {}, write = (line) => console.log(line)) {
+    const document = this.buildEmf(dimensions);
+    if (document && config.metrics_emf) {
+      write(JSON.stringify(document));
+    }
+  }
+}
+
+module.exports = {
+  METRICS,
+  Metrics,
+  metrics: new Metrics(),
+};
@@ -0,0 +1,186 @@
+/* eslint-disable max-len */
+const {EJSON} = require('bson');
+const config = require('../config');
+const {canonicalizeSchedule} = require('./helper_functions');
+const {getSnapshotTimestamp} = require('./timeline');
+const {logger} = require('./logger');
+
+/**
+ * The progress of an interrupted migration, kept in the target so that the
+ * migration resumes where it stopped. It's removed once a pass completes, so
+ * that running it again copies everything (e.g. the keys written meanwhile).
+ */
+const PROGRESS_FILENAME = 'migrations/storage.json';
+
+// Save the progress after every this many keys
+const PROGRESS_INTERVAL = 25;
+
+// The directories of the state shared by every team, besides the top level
+const SHARED_DIRECTORIES = ['twitter/', 'run-results/'];
+
+// The directories of each team's state, besides the team's top level
+const TEAM_DIRECTORIES = ['archive/', 'links/'];
+
+/**
+ * Lists every key of the state and archive. Some stores (i.e. DynamoDB) only
+ * list a single directory, so each directory of the layout is listed.
+ *
+ * @async
+ * @param {Object} store the storage to list
+ * @param {Array} teams the configured teams
+ * @return {Array} the keys, sorted
+ */
+async function listMigrationKeys(store, teams = config.teams) {
+  const directories = ['', ...SHARED_DIRECTORIES];
+  for (const team of teams) {
+    directories.push(`${team.id}/`, ...TEAM_DIRECTORIES.map((directory) => `${team.id}/${directory}`));
+  }
+  const keys = new Set();
+  for (const directory of directories) {
+    for (const file of await store.list(directory)) {
+      keys.add(file.key);
+    }
+  }
+  keys.delete(PROGRESS_FILENAME);
+  return [...keys].sort();
+}
+
+/**
+ * Whether the key is a schedule, i.e. the previous schedule, or an archived
+ * snapshot.
+ *
+ * @param {String} key the key
+ * @return {Boolean} true if it's a schedule
+ */
+function isScheduleKey(key) {
+  return /\/previousSchedule\.json$/.test(key) || /\/archive\/schedule-\d{4}-\d{1,2}-\d{1,2}-\d+\.json$/.test(key);
+}
+
+/**
+ * Upgrades a schedule stored before the canonicalization (see
+ * `canonicalizeSchedule()`) to the canonical keys and values. They're read
+ * the same way either way, but the stored files then match what's compared.
+ *
+ * @param {Buffer} contents the stored schedule
+ * @param {Date} storedAt when the schedule was stored, to infer the year of its keys
+ * @return {Buffer} the canonical schedule
+ */
+function canonicalizeScheduleContents(contents, storedAt = new Date()) {
+  const schedule = new Map(Object.entries(EJSON.parse(contents.toString())));
+  return Buffer.from(EJSON.stringify(canonicalizeSchedule(schedule, storedAt)));
+}
+
+/**
+ * Determines what the key is migrated as: copied as is, or, with
+ * `canonicalize`, upgraded to the canonical schedule format. Signed archived
+ * snapshots are always copied as is, since rewriting them would void their
+ * signatures (see `lib/signing.js`).
+ *
+ * @param {String} key the key
+ * @param {Buffer} contents the contents in the source
+ * @param {Set} keys every key in the source
+ * @param {Boolean} canonicalize whether to upgrade the schedules
+ * @return {Buffer} the contents for the target
+ */
+function transformContents(key, contents, keys, canonicalize) {
+  if (!canonicalize || !isScheduleKey(key) || keys.has(`${key}.sig`)) {
+    return contents;
+  }
+  try {
+    return canonicalizeScheduleContents(contents, getSnapshotTimestamp(key) || undefined);
+  } catch (e) {
+    logger.warn(`Unable to canonicalize ${key}, copying it as is: ${e.message}`);
+    return contents;
+  }
+}
+
+/**
+ * Copies the state and archive from one store to another (e.g. from S3 to
+ * Postgres), or upgrades the schedules in place, verifying each key after
+ * it's written. The notifier can keep running on the source meanwhile; once
+ * it's switched to the target, running the migration again picks up the
+ * keys that changed in between.
+ *
+ * @async
+ * @param {Object} source the storage to migrate from
+ * @param {Object} target the storage to migrate to (may be the source, to upgrade in place)
+ * @param {Object} options `{teams, canonicalize, dryRun, onProgress}`, where `onProgress` is called with `(done, total, key)`
+ * @return {Object} `{total, migrated, transformed, resumed, failed}`, with the keys that failed
+ */
+async function migrateStorage(source, target, {teams = config.teams, canonicalize = false, dryRun = false, onProgress = () => {}} = {}) {
+  const keys = await listMigrationKeys(source, teams);
+  const keySet = new Set(keys);
+  const data = dryRun ? null : await target.download(PROGRESS_FILENAME);
+  const progress = data ? JSON.parse(data) : {lastKey: null, migrated: 0};
+  const result = {total: keys.length, migrated: 0, transformed: 0, resumed: 0, failed: []};
+  for (const [index, key] of keys.entries()) {
+    if (progress.lastKey && key <= progress.lastKey) {
+      result.resumed++;
+      continue;
+    }
+    const contents = await source.download(key);
+    if (contents === null) {
+      continue; // deleted since it was listed
+    }
+    const migrated = transformContents(key, Buffer.from(contents), keySet, canonicalize);
+    if (!migrated.equals(Buffer.from(contents))) {
+      result.transformed++;
+    }
+    if (!dryRun) {
+      const written = await target.upload(key, migrated) && await target.download(key);
+      if (!written || !Buffer.from(written).equals(migrated)) {
+        result.failed.push(key);
+        continue;
+      }
+      progress.lastKey = key;
+      progress.migrated++;
+      if (progress.migrated % PROGRESS_INTERVAL === 0) {
+        await target.upload(PROGRESS_FILENAME, JSON.stringify(progress));
+      }
+    }
+    result.migrated++;
+    onProgress(index + 1, keys.length, key);
+  }
+  if (!dryRun && !result.failed.length && await target.exists(PROGRESS_FILENAME)) {
+    await target.delete(PROGRESS_FILENAME);
+  }
+  return result;
+}
+
+/**
+ * Verifies that the target has every key of the source, with the same
+ * contents (or the canonical schedule, with `canonicalize`).
+ *
+ * @async
+ * @param {Object} source the storage that was migrated from
+ * @param {Object} target the storage that was migrated to
+ * @param {Object} options `{teams, canonicalize}`
+ * @return {Array} list of `{key, problem}`, where the problem is `missing` or `different`
+ */
+async function verifyMigration(source, target, {teams = config.teams, canonicalize = false} = {}) {
+  const keys = await listMigrationKeys(source, teams);
+  const keySet = new Set(keys);
+  const problems = [];
+  for (const key of keys) {
+    const contents = await source.download(key);
+    const migrated = await target.download(key);
+    if (contents === null) {
+      continue;
+    }
+    if (migrated === null) {
+      problems.push({key, problem: 'missing'});
+    } else if (!Buffer.from(migrated).equals(transformContents(key, Buffer.from(contents), keySet, canonicalize)) && !Buffer.from(migrated).equals(Buffer.from(contents))) {
+      problems.push({key, problem: 'different'});
+    }
+  }
+  return problems;
+}
+
+module.exports = {
+  PROGRESS_FILENAME,
+  listMigrationKeys,
+  isScheduleKey,
+  canonicalizeScheduleContents,
+  migrateStorage,
+  verifyMigration,
+};
@@ -0,0 +1,323 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const crypto = require('crypto');
+const config = require('../config');
+
+const SESSION_COOKIE = 'bandits_session';
+const LOGIN_COOKIE = 'bandits_login';
+
+// A login that isn't completed within this long has to be started over
+const LOGIN_TIMEOUT_MS = 10 * 60 * 1000;
+
+// The algorithms of the ID tokens that are accepted, with the options to verify them
+const ALGORITHMS = {
+  RS256: {},
+  ES256: {dsaEncoding: 'ieee-p1363'},
+};
+
+// The discovery documents and keys of the issuers, which rarely change
+const discoveries = new Map();
+const keySets = new Map();
+
+// The secret when `OIDC_SESSION_SECRET` isn't configured, for the life of the process
+const generatedSecret = crypto.randomBytes(32).toString('hex');
+
+/**
+ * Retrieves the secret that the cookies are signed with.
+ *
+ * @return {String} the secret
+ */
+function getSessionSecret() {
+  return config.oidc_session_secret || generatedSecret;
+}
+
+/**
+ * Signs the value, so that it can be handed to the browser in a cookie and
+ * trusted when it comes back.
+ *
+ * @param {Object} value the value, which is serialized as JSON
+ * @param {String} secret the secret to sign with
+ * @return {String} the signed value, i.e. `<base64url JSON>.<base64url HMAC>`
+ */
+function signValue(value, secret = getSessionSecret()) {
+  const payload = Buffer.from(JSON.stringify(value)).toString('base64url');
+  return `${payload}.${crypto.createHmac('sha256', secret).update(payload).digest('base64url')}`;
+}
+
+/**
+ * Verifies the signed value, see `signValue()`, and that it hasn't expired.
+ *
+ * @param {String} signed the signed value
+ * @param {String} secret the secret it was signed with
+ * @param {Date} now the current date
+ * @return {Object} the value, or null if it's missing, tampered with, or expired
+ */
+function verifyValue(signed, secret = getSessionSecret(), now = new Date()) {
+  if (!signed || !signed.includes('.')) {
+    return null;
+  }
+  const [payload, signature] = signed.split('.');
+  const expected = crypto.createHmac('sha256', secret).update(payload).digest();
+  const actual = Buffer.from(signature, 'base64url');
+  if (actual.length !== expected.length || !crypto.timingSafeEqual(actual, expected)) {
+    return null;
+  }
+  try {
+    const value = JSON.parse(Buffer.from(payload, 'base64url').toString());
+    return value.expiresAt && new Date(value.expiresAt) > now ? value : null;
+  } catch (e) {
+    return null;
+  }
+}
+
+/**
+ * Parses the `Cookie` header of a request.
+ *
+ * @param {String} header the header
+ * @return {Object} the cookies, by name
+ */
+function parseCookies(header) {
+  const cookies = {};
+  for (const part of (header || '').split(';')) {
+    const index = part.indexOf('=');
+    if (index > 0) {
+      cookies[part.slice(0, index).trim()] = decodeURIComponent(part.slice(index + 1).trim());
+    }
+  }
+  return cookies;
+}
+
+/**
+ * Builds the `Set-Cookie` header for a cookie that only the server reads.
+ *
+ * @param {String} name the name of the cookie
+ * @param {String} value the value, or null to clear the cookie
+ * @param {Integer} maxAge the # of seconds the cookie lasts
+ * @return {String} the header
+ */
+function buildCookie(name, value, maxAge) {
+  const secure = (config.oidc_redirect_uri || '').startsWith('https:') ? '; Secure' : '';
+  return `${name}=${value ? encodeURIComponent(value) : ''}; Path=/; HttpOnly; SameSite=Lax; Max-Age=${value ? maxAge : 0}${secure}`;
+}
+
+/**
+ * Retrieves the discovery document of the issuer, i.e. its endpoints.
+ *
+ * @async
+ * @param {String} issuer the issuer, e.g. `https://accounts.google.com`
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Object} the document, with `authorization_endpoint`, `token_endpoint`, and `jwks_uri`
+ */
+async function discoverIssuer(issuer = config.oidc_issuer, http = axios) {
+  if (!discoveries.has(issuer)) {
+    const result = await http.get(`${issuer}/.well-known/openid-configuration`);
+    discoveries.set(issuer, result.data);
+  }
+  return discoveries.get(issuer);
+}
+
+/**
+ * Retrieves the key that the issuer signed an ID token with, fetching the
+ * keys again when it's new (i.e. the issuer rotated its keys).
+ *
+ * @async
+ * @param {String} jwksUri the URL of the issuer's keys
+ * @param {String} kid the id of the key
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {crypto.KeyObject} the public key, or null if the issuer has no such key
+ */
+async function getSigningKey(jwksUri, kid, http = axios) {
+  let keys = keySets.get(jwksUri);
+  if (!keys || !keys.some((key) => key.kid === kid)) {
+    keys = (await http.get(jwksUri)).data.keys || [];
+    keySets.set(jwksUri, keys);
+  }
+  const jwk = keys.find((key) => key.kid === kid);
+  return jwk ? crypto.createPublicKey({key: jwk, format: 'jwk'}) : null;
+}
+
+/**
+ * Verifies the ID token that the issuer returned: its signature, that it's
+ * for this client, that it hasn't expired, and that it's for this login.
+ *
+ * @async
+ * @param {String} idToken the ID token (a JWT)
+ * @param {Object} discovery the discovery document of the issuer, see `discoverIssuer()`
+ * @param {String} nonce the nonce of the login
+ * @param {Object} http the HTTP client, i.e. axios
+ * @param {Date} now the current date
+ * @return {Object} the claims of the token
+ */
+async function verifyIdToken(idToken, discovery, nonce, http = axios, now = new Date()) {
+  const [header, payload, signature] = `${idToken}`.split('.');
+  if (!header || !payload || !signature) {
+    throw new Error('The ID token is malformed');
+  }
+  const {alg, kid} = JSON.parse(Buffer.from(header, 'base64url').toString());
+  if (!ALGORITHMS[alg]) {
+    throw new Error(`The ID token is signed with an unsupported algorithm: ${alg}`);
+  }
+  const key = await getSigningKey(discovery.jwks_uri, kid, http);
+  if (!key || !crypto.verify('sha256', Buffer.from(`${header}.${payload}`), {key, ...ALGORITHMS[alg]}, Buffer.from(signature, 'base64url'))) {
+    throw new Error('The signature of the ID token isn\'t valid');
+  }
+  const claims = JSON.parse(Buffer.from(payload, 'base64url').toString());
+  const audiences = Array.isArray(claims.aud) ? claims.aud : [claims.aud];
+  if (claims.iss !== discovery.issuer || !audiences.includes(config.oidc_client_id)) {
+    throw new Error('The ID token is for another issuer or client');
+  }
+  if (claims.exp * 1000 <= now.getTime()) {
+    throw new Error('The ID token has expired');
+  }
+  if (claims.nonce !== nonce) {
+    throw new Error('The ID token is for another login');
+  }
+  return claims;
+}
+
+/**
+ * Maps the claims of the logged in user to their role, see `oidc_roles`.
+ * Admins are matched first, and the email address only counts when the
+ * issuer verified it.
+ *
+ * @param {Object} claims the claims of the ID token, with `email`, `email_verified`, and `groups`
+ * @param {Object} roles the entries of each role, by role
+ * @return {String} `admin` or `viewer`, or null if the user has neither
+ */
+function mapRole(claims, roles = config.oidc_roles) {
+  const email = claims.email && claims.email_verified !== false ? `${claims.email}`.toLowerCase() : null;
+  const groups = Array.isArray(claims.groups) ? claims.groups.map((group) => `${group}`.toLowerCase()) : [];
+  const matches = (entry) => {
+    entry = `${entry}`.trim().toLowerCase();
+    if (entry === '*') {
+      return true;
+    }
+    if (entry.startsWith('group:')) {
+      return groups.includes(entry.slice('group:'.length));
+    }
+    if (entry.startsWith('@')) {
+      return !!email && email.endsWith(entry);
+    }
+    return entry === email;
+  };
+  for (const role of ['admin', 'viewer']) {
+    if ((roles[role] || []).some(matches)) {
+      return role;
+    }
+  }
+  return null;
+}
+
+/**
+ * Whether the role may use the route: admins may use every route, and
+ * viewers only the routes that aren't `admin`.
+ *
+ * @param {Object} route the route, see `ROUTES` in `lib/link_tracking.js`
+ * @param {String} role the role, see `mapRole()`
+ * @return {Boolean} true if the role may use the route
+ */
+function isRoleAuthorized(route, role) {
+  return role === 'admin' || (role === 'viewer' && !route.admin);
+}
+
+/**
+ * Retrieves the session of the logged in user that made the request.
+ *
+ * @param {http.IncomingMessage} req the request
+ * @param {Date} now the current date
+ * @return {Object} the session, i.e. `{email, role, expiresAt}`, or null if the user isn't logged in
+ */
+function getSession(req, now = new Date()) {
+  return verifyValue(parseCookies(req.headers.cookie)[SESSION_COOKIE], getSessionSecret(), now);
+}
+
+/**
+ * Starts the login at the issuer. The state and nonce are kept in a signed
+ * cookie until the issuer redirects back, see `completeLogin()`.
+ *
+ * @async
+ * @param {String} next the path to return to once logged in
+ * @param {Object} http the HTTP client, i.e. axios
+ * @param {Date} now the current date
+ * @return {Object} the response, which redirects to the issuer
+ */
+async function startLogin(next = '/', http = axios, now = new Date()) {
+  const discovery = await discoverIssuer(config.oidc_issuer, http);
+  const state = crypto.randomBytes(16).toString('base64url');
+  const nonce = crypto.randomBytes(16).toString('base64url');
+  // Only return to paths of this server, so that the login can't be used to redirect elsewhere
+  next = next && next.startsWith('/') && !next.startsWith('//') ? next : '/';
+  const pending = signValue({state, nonce, next, expiresAt: new Date(now.getTime() + LOGIN_TIMEOUT_MS).toISOString()});
+  const url = new URL(discovery.authorization_endpoint);
+  url.search = new URLSearchParams({
+    response_type: 'code',
+    client_id: config.oidc_client_id,
+    redirect_uri: config.oidc_redirect_uri,
+    scope: 'openid email profile',
+    state,
+    nonce,
+  }).toString();
+  return {status: 302, headers: {'Location': url.toString(), 'Set-Cookie': buildCookie(LOGIN_COOKIE, pending, LOGIN_TIMEOUT_MS / 1000)}};
+}
+
+/**
+ * Completes the login with the code that the issuer redirected back with:
+ * exchanges it for the ID token, maps the user to their role, and starts
+ * the session.
+ *
+ * @async
+ * @param {String} code the `code` in the callback URL
+ * @param {String} state the `state` in the callback URL
+ * @param {http.IncomingMessage} req the request, with the cookie of the pending login
+ * @param {Object} http the HTTP client, i.e. axios
+ * @param {Date} now the current date
+ * @return {Object} the response, which redirects back to where the login started, or 403 when the user has no role
+ */
+async function completeLogin(code, state, req, http = axios, now = new Date()) {
+  const pending = verifyValue(parseCookies(req.headers.cookie)[LOGIN_COOKIE], getSessionSecret(), now);
+  if (!pending || !code || pending.state !== state) {
+    return {status: 400, headers: {'Content-Type': 'text/plain'}, body: 'No login in progress, start it again'};
+  }
+  const discovery = await discoverIssuer(config.oidc_issuer, http);
+  const result = await http.post(discovery.token_endpoint, new URLSearchParams({
+    grant_type: 'authorization_code',
+    code,
+    redirect_uri: config.oidc_redirect_uri,
+    client_id: config.oidc_client_id,
+    client_secret: config.oidc_client_secret || '',
+  }).toString(), {headers: {'Content-Type': 'application/x-www-form-urlencoded'}});
+  const claims = await verifyIdToken(result.data.id_token, discovery, pending.nonce, http, now);
+  const role = mapRole(claims);
+  const clearLogin = buildCookie(LOGIN_COOKIE, null);
+  if (!role) {
+    return {status: 403, headers: {'Content-Type': 'text/plain', 'Set-Cookie': clearLogin}, body: `${claims.email || claims.sub} has no access`};
+  }
+  const maxAge = config.oidc_session_hours * 60 * 60;
+  const session = signValue({email: claims.email || claims.sub, role, expiresAt: new Date(now.getTime() + maxAge * 1000).toISOString()});
+  return {status: 302, headers: {'Location': pending.next, 'Set-Cookie': [clearLogin, buildCookie(SESSION_COOKIE, session, maxAge)]}};
+}
+
+/**
+ * Ends the session.
+ *
+ * @return {Object} the response, which clears the session cookie
+ */
+function logout() {
+  return {status: 200, headers: {'Content-Type': 'text/plain', 'Set-Cookie': buildCookie(SESSION_COOKIE, null)}, body: 'Logged out'};
+}
+
+module.exports = {
+  SESSION_COOKIE,
+  LOGIN_COOKIE,
+  signValue,
+  verifyValue,
+  parseCookies,
+  discoverIssuer,
+  verifyIdToken,
+  mapRole,
+  isRoleAuthorized,
+  getSession,
+  startLogin,
+  completeLogin,
+  logout,
+};
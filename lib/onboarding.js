@@ -0,0 +1,215 @@
+/* eslint-disable max-len */
+const {PARSERS} = require('./parsers');
+const {parseDuration, parseCronExpression} = require('./scheduler');
+const {describeEntry} = require('./timeline');
+
+// The columns of the onboarding CSV. The rest of the settings, e.g. the
+// posting channels, are shared by every team.
+const ONBOARDING_COLUMNS = ['name', 'url', 'handle', 'schedule', 'screenshot', 'watermark', 'hashtags', 'color', 'parser', 'scraper'];
+
+/**
+ * Parses CSV text into rows, keyed by the (lowercased) header of each
+ * column. Quoted values can contain commas, newlines, and doubled quotes.
+ *
+ * @param {String} text the CSV text
+ * @return {Array} the rows, as objects
+ */
+function parseCsv(text) {
+  const records = [];
+  let record = [];
+  let value = '';
+  let quoted = false;
+  for (let i = 0; i < text.length; i++) {
+    const char = text[i];
+    if (quoted) {
+      if (char === '"' && text[i + 1] === '"') {
+        value += '"';
+        i++;
+      } else if (char === '"') {
+        quoted = false;
+      } else {
+        value += char;
+      }
+    } else if (char === '"') {
+      quoted = true;
+    } else if (char === ',') {
+      record.push(value);
+      value = '';
+    } else if (char === '\n' || char === '\r') {
+      if (char === '\r' && text[i + 1] === '\n') {
+        i++;
+      }
+      record.push(value);
+      records.push(record);
+      record = [];
+      value = '';
+    } else {
+      value += char;
+    }
+  }
+  if (value || record.length) {
+    record.push(value);
+    records.push(record);
+  }
+  const [header, ...rows] = records.filter((fields) => fields.some((field) => field.trim()));
+  if (!header) {
+    return [];
+  }
+  const names = header.map((name) => name.trim().toLowerCase());
+  return rows.map((fields) => Object.fromEntries(names.map((name, i) => [name, (fields[i] || '').trim()])));
+}
+
+/**
+ * Builds the team's config (i.e. its entry in `TEAMS`) from a row of the
+ * onboarding CSV, checking each of the settings.
+ *
+ * @param {Object} row the row, see `ONBOARDING_COLUMNS`
+ * @return {Object} Object with the `team`, and the `errors` (empty when the row is valid)
+ */
+function buildTeamConfig(row) {
+  const errors = [];
+  const team = {id: row.handle, url: row.url};
+  if (!row.handle) {
+    errors.push('handle is required');
+  } else if (!/^[A-Za-z0-9_-]+$/.test(row.handle)) {
+    errors.push(`handle ${row.handle} can only have letters, numbers, dashes, and underscores`);
+  }
+  if (!/^https?:\/\/\S+$/.test(row.url || '')) {
+    errors.push(`url ${row.url || '(missing)'} isn't an http(s) URL`);
+  }
+  if (row.name) {
+    team.name = row.name;
+  }
+  if (row.schedule) {
+    try {
+      if (isNaN(parseDuration(row.schedule))) {
+        parseCronExpression(row.schedule);
+      }
+      team.schedule = row.schedule;
+    } catch (e) {
+      errors.push(`schedule ${row.schedule} isn't a duration or cron expression`);
+    }
+  }
+  if (row.screenshot) {
+    if (['page', 'rendered'].includes(row.screenshot)) {
+      team.screenshot = row.screenshot;
+    } else {
+      errors.push(`screenshot ${row.screenshot} isn't page or rendered`);
+    }
+  }
+  if (row.watermark) {
+    if (['true', 'false'].includes(row.watermark.toLowerCase())) {
+      team.watermark = row.watermark.toLowerCase() === 'true';
+    } else {
+      errors.push(`watermark ${row.watermark} isn't true or false`);
+    }
+  }
+  if (row.hashtags) {
+    team.hashtags = row.hashtags.split(/\s+/).filter((hashtag) => hashtag);
+  }
+  if (row.color) {
+    if (/^#[0-9a-fA-F]{3}([0-9a-fA-F]{3})?$/.test(row.color)) {
+      team.color = row.color;
+    } else {
+      errors.push(`color ${row.color} isn't a hex color, e.g. #0b3d91`);
+    }
+  }
+  const scrape = {};
+  if (row.parser) {
+    if (PARSERS.has(row.parser)) {
+      scrape.parser = row.parser;
+    } else {
+      errors.push(`parser ${row.parser} isn't one of ${[...PARSERS.keys()].join(', ')}`);
+    }
+  }
+  if (row.scraper) {
+    if (['browser', 'http'].includes(row.scraper)) {
+      scrape.scraper = row.scraper;
+    } else {
+      errors.push(`scraper ${row.scraper} isn't browser or http`);
+    }
+  }
+  if (Object.keys(scrape).length) {
+    team.scrape = scrape;
+  }
+  const unknown = Object.keys(row).filter((column) => !ONBOARDING_COLUMNS.includes(column) && row[column]);
+  if (unknown.length) {
+    errors.push(`unknown columns: ${unknown.join(', ')}`);
+  }
+  return {team, errors};
+}
+
+/**
+ * Validates each team of the onboarding CSV, by checking its settings and
+ * scraping its page, so that a league admin can see which teams are ready
+ * before adding them to the config.
+ *
+ * @async
+ * @param {Array} rows the rows of the CSV, see `parseCsv()`
+ * @param {Function} scrape scrapes the team's page, returning the schedule (Map)
+ * @param {Array} existingTeams the teams that are already configured
+ * @return {Array} the results, with the `team`, `errors`, and parsed `schedule` (null if it wasn't scraped)
+ */
+async function validateTeams(rows, scrape, existingTeams = []) {
+  const ids = new Set(existingTeams.map((team) => team.id));
+  const results = [];
+  for (const row of rows) {
+    const {team, errors} = buildTeamConfig(row);
+    if (team.id && ids.has(team.id)) {
+      errors.push(`handle ${team.id} is already used by another team`);
+    }
+    ids.add(team.id);
+    let schedule = null;
+    if (!errors.length) {
+      try {
+        schedule = await scrape(team);
+        if (!schedule.size) {
+          errors.push('no schedule entries were found on the page, check the parser and scrape settings');
+        }
+      } catch (e) {
+        errors.push(`unable to scrape the page: ${e.message}`);
+      }
+    }
+    results.push({team, errors, schedule});
+  }
+  return results;
+}
+
+/**
+ * Formats the results of the validation, with a preview of each team's
+ * parsed schedule, followed by the `TEAMS` config with the valid teams
+ * added to the existing ones, ready to be stored with the other secrets.
+ *
+ * @param {Array} results the results, see `validateTeams()`
+ * @param {Array} existingTeams the teams that are already configured
+ * @param {Integer} previewEntries # of schedule entries to preview for each team
+ * @return {String} the report
+ */
+function formatOnboardingReport(results, existingTeams = [], previewEntries = 3) {
+  const lines = [];
+  for (const {team, errors, schedule} of results) {
+    const label = `${team.name || team.id || '(no handle)'} (${team.url || 'no url'})`;
+    if (errors.length) {
+      lines.push(`✗ ${label}`, ...errors.map((error) => `    ${error}`));
+      continue;
+    }
+    lines.push(`✓ ${label}: ${schedule.size} entries`);
+    for (const [key, entry] of [...schedule.entries()].slice(0, previewEntries)) {
+      lines.push(`    ${key}: ${describeEntry(entry)}`);
+    }
+  }
+  const ready = results.filter((result) => !result.errors.length).map((result) => result.team);
+  lines.push('', `${ready.length} of ${results.length} teams are ready.`);
+  if (ready.length) {
+    lines.push('', `TEAMS=${JSON.stringify([...existingTeams, ...ready])}`);
+  }
+  return lines.join('\n');
+}
+
+module.exports = {
+  ONBOARDING_COLUMNS,
+  parseCsv,
+  buildTeamConfig,
+  validateTeams,
+  formatOnboardingReport,
+};
@@ -0,0 +1,155 @@
+/* eslint-disable max-len */
+
+/**
+ * Compiles the path of a route, e.g. `/r/{teamId}/{linkId}`, into the
+ * regular expression that matches it. Each path parameter matches its
+ * `pattern`, or any segment by default.
+ *
+ * @param {Object} route the route, with `path` and `parameters`
+ * @return {RegExp} the regular expression, with a group for each path parameter
+ */
+function compileRoutePath(route) {
+  const patterns = Object.fromEntries((route.parameters || []).filter((parameter) => parameter.in === 'path').map((parameter) => [parameter.name, parameter.pattern || '[^/]+']));
+  const source = route.path.split(/(\{[A-Za-z]+\})/).map((part) => {
+    const match = part.match(/^\{([A-Za-z]+)\}$/);
+    return match ? `(${patterns[match[1]] || '[^/]+'})` : part.replace(/[.*+?^$()|[\]\\]/g, '\\$&');
+  }).join('');
+  return new RegExp(`^${source}$`);
+}
+
+/**
+ * Finds the route that handles the request.
+ *
+ * @param {Array} routes the routes, see `ROUTES` in `lib/link_tracking.js`
+ * @param {String} method the HTTP method of the request
+ * @param {String} url the URL of the request
+ * @return {Object} Object with the `route`, its `params` (path and query, by name), or null if no route matches
+ */
+function matchRoute(routes, method, url) {
+  const {pathname, searchParams} = new URL(url, 'http://localhost');
+  for (const route of routes) {
+    if (route.method !== method || (route.enabled && !route.enabled())) {
+      continue;
+    }
+    const match = pathname.match(compileRoutePath(route));
+    if (!match) {
+      continue;
+    }
+    const params = {};
+    const pathParameters = route.path.match(/\{[A-Za-z]+\}/g) || [];
+    pathParameters.forEach((name, i) => {
+      params[name.slice(1, -1)] = decodeURIComponent(match[i + 1]);
+    });
+    for (const parameter of route.parameters || []) {
+      if (parameter.in === 'query' && searchParams.has(parameter.name)) {
+        params[parameter.name] = searchParams.get(parameter.name);
+      }
+    }
+    return {route, params};
+  }
+  return null;
+}
+
+/**
+ * Builds the OpenAPI document describing the routes of the server, so that
+ * it always matches what the server handles.
+ *
+ * @param {Array} routes the routes, see `ROUTES` in `lib/link_tracking.js`
+ * @param {String} version the version of the API, i.e. of the package
+ * @param {String} serverUrl the base URL of the server, or null to leave it out
+ * @return {Object} the OpenAPI 3.0 document
+ */
+function buildOpenApiSpec(routes, version = '0.0.1', serverUrl = null) {
+  const paths = {};
+  for (const route of routes) {
+    const responses = {};
+    for (const [status, response] of Object.entries(route.responses)) {
+      responses[status] = {description: response.description};
+      if (response.contentType) {
+        responses[status].content = {[response.contentType]: {schema: response.schema || {type: 'string', ...(response.contentType === 'image/png' ? {format: 'binary'} : {})}}};
+      }
+    }
+    if (route.admin) {
+      responses['403'] = {description: 'The client isn\'t on the admin allowlist, has no client certificate, or lacks the admin role'};
+    }
+    if (route.admin || route.viewer) {
+      responses['302'] = responses['302'] || {description: 'Redirects to log in, when OpenID Connect is configured'};
+    }
+    paths[route.path] = paths[route.path] || {};
+    paths[route.path][route.method.toLowerCase()] = {
+      operationId: route.operationId,
+      summary: route.summary,
+      tags: [route.admin ? 'admin' : route.viewer ? 'viewer' : 'public'],
+      parameters: (route.parameters || []).map((parameter) => ({
+        name: parameter.name,
+        in: parameter.in,
+        required: parameter.in === 'path',
+        description: parameter.description,
+        schema: {type: 'string', ...(parameter.pattern ? {pattern: `^${parameter.pattern}$`} : {})},
+      })),
+      responses,
+    };
+  }
+  const spec = {
+    openapi: '3.0.3',
+    info: {title: 'Bandits Notification', version, description: 'Tracked links, status, metrics, and schedule history of the notifier.'},
+    paths,
+  };
+  if (serverUrl) {
+    spec.servers = [{url: serverUrl.replace(/\/$/, '')}];
+  }
+  return spec;
+}
+
+/**
+ * Generates a TypeScript client for the API from the OpenAPI document, with
+ * a method per operation that returns the `fetch()` response, so that team
+ * apps can integrate without reverse-engineering the endpoints.
+ *
+ * @param {Object} spec the OpenAPI document, see `buildOpenApiSpec()`
+ * @return {String} the TypeScript source of the client
+ */
+function generateClient(spec) {
+  const methods = [];
+  for (const [path, operations] of Object.entries(spec.paths)) {
+    for (const [method, operation] of Object.entries(operations)) {
+      const pathParameters = operation.parameters.filter((parameter) => parameter.in === 'path');
+      const queryParameters = operation.parameters.filter((parameter) => parameter.in === 'query');
+      const args = pathParameters.map((parameter) => `${parameter.name}: string`);
+      if (queryParameters.length) {
+        args.push(`query: {${queryParameters.map((parameter) => `${parameter.name}?: string`).join('; ')}} = {}`);
+      }
+      const url = path.replace(/\{([A-Za-z]+)\}/g, '${encodeURIComponent($1)}');
+      methods.push(`  /** ${operation.summary} */
+  ${operation.operationId}(${args.join(', ')}): Promise<Response> {
+    return this.request('${method.toUpperCase()}', \`${url}\`${queryParameters.length ? ', query' : ''});
+  }`);
+    }
+  }
+  return `// Generated from the OpenAPI document of ${spec.info.title} ${spec.info.version}, do not edit.
+// Regenerate with: npm run openapi
+
+export class BanditsNotificationClient {
+  constructor(private baseUrl: string, private fetchImpl: typeof fetch = fetch) {}
+
+  private request(method: string, path: string, query: Record<string, string | undefined> = {}): Promise<Response> {
+    const url = new URL(this.baseUrl.replace(/\\/$/, '') + path);
+    for (const [name, value] of Object.entries(query)) {
+      if (value !== undefined) {
+        url.searchParams.set(name, value);
+      }
+    }
+    return this.fetchImpl(url.toString(), {method});
+  }
+
+${methods.join('\n\n')}
+}
+`;
+}
+
+module.exports = {
+  compileRoutePath,
+  matchRoute,
+  buildOpenApiSpec,
+  generateClient,
+};
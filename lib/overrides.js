@@ -0,0 +1,194 @@
+/* eslint-disable max-len */
+const {getStore} = require('./storage');
+const {parseScheduleEntry, getEntryDate} = require('./helper_functions');
+const {logger} = require('./logger');
+const {withTeamLock} = require('./team_lock');
+
+/**
+ * Parses a schedule key such as `SATURDAY, 9/6` (or `SATURDAY, 9/6 @ 1:00`
+ * for a later entry of the day, see `getScheduleKey()`) into its parts.
+ * The year is optional, and inferred when the override is applied.
+ *
+ * @param {String} key the schedule key
+ * @return {Object} Object with the normalized `key`, `dayOfWeek`, and `dayOfMonth`, or null if invalid
+ */
+function parseScheduleKey(key) {
+  const match = `${key}`.toUpperCase().trim().match(/^(SUNDAY|MONDAY|TUESDAY|WEDNESDAY|THURSDAY|FRIDAY|SATURDAY),? +(\d+\/\d+)(\/\d{4})?(?: *@ *(\d{1,2}:\d{2}))?(?: *#(\d+))?$/);
+  if (!match) {
+    return null;
+  }
+  return {key: `${match[1]}, ${match[2]}${match[3] || ''}${match[4] ? ` @ ${match[4]}` : ''}${match[5] ? ` #${match[5]}` : ''}`, dayOfWeek: match[1], dayOfMonth: match[2]};
+}
+
+/**
+ * Checks whether the override has expired.
+ *
+ * @param {Object} override the override entry
+ * @param {Date} now the current date
+ * @return {Boolean} true if the override has expired
+ */
+function isExpired(override, now = new Date()) {
+  return Boolean(override.expiresAt) && new Date(override.expiresAt) <= now;
+}
+
+/**
+ * Retrieves all of the manually entered schedule entries for the team,
+ * including the ones that have expired.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {Object} store the storage that the overrides are kept in
+ * @return {Map} map of schedule key to the override entry
+ */
+async function loadAllOverrides(prefix, store = getStore()) {
+  const data = await store.download(`${prefix}/overrides.json`);
+  if (!data) {
+    return new Map();
+  }
+  try {
+    return new Map(Object.entries(JSON.parse(data)));
+  } catch (e) {
+    logger.error(e);
+  }
+  return new Map();
+}
+
+/**
+ * Retrieves the active (i.e. not expired) manually entered schedule entries
+ * for the team.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {Object} store the storage that the overrides are kept in
+ * @param {Date} now the current date
+ * @return {Map} map of schedule key to the override entry
+ */
+async function loadOverrides(prefix, store = getStore(), now = new Date()) {
+  const overrides = await loadAllOverrides(prefix, store);
+  return new Map([...overrides].filter(([key, override]) => !isExpired(override, now)));
+}
+
+/**
+ * Persists the manually entered schedule entries for the team.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {Map} overrides map of schedule key to the override entry
+ * @param {Object} store the storage that the overrides are kept in
+ */
+async function saveOverrides(prefix, overrides, store = getStore()) {
+  await store.upload(`${prefix}/overrides.json`, JSON.stringify(Object.fromEntries(overrides)));
+}
+
+/**
+ * Manually enters (or corrects) a schedule entry. The details are written
+ * the same way they appear on the web page, e.g. `Practice, Warren, 3:00–5:30`.
+ * Unless an expiry is given, the override expires the day after the entry's
+ * date. Expired overrides are pruned whenever an override is set. The
+ * overrides are written while holding the team's lock, so that they can't
+ * interleave with a run's writes.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {String} key the schedule key, e.g. `SATURDAY, 9/6`
+ * @param {String} details the block of information for the day
+ * @param {Object} store the storage that the overrides are kept in
+ * @param {Date} expiresAt when the override expires
+ * @param {Date} now the current date
+ * @return {Object} the override entry
+ * @throws {Error} when another run holds the team's lock
+ */
+async function setOverride(prefix, key, details, store = getStore(), expiresAt = null, now = new Date()) {
+  const parsedKey = parseScheduleKey(key);
+  if (!parsedKey) {
+    throw new Error(`Invalid schedule key "${key}", expected something like "SATURDAY, 9/6"`);
+  }
+  if (!expiresAt) {
+    expiresAt = getEntryDate(parsedKey.dayOfMonth, now);
+    expiresAt.setDate(expiresAt.getDate() + 1);
+  }
+  const entry = {
+    ...parseScheduleEntry(parsedKey.dayOfWeek, parsedKey.dayOfMonth, details, now),
+    manuallyCorrected: true,
+    createdAt: now.toISOString(),
+    expiresAt: expiresAt.toISOString(),
+  };
+  return await withTeamLock(prefix, async () => {
+    const overrides = await loadOverrides(prefix, store, now);
+    overrides.set(parsedKey.key, entry);
+    await saveOverrides(prefix, overrides, store);
+    return entry;
+  }, store);
+}
+
+/**
+ * Clears the override for a single schedule entry, or all of the overrides
+ * for the team when no key is given, while holding the team's lock.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {String} key the schedule key, e.g. `SATURDAY, 9/6`, or null for all
+ * @param {Object} store the storage that the overrides are kept in
+ * @return {Integer} the number of overrides that were cleared
+ * @throws {Error} when another run holds the team's lock
+ */
+async function clearOverrides(prefix, key = null, store = getStore()) {
+  const parsedKey = key ? parseScheduleKey(key) : null;
+  if (key && !parsedKey) {
+    throw new Error(`Invalid schedule key "${key}", expected something like "SATURDAY, 9/6"`);
+  }
+  return await withTeamLock(prefix, async () => {
+    const overrides = await loadAllOverrides(prefix, store);
+    let cleared = 0;
+    if (parsedKey) {
+      cleared = overrides.delete(parsedKey.key) ? 1 : 0;
+    } else {
+      cleared = overrides.size;
+      overrides.clear();
+    }
+    await saveOverrides(prefix, overrides, store);
+    return cleared;
+  }, store);
+}
+
+/**
+ * Merges the overrides over the parsed schedule. Overrides replace the parsed
+ * entry for the same day, and days that are missing from the parsed schedule
+ * are added. Overrides keyed without a year take the year of their entry, so
+ * that they match the parsed keys.
+ *
+ * @param {Map} schedule the schedule parsed from the web page
+ * @param {Map} overrides map of schedule key to the override entry
+ * @return {Map} the merged schedule
+ */
+function applyOverrides(schedule, overrides) {
+  const merged = new Map(schedule);
+  overrides.forEach((entry, key) => {
+    const year = entry && /^\d{4}-/.test(entry.date) ? `/${entry.date.slice(0, 4)}` : '';
+    merged.set(`${key}`.replace(/^([A-Z]+, \d+\/\d+)(?!\/\d)/, `$1${year}`), entry);
+  });
+  return merged;
+}
+
+/**
+ * Checks whether any of the added or modified entries were manually
+ * corrected, so the notifications can call it out.
+ *
+ * @param {Object} scheduleDiff the output of `compareSchedules()`
+ * @return {Boolean} true if any of the changes came from an override
+ */
+function hasManualCorrections(scheduleDiff) {
+  return [...scheduleDiff.added.values(), ...scheduleDiff.modified.values()].some((entry) => entry.manuallyCorrected);
+}
+
+module.exports = {
+  parseScheduleKey,
+  isExpired,
+  loadAllOverrides,
+  loadOverrides,
+  saveOverrides,
+  setOverride,
+  clearOverrides,
+  applyOverrides,
+  hasManualCorrections,
+};
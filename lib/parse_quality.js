@@ -0,0 +1,165 @@
+/* eslint-disable max-len */
+const {getStore} = require('./storage');
+const {getEntryDate} = require('./helper_functions');
+const {isFallbackExtraction} = require('./parsers');
+const {logger} = require('./logger');
+
+const DAYS_OF_WEEK = ['SUNDAY', 'MONDAY', 'TUESDAY', 'WEDNESDAY', 'THURSDAY', 'FRIDAY', 'SATURDAY'];
+
+// Locations longer than this probably swallowed the entries that follow them
+const MAX_LOCATION_LENGTH = 100;
+
+/**
+ * Determines the reasons that a parsed entry is low-confidence, i.e. looks
+ * like the layout of the page may have changed under the parser.
+ *
+ * @param {Object} entry the schedule entry
+ * @param {Date} now the current date
+ * @return {Array} the reasons, empty if the entry looks right
+ */
+function getLowConfidenceReasons(entry, now = new Date()) {
+  const reasons = [];
+  const date = getEntryDate(entry.dayOfMonth, now);
+  if (date && DAYS_OF_WEEK[date.getDay()] !== entry.dayOfWeek) {
+    reasons.push(`${entry.dayOfMonth} isn't a ${entry.dayOfWeek.toLowerCase()}`);
+  }
+  if (entry.timeBlock && !entry.parsed) {
+    reasons.push(`time ${entry.timeBlock} couldn't be parsed`);
+  }
+  if (entry.location && entry.location.length > MAX_LOCATION_LENGTH) {
+    reasons.push(`location is ${entry.location.length} characters long`);
+  }
+  if (entry.location && (/\b\d{1,2}\/\d{1,2}\b/.test(entry.location) || new RegExp(`\\b(${DAYS_OF_WEEK.join('|')})\\b`, 'i').test(entry.location))) {
+    reasons.push('location contains another date');
+  }
+  return reasons;
+}
+
+/**
+ * Finds the text that looks like it starts an entry (i.e. has a day or a
+ * date), but wasn't recognized by the parser, e.g. `Sat 10/7` or
+ * `Saturday, 10/7`. The text of the schedule section isn't always split into
+ * lines, so the text following each unrecognized day or date is returned.
+ *
+ * @param {String} text the text that the schedule was parsed from
+ * @param {Integer} snippetLength the maximum length of the returned text
+ * @return {Array} the unmatched text
+ */
+function findUnmatchedLines(text, snippetLength = 40) {
+  const recognized = new RegExp(`(?:${DAYS_OF_WEEK.join('|')}),\\s*\\d+\\/\\d+`);
+  const looksLikeEntry = new RegExp(`\\b(?:${DAYS_OF_WEEK.map((day) => `${day.slice(0, 3)}(?:${day.slice(3)})?`).join('|')})\\b|\\b\\d{1,2}\\/\\d{1,2}\\b`, 'gi');
+  const unmatched = [];
+  for (const chunk of `${text}`.split(recognized)) {
+    for (const match of chunk.matchAll(looksLikeEntry)) {
+      const snippet = chunk.slice(match.index, match.index + snippetLength).split(/\r?\n/)[0].trim();
+      // A day followed by its date is a single match, e.g. "Sat 10/7"
+      if (!unmatched.length || !unmatched[unmatched.length - 1].includes(snippet)) {
+        unmatched.push(snippet);
+      }
+    }
+  }
+  return unmatched;
+}
+
+/**
+ * Builds the parse quality report of a scrape, so that degradations in the
+ * page's layout are visible as a trend before the parse fails entirely.
+ *
+ * @param {Map} schedule the parsed schedule (before any overrides)
+ * @param {String} text the text that the schedule was parsed from, or null if the parser doesn't parse text
+ * @param {Date} now the current date
+ * @param {String} extraction how the schedule section was extracted (see `extractScheduleSection()`), or null if it wasn't
+ * @return {Object} the report, with the # of `entries`, the # of entries with `missingFields`, the `lowConfidence` entries, the `unmatchedLines`, and the `extraction`
+ */
+function buildParseQualityReport(schedule, text, now = new Date(), extraction = null) {
+  const missingFields = {location: 0, timeBlock: 0};
+  const lowConfidence = [];
+  for (const [key, entry] of schedule) {
+    if (!entry.location) {
+      missingFields.location++;
+    }
+    if (!entry.timeBlock) {
+      missingFields.timeBlock++;
+    }
+    const reasons = getLowConfidenceReasons(entry, now);
+    if (reasons.length) {
+      lowConfidence.push({key, reasons});
+    }
+  }
+  return {
+    generatedAt: now.toISOString(),
+    entries: schedule.size,
+    missingFields,
+    lowConfidence,
+    unmatchedLines: text === null ? null : findUnmatchedLines(text),
+    extraction,
+  };
+}
+
+/**
+ * Summarizes the parse quality report in a single line, for the logs.
+ *
+ * @param {Object} report the report, see `buildParseQualityReport()`
+ * @return {String} the summary
+ */
+function formatParseQualitySummary(report) {
+  const parts = [
+    `${report.entries} entries`,
+    `${report.missingFields.location} missing location`,
+    `${report.missingFields.timeBlock} missing time`,
+    `${report.lowConfidence.length} low-confidence`,
+  ];
+  if (report.unmatchedLines) {
+    parts.push(`${report.unmatchedLines.length} unmatched lines`);
+  }
+  if (isFallbackExtraction(report.extraction)) {
+    parts.push(`${report.extraction} fallback extraction`);
+  }
+  return parts.join(', ');
+}
+
+/**
+ * Determines whether the report shows problems worth a warning.
+ *
+ * @param {Object} report the report, see `buildParseQualityReport()`
+ * @return {Boolean} true if no entries were found, some were low-confidence or unmatched, or the extraction fell back
+ */
+function hasParseQualityIssues(report) {
+  return !report.entries || report.lowConfidence.length > 0 || (report.unmatchedLines || []).length > 0 || isFallbackExtraction(report.extraction);
+}
+
+/**
+ * Appends the report to the team's parse quality reports for the day, i.e.
+ * `<prefix>/parse-quality/YYYY-MM-DD.json`, so that the trend can be
+ * followed across runs.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} report the report, see `buildParseQualityReport()`
+ * @param {Object} store the storage that the reports are kept in
+ * @return {Array} the reports for the day
+ */
+async function recordParseQualityReport(prefix, report, store = getStore()) {
+  const filepath = `${prefix}/parse-quality/${report.generatedAt.slice(0, 10)}.json`;
+  let reports = [];
+  const data = await store.download(filepath);
+  if (data) {
+    try {
+      reports = JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  reports.push(report);
+  await store.upload(filepath, JSON.stringify(reports));
+  return reports;
+}
+
+module.exports = {
+  getLowConfidenceReasons,
+  findUnmatchedLines,
+  buildParseQualityReport,
+  formatParseQualitySummary,
+  hasParseQualityIssues,
+  recordParseQualityReport,
+};
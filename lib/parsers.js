@@ -0,0 +1,242 @@
+/* eslint-disable max-len */
+const cheerio = require('cheerio');
+const {parseSchedule, parseScheduleEntry, getScheduleKey, getEntryDate} = require('./helper_functions');
+
+const DAYS_OF_WEEK = ['SUNDAY', 'MONDAY', 'TUESDAY', 'WEDNESDAY', 'THURSDAY', 'FRIDAY', 'SATURDAY'];
+
+/**
+ * Normalizes the text of a heading for relaxed matching, i.e. ignoring the
+ * casing and the whitespace.
+ *
+ * @param {String} text the text
+ * @return {String} the normalized text
+ */
+function normalizeHeadingText(text) {
+  return `${text || ''}`.replace(/[\u200B-\u200D\uFEFF]/g, '').replace(/\s+/g, ' ').trim().toLowerCase();
+}
+
+/**
+ * Extracts the schedule section from the page's HTML, i.e. the parent of
+ * the anchor element. When the anchor isn't found (e.g. the heading was
+ * renamed or restyled), the extraction is retried once, with relaxed heading
+ * matching and then with the alternate anchors, before falling back to the
+ * text of the entire page.
+ *
+ * @param {String} html the HTML of the page
+ * @param {Object} settings the scrape settings, see `getScrapeSettings()`
+ * @return {Object} `{text, strategy}`, where the strategy is `anchor`, `relaxed`, `alternate`, or `page` (see `isFallbackExtraction()`)
+ */
+function extractScheduleSection(html, settings) {
+  const $ = cheerio.load(html);
+  const selector = settings.anchorText ? `${settings.anchorSelector}:contains(${JSON.stringify(settings.anchorText)})` : settings.anchorSelector;
+  const anchor = $(selector).first();
+  if (anchor.length) {
+    return {text: anchor.parent().text(), strategy: 'anchor'}; // the parent contains the entire schedule section
+  }
+  const headings = $(`h1, h2, h3, h4, h5, h6, ${settings.anchorSelector}`);
+  const findHeading = (anchorText) => headings.filter((i, element) => normalizeHeadingText($(element).text()).includes(normalizeHeadingText(anchorText))).first();
+  if (settings.anchorText) {
+    const relaxed = findHeading(settings.anchorText);
+    if (relaxed.length) {
+      return {text: relaxed.parent().text(), strategy: 'relaxed'};
+    }
+  }
+  for (const anchorText of settings.alternateAnchors || []) {
+    const alternate = findHeading(anchorText);
+    if (alternate.length) {
+      return {text: alternate.parent().text(), strategy: 'alternate'};
+    }
+  }
+  return {text: $('body').text(), strategy: 'page'};
+}
+
+/**
+ * Extracts the text of the schedule section from the page's HTML, see
+ * `extractScheduleSection()`.
+ *
+ * @param {String} html the HTML of the page
+ * @param {Object} settings the scrape settings, see `getScrapeSettings()`
+ * @return {String} the text of the schedule section
+ */
+function extractScheduleText(html, settings) {
+  return extractScheduleSection(html, settings).text;
+}
+
+/**
+ * Whether the schedule came from a fallback extraction, i.e. the anchor
+ * wasn't found as configured, so its changes should be treated cautiously.
+ *
+ * @param {String} strategy the extraction strategy, see `extractScheduleSection()`
+ * @return {Boolean} true if the extraction fell back
+ */
+function isFallbackExtraction(strategy) {
+  return !!strategy && strategy !== 'anchor';
+}
+
+/**
+ * Determines the schedule key of a date, e.g. `SATURDAY, 10/7` for `10/7`,
+ * `Sat 10/7/2023`, or `2023-10-07`. When the date doesn't include a year, it
+ * is inferred (see `getEntryDate()`).
+ *
+ * @param {String} text the text with the date
+ * @param {Date} now the current date
+ * @return {Object} Object with `dayOfWeek`, `dayOfMonth`, and `date` (e.g. `2023-10-07`), or null if there isn't a date
+ */
+function parseDateKey(text, now = new Date()) {
+  let date = null;
+  const isoMatch = `${text}`.match(/(\d{4})-(\d{1,2})-(\d{1,2})/);
+  const usMatch = `${text}`.match(/(\d{1,2})\/(\d{1,2})(?:\/(\d{4}|\d{2}))?/);
+  if (isoMatch) {
+    date = new Date(parseInt(isoMatch[1]), parseInt(isoMatch[2]) - 1, parseInt(isoMatch[3]));
+  } else if (usMatch && usMatch[3]) {
+    const year = parseInt(usMatch[3]);
+    date = new Date(year < 100 ? 2000 + year : year, parseInt(usMatch[1]) - 1, parseInt(usMatch[2]));
+  } else if (usMatch) {
+    date = getEntryDate(`${usMatch[1]}/${usMatch[2]}`, now);
+  }
+  if (!date || isNaN(date)) {
+    return null;
+  }
+  return {
+    dayOfWeek: DAYS_OF_WEEK[date.getDay()],
+    dayOfMonth: `${date.getMonth() + 1}/${date.getDate()}`,
+    date: [date.getFullYear(), date.getMonth() + 1, date.getDate()].map((part) => `${part}`.padStart(2, '0')).join('-'),
+  };
+}
+
+/**
+ * Adds an entry to the schedule, keyed like the Wix schedule, e.g.
+ * `SATURDAY, 10/7/2023`. The entry keeps the year of the date when it has one.
+ *
+ * @param {Map} schedule the schedule being built
+ * @param {String} dateText the text with the date
+ * @param {String} details the block of information for the day
+ * @param {Date} now the current date
+ */
+function addEntry(schedule, dateText, details, now) {
+  const key = parseDateKey(dateText, now);
+  if (!key || !details) {
+    return;
+  }
+  const entry = {...parseScheduleEntry(key.dayOfWeek, key.dayOfMonth, details, now), date: key.date};
+  schedule.set(getScheduleKey(entry, schedule), entry);
+}
+
+/**
+ * Looks up a (dot separated) path in the object, e.g. `data.events`.
+ *
+ * @param {Object} object the object
+ * @param {String} path the path, or empty for the object itself
+ * @return {*} the value at the path, or undefined
+ */
+function getPath(object, path) {
+  if (!path) {
+    return object;
+  }
+  return path.split('.').reduce((value, part) => (value === undefined || value === null ? undefined : value[part]), object);
+}
+
+/**
+ * The parsers for the different kinds of schedule pages. Each parser turns
+ * the page's content (`html` and `text`) into the schedule Map.
+ */
+const PARSERS = new Map([
+  // Wix rich-text, where the schedule is a section of text under an anchor
+  ['wix', (content, settings, now) => parseSchedule(extractScheduleText(content.html, settings), now, settings.endMarkers)],
+  // Plain text, where the schedule is the text of the entire page
+  ['text', (content, settings, now) => parseSchedule(content.text, now, settings.endMarkers)],
+  // HTML table (e.g. TeamSnap-style), with the date in one column and the details in the others
+  ['table', (content, settings, now) => {
+    const $ = cheerio.load(content.html);
+    const schedule = new Map();
+    $(settings.rowSelector).each((i, row) => {
+      const cells = $(row).find('td').map((j, cell) => $(cell).text().trim()).get();
+      const details = cells.filter((cell, j) => j !== settings.dateColumn && cell).join(', ');
+      addEntry(schedule, cells[settings.dateColumn], details, now);
+    });
+    return schedule;
+  }],
+  // JSON API, with a list of events that each have a date and details
+  ['json', (content, settings, now) => {
+    const items = getPath(JSON.parse(content.text), settings.itemsPath) || [];
+    const schedule = new Map();
+    for (const item of items) {
+      const details = settings.detailsFields.map((field) => getPath(item, field)).filter((value) => value).join(', ');
+      addEntry(schedule, getPath(item, settings.dateField), details, now);
+    }
+    return schedule;
+  }],
+]);
+
+/**
+ * Registers a parser, so that teams can select it with `parser` in their
+ * scrape settings.
+ *
+ * @param {String} name the name of the parser
+ * @param {Function} parser turns `(content, settings, now)` into the schedule Map
+ */
+function registerParser(name, parser) {
+  PARSERS.set(name, parser);
+}
+
+/**
+ * Retrieves the text that the schedule is parsed from, i.e. the upcoming
+ * portion of the schedule section, for the parsers that parse text.
+ *
+ * @param {Object} content the page's content, i.e. `{html, text}`
+ * @param {Object} settings the scrape settings, see `getScrapeSettings()`
+ * @return {String} the text, or null if the parser doesn't parse text (e.g. `table` and `json`)
+ */
+function getScheduleSourceText(content, settings) {
+  let text = null;
+  if (settings.parser === 'wix') {
+    text = extractScheduleText(content.html, settings);
+  } else if (settings.parser === 'text') {
+    text = content.text;
+  }
+  if (text === null) {
+    return null;
+  }
+  return (settings.endMarkers || []).reduce((remaining, marker) => remaining.split(marker)[0], text);
+}
+
+/**
+ * Determines how the schedule section was extracted from the page's
+ * content, for the parsers that extract a section.
+ *
+ * @param {Object} content the page's content, i.e. `{html, text}`
+ * @param {Object} settings the scrape settings, see `getScrapeSettings()`
+ * @return {String} the strategy (see `extractScheduleSection()`), or null if the parser doesn't extract a section
+ */
+function getExtractionStrategy(content, settings) {
+  return settings.parser === 'wix' ? extractScheduleSection(content.html, settings).strategy : null;
+}
+
+/**
+ * Parses the page's content into the schedule, with the parser selected in
+ * the scrape settings.
+ *
+ * @param {Object} content the page's content, i.e. `{html, text}`
+ * @param {Object} settings the scrape settings, see `getScrapeSettings()`
+ * @param {Date} now the current date
+ * @return {Map} the schedule
+ */
+function parseSchedulePage(content, settings, now = new Date()) {
+  const parser = PARSERS.get(settings.parser);
+  if (!parser) {
+    throw new Error(`Unknown parser "${settings.parser}", expected one of ${[...PARSERS.keys()].join(', ')}`);
+  }
+  return parser(content, settings, now);
+}
+
+module.exports = {
+  PARSERS,
+  extractScheduleSection,
+  extractScheduleText,
+  isFallbackExtraction,
+  getExtractionStrategy,
+  parseDateKey,
+  registerParser,
+  getScheduleSourceText,
+  parseSchedulePage,
+};
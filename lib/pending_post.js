@@ -0,0 +1,140 @@
+/* eslint-disable max-len */
+const crypto = require('crypto');
+const {EJSON} = require('bson');
+const {getStore} = require('./storage');
+const {serializeSchedule} = require('./helper_functions');
+const {logger} = require('./logger');
+
+// The retry token of a change that's been archived, but not yet notified of
+const PENDING_POST_FILENAME = 'pendingPost.json';
+
+/**
+ * Hashes the schedule, to tell whether a pending post is for the same
+ * changes.
+ *
+ * @param {Map} schedule the schedule
+ * @return {String} the hash
+ */
+function hashSchedule(schedule) {
+  return crypto.createHash('sha256').update(EJSON.stringify(schedule)).digest('hex');
+}
+
+/**
+ * Saves the pending post.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} pending the pending post, see `beginPendingPost()`
+ * @param {Object} store the storage that the state is kept in
+ */
+async function savePendingPost(prefix, pending, store = getStore()) {
+  await store.upload(`${prefix}/${PENDING_POST_FILENAME}`, JSON.stringify(pending));
+}
+
+/**
+ * Begins (or resumes) the post of the changes to the given schedule. The
+ * previous schedule is only replaced once the post is committed (see
+ * `commitPendingPost()`), so a run that fails or is cancelled before then
+ * detects the same changes again on the next run, which resumes the post:
+ * the snapshot that was already archived is reused, and the notifications
+ * that already went out (see `completePendingStep()`) are skipped.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Map} schedule the schedule that's being posted
+ * @param {Object} store the storage that the state is kept in
+ * @param {Date} now the current date
+ * @return {Object} `{scheduleHash, startedAt, attempts, archived, completed}`, where `archived` is what was archived (or null), and `completed` maps the steps to their results
+ */
+async function beginPendingPost(prefix, schedule, store = getStore(), now = new Date()) {
+  const scheduleHash = hashSchedule(schedule);
+  let pending = null;
+  const data = await store.download(`${prefix}/${PENDING_POST_FILENAME}`);
+  if (data) {
+    try {
+      pending = JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  if (pending && pending.scheduleHash === scheduleHash) {
+    pending.attempts++;
+  } else {
+    // Either nothing is pending, or the page changed again since, so the post starts over
+    pending = {scheduleHash, startedAt: now.toISOString(), attempts: 1, archived: null, completed: {}};
+  }
+  await savePendingPost(prefix, pending, store);
+  return pending;
+}
+
+/**
+ * Records that a step of the post (e.g. the `social` posts) went out, so
+ * that a resumed post skips it.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} pending the pending post, see `beginPendingPost()`
+ * @param {String} step the step, e.g. `social`
+ * @param {*} details what the step resulted in, e.g. the id of the tweet
+ * @param {Object} store the storage that the state is kept in
+ */
+async function completePendingStep(prefix, pending, step, details = true, store = getStore()) {
+  pending.completed[step] = details;
+  await savePendingPost(prefix, pending, store);
+}
+
+/**
+ * Determines how much longer the changes need to stay the same before
+ * they're posted. The pending post starts over whenever the page changes
+ * again, so its `startedAt` is when the page last changed.
+ *
+ * @param {Object} pending the pending post, see `beginPendingPost()`
+ * @param {Integer} debounceMinutes # of minutes that the changes need to stay the same
+ * @param {Date} now the current date
+ * @return {Integer} the # of minutes left, or 0 if the changes can be posted
+ */
+function getMinutesUntilSettled(pending, debounceMinutes, now = new Date()) {
+  const remaining = debounceMinutes * 60 * 1000 - (now - new Date(pending.startedAt));
+  return remaining > 0 ? Math.ceil(remaining / 60000) : 0;
+}
+
+/**
+ * Queues the post until a later run, e.g. outside of the posting window. The
+ * run doesn't count as an attempt at the post, so queueing never gives up
+ * on it.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} pending the pending post, see `beginPendingPost()`
+ * @param {Object} store the storage that the state is kept in
+ * @param {Date} now the current date
+ */
+async function queuePendingPost(prefix, pending, store = getStore(), now = new Date()) {
+  pending.attempts--;
+  pending.queuedAt = pending.queuedAt || now.toISOString();
+  await savePendingPost(prefix, pending, store);
+}
+
+/**
+ * Commits the post: replaces the previous schedule with the one that was
+ * posted, and clears the retry token.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Map} schedule the schedule that was posted
+ * @param {Object} store the storage that the state is kept in
+ */
+async function commitPendingPost(prefix, schedule, store = getStore()) {
+  await serializeSchedule(schedule, `${prefix}/previousSchedule.json`, store);
+  await store.delete(`${prefix}/${PENDING_POST_FILENAME}`);
+}
+
+module.exports = {
+  PENDING_POST_FILENAME,
+  beginPendingPost,
+  savePendingPost,
+  completePendingStep,
+  getMinutesUntilSettled,
+  queuePendingPost,
+  commitPendingPost,
+};
@@ -0,0 +1,266 @@
+/* eslint-disable max-len */
+const {EJSON} = require('bson');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {createLazyBrowser, createPageScraper} = require('./scrape');
+const {canonicalizeSchedule, deserializeSchedule} = require('./helper_functions');
+const {loadOverrides, applyOverrides} = require('./overrides');
+const {getDiffer} = require('./differ');
+const {createRunId} = require('./pipeline_events');
+const {recordRunResults} = require('./run_results');
+const {reportRunHealth} = require('./healthcheck');
+const {logger} = require('./logger');
+
+// The stages of the pipeline mode, in order: listing the teams, each team's stages, and reporting the results
+const STAGES = ['teams', 'scrape', 'diff', 'notify', 'report'];
+
+/**
+ * Scrapes the team's page, and stages what was scraped for the later stages
+ * (i.e. `diff` and `notify`), which can then run without Chrome.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {Function} getBrowser retrieves the puppeteer browser, see `createLazyBrowser()`
+ * @param {Object} store the storage that the state is kept in
+ * @param {AbortSignal} signal the signal that cancels the scrape
+ * @param {Function} createScraper creates the scraper for the team, see `createPageScraper()`
+ * @param {Date} now the current date
+ * @return {Object} `{team, runId, stagedKey}`, the input of the `diff` stage
+ */
+async function runScrapeStage(team, getBrowser, store = getStore(), signal = undefined, createScraper = createPageScraper, now = new Date()) {
+  const runId = createRunId();
+  const stagedKey = `${team.id}/pipeline/${runId}.json`;
+  const scraper = createScraper(team, getBrowser);
+  try {
+    const schedule = await scraper.scrape(team, signal);
+    await store.upload(stagedKey, EJSON.stringify({scrapedAt: now.toISOString(), schedule, content: scraper.content || null}));
+  } finally {
+    await scraper.close();
+  }
+  logger.info(`Staged the scrape of ${team.id} as ${stagedKey}`);
+  return {team: team.id, runId, stagedKey};
+}
+
+/**
+ * Loads what the `scrape` stage staged.
+ *
+ * @async
+ * @param {String} stagedKey the key of the staged scrape
+ * @param {Object} store the storage that the state is kept in
+ * @return {Object} `{scrapedAt, schedule, content}`
+ * @throws {Error} when the staged scrape is missing
+ */
+async function loadStagedScrape(stagedKey, store = getStore()) {
+  const data = await store.download(stagedKey);
+  if (!data) {
+    throw new Error(`The staged scrape ${stagedKey} is missing`);
+  }
+  const staged = EJSON.parse(data.toString());
+  return {...staged, schedule: new Map(Object.entries(staged.schedule))};
+}
+
+/**
+ * Stands in for the team's scraper in the later stages: the scrape returns
+ * the staged schedule, so the page isn't loaded again unless a screenshot
+ * is needed, in which case the page is loaded with the team's scraper.
+ *
+ * @class StagedScraper
+ * @typedef {StagedScraper}
+ */
+class StagedScraper {
+  /**
+   * Creates an instance of StagedScraper.
+   *
+   * @constructor
+   * @param {Object} staged the staged scrape, see `loadStagedScrape()`
+   * @param {Function} getBrowser retrieves the puppeteer browser, see `createLazyBrowser()`
+   * @param {Function} createScraper creates the scraper for the team, see `createPageScraper()`
+   */
+  constructor(staged, getBrowser, createScraper = createPageScraper) {
+    this.staged = staged;
+    this.getBrowser = getBrowser;
+    this.createScraper = createScraper;
+    this.content = staged.content;
+    this.scraper = null;
+  }
+
+  /**
+   * Returns the staged schedule.
+   *
+   * @async
+   * @return {Map} the schedule
+   */
+  async scrape() {
+    return new Map(this.staged.schedule);
+  }
+
+  /**
+   * Loads the page with the team's scraper, and takes the screenshot.
+   *
+   * @async
+   * @param {Object} team the team
+   * @param {AbortSignal} signal the signal that cancels the screenshot
+   * @param {Array} highlights the entries to highlight
+   * @return {Buffer} the screenshot
+   */
+  async screenshot(team, signal = undefined, highlights = []) {
+    if (!this.scraper) {
+      this.scraper = this.createScraper(team, this.getBrowser);
+      await this.scraper.scrape(team, signal); // the screenshot is taken of the loaded page
+    }
+    return await this.scraper.screenshot(team, signal, highlights);
+  }
+
+  /**
+   * Closes the team's scraper, if the page was loaded.
+   *
+   * @async
+   */
+  async close() {
+    if (this.scraper) {
+      await this.scraper.close();
+    }
+  }
+}
+
+/**
+ * Counts the changes of the staged scrape against the previous schedule,
+ * without saving anything, so that the pipeline only runs the `notify`
+ * stage when there's something to notify of.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {Object} staged the staged scrape, see `loadStagedScrape()`
+ * @param {Object} store the storage that the state is kept in
+ * @return {Integer} the # of added, deleted, and modified entries
+ */
+async function countStagedChanges(team, staged, store = getStore()) {
+  if (!await store.exists(`${team.id}/previousSchedule.json`)) {
+    return 0; // the first run only seeds the schedule
+  }
+  const schedule = canonicalizeSchedule(applyOverrides(staged.schedule, await loadOverrides(team.id, store)));
+  const scheduleDiff = getDiffer().diff(await deserializeSchedule(`${team.id}/previousSchedule.json`, store), schedule);
+  return scheduleDiff.added.size + scheduleDiff.deleted.size + scheduleDiff.modified.size;
+}
+
+/**
+ * Runs a stage of the pipeline mode, as invoked by the state machine (see
+ * `buildStateMachineDefinition()`):
+ * - `teams`: lists the configured teams
+ * - `scrape`: scrapes the team's page, see `runScrapeStage()`
+ * - `diff`: counts the changes; when there are none, it finishes the team,
+ *   returning its `result`, otherwise the `notify` stage does
+ * - `notify`: processes the team like a regular run, i.e. archiving and
+ *   posting the changes, but with the staged scrape
+ * - `report`: records the results, and reports the health of the run
+ *
+ * @async
+ * @param {String} stage the stage
+ * @param {Object} input the output of the previous stage
+ * @param {Function} processTeam processes the team, see `processTeam()` in `index.js`
+ * @param {Object} store the storage that the state is kept in
+ * @param {AbortSignal} signal the signal that cancels the stage
+ * @param {Object} browser the lazily launched browser, see `createLazyBrowser()`
+ * @param {Function} createScraper creates the scraper for the team, see `createPageScraper()`
+ * @return {Object} the input of the next stage
+ * @throws {Error} when the stage or the team is unknown
+ */
+async function runPipelineStage(stage, input, processTeam, store = getStore(), signal = undefined, browser = createLazyBrowser(), createScraper = createPageScraper) {
+  if (stage === 'teams') {
+    return {teams: config.teams.map((team) => team.id)};
+  }
+  if (stage === 'report') {
+    // The teams that failed for good only have their id
+    const results = (input.results || []).map((result) => ({url: (config.teams.find((team) => team.id === result.team) || {}).url, ...result}));
+    if (results.length) {
+      await recordRunResults(results, store);
+      await reportRunHealth(results, store);
+    }
+    return {results};
+  }
+  if (!STAGES.includes(stage)) {
+    throw new Error(`Unknown stage ${stage}`);
+  }
+  const team = config.teams.find((team) => team.id === input.team);
+  if (!team) {
+    throw new Error(`No configured team matches ${input.team}`);
+  }
+  try {
+    if (stage === 'scrape') {
+      return await runScrapeStage(team, browser.get, store, signal, createScraper);
+    }
+    const staged = await loadStagedScrape(input.stagedKey, store);
+    if (stage === 'diff') {
+      const changes = await countStagedChanges(team, staged, store);
+      if (changes) {
+        return {...input, changes};
+      }
+    }
+    const result = await processTeam(browser, store, team, signal, () => new StagedScraper(staged, browser.get, createScraper));
+    await store.delete(input.stagedKey);
+    return {...input, result};
+  } finally {
+    await browser.close();
+  }
+}
+
+/**
+ * Builds the Step Functions state machine (in the Amazon States Language)
+ * that runs the pipeline mode: the `scrape`, `diff`, and `notify` stages of
+ * each team, as separate invocations of the Lambda, followed by a `report`
+ * of the results. Each stage retries on its own, so a slow Chrome scrape
+ * can't time out the notifications, and a failed post doesn't scrape again.
+ *
+ * @param {String} functionArn the ARN of the Lambda
+ * @return {Object} the state machine definition
+ */
+function buildStateMachineDefinition(functionArn) {
+  // Each state invokes the Lambda with `{stage, input}`, where the input is the output of the previous state
+  const task = (stage, next, retry, catchTo = null) => ({
+    Type: 'Task',
+    Resource: 'arn:aws:states:::lambda:invoke',
+    Parameters: {'FunctionName': functionArn, 'Payload': {'stage': stage, 'input.$': '$'}},
+    OutputPath: '$.Payload',
+    Retry: [{ErrorEquals: ['States.ALL'], ...retry, BackoffRate: 2}],
+    ...(catchTo ? {Catch: [{ErrorEquals: ['States.ALL'], ResultPath: '$.error', Next: catchTo}]} : {}),
+    ...(next ? {Next: next} : {End: true}),
+  });
+  return {
+    Comment: 'Checks the teams\' schedules in stages',
+    StartAt: 'Teams',
+    States: {
+      Teams: task('teams', 'CheckTeams', {IntervalSeconds: 5, MaxAttempts: 1}),
+      CheckTeams: {
+        Type: 'Map',
+        ItemsPath: '$.teams',
+        ItemSelector: {'team.$': '$$.Map.Item.Value'},
+        ItemProcessor: {
+          StartAt: 'Scrape',
+          States: {
+            Scrape: task('scrape', 'Diff', {IntervalSeconds: 30, MaxAttempts: 2}, 'Failed'),
+            Diff: task('diff', 'Changed', {IntervalSeconds: 5, MaxAttempts: 2}, 'Failed'),
+            // The diff stage finishes the team itself when nothing changed
+            Changed: {Type: 'Choice', Choices: [{Variable: '$.result', IsPresent: true, Next: 'Done'}], Default: 'Notify'},
+            Notify: task('notify', 'Done', {IntervalSeconds: 60, MaxAttempts: 2}, 'Failed'),
+            // A team that fails for good is reported as failed, rather than failing the other teams' run
+            Failed: {Type: 'Pass', Parameters: {'result': {'team.$': '$.team', 'outcome': 'failed', 'changes': 0, 'postedId': null, 'error.$': '$.error.Cause', 'errorType.$': '$.error.Error'}}, Next: 'Done'},
+            Done: {Type: 'Pass', OutputPath: '$.result', End: true},
+          },
+        },
+        ResultPath: '$.results',
+        Next: 'Report',
+      },
+      Report: task('report', null, {IntervalSeconds: 5, MaxAttempts: 1}),
+    },
+  };
+}
+
+module.exports = {
+  STAGES,
+  runScrapeStage,
+  loadStagedScrape,
+  StagedScraper,
+  countStagedChanges,
+  runPipelineStage,
+  buildStateMachineDefinition,
+};
@@ -0,0 +1,153 @@
+/* eslint-disable max-len */
+const crypto = require('crypto');
+
+// The stages of processing a team, in order. `run` covers the whole run.
+const STAGES = ['scrape', 'parse', 'diff', 'screenshot', 'archive', 'notify', 'run'];
+
+/**
+ * Tracks the stages of a team's run, and logs one structured event per
+ * stage transition, with consistent field names (`url_id`, `run_id`,
+ * `stage`, `duration_ms`, and `outcome`), so that production runs can be
+ * queried in CloudWatch Logs Insights (with `LOG_FORMAT=json`) instead of
+ * grepped.
+ *
+ * @class StageTracker
+ * @typedef {StageTracker}
+ */
+class StageTracker {
+  /**
+   * Creates an instance of StageTracker.
+   *
+   * @constructor
+   * @param {Object} log the logger, see `lib/logger.js`
+   * @param {String} urlId the identifier of the page (i.e. team id)
+   * @param {String} runId the identifier of the run, see `createRunId()`
+   * @param {Function} now returns the current time in milliseconds
+   */
+  constructor(log, urlId, runId = createRunId(), now = Date.now) {
+    this.log = log;
+    this.urlId = urlId;
+    this.runId = runId;
+    this.now = now;
+    this.startedAt = now();
+    this.stage = null;
+    this.stageStartedAt = null;
+  }
+
+  /**
+   * Logs the event of a stage.
+   *
+   * @param {String} stage the stage, see `STAGES`
+   * @param {Integer} durationMs # of milliseconds that the stage took
+   * @param {String} outcome the outcome, e.g. `ok`, `failed`, or `cancelled` (or the run's outcome)
+   * @param {String} error the error that the stage failed with, if any
+   */
+  emit(stage, durationMs, outcome, error = null) {
+    const fields = {event: 'stage', url_id: this.urlId, run_id: this.runId, stage, duration_ms: durationMs, outcome};
+    if (error) {
+      fields.error_message = error;
+    }
+    this.log.log(outcome === 'failed' ? 'warn' : 'info', `Stage ${stage} ${outcome}`, fields);
+  }
+
+  /**
+   * Moves on to the next stage, ending the current one successfully.
+   *
+   * @param {String} stage the next stage, see `STAGES`
+   */
+  enter(stage) {
+    if (this.stage) {
+      this.emit(this.stage, this.now() - this.stageStartedAt, 'ok');
+    }
+    this.stage = stage;
+    this.stageStartedAt = this.now();
+  }
+
+  /**
+   * Ends the current stage and the run. When the run failed or was
+   * cancelled, the current stage is the one that failed.
+   *
+   * @param {String} outcome the outcome of the run, e.g. `changed`, `unchanged`, `failed`, or `cancelled`
+   * @param {String} error the error that the run failed with, if any
+   */
+  finish(outcome, error = null) {
+    const failed = outcome === 'failed' || outcome === 'cancelled';
+    if (this.stage) {
+      this.emit(this.stage, this.now() - this.stageStartedAt, failed ? outcome : 'ok', failed ? error : null);
+    }
+    this.stage = null;
+    this.emit('run', this.now() - this.startedAt, outcome, error);
+  }
+}
+
+/**
+ * Creates the identifier of a run, which is attached to all of its log lines.
+ *
+ * @return {String} the identifier
+ */
+function createRunId() {
+  return crypto.randomUUID();
+}
+
+/**
+ * The canned CloudWatch Logs Insights queries over the stage events. The
+ * `{runId}` placeholder is replaced with the run to trace.
+ */
+const INSIGHTS_QUERIES = {
+  'stage-durations': {
+    description: 'How long each stage takes, per team',
+    query: `filter event = "stage" and stage != "run"
+| stats count(*) as runs, avg(duration_ms) as avg_ms, pct(duration_ms, 95) as p95_ms, max(duration_ms) as max_ms by url_id, stage
+| sort url_id, p95_ms desc`,
+  },
+  'failures': {
+    description: 'The latest failed or cancelled stages, with their errors',
+    query: `filter event = "stage" and stage != "run" and outcome in ["failed", "cancelled"]
+| fields @timestamp, url_id, run_id, stage, outcome, error_message
+| sort @timestamp desc
+| limit 50`,
+  },
+  'run-outcomes': {
+    description: 'The outcomes of the runs per team, by day',
+    query: `filter event = "stage" and stage = "run"
+| stats count(*) as runs by url_id, outcome, bin(1d) as day
+| sort day desc, url_id`,
+  },
+  'slow-runs': {
+    description: 'The slowest runs, to trace with run-trace',
+    query: `filter event = "stage" and stage = "run"
+| fields @timestamp, url_id, run_id, duration_ms, outcome
+| sort duration_ms desc
+| limit 20`,
+  },
+  'run-trace': {
+    description: 'Every log line of a run, in order',
+    query: `filter run_id = "{runId}"
+| fields @timestamp, level, stage, msg, duration_ms, outcome
+| sort @timestamp asc`,
+  },
+};
+
+/**
+ * Formats the canned Logs Insights queries, ready to paste into the console
+ * or pass to `aws logs start-query`.
+ *
+ * @param {String} name the query to format, or undefined for all of them
+ * @param {String} runId the run to trace, for `run-trace`
+ * @return {String} the queries, or null if there's no query by the name
+ */
+function formatInsightsQueries(name = undefined, runId = '<run id>') {
+  const names = name ? [name] : Object.keys(INSIGHTS_QUERIES);
+  if (names.some((candidate) => !INSIGHTS_QUERIES[candidate])) {
+    return null;
+  }
+  return names.map((candidate) => `# ${candidate}: ${INSIGHTS_QUERIES[candidate].description}\n${INSIGHTS_QUERIES[candidate].query.replace('{runId}', runId)}`).join('\n\n');
+}
+
+module.exports = {
+  STAGES,
+  StageTracker,
+  createRunId,
+  INSIGHTS_QUERIES,
+  formatInsightsQueries,
+};
@@ -0,0 +1,353 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {logger} = require('./logger');
+
+/**
+ * The schema migrations, applied in order. Each migration is applied once,
+ * in a transaction, and recorded in `schema_migrations`. New migrations are
+ * appended; existing ones must never change.
+ */
+const MIGRATIONS = [
+  // 1: the objects (state and archive), keyed like the other stores
+  `CREATE TABLE objects (
+    key TEXT PRIMARY KEY,
+    contents BYTEA NOT NULL,
+    size INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+  );
+  CREATE INDEX objects_key_prefix ON objects (key text_pattern_ops);`,
+  // 2: every version of the state (e.g. `previousSchedule.json`), for restores and real queries
+  `CREATE TABLE changelog (
+    key TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    contents BYTEA NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (key, version)
+  );`,
+  // 3: who changed what, and when
+  `CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    key TEXT NOT NULL,
+    action TEXT NOT NULL,
+    version INTEGER,
+    actor TEXT,
+    at TIMESTAMPTZ NOT NULL DEFAULT now()
+  );
+  CREATE INDEX audit_log_key ON audit_log (key, at);`,
+];
+
+const pools = new Map(); // pools by connection string, shared by the stores
+
+/**
+ * Retrieves the connection pool, creating it on first use. The driver is
+ * optional, so that the default (S3) setup doesn't need it.
+ *
+ * @param {String} connectionString the PostgreSQL connection string
+ * @return {Object} the `pg` Pool
+ */
+function getPool(connectionString = config.postgres_url) {
+  if (!pools.has(connectionString)) {
+    let pg;
+    try {
+      pg = require('pg');
+    } catch (e) {
+      throw new Error('The PostgreSQL storage backend requires the pg package, i.e. `npm install pg`');
+    }
+    pools.set(connectionString, new pg.Pool({connectionString}));
+  }
+  return pools.get(connectionString);
+}
+
+/**
+ * Runs the function in a transaction, rolling back if it throws.
+ *
+ * @async
+ * @param {Object} pool the `pg` Pool
+ * @param {Function} fn called with the client, within the transaction
+ * @return {*} the result of the function
+ */
+async function transaction(pool, fn) {
+  const client = await pool.connect();
+  try {
+    await client.query('BEGIN');
+    const result = await fn(client);
+    await client.query('COMMIT');
+    return result;
+  } catch (e) {
+    await client.query('ROLLBACK');
+    throw e;
+  } finally {
+    client.release();
+  }
+}
+
+/**
+ * Applies the migrations that haven't been applied yet. An advisory lock
+ * keeps concurrent processes from migrating at the same time.
+ *
+ * @async
+ * @param {Object} pool the `pg` Pool
+ * @param {Array} migrations the migrations
+ * @return {Integer} the # of migrations that were applied
+ */
+async function migrate(pool, migrations = MIGRATIONS) {
+  return await transaction(pool, async (client) => {
+    await client.query('SELECT pg_advisory_xact_lock(7240731)');
+    await client.query('CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())');
+    const result = await client.query('SELECT version FROM schema_migrations');
+    const applied = new Set(result.rows.map((row) => row.version));
+    let count = 0;
+    for (let i = 0; i < migrations.length; i++) {
+      if (applied.has(i + 1)) {
+        continue;
+      }
+      await client.query(migrations[i]);
+      await client.query('INSERT INTO schema_migrations (version) VALUES ($1)', [i + 1]);
+      count++;
+    }
+    return count;
+  });
+}
+
+/**
+ * Storage that keeps the state and archive in PostgreSQL, for hosted
+ * deployments with many teams that need transactional consistency and real
+ * queries. Every write of a key is recorded in the changelog (which backs
+ * `listVersions()`, like a versioned S3 bucket) and the audit log, in the
+ * same transaction.
+ *
+ * Like DynamoStore, writes are conditional on the version that was last
+ * read, so that overlapping runs for the same team can't clobber each
+ * other's state.
+ *
+ * @class PostgresStore
+ * @typedef {PostgresStore}
+ */
+class PostgresStore {
+  /**
+   * Creates an instance of PostgresStore. The migrations are applied before
+   * the first query.
+   *
+   * @constructor
+   * @param {Object} pool the `pg` Pool
+   * @param {String} actor who the writes are attributed to in the audit log
+   */
+  constructor(pool = getPool(), actor = config.postgres_actor) {
+    this.pool = pool;
+    this.actor = actor;
+    this.versions = new Map(); // versions of the keys that were read, used for the conditional writes
+    this.migrated = null;
+  }
+
+  /**
+   * Applies the migrations, once.
+   *
+   * @async
+   */
+  async ready() {
+    if (!this.migrated) {
+      this.migrated = migrate(this.pool).catch((e) => {
+        this.migrated = null; // retry on the next query
+        throw e;
+      });
+    }
+    await this.migrated;
+  }
+
+  /**
+   * Runs the query, once the migrations are applied.
+   *
+   * @async
+   * @param {String} text the SQL
+   * @param {Array} values the parameters
+   * @return {Object} the result
+   */
+  async query(text, values = []) {
+    await this.ready();
+    return await this.pool.query(text, values);
+  }
+
+  /**
+   * Uploads the contents to the given key. Writes are conditional on the
+   * version that was last read, and fail when another run wrote in between.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to upload to
+   * @param {*} contents the contents of the file
+   * @return {Boolean} true if the upload succeeded
+   */
+  async upload(key, contents) {
+    const buffer = Buffer.from(contents);
+    try {
+      await this.ready();
+      const version = await transaction(this.pool, async (client) => {
+        let result;
+        if (!this.versions.has(key)) {
+          // Never read, so there's nothing to be conditional on
+          result = await client.query('INSERT INTO objects (key, contents, size, version) VALUES ($1, $2, $3, 1) ON CONFLICT (key) DO UPDATE SET contents = EXCLUDED.contents, size = EXCLUDED.size, version = objects.version + 1, updated_at = now() RETURNING version', [key, buffer, buffer.length]);
+        } else if (this.versions.get(key) === 0) {
+          result = await client.query('INSERT INTO objects (key, contents, size, version) VALUES ($1, $2, $3, 1) ON CONFLICT (key) DO NOTHING RETURNING version', [key, buffer, buffer.length]);
+        } else {
+          result = await client.query('UPDATE objects SET contents = $2, size = $3, version = version + 1, updated_at = now() WHERE key = $1 AND version = $4 RETURNING version', [key, buffer, buffer.length, this.versions.get(key)]);
+        }
+        if (!result.rows.length) {
+          return null;
+        }
+        const newVersion = result.rows[0].version;
+        await client.query('INSERT INTO changelog (key, version, contents) VALUES ($1, $2, $3)', [key, newVersion, buffer]);
+        await client.query('INSERT INTO audit_log (key, action, version, actor) VALUES ($1, $2, $3, $4)', [key, 'upload', newVersion, this.actor]);
+        return newVersion;
+      });
+      if (version === null) {
+        logger.warn(`Concurrent write detected for ${key}, skipping the write`);
+        return false;
+      }
+      this.versions.set(key, version);
+    } catch (e) {
+      logger.error(e);
+      return false;
+    }
+    return true;
+  }
+
+  /**
+   * Downloads the contents of the given key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to download
+   * @return {Buffer} the contents, or null if the key doesn't exist
+   */
+  async download(key) {
+    try {
+      const result = await this.query('SELECT contents, version FROM objects WHERE key = $1', [key]);
+      if (!result.rows.length) {
+        this.versions.set(key, 0);
+        return null;
+      }
+      this.versions.set(key, result.rows[0].version);
+      return Buffer.from(result.rows[0].contents);
+    } catch (e) {
+      logger.error(e);
+    }
+    return null;
+  }
+
+  /**
+   * Checks whether the given key exists.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to check
+   * @return {Boolean} true if the key exists
+   */
+  async exists(key) {
+    try {
+      return (await this.query('SELECT 1 FROM objects WHERE key = $1', [key])).rows.length > 0;
+    } catch (e) {
+      logger.error(e);
+    }
+    return false;
+  }
+
+  /**
+   * Uploads the contents to the given key, unless the key already exists.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to create
+   * @param {*} contents the contents of the file
+   * @return {Boolean} true if the key was created, false if it already exists
+   */
+  async create(key, contents) {
+    this.versions.set(key, 0); // conditional on the key not existing
+    return await this.upload(key, contents);
+  }
+
+  /**
+   * Deletes the given key. Its changelog is kept.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to delete
+   * @return {Boolean} true if the key was deleted
+   */
+  async delete(key) {
+    try {
+      await this.ready();
+      const deleted = await transaction(this.pool, async (client) => {
+        const result = await client.query('DELETE FROM objects WHERE key = $1 RETURNING version', [key]);
+        if (!result.rows.length) {
+          return false;
+        }
+        await client.query('INSERT INTO audit_log (key, action, version, actor) VALUES ($1, $2, $3, $4)', [key, 'delete', result.rows[0].version, this.actor]);
+        return true;
+      });
+      this.versions.delete(key);
+      return deleted;
+    } catch (e) {
+      logger.error(e);
+    }
+    return false;
+  }
+
+  /**
+   * Lists all of the keys that start with the prefix.
+   *
+   * @async
+   * @param {String} prefix the prefix of the keys to list
+   * @return {Array} list of objects with `key`, `lastModified`, and `size`
+   */
+  async list(prefix = '') {
+    try {
+      const pattern = `${prefix.replace(/[\\%_]/g, (c) => `\\${c}`)}%`;
+      const result = await this.query('SELECT key, updated_at, size FROM objects WHERE key LIKE $1 ORDER BY key', [pattern]);
+      return result.rows.map((row) => ({key: row.key, lastModified: new Date(row.updated_at), size: row.size}));
+    } catch (e) {
+      logger.error(e);
+    }
+    return [];
+  }
+
+  /**
+   * Lists all of the versions of the key, from the changelog.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename)
+   * @return {Array} list of objects with `versionId` and `lastModified`, newest first
+   */
+  async listVersions(key) {
+    try {
+      const result = await this.query('SELECT version, changed_at FROM changelog WHERE key = $1 ORDER BY version DESC', [key]);
+      return result.rows.map((row) => ({versionId: `${row.version}`, lastModified: new Date(row.changed_at)}));
+    } catch (e) {
+      logger.error(e);
+    }
+    return [];
+  }
+
+  /**
+   * Downloads the contents of a specific version of the key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to download
+   * @param {String} versionId the version to download
+   * @return {Buffer} the contents, or null if the version can't be retrieved
+   */
+  async downloadVersion(key, versionId) {
+    try {
+      const result = await this.query('SELECT contents FROM changelog WHERE key = $1 AND version = $2', [key, parseInt(versionId)]);
+      if (result.rows.length) {
+        return Buffer.from(result.rows[0].contents);
+      }
+    } catch (e) {
+      logger.error(e);
+    }
+    return null;
+  }
+}
+
+module.exports = {
+  MIGRATIONS,
+  getPool,
+  transaction,
+  migrate,
+  PostgresStore,
+};
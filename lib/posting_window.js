@@ -0,0 +1,64 @@
+/* eslint-disable max-len */
+const moment = require('moment-timezone');
+const config = require('../config');
+const {logger} = require('./logger');
+
+/**
+ * Parses a posting window, e.g. `07:00-22:00`. A window whose end is before
+ * its start spans midnight, e.g. `18:00-02:00`.
+ *
+ * @param {String} value the posting window
+ * @return {Object} `{start, end}`, in minutes since midnight, or null if the value isn't a window
+ */
+function parsePostingWindow(value) {
+  const match = (value || '').match(/^\s*(\d{1,2}):(\d{2})\s*-\s*(\d{1,2}):(\d{2})\s*$/);
+  if (!match) {
+    return null;
+  }
+  const [startHours, startMinutes, endHours, endMinutes] = match.slice(1).map((part) => parseInt(part));
+  if (startHours > 24 || endHours > 24 || startMinutes > 59 || endMinutes > 59) {
+    return null;
+  }
+  return {start: startHours * 60 + startMinutes, end: endHours * 60 + endMinutes};
+}
+
+/**
+ * Retrieves the team's posting window: its own `postingWindow`, or else the
+ * `POSTING_WINDOW`.
+ *
+ * @param {Object} team the team
+ * @return {Object} `{start, end}`, see `parsePostingWindow()`, or null to post any time
+ */
+function getPostingWindow(team) {
+  const value = team.postingWindow ?? config.posting_window;
+  if (!value) {
+    return null;
+  }
+  const window = parsePostingWindow(value);
+  if (!window) {
+    logger.warn(`Ignoring the invalid posting window "${value}" of ${team.id}, expected e.g. 07:00-22:00`);
+  }
+  return window;
+}
+
+/**
+ * Determines the # of minutes until the posting window opens, in the
+ * `DISPLAY_TIME_ZONE`.
+ *
+ * @param {Object} window the posting window, see `parsePostingWindow()`
+ * @param {Date} now the current date
+ * @param {String} timeZone the time zone of the window
+ * @return {Integer} the # of minutes until the window opens, or 0 if it's open
+ */
+function getMinutesUntilPostingWindow(window, now = new Date(), timeZone = config.display_time_zone) {
+  const local = moment(now).tz(timeZone);
+  const minutes = local.hours() * 60 + local.minutes();
+  const open = window.start <= window.end ? minutes >= window.start && minutes < window.end : minutes >= window.start || minutes < window.end;
+  return open ? 0 : (window.start - minutes + 24 * 60) % (24 * 60);
+}
+
+module.exports = {
+  parsePostingWindow,
+  getPostingWindow,
+  getMinutesUntilPostingWindow,
+};
@@ -0,0 +1,97 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getEntryDate} = require('./helper_functions');
+const {getDiffer} = require('./differ');
+const {escapeHtml} = require('./image');
+const {formatTimestamp} = require('./format');
+
+/**
+ * Lines up the entries of the previous and the new schedule, one row per
+ * key, in the order of their dates.
+ *
+ * @param {Map} schedule the new schedule
+ * @param {Object} scheduleDiff the differences, with the `previousSchedule`
+ * @return {Array} list of `{key, before, after, change}`, where the change is `added`, `deleted`, `modified`, or null
+ */
+function buildSideBySideRows(schedule, scheduleDiff) {
+  const previousSchedule = scheduleDiff.previousSchedule || new Map();
+  const keys = [...new Set([...previousSchedule.keys(), ...schedule.keys()])];
+  const rows = keys.map((key) => {
+    const change = ['added', 'deleted', 'modified'].find((type) => scheduleDiff[type].has(key)) || null;
+    return {key, before: previousSchedule.get(key) || null, after: schedule.get(key) || null, change};
+  });
+  const date = (row) => getEntryDate((row.after || row.before).dayOfMonth) || 0;
+  return rows.sort((a, b) => date(a) - date(b));
+}
+
+/**
+ * Builds the self-contained HTML report of the changes, i.e. what would be
+ * (or was) posted: the summary, the screenshot, and the previous and the
+ * new schedule side by side, with the changes highlighted. Used by the
+ * `preview` command (with the screenshot embedded) and the `email` channel
+ * (with the screenshot attached inline). The title is underlined in the
+ * team's `color`.
+ *
+ * @param {Object} team the team
+ * @param {Map} schedule the new schedule
+ * @param {Object} scheduleDiff the differences, with the `previousSchedule`
+ * @param {String} imageSrc the `src` of the screenshot, e.g. a `data:` URL or a `cid:` reference, or null to leave it out
+ * @param {Date} now the time the report is built
+ * @param {String} timeZone the time zone that the dates are displayed in
+ * @return {String} the HTML page
+ */
+function buildPreviewHtml(team, schedule, scheduleDiff, imageSrc = null, now = new Date(), timeZone = config.display_time_zone) {
+  const title = `${team.name || team.id} schedule changes`;
+  const cells = (entry) => entry ? `<td>${escapeHtml(entry.location || '')}</td><td class="time">${escapeHtml(entry.timeBlock || '')}</td>` : '<td></td><td class="time"></td>';
+  const tableRows = buildSideBySideRows(schedule, scheduleDiff).map(({before, after, change}) => {
+    const entry = after || before;
+    return `      <tr${change ? ` class="${change}"` : ''}><td class="day">${escapeHtml(`${entry.dayOfWeek} ${entry.dayOfMonth}`)}</td>${cells(before)}${cells(after)}</tr>`;
+  });
+  return `<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1" />
+    <title>${escapeHtml(title)}</title>
+    <style>
+      body { font-family: Helvetica, Arial, sans-serif; max-width: 960px; margin: 20px auto; padding: 0 12px; }
+      h1 { border-bottom: 4px solid ${escapeHtml(team.color || config.brand_primary_color)}; padding-bottom: 6px; }
+      table { width: 100%; border-collapse: collapse; font-size: 14px; margin: 12px 0; }
+      th, td { padding: 6px 8px; border-bottom: 1px solid #e0e0e0; vertical-align: top; text-align: left; }
+      .day { font-weight: bold; white-space: nowrap; }
+      .time { white-space: nowrap; text-align: right; }
+      .added { background: #e6ffed; }
+      .deleted { background: #ffeef0; text-decoration: line-through; }
+      .modified { background: #fff5b1; }
+      img { max-width: 100%; border: 1px solid #e0e0e0; }
+      footer { color: #999999; font-size: 12px; }
+    </style>
+  </head>
+  <body>
+    <h1>${escapeHtml(title)}</h1>
+    <p>${escapeHtml(getDiffer().summarize(scheduleDiff))}, from <a href="${escapeHtml(team.url)}">${escapeHtml(team.url)}</a>.</p>${imageSrc ? `\n    <img src="${escapeHtml(imageSrc)}" alt="Screenshot of the schedule page" />` : ''}
+    <table>
+      <tr><th>Day</th><th colspan="2">Before</th><th colspan="2">After</th></tr>
+${tableRows.length ? tableRows.join('\n') : '      <tr><td colspan="5">Nothing scheduled</td></tr>'}
+    </table>
+    <footer>Generated ${escapeHtml(formatTimestamp(now, timeZone))}</footer>
+  </body>
+</html>`;
+}
+
+/**
+ * Embeds the screenshot as a `data:` URL, so that the report is a single
+ * file.
+ *
+ * @param {Buffer} screenshot the PNG screenshot
+ * @return {String} the `data:` URL
+ */
+function toDataUrl(screenshot) {
+  return `data:image/png;base64,${Buffer.from(screenshot).toString('base64')}`;
+}
+
+module.exports = {
+  buildSideBySideRows,
+  buildPreviewHtml,
+  toDataUrl,
+};
@@ -0,0 +1,137 @@
+/* eslint-disable max-len */
+const moment = require('moment-timezone');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {serializeSchedule, deserializeSchedule, canonicalizeSchedule, summarizeChanges} = require('./helper_functions');
+const {getDiffer} = require('./differ');
+const {logger} = require('./logger');
+
+/**
+ * Loads the team's run state, i.e. when the last run completed and when the
+ * last notification was posted.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ * @return {Object} Object with `lastRunAt` and `lastPostedAt` (ISO timestamps, or null)
+ */
+async function loadRunState(prefix, store = getStore()) {
+  const state = {lastRunAt: null, lastPostedAt: null};
+  try {
+    const data = await store.download(`${prefix}/runState.json`);
+    if (data) {
+      Object.assign(state, JSON.parse(data));
+    }
+  } catch (e) {
+    logger.error(e);
+  }
+  return state;
+}
+
+/**
+ * Saves the team's run state.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} state the run state, as returned by `loadRunState()`
+ * @param {Object} store the storage that the state is kept in
+ */
+async function saveRunState(prefix, state, store = getStore()) {
+  await store.upload(`${prefix}/runState.json`, JSON.stringify(state));
+}
+
+/**
+ * Records that a run completed, i.e. the schedule was scraped and compared.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ * @param {Date} now the current date
+ */
+async function recordRun(prefix, store = getStore(), now = new Date()) {
+  const state = await loadRunState(prefix, store);
+  state.lastRunAt = now.toISOString();
+  await saveRunState(prefix, state, store);
+}
+
+/**
+ * Records that a notification was posted, keeping the schedule as of the
+ * post so that a catch-up after an outage can be compared against it.
+ *
+ * @async
+ * @param {Map} schedule the schedule that the notification was posted for
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ * @param {Date} now the current date
+ */
+async function recordPost(schedule, prefix, store = getStore(), now = new Date()) {
+  await serializeSchedule(schedule, `${prefix}/lastPostedSchedule.json`, store);
+  const state = await loadRunState(prefix, store);
+  state.lastPostedAt = now.toISOString();
+  await saveRunState(prefix, state, store);
+}
+
+/**
+ * Determines whether there was an outage, i.e. the last completed run was
+ * longer ago than the threshold.
+ *
+ * @param {Object} state the run state, as returned by `loadRunState()`
+ * @param {Date} now the current date
+ * @param {Integer} thresholdSeconds # of seconds without a completed run that count as an outage
+ * @return {Boolean} true if there was an outage
+ */
+function detectOutage(state, now = new Date(), thresholdSeconds = config.outageThreshold) {
+  if (!state.lastRunAt) {
+    return false; // never ran before, so there's nothing to catch up on
+  }
+  return now.getTime() - new Date(state.lastRunAt).getTime() > thresholdSeconds * 1000;
+}
+
+/**
+ * Compares the schedule against the schedule as of the last post, so that
+ * everything that changed during an outage is reported at once, rather than
+ * only the changes since the last (possibly stale) run.
+ *
+ * @async
+ * @param {Map} schedule the schedule that was just scraped
+ * @param {Object} state the run state, as returned by `loadRunState()`
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ * @param {Object} differ the differ that compares the schedules
+ * @return {Object} the output of the differ along with the `previousSchedule`
+ * and `catchUpSince`, or null if nothing was posted before
+ */
+async function getCatchUpDiff(schedule, state, prefix, store = getStore(), differ = getDiffer()) {
+  const filepath = `${prefix}/lastPostedSchedule.json`;
+  if (!state.lastPostedAt || !await store.exists(filepath)) {
+    return null;
+  }
+  const lastPostedSchedule = await deserializeSchedule(filepath, store);
+  const scheduleDiff = differ.diff(lastPostedSchedule, canonicalizeSchedule(schedule));
+  scheduleDiff.previousSchedule = lastPostedSchedule;
+  scheduleDiff.catchUpSince = state.lastPostedAt;
+  return scheduleDiff;
+}
+
+/**
+ * Generates the summary for a catch-up notification, e.g.
+ * `Catch-up: 2 added, 1 modified since Friday, October 6th, 12:00 pm`.
+ *
+ * @param {Object} scheduleDiff the output of `getCatchUpDiff()`
+ * @param {String} summary the summary of the changes themselves
+ * @return {String} the summary of the changes
+ */
+function summarizeCatchUp(scheduleDiff, summary = summarizeChanges(scheduleDiff)) {
+  const since = moment(scheduleDiff.catchUpSince).tz(config.display_time_zone).format('dddd, MMMM Do, h:mm a');
+  return `Catch-up: ${summary} since ${since}`;
+}
+
+module.exports = {
+  loadRunState,
+  saveRunState,
+  recordRun,
+  recordPost,
+  detectOutage,
+  getCatchUpDiff,
+  summarizeCatchUp,
+};
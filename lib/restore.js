@@ -0,0 +1,61 @@
+/* eslint-disable max-len */
+const {getStore} = require('./storage');
+const {listScheduleSnapshots} = require('./timeline');
+
+/**
+ * Finds the latest version that was written at or before the given time.
+ *
+ * @param {Array} versions list of objects with `lastModified`
+ * @param {Date} at the point in time to restore to
+ * @return {Object} the version, or null if there is none
+ */
+function findVersionAt(versions, at) {
+  let found = null;
+  for (const version of versions) {
+    const timestamp = new Date(version.lastModified);
+    if (timestamp <= at && (!found || timestamp > new Date(found.lastModified))) {
+      found = version;
+    }
+  }
+  return found;
+}
+
+/**
+ * Restores the team's `previousSchedule.json` to how it was at the given
+ * time, so that a bad parse can be rolled back. When the storage supports
+ * versions (i.e. S3 with versioning enabled), the previous version of the
+ * file is restored. Otherwise, the archived schedule snapshot is restored.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {Date} at the point in time to restore to
+ * @param {Object} store the storage that the state is kept in
+ * @return {Object} Object with the `source` (`version` or `archive`), the `id` of what was restored, and its `timestamp`, or null if nothing could be restored
+ */
+async function restorePreviousSchedule(prefix, at, store = getStore()) {
+  const filepath = `${prefix}/previousSchedule.json`;
+  if (typeof store.listVersions === 'function') {
+    const version = findVersionAt(await store.listVersions(filepath), at);
+    if (version) {
+      const contents = await store.downloadVersion(filepath, version.versionId);
+      if (contents && await store.upload(filepath, contents)) {
+        return {source: 'version', id: version.versionId, timestamp: new Date(version.lastModified)};
+      }
+    }
+  }
+
+  const snapshots = await listScheduleSnapshots(prefix, store);
+  const snapshot = findVersionAt(snapshots.map((snapshot) => ({...snapshot, lastModified: snapshot.timestamp})), at);
+  if (snapshot) {
+    const contents = await store.download(snapshot.key);
+    if (contents && await store.upload(filepath, contents)) {
+      return {source: 'archive', id: snapshot.key, timestamp: snapshot.timestamp};
+    }
+  }
+  return null;
+}
+
+module.exports = {
+  findVersionAt,
+  restorePreviousSchedule,
+};
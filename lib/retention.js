@@ -0,0 +1,91 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+
+const DAY_MS = 24 * 60 * 60 * 1000;
+
+/**
+ * Groups the archived files into versions, i.e. the schedule, screenshot
+ * (or pointer), and preview that were archived together, by their timestamp.
+ *
+ * @param {Array} files the archived files, see `store.list()`
+ * @return {Array} list of `{timestamp, keys}`, newest first
+ */
+function groupArchiveVersions(files) {
+  const versions = new Map();
+  for (const file of files) {
+    const match = file.key.match(/-(\d{10,})\.[\w.]+$/);
+    if (!match) {
+      continue;
+    }
+    if (!versions.has(match[1])) {
+      versions.set(match[1], {timestamp: new Date(parseInt(match[1])), keys: []});
+    }
+    versions.get(match[1]).keys.push(file.key);
+  }
+  return [...versions.values()].sort((a, b) => b.timestamp - a.timestamp);
+}
+
+/**
+ * Determines which archive versions are pruned: those older than the max
+ * age, and those beyond the newest N. The newest version is always kept.
+ *
+ * @param {Array} versions the versions, newest first, see `groupArchiveVersions()`
+ * @param {Date} now the current date
+ * @param {Integer} maxAgeDays # of days to keep the versions for, or null to keep them regardless of age
+ * @param {Integer} maxVersions # of versions to keep, or null to keep them regardless of count
+ * @return {Array} the versions to prune
+ */
+function selectVersionsToPrune(versions, now = new Date(), maxAgeDays = null, maxVersions = null) {
+  return versions.filter((version, index) => index > 0 && (
+    (maxAgeDays !== null && now - version.timestamp > maxAgeDays * DAY_MS) ||
+    (maxVersions !== null && index >= maxVersions)
+  ));
+}
+
+/**
+ * Prunes the team's archive (`<prefix>/archive/`) according to the
+ * retention policy. The screenshots that the pointers of the kept versions
+ * refer to (see `lib/screenshot_archive.js`) are kept, so that the history
+ * stays complete.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the archive is kept in
+ * @param {Date} now the current date
+ * @param {Integer} maxAgeDays # of days to keep the versions for, or null to keep them regardless of age
+ * @param {Integer} maxVersions # of versions to keep, or null to keep them regardless of count
+ * @param {Boolean} dryRun whether to only determine what would be pruned
+ * @return {Object} Object with the # of `versions`, and the `pruned` keys
+ */
+async function pruneArchive(prefix, store = getStore(), now = new Date(), maxAgeDays = config.archive_max_age_days, maxVersions = config.archive_max_versions, dryRun = false) {
+  const versions = groupArchiveVersions(await store.list(`${prefix}/archive/`));
+  const pruned = selectVersionsToPrune(versions, now, maxAgeDays, maxVersions);
+  if (!pruned.length) {
+    return {versions: versions.length, pruned: []};
+  }
+  const referenced = new Set();
+  for (const version of versions.filter((candidate) => !pruned.includes(candidate))) {
+    for (const key of version.keys.filter((candidate) => candidate.endsWith('.pointer'))) {
+      try {
+        referenced.add(JSON.parse(await store.download(key)).target);
+      } catch (e) {
+        logger.error(e);
+      }
+    }
+  }
+  const keys = pruned.flatMap((version) => version.keys).filter((key) => !referenced.has(key));
+  if (!dryRun) {
+    for (const key of keys) {
+      await store.delete(key);
+    }
+  }
+  return {versions: versions.length, pruned: keys};
+}
+
+module.exports = {
+  groupArchiveVersions,
+  selectVersionsToPrune,
+  pruneArchive,
+};
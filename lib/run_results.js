@@ -0,0 +1,90 @@
+/* eslint-disable max-len */
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+
+const COLUMNS = [
+  {title: 'URL', value: (result) => result.url || result.team},
+  {title: 'Outcome', value: (result) => result.outcome},
+  {title: 'Changes', value: (result) => `${result.changes}`},
+  {title: 'Posted ID', value: (result) => result.postedId || '-'},
+  {title: 'Error', value: (result) => result.error ? `${result.error}${result.errorType ? ` (${result.errorType})` : ''}` : '-'},
+];
+
+/**
+ * Formats the per-team results of a run as a plain text table, so that the
+ * output of a cron run (i.e. `--once`) shows what happened to every URL.
+ *
+ * @param {Array} results list of `{team, url, outcome, changes, postedId, error, errorType}`, see `processTeam()`
+ * @return {String} the table, one row per result after the header
+ */
+function formatRunResultsTable(results) {
+  const rows = [COLUMNS.map((column) => column.title), ...results.map((result) => COLUMNS.map((column) => column.value(result)))];
+  const widths = COLUMNS.map((column, i) => Math.max(...rows.map((row) => row[i].length)));
+  return rows.map((row) => row.map((cell, i) => i === row.length - 1 ? cell : cell.padEnd(widths[i])).join('  ')).join('\n');
+}
+
+/**
+ * Appends the results of a run to the day's summary artifact
+ * (`run-results/YYYY-MM-DD.json`), alongside the per-team run summaries.
+ *
+ * @async
+ * @param {Array} results the per-team results, see `formatRunResultsTable()`
+ * @param {Object} store the storage to keep the artifact in
+ * @param {Date} now the time the run finished
+ * @return {Array} the runs recorded for the day, oldest first
+ */
+async function recordRunResults(results, store = getStore(), now = new Date()) {
+  const filepath = `run-results/${now.toISOString().slice(0, 10)}.json`;
+  let runs = [];
+  const data = await store.download(filepath);
+  if (data) {
+    try {
+      runs = JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  runs.push({finishedAt: now.toISOString(), results});
+  await store.upload(filepath, JSON.stringify(runs));
+  return runs;
+}
+
+/**
+ * Loads the results of the last recorded run.
+ *
+ * @async
+ * @param {Object} store the storage that the artifacts are kept in
+ * @return {Object} `{finishedAt, results}`, or null if no run was recorded
+ */
+async function loadLastRunResults(store = getStore()) {
+  const files = (await store.list('run-results/')).sort((a, b) => a.key.localeCompare(b.key));
+  for (const file of files.reverse()) {
+    const data = await store.download(file.key);
+    try {
+      const runs = JSON.parse(data);
+      if (runs.length) {
+        return runs[runs.length - 1];
+      }
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  return null;
+}
+
+/**
+ * Whether any of the teams in the run failed or were cancelled.
+ *
+ * @param {Array} results the per-team results, see `formatRunResultsTable()`
+ * @return {Boolean} true if a team didn't finish its check
+ */
+function hasFailedResults(results) {
+  return results.some((result) => result.outcome === 'failed' || result.outcome === 'cancelled');
+}
+
+module.exports = {
+  formatRunResultsTable,
+  recordRunResults,
+  loadLastRunResults,
+  hasFailedResults,
+};
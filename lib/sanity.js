@@ -0,0 +1,58 @@
+/* eslint-disable max-len */
+const config = require('../config');
+
+/**
+ * Thrown when the scraped schedule fails the sanity checks, i.e. when it's
+ * more likely a broken scrape or parse than a real change.
+ *
+ * @class ScheduleSanityError
+ * @typedef {ScheduleSanityError}
+ * @extends {Error}
+ */
+class ScheduleSanityError extends Error {
+  /**
+   * Creates an instance of ScheduleSanityError.
+   *
+   * @constructor
+   * @param {String} message the reason that the schedule failed the checks
+   */
+  constructor(message) {
+    super(message);
+    this.name = 'ScheduleSanityError';
+  }
+}
+
+/**
+ * Checks the scraped schedule against the previous one before anything is
+ * posted or overwritten: a schedule that parsed to no entries, or that lost
+ * more than the given share of its entries at once, is far more likely a
+ * broken scrape (or a layout change that the parser missed) than a cleared
+ * page. Schedules smaller than the minimum aren't checked, since a few
+ * entries legitimately vanish as the days pass.
+ *
+ * @param {Map} schedule the scraped schedule
+ * @param {Object} scheduleDiff the output of a differ, along with the `previousSchedule`
+ * @param {Integer} minEntries the min # of entries of the previous schedule to check it
+ * @param {Number} maxVanishedPercent the max % of the previous entries that may vanish, or null to allow any
+ * @param {Boolean} checkEmpty whether a schedule with no entries fails the checks
+ * @return {String} the reason that the schedule failed the checks, or null if it passed
+ */
+function checkScheduleSanity(schedule, scheduleDiff, minEntries = config.sanity_min_entries, maxVanishedPercent = config.sanity_max_vanished_percent, checkEmpty = config.empty_schedule_check) {
+  const previousSize = scheduleDiff.previousSchedule ? scheduleDiff.previousSchedule.size : 0;
+  if (!previousSize || previousSize < minEntries) {
+    return null;
+  }
+  if (!schedule.size) {
+    return checkEmpty ? `The page parsed to no entries, while the previous schedule had ${previousSize}` : null;
+  }
+  const vanishedPercent = scheduleDiff.deleted.size / previousSize * 100;
+  if (maxVanishedPercent !== null && vanishedPercent > maxVanishedPercent) {
+    return `${scheduleDiff.deleted.size} of the ${previousSize} entries (${Math.round(vanishedPercent)}%) vanished at once, more than the ${maxVanishedPercent}% allowed`;
+  }
+  return null;
+}
+
+module.exports = {
+  ScheduleSanityError,
+  checkScheduleSanity,
+};
@@ -0,0 +1,126 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {getScheduledDate} = require('./helper_functions');
+const {uploadWebsiteFileToS3} = require('./aws');
+const {logger} = require('./logger');
+
+// Bumped whenever a field of `latest.json` is renamed or removed, so that the apps can tell
+const SCHEMA_VERSION = 1;
+
+// Keeps the last change, since most runs publish without one
+const LAST_CHANGE_FILENAME = 'lastChange.json';
+
+/**
+ * Uploads the `latest.json` of a team to the `SCHEDULE_API_BUCKET`.
+ *
+ * @async
+ * @param {String} key the key of the file, including the `SCHEDULE_API_PREFIX`
+ * @param {String} contents the JSON
+ * @return {Boolean} true if the upload succeeded
+ */
+async function uploadApiFile(key, contents) {
+  return (await uploadWebsiteFileToS3(contents, key, 'application/json; charset=utf-8', config.schedule_api_bucket)) !== null;
+}
+
+/**
+ * Formats the (local) date of the entry, e.g. `2023-10-07`.
+ *
+ * @param {Object} entry the schedule entry
+ * @param {Date} now the current date
+ * @return {String} the date, or null if it can't be determined
+ */
+function formatEntryDate(entry, now = new Date()) {
+  const date = getScheduledDate(entry, now);
+  if (!date) {
+    return null;
+  }
+  return [date.getFullYear(), date.getMonth() + 1, date.getDate()].map((part) => `${part}`.padStart(2, '0')).join('-');
+}
+
+/**
+ * Builds the last change of the team from the change event that was sent to
+ * the webhooks, i.e. without what's already in `latest.json`.
+ *
+ * @param {Object} changeEvent the change event, see `buildChangeEvent()`
+ * @return {Object} `{detectedAt, severity, summary, changes}`
+ */
+function buildLastChange(changeEvent) {
+  const {detectedAt, severity, summary, changes} = changeEvent;
+  return {detectedAt, severity, summary, changes};
+}
+
+/**
+ * Builds the `latest.json` of the team: the parsed schedule, sorted by date,
+ * with when it was scraped, where from, and the last change.
+ *
+ * @param {Object} team the team
+ * @param {Map} schedule the current schedule
+ * @param {Object} lastChange the last change, see `buildLastChange()`, or null if there hasn't been one
+ * @param {Date} now the time the schedule was scraped
+ * @return {Object} the snapshot
+ */
+function buildScheduleSnapshot(team, schedule, lastChange, now = new Date()) {
+  const entries = [...schedule.entries()]
+      .map(([key, entry]) => ({key, date: formatEntryDate(entry, now), ...entry}))
+      .sort((a, b) => (a.date || '').localeCompare(b.date || ''));
+  return {
+    version: SCHEMA_VERSION,
+    team: team.id,
+    name: team.name || null,
+    url: team.url,
+    season: team.season || null,
+    ageGroup: team.ageGroup || null,
+    scrapedAt: now.toISOString(),
+    entries,
+    lastChange,
+  };
+}
+
+/**
+ * Publishes the team's `latest.json` (`<prefix><team id>/latest.json`), so
+ * that a team app or a widget on the team's website can show the current
+ * schedule without scraping the page. It's published after every run, so
+ * `scrapedAt` tells how fresh it is, and the last change is kept in the
+ * team's state in between.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {Map} schedule the current schedule
+ * @param {Object} changeEvent the change event of this run, see `buildChangeEvent()`, or null if nothing changed
+ * @param {Object} store the storage that the state is kept in
+ * @param {Function} upload uploads the file, see `uploadApiFile()`
+ * @param {Date} now the current date
+ * @return {String} the key that was published, or null if the upload failed
+ */
+async function publishScheduleSnapshot(team, schedule, changeEvent = null, store = getStore(), upload = uploadApiFile, now = new Date()) {
+  const filepath = `${team.id}/${LAST_CHANGE_FILENAME}`;
+  let lastChange = null;
+  if (changeEvent) {
+    lastChange = buildLastChange(changeEvent);
+    await store.upload(filepath, JSON.stringify(lastChange));
+  } else {
+    const data = await store.download(filepath);
+    if (data) {
+      try {
+        lastChange = JSON.parse(data);
+      } catch (e) {
+        logger.error(e);
+      }
+    }
+  }
+  const key = `${config.schedule_api_prefix}${team.id}/latest.json`;
+  if (!await upload(key, JSON.stringify(buildScheduleSnapshot(team, schedule, lastChange, now), null, 2))) {
+    logger.warn(`Unable to publish ${key}`);
+    return null;
+  }
+  return key;
+}
+
+module.exports = {
+  SCHEMA_VERSION,
+  LAST_CHANGE_FILENAME,
+  buildLastChange,
+  buildScheduleSnapshot,
+  publishScheduleSnapshot,
+};
@@ -0,0 +1,224 @@
+/* eslint-disable max-len */
+
+const DURATION_UNITS = {s: 1, m: 60, h: 3600, d: 86400};
+
+// The allowed range of each cron field: minute, hour, day of month, month, day of week
+const CRON_FIELDS = [[0, 59], [0, 23], [1, 31], [1, 12], [0, 7]];
+
+const formatters = new Map();
+
+/**
+ * Parses a duration, e.g. `30m`, `2h`, `1d`, or a plain number of seconds.
+ *
+ * @param {String} value the duration
+ * @return {Number} the duration in seconds, or NaN if it isn't valid
+ */
+function parseDuration(value) {
+  const match = `${value}`.trim().toLowerCase().match(/^(\d+(?:\.\d+)?)\s*([smhd]?)$/);
+  if (!match) {
+    return NaN;
+  }
+  return Math.round(parseFloat(match[1]) * DURATION_UNITS[match[2] || 's']);
+}
+
+/**
+ * Parses one field of a cron expression, e.g. `*`, `*\/15`, `1-5`, or `0,30`.
+ *
+ * @param {String} field the field
+ * @param {Integer} min the smallest allowed value
+ * @param {Integer} max the largest allowed value
+ * @return {Set} the values that the field matches
+ */
+function parseCronField(field, min, max) {
+  const values = new Set();
+  for (const part of field.split(',')) {
+    const match = part.match(/^(\*|(\d+)(?:-(\d+))?)(?:\/(\d+))?$/);
+    if (!match) {
+      throw new Error(`Invalid cron field: ${field}`);
+    }
+    let start = min;
+    let end = max;
+    if (match[1] !== '*') {
+      start = parseInt(match[2]);
+      end = match[3] !== undefined ? parseInt(match[3]) : (match[4] ? max : start);
+    }
+    const step = match[4] ? parseInt(match[4]) : 1;
+    if (start < min || end > max || start > end || step < 1) {
+      throw new Error(`Invalid cron field: ${field}`);
+    }
+    for (let value = start; value <= end; value += step) {
+      values.add(value);
+    }
+  }
+  return values;
+}
+
+/**
+ * Parses a standard 5 field cron expression (minute, hour, day of month,
+ * month, day of week).
+ *
+ * @param {String} expression the cron expression, e.g. `*\/30 8-22 * * *`
+ * @return {Object} the values matched by each field, and whether the day fields are restricted
+ */
+function parseCronExpression(expression) {
+  const fields = `${expression}`.trim().split(/\s+/);
+  if (fields.length !== 5) {
+    throw new Error(`Invalid cron expression (expected 5 fields): ${expression}`);
+  }
+  const [minutes, hours, daysOfMonth, months, daysOfWeek] = fields.map((field, i) => parseCronField(field, ...CRON_FIELDS[i]));
+  if (daysOfWeek.has(7)) {
+    daysOfWeek.add(0); // both 0 and 7 are Sunday
+  }
+  // Like cron, a day field starting with `*` (e.g. `*/2`) doesn't count as restricted
+  return {minutes, hours, daysOfMonth, months, daysOfWeek, restrictsDayOfMonth: !fields[2].startsWith('*'), restrictsDayOfWeek: !fields[4].startsWith('*')};
+}
+
+/**
+ * Retrieves the local date and time fields of a date in a time zone.
+ *
+ * @param {Date} date the date
+ * @param {String} timeZone the time zone, e.g. `America/New_York`
+ * @return {Object} the minute, hour, day of month, month, and day of week
+ */
+function getZonedFields(date, timeZone) {
+  if (!formatters.has(timeZone)) {
+    formatters.set(timeZone, new Intl.DateTimeFormat('en-US', {timeZone, hourCycle: 'h23', month: 'numeric', day: 'numeric', weekday: 'short', hour: 'numeric', minute: 'numeric'}));
+  }
+  const parts = Object.fromEntries(formatters.get(timeZone).formatToParts(date).map((part) => [part.type, part.value]));
+  return {
+    minute: parseInt(parts.minute),
+    hour: parseInt(parts.hour),
+    dayOfMonth: parseInt(parts.day),
+    month: parseInt(parts.month),
+    dayOfWeek: ['Sun', 'Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat'].indexOf(parts.weekday),
+  };
+}
+
+/**
+ * Calculates the next time that a cron expression matches, strictly after
+ * the given date.
+ *
+ * @param {String} expression the cron expression
+ * @param {Date} after the date to start from
+ * @param {String} timeZone the time zone that the expression is evaluated in
+ * @return {Date} the next matching time, or null if there isn't one within a year
+ */
+function getNextCronTime(expression, after, timeZone = 'UTC') {
+  const cron = parseCronExpression(expression);
+  let time = Math.floor(after.getTime() / 60000) * 60000 + 60000;
+  const limit = time + 366 * 86400000;
+  while (time < limit) {
+    const fields = getZonedFields(new Date(time), timeZone);
+    const dayOfMonthMatches = cron.daysOfMonth.has(fields.dayOfMonth);
+    const dayOfWeekMatches = cron.daysOfWeek.has(fields.dayOfWeek);
+    // Like cron, when both day fields are restricted, either one matching is enough
+    const dayMatches = cron.restrictsDayOfMonth && cron.restrictsDayOfWeek ? dayOfMonthMatches || dayOfWeekMatches : dayOfMonthMatches && dayOfWeekMatches;
+    if (!cron.months.has(fields.month) || !dayMatches || !cron.hours.has(fields.hour)) {
+      time += (60 - fields.minute) * 60000; // skip to the next hour
+    } else if (!cron.minutes.has(fields.minute)) {
+      time += 60000;
+    } else {
+      return new Date(time);
+    }
+  }
+  return null;
+}
+
+/**
+ * Calculates when a schedule is next due. The schedule is either an interval
+ * (e.g. `30m`) since the last run, or a cron expression.
+ *
+ * @param {String} schedule the interval or cron expression
+ * @param {Date} lastRun when it last ran, or null if it hasn't run yet
+ * @param {String} timeZone the time zone that cron expressions are evaluated in
+ * @return {Date} when it's next due
+ */
+function getNextRunTime(schedule, lastRun, timeZone = 'UTC') {
+  if (!lastRun) {
+    return new Date(0); // always run at startup
+  }
+  const interval = parseDuration(schedule);
+  if (!isNaN(interval)) {
+    return new Date(lastRun.getTime() + interval * 1000);
+  }
+  return getNextCronTime(schedule, lastRun, timeZone);
+}
+
+/**
+ * Keeps track of when each team last ran, and which teams are due, so that
+ * each team can be checked on its own schedule.
+ *
+ * @class TeamScheduler
+ * @typedef {TeamScheduler}
+ */
+class TeamScheduler {
+  /**
+   * Creates an instance of TeamScheduler.
+   *
+   * @constructor
+   * @param {String} defaultSchedule the schedule of teams without their own `schedule`
+   * @param {String} timeZone the time zone that cron expressions are evaluated in
+   */
+  constructor(defaultSchedule, timeZone = 'UTC') {
+    this.defaultSchedule = defaultSchedule;
+    this.timeZone = timeZone;
+    this.lastRuns = new Map();
+  }
+
+  /**
+   * Calculates when a team is next due.
+   *
+   * @param {Object} team the team, with an optional `schedule`
+   * @return {Date} when it's next due, or null if it never is
+   */
+  getNextRunTime(team) {
+    return getNextRunTime(team.schedule || this.defaultSchedule, this.lastRuns.get(team.id), this.timeZone);
+  }
+
+  /**
+   * Retrieves the teams that are due to run.
+   *
+   * @param {Array} teams the teams
+   * @param {Date} now the current date
+   * @return {Array} the teams that are due
+   */
+  getDueTeams(teams, now = new Date()) {
+    return teams.filter((team) => {
+      const next = this.getNextRunTime(team);
+      return next && next <= now;
+    });
+  }
+
+  /**
+   * Records that teams have run.
+   *
+   * @param {Array} teams the teams that ran
+   * @param {Date} now when they ran
+   */
+  markRun(teams, now = new Date()) {
+    teams.forEach((team) => this.lastRuns.set(team.id, now));
+  }
+
+  /**
+   * Calculates how long to wait until the next team is due.
+   *
+   * @param {Array} teams the teams
+   * @param {Date} now the current date
+   * @return {Integer} the delay, in milliseconds, or null if no team is ever due
+   */
+  getDelayUntilNextRun(teams, now = new Date()) {
+    const times = teams.map((team) => this.getNextRunTime(team)).filter((time) => time);
+    if (!times.length) {
+      return null;
+    }
+    return Math.max(Math.min(...times.map((time) => time.getTime())) - now.getTime(), 0);
+  }
+}
+
+module.exports = {
+  parseDuration,
+  parseCronExpression,
+  getNextCronTime,
+  getNextRunTime,
+  TeamScheduler,
+};
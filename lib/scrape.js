@@ -0,0 +1,652 @@
+/* eslint-disable max-len */
+const fs = require('fs');
+const path = require('path');
+const axios = require('axios');
+const cheerio = require('cheerio');
+const puppeteer = require('puppeteer');
+const config = require('../config');
+const {parseSchedulePage} = require('./parsers');
+const {logger} = require('./logger');
+const {sleep} = require('./abort');
+
+// The settings for the Bandits 12U page, used unless a team overrides them
+const DEFAULT_SCRAPE_SETTINGS = {
+  scraper: 'browser', // `browser` (headless Chrome) or `http` (plain request, for pages that render server-side)
+  parser: 'wix', // one of `wix`, `text`, `table`, or `json` (see `lib/parsers.js`)
+  anchorSelector: 'h5', // element that marks the schedule section
+  anchorText: 'Winter Practices', // text that the anchor element contains
+  alternateAnchors: ['Upcoming Schedule', 'Schedule'], // headings to try when the anchor isn't found
+  endMarkers: ['Schedule by Season', 'Spring Season'], // text that marks the end of the upcoming schedule
+  rowSelector: 'table tr', // rows of the schedule, for the `table` parser
+  dateColumn: 0, // column with the date, for the `table` parser
+  itemsPath: '', // path to the list of events, for the `json` parser
+  dateField: 'date', // field with the date of each event, for the `json` parser
+  detailsFields: ['details'], // fields with the details of each event, for the `json` parser
+  waitSelector: null, // element to wait for before scraping, e.g. for pages that render late
+  waitUntil: 'load', // when the page counts as loaded: `load`, `domcontentloaded`, `networkidle0`, or `networkidle2`
+  settleMs: 0, // # of milliseconds to wait once the page is loaded, e.g. for animations, as a last resort
+  timeoutSeconds: null, // # of seconds to wait for the page, or null for the `TEAM_TIMEOUT`
+  viewport: {width: 1200, height: 800, deviceScaleFactor: 2},
+  clipMode: 'element', // `element` (the bounds of the schedule section on the page) or `fixed` (the `clip`)
+  clipPadding: 16, // # of pixels around the schedule section, for the `element` clip
+  clip: {x: 150, y: 200, width: 340, height: 470}, // portion of the page in the screenshot, for the `fixed` clip (or when the section isn't found)
+};
+
+// Where Chrome is found within a directory, e.g. a Lambda layer mounted at `/opt`
+const CHROME_EXECUTABLES = ['chrome', 'chromium', 'headless-chromium', 'chrome-linux64/chrome', 'chrome/chrome', 'bin/chromium', 'bin/chrome'];
+
+/**
+ * Finds the Chrome executable outside of the image, e.g. in a Lambda layer
+ * or an EFS mount, so that the image doesn't need to bundle Chrome.
+ *
+ * @param {String} chromePath the executable, or a directory to look for it in, or undefined to use the bundled Chrome
+ * @param {Object} fileSystem the file system, to look for the executable in
+ * @return {String} the path of the executable, or null to use the bundled Chrome
+ */
+function findChromeExecutable(chromePath = config.chrome_path, fileSystem = fs) {
+  if (!chromePath) {
+    return null;
+  }
+  if (!fileSystem.existsSync(chromePath)) {
+    throw new Error(`Chrome wasn't found at ${chromePath} (CHROME_PATH)`);
+  }
+  if (!fileSystem.statSync(chromePath).isDirectory()) {
+    return chromePath;
+  }
+  const executable = CHROME_EXECUTABLES.map((name) => path.join(chromePath, name)).find((candidate) => fileSystem.existsSync(candidate) && !fileSystem.statSync(candidate).isDirectory());
+  if (!executable) {
+    throw new Error(`Chrome wasn't found in ${chromePath} (CHROME_PATH), looked for ${CHROME_EXECUTABLES.join(', ')}`);
+  }
+  return executable;
+}
+
+/**
+ * Launches the headless browser used for scraping and screenshots, either
+ * the Chrome bundled with puppeteer, or the one at `CHROME_PATH`.
+ *
+ * @async
+ * @return {Object} the puppeteer browser
+ */
+async function launchBrowser() {
+  const executablePath = findChromeExecutable();
+  return await puppeteer.launch({
+    headless: 'new',
+    args: ['--no-sandbox', '--disable-setuid-sandbox', ...config.chrome_args],
+    ...(executablePath ? {executablePath} : {}),
+  });
+}
+
+/**
+ * Creates a browser that's only launched when it's first needed, so that runs
+ * where every team is scraped over HTTP (and nothing changed) don't start
+ * Chrome at all.
+ *
+ * @param {Function} launch launches the browser
+ * @return {Object} Object with `get()`, which launches the browser on first use, and `close()`
+ */
+function createLazyBrowser(launch = launchBrowser) {
+  let browser = null;
+  return {
+    get: async () => {
+      if (!browser) {
+        browser = launch();
+      }
+      return await browser;
+    },
+    close: async () => {
+      if (browser) {
+        await (await browser).close();
+        browser = null;
+      }
+    },
+  };
+}
+
+/**
+ * Creates a browser that's shared across runs, e.g. by the invocations of a
+ * warm Lambda container, so that Chrome is only started once per container
+ * rather than once per run. Its pages are pooled too: closing a page returns
+ * it to the pool (on `about:blank`), for the next page that's opened, up to
+ * `BROWSER_PAGE_POOL_SIZE` idle pages. Chrome is relaunched when it crashed
+ * or disconnected since it was last used.
+ *
+ * @param {Function} launch launches the browser
+ * @param {Integer} poolSize the # of idle pages to keep
+ * @return {Object} Object with `get()`, which launches the browser on first use (or after a crash), `close()`, which keeps it running for the next run, and `shutdown()`
+ */
+function createSharedBrowser(launch = launchBrowser, poolSize = config.browser_page_pool_size) {
+  let browser = null;
+  let idle = [];
+  const closers = new WeakMap(); // the pages' own `close()`, before it's swapped for returning them to the pool
+  const relaunch = () => {
+    browser = launch().then((launched) => {
+      if (typeof launched.on === 'function') {
+        launched.on('disconnected', () => {
+          logger.warn('Chrome disconnected, it will be relaunched on the next use');
+          browser = null;
+          idle = [];
+        });
+      }
+      return launched;
+    });
+    browser.catch(() => {
+      browser = null; // launch again on the next use
+    });
+    idle = [];
+    return browser;
+  };
+  // Resets the page for the next use, or closes it when the pool is full (or it can't be reset)
+  const release = async (page, closePage) => {
+    if (idle.length < poolSize) {
+      try {
+        await page.goto('about:blank', {timeout: 5000});
+        idle.push(page);
+        return;
+      } catch (e) {
+        logger.warn(`Unable to reset the page for reuse, closing it: ${e.message}`);
+      }
+    }
+    await closePage();
+  };
+  const newPage = async (launched) => {
+    const page = idle.pop() || await launched.newPage();
+    if (!closers.has(page)) {
+      closers.set(page, page.close.bind(page));
+    }
+    const closePage = closers.get(page);
+    let released = false;
+    page.close = async () => {
+      if (!released) {
+        released = true;
+        await release(page, closePage);
+      }
+    };
+    page.isClosed = () => released;
+    return page;
+  };
+  return {
+    get: async () => {
+      let launched = browser ? await browser : null;
+      if (!launched || (typeof launched.isConnected === 'function' && !launched.isConnected())) {
+        launched = await relaunch();
+      }
+      return {newPage: () => newPage(launched), browser: launched};
+    },
+    close: async () => {}, // kept running for the next run, see `shutdown()`
+    shutdown: async () => {
+      if (browser) {
+        const launched = await browser;
+        browser = null;
+        idle = [];
+        await launched.close();
+      }
+    },
+  };
+}
+
+/**
+ * Retrieves the scrape settings that the deployment sets for every team
+ * (i.e. `SCRAPE_WAIT_UNTIL`, `SCRAPE_SETTLE_MS`, `SCRAPE_TIMEOUT_SECONDS`,
+ * and `SCRAPE_VIEWPORT`), over the defaults.
+ *
+ * @return {Object} the settings that are set
+ */
+function getDeploymentScrapeSettings() {
+  const settings = {};
+  if (config.scrape_wait_until) {
+    settings.waitUntil = config.scrape_wait_until;
+  }
+  if (config.scrape_settle_ms !== null) {
+    settings.settleMs = config.scrape_settle_ms;
+  }
+  if (config.scrape_timeout_seconds) {
+    settings.timeoutSeconds = config.scrape_timeout_seconds;
+  }
+  if (config.scrape_viewport) {
+    settings.viewport = {...DEFAULT_SCRAPE_SETTINGS.viewport, ...config.scrape_viewport};
+  }
+  return settings;
+}
+
+/**
+ * Retrieves the scrape settings for the team, where the team's `scrape`
+ * settings (from `TEAMS`) are layered over the deployment's settings (see
+ * `getDeploymentScrapeSettings()`) and the defaults.
+ *
+ * @param {Object} team the team, e.g. `{id, url, scrape: {anchorText: 'Upcoming Schedule'}}`
+ * @return {Object} the scrape settings
+ */
+function getScrapeSettings(team) {
+  const scrape = team.scrape || {};
+  const defaults = {...DEFAULT_SCRAPE_SETTINGS, ...getDeploymentScrapeSettings()};
+  return {
+    ...defaults,
+    ...scrape,
+    viewport: {...defaults.viewport, ...scrape.viewport},
+    clip: {...DEFAULT_SCRAPE_SETTINGS.clip, ...scrape.clip},
+    // A team that set its own clip keeps it, unless it asks for the element clip
+    clipMode: scrape.clipMode || (scrape.clip ? 'fixed' : DEFAULT_SCRAPE_SETTINGS.clipMode),
+  };
+}
+
+/**
+ * Retrieves the # of milliseconds to wait for the team's page.
+ *
+ * @param {Object} settings the scrape settings, see `getScrapeSettings()`
+ * @return {Integer} the timeout
+ */
+function getPageTimeoutMs(settings) {
+  return (settings.timeoutSeconds || config.teamTimeout) * 1000;
+}
+
+/**
+ * Loads the team's page at its viewport, and waits for it as the team's
+ * settings say: until the `waitUntil` event, then for the `waitSelector`
+ * element, then for `settleMs`.
+ *
+ * @async
+ * @param {Object} page the puppeteer page
+ * @param {Object} team the team
+ * @param {Integer} timeoutMs # of milliseconds to wait for the page
+ */
+async function navigatePage(page, team, timeoutMs = getPageTimeoutMs(getScrapeSettings(team))) {
+  const settings = getScrapeSettings(team);
+  await page.setViewport(settings.viewport);
+  await page.goto(team.url, {timeout: timeoutMs, waitUntil: settings.waitUntil});
+  if (settings.waitSelector) {
+    await page.waitForSelector(settings.waitSelector, {timeout: timeoutMs});
+  }
+  if (settings.settleMs) {
+    await sleep(settings.settleMs);
+  }
+}
+
+/**
+ * Loads the team's page, and grabs its content for the parsers.
+ *
+ * @async
+ * @param {Object} page the puppeteer page
+ * @param {Object} team the team
+ * @param {Integer} timeoutMs # of milliseconds to wait for the page
+ * @return {Object} the page's content, i.e. `{html, text}`
+ */
+async function loadPageContent(page, team, timeoutMs = getPageTimeoutMs(getScrapeSettings(team))) {
+  await navigatePage(page, team, timeoutMs);
+  // Grab the page's HTML data, and its text for the parsers that don't need the markup
+  return await page.evaluate(() => {
+    return {html: document.documentElement.innerHTML, text: document.body.innerText};
+  });
+}
+
+/**
+ * Loads the team's page and parses the schedule, with the team's parser.
+ *
+ * @async
+ * @param {Object} page the puppeteer page
+ * @param {Object} team the team
+ * @param {Integer} timeoutMs # of milliseconds to wait for the page
+ * @param {Date} now the current date
+ * @return {Map} the schedule
+ */
+async function scrapeSchedule(page, team, timeoutMs = getPageTimeoutMs(getScrapeSettings(team)), now = new Date()) {
+  return parseSchedulePage(await loadPageContent(page, team, timeoutMs), getScrapeSettings(team), now);
+}
+
+/**
+ * Builds the date of an entry the way the page shows it, e.g.
+ * `SATURDAY, 10/7`, from the entry's day rather than its key, which is
+ * canonicalized (e.g. `SATURDAY, 10/07/2023`).
+ *
+ * @param {Object} entry the schedule entry
+ * @param {String} key the key of the entry, for the entries without a day
+ * @return {String} the date as shown on the page
+ */
+function getHighlightText(entry, key) {
+  if (!entry || !entry.dayOfWeek || !entry.dayOfMonth) {
+    return `${key}`;
+  }
+  const dayOfMonth = `${entry.dayOfMonth}`.split('/').map((part) => `${parseInt(part)}`).join('/');
+  return `${`${entry.dayOfWeek}`.toUpperCase()}, ${dayOfMonth}`;
+}
+
+/**
+ * Determines which entries to highlight in the screenshot, i.e. the added
+ * and modified entries.
+ *
+ * @param {Object} scheduleDiff the differences, see `diffSchedule()`
+ * @return {Array} list of objects with the entry's `key`, its `text` on the page (e.g. `SATURDAY, 10/7`), and `label`
+ */
+function getHighlights(scheduleDiff) {
+  return [
+    ...[...scheduleDiff.added].map(([key, entry]) => ({key, text: getHighlightText(entry, key), label: 'NEW'})),
+    ...[...scheduleDiff.modified].map(([key, entry]) => ({key, text: getHighlightText(entry, key), label: 'CHANGED'})),
+  ];
+}
+
+/**
+ * Overlays markers on the page for the highlighted entries: a colored box
+ * around the entry (its date and the details that follow) and a badge. The
+ * entries are found by the bounding boxes of the elements with their dates.
+ *
+ * @async
+ * @param {Object} page the puppeteer page, already showing the team's page
+ * @param {Array} highlights the entries to highlight, see `getHighlights()`
+ * @return {Integer} the # of entries that were found and highlighted
+ */
+async function highlightEntries(page, highlights) {
+  if (!highlights.length) {
+    return 0;
+  }
+  return await page.evaluate((items) => {
+    const normalize = (text) => `${text}`.replace(/\s+/g, ' ').trim().toUpperCase();
+    const colors = {NEW: '#2e7d32', CHANGED: '#e65100'};
+    let found = 0;
+    for (const item of items) {
+      // The deepest element that contains the date, e.g. `SATURDAY, 10/7`
+      const date = new RegExp(`${normalize(item.text || item.key)}(?!\\d)`); // so that 10/1 doesn't match 10/15
+      const matches = [...document.body.querySelectorAll('*')].filter((element) => date.test(normalize(element.textContent)));
+      const element = matches.find((match) => ![...match.children].some((child) => date.test(normalize(child.textContent))));
+      if (!element) {
+        continue;
+      }
+      const box = element.getBoundingClientRect();
+      let bottom = box.bottom;
+      let right = box.right;
+      const details = element.nextElementSibling;
+      if (details && details.getBoundingClientRect().height) {
+        bottom = Math.max(bottom, details.getBoundingClientRect().bottom);
+        right = Math.max(right, details.getBoundingClientRect().right);
+      }
+      const color = colors[item.label] || '#e65100';
+      const overlay = document.createElement('div');
+      overlay.style.cssText = `position: absolute; z-index: 99999; pointer-events: none; left: ${box.left + window.scrollX - 3}px; top: ${box.top + window.scrollY - 3}px; width: ${right - box.left + 6}px; height: ${bottom - box.top + 6}px; border: 2px solid ${color}; border-radius: 4px; box-sizing: border-box;`;
+      const badge = document.createElement('span');
+      badge.textContent = item.label;
+      badge.style.cssText = `position: absolute; right: 0; top: 0; padding: 1px 4px; background: ${color}; color: #ffffff; font: bold 9px Helvetica, Arial, sans-serif; border-bottom-left-radius: 3px;`;
+      overlay.appendChild(badge);
+      document.body.appendChild(overlay);
+      found++;
+    }
+    return found;
+  }, highlights);
+}
+
+/**
+ * Finds the bounds of the schedule section on the page: from the anchor
+ * heading (or an alternate one) through the text that follows it, up to
+ * the end marker (or the next heading like the anchor). The bounds follow
+ * the section, so that a long schedule isn't cut off, and a short one
+ * doesn't take in the unrelated content below it.
+ *
+ * @async
+ * @param {Object} page the puppeteer page, already showing the team's page
+ * @param {Object} settings the scrape settings, see `getScrapeSettings()`
+ * @return {Object} the bounds in page coordinates, `{left, top, right, bottom}`, or null if the anchor isn't found
+ */
+async function findScheduleBounds(page, settings) {
+  return await page.evaluate(({anchorSelector, anchors, endMarkers}) => {
+    const normalize = (text) => `${text}`.replace(/\s+/g, ' ').trim().toUpperCase();
+    const headings = [...document.querySelectorAll(`h1, h2, h3, h4, h5, h6, ${anchorSelector}`)];
+    const anchor = anchors.map((text) => headings.find((heading) => normalize(heading.textContent).includes(normalize(text)))).find((heading) => heading);
+    if (!anchor) {
+      return null;
+    }
+    const rects = [anchor.getBoundingClientRect()];
+    const walker = document.createTreeWalker(document.body, NodeFilter.SHOW_TEXT);
+    walker.currentNode = anchor;
+    let node;
+    while ((node = walker.nextNode())) {
+      const text = normalize(node.textContent);
+      if (anchor.contains(node) || !text) {
+        continue;
+      }
+      const heading = node.parentElement && node.parentElement.closest(anchor.tagName);
+      if ((heading && heading !== anchor) || endMarkers.some((marker) => text.includes(normalize(marker)))) {
+        break;
+      }
+      const range = document.createRange();
+      range.selectNodeContents(node);
+      const rect = range.getBoundingClientRect();
+      if (rect.width && rect.height) {
+        rects.push(rect);
+      }
+    }
+    return {
+      left: Math.min(...rects.map((rect) => rect.left)) + window.scrollX,
+      top: Math.min(...rects.map((rect) => rect.top)) + window.scrollY,
+      right: Math.max(...rects.map((rect) => rect.right)) + window.scrollX,
+      bottom: Math.max(...rects.map((rect) => rect.bottom)) + window.scrollY,
+    };
+  }, {anchorSelector: settings.anchorSelector, anchors: [settings.anchorText, ...(settings.alternateAnchors || [])].filter((text) => text), endMarkers: settings.endMarkers || []});
+}
+
+/**
+ * Pads the bounds of the schedule section into the clip of the screenshot,
+ * in whole pixels, without going past the top or left of the page.
+ *
+ * @param {Object} bounds the bounds, see `findScheduleBounds()`
+ * @param {Integer} padding # of pixels around the bounds
+ * @return {Object} the clip, `{x, y, width, height}`
+ */
+function getPaddedClip(bounds, padding) {
+  const x = Math.max(0, Math.floor(bounds.left - padding));
+  const y = Math.max(0, Math.floor(bounds.top - padding));
+  return {x, y, width: Math.ceil(bounds.right + padding) - x, height: Math.ceil(bounds.bottom + padding) - y};
+}
+
+/**
+ * Takes the screenshot of the portion of the page with the schedule,
+ * optionally highlighting the changed entries.
+ *
+ * @async
+ * @param {Object} page the puppeteer page, already showing the team's page
+ * @param {Object} team the team
+ * @param {Array} highlights the entries to highlight, see `getHighlights()`
+ * @return {Buffer} the screenshot
+ */
+async function screenshotSchedule(page, team, highlights = []) {
+  const settings = getScrapeSettings(team);
+  await page.setViewport(settings.viewport);
+  // The section is measured (and the markers positioned) after the viewport is set, since the layout can change with it
+  let clip = settings.clip;
+  if (settings.clipMode === 'element') {
+    const bounds = await findScheduleBounds(page, settings);
+    if (bounds) {
+      clip = getPaddedClip(bounds, settings.clipPadding);
+    } else {
+      logger.warn(`The schedule section of ${team.id} wasn't found for the screenshot, using the fixed clip`);
+    }
+  }
+  await highlightEntries(page, highlights);
+  return await page.screenshot({
+    type: 'png',
+    clip,
+    omitBackground: true,
+    captureBeyondViewport: true, // a long schedule can run past the viewport
+  });
+}
+
+/**
+ * Scrapes the team's page with headless Chrome, for pages that render
+ * client-side (e.g. Wix).
+ *
+ * @class BrowserScraper
+ * @typedef {BrowserScraper}
+ */
+class BrowserScraper {
+  /**
+   * Creates an instance of BrowserScraper.
+   *
+   * @constructor
+   * @param {Function} getBrowser retrieves the puppeteer browser
+   */
+  constructor(getBrowser) {
+    this.getBrowser = getBrowser;
+    this.page = null;
+    this.content = null; // the content of the page that was last scraped, for the parse quality report
+  }
+
+  /**
+   * Loads the team's page and parses the schedule.
+   *
+   * @async
+   * @param {Object} team the team
+   * @param {AbortSignal} signal the signal that cancels the scrape
+   * @param {Date} now the current date
+   * @return {Map} the schedule
+   */
+  async scrape(team, signal = undefined, now = new Date()) {
+    await this.openPage(signal);
+    this.content = await loadPageContent(this.page, team);
+    return parseSchedulePage(this.content, getScrapeSettings(team), now);
+  }
+
+  /**
+   * Takes the screenshot of the portion of the page with the schedule.
+   *
+   * @async
+   * @param {Object} team the team
+   * @param {AbortSignal} signal the signal that cancels the screenshot
+   * @param {Array} highlights the entries to highlight, see `getHighlights()`
+   * @return {Buffer} the screenshot
+   */
+  async screenshot(team, signal = undefined, highlights = []) {
+    await this.openPage(signal);
+    return await screenshotSchedule(this.page, team, highlights);
+  }
+
+  /**
+   * Opens the page, if it isn't already. Cancelling closes the page, which
+   * cancels any pending navigation or evaluation.
+   *
+   * @async
+   * @param {AbortSignal} signal the signal that cancels the page
+   */
+  async openPage(signal) {
+    if (this.page) {
+      return;
+    }
+    const page = await (await this.getBrowser()).newPage();
+    this.page = page;
+    if (signal) {
+      signal.addEventListener('abort', () => page.close().catch(() => {}), {once: true});
+    }
+  }
+
+  /**
+   * Closes the page, if it's still open.
+   *
+   * @async
+   */
+  async close() {
+    if (this.page && !this.page.isClosed()) {
+      await this.page.close();
+    }
+    this.page = null;
+  }
+}
+
+/**
+ * Scrapes the team's page with a plain HTTP request, for pages that render
+ * server-side (or JSON APIs). Chrome is only launched for the screenshot,
+ * i.e. when the schedule changed.
+ *
+ * @class HttpScraper
+ * @typedef {HttpScraper}
+ */
+class HttpScraper extends BrowserScraper {
+  /**
+   * Requests the team's page and parses the schedule.
+   *
+   * @async
+   * @param {Object} team the team
+   * @param {AbortSignal} signal the signal that cancels the scrape
+   * @param {Date} now the current date
+   * @return {Map} the schedule
+   */
+  async scrape(team, signal = undefined, now = new Date()) {
+    const result = await axios.get(team.url, {
+      responseType: 'text',
+      transformResponse: (data) => data, // keep JSON as text, for the parsers
+      timeout: getPageTimeoutMs(getScrapeSettings(team)),
+      signal,
+    });
+    this.content = getPageContent(result.data, result.headers['content-type']);
+    return parseSchedulePage(this.content, getScrapeSettings(team), now);
+  }
+
+  /**
+   * Loads the team's page in the browser and takes the screenshot of the
+   * portion of the page with the schedule.
+   *
+   * @async
+   * @param {Object} team the team
+   * @param {AbortSignal} signal the signal that cancels the screenshot
+   * @param {Array} highlights the entries to highlight, see `getHighlights()`
+   * @return {Buffer} the screenshot
+   */
+  async screenshot(team, signal = undefined, highlights = []) {
+    await this.openPage(signal);
+    await navigatePage(this.page, team);
+    return await screenshotSchedule(this.page, team, highlights);
+  }
+}
+
+/**
+ * Builds the page's content for the parsers from the HTTP response, like
+ * the browser would, i.e. the HTML and the text of the body. Responses that
+ * aren't HTML (e.g. JSON) are the text as is.
+ *
+ * @param {String} body the body of the response
+ * @param {String} contentType the content type of the response
+ * @return {Object} the page's content, i.e. `{html, text}`
+ */
+function getPageContent(body, contentType = '') {
+  if (!`${contentType}`.includes('html')) {
+    return {html: '', text: body};
+  }
+  const $ = cheerio.load(body);
+  return {html: $.html(), text: $('body').text()};
+}
+
+/**
+ * Creates the scraper for the team, per the team's `scraper` setting.
+ *
+ * @param {Object} team the team
+ * @param {Function} getBrowser retrieves the puppeteer browser, see `createLazyBrowser()`
+ * @return {BrowserScraper} the scraper
+ */
+function createPageScraper(team, getBrowser) {
+  const settings = getScrapeSettings(team);
+  switch (settings.scraper) {
+    case 'browser':
+      return new BrowserScraper(getBrowser);
+    case 'http':
+      return new HttpScraper(getBrowser);
+    default:
+      throw new Error(`Unknown scraper "${settings.scraper}", expected browser or http`);
+  }
+}
+
+module.exports = {
+  DEFAULT_SCRAPE_SETTINGS,
+  findChromeExecutable,
+  launchBrowser,
+  createLazyBrowser,
+  createSharedBrowser,
+  getDeploymentScrapeSettings,
+  getScrapeSettings,
+  getPageTimeoutMs,
+  navigatePage,
+  loadPageContent,
+  scrapeSchedule,
+  getHighlights,
+  highlightEntries,
+  findScheduleBounds,
+  getPaddedClip,
+  screenshotSchedule,
+  BrowserScraper,
+  HttpScraper,
+  getPageContent,
+  createPageScraper,
+};
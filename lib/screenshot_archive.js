@@ -0,0 +1,202 @@
+/* eslint-disable max-len */
+const zlib = require('zlib');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+
+// The # of channels of each (8-bit) PNG color type: grayscale, RGB, grayscale + alpha, and RGBA
+const PNG_CHANNELS = {0: 1, 2: 3, 4: 2, 6: 4};
+
+/**
+ * Decodes a PNG into its grayscale pixels. Only the formats that the
+ * screenshots are taken in are supported, i.e. 8-bit, non-interlaced, and
+ * without a palette.
+ *
+ * @param {Buffer} buffer the PNG
+ * @return {Object} Object with the `width`, `height`, and grayscale `pixels` (row by row)
+ */
+function decodePng(buffer) {
+  if (buffer.length < 8 || buffer.readUInt32BE(0) !== 0x89504e47) {
+    throw new Error('Not a PNG');
+  }
+  let header = null;
+  const data = [];
+  for (let offset = 8; offset + 8 <= buffer.length;) {
+    const length = buffer.readUInt32BE(offset);
+    const type = buffer.toString('ascii', offset + 4, offset + 8);
+    const chunk = buffer.subarray(offset + 8, offset + 8 + length);
+    if (type === 'IHDR') {
+      header = {width: chunk.readUInt32BE(0), height: chunk.readUInt32BE(4), bitDepth: chunk[8], colorType: chunk[9], interlace: chunk[12]};
+    } else if (type === 'IDAT') {
+      data.push(chunk);
+    } else if (type === 'IEND') {
+      break;
+    }
+    offset += length + 12;
+  }
+  if (!header || header.bitDepth !== 8 || !PNG_CHANNELS[header.colorType] || header.interlace) {
+    throw new Error('Unsupported PNG format');
+  }
+  const {width, height, colorType} = header;
+  const channels = PNG_CHANNELS[colorType];
+  const stride = width * channels;
+  const raw = zlib.inflateSync(Buffer.concat(data));
+  const pixels = new Uint8Array(width * height);
+  let previous = new Uint8Array(stride);
+  for (let y = 0; y < height; y++) {
+    const filter = raw[y * (stride + 1)];
+    const line = raw.subarray(y * (stride + 1) + 1, (y + 1) * (stride + 1));
+    const row = new Uint8Array(stride);
+    for (let i = 0; i < stride; i++) {
+      const left = i >= channels ? row[i - channels] : 0;
+      const up = previous[i];
+      const upLeft = i >= channels ? previous[i - channels] : 0;
+      let predictor = 0;
+      if (filter === 1) {
+        predictor = left;
+      } else if (filter === 2) {
+        predictor = up;
+      } else if (filter === 3) {
+        predictor = (left + up) >> 1;
+      } else if (filter === 4) {
+        const estimate = left + up - upLeft;
+        const [distanceLeft, distanceUp, distanceUpLeft] = [Math.abs(estimate - left), Math.abs(estimate - up), Math.abs(estimate - upLeft)];
+        predictor = distanceLeft <= distanceUp && distanceLeft <= distanceUpLeft ? left : (distanceUp <= distanceUpLeft ? up : upLeft);
+      }
+      row[i] = (line[i] + predictor) & 0xff;
+    }
+    for (let x = 0; x < width; x++) {
+      const pixel = row.subarray(x * channels, (x + 1) * channels);
+      pixels[y * width + x] = channels < 3 ? pixel[0] : Math.round(0.299 * pixel[0] + 0.587 * pixel[1] + 0.114 * pixel[2]);
+    }
+    previous = row;
+  }
+  return {width, height, pixels};
+}
+
+/**
+ * Computes the perceptual (difference) hash of a PNG: the image is shrunk to
+ * 9x8 grayscale cells, and each bit is whether a cell is darker than the one
+ * to its right. Images that look the same have the same (or a nearby) hash,
+ * even when their bytes differ, e.g. because of compression.
+ *
+ * @param {Buffer} buffer the PNG
+ * @return {String} the hash, as 16 hex digits, or null if the PNG couldn't be decoded
+ */
+function getPerceptualHash(buffer) {
+  let image;
+  try {
+    image = decodePng(buffer);
+  } catch (e) {
+    logger.warn(`Unable to hash the screenshot: ${e.message}`);
+    return null;
+  }
+  const {width, height, pixels} = image;
+  const cell = (cx, cy) => {
+    const [x0, x1] = [Math.floor(cx * width / 9), Math.max(Math.floor((cx + 1) * width / 9), Math.floor(cx * width / 9) + 1)];
+    const [y0, y1] = [Math.floor(cy * height / 8), Math.max(Math.floor((cy + 1) * height / 8), Math.floor(cy * height / 8) + 1)];
+    let sum = 0;
+    let count = 0;
+    for (let y = y0; y < Math.min(y1, height); y++) {
+      for (let x = x0; x < Math.min(x1, width); x++) {
+        sum += pixels[y * width + x];
+        count++;
+      }
+    }
+    return count ? sum / count : 0;
+  };
+  let hash = 0n;
+  for (let cy = 0; cy < 8; cy++) {
+    for (let cx = 0; cx < 8; cx++) {
+      hash = (hash << 1n) | (cell(cx, cy) < cell(cx + 1, cy) ? 1n : 0n);
+    }
+  }
+  return hash.toString(16).padStart(16, '0');
+}
+
+/**
+ * Counts the bits that differ between two perceptual hashes.
+ *
+ * @param {String} a the first hash
+ * @param {String} b the second hash
+ * @return {Integer} the # of differing bits
+ */
+function getHammingDistance(a, b) {
+  let difference = BigInt(`0x${a}`) ^ BigInt(`0x${b}`);
+  let distance = 0;
+  while (difference) {
+    distance += Number(difference & 1n);
+    difference >>= 1n;
+  }
+  return distance;
+}
+
+/**
+ * Archives the screenshot, unless it looks the same as the last archived
+ * screenshot of the team (i.e. their perceptual hashes are within the
+ * distance), in which case a pointer to the last screenshot is stored at
+ * `<key>.pointer` instead. This cuts the storage of the screenshots of pages
+ * whose image rarely changes.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {String} key the key to archive the screenshot at
+ * @param {Buffer} imageBuffer the screenshot
+ * @param {Object} store the storage that the archive is kept in
+ * @param {Integer} maxDistance the max # of differing bits of the hashes, or null to always archive the screenshot
+ * @return {Object} Object with the `key` of the archived screenshot (the last one, if deduplicated), and whether it was `deduplicated`
+ */
+async function archiveScreenshot(prefix, key, imageBuffer, store = getStore(), maxDistance = config.screenshot_dedup_distance) {
+  const lastFilename = `${prefix}/lastScreenshot.json`;
+  const hash = getPerceptualHash(imageBuffer);
+  let last = null;
+  const data = await store.download(lastFilename);
+  if (data) {
+    try {
+      last = JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  if (maxDistance !== null && hash && last && last.hash && getHammingDistance(hash, last.hash) <= maxDistance && await store.exists(last.key)) {
+    await store.upload(`${key}.pointer`, JSON.stringify({target: last.key, hash}));
+    return {key: last.key, deduplicated: true};
+  }
+  await store.upload(key, imageBuffer);
+  await store.upload(lastFilename, JSON.stringify({key, hash}));
+  return {key, deduplicated: false};
+}
+
+/**
+ * Resolves the key of an archived screenshot, following the pointer when
+ * the screenshot was deduplicated (see `archiveScreenshot()`).
+ *
+ * @async
+ * @param {String} key the key that the screenshot was archived at
+ * @param {Object} store the storage that the archive is kept in
+ * @return {String} the key of the image, or null if there's no screenshot
+ */
+async function resolveScreenshotKey(key, store = getStore()) {
+  if (await store.exists(key)) {
+    return key;
+  }
+  const data = await store.download(`${key}.pointer`);
+  if (!data) {
+    return null;
+  }
+  try {
+    const {target} = JSON.parse(data);
+    return target && await store.exists(target) ? target : null;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+module.exports = {
+  decodePng,
+  getPerceptualHash,
+  getHammingDistance,
+  archiveScreenshot,
+  resolveScreenshotKey,
+};
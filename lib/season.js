@@ -0,0 +1,101 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+
+/**
+ * Retrieves the season and age group that the team's page currently shows,
+ * e.g. `{"season": "2024 Spring", "ageGroup": "12U"}` in `TEAMS`, so that
+ * teams that reuse the same page year after year can tell the seasons apart.
+ *
+ * @param {Object} team the team
+ * @return {Object} `{season, ageGroup}`, or null if neither is configured
+ */
+function getSeasonMetadata(team) {
+  if (!team || (!team.season && !team.ageGroup)) {
+    return null;
+  }
+  return {season: team.season ? `${team.season}` : null, ageGroup: team.ageGroup ? `${team.ageGroup}` : null};
+}
+
+/**
+ * Retrieves the season and age group of a configured team by its id.
+ *
+ * @param {String} teamId the team id
+ * @param {Array} teams the configured teams
+ * @return {Object} `{season, ageGroup}`, or null if neither is configured, see `getSeasonMetadata()`
+ */
+function getTeamSeasonMetadata(teamId, teams = config.teams) {
+  return getSeasonMetadata(teams.find((team) => team.id === teamId));
+}
+
+/**
+ * Determines the key of the metadata stored alongside an archived schedule
+ * snapshot. It doesn't end with `.json`, so that it isn't mistaken for a
+ * snapshot, and it has the snapshot's timestamp, so that it's pruned with it.
+ *
+ * @param {String} snapshotKey the key of the archived schedule, e.g. `team/archive/schedule-2023-10-6-1696600000000.json`
+ * @return {String} the key of the metadata, e.g. `team/archive/schedule-2023-10-6-1696600000000.json.meta`
+ */
+function getSnapshotMetadataKey(snapshotKey) {
+  return `${snapshotKey}.meta`;
+}
+
+/**
+ * Stores the season and age group with an archived schedule snapshot.
+ *
+ * @async
+ * @param {String} snapshotKey the key of the archived schedule
+ * @param {Object} metadata the season and age group, see `getSeasonMetadata()`
+ * @param {Object} store the storage that the archive is kept in
+ * @return {String} the key of the metadata, or null if there's no metadata to store
+ */
+async function recordSnapshotMetadata(snapshotKey, metadata, store = getStore()) {
+  if (!metadata) {
+    return null;
+  }
+  const key = getSnapshotMetadataKey(snapshotKey);
+  await store.upload(key, JSON.stringify(metadata));
+  return key;
+}
+
+/**
+ * Loads the season and age group stored with an archived schedule snapshot.
+ *
+ * @async
+ * @param {String} snapshotKey the key of the archived schedule
+ * @param {Object} store the storage that the archive is kept in
+ * @return {Object} `{season, ageGroup}`, or null if none was stored (e.g. the snapshot predates the metadata)
+ */
+async function loadSnapshotMetadata(snapshotKey, store = getStore()) {
+  const data = await store.download(getSnapshotMetadataKey(snapshotKey));
+  if (!data) {
+    return null;
+  }
+  try {
+    return JSON.parse(data);
+  } catch (e) {
+    logger.error(e);
+    return null;
+  }
+}
+
+/**
+ * Whether the metadata is of the given season, ignoring case.
+ *
+ * @param {Object} metadata the season and age group, see `getSeasonMetadata()`
+ * @param {String} season the season to filter by, e.g. `2024 Spring`
+ * @return {Boolean} true if it matches
+ */
+function matchesSeason(metadata, season) {
+  return !!(metadata && metadata.season) && metadata.season.trim().toLowerCase() === `${season}`.trim().toLowerCase();
+}
+
+module.exports = {
+  getSeasonMetadata,
+  getTeamSeasonMetadata,
+  getSnapshotMetadataKey,
+  recordSnapshotMetadata,
+  loadSnapshotMetadata,
+  matchesSeason,
+};
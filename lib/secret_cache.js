@@ -0,0 +1,93 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const vault = require('./vault');
+
+/**
+ * Caches the secrets from HCP Vault Secrets (or AWS, see `lib/aws_secrets.js`)
+ * for the lifetime of the process, so that they are fetched once at startup
+ * rather than on every run. Once
+ * the cache is older than its TTL, the versions of the secrets are checked,
+ * and the secrets are only fetched again when one of them was rotated.
+ *
+ * @class SecretCache
+ * @typedef {SecretCache}
+ */
+class SecretCache {
+  /**
+   * Creates an instance of SecretCache.
+   *
+   * @constructor
+   * @param {Integer} ttlSeconds # of seconds before the versions are checked again
+   * @param {Object} client the client of the secrets source (see `lib/vault.js` and `lib/aws_secrets.js`)
+   */
+  constructor(ttlSeconds = config.secrets_cache_ttl, client = vault) {
+    this.ttlSeconds = ttlSeconds;
+    this.client = client;
+    this.secrets = null;
+    this.checkedAt = null;
+  }
+
+  /**
+   * Fetches all of the secrets.
+   *
+   * @async
+   * @param {Date} now the current date
+   * @return {Boolean} true if the secrets were fetched
+   */
+  async load(now = new Date()) {
+    const apiToken = await this.client.retrieveApiToken();
+    const secrets = apiToken ? await this.client.retrieveSecrets(apiToken) : null;
+    if (!secrets) {
+      return false;
+    }
+    this.secrets = secrets;
+    this.checkedAt = now;
+    return true;
+  }
+
+  /**
+   * Checks whether any of the secrets were rotated once the cache has
+   * expired, and fetches the secrets again if so. When the versions can't be
+   * checked, the cached secrets are kept.
+   *
+   * @async
+   * @param {Date} now the current date
+   * @return {Boolean} true if the secrets were fetched again
+   */
+  async refresh(now = new Date()) {
+    if (!this.secrets) {
+      return await this.load(now);
+    }
+    if (now - this.checkedAt < this.ttlSeconds * 1000) {
+      return false;
+    }
+    const apiToken = await this.client.retrieveApiToken();
+    const versions = apiToken ? await this.client.retrieveSecretVersions(apiToken) : null;
+    if (!versions) {
+      return false;
+    }
+    this.checkedAt = now;
+    const rotated = [...versions].some(([name, version]) => !this.secrets.has(name) || this.secrets.get(name).version !== version);
+    if (!rotated) {
+      return false;
+    }
+    return await this.load(now);
+  }
+
+  /**
+   * Retrieves the cached value of the secret.
+   *
+   * @param {String} name the name of the secret
+   * @return {String} the value of the secret, or null if it doesn't exist
+   */
+  get(name) {
+    if (!this.secrets || !this.secrets.has(name)) {
+      return null;
+    }
+    return this.secrets.get(name).value;
+  }
+}
+
+module.exports = {
+  SecretCache,
+};
@@ -0,0 +1,128 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getScheduledDate} = require('./helper_functions');
+
+// Ordered from least to most severe
+const SEVERITIES = ['minor', 'moderate', 'critical'];
+
+/**
+ * Normalizes text so that trivial edits (casing, punctuation, whitespace)
+ * don't register as a meaningful change.
+ *
+ * @param {String} text the text to be normalized
+ * @return {String} the normalized text
+ */
+function normalizeForComparison(text) {
+  if (!text) {
+    return '';
+  }
+  return `${text}`.toLowerCase().replace(/[^a-z0-9:\/]+/g, ' ').trim();
+}
+
+/**
+ * Checks whether the schedule entry is for a day that has already passed.
+ * Entries for past days naturally drop off the schedule, and shouldn't be
+ * treated as cancellations.
+ *
+ * @param {Object} entry the schedule entry (with `dayOfMonth` such as `10/3`)
+ * @param {Date} now the current date
+ * @return {Boolean} true if the entry's date is before today
+ */
+function isPastEntry(entry, now = new Date()) {
+  const date = getScheduledDate(entry, now);
+  if (!date) {
+    return false;
+  }
+  return date < new Date(now.getFullYear(), now.getMonth(), now.getDate());
+}
+
+/**
+ * Categorizes a single change to the schedule.
+ *
+ * @param {String} type one of `added`, `deleted`, or `modified`
+ * @param {Object} previous the previous schedule entry (null when added)
+ * @param {Object} current the current schedule entry (null when deleted)
+ * @param {Date} now the current date
+ * @return {String} one of `newGame`, `cancellation`, `expired`, `timeChange`, `locationChange`, or `textFix`
+ */
+function categorizeChange(type, previous, current, now = new Date()) {
+  if (type === 'added') {
+    return /cancel|postpone/i.test(current.location) ? 'cancellation' : 'newGame';
+  }
+  if (type === 'deleted') {
+    return isPastEntry(previous, now) ? 'expired' : 'cancellation';
+  }
+  if (/cancel|postpone/i.test(current.location) && !/cancel|postpone/i.test(previous.location)) {
+    return 'cancellation';
+  }
+  if (previous.timeBlock !== current.timeBlock) {
+    return 'timeChange';
+  }
+  if (normalizeForComparison(previous.location) !== normalizeForComparison(current.location)) {
+    return 'locationChange';
+  }
+  return 'textFix';
+}
+
+/**
+ * Classifies the schedule differences by severity, using the configured
+ * mapping of change categories to severities.
+ *
+ * @param {Map} previousSchedule the previous schedule
+ * @param {Object} scheduleDiff the output of `compareSchedules()`
+ * @param {Object} rules mapping of change category to severity
+ * @param {Date} now the current date
+ * @return {Object} Object with the overall `severity` and the list of `changes`
+ */
+function classifyChanges(previousSchedule, scheduleDiff, rules = config.severity_rules, now = new Date()) {
+  const changes = [];
+  const addChange = (key, type, previous, current) => {
+    const category = categorizeChange(type, previous, current, now);
+    const manuallyCorrected = Boolean(current && current.manuallyCorrected);
+    changes.push({key, type, category, severity: rules[category] || 'moderate', manuallyCorrected});
+  };
+  scheduleDiff.added.forEach((value, key) => addChange(key, 'added', null, value));
+  scheduleDiff.deleted.forEach((value, key) => addChange(key, 'deleted', value, null));
+  scheduleDiff.modified.forEach((value, key) => addChange(key, 'modified', previousSchedule ? previousSchedule.get(key) : null, value));
+
+  let severity = null;
+  for (const change of changes) {
+    if (severity === null || SEVERITIES.indexOf(change.severity) > SEVERITIES.indexOf(severity)) {
+      severity = change.severity;
+    }
+  }
+  return {severity, changes};
+}
+
+/**
+ * Determines which notification channels should be used for the severity.
+ *
+ * @param {String} severity one of `minor`, `moderate`, or `critical`
+ * @param {Object} routes mapping of severity to list of channels
+ * @return {Array} the list of channels, e.g. `['webhook', 'social']`
+ */
+function getChannelsForSeverity(severity, routes = config.severity_routes) {
+  return routes[severity] || [];
+}
+
+/**
+ * Caps the severity, e.g. so that changes that can't be trusted as much are
+ * routed to fewer channels.
+ *
+ * @param {String} severity one of `minor`, `moderate`, or `critical`
+ * @param {String} cap the highest severity allowed
+ * @return {String} the lower of the two severities
+ */
+function capSeverity(severity, cap) {
+  return SEVERITIES.indexOf(severity) > SEVERITIES.indexOf(cap) ? cap : severity;
+}
+
+module.exports = {
+  SEVERITIES,
+  normalizeForComparison,
+  isPastEntry,
+  categorizeChange,
+  classifyChanges,
+  getChannelsForSeverity,
+  capSeverity,
+};
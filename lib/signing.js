@@ -0,0 +1,197 @@
+/* eslint-disable max-len */
+const crypto = require('crypto');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+
+/**
+ * Loads the deployment's ed25519 key from its PEM, e.g. the private key
+ * that signs the archive, or the public key that verifies it.
+ *
+ * @param {String} pem the PEM of the key
+ * @param {Boolean} isPrivate whether it's the private key
+ * @return {KeyObject} the key, or null if there isn't one (or it isn't an ed25519 key)
+ */
+function loadKey(pem, isPrivate) {
+  if (!pem) {
+    return null;
+  }
+  try {
+    const key = isPrivate ? crypto.createPrivateKey(pem) : crypto.createPublicKey(pem);
+    if (key.asymmetricKeyType !== 'ed25519') {
+      logger.error(`Expected an ed25519 key for the archive signatures, got ${key.asymmetricKeyType}`);
+      return null;
+    }
+    return key;
+  } catch (e) {
+    logger.error(e);
+    return null;
+  }
+}
+
+/**
+ * Loads the private key that signs the archive, see `config.archive_signing_key`.
+ *
+ * @param {String} pem the PEM of the private key
+ * @return {KeyObject} the key, or null if the archive isn't signed
+ */
+function loadSigningKey(pem = config.archive_signing_key) {
+  return loadKey(pem, true);
+}
+
+/**
+ * Loads the public key that verifies the archive, i.e. the configured public
+ * key, or the one of the signing key.
+ *
+ * @param {String} pem the PEM of the public key
+ * @param {KeyObject} signingKey the private key that signs the archive, if any
+ * @return {KeyObject} the key, or null if there isn't one
+ */
+function loadVerifyKey(pem = config.archive_verify_key, signingKey = loadSigningKey()) {
+  if (pem) {
+    return loadKey(pem, false);
+  }
+  return signingKey ? crypto.createPublicKey(signingKey) : null;
+}
+
+/**
+ * Identifies the key that made a signature, i.e. the start of the SHA-256
+ * of its public key, so that signatures from a rotated key can be told apart.
+ *
+ * @param {KeyObject} key the private or public key
+ * @return {String} the key id, e.g. `3f2a9c1d8e7b6a50`
+ */
+function getKeyId(key) {
+  const publicKey = key.type === 'private' ? crypto.createPublicKey(key) : key;
+  return crypto.createHash('sha256').update(publicKey.export({type: 'spki', format: 'der'})).digest('hex').slice(0, 16);
+}
+
+/**
+ * Builds the message that's signed for an archived file. The key is part of
+ * it, so that a signature can't vouch for a file that was moved or swapped.
+ *
+ * @param {String} key the key of the file
+ * @param {String} sha256 the hex SHA-256 of its contents
+ * @param {String} signedAt when it was signed (ISO 8601)
+ * @return {Buffer} the message
+ */
+function buildSignedMessage(key, sha256, signedAt) {
+  return Buffer.from(`${key}\n${sha256}\n${signedAt}`);
+}
+
+/**
+ * Signs the contents of an archived file.
+ *
+ * @param {String} key the key of the file
+ * @param {*} contents the contents of the file
+ * @param {KeyObject} privateKey the ed25519 private key
+ * @param {Date} now the time of the signature
+ * @return {Object} the signature, i.e. `{algorithm, keyId, sha256, signedAt, signature}`
+ */
+function signContents(key, contents, privateKey, now = new Date()) {
+  const sha256 = crypto.createHash('sha256').update(Buffer.from(contents)).digest('hex');
+  const signedAt = now.toISOString();
+  return {
+    algorithm: 'ed25519',
+    keyId: getKeyId(privateKey),
+    sha256,
+    signedAt,
+    signature: crypto.sign(null, buildSignedMessage(key, sha256, signedAt), privateKey).toString('base64'),
+  };
+}
+
+/**
+ * Verifies the contents of an archived file against its signature.
+ *
+ * @param {String} key the key of the file
+ * @param {*} contents the contents of the file
+ * @param {Object} signature the signature, see `signContents()`
+ * @param {KeyObject} publicKey the ed25519 public key
+ * @return {String} the problem, or null if the file is as it was signed
+ */
+function verifyContents(key, contents, signature, publicKey) {
+  if (signature.keyId !== getKeyId(publicKey)) {
+    return `signed with another key (${signature.keyId})`;
+  }
+  if (crypto.createHash('sha256').update(Buffer.from(contents)).digest('hex') !== signature.sha256) {
+    return 'the contents changed since they were signed';
+  }
+  try {
+    if (!crypto.verify(null, buildSignedMessage(key, signature.sha256, signature.signedAt), publicKey, Buffer.from(signature.signature, 'base64'))) {
+      return 'the signature doesn\'t match';
+    }
+  } catch (e) {
+    return `the signature is invalid: ${e.message}`;
+  }
+  return null;
+}
+
+/**
+ * Signs the archived files of a version (e.g. the schedule snapshot, the
+ * screenshot, and the preview), storing each signature at `<key>.sig`.
+ *
+ * @async
+ * @param {Array} keys the keys of the archived files
+ * @param {Object} store the storage that the archive is kept in
+ * @param {KeyObject} privateKey the ed25519 private key, or null if the archive isn't signed
+ * @param {Date} now the time of the signatures
+ * @return {Array} the keys that were signed
+ */
+async function signArchivedFiles(keys, store = getStore(), privateKey = loadSigningKey(), now = new Date()) {
+  if (!privateKey) {
+    return [];
+  }
+  const signed = [];
+  for (const key of keys) {
+    const contents = await store.download(key);
+    if (contents === null) {
+      continue;
+    }
+    await store.upload(`${key}.sig`, JSON.stringify(signContents(key, contents, privateKey, now)));
+    signed.push(key);
+  }
+  return signed;
+}
+
+/**
+ * Verifies every file in the team's archive against its signature.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the archive is kept in
+ * @param {KeyObject} publicKey the ed25519 public key
+ * @return {Array} list of `{key, status, detail}`, where the status is `verified`, `tampered`, or `unsigned`
+ */
+async function verifyArchive(prefix, store = getStore(), publicKey = loadVerifyKey()) {
+  const files = await store.list(`${prefix}/archive/`);
+  const keys = new Set(files.map((file) => file.key));
+  const results = [];
+  for (const key of [...keys].filter((key) => !key.endsWith('.sig')).sort()) {
+    if (!keys.has(`${key}.sig`)) {
+      results.push({key, status: 'unsigned', detail: null});
+      continue;
+    }
+    let detail;
+    try {
+      detail = verifyContents(key, await store.download(key), JSON.parse(await store.download(`${key}.sig`)), publicKey);
+    } catch (e) {
+      detail = `the signature can't be read: ${e.message}`;
+    }
+    results.push({key, status: detail ? 'tampered' : 'verified', detail});
+  }
+  // A signature without its file means that the file was deleted
+  for (const key of [...keys].filter((key) => key.endsWith('.sig') && !keys.has(key.slice(0, -4))).sort()) {
+    results.push({key: key.slice(0, -4), status: 'tampered', detail: 'the file was deleted'});
+  }
+  return results;
+}
+
+module.exports = {
+  loadSigningKey,
+  loadVerifyKey,
+  getKeyId,
+  signContents,
+  verifyContents,
+  signArchivedFiles,
+  verifyArchive,
+};
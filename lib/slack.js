@@ -0,0 +1,220 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const config = require('../config');
+const {logger} = require('./logger');
+const {describeAltTextEntry} = require('./summary');
+
+// Slack rejects section texts longer than this
+const SECTION_MAX_LENGTH = 3000;
+
+const SECTION_TITLES = {added: 'Added', modified: 'Modified', deleted: 'Removed'};
+
+/**
+ * Retrieves where the team's updates are posted in Slack: the team's
+ * `slack` in `TEAMS`, either `{"botToken": "xoxb-...", "channel": "C0123456789"}`
+ * or `{"webhookUrl": "https://hooks.slack.com/services/..."}`, or else the
+ * `SLACK_BOT_TOKEN` and `SLACK_CHANNEL`, or the `SLACK_WEBHOOK_URL`. With a
+ * bot, the screenshot is uploaded along with the message. With an incoming
+ * webhook, which can't upload files, the message links to the screenshot.
+ *
+ * @param {Object} team the team
+ * @return {Object} `{botToken, channel}` or `{webhookUrl}`, or null if Slack isn't configured for the team
+ */
+function getSlackSettings(team) {
+  const settings = (team && team.slack) || {};
+  const botToken = settings.botToken || (settings.webhookUrl ? null : config.slack_bot_token);
+  const channel = settings.channel || config.slack_channel;
+  if (botToken && channel) {
+    return {botToken, channel};
+  }
+  const webhookUrl = settings.webhookUrl || config.slack_webhook_url;
+  return webhookUrl ? {webhookUrl} : null;
+}
+
+/**
+ * Escapes the text for Slack's `mrkdwn`.
+ *
+ * @param {String} text the text
+ * @return {String} the escaped text
+ */
+function escapeMrkdwn(text) {
+  return `${text}`.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
+}
+
+/**
+ * Lists the changes of the given type, one bullet per entry, with the
+ * previous version of modified entries struck through, e.g.
+ * `• ~Practice Sat 10/7 3:00-5:30 at Warren~ → Practice Sat 10/7 3:30-5:30 at Warren`.
+ * The bullets that don't fit in a section are only counted.
+ *
+ * @param {String} type one of `added`, `modified`, or `deleted`
+ * @param {Object} scheduleDiff the output of a differ, along with the `previousSchedule`
+ * @return {String} the `mrkdwn` text of the section, or null if there are no such changes
+ */
+function buildSectionText(type, scheduleDiff) {
+  const bullets = [...scheduleDiff[type].entries()].map(([key, entry]) => {
+    const description = escapeMrkdwn(describeAltTextEntry(entry));
+    if (type === 'deleted') {
+      return `• ~${description}~`;
+    }
+    const previous = type === 'modified' && scheduleDiff.previousSchedule && scheduleDiff.previousSchedule.get(key);
+    return previous ? `• ~${escapeMrkdwn(describeAltTextEntry(previous))}~ → ${description}` : `• ${description}`;
+  });
+  if (!bullets.length) {
+    return null;
+  }
+  const heading = `*${SECTION_TITLES[type]}*`;
+  for (let count = bullets.length; count > 0; count--) {
+    const more = count < bullets.length ? `\n+${bullets.length - count} more` : '';
+    const text = `${heading}\n${bullets.slice(0, count).join('\n')}${more}`;
+    if (text.length <= SECTION_MAX_LENGTH) {
+      return text;
+    }
+  }
+  return `${heading}\n${bullets.length} changes`;
+}
+
+/**
+ * Builds the Block Kit message for the changes: a header, the summary, a
+ * section each for the added, modified, and removed entries, the
+ * screenshot (when it's linked rather than uploaded), and the link to the
+ * schedule.
+ *
+ * @param {String} title the title, e.g. `Bandits 12U schedule update`
+ * @param {String} summary the summary of the changes
+ * @param {Object} scheduleDiff the output of a differ, along with the `previousSchedule`
+ * @param {String} link the link to the schedule
+ * @param {String} imageUrl the URL of the screenshot, or null when it's uploaded
+ * @param {String} altText the alt text of the screenshot
+ * @return {Object} the message, i.e. `{text, blocks}`, where the text is the fallback for notifications
+ */
+function buildSlackMessage(title, summary, scheduleDiff, link, imageUrl = null, altText = '') {
+  const blocks = [
+    {type: 'header', text: {type: 'plain_text', text: title.slice(0, 150)}},
+    {type: 'section', text: {type: 'mrkdwn', text: escapeMrkdwn(summary)}},
+  ];
+  for (const type of ['added', 'modified', 'deleted']) {
+    const text = buildSectionText(type, scheduleDiff);
+    if (text) {
+      blocks.push({type: 'section', text: {type: 'mrkdwn', text}});
+    }
+  }
+  if (imageUrl) {
+    blocks.push({type: 'image', image_url: imageUrl, alt_text: (altText || title).slice(0, 2000)});
+  }
+  blocks.push({type: 'context', elements: [{type: 'mrkdwn', text: `<${link}|View the schedule>`}]});
+  return {text: `${title}: ${summary}`, blocks};
+}
+
+/**
+ * Calls a method of the Slack Web API with the bot token.
+ *
+ * @async
+ * @param {String} method the method, e.g. `chat.postMessage`
+ * @param {Object} params the parameters, sent as a form
+ * @param {String} botToken the bot token
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Object} the response
+ */
+async function callSlackApi(method, params, botToken, signal = undefined, http = axios) {
+  const body = new URLSearchParams(Object.entries(params).map(([name, value]) => [name, typeof value === 'string' ? value : JSON.stringify(value)])).toString();
+  const result = await http.post(`https://slack.com/api/${method}`, body, {
+    headers: {'Authorization': `Bearer ${botToken}`, 'content-type': 'application/x-www-form-urlencoded'},
+    signal,
+  });
+  if (!result.data || !result.data.ok) {
+    throw new Error(`${method} failed: ${(result.data && result.data.error) || result.status}`);
+  }
+  return result.data;
+}
+
+/**
+ * Uploads the screenshot and shares it to the channel, with the external
+ * upload flow of the Slack Web API.
+ *
+ * @async
+ * @param {Buffer} imageBuffer the binary contents of the screenshot
+ * @param {String} channelId the id of the channel
+ * @param {String} title the title of the file
+ * @param {String} altText the alt text of the screenshot
+ * @param {String} botToken the bot token
+ * @param {AbortSignal} signal the signal that cancels the requests
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {String} the id of the file
+ */
+async function uploadScreenshot(imageBuffer, channelId, title, altText, botToken, signal = undefined, http = axios) {
+  const upload = await callSlackApi('files.getUploadURLExternal', {filename: 'schedule.png', length: `${imageBuffer.length}`, ...(altText ? {alt_txt: altText.slice(0, 1000)} : {})}, botToken, signal, http);
+  await http.post(upload.upload_url, Buffer.from(imageBuffer), {headers: {'content-type': 'image/png'}, signal});
+  await callSlackApi('files.completeUploadExternal', {files: [{id: upload.file_id, title}], channel_id: channelId}, botToken, signal, http);
+  return upload.file_id;
+}
+
+/**
+ * Posts the changes to the team's Slack channel: the Block Kit message,
+ * followed by the screenshot with a bot, or with the screenshot linked in
+ * the message with an incoming webhook.
+ *
+ * @async
+ * @param {Buffer} imageBuffer the screenshot
+ * @param {Object} message the message, see `buildSlackMessage()`
+ * @param {Object} settings where to post, see `getSlackSettings()`
+ * @param {String} title the title of the screenshot
+ * @param {String} altText the alt text of the screenshot
+ * @param {AbortSignal} signal the signal that cancels the requests
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Object} `{channel, ts}` of the message (or `{}` with a webhook), or null on failure
+ */
+async function postToSlackChannel(imageBuffer, message, settings, title, altText = '', signal = undefined, http = axios) {
+  try {
+    if (settings.webhookUrl) {
+      const result = await http.post(settings.webhookUrl, message, {headers: {'content-type': 'application/json'}, signal});
+      return result.status === 200 ? {} : null;
+    }
+    const posted = await callSlackApi('chat.postMessage', {channel: settings.channel, text: message.text, blocks: message.blocks, unfurl_links: 'false'}, settings.botToken, signal, http);
+    if (imageBuffer) {
+      await uploadScreenshot(imageBuffer, posted.channel, title, altText, settings.botToken, signal, http);
+    }
+    return {channel: posted.channel, ts: posted.ts};
+  } catch (e) {
+    signal?.throwIfAborted();
+    // The webhook URL is a secret, so only the message is logged
+    logger.error(`Unable to post to Slack: ${e.message}`);
+  }
+  return null;
+}
+
+/**
+ * Checks that the bot tokens that the teams' updates are posted with still
+ * work, without posting anything. Incoming webhooks can't be checked
+ * without posting, so they're only counted.
+ *
+ * @async
+ * @param {Array} teams the configured teams
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {String} the bots and the # of webhooks
+ */
+async function checkSlack(teams = config.teams, http = axios) {
+  const settings = [...teams.map(getSlackSettings), getSlackSettings(null)].filter((candidate) => candidate);
+  const tokens = [...new Set(settings.filter((candidate) => candidate.botToken).map((candidate) => candidate.botToken))];
+  const webhooks = new Set(settings.filter((candidate) => candidate.webhookUrl).map((candidate) => candidate.webhookUrl));
+  const details = [];
+  for (const token of tokens) {
+    const result = await callSlackApi('auth.test', {}, token, undefined, http);
+    details.push(`${result.user} in ${result.team}`);
+  }
+  if (webhooks.size) {
+    details.push(`${webhooks.size} webhook${webhooks.size === 1 ? '' : 's'}`);
+  }
+  return details.join(', ');
+}
+
+module.exports = {
+  getSlackSettings,
+  escapeMrkdwn,
+  buildSectionText,
+  buildSlackMessage,
+  uploadScreenshot,
+  postToSlackChannel,
+  checkSlack,
+};
@@ -0,0 +1,95 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const config = require('../config');
+const {AWS} = require('./aws');
+const {raceAbort} = require('./abort');
+const {logger} = require('./logger');
+
+/**
+ * Sends a text message through AWS SNS.
+ *
+ * @async
+ * @param {String} phoneNumber the E.164 formatted phone number, e.g. `+16175551234`
+ * @param {String} message the text of the message
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @return {String} the SNS message id, or null on failure
+ */
+async function sendSmsViaSns(phoneNumber, message, signal = undefined) {
+  const sns = new AWS.SNS({apiVersion: '2010-03-31'});
+  try {
+    const request = sns.publish({
+      PhoneNumber: phoneNumber,
+      Message: message,
+      MessageAttributes: {
+        'AWS.SNS.SMS.SMSType': {DataType: 'String', StringValue: 'Transactional'},
+      },
+    });
+    signal?.addEventListener('abort', () => request.abort(), {once: true});
+    const result = await raceAbort(request.promise(), signal);
+    return result.MessageId;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Sends a text message through the Twilio Messages API.
+ *
+ * @async
+ * @param {String} phoneNumber the E.164 formatted phone number, e.g. `+16175551234`
+ * @param {String} message the text of the message
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @return {String} the Twilio message sid, or null on failure
+ */
+async function sendSmsViaTwilio(phoneNumber, message, signal = undefined) {
+  try {
+    const result = await axios.post(`/2010-04-01/Accounts/${config.twilio_account_sid}/Messages.json`,
+        new URLSearchParams({
+          To: phoneNumber,
+          From: config.twilio_from_number,
+          Body: message,
+        }).toString(),
+        {
+          baseURL: 'https://api.twilio.com',
+          auth: {
+            username: config.twilio_account_sid,
+            password: config.twilio_auth_token,
+          },
+          headers: {'content-type': 'application/x-www-form-urlencoded'},
+          signal,
+        });
+    if (result.status !== 201) {
+      return null;
+    }
+    return result.data.sid;
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Sends the text message to every configured phone number, using the
+ * configured SMS provider (`sns` or `twilio`).
+ *
+ * @async
+ * @param {String} message the text of the message
+ * @param {AbortSignal} signal the signal that cancels the requests
+ * @return {Array} the message ids (null for any that failed), one per phone number
+ */
+async function sendSms(message, signal = undefined) {
+  const send = config.sms_provider === 'twilio' ? sendSmsViaTwilio : sendSmsViaSns;
+  const results = [];
+  for (const phoneNumber of config.sms_phone_numbers) {
+    signal?.throwIfAborted(); // don't start texting anyone else once cancelled
+    results.push(await send(phoneNumber, message, signal));
+  }
+  return results;
+}
+
+module.exports = {
+  sendSmsViaSns,
+  sendSmsViaTwilio,
+  sendSms,
+};
@@ -0,0 +1,293 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {logger} = require('./logger');
+const {getTeamSeasonMetadata} = require('./season');
+
+// The tables that mirror the state, for ad-hoc queries
+const SCHEMA = `
+CREATE TABLE IF NOT EXISTS schedules (
+  team_id TEXT NOT NULL,
+  captured_at TEXT NOT NULL,
+  key TEXT NOT NULL,
+  day_of_week TEXT,
+  day_of_month TEXT,
+  location TEXT,
+  time_block TEXT,
+  start TEXT,
+  end TEXT,
+  season TEXT,
+  age_group TEXT
+);
+CREATE TABLE IF NOT EXISTS diffs (
+  team_id TEXT NOT NULL,
+  detected_at TEXT NOT NULL,
+  key TEXT NOT NULL,
+  change TEXT NOT NULL,
+  category TEXT,
+  severity TEXT,
+  previous_location TEXT,
+  previous_time_block TEXT,
+  location TEXT,
+  time_block TEXT,
+  season TEXT,
+  age_group TEXT
+);
+CREATE TABLE IF NOT EXISTS runs (
+  team_id TEXT NOT NULL,
+  ran_at TEXT NOT NULL,
+  changes INTEGER NOT NULL,
+  severity TEXT,
+  channels TEXT,
+  season TEXT,
+  age_group TEXT
+);
+CREATE INDEX IF NOT EXISTS schedules_team ON schedules (team_id, captured_at);
+CREATE INDEX IF NOT EXISTS diffs_team ON diffs (team_id, detected_at);
+CREATE INDEX IF NOT EXISTS runs_team ON runs (team_id, ran_at);
+`;
+
+// The columns added since the tables were first created, which the
+// databases created before them are migrated to
+const ADDED_COLUMNS = {
+  schedules: ['season TEXT', 'age_group TEXT'],
+  diffs: ['season TEXT', 'age_group TEXT'],
+  runs: ['season TEXT', 'age_group TEXT'],
+};
+
+/**
+ * Loads the SQLite driver. It's optional, so that the default (S3) setup
+ * doesn't need to build it.
+ *
+ * @return {Function} the `better-sqlite3` Database constructor
+ */
+function loadDriver() {
+  try {
+    return require('better-sqlite3');
+  } catch (e) {
+    throw new Error('The SQLite state requires the better-sqlite3 package, i.e. `npm install better-sqlite3`');
+  }
+}
+
+/**
+ * Adds the columns that the tables of an older database are missing.
+ *
+ * @param {Object} db the database
+ */
+function migrateSchema(db) {
+  for (const [table, columns] of Object.entries(ADDED_COLUMNS)) {
+    const existing = new Set(db.prepare(`PRAGMA table_info(${table})`).all().map((column) => column.name));
+    for (const column of columns.filter((definition) => !existing.has(definition.split(' ')[0]))) {
+      db.exec(`ALTER TABLE ${table} ADD COLUMN ${column}`);
+    }
+  }
+}
+
+/**
+ * Converts the schedule into rows of the `schedules` table.
+ *
+ * @param {String} teamId the team id
+ * @param {Map} schedule the schedule
+ * @param {Date} now when the schedule was captured
+ * @param {Object} metadata the season and age group of the team, see `getSeasonMetadata()`
+ * @return {Array} the rows
+ */
+function getScheduleRows(teamId, schedule, now = new Date(), metadata = getTeamSeasonMetadata(teamId)) {
+  const rows = [];
+  for (const [key, entry] of schedule) {
+    rows.push({
+      team_id: teamId,
+      captured_at: now.toISOString(),
+      key,
+      day_of_week: entry.dayOfWeek,
+      day_of_month: entry.dayOfMonth,
+      location: entry.location,
+      time_block: entry.timeBlock,
+      start: entry.parsed ? new Date(entry.parsed.start).toISOString() : null,
+      end: entry.parsed ? new Date(entry.parsed.end).toISOString() : null,
+      season: metadata ? metadata.season : null,
+      age_group: metadata ? metadata.ageGroup : null,
+    });
+  }
+  return rows;
+}
+
+/**
+ * Converts the schedule differences into rows of the `diffs` table.
+ *
+ * @param {String} teamId the team id
+ * @param {Object} scheduleDiff the differences, see `diffSchedule()`
+ * @param {Object} classification the classification, see `classifyChanges()`
+ * @param {Date} now when the differences were detected
+ * @param {Object} metadata the season and age group of the team, see `getSeasonMetadata()`
+ * @return {Array} the rows
+ */
+function getDiffRows(teamId, scheduleDiff, classification = {changes: []}, now = new Date(), metadata = getTeamSeasonMetadata(teamId)) {
+  const rows = [];
+  const previousSchedule = scheduleDiff.previousSchedule || new Map();
+  for (const change of ['added', 'deleted', 'modified']) {
+    for (const [key, entry] of scheduleDiff[change]) {
+      const classified = classification.changes.find((item) => item.key === key) || {};
+      const previous = change === 'added' ? null : (previousSchedule.get(key) || (change === 'deleted' ? entry : null));
+      const current = change === 'deleted' ? null : entry;
+      rows.push({
+        team_id: teamId,
+        detected_at: now.toISOString(),
+        key,
+        change,
+        category: classified.category || null,
+        severity: classified.severity || null,
+        previous_location: previous ? previous.location : null,
+        previous_time_block: previous ? previous.timeBlock : null,
+        location: current ? current.location : null,
+        time_block: current ? current.timeBlock : null,
+        season: metadata ? metadata.season : null,
+        age_group: metadata ? metadata.ageGroup : null,
+      });
+    }
+  }
+  return rows;
+}
+
+/**
+ * Inserts the rows into the table, in one transaction.
+ *
+ * @param {Object} db the database
+ * @param {String} table the table
+ * @param {Array} rows the rows, with the same columns
+ */
+function insertRows(db, table, rows) {
+  if (!rows.length) {
+    return;
+  }
+  const columns = Object.keys(rows[0]);
+  const statement = db.prepare(`INSERT INTO ${table} (${columns.join(', ')}) VALUES (${columns.map((column) => `@${column}`).join(', ')})`);
+  db.transaction((items) => items.forEach((item) => statement.run(item)))(rows);
+}
+
+/**
+ * Mirrors the schedules, differences, and run history into an embedded
+ * SQLite database, for ad-hoc queries (see `npm run query`). S3 (or the
+ * configured storage) remains the source of truth, so failures are logged
+ * rather than failing the run.
+ *
+ * @class SqliteMirror
+ * @typedef {SqliteMirror}
+ */
+class SqliteMirror {
+  /**
+   * Creates an instance of SqliteMirror, creating (or migrating) the tables
+   * if needed.
+   *
+   * @constructor
+   * @param {String} filename the path of the database file
+   * @param {Function} Database the `better-sqlite3` Database constructor
+   */
+  constructor(filename = config.sqlite_path, Database = loadDriver()) {
+    this.db = new Database(filename);
+    this.db.exec(SCHEMA);
+    migrateSchema(this.db);
+  }
+
+  /**
+   * Records the schedule as captured.
+   *
+   * @param {String} teamId the team id
+   * @param {Map} schedule the schedule
+   * @param {Date} now when the schedule was captured
+   */
+  recordSchedule(teamId, schedule, now = new Date()) {
+    try {
+      insertRows(this.db, 'schedules', getScheduleRows(teamId, schedule, now));
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+
+  /**
+   * Records the schedule differences.
+   *
+   * @param {String} teamId the team id
+   * @param {Object} scheduleDiff the differences, see `diffSchedule()`
+   * @param {Object} classification the classification, see `classifyChanges()`
+   * @param {Date} now when the differences were detected
+   */
+  recordDiff(teamId, scheduleDiff, classification, now = new Date()) {
+    try {
+      insertRows(this.db, 'diffs', getDiffRows(teamId, scheduleDiff, classification, now));
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+
+  /**
+   * Records the run.
+   *
+   * @param {String} teamId the team id
+   * @param {Integer} changes the # of changed entries
+   * @param {String} severity the severity of the changes, if any
+   * @param {Array} channels the channels that were notified
+   * @param {Date} now when the run happened
+   */
+  recordRun(teamId, changes, severity = null, channels = [], now = new Date()) {
+    try {
+      const metadata = getTeamSeasonMetadata(teamId);
+      insertRows(this.db, 'runs', [{team_id: teamId, ran_at: now.toISOString(), changes, severity, channels: channels.join(','), season: metadata ? metadata.season : null, age_group: metadata ? metadata.ageGroup : null}]);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+
+  /**
+   * Closes the database.
+   */
+  close() {
+    this.db.close();
+  }
+}
+
+/**
+ * Runs a read-only query against the database, e.g.
+ * `SELECT key, location FROM diffs WHERE change = 'modified'`.
+ *
+ * @param {String} sql the query
+ * @param {String} filename the path of the database file
+ * @param {Function} Database the `better-sqlite3` Database constructor
+ * @return {Array} the rows
+ */
+function queryState(sql, filename = config.sqlite_path, Database = loadDriver()) {
+  const db = new Database(filename, {readonly: true, fileMustExist: true});
+  try {
+    const statement = db.prepare(sql);
+    if (!statement.reader) {
+      throw new Error('Only queries that return rows (e.g. SELECT) are supported');
+    }
+    return statement.all();
+  } finally {
+    db.close();
+  }
+}
+
+let mirror = null;
+
+/**
+ * Retrieves the SQLite mirror, opening it on first use.
+ *
+ * @return {SqliteMirror} the mirror, or null if SQLite isn't configured
+ */
+function getSqliteMirror() {
+  if (!config.sqlite_path) {
+    return null;
+  }
+  if (!mirror) {
+    mirror = new SqliteMirror(config.sqlite_path);
+  }
+  return mirror;
+}
+
+module.exports = {
+  getScheduleRows,
+  getDiffRows,
+  SqliteMirror,
+  queryState,
+  getSqliteMirror,
+};
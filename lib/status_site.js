@@ -0,0 +1,174 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {deserializeSchedule, compareSchedules, getEntryDate} = require('./helper_functions');
+const {listScheduleSnapshots} = require('./timeline');
+const {getSnapshotScreenshotKey} = require('./history');
+const {resolveScreenshotKey} = require('./screenshot_archive');
+const {listChangeItems} = require('./summary');
+const {escapeHtml} = require('./image');
+const {uploadWebsiteFileToS3} = require('./aws');
+const {logger} = require('./logger');
+const {formatTimestamp} = require('./format');
+
+/**
+ * Uploads a file of the status site to the `STATUS_SITE_BUCKET`.
+ *
+ * @async
+ * @param {String} key the key of the file, including the `STATUS_SITE_PREFIX`
+ * @param {*} contents the contents of the file
+ * @param {String} contentType the content type that it's served with
+ * @return {Boolean} true if the upload succeeded
+ */
+async function uploadStatusFile(key, contents, contentType) {
+  return (await uploadWebsiteFileToS3(contents, key, contentType, config.status_site_bucket)) !== null;
+}
+
+/**
+ * Builds the change log of the team from the archived schedules, i.e. the
+ * changes between each snapshot and the one before it.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the archive is kept in
+ * @param {Integer} maxChanges the max # of changes to list
+ * @return {Array} list of `{timestamp, items}`, newest first, where the items describe the changes (see `listChangeItems()`)
+ */
+async function getChangeLog(prefix, store = getStore(), maxChanges = config.status_site_changes) {
+  const snapshots = (await listScheduleSnapshots(prefix, store)).slice(-(maxChanges + 1));
+  const changeLog = [];
+  let previousSchedule = null;
+  for (const snapshot of snapshots) {
+    const schedule = await deserializeSchedule(snapshot.key, store, snapshot.timestamp);
+    if (previousSchedule) {
+      const items = listChangeItems({...compareSchedules(previousSchedule, schedule), previousSchedule}, snapshot.timestamp);
+      if (items.length) {
+        changeLog.unshift({timestamp: snapshot.timestamp, items});
+      }
+    }
+    previousSchedule = schedule;
+  }
+  return changeLog;
+}
+
+/**
+ * Builds the status page of the team: the current schedule, when it last
+ * changed, the latest screenshot, and the recent changes, so that families
+ * without Twitter can bookmark it.
+ *
+ * @param {Object} team the team
+ * @param {Object} latest the latest snapshot, i.e. `{timestamp, schedule, hasScreenshot}`
+ * @param {Array} changeLog the recent changes, see `getChangeLog()`
+ * @param {Date} now the time the page is published
+ * @param {String} timeZone the time zone that the dates are displayed in
+ * @return {String} the HTML page
+ */
+function buildStatusPageHtml(team, latest, changeLog, now = new Date(), timeZone = config.display_time_zone) {
+  const format = (date) => formatTimestamp(date, timeZone);
+  const title = `${team.name || team.id} schedule`;
+  const entries = [...latest.schedule.values()].sort((a, b) => (getEntryDate(a.dayOfMonth) || 0) - (getEntryDate(b.dayOfMonth) || 0));
+  const tableRows = entries.map((entry) => `      <tr><td class="day">${escapeHtml(`${entry.dayOfWeek} ${entry.dayOfMonth}`)}</td><td>${escapeHtml(entry.location || '')}</td><td class="time">${escapeHtml(entry.timeBlock || '')}</td></tr>`);
+  const changes = changeLog.map((change) => `      <li><strong>${escapeHtml(format(change.timestamp))}</strong>: ${change.items.map(escapeHtml).join('; ')}</li>`);
+  return `<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1" />
+    <title>${escapeHtml(title)}</title>
+    <style>
+      body { font-family: Helvetica, Arial, sans-serif; max-width: 640px; margin: 20px auto; padding: 0 12px; }
+      table { width: 100%; border-collapse: collapse; font-size: 14px; margin: 12px 0; }
+      td { padding: 6px 8px; border-bottom: 1px solid #e0e0e0; vertical-align: top; }
+      .day { font-weight: bold; white-space: nowrap; }
+      .time { white-space: nowrap; text-align: right; }
+      li { margin: 6px 0; font-size: 14px; }
+      img { max-width: 100%; border: 1px solid #e0e0e0; }
+      footer { color: #999999; font-size: 12px; }
+    </style>
+  </head>
+  <body>
+    <h1>${escapeHtml(title)}</h1>
+    <p>Last changed ${escapeHtml(format(latest.timestamp))}. See the <a href="${escapeHtml(team.url)}">team's page</a> for the details.</p>
+    <table>
+${tableRows.length ? tableRows.join('\n') : '      <tr><td>Nothing scheduled</td></tr>'}
+    </table>${latest.hasScreenshot ? '\n    <img src="screenshot.png" alt="Screenshot of the schedule page" />' : ''}
+    <h2>Recent changes</h2>
+${changes.length ? `    <ul>\n${changes.join('\n')}\n    </ul>` : '    <p>No changes yet.</p>'}
+    <footer>Updated ${escapeHtml(format(now))}</footer>
+  </body>
+</html>`;
+}
+
+/**
+ * Builds the index of the status site, linking to each team's page.
+ *
+ * @param {Array} teams the configured teams
+ * @return {String} the HTML page
+ */
+function buildSiteIndexHtml(teams) {
+  const links = teams.map((team) => `      <li><a href="${encodeURIComponent(team.id)}/">${escapeHtml(team.name || team.id)}</a></li>`);
+  return `<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8" />
+    <meta name="viewport" content="width=device-width, initial-scale=1" />
+    <title>Schedules</title>
+    <style>
+      body { font-family: Helvetica, Arial, sans-serif; max-width: 640px; margin: 20px auto; padding: 0 12px; }
+    </style>
+  </head>
+  <body>
+    <h1>Schedules</h1>
+    <ul>
+${links.join('\n')}
+    </ul>
+  </body>
+</html>`;
+}
+
+/**
+ * Publishes the team's status page, with its latest screenshot, and the
+ * index of the teams, to the status site (`<prefix><team id>/index.html`).
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {Object} store the storage that the archive is kept in
+ * @param {Array} teams the configured teams, for the index
+ * @param {Function} upload uploads a file, see `uploadStatusFile()`
+ * @param {Date} now the current date
+ * @return {Object} the keys that were `published` and that `failed`, or null if nothing has been archived for the team yet
+ */
+async function publishStatusSite(team, store = getStore(), teams = config.teams, upload = uploadStatusFile, now = new Date()) {
+  const snapshots = await listScheduleSnapshots(team.id, store);
+  if (!snapshots.length) {
+    return null;
+  }
+  const snapshot = snapshots[snapshots.length - 1];
+  const screenshotKey = await resolveScreenshotKey(getSnapshotScreenshotKey(snapshot.key), store);
+  const screenshot = screenshotKey ? await store.download(screenshotKey) : null;
+  const latest = {timestamp: snapshot.timestamp, schedule: await deserializeSchedule(snapshot.key, store, snapshot.timestamp), hasScreenshot: !!screenshot};
+  const teamPrefix = `${config.status_site_prefix}${team.id}/`;
+  const files = [];
+  if (screenshot) {
+    files.push({key: `${teamPrefix}screenshot.png`, contents: screenshot, contentType: 'image/png'});
+  }
+  files.push({key: `${teamPrefix}index.html`, contents: buildStatusPageHtml(team, latest, await getChangeLog(team.id, store), now), contentType: 'text/html; charset=utf-8'});
+  files.push({key: `${config.status_site_prefix}index.html`, contents: buildSiteIndexHtml(teams), contentType: 'text/html; charset=utf-8'});
+  const result = {published: [], failed: []};
+  for (const file of files) {
+    if (await upload(file.key, file.contents, file.contentType)) {
+      result.published.push(file.key);
+    } else {
+      logger.warn(`Unable to publish ${file.key} to the status site`);
+      result.failed.push(file.key);
+    }
+  }
+  return result;
+}
+
+module.exports = {
+  getChangeLog,
+  buildStatusPageHtml,
+  buildSiteIndexHtml,
+  publishStatusSite,
+};
@@ -0,0 +1,339 @@
+/* eslint-disable max-len */
+const fs = require('fs');
+const path = require('path');
+const config = require('../config');
+const {
+  uploadFileToS3,
+  getFileFromS3,
+  listFilesInS3,
+  existsInS3,
+  deleteFileFromS3,
+  createFileInS3,
+  listFileVersionsInS3,
+  getFileVersionFromS3,
+  getSignedUrlForS3,
+} = require('./aws');
+const {DynamoStore} = require('./dynamodb');
+const {PostgresStore} = require('./postgres');
+const {logger} = require('./logger');
+
+/**
+ * Storage backed by an AWS S3 bucket. This is the default storage.
+ *
+ * @class S3Store
+ * @typedef {S3Store}
+ */
+class S3Store {
+  /**
+   * Uploads the contents to the given key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to upload to
+   * @param {*} contents the contents of the file
+   * @return {Boolean} true if the upload succeeded
+   */
+  async upload(key, contents) {
+    return (await uploadFileToS3(contents, key)) !== null;
+  }
+
+  /**
+   * Downloads the contents of the given key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to download
+   * @return {Buffer} the contents, or null if the key doesn't exist
+   */
+  async download(key) {
+    return await getFileFromS3(key);
+  }
+
+  /**
+   * Checks whether the given key exists.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to check
+   * @return {Boolean} true if the key exists
+   */
+  async exists(key) {
+    return await existsInS3(key);
+  }
+
+  /**
+   * Deletes the given key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to delete
+   * @return {Boolean} true if the key was deleted
+   */
+  async delete(key) {
+    return await deleteFileFromS3(key);
+  }
+
+  /**
+   * Uploads the contents to the given key, unless the key already exists.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to create
+   * @param {*} contents the contents of the file
+   * @return {Boolean} true if the key was created, false if it already exists
+   */
+  async create(key, contents) {
+    return await createFileInS3(contents, key);
+  }
+
+  /**
+   * Lists all of the keys that start with the prefix.
+   *
+   * @async
+   * @param {String} prefix the prefix of the keys to list
+   * @return {Array} list of objects with `key`, `lastModified`, and `size`
+   */
+  async list(prefix) {
+    const files = await listFilesInS3(prefix);
+    return files.map((file) => ({key: file.Key, lastModified: file.LastModified, size: file.Size}));
+  }
+
+  /**
+   * Lists all of the versions of the key. Requires versioning to be enabled
+   * on the bucket. Only the S3 storage supports versions.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename)
+   * @return {Array} list of objects with `versionId` and `lastModified`, newest first
+   */
+  async listVersions(key) {
+    const versions = await listFileVersionsInS3(key);
+    return versions.map((version) => ({versionId: version.VersionId, lastModified: version.LastModified}));
+  }
+
+  /**
+   * Downloads the contents of a specific version of the key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to download
+   * @param {String} versionId the version to download
+   * @return {Buffer} the contents, or null if the version can't be retrieved
+   */
+  async downloadVersion(key, versionId) {
+    return await getFileVersionFromS3(key, versionId);
+  }
+
+  /**
+   * Generates a signed, expiring URL that the key can be viewed at, without
+   * the bucket being public.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to share
+   * @param {Integer} expiresInSeconds # of seconds until the URL expires
+   * @return {String} the URL, or null if it can't be generated
+   */
+  async getShareUrl(key, expiresInSeconds = config.share_link_ttl) {
+    return await getSignedUrlForS3(key, expiresInSeconds);
+  }
+}
+
+/**
+ * Storage backed by a directory on the local filesystem, where each key maps
+ * to a file path relative to the root directory. Useful for running locally
+ * without AWS credentials, and for tests.
+ *
+ * @class LocalStore
+ * @typedef {LocalStore}
+ */
+class LocalStore {
+  /**
+   * Creates an instance of LocalStore.
+   *
+   * @constructor
+   * @param {String} rootPath the directory that the files are stored under
+   */
+  constructor(rootPath = config.local_storage_path) {
+    this.rootPath = path.resolve(rootPath);
+  }
+
+  /**
+   * Resolves the key into a file path, making sure it stays within the root.
+   *
+   * @param {String} key the key (i.e. filename)
+   * @return {String} the absolute file path
+   */
+  resolve(key) {
+    const filepath = path.resolve(this.rootPath, key);
+    if (filepath !== this.rootPath && !filepath.startsWith(`${this.rootPath}${path.sep}`)) {
+      throw new Error(`Key "${key}" is outside of the storage root`);
+    }
+    return filepath;
+  }
+
+  /**
+   * Uploads the contents to the given key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to upload to
+   * @param {*} contents the contents of the file
+   * @return {Boolean} true if the upload succeeded
+   */
+  async upload(key, contents) {
+    try {
+      const filepath = this.resolve(key);
+      await fs.promises.mkdir(path.dirname(filepath), {recursive: true});
+      await fs.promises.writeFile(filepath, contents);
+    } catch (e) {
+      logger.error(e);
+      return false;
+    }
+    return true;
+  }
+
+  /**
+   * Downloads the contents of the given key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to download
+   * @return {Buffer} the contents, or null if the key doesn't exist
+   */
+  async download(key) {
+    try {
+      return await fs.promises.readFile(this.resolve(key));
+    } catch (e) {
+      if (e.code !== 'ENOENT') {
+        // Only log if it's actually something we need to worry about.
+        logger.error(e);
+      }
+    }
+    return null;
+  }
+
+  /**
+   * Checks whether the given key exists.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to check
+   * @return {Boolean} true if the key exists
+   */
+  async exists(key) {
+    try {
+      return (await fs.promises.stat(this.resolve(key))).isFile();
+    } catch (e) {
+      return false;
+    }
+  }
+
+  /**
+   * Deletes the given key.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to delete
+   * @return {Boolean} true if the key was deleted
+   */
+  async delete(key) {
+    try {
+      await fs.promises.unlink(this.resolve(key));
+    } catch (e) {
+      if (e.code !== 'ENOENT') {
+        logger.error(e);
+      }
+      return false;
+    }
+    return true;
+  }
+
+  /**
+   * Uploads the contents to the given key, unless the key already exists.
+   *
+   * @async
+   * @param {String} key the key (i.e. filename) to create
+   * @param {*} contents the contents of the file
+   * @return {Boolean} true if the key was created, false if it already exists
+   */
+  async create(key, contents) {
+    try {
+      const filepath = this.resolve(key);
+      await fs.promises.mkdir(path.dirname(filepath), {recursive: true});
+      await fs.promises.writeFile(filepath, contents, {flag: 'wx'}); // fails if the file exists
+    } catch (e) {
+      if (e.code !== 'EEXIST') {
+        logger.error(e);
+      }
+      return false;
+    }
+    return true;
+  }
+
+  /**
+   * Lists all of the keys that start with the prefix.
+   *
+   * @async
+   * @param {String} prefix the prefix of the keys to list
+   * @return {Array} list of objects with `key`, `lastModified`, and `size`
+   */
+  async list(prefix = '') {
+    const files = [];
+    const walk = async (directory) => {
+      let entries = [];
+      try {
+        entries = await fs.promises.readdir(directory, {withFileTypes: true});
+      } catch (e) {
+        return; // directory doesn't exist, so there's nothing to list
+      }
+      for (const entry of entries) {
+        const filepath = path.join(directory, entry.name);
+        if (entry.isDirectory()) {
+          await walk(filepath);
+          continue;
+        }
+        const key = path.relative(this.rootPath, filepath).split(path.sep).join('/');
+        if (key.startsWith(prefix)) {
+          const stat = await fs.promises.stat(filepath);
+          files.push({key, lastModified: stat.mtime, size: stat.size});
+        }
+      }
+    };
+    await walk(this.rootPath);
+    return files.sort((a, b) => a.key.localeCompare(b.key));
+  }
+}
+
+/**
+ * Generates a signed, expiring URL that the key can be viewed at, for the
+ * storage backends that support it (i.e. S3).
+ *
+ * @async
+ * @param {Object} store the storage that the key is kept in
+ * @param {String} key the key (i.e. filename) to share
+ * @param {Integer} expiresInSeconds # of seconds until the URL expires
+ * @return {String} the URL, or null if the storage doesn't support sharing
+ */
+async function getShareUrl(store, key, expiresInSeconds = config.share_link_ttl) {
+  if (typeof store.getShareUrl !== 'function') {
+    return null;
+  }
+  return await store.getShareUrl(key, expiresInSeconds);
+}
+
+/**
+ * Retrieves the store for the configured storage backend (`s3`, `local`,
+ * `dynamodb`, or `postgres`).
+ *
+ * @param {String} backend the storage backend, e.g. another one to migrate to
+ * @return {Object} the store
+ */
+function getStore(backend = config.storage_backend) {
+  if (backend === 'local') {
+    return new LocalStore(config.local_storage_path);
+  }
+  if (backend === 'dynamodb') {
+    return new DynamoStore(config.dynamodb_table, new S3Store());
+  }
+  if (backend === 'postgres') {
+    return new PostgresStore();
+  }
+  return new S3Store();
+}
+
+module.exports = {
+  S3Store,
+  LocalStore,
+  getShareUrl,
+  getStore,
+};
@@ -0,0 +1,343 @@
+/* eslint-disable max-len */
+const moment = require('moment-timezone');
+const config = require('../config');
+const {getEntryDate, getScheduledDate, getKeyDayOfMonth, getEventDetails} = require('./helper_functions');
+const {categorizeChange} = require('./severity');
+const {SemanticDiffer} = require('./differ');
+const {getWeightedLength} = require('./content_validator');
+
+// Twitter's limit on the alt text of an image
+const ALT_TEXT_MAX_LENGTH = 1000;
+
+const CHANGE_LIST_ICONS = {
+  added: '➕',
+  deleted: '❌',
+  modified: '✏️',
+};
+
+/**
+ * Describes the kind of event of a schedule entry, i.e. its event type (see
+ * `getEventDetails()`), e.g. `game` for `Game, Downes`.
+ *
+ * @param {Object} entry the schedule entry
+ * @return {String} the kind of event, or `event` when it isn't known
+ */
+function describeKind(entry) {
+  return getEventDetails(entry).eventType || 'event';
+}
+
+/**
+ * Describes the event of a schedule entry, with its opponent when there's
+ * one, e.g. `game vs Tigers` for `Game vs Tigers, Downes` or `game at Lions`
+ * for `Game @ Lions, Larz`.
+ *
+ * @param {Object} entry the schedule entry
+ * @return {String} the event, in lowercase (apart from the opponent)
+ */
+function describeEvent(entry) {
+  const {opponent, homeAway} = getEventDetails(entry);
+  const kind = describeKind(entry);
+  if (!opponent) {
+    return kind;
+  }
+  return `${kind} ${homeAway === 'away' ? 'at' : 'vs'} ${opponent}`;
+}
+
+/**
+ * Describes the place of a schedule entry, e.g. `Downes` for `Game, Downes`.
+ *
+ * @param {Object} entry the schedule entry
+ * @return {String} the place
+ */
+function describePlace(entry) {
+  const parts = `${entry.location}`.split(/, */);
+  return parts.length > 1 ? parts.slice(1).join(', ') : entry.location;
+}
+
+/**
+ * Describes the time of a schedule entry, e.g. `1pm` or `4:30pm`, falling
+ * back to the time block when it couldn't be resolved.
+ *
+ * @param {Object} entry the schedule entry
+ * @return {String} the time
+ */
+function describeTime(entry) {
+  if (!entry.parsed || !entry.parsed.start) {
+    return entry.timeBlock;
+  }
+  const start = moment(entry.parsed.start).tz(config.display_time_zone);
+  return start.format(start.minutes() ? 'h:mma' : 'ha');
+}
+
+/**
+ * Describes the day of a schedule entry, e.g. `Saturday`. The day of the
+ * month is added when the day of the week alone would be ambiguous.
+ *
+ * @param {Object} entry the schedule entry
+ * @param {Boolean} ambiguous true if another change falls on the same day of the week
+ * @return {String} the day
+ */
+function describeDay(entry, ambiguous = false) {
+  const day = `${entry.dayOfWeek.charAt(0)}${entry.dayOfWeek.slice(1).toLowerCase()}`;
+  return ambiguous ? `${day} ${entry.dayOfMonth}` : day;
+}
+
+/**
+ * Describes a single change as a clause, e.g. `Saturday's game moved to 1pm`.
+ * Changes that aren't newsworthy (entries dropping off after they happened,
+ * and text fixes) aren't described.
+ *
+ * @param {String} type one of `added`, `deleted`, or `modified`
+ * @param {Object} previous the previous schedule entry (null when added)
+ * @param {Object} current the current schedule entry (null when deleted)
+ * @param {Boolean} ambiguous true if another change falls on the same day of the week
+ * @param {Date} now the current date
+ * @return {String} the clause, or null if the change isn't newsworthy
+ */
+function describeChange(type, previous, current, ambiguous = false, now = new Date()) {
+  const entry = current || previous;
+  const day = describeDay(entry, ambiguous);
+  switch (categorizeChange(type, previous, current, now)) {
+    case 'newGame':
+      return `${day} ${describeEvent(current)} added at ${describePlace(current)}${current.timeBlock ? `, ${describeTime(current)}` : ''}`;
+    case 'cancellation':
+      return `${day} ${describeEvent(previous || current)} cancelled`;
+    case 'timeChange':
+      return current.timeBlock ? `${day}'s ${describeEvent(current)} moved to ${describeTime(current)}` : `${day}'s ${describeEvent(current)} time removed`;
+    case 'locationChange':
+      if (describePlace(previous) === describePlace(current) && getEventDetails(previous).opponent !== getEventDetails(current).opponent) {
+        return `${day}'s ${describeEvent(current)} (was ${describeEvent(previous)})`;
+      }
+      return `${day}'s ${describeEvent(current)} moved to ${describePlace(current)}`;
+    default:
+      return null;
+  }
+}
+
+/**
+ * Summarizes the changes in one or two sentences, e.g. `Saturday's game moved
+ * to 1pm; Tuesday practice cancelled.` The changes are described in the order
+ * of the schedule, and when there are more than `maxClauses` of them, the
+ * rest are only counted.
+ *
+ * @param {Object} scheduleDiff the output of a differ, along with the `previousSchedule`
+ * @param {Integer} maxClauses the maximum # of changes that are described
+ * @param {Date} now the current date
+ * @return {String} the summary, or null when none of the changes are newsworthy
+ */
+function summarizeInSentences(scheduleDiff, maxClauses = 3, now = new Date()) {
+  const clauses = [];
+  const covered = new Set();
+
+  // Lead with the higher level changes from the semantic differ, if any
+  const semanticDiffer = new SemanticDiffer();
+  for (const change of scheduleDiff.semanticChanges || []) {
+    clauses.push({date: getEntryDate(getKeyDayOfMonth(change.keys[0]), now), text: semanticDiffer.describe(change, scheduleDiff)});
+    change.keys.forEach((key) => covered.add(key));
+  }
+
+  const changes = [];
+  ['added', 'modified', 'deleted'].forEach((type) => {
+    scheduleDiff[type].forEach((value, key) => {
+      if (covered.has(key)) {
+        return;
+      }
+      const previous = type === 'added' ? null : (type === 'deleted' ? value : scheduleDiff.previousSchedule && scheduleDiff.previousSchedule.get(key));
+      const current = type === 'deleted' ? null : value;
+      if (type === 'modified' && !previous) {
+        return;
+      }
+      changes.push({type, previous, current, entry: value});
+    });
+  });
+  const daysOfWeek = changes.map((change) => change.entry.dayOfWeek);
+  for (const change of changes) {
+    const ambiguous = daysOfWeek.filter((dayOfWeek) => dayOfWeek === change.entry.dayOfWeek).length > 1;
+    const text = describeChange(change.type, change.previous, change.current, ambiguous, now);
+    if (text) {
+      clauses.push({date: getScheduledDate(change.entry, now), text});
+    }
+  }
+  if (!clauses.length) {
+    return null;
+  }
+
+  clauses.sort((a, b) => (a.date || 0) - (b.date || 0));
+  const described = clauses.slice(0, maxClauses).map((clause) => clause.text);
+  let summary = `${described.join('; ')}.`;
+  const remaining = clauses.length - described.length;
+  if (remaining > 0) {
+    summary += ` Plus ${remaining} more ${remaining === 1 ? 'change' : 'changes'}.`;
+  }
+  return summary;
+}
+
+/**
+ * Describes a single change as an item of the change list, e.g.
+ * `✏️ Tue 9/9 time changed to 5pm`. Entries dropping off after they
+ * happened aren't listed.
+ *
+ * @param {String} type one of `added`, `deleted`, or `modified`
+ * @param {Object} previous the previous schedule entry (null when added)
+ * @param {Object} current the current schedule entry (null when deleted)
+ * @param {Date} now the current date
+ * @return {String} the item, or null if the change isn't listed
+ */
+function describeListItem(type, previous, current, now = new Date()) {
+  const entry = current || previous;
+  const day = `${entry.dayOfWeek.charAt(0)}${entry.dayOfWeek.slice(1, 3).toLowerCase()} ${entry.dayOfMonth}`;
+  const category = categorizeChange(type, previous, current, now);
+  let description;
+  if (category === 'expired') {
+    return null;
+  } else if (type === 'added') {
+    description = `${describeEvent(current)} added`;
+  } else if (type === 'deleted' || category === 'cancellation') {
+    description = `${describeEvent(previous || current)} cancelled`;
+  } else if (category === 'timeChange') {
+    description = current.timeBlock ? `time changed to ${describeTime(current)}` : 'time removed';
+  } else if (category === 'locationChange') {
+    description = `moved to ${describePlace(current)}`;
+  } else {
+    description = 'updated';
+  }
+  return `${CHANGE_LIST_ICONS[type]} ${day} ${description}`;
+}
+
+/**
+ * Lists the changes as items of the change list (see `describeListItem()`),
+ * in the order of the schedule.
+ *
+ * @param {Object} scheduleDiff the output of a differ, along with the `previousSchedule`
+ * @param {Date} now the current date
+ * @return {Array} the list of items
+ */
+function listChangeItems(scheduleDiff, now = new Date()) {
+  const items = [];
+  ['added', 'modified', 'deleted'].forEach((type) => {
+    scheduleDiff[type].forEach((value, key) => {
+      const previous = type === 'added' ? null : (type === 'deleted' ? value : scheduleDiff.previousSchedule && scheduleDiff.previousSchedule.get(key));
+      if (type === 'modified' && !previous) {
+        return;
+      }
+      const text = describeListItem(type, previous, type === 'deleted' ? null : value, now);
+      if (text) {
+        items.push({date: getScheduledDate(value, now), text});
+      }
+    });
+  });
+  items.sort((a, b) => (a.date || 0) - (b.date || 0));
+  return items.map((item) => item.text);
+}
+
+/**
+ * Splits the change list into the part that fits within the maximum length,
+ * where the changes that don't fit are only counted (e.g. `+2 more`), and
+ * the changes that were left out, grouped into chunks that fit within the
+ * maximum length of a reply.
+ *
+ * @param {Object} scheduleDiff the output of a differ, along with the `previousSchedule`
+ * @param {Integer} maxLength the maximum weighted length of the list
+ * @param {Integer} replyLength the maximum weighted length of each chunk of left out changes
+ * @param {Date} now the current date
+ * @return {Object} Object with the `list` (null if there is nothing to list, or it doesn't fit)
+ * and the `remainder` (list of chunks)
+ */
+function splitChangeList(scheduleDiff, maxLength = Infinity, replyLength = config.post_max_length, now = new Date()) {
+  const items = listChangeItems(scheduleDiff, now);
+  let list = null;
+  let count = items.length;
+  for (; count > 0; count--) {
+    const listed = items.slice(0, count);
+    if (count < items.length) {
+      listed.push(`+${items.length - count} more`);
+    }
+    if (getWeightedLength(listed.join(', ')) <= maxLength) {
+      list = listed.join(', ');
+      break;
+    }
+  }
+
+  const remainder = [];
+  for (const item of items.slice(count)) {
+    const last = remainder.length - 1;
+    if (last >= 0 && getWeightedLength(`${remainder[last]}\n${item}`) <= replyLength) {
+      remainder[last] = `${remainder[last]}\n${item}`;
+    } else {
+      remainder.push(item);
+    }
+  }
+  return {list, remainder};
+}
+
+/**
+ * Formats the changes as a compact list, e.g. `➕ Sat 9/6 practice added,
+ * ✏️ Tue 9/9 time changed to 5pm`, in the order of the schedule. When the
+ * list doesn't fit within the maximum length, the changes that don't fit
+ * are only counted, e.g. `+2 more`.
+ *
+ * @param {Object} scheduleDiff the output of a differ, along with the `previousSchedule`
+ * @param {Integer} maxLength the maximum weighted length of the list
+ * @param {Date} now the current date
+ * @return {String} the list, or null if there is nothing to list (or it doesn't fit)
+ */
+function formatChangeList(scheduleDiff, maxLength = Infinity, now = new Date()) {
+  return splitChangeList(scheduleDiff, maxLength, Infinity, now).list;
+}
+
+/**
+ * Describes a schedule entry for the alt text, e.g.
+ * `Practice Sat 9/6 3:30–6:00 at Warren`.
+ *
+ * @param {Object} entry the schedule entry
+ * @return {String} the description
+ */
+function describeAltTextEntry(entry) {
+  const kind = describeEvent(entry);
+  const day = `${entry.dayOfWeek.charAt(0)}${entry.dayOfWeek.slice(1, 3).toLowerCase()} ${entry.dayOfMonth}`;
+  const place = kind === 'event' ? entry.location : describePlace(entry);
+  return [kind === 'event' ? null : `${kind.charAt(0).toUpperCase()}${kind.slice(1)}`, day, entry.timeBlock, place ? `at ${place}` : null].filter((part) => part).join(' ');
+}
+
+/**
+ * Builds the alt text of the screenshot from the parsed schedule, e.g.
+ * `Bandits 12U schedule: Practice Sat 9/6 3:30–6:00 at Warren, Game Tue 9/9
+ * 5:00 at Downes`, so that the image is accessible to screen readers. The
+ * entries that don't fit are only counted, e.g. `+2 more`.
+ *
+ * @param {Map} schedule the schedule
+ * @param {String} title what the schedule is, e.g. `Bandits 12U schedule`
+ * @param {Integer} maxLength the maximum length of the alt text
+ * @return {String} the alt text
+ */
+function buildAltText(schedule, title, maxLength = ALT_TEXT_MAX_LENGTH) {
+  const entries = [...schedule.values()].sort((a, b) => (getScheduledDate(a) || 0) - (getScheduledDate(b) || 0));
+  if (!entries.length) {
+    return `${title}: nothing scheduled`;
+  }
+  const items = entries.map(describeAltTextEntry);
+  for (let count = items.length; count > 0; count--) {
+    const more = items.length - count;
+    const text = `${title}: ${items.slice(0, count).join(', ')}${more ? `, +${more} more` : ''}`;
+    if (text.length <= maxLength) {
+      return text;
+    }
+  }
+  return `${title}: ${items.length} entries`.slice(0, maxLength);
+}
+
+module.exports = {
+  describeKind,
+  describeEvent,
+  describePlace,
+  describeTime,
+  describeDay,
+  describeChange,
+  summarizeInSentences,
+  describeListItem,
+  listChangeItems,
+  splitChangeList,
+  formatChangeList,
+  describeAltTextEntry,
+  buildAltText,
+};
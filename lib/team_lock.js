@@ -0,0 +1,139 @@
+/* eslint-disable max-len */
+const crypto = require('crypto');
+const config = require('../config');
+const {getStore} = require('./storage');
+const {logger} = require('./logger');
+
+// Held while a run (or a CLI command) is reading and writing the team's state
+const LOCK_FILENAME = 'run.lock';
+
+/**
+ * Loads the team's lock.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ * @return {Object} the lock, see `acquireTeamLock()`, or null if there's none (or it's unreadable)
+ */
+async function loadTeamLock(prefix, store = getStore()) {
+  const data = await store.download(`${prefix}/${LOCK_FILENAME}`);
+  if (data) {
+    try {
+      return JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  return null;
+}
+
+/**
+ * Creates the lock's key, unless it already exists. The stores create it
+ * with a conditional write (an S3 `If-None-Match` put, a DynamoDB
+ * `attribute_not_exists` put, ...), so only one of the runs that race for it
+ * wins. Stores without conditional writes fall back to checking first.
+ *
+ * @async
+ * @param {String} key the key of the lock
+ * @param {Object} lock the lock
+ * @param {Object} store the storage that the state is kept in
+ * @return {Boolean} true if the lock was created
+ */
+async function createLock(key, lock, store) {
+  if (typeof store.create === 'function') {
+    return await store.create(key, JSON.stringify(lock));
+  }
+  return !await store.exists(key) && await store.upload(key, JSON.stringify(lock));
+}
+
+/**
+ * Acquires the team's lock, so that overlapping runs (e.g. a slow Lambda
+ * invocation and the next one, or a manual run during the scheduled one)
+ * can't interleave their reads and writes of the team's state. The lock is
+ * a lease: it expires after `TEAM_LOCK_TTL_SECONDS`, so that a run that
+ * crashed without releasing it only holds up the team until then.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ * @param {Integer} ttlSeconds # of seconds until the lock expires
+ * @param {Date} now the current date
+ * @return {Object} `{owner, acquiredAt, expiresAt}`, or null if another run holds the lock
+ */
+async function acquireTeamLock(prefix, store = getStore(), ttlSeconds = config.team_lock_ttl_seconds, now = new Date()) {
+  const key = `${prefix}/${LOCK_FILENAME}`;
+  const lock = {owner: crypto.randomUUID(), acquiredAt: now.toISOString(), expiresAt: new Date(now.getTime() + ttlSeconds * 1000).toISOString()};
+  if (await createLock(key, lock, store)) {
+    return lock;
+  }
+  const held = await loadTeamLock(prefix, store);
+  if (held && new Date(held.expiresAt) > now) {
+    logger.warn(`${prefix} is locked by another run until ${held.expiresAt}`);
+    return null;
+  }
+  if (!held && !await store.exists(key)) {
+    // There's no lock to take over (e.g. it was just released), so the create failed for another reason
+    if (await createLock(key, lock, store)) {
+      return lock;
+    }
+    logger.error(`Couldn't create the lock of ${prefix}`);
+    return null;
+  }
+  // The lock expired (or is unreadable), so take it over; if another run takes it over first, it wins
+  logger.warn(`Taking over the ${held ? `expired lock of ${prefix} (acquired at ${held.acquiredAt})` : `unreadable lock of ${prefix}`}`);
+  await store.delete(key);
+  return await createLock(key, lock, store) ? lock : null;
+}
+
+/**
+ * Releases the team's lock, unless it's no longer held by the given lock
+ * (i.e. it expired, and another run took it over).
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} lock the lock, see `acquireTeamLock()`
+ * @param {Object} store the storage that the state is kept in
+ * @return {Boolean} true if the lock was released
+ */
+async function releaseTeamLock(prefix, lock, store = getStore()) {
+  const held = await loadTeamLock(prefix, store);
+  if (!held || held.owner !== lock.owner) {
+    logger.warn(`The lock of ${prefix} expired before the run finished`);
+    return false;
+  }
+  return await store.delete(`${prefix}/${LOCK_FILENAME}`);
+}
+
+/**
+ * Runs the function while holding the team's lock (if `TEAM_LOCK` is
+ * enabled), e.g. for the CLI commands that write the team's state.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Function} fn the function to run
+ * @param {Object} store the storage that the state is kept in
+ * @return {*} the result of the function
+ * @throws {Error} when another run holds the lock
+ */
+async function withTeamLock(prefix, fn, store = getStore()) {
+  if (!config.team_lock) {
+    return await fn();
+  }
+  const lock = await acquireTeamLock(prefix, store);
+  if (!lock) {
+    throw new Error(`${prefix} is locked by another run, try again once it finishes`);
+  }
+  try {
+    return await fn();
+  } finally {
+    await releaseTeamLock(prefix, lock, store);
+  }
+}
+
+module.exports = {
+  LOCK_FILENAME,
+  loadTeamLock,
+  acquireTeamLock,
+  releaseTeamLock,
+  withTeamLock,
+};
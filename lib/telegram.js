@@ -0,0 +1,114 @@
+/* eslint-disable max-len */
+const axios = require('axios');
+const config = require('../config');
+const {logger} = require('./logger');
+
+// Telegram cuts off photo captions longer than this
+const CAPTION_MAX_LENGTH = 1024;
+
+/**
+ * Retrieves the Telegram bot and chat that the team's updates are sent to:
+ * the team's `telegram` in `TEAMS` (e.g. `{"chatId": "-1001234567890"}`,
+ * optionally with its own `botToken`), or else `TELEGRAM_CHAT_ID`, with the
+ * bot of `TELEGRAM_BOT_TOKEN`.
+ *
+ * @param {Object} team the team
+ * @return {Object} `{botToken, chatId}`, or null if Telegram isn't configured for the team
+ */
+function getTelegramSettings(team) {
+  const settings = (team && team.telegram) || {};
+  const botToken = settings.botToken || config.telegram_bot_token;
+  const chatId = settings.chatId || config.telegram_chat_id;
+  return botToken && chatId ? {botToken, chatId: `${chatId}`} : null;
+}
+
+/**
+ * Shortens the caption to the length that Telegram allows.
+ *
+ * @param {String} text the text
+ * @return {String} the caption
+ */
+function buildCaption(text) {
+  return text.length <= CAPTION_MAX_LENGTH ? text : `${text.slice(0, CAPTION_MAX_LENGTH - 1)}…`;
+}
+
+/**
+ * Sends the photo with a caption to the Telegram chat, through the Bot API.
+ * The errors are logged without the request, since its URL has the bot token.
+ *
+ * @async
+ * @param {Buffer} imageBuffer the binary contents of the photo
+ * @param {String} caption the caption of the photo
+ * @param {Object} settings the bot and chat, see `getTelegramSettings()`
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Object} the sent message, or null on failure
+ */
+async function sendPhoto(imageBuffer, caption, settings, signal = undefined, http = axios) {
+  try {
+    const form = new FormData();
+    form.append('chat_id', settings.chatId);
+    form.append('caption', buildCaption(caption));
+    form.append('photo', new Blob([Buffer.from(imageBuffer)], {type: 'image/png'}), 'schedule.png');
+    const result = await http.post(`https://api.telegram.org/bot${settings.botToken}/sendPhoto`, form, {signal});
+    if (result.status !== 200 || !result.data.ok) {
+      logger.error(`Unable to send the photo to Telegram: ${result.data.description || result.status}`);
+      return null;
+    }
+    return result.data.result;
+  } catch (e) {
+    signal?.throwIfAborted();
+    logger.error(`Unable to send the photo to Telegram: ${(e.response && e.response.data && e.response.data.description) || e.message}`);
+  }
+  return null;
+}
+
+/**
+ * Posts the screenshot to the team's Telegram chat along with the given text.
+ *
+ * @async
+ * @param {Buffer} imageBuffer the screenshot to be posted
+ * @param {String} text the caption
+ * @param {Object} team the team, see `getTelegramSettings()`
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {Object} the sent message, or null on failure or when Telegram isn't configured for the team
+ */
+async function postScreenshotToTelegram(imageBuffer, text, team, signal = undefined, http = axios) {
+  const settings = getTelegramSettings(team);
+  if (!settings) {
+    return null;
+  }
+  return await sendPhoto(imageBuffer, text, settings, signal, http);
+}
+
+/**
+ * Checks that the bots that the teams' updates are sent with still exist,
+ * without sending anything.
+ *
+ * @async
+ * @param {Array} teams the configured teams
+ * @param {Object} http the HTTP client, i.e. axios
+ * @return {String} the usernames of the bots
+ */
+async function checkTelegram(teams = config.teams, http = axios) {
+  const tokens = [...new Set([...teams.map(getTelegramSettings), getTelegramSettings(null)].filter((settings) => settings).map((settings) => settings.botToken))];
+  const usernames = [];
+  for (const token of tokens) {
+    const result = await http.get(`https://api.telegram.org/bot${token}/getMe`, {validateStatus: () => true});
+    if (!result.data || !result.data.ok) {
+      throw new Error(`A bot token was rejected: ${(result.data && result.data.description) || result.status}`);
+    }
+    usernames.push(`@${result.data.result.username}`);
+  }
+  return usernames.join(', ');
+}
+
+module.exports = {
+  CAPTION_MAX_LENGTH,
+  getTelegramSettings,
+  buildCaption,
+  sendPhoto,
+  postScreenshotToTelegram,
+  checkTelegram,
+};
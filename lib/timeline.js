@@ -0,0 +1,168 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {deserializeSchedule, canonicalizeScheduleKey, getKeyLabel} = require('./helper_functions');
+const {categorizeChange} = require('./severity');
+const {getSnapshotMetadataKey, loadSnapshotMetadata, matchesSeason} = require('./season');
+const {formatTimestamp} = require('./format');
+
+const CATEGORY_LABELS = {
+  newGame: 'Added',
+  cancellation: 'Canceled',
+  expired: 'Dropped off the schedule',
+  timeChange: 'Time changed',
+  locationChange: 'Location changed',
+  textFix: 'Text edited',
+};
+
+/**
+ * Extracts the timestamp from an archived filename. The archived filenames
+ * end with the milliseconds since epoch, e.g. `schedule-2023-10-6-1696600000000.json`.
+ *
+ * @param {String} filename the archived filename (or S3 key)
+ * @return {Date} the timestamp of the file, or null if it can't be determined
+ */
+function getSnapshotTimestamp(filename) {
+  const match = `${filename}`.match(/-(\d{10,})\.\w+$/);
+  return match ? new Date(parseInt(match[1])) : null;
+}
+
+/**
+ * Lists the archived schedule snapshots, in chronological order. When a
+ * season is given, only the snapshots stored with that season are listed
+ * (see `lib/season.js`).
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {Object} store the storage that the archive is kept in
+ * @param {String} season the season to filter by, or null for every snapshot
+ * @return {Array} list of objects with `key` and `timestamp`
+ */
+async function listScheduleSnapshots(prefix = config.twitterUserHandle, store = getStore(), season = null) {
+  const files = await store.list(`${prefix}/archive/schedule-`);
+  const snapshots = files
+      .filter((file) => file.key.endsWith('.json'))
+      .map((file) => ({key: file.key, timestamp: getSnapshotTimestamp(file.key)}))
+      .filter((snapshot) => snapshot.timestamp)
+      .sort((a, b) => a.timestamp - b.timestamp);
+  if (!season) {
+    return snapshots;
+  }
+  const metadataKeys = new Set(files.map((file) => file.key));
+  const filtered = [];
+  for (const snapshot of snapshots) {
+    if (metadataKeys.has(getSnapshotMetadataKey(snapshot.key)) && matchesSeason(await loadSnapshotMetadata(snapshot.key, store), season)) {
+      filtered.push(snapshot);
+    }
+  }
+  return filtered;
+}
+
+/**
+ * Builds the timeline of how a single schedule entry evolved across the
+ * snapshots. Only the snapshots where the entry changed produce an event.
+ * The key is matched as typed, e.g. `saturday, 9/6`, and without a year it
+ * matches the entry of that day in any year.
+ *
+ * @param {Array} snapshots chronological list of objects with `timestamp` and `schedule` (Map)
+ * @param {String} key the schedule key, e.g. `SATURDAY, 9/6`
+ * @return {Array} list of events with `timestamp`, `category`, `previous`, and `current`
+ */
+function buildEventTimeline(snapshots, key) {
+  const target = canonicalizeScheduleKey(key.toUpperCase().replace(/\s+/g, ' '));
+  const matchesKey = (candidate) => [candidate, getKeyLabel(candidate)].includes(target);
+  const events = [];
+  let previous = null;
+  for (const snapshot of snapshots) {
+    const match = [...snapshot.schedule.keys()].map((candidate) => canonicalizeScheduleKey(candidate)).findIndex(matchesKey);
+    const current = match === -1 ? null : [...snapshot.schedule.values()][match];
+    let type = null;
+    if (!previous && current) {
+      type = 'added';
+    } else if (previous && !current) {
+      type = 'deleted';
+    } else if (previous && current && (previous.location !== current.location || previous.timeBlock !== current.timeBlock)) {
+      type = 'modified';
+    }
+    if (type) {
+      events.push({
+        timestamp: snapshot.timestamp,
+        category: categorizeChange(type, previous, current, snapshot.timestamp),
+        previous,
+        current,
+      });
+    }
+    previous = current;
+  }
+  return events;
+}
+
+/**
+ * Retrieves every archived snapshot (of the season, if given) and builds
+ * the timeline of the entry. The same day recurs every year, so a page that's
+ * reused across seasons needs the season to tell the entries apart.
+ *
+ * @async
+ * @param {String} key the schedule key, e.g. `SATURDAY, 9/6`
+ * @param {String} prefix the prefix where the team's state is kept
+ * @param {Object} store the storage that the archive is kept in
+ * @param {String} season the season to limit the snapshots to, or null for every snapshot
+ * @return {Array} list of events, see `buildEventTimeline()`
+ */
+async function getEventTimeline(key, prefix = config.twitterUserHandle, store = getStore(), season = null) {
+  const snapshots = [];
+  for (const snapshot of await listScheduleSnapshots(prefix, store, season)) {
+    snapshots.push({
+      timestamp: snapshot.timestamp,
+      schedule: await deserializeSchedule(snapshot.key, store, snapshot.timestamp),
+    });
+  }
+  return buildEventTimeline(snapshots, key);
+}
+
+/**
+ * Describes a schedule entry in a single line, e.g. `Practice, Warren 3:00–5:30`.
+ *
+ * @param {Object} entry the schedule entry
+ * @return {String} the description of the entry
+ */
+function describeEntry(entry) {
+  if (!entry) {
+    return '(not listed)';
+  }
+  const description = [entry.location, entry.timeBlock].filter((part) => part).join(' ');
+  return entry.manuallyCorrected ? `${description} (manually corrected)` : description;
+}
+
+/**
+ * Formats the timeline for display on the console.
+ *
+ * @param {String} key the schedule key, e.g. `SATURDAY, 9/6`
+ * @param {Array} events list of events, see `buildEventTimeline()`
+ * @return {String} the formatted timeline
+ */
+function formatTimeline(key, events) {
+  if (!events.length) {
+    return `No history found for ${key}.`;
+  }
+  const lines = [`History of ${key}:`];
+  for (const event of events) {
+    const timestamp = formatTimestamp(event.timestamp);
+    const label = CATEGORY_LABELS[event.category] || event.category;
+    if (event.category === 'newGame') {
+      lines.push(`  ${timestamp} - ${label}: ${describeEntry(event.current)}`);
+    } else {
+      lines.push(`  ${timestamp} - ${label}: ${describeEntry(event.previous)} → ${describeEntry(event.current)}`);
+    }
+  }
+  return lines.join('\n');
+}
+
+module.exports = {
+  getSnapshotTimestamp,
+  listScheduleSnapshots,
+  buildEventTimeline,
+  getEventTimeline,
+  describeEntry,
+  formatTimeline,
+};
@@ -0,0 +1,289 @@
+/* eslint-disable max-len */
+const {TwitterApi} = require('twitter-api-v2');
+const config = require('../config');
+const {sleep} = require('./abort');
+const {logger} = require('./logger');
+const {getStore} = require('./storage');
+const {getOAuth2Client} = require('./twitter_oauth2');
+
+// The size of the chunks that the media is uploaded in with v2 (at most 5MB)
+const MEDIA_CHUNK_BYTES = 1024 * 1024;
+
+/**
+ * Creates the Twitter client for the bot's account, using the credentials
+ * from the config.
+ *
+ * @return {TwitterApi} the Twitter client
+ */
+function createTwitterClient() {
+  return new TwitterApi({
+    appKey: config.consumer_key,
+    appSecret: config.consumer_secret,
+    accessToken: config.access_token_key,
+    accessSecret: config.access_token_secret,
+  });
+}
+
+/**
+ * Retrieves the Twitter client for the bot's account with the configured
+ * authentication, see `config.twitter_auth`. With OAuth2, the token is
+ * refreshed (and persisted) when it's about to expire.
+ *
+ * @async
+ * @param {Object} store the storage that the OAuth2 token is kept in
+ * @param {String} auth `oauth1` or `oauth2`
+ * @return {TwitterApi} the Twitter client
+ */
+async function getTwitterClient(store = getStore(), auth = config.twitter_auth) {
+  return auth === 'oauth2' ? await getOAuth2Client(store) : createTwitterClient();
+}
+
+/**
+ * Retrieves the credentials that the bot authenticates with, i.e. the OAuth2
+ * client id (and secret) or the OAuth1 keys and tokens, to tell whether
+ * Twitter is configured and when the credentials are rotated.
+ *
+ * @param {String} auth `oauth1` or `oauth2`
+ * @return {Array} the values of the credentials
+ */
+function getTwitterCredentials(auth = config.twitter_auth) {
+  if (auth === 'oauth2') {
+    return [config.twitter_client_id, ...(config.twitter_client_secret ? [config.twitter_client_secret] : [])];
+  }
+  return [config.consumer_key, config.consumer_secret, config.access_token_key, config.access_token_secret];
+}
+
+/**
+ * An error from the Twitter API, classified so that the caller can decide
+ * whether to retry or skip, e.g. a duplicate status can't be posted again.
+ *
+ * @class TwitterError
+ * @typedef {TwitterError}
+ */
+class TwitterError extends Error {
+  /**
+   * Creates an instance of TwitterError.
+   *
+   * @constructor
+   * @param {String} message the message
+   * @param {String} type one of `rate_limited`, `duplicate`, `media_too_large`, `unauthorized`, `server`, `network`, or `other`
+   * @param {Integer} status the HTTP status, or null if there was no response
+   * @param {Integer} retryAfterMs # of milliseconds until the rate limit resets, or null if unknown
+   * @param {Error} cause the original error
+   */
+  constructor(message, type, status = null, retryAfterMs = null, cause = undefined) {
+    super(message, {cause});
+    this.name = 'TwitterError';
+    this.type = type;
+    this.status = status;
+    this.retryAfterMs = retryAfterMs;
+    this.retryable = ['rate_limited', 'server', 'network'].includes(type);
+  }
+}
+
+/**
+ * Classifies an error from the Twitter client (see `twitter-api-v2`'s
+ * `ApiResponseError` and `ApiRequestError`) by its status and the error
+ * codes in its response.
+ *
+ * @param {Error} e the error
+ * @param {Date} now the current date, for when the rate limit resets
+ * @return {TwitterError} the classified error
+ */
+function classifyTwitterError(e, now = new Date()) {
+  if (e instanceof TwitterError) {
+    return e;
+  }
+  const status = typeof e.code === 'number' ? e.code : null;
+  const data = e.data || {};
+  const codes = (data.errors || []).map((error) => error.code);
+  const details = [data.detail, data.title, ...(data.errors || []).map((error) => error.message), e.message].filter((detail) => detail).join(' ');
+  if (status === 429 || e.rateLimitError) {
+    const reset = e.rateLimit && e.rateLimit.reset ? e.rateLimit.reset : parseInt((e.headers || {})['x-rate-limit-reset']);
+    const retryAfterMs = reset ? Math.max(0, reset * 1000 - now.getTime()) : null;
+    return new TwitterError(`Rate limited by Twitter${retryAfterMs === null ? '' : `, resets in ${Math.ceil(retryAfterMs / 1000)}s`}`, 'rate_limited', status, retryAfterMs, e);
+  }
+  if (codes.includes(187) || /duplicate/i.test(details)) {
+    return new TwitterError(`Duplicate status: ${details}`, 'duplicate', status, null, e);
+  }
+  if (status === 413 || codes.includes(324) || /(file size|too large)/i.test(details)) {
+    return new TwitterError(`Media too large: ${details}`, 'media_too_large', status, null, e);
+  }
+  if (status === 401 || status === 403 || codes.includes(32) || codes.includes(89)) {
+    return new TwitterError(`Unauthorized: ${details}`, 'unauthorized', status, null, e);
+  }
+  if (status !== null && status >= 500) {
+    return new TwitterError(`Twitter server error: ${details}`, 'server', status, null, e);
+  }
+  if (status === null) {
+    return new TwitterError(`Unable to reach Twitter: ${details}`, 'network', null, null, e);
+  }
+  return new TwitterError(details, 'other', status, null, e);
+}
+
+/**
+ * Calls the Twitter API, waiting for the rate limit to reset and retrying
+ * once when rate limited (unless the reset is too far off). Errors are
+ * classified, see `classifyTwitterError()`.
+ *
+ * @async
+ * @param {Function} call makes the request, e.g. `() => client.v2.tweet(params)`
+ * @param {AbortSignal} signal the signal that cancels the wait
+ * @param {Integer} maxWaitMs the max # of milliseconds to wait for the rate limit to reset
+ * @param {Function} wait waits for the given # of milliseconds, see `sleep()`
+ * @return {*} the result of the call
+ */
+async function callWithRateLimit(call, signal = undefined, maxWaitMs = config.twitter_rate_limit_max_wait * 1000, wait = sleep) {
+  try {
+    return await call();
+  } catch (e) {
+    const error = classifyTwitterError(e);
+    if (error.type !== 'rate_limited' || error.retryAfterMs === null || error.retryAfterMs > maxWaitMs) {
+      throw error;
+    }
+    logger.warn(`${error.message}, waiting to retry`);
+    await wait(error.retryAfterMs, signal);
+  }
+  try {
+    return await call();
+  } catch (e) {
+    throw classifyTwitterError(e);
+  }
+}
+
+/**
+ * Uploads the media with the v2 chunked upload (`POST /2/media/upload`),
+ * i.e. INIT with its size, APPEND each chunk, then FINALIZE, waiting for
+ * Twitter to finish processing it if needed.
+ *
+ * @async
+ * @param {Buffer} buffer the media
+ * @param {TwitterApi} client the Twitter client
+ * @param {String} mediaType the MIME type of the media
+ * @param {AbortSignal} signal the signal that cancels the upload
+ * @param {Function} wait waits for the given # of milliseconds, see `sleep()`
+ * @return {String} the media id
+ */
+async function uploadMediaChunked(buffer, client, mediaType = 'image/png', signal = undefined, wait = sleep) {
+  const post = (params) => callWithRateLimit(() => client.v2.post('media/upload', params, {forceBodyMode: 'form-data'}), signal);
+  const init = await post({command: 'INIT', media_type: mediaType, total_bytes: `${buffer.length}`, media_category: 'tweet_image'});
+  const mediaId = init.data.id;
+  for (let offset = 0, index = 0; offset < buffer.length; offset += MEDIA_CHUNK_BYTES, index++) {
+    signal?.throwIfAborted();
+    await post({command: 'APPEND', media_id: mediaId, segment_index: `${index}`, media: buffer.subarray(offset, offset + MEDIA_CHUNK_BYTES)});
+  }
+  let processing = (await post({command: 'FINALIZE', media_id: mediaId})).data.processing_info;
+  while (processing && ['pending', 'in_progress'].includes(processing.state)) {
+    await wait((processing.check_after_secs || 1) * 1000, signal);
+    processing = (await callWithRateLimit(() => client.v2.get('media/upload', {command: 'STATUS', media_id: mediaId}), signal)).data.processing_info;
+  }
+  if (processing && processing.state === 'failed') {
+    throw new TwitterError(`Media processing failed: ${processing.error ? processing.error.message : 'unknown error'}`, 'other');
+  }
+  return mediaId;
+}
+
+/**
+ * Sets the alt text of uploaded media (`media/metadata/create` with v1.1, or
+ * `POST /2/media/metadata` with v2), for screen readers. The image can still
+ * be posted without it, so failures are logged rather than thrown.
+ *
+ * @async
+ * @param {String} mediaId the media id
+ * @param {String} altText the alt text, at most 1,000 characters
+ * @param {TwitterApi} client the Twitter client
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @param {String} apiVersion `v1` or `v2`
+ * @return {Boolean} true if the alt text was set
+ */
+async function setMediaAltText(mediaId, altText, client = createTwitterClient(), signal = undefined, apiVersion = config.twitter_api_version) {
+  try {
+    if (apiVersion === 'v2') {
+      await callWithRateLimit(() => client.v2.post('media/metadata', {id: mediaId, metadata: {alt_text: {text: altText}}}), signal);
+    } else {
+      await callWithRateLimit(() => client.v1.createMediaMetadata(mediaId, {alt_text: {text: altText}}), signal);
+    }
+    return true;
+  } catch (e) {
+    signal?.throwIfAborted();
+    logger.warn(`Unable to set the alt text of the media: ${e.message}`);
+    return false;
+  }
+}
+
+/**
+ * Uploads a PNG image to attach to a tweet, with the configured version of
+ * the API (see `config.twitter_api_version`), along with its alt text.
+ *
+ * @async
+ * @param {Buffer} imageBuffer the PNG image
+ * @param {TwitterApi} client the Twitter client
+ * @param {AbortSignal} signal the signal that cancels the upload
+ * @param {String} altText the alt text of the image, or empty for none
+ * @param {String} apiVersion `v1` or `v2`
+ * @return {String} the media id
+ */
+async function uploadMedia(imageBuffer, client = createTwitterClient(), signal = undefined, altText = '', apiVersion = config.twitter_api_version) {
+  let mediaId;
+  if (apiVersion === 'v2') {
+    mediaId = await uploadMediaChunked(Buffer.from(imageBuffer), client, 'image/png', signal);
+  } else {
+    mediaId = await callWithRateLimit(() => client.v1.uploadMedia(Buffer.from(imageBuffer), {type: 'png'}), signal);
+  }
+  if (altText) {
+    await setMediaAltText(mediaId, altText, client, signal, apiVersion);
+  }
+  return mediaId;
+}
+
+/**
+ * Posts a tweet from the bot's account, with an optional image.
+ *
+ * @async
+ * @param {String} text the text of the tweet
+ * @param {Buffer} imageBuffer the PNG image to attach, or null for none
+ * @param {TwitterApi} client the Twitter client
+ * @param {String} altText the alt text of the image, or empty for none
+ * @return {String} the id of the tweet
+ */
+async function postTweet(text, imageBuffer = null, client = createTwitterClient(), altText = '') {
+  const tweet = {text};
+  if (imageBuffer) {
+    tweet.media = {media_ids: [await uploadMedia(imageBuffer, client, undefined, altText)]};
+  }
+  const result = await callWithRateLimit(() => client.v2.tweet(tweet));
+  return result.data.id;
+}
+
+/**
+ * Deletes a tweet from the bot's account, with the configured version of the
+ * API, i.e. `DELETE /2/tweets/:id` with `v2`.
+ *
+ * @async
+ * @param {String} id the id of the tweet
+ * @param {TwitterApi} client the Twitter client
+ * @param {String} apiVersion `v1` or `v2`
+ * @return {Boolean} true if the tweet was deleted
+ */
+async function deleteTweet(id, client = createTwitterClient(), apiVersion = config.twitter_api_version) {
+  if (apiVersion === 'v2') {
+    const result = await callWithRateLimit(() => client.v2.deleteTweet(id));
+    return !!(result.data && result.data.deleted);
+  }
+  await callWithRateLimit(() => client.v1.deleteTweet(id));
+  return true;
+}
+
+module.exports = {
+  TwitterError,
+  classifyTwitterError,
+  callWithRateLimit,
+  createTwitterClient,
+  getTwitterClient,
+  getTwitterCredentials,
+  uploadMediaChunked,
+  setMediaAltText,
+  uploadMedia,
+  postTweet,
+  deleteTweet,
+};
@@ -0,0 +1,152 @@
+/* eslint-disable max-len */
+const {TwitterApi} = require('twitter-api-v2');
+const config = require('../config');
+const {getStore} = require('./storage');
+
+/**
+ * The OAuth2 token is shared by all of the teams (it's the bot's account), so
+ * it's kept at the top level of the storage rather than under a team's prefix.
+ */
+const TOKEN_FILENAME = 'twitter/oauth2-token.json';
+const PENDING_LOGIN_FILENAME = 'twitter/oauth2-login.json';
+
+// What the bot needs: posting with media, and refresh tokens (`offline.access`)
+const OAUTH2_SCOPES = ['tweet.read', 'tweet.write', 'users.read', 'media.write', 'offline.access'];
+
+// Refresh the access token when it's this close to expiring (or expired)
+const REFRESH_MARGIN_MS = 5 * 60 * 1000;
+
+// A login that isn't completed within this long has to be started over
+const LOGIN_TIMEOUT_MS = 60 * 60 * 1000;
+
+/**
+ * Creates the client for the app's OAuth2 credentials, which starts the
+ * login and refreshes the tokens (but can't post by itself).
+ *
+ * @param {String} clientId the OAuth2 client id
+ * @param {String} clientSecret the OAuth2 client secret, or empty for a public client
+ * @return {TwitterApi} the client
+ */
+function createOAuth2AppClient(clientId = config.twitter_client_id, clientSecret = config.twitter_client_secret) {
+  return new TwitterApi(clientSecret ? {clientId, clientSecret} : {clientId});
+}
+
+/**
+ * Converts the result of a login or refresh into the token that's persisted.
+ *
+ * @param {Object} result the result, with `accessToken`, `refreshToken`, `expiresIn` (seconds), and `scope`
+ * @param {Date} now the current date
+ * @return {Object} the token, i.e. `{accessToken, refreshToken, expiresAt, scope}`
+ */
+function buildToken(result, now = new Date()) {
+  return {
+    accessToken: result.accessToken,
+    refreshToken: result.refreshToken,
+    expiresAt: new Date(now.getTime() + result.expiresIn * 1000).toISOString(),
+    scope: result.scope || OAUTH2_SCOPES,
+  };
+}
+
+/**
+ * Loads the persisted OAuth2 token.
+ *
+ * @async
+ * @param {Object} store the storage that the token is kept in
+ * @return {Object} the token, see `buildToken()`, or null if the bot hasn't logged in
+ */
+async function loadOAuth2Token(store = getStore()) {
+  const data = await store.download(TOKEN_FILENAME);
+  return data ? JSON.parse(data) : null;
+}
+
+/**
+ * Persists the OAuth2 token. The refresh tokens are single use, so the new
+ * one has to be saved after every refresh.
+ *
+ * @async
+ * @param {Object} token the token, see `buildToken()`
+ * @param {Object} store the storage that the token is kept in
+ */
+async function saveOAuth2Token(token, store = getStore()) {
+  await store.upload(TOKEN_FILENAME, JSON.stringify(token));
+}
+
+/**
+ * Starts the OAuth2 login (with PKCE) for the bot's account. The code
+ * verifier and state are kept until the login is completed, see
+ * `completeOAuth2Login()`.
+ *
+ * @async
+ * @param {Object} store the storage that the pending login is kept in
+ * @param {TwitterApi} appClient the client for the app's OAuth2 credentials
+ * @param {String} redirectUri the callback URL registered for the app
+ * @param {Date} now the current date
+ * @return {String} the URL to authorize the app at, while logged in as the bot
+ */
+async function startOAuth2Login(store = getStore(), appClient = createOAuth2AppClient(), redirectUri = config.twitter_oauth2_redirect_uri, now = new Date()) {
+  const {url, codeVerifier, state} = appClient.generateOAuth2AuthLink(redirectUri, {scope: OAUTH2_SCOPES});
+  await store.upload(PENDING_LOGIN_FILENAME, JSON.stringify({codeVerifier, state, redirectUri, startedAt: now.toISOString()}));
+  return url;
+}
+
+/**
+ * Completes the OAuth2 login with the code that Twitter redirected to the
+ * callback URL with, and persists the token.
+ *
+ * @async
+ * @param {String} code the `code` in the callback URL
+ * @param {String} state the `state` in the callback URL
+ * @param {Object} store the storage that the token is kept in
+ * @param {TwitterApi} appClient the client for the app's OAuth2 credentials
+ * @param {Date} now the current date
+ * @return {Object} the token, see `buildToken()`
+ */
+async function completeOAuth2Login(code, state, store = getStore(), appClient = createOAuth2AppClient(), now = new Date()) {
+  const data = await store.download(PENDING_LOGIN_FILENAME);
+  const pending = data ? JSON.parse(data) : null;
+  if (!pending || now - new Date(pending.startedAt) > LOGIN_TIMEOUT_MS) {
+    throw new Error('No login in progress, start it again');
+  }
+  if (pending.state !== state) {
+    throw new Error('The state doesn\'t match the login in progress');
+  }
+  const result = await appClient.loginWithOAuth2({code, codeVerifier: pending.codeVerifier, redirectUri: pending.redirectUri});
+  const token = buildToken(result, now);
+  await saveOAuth2Token(token, store);
+  await store.delete(PENDING_LOGIN_FILENAME);
+  return token;
+}
+
+/**
+ * Creates the client for the bot's account with the persisted OAuth2 token,
+ * refreshing the token first when it's about to expire.
+ *
+ * @async
+ * @param {Object} store the storage that the token is kept in
+ * @param {TwitterApi} appClient the client for the app's OAuth2 credentials
+ * @param {Function} createClient creates the client for an access token
+ * @param {Date} now the current date
+ * @return {TwitterApi} the Twitter client
+ */
+async function getOAuth2Client(store = getStore(), appClient = createOAuth2AppClient(), createClient = (accessToken) => new TwitterApi(accessToken), now = new Date()) {
+  let token = await loadOAuth2Token(store);
+  if (!token) {
+    throw new Error('Not logged in to Twitter with OAuth2, run `npm run cli -- twitter-login`');
+  }
+  if (new Date(token.expiresAt) - now < REFRESH_MARGIN_MS) {
+    token = buildToken(await appClient.refreshOAuth2Token(token.refreshToken), now);
+    await saveOAuth2Token(token, store);
+  }
+  return createClient(token.accessToken);
+}
+
+module.exports = {
+  OAUTH2_SCOPES,
+  createOAuth2AppClient,
+  buildToken,
+  loadOAuth2Token,
+  saveOAuth2Token,
+  startOAuth2Login,
+  completeOAuth2Login,
+  getOAuth2Client,
+};
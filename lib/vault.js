@@ -1,6 +1,7 @@
 /* eslint-disable max-len */
 const axios = require('axios');
 const config = require('../config');
+const {logger} = require('./logger');
 
 /**
  * Retrieves the HCP API Token, by providing it with the Client ID
@@ -26,7 +27,7 @@ async function retrieveApiToken() {
     }
     return result.data.access_token;
   } catch (e) {
-    console.error(e);
+    logger.error(e);
   }
   return null;
 }
@@ -55,7 +56,64 @@ async function retrieveSecret(apiToken, secretName) {
     }
     return result.data.secret.version.value;
   } catch (e) {
-    console.error(e);
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Retrieves all of the application's secrets from HCP Vault Secrets in a
+ * single request, rather than making one request per secret.
+ *
+ * @async
+ * @param {String} apiToken the API Token gotten using `retrieveApiToken()`
+ * @return {Map} map of secret name to `{value, version}`, or null on failure
+ */
+async function retrieveSecrets(apiToken) {
+  try {
+    const result = await axios.get(`secrets/2023-06-13/organizations/${config.hcp_organization_id}/projects/${config.hcp_project_id}/apps/${config.hcp_application_name}/open`,
+        {
+          baseURL: 'https://api.cloud.hashicorp.com',
+          headers: {
+            'content-type': 'application/json',
+            'Authorization': `Bearer ${apiToken}`,
+          },
+        });
+    if (result.status !== 200) {
+      return null;
+    }
+    return new Map(result.data.secrets.map((secret) => [secret.name, {value: secret.version.value, version: secret.version.version}]));
+  } catch (e) {
+    logger.error(e);
+  }
+  return null;
+}
+
+/**
+ * Retrieves the latest version of each of the application's secrets, without
+ * opening (i.e. reading the values of) the secrets. This is used to check
+ * whether any of the secrets were rotated.
+ *
+ * @async
+ * @param {String} apiToken the API Token gotten using `retrieveApiToken()`
+ * @return {Map} map of secret name to the latest version, or null on failure
+ */
+async function retrieveSecretVersions(apiToken) {
+  try {
+    const result = await axios.get(`secrets/2023-06-13/organizations/${config.hcp_organization_id}/projects/${config.hcp_project_id}/apps/${config.hcp_application_name}/secrets`,
+        {
+          baseURL: 'https://api.cloud.hashicorp.com',
+          headers: {
+            'content-type': 'application/json',
+            'Authorization': `Bearer ${apiToken}`,
+          },
+        });
+    if (result.status !== 200) {
+      return null;
+    }
+    return new Map(result.data.secrets.map((secret) => [secret.name, secret.latest_version]));
+  } catch (e) {
+    logger.error(e);
   }
   return null;
 }
@@ -63,4 +121,6 @@ async function retrieveSecret(apiToken, secretName) {
 module.exports = {
   retrieveApiToken,
   retrieveSecret,
+  retrieveSecrets,
+  retrieveSecretVersions,
 };
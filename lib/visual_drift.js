@@ -0,0 +1,99 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {getPerceptualHash, getHammingDistance} = require('./screenshot_archive');
+const {notifyAdmins} = require('./admin_notifier');
+const {logger} = require('./logger');
+
+// What the page looked like the last time its schedule was found unchanged
+const VISUAL_DRIFT_FILENAME = 'visualDrift.json';
+
+/**
+ * Loads the team's visual baseline.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ * @return {Object} `{hash, checkedAt}`, or null if there's none (or it's unreadable)
+ */
+async function loadVisualBaseline(prefix, store = getStore()) {
+  const data = await store.download(`${prefix}/${VISUAL_DRIFT_FILENAME}`);
+  if (data) {
+    try {
+      return JSON.parse(data);
+    } catch (e) {
+      logger.error(e);
+    }
+  }
+  return null;
+}
+
+/**
+ * Compares the screenshot of a page whose parsed schedule is unchanged
+ * against what the page looked like the last time, so that visual-only
+ * changes (e.g. a note added above the schedule, which the parser misses)
+ * don't go unnoticed. The screenshot becomes the new baseline when it
+ * drifted, so that each drift is only reported once.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Buffer} screenshot the screenshot of the page
+ * @param {Object} store the storage that the state is kept in
+ * @param {Integer} maxDistance the max # of differing bits of the perceptual hashes (out of 64) that still count as the same
+ * @param {Date} now the current date
+ * @return {Object} `{status, distance}`, where the status is `seeded`, `same`, `drifted`, or `unknown` (the screenshot couldn't be hashed)
+ */
+async function checkVisualDrift(prefix, screenshot, store = getStore(), maxDistance = config.visual_drift_distance, now = new Date()) {
+  const hash = getPerceptualHash(screenshot);
+  if (!hash) {
+    return {status: 'unknown', distance: null};
+  }
+  const baseline = await loadVisualBaseline(prefix, store);
+  const distance = baseline && baseline.hash ? getHammingDistance(hash, baseline.hash) : null;
+  if (distance !== null && distance <= maxDistance) {
+    return {status: 'same', distance};
+  }
+  await store.upload(`${prefix}/${VISUAL_DRIFT_FILENAME}`, JSON.stringify({hash, checkedAt: now.toISOString()}));
+  return {status: distance === null ? 'seeded' : 'drifted', distance};
+}
+
+/**
+ * Forgets the team's visual baseline, e.g. once its schedule changed (and
+ * so its page looks different for a reason), so that the next unchanged run
+ * starts a new one.
+ *
+ * @async
+ * @param {String} prefix the prefix where the team's state is kept (i.e. team id)
+ * @param {Object} store the storage that the state is kept in
+ */
+async function resetVisualBaseline(prefix, store = getStore()) {
+  if (await store.exists(`${prefix}/${VISUAL_DRIFT_FILENAME}`)) {
+    await store.delete(`${prefix}/${VISUAL_DRIFT_FILENAME}`);
+  }
+}
+
+/**
+ * Lets the admins know that the team's page looks different while its
+ * parsed schedule is the same. This is informational: nothing is posted,
+ * but the page (or the parser) may need a look.
+ *
+ * @async
+ * @param {Object} team the team
+ * @param {Object} drift the result of `checkVisualDrift()`
+ * @param {Buffer} screenshot the screenshot of the page
+ * @param {Function} notify alerts the admins, see `notifyAdmins()`
+ * @return {Array} the channels that the alert was sent to
+ */
+async function alertVisualDrift(team, drift, screenshot, notify = notifyAdmins) {
+  const text = `The page of ${team.id} (${team.url}) looks different than it did (${drift.distance} of 64 bits of the screenshot's hash differ), but the parsed schedule is unchanged. A note or a format change that the parser misses may have been added to the page.`;
+  logger.warn(`Visual drift: ${text}`);
+  return await notify(`Bandits notification: ${team.id} page looks different (info)`, text, {content: screenshot});
+}
+
+module.exports = {
+  VISUAL_DRIFT_FILENAME,
+  loadVisualBaseline,
+  checkVisualDrift,
+  resetVisualBaseline,
+  alertVisualDrift,
+};
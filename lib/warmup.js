@@ -0,0 +1,90 @@
+/* eslint-disable max-len */
+const config = require('../config');
+const {getStore} = require('./storage');
+const {createLazyBrowser} = require('./scrape');
+const {getTwitterClient} = require('./twitter');
+
+/**
+ * Checks that the headless browser can be launched. A shared browser (see
+ * `createSharedBrowser()`) is left running, so that warming it up starts the
+ * Chrome that the next runs use.
+ *
+ * @async
+ * @param {Object} browser the browser, see `createLazyBrowser()` and `createSharedBrowser()`
+ * @return {String} the version of the browser
+ */
+async function checkBrowser(browser = createLazyBrowser()) {
+  try {
+    const launched = await browser.get();
+    return await (launched.browser || launched).version();
+  } finally {
+    await browser.close();
+  }
+}
+
+/**
+ * Checks that the storage can be reached, by listing the first team's files.
+ *
+ * @async
+ * @param {Object} store the storage that the state is kept in
+ * @return {String} the number of files found
+ */
+async function checkStorage(store = getStore()) {
+  const prefix = `${config.teams[0].id}/`;
+  const files = await store.list(prefix);
+  return `${files.length} files under ${prefix}`;
+}
+
+/**
+ * Checks that the Twitter credentials work, without posting anything.
+ *
+ * @async
+ * @param {Object} client the Twitter client, or null for the bot's, see `getTwitterClient()`
+ * @return {String} the handle of the account
+ */
+async function checkTwitter(client = null) {
+  // The v2 endpoint accepts both OAuth1 and OAuth2 user context
+  const me = await (client || await getTwitterClient()).v2.me();
+  return `@${me.data.username}`;
+}
+
+/**
+ * Runs the warmup checks, which initialize the browser and verify the
+ * connectivity to storage and Twitter without processing any teams. None of
+ * the checks have side effects, so they are safe to run at any time.
+ *
+ * @async
+ * @param {Object} checks mapping of the check's name to the function that runs it
+ * @return {Array} list of `{name, ok, detail, ms}` results
+ */
+async function runWarmupChecks(checks = {browser: () => checkBrowser(), storage: () => checkStorage(), twitter: () => checkTwitter()}) {
+  const results = [];
+  for (const [name, check] of Object.entries(checks)) {
+    const start = Date.now();
+    try {
+      results.push({name, ok: true, detail: await check(), ms: Date.now() - start});
+    } catch (e) {
+      results.push({name, ok: false, detail: e.message, ms: Date.now() - start});
+    }
+  }
+  return results;
+}
+
+/**
+ * Formats the results of the warmup checks, e.g.
+ * `browser: ok (HeadlessChrome/117.0.5938.92, 812ms), twitter: FAILED (...)`.
+ *
+ * @param {Array} results the results of `runWarmupChecks()`
+ * @return {String} the formatted results
+ */
+function formatWarmupResults(results) {
+  return results.map((result) => `${result.name}: ${result.ok ? 'ok' : 'FAILED'} (${result.detail}, ${result.ms}ms)`).join(', ');
+}
+
+module.exports = {
+  checkBrowser,
+  checkStorage,
+  checkTwitter,
+  runWarmupChecks,
+  formatWarmupResults,
+};
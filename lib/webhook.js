@@ -0,0 +1,186 @@
+/* eslint-disable max-len */
+const crypto = require('crypto');
+const axios = require('axios');
+const config = require('../config');
+const {logger} = require('./logger');
+
+// Identifies the encryption scheme of the encrypted payloads
+const ENCRYPTION_ALGORITHM = 'X25519-HKDF-SHA256-A256GCM';
+const HKDF_INFO = 'banditsNotification webhook payload';
+
+/**
+ * Builds the change event that is sent to the webhooks.
+ *
+ * @param {Object} team the team, i.e. `{id, url}`, with the optional `season` and `ageGroup`
+ * @param {Object} scheduleDiff the output of a differ, along with the `previousSchedule`
+ * @param {Object} classification the output of `classifyChanges()`
+ * @param {String} summary the summary of the changes
+ * @param {Date} now the current date
+ * @return {Object} the change event
+ */
+function buildChangeEvent(team, scheduleDiff, classification, summary, now = new Date()) {
+  return {
+    type: 'schedule.changed',
+    team: team.id,
+    url: team.url,
+    season: team.season || null,
+    ageGroup: team.ageGroup || null,
+    detectedAt: now.toISOString(),
+    severity: classification.severity,
+    summary,
+    changes: classification.changes.map((change) => ({
+      key: change.key,
+      type: change.type,
+      category: change.category,
+      severity: change.severity,
+      previous: scheduleDiff.previousSchedule ? scheduleDiff.previousSchedule.get(change.key) || null : null,
+      current: change.type === 'deleted' ? null : scheduleDiff[change.type].get(change.key),
+    })),
+  };
+}
+
+/**
+ * Signs the body of the request with HMAC-SHA256, so that the recipient can
+ * verify that it came from us.
+ *
+ * @param {String} body the body of the request
+ * @param {String} secret the secret shared with the recipient
+ * @return {String} the signature, e.g. `sha256=<hex>`
+ */
+function signPayload(body, secret) {
+  return `sha256=${crypto.createHmac('sha256', secret).update(body).digest('hex')}`;
+}
+
+/**
+ * Derives the key used to encrypt a payload from the X25519 shared secret.
+ *
+ * @param {Buffer} sharedSecret the X25519 shared secret
+ * @param {String} ephemeralPublicKey the ephemeral public key (base64url)
+ * @param {String} recipientPublicKey the recipient's public key (base64url)
+ * @return {Buffer} the 256-bit key
+ */
+function deriveKey(sharedSecret, ephemeralPublicKey, recipientPublicKey) {
+  return Buffer.from(crypto.hkdfSync('sha256', sharedSecret, `${ephemeralPublicKey}${recipientPublicKey}`, HKDF_INFO, 32));
+}
+
+/**
+ * Encrypts the payload for the recipient's X25519 public key, so that relays
+ * between us and the recipient can't read it. A new ephemeral key is used for
+ * every payload, and only the holder of the recipient's private key can
+ * decrypt it (see `decryptPayload()`).
+ *
+ * @param {String} body the payload to be encrypted
+ * @param {String} recipientPublicKey the recipient's raw X25519 public key (base64url)
+ * @return {Object} the encrypted envelope, with `alg`, `epk`, `iv`, `ciphertext`, and `tag`
+ */
+function encryptPayload(body, recipientPublicKey) {
+  const {publicKey, privateKey} = crypto.generateKeyPairSync('x25519');
+  const epk = publicKey.export({format: 'jwk'}).x;
+  const sharedSecret = crypto.diffieHellman({
+    privateKey,
+    publicKey: crypto.createPublicKey({key: {kty: 'OKP', crv: 'X25519', x: recipientPublicKey}, format: 'jwk'}),
+  });
+  const iv = crypto.randomBytes(12);
+  const cipher = crypto.createCipheriv('aes-256-gcm', deriveKey(sharedSecret, epk, recipientPublicKey), iv);
+  const ciphertext = Buffer.concat([cipher.update(body, 'utf8'), cipher.final()]);
+  return {
+    alg: ENCRYPTION_ALGORITHM,
+    epk,
+    iv: iv.toString('base64url'),
+    ciphertext: ciphertext.toString('base64url'),
+    tag: cipher.getAuthTag().toString('base64url'),
+  };
+}
+
+/**
+ * Decrypts an envelope from `encryptPayload()`. This is what the recipient
+ * runs on their end.
+ *
+ * @param {Object} envelope the encrypted envelope
+ * @param {String} recipientPrivateKey the recipient's raw X25519 private key (base64url)
+ * @param {String} recipientPublicKey the recipient's raw X25519 public key (base64url)
+ * @return {String} the decrypted payload
+ */
+function decryptPayload(envelope, recipientPrivateKey, recipientPublicKey) {
+  if (envelope.alg !== ENCRYPTION_ALGORITHM) {
+    throw new Error(`Unsupported encryption algorithm "${envelope.alg}"`);
+  }
+  const sharedSecret = crypto.diffieHellman({
+    privateKey: crypto.createPrivateKey({key: {kty: 'OKP', crv: 'X25519', x: recipientPublicKey, d: recipientPrivateKey}, format: 'jwk'}),
+    publicKey: crypto.createPublicKey({key: {kty: 'OKP', crv: 'X25519', x: envelope.epk}, format: 'jwk'}),
+  });
+  const decipher = crypto.createDecipheriv('aes-256-gcm', deriveKey(sharedSecret, envelope.epk, recipientPublicKey), Buffer.from(envelope.iv, 'base64url'));
+  decipher.setAuthTag(Buffer.from(envelope.tag, 'base64url'));
+  return Buffer.concat([decipher.update(Buffer.from(envelope.ciphertext, 'base64url')), decipher.final()]).toString('utf8');
+}
+
+/**
+ * Builds the body and headers of the request for the webhook. The payload is
+ * encrypted when the webhook has a `publicKey`, and the (possibly encrypted)
+ * body is signed when it has a `secret`.
+ *
+ * @param {Object} webhook the webhook, i.e. `{url, secret, publicKey}`
+ * @param {Object} event the change event
+ * @return {Object} Object with the `body` and `headers`
+ */
+function buildWebhookRequest(webhook, event) {
+  let body = JSON.stringify(event);
+  const headers = {'content-type': 'application/json'};
+  if (webhook.publicKey) {
+    body = JSON.stringify(encryptPayload(body, webhook.publicKey));
+    headers['x-bandits-encryption'] = ENCRYPTION_ALGORITHM;
+  }
+  if (webhook.secret) {
+    headers['x-bandits-signature'] = signPayload(body, webhook.secret);
+  }
+  return {body, headers};
+}
+
+/**
+ * Sends the change event to the webhook.
+ *
+ * @async
+ * @param {Object} webhook the webhook, i.e. `{url, secret, publicKey}`
+ * @param {Object} event the change event
+ * @param {AbortSignal} signal the signal that cancels the request
+ * @return {Boolean} true if the webhook accepted the event
+ */
+async function sendWebhook(webhook, event, signal = undefined) {
+  try {
+    const {body, headers} = buildWebhookRequest(webhook, event);
+    const result = await axios.post(webhook.url, body, {headers, signal});
+    return result.status >= 200 && result.status < 300;
+  } catch (e) {
+    logger.error(e);
+  }
+  return false;
+}
+
+/**
+ * Sends the change event to all of the configured webhooks.
+ *
+ * @async
+ * @param {Object} event the change event
+ * @param {Array} webhooks list of webhooks, i.e. `{url, secret, publicKey}`
+ * @param {AbortSignal} signal the signal that cancels the requests
+ * @return {Array} list of booleans, whether each webhook accepted the event
+ */
+async function sendWebhooks(event, webhooks = config.webhooks, signal = undefined) {
+  const results = [];
+  for (const webhook of webhooks) {
+    signal?.throwIfAborted();
+    results.push(await sendWebhook(webhook, event, signal));
+  }
+  return results;
+}
+
+module.exports = {
+  ENCRYPTION_ALGORITHM,
+  buildChangeEvent,
+  signPayload,
+  encryptPayload,
+  decryptPayload,
+  buildWebhookRequest,
+  sendWebhook,
+  sendWebhooks,
+};
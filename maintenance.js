@@ -0,0 +1,48 @@
+/* eslint-disable max-len */
+'use strict';
+const {getMaintenanceStatus, pauseNotifications, resumeNotifications, formatMaintenanceStatus} = require('./lib/maintenance');
+const {init} = require('./setup');
+
+const USAGE = `Usage:
+  node maintenance.js pause --by <name> [--reason "site migration"]
+  node maintenance.js resume
+  node maintenance.js status`;
+
+/**
+ * Pauses and resumes posting for all of the teams, e.g. during a site
+ * migration or a credential rotation. Scraping and archiving carry on while
+ * posting is paused.
+ */
+(async () => {
+  const args = process.argv.slice(2);
+  const command = args.shift();
+  const options = {};
+  for (let i = 0; i < args.length; i += 2) {
+    if (!args[i].startsWith('--') || args[i + 1] === undefined) {
+      console.error(USAGE);
+      process.exit(1);
+    }
+    options[args[i].slice(2)] = args[i + 1];
+  }
+
+  await init(); // connect to HCP Vault Secrets and populate environment variables
+  try {
+    if (command === 'pause' && options.by) {
+      await pauseNotifications(options.by, options.reason);
+      console.log(formatMaintenanceStatus(await getMaintenanceStatus()));
+    } else if (command === 'resume' && !args.length) {
+      if (!await resumeNotifications()) {
+        console.log('Posting was not paused.');
+      }
+      console.log(formatMaintenanceStatus(await getMaintenanceStatus()));
+    } else if (command === 'status' && !args.length) {
+      console.log(formatMaintenanceStatus(await getMaintenanceStatus()));
+    } else {
+      console.error(USAGE);
+      process.exit(1);
+    }
+  } catch (e) {
+    console.error(e.message);
+    process.exit(1);
+  }
+})();
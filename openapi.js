@@ -0,0 +1,23 @@
+/* eslint-disable max-len */
+'use strict';
+const fs = require('fs');
+const path = require('path');
+const config = require('./config');
+const {ROUTES} = require('./lib/link_tracking');
+const {buildOpenApiSpec, generateClient} = require('./lib/openapi');
+const {version} = require('./package.json');
+
+/**
+ * Writes the OpenAPI document of the server, and the TypeScript client
+ * generated from it, for team apps that integrate with the server.
+ *
+ * Usage: node openapi.js [output directory, default: api]
+ */
+(() => {
+  const outputDir = process.argv[2] || 'api';
+  const spec = buildOpenApiSpec(ROUTES, version, config.link_tracking_base_url);
+  fs.mkdirSync(outputDir, {recursive: true});
+  fs.writeFileSync(path.join(outputDir, 'openapi.json'), `${JSON.stringify(spec, null, 2)}\n`);
+  fs.writeFileSync(path.join(outputDir, 'client.ts'), generateClient(spec));
+  console.log(`Wrote ${path.join(outputDir, 'openapi.json')} and ${path.join(outputDir, 'client.ts')}`);
+})();
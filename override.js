@@ -0,0 +1,65 @@
+/* eslint-disable max-len */
+'use strict';
+const moment = require('moment-timezone');
+const config = require('./config');
+const {parseScheduleKey, setOverride, loadOverrides, clearOverrides} = require('./lib/overrides');
+const {init} = require('./setup');
+
+const USAGE = `Usage:
+  node override.js set [team id] "SATURDAY, 9/6" "Practice, Warren, 3:00–5:30" [--expires YYYY-MM-DD]
+  node override.js list [team id]
+  node override.js clear [team id] ["SATURDAY, 9/6"]`;
+
+/**
+ * Manages the manually entered schedule entries (overrides), for weeks when
+ * the schedule is only posted as an image that can't be parsed. The active
+ * overrides are layered over the parsed schedule on every run.
+ */
+(async () => {
+  const args = process.argv.slice(2);
+  const command = args.shift();
+  let expiresAt = null;
+  const expiresIndex = args.indexOf('--expires');
+  if (expiresIndex !== -1) {
+    expiresAt = moment.tz(args[expiresIndex + 1], 'YYYY-MM-DD', true, config.display_time_zone);
+    if (!expiresAt.isValid()) {
+      console.error(`Invalid expiry "${args[expiresIndex + 1]}", expected YYYY-MM-DD`);
+      process.exit(1);
+    }
+    expiresAt = expiresAt.toDate();
+    args.splice(expiresIndex, 2);
+  }
+
+  await init(); // connect to HCP Vault Secrets and populate environment variables
+  const defaultTeamId = config.teams[0].id;
+  try {
+    if (command === 'set' && (args.length === 2 || args.length === 3)) {
+      const [teamId, key, details] = args.length === 3 ? args : [defaultTeamId, ...args];
+      const entry = await setOverride(teamId, key, details, undefined, expiresAt);
+      console.log(`Saved override for ${teamId}: ${key.toUpperCase()} => ${[entry.location, entry.timeBlock].filter((part) => part).join(' ')} (expires ${entry.expiresAt})`);
+    } else if (command === 'list' && args.length <= 1) {
+      const teamId = args[0] || defaultTeamId;
+      const overrides = await loadOverrides(teamId);
+      if (!overrides.size) {
+        console.log(`No active overrides for ${teamId}.`);
+      }
+      overrides.forEach((entry, key) => {
+        console.log(`${key} => ${[entry.location, entry.timeBlock].filter((part) => part).join(' ')} (expires ${entry.expiresAt})`);
+      });
+    } else if (command === 'clear' && args.length <= 2) {
+      let [teamId, key] = args.length === 2 ? args : [defaultTeamId, null];
+      if (args.length === 1) {
+        // A single argument is either the schedule key or the team id
+        [teamId, key] = parseScheduleKey(args[0]) ? [defaultTeamId, args[0]] : [args[0], null];
+      }
+      const cleared = await clearOverrides(teamId, key);
+      console.log(`Cleared ${cleared} override(s) for ${teamId}.`);
+    } else {
+      console.error(USAGE);
+      process.exit(1);
+    }
+  } catch (e) {
+    console.error(e.message);
+    process.exit(1);
+  }
+})();
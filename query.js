@@ -0,0 +1,28 @@
+/* eslint-disable max-len */
+'use strict';
+const {queryState} = require('./lib/sqlite');
+const {init} = require('./setup');
+
+/**
+ * Runs an ad-hoc (read-only) query against the SQLite state, e.g.
+ * `node query.js "SELECT ran_at, severity FROM runs ORDER BY ran_at DESC LIMIT 10"`.
+ * The tables are `schedules`, `diffs`, and `runs`.
+ *
+ * Usage: node query.js "<SQL>"
+ */
+(async () => {
+  await init(); // connect to HCP Vault Secrets and populate environment variables
+  const sql = process.argv[2];
+  if (!sql) {
+    console.error('Usage: node query.js "SELECT ..."');
+    process.exit(1);
+  }
+  try {
+    const rows = queryState(sql);
+    console.table(rows);
+    console.log(`${rows.length} row(s)`);
+  } catch (e) {
+    console.error(e.message);
+    process.exit(1);
+  }
+})();
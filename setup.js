@@ -1,24 +1,123 @@
 /* eslint-disable max-len */
-const {retrieveApiToken, retrieveSecret} = require('./lib/vault');
+const config = require('./config');
+const {SecretCache} = require('./lib/secret_cache');
+const {SecretsManagerSource, ParameterStoreSource} = require('./lib/aws_secrets');
+const vault = require('./lib/vault');
+
+const REQUIRED_SECRETS = [
+  'TWITTER_CONSUMER_KEY',
+  'TWITTER_CONSUMER_SECRET',
+  'TWITTER_ACCESS_TOKEN_KEY',
+  'TWITTER_ACCESS_TOKEN_SECRET',
+  'TWITTER_USER_HANDLE',
+  'AWS_ACCESS_KEY_ID',
+  'AWS_SECRET_ACCESS_KEY',
+  'AWS_DEFAULT_REGION',
+  'AWS_S3_BUCKET',
+];
+
+const OPTIONAL_SECRETS = [
+  'BLUESKY_HANDLE',
+  'BLUESKY_APP_PASSWORD',
+  'MASTODON_INSTANCE_URL',
+  'MASTODON_ACCESS_TOKEN',
+  'TWILIO_ACCOUNT_SID',
+  'TWILIO_AUTH_TOKEN',
+];
+
+// The secrets are fetched once per process, and only fetched again when rotated
+let secretCache = null;
+
+// The optional secrets that came from the secrets source (rather than being set locally)
+const populatedOptionalSecrets = new Set();
+
+/**
+ * Determines where the secrets are read from: HCP Vault Secrets, a secret in
+ * AWS Secrets Manager, or the parameters under a path in AWS Systems Manager
+ * Parameter Store, in that order, depending on which is configured.
+ *
+ * @return {Object} the client of the secrets source, or null if none is configured
+ */
+function getSecretsSource() {
+  if (config.hcp_client_id) {
+    return vault;
+  }
+  if (config.aws_secrets_manager_secret_id) {
+    return new SecretsManagerSource(config.aws_secrets_manager_secret_id);
+  }
+  if (config.aws_ssm_parameter_path) {
+    return new ParameterStoreSource(config.aws_ssm_parameter_path);
+  }
+  return null;
+}
+
+/**
+ * Populates an environment variable from the secrets source only if the secret
+ * exists. Used for the optional integrations, so that a missing secret doesn't
+ * end up as the string "null" in the environment.
+ *
+ * @param {String} secretName the key of the secret (and environment variable)
+ */
+function populateOptionalSecret(secretName) {
+  if (process.env[secretName] && !populatedOptionalSecrets.has(secretName)) {
+    return; // already set locally (e.g. via .env), so don't override it
+  }
+  const value = secretCache.get(secretName);
+  if (value) {
+    process.env[secretName] = value;
+    populatedOptionalSecrets.add(secretName);
+  }
+}
+
+/**
+ * Populates the environment variables from the cached secrets.
+ */
+function populateSecrets() {
+  REQUIRED_SECRETS.forEach((secretName) => {
+    const value = secretCache.get(secretName);
+    if (value) {
+      process.env[secretName] = value;
+    }
+  });
+  OPTIONAL_SECRETS.forEach(populateOptionalSecret);
+}
 
 /**
- * Makes a call to HCP Vault Secrets and populates the environment variables
+ * Fetches the secrets from the secrets source (see `getSecretsSource()`) and
+ * populates the environment variables. Without a secrets source, the config
+ * comes from the environment variables, `.env`, and the plain YAML config
+ * file alone (see `lib/config_file.js`).
  *
  * @async
  */
 async function init() {
-  const apiToken = await retrieveApiToken();
-  process.env.TWITTER_CONSUMER_KEY = await retrieveSecret(apiToken, 'TWITTER_CONSUMER_KEY');
-  process.env.TWITTER_CONSUMER_SECRET = await retrieveSecret(apiToken, 'TWITTER_CONSUMER_SECRET');
-  process.env.TWITTER_ACCESS_TOKEN_KEY = await retrieveSecret(apiToken, 'TWITTER_ACCESS_TOKEN_KEY');
-  process.env.TWITTER_ACCESS_TOKEN_SECRET = await retrieveSecret(apiToken, 'TWITTER_ACCESS_TOKEN_SECRET');
-  process.env.TWITTER_USER_HANDLE = await retrieveSecret(apiToken, 'TWITTER_USER_HANDLE');
-  process.env.AWS_ACCESS_KEY_ID = await retrieveSecret(apiToken, 'AWS_ACCESS_KEY_ID');
-  process.env.AWS_SECRET_ACCESS_KEY = await retrieveSecret(apiToken, 'AWS_SECRET_ACCESS_KEY');
-  process.env.AWS_DEFAULT_REGION = await retrieveSecret(apiToken, 'AWS_DEFAULT_REGION');
-  process.env.AWS_S3_BUCKET = await retrieveSecret(apiToken, 'AWS_S3_BUCKET');
+  const source = getSecretsSource();
+  if (!source) {
+    return;
+  }
+  secretCache = new SecretCache(config.secrets_cache_ttl, source);
+  await secretCache.load();
+  populateSecrets();
+}
+
+/**
+ * Picks up rotated secrets, by checking the versions of the secrets once the
+ * cache has expired (see `SECRETS_CACHE_TTL`). The environment variables are
+ * only populated again when one of the secrets was rotated.
+ *
+ * @async
+ * @return {Boolean} true if the secrets were rotated
+ */
+async function refreshSecrets() {
+  if (!secretCache || !await secretCache.refresh()) {
+    return false;
+  }
+  populateSecrets();
+  return true;
 }
 
 module.exports = {
+  getSecretsSource,
   init,
+  refreshSecrets,
 };
@@ -0,0 +1,66 @@
+const expect = require('chai').expect;
+const {raceAbort, createDeadlineSignal, sleep, AbortableStore} = require('../lib/abort');
+
+describe('Abort Unit Tests', function() {
+  it(`resolves with the operation when not aborted`, async function() {
+    const controller = new AbortController();
+    expect(await raceAbort(Promise.resolve('done'), controller.signal)).to.equal('done');
+    expect(await raceAbort(Promise.resolve('done'), undefined)).to.equal('done');
+  });
+
+  it(`rejects with the reason as soon as the signal is aborted`, async function() {
+    const controller = new AbortController();
+    const pending = raceAbort(new Promise(() => {}), controller.signal);
+    controller.abort(new Error('stopped'));
+    let error = null;
+    try {
+      await pending;
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('stopped');
+  });
+
+  it(`wakes up from sleep early when aborted`, async function() {
+    const controller = new AbortController();
+    const start = Date.now();
+    setTimeout(() => controller.abort(new Error('stopped')), 10);
+    let error = null;
+    try {
+      await sleep(60000, controller.signal);
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('stopped');
+    expect(Date.now() - start).to.be.below(1000);
+  });
+
+  it(`aborts the deadline signal when the parent is aborted`, function() {
+    const controller = new AbortController();
+    const signal = createDeadlineSignal(controller.signal, 60000);
+    expect(signal.aborted).to.equal(false);
+    controller.abort(new Error('stopped'));
+    expect(signal.aborted).to.equal(true);
+  });
+
+  it(`stops making storage requests once aborted`, async function() {
+    const calls = [];
+    const store = {
+      upload: async (key) => calls.push(key),
+      download: async () => null,
+    };
+    const controller = new AbortController();
+    const abortable = new AbortableStore(store, controller.signal);
+    await abortable.upload('a.json', '{}');
+    controller.abort(new Error('stopped'));
+    let error = null;
+    try {
+      await abortable.upload('b.json', '{}');
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('stopped');
+    expect(calls).to.deep.equal(['a.json']);
+    expect(await abortable.getShareUrl('a.json')).to.equal(null);
+  });
+});
@@ -0,0 +1,29 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {createAllowlist, isAddressAllowed, isAdminRequestAuthorized} = require('../lib/access_control');
+
+describe('Access Control Unit Tests', function() {
+  it(`allows every address without an allowlist`, function() {
+    expect(createAllowlist([])).to.equal(null);
+    expect(isAddressAllowed('203.0.113.5', null)).to.equal(true);
+  });
+
+  it(`allows the addresses in the CIDR ranges`, function() {
+    const allowlist = createAllowlist(['192.168.1.0/24', '10.0.0.7', 'fd00::/8', 'not-an-address', '10.0.0.0/99']);
+    expect(isAddressAllowed('192.168.1.42', allowlist)).to.equal(true);
+    expect(isAddressAllowed('::ffff:192.168.1.42', allowlist)).to.equal(true);
+    expect(isAddressAllowed('10.0.0.7', allowlist)).to.equal(true);
+    expect(isAddressAllowed('fd12:3456::1', allowlist)).to.equal(true);
+    expect(isAddressAllowed('192.168.2.1', allowlist)).to.equal(false);
+    expect(isAddressAllowed('10.0.0.8', allowlist)).to.equal(false);
+    expect(isAddressAllowed(undefined, allowlist)).to.equal(false);
+  });
+
+  it(`requires a client certificate when mTLS is configured`, function() {
+    const allowlist = createAllowlist(['127.0.0.1/32']);
+    expect(isAdminRequestAuthorized({socket: {remoteAddress: '127.0.0.1'}}, allowlist, false)).to.equal(true);
+    expect(isAdminRequestAuthorized({socket: {remoteAddress: '127.0.0.1', authorized: false}}, allowlist, true)).to.equal(false);
+    expect(isAdminRequestAuthorized({socket: {remoteAddress: '127.0.0.1', authorized: true}}, allowlist, true)).to.equal(true);
+    expect(isAdminRequestAuthorized({socket: {remoteAddress: '192.168.1.1', authorized: true}}, allowlist, true)).to.equal(false);
+  });
+});
@@ -0,0 +1,51 @@
+const expect = require('chai').expect;
+const axios = require('axios');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {serializeSchedule, parseSchedule} = require('../lib/helper_functions');
+const {buildAdhocTeam, validatePayload, loadPreviousSchedule, processPayload} = require('../lib/adhoc');
+
+describe('Ad-hoc Payload Unit Tests', function() {
+  const scrape = {scraper: 'http', parser: 'json', itemsPath: 'events', dateField: 'date', detailsFields: ['details']};
+  let store;
+  let get;
+
+  beforeEach(function() {
+    store = new LocalStore(fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-')));
+    get = axios.get;
+  });
+
+  afterEach(function() {
+    axios.get = get;
+  });
+
+  it(`validates the payload`, function() {
+    expect(validatePayload({})).to.equal('Expected either `html` or `url`');
+    expect(validatePayload({url: 'file:///etc/passwd'})).to.match(/http\(s\) URL/);
+    expect(validatePayload({url: 'https://example.com/schedule', notify: true})).to.match(/`id`/);
+    expect(validatePayload({html: '<p>SATURDAY, 10/7</p>', previous: 'nope'})).to.match(/`previous`/);
+    expect(validatePayload({url: 'https://example.com/schedule', id: 'OtherTeamBot', notify: true})).to.equal(null);
+  });
+
+  it(`builds a team for the page`, function() {
+    expect(buildAdhocTeam({url: 'https://example.com/schedule'})).to.eql({id: 'adhoc', url: 'https://example.com/schedule', scrape: {}});
+  });
+
+  it(`compares against the payload's schedule or the stored one`, async function() {
+    expect((await loadPreviousSchedule({id: 'OtherTeamBot'}, store)).size).to.equal(0);
+    await serializeSchedule(parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\n', new Date('2023-10-01T12:00:00Z')), 'OtherTeamBot/previousSchedule.json', store);
+    expect([...(await loadPreviousSchedule({id: 'OtherTeamBot'}, store)).keys()]).to.eql(['SATURDAY, 10/07/2023']);
+    expect([...(await loadPreviousSchedule({id: 'OtherTeamBot', previous: {'Sunday, 10/8/2023': {location: 'Larz'}}}, store)).keys()]).to.eql(['SUNDAY, 10/08/2023']);
+  });
+
+  it(`parses and diffs a URL without saving anything`, async function() {
+    axios.get = async () => ({headers: {'content-type': 'application/json'}, data: JSON.stringify({events: [{date: '2023-10-07', details: 'Practice, Warren, 3:30-5:30'}]})});
+    const result = await processPayload({url: 'https://example.com/api/events', scrape, previous: {'SUNDAY, 10/08/2023': {location: 'Larz'}}}, null, store);
+    expect(Object.keys(result.schedule)).to.eql(['SATURDAY, 10/07/2023']);
+    expect(result.extraction).to.equal(null);
+    expect(result.changes).to.eql({added: ['SATURDAY, 10/07/2023'], deleted: ['SUNDAY, 10/08/2023'], modified: []});
+    expect(await store.list('')).to.eql([]);
+  });
+});
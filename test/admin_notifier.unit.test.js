@@ -0,0 +1,94 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore, PNG} = require('./fakes');
+const {TwitterError} = require('../lib/twitter');
+const {ScheduleSanityError} = require('../lib/sanity');
+const {notifyAdmins, sendTwitterDm, getLastScreenshot, classifyFailure, alertTeamFailure, FAILURE_ALERT_FILENAME} = require('../lib/admin_notifier');
+
+describe('Admin Notifier Unit Tests', function() {
+  const names = ['ADMIN_EMAIL', 'ADMIN_SLACK_WEBHOOK_URL', 'ADMIN_TWITTER_USER_ID', 'ADMIN_ALERT_REPEAT_HOURS', 'TWITTER_API_VERSION'];
+  const originals = {};
+  const team = {id: 'team', url: 'https://example.com/schedule'};
+
+  beforeEach(function() {
+    names.forEach((name) => {
+      originals[name] = process.env[name];
+      delete process.env[name];
+    });
+  });
+
+  afterEach(function() {
+    for (const name of names) {
+      if (originals[name] === undefined) {
+        delete process.env[name];
+      } else {
+        process.env[name] = originals[name];
+      }
+    }
+  });
+
+  it(`alerts on every configured channel, with the screenshot`, async function() {
+    process.env.ADMIN_EMAIL = 'admin@example.com';
+    process.env.ADMIN_SLACK_WEBHOOK_URL = 'https://hooks.slack.com/services/T/B/x';
+    process.env.ADMIN_TWITTER_USER_ID = '12345';
+    const emails = [];
+    const send = async (to, subject, text, attachments) => emails.push({to, subject, text, attachments}) && 'message-id';
+    const posts = [];
+    const http = {post: async (url, body) => posts.push({url, body})};
+    const dms = [];
+    const sendDm = async (text, screenshot) => dms.push({text, screenshot}) && true;
+    const sent = await notifyAdmins('Failed', 'The scrape failed.', {content: PNG, url: 'https://example.com/screenshot.png'}, send, http, sendDm);
+    expect(sent).to.eql(['email', 'slack', 'twitter']);
+    expect(emails[0].attachments).to.eql([{filename: 'screenshot.png', contentType: 'image/png', content: PNG}]);
+    expect(posts[0].body.text).to.equal('*Failed*\nThe scrape failed.\n<https://example.com/screenshot.png|Last screenshot>');
+    expect(dms).to.eql([{text: 'Failed\n\nThe scrape failed.', screenshot: PNG}]);
+
+    delete process.env.ADMIN_EMAIL;
+    delete process.env.ADMIN_SLACK_WEBHOOK_URL;
+    delete process.env.ADMIN_TWITTER_USER_ID;
+    expect(await notifyAdmins('Failed', 'The scrape failed.', null, send, http, sendDm)).to.eql([]);
+  });
+
+  it(`sends the Twitter DM with the screenshot`, async function() {
+    process.env.ADMIN_TWITTER_USER_ID = '12345';
+    const messages = [];
+    const client = {
+      v1: {uploadMedia: async () => 'media-1'},
+      v2: {sendDmToParticipant: async (participantId, message) => messages.push({participantId, message})},
+    };
+    process.env.TWITTER_API_VERSION = 'v1';
+    expect(await sendTwitterDm('The scrape failed.', PNG, client)).to.equal(true);
+    expect(messages).to.eql([{participantId: '12345', message: {text: 'The scrape failed.', attachments: [{media_id: 'media-1'}]}}]);
+  });
+
+  it(`classifies the failures`, function() {
+    expect(classifyFailure(new TwitterError('Unauthorized', 'unauthorized', 401), 'notify')).to.equal('credentials');
+    expect(classifyFailure(new TwitterError('Too Many Requests', 'rate_limited', 429), 'notify')).to.equal('notify');
+    expect(classifyFailure(new Error('net::ERR_NAME_NOT_RESOLVED'), 'scrape')).to.equal('scrape');
+    expect(classifyFailure(new Error('oops'), null)).to.equal('run');
+    expect(classifyFailure(new ScheduleSanityError('The page parsed to no entries'), 'diff')).to.equal('sanity');
+  });
+
+  it(`alerts with the last screenshot, once per failure a day`, async function() {
+    const store = new MemoryStore();
+    await store.upload('team/archive/schedule-2023-10-6-1696600000000.json', '{}');
+    await store.upload('team/archive/schedule-screenshot-2023-10-6-1696600000000.png', PNG);
+    expect((await getLastScreenshot('team', store)).key).to.equal('team/archive/schedule-screenshot-2023-10-6-1696600000000.png');
+    expect(await getLastScreenshot('other', store)).to.equal(null);
+
+    const alerts = [];
+    const notify = async (subject, text, screenshot) => alerts.push({subject, text, screenshot}) && ['email'];
+    const now = new Date('2023-10-07T12:00:00Z');
+    const error = new Error('net::ERR_NAME_NOT_RESOLVED');
+    expect(await alertTeamFailure(team, error, 'scrape', store, notify, now)).to.eql(['email']);
+    expect(alerts[0].subject).to.equal('Bandits notification: team failed (scrape)');
+    expect(alerts[0].text).to.equal('team (https://example.com/schedule) failed (scrape): net::ERR_NAME_NOT_RESOLVED.');
+    expect(alerts[0].screenshot.content).to.eql(PNG);
+    expect(JSON.parse(await store.download(`team/${FAILURE_ALERT_FILENAME}`))).to.eql({error: 'net::ERR_NAME_NOT_RESOLVED', kind: 'scrape', alertedAt: now.toISOString()});
+
+    expect(await alertTeamFailure(team, error, 'scrape', store, notify, new Date('2023-10-07T18:00:00Z'))).to.equal(null);
+    expect(await alertTeamFailure(team, new Error('Timed out'), 'scrape', store, notify, new Date('2023-10-07T18:00:00Z'))).to.eql(['email']);
+    expect(await alertTeamFailure(team, new Error('Timed out'), 'scrape', store, notify, new Date('2023-10-08T19:00:00Z'))).to.eql(['email']);
+    expect(alerts).to.have.lengthOf(3);
+  });
+});
@@ -0,0 +1,38 @@
+/* eslint-disable max-len */
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {LocalArtifactWriter, DryRunStore} = require('../lib/artifacts');
+
+describe('Artifacts Unit Tests', function() {
+  it(`keeps the writes of a dry run from reaching the store`, async function() {
+    const store = new MemoryStore();
+    await store.upload('team/previousSchedule.json', 'before');
+    await store.upload('team/archive/old.json', 'old');
+    const dryRun = new DryRunStore(store);
+    await dryRun.upload('team/previousSchedule.json', 'after');
+    await dryRun.upload('team/archive/new.json', 'new');
+    await dryRun.delete('team/archive/old.json');
+    expect((await dryRun.download('team/previousSchedule.json')).toString()).to.equal('after');
+    expect(await dryRun.exists('team/archive/old.json')).to.equal(false);
+    expect((await dryRun.list('team/archive/')).map((file) => file.key)).to.eql(['team/archive/new.json']);
+    expect(await dryRun.create('team/archive/new.json', 'again')).to.equal(false);
+    expect((await store.download('team/previousSchedule.json')).toString()).to.equal('before');
+    expect((await store.list('team/archive/')).map((file) => file.key)).to.eql(['team/archive/old.json']);
+  });
+
+  it(`writes the artifacts to the directory`, async function() {
+    const directory = fs.mkdtempSync(path.join(os.tmpdir(), 'artifacts-'));
+    try {
+      const artifacts = new LocalArtifactWriter(directory);
+      const filename = await artifacts.write('team/schedule.json', '{}');
+      expect(filename).to.equal(path.join(directory, 'team', 'schedule.json'));
+      expect(fs.readFileSync(filename, 'utf8')).to.equal('{}');
+      expect(artifacts.written).to.eql([filename]);
+    } finally {
+      fs.rmSync(directory, {recursive: true, force: true});
+    }
+  });
+});
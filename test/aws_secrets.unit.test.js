@@ -0,0 +1,54 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseSecretContents, SecretsManagerSource, ParameterStoreSource} = require('../lib/aws_secrets');
+
+describe('AWS Secrets Unit Tests', function() {
+  it(`parses JSON or YAML secrets`, function() {
+    expect(parseSecretContents('{"TWITTER_CONSUMER_KEY": "key", "AWS_S3_BUCKET": "bucket"}')).to.eql({TWITTER_CONSUMER_KEY: 'key', AWS_S3_BUCKET: 'bucket'});
+    expect(parseSecretContents('twitter:\n  consumer_key: key\naws:\n  s3_bucket: bucket\n')).to.eql({TWITTER_CONSUMER_KEY: 'key', AWS_S3_BUCKET: 'bucket'});
+  });
+
+  it(`reads the secrets from Secrets Manager`, async function() {
+    const requests = [];
+    const client = {
+      getSecretValue: (params) => {
+        requests.push(params);
+        return {promise: async () => ({SecretString: 'twitter:\n  user_handle: BlineBanditsBot\n', VersionId: 'v1'})};
+      },
+    };
+    const source = new SecretsManagerSource('banditsNotification/secrets', client);
+    expect(await source.retrieveApiToken()).to.equal(true);
+    expect(await source.retrieveSecrets()).to.eql(new Map([['TWITTER_USER_HANDLE', {value: 'BlineBanditsBot', version: 'v1'}]]));
+    expect(await source.retrieveSecretVersions()).to.eql(new Map([['TWITTER_USER_HANDLE', 'v1']]));
+    expect(requests[0]).to.eql({SecretId: 'banditsNotification/secrets'});
+  });
+
+  it(`returns null when the secret can't be read`, async function() {
+    const client = {getSecretValue: () => ({promise: async () => {
+      throw new Error('AccessDeniedException');
+    }})};
+    expect(await new SecretsManagerSource('missing', client).retrieveSecrets()).to.equal(null);
+  });
+
+  it(`reads the secrets from the pages of parameters`, async function() {
+    const pages = [
+      {Parameters: [{Name: '/banditsNotification/TWITTER_CONSUMER_KEY', Value: 'key', Version: 2}], NextToken: 'next'},
+      {Parameters: [{Name: '/banditsNotification/secrets.yaml', Value: 'aws:\n  s3_bucket: bucket\n', Version: 1}]},
+    ];
+    const requests = [];
+    const client = {
+      getParametersByPath: (params) => {
+        requests.push(params);
+        return {promise: async () => pages[requests.length - 1]};
+      },
+    };
+    const source = new ParameterStoreSource('/banditsNotification/', client);
+    expect(await source.retrieveSecrets()).to.eql(new Map([
+      ['TWITTER_CONSUMER_KEY', {value: 'key', version: '/banditsNotification/TWITTER_CONSUMER_KEY:2'}],
+      ['AWS_S3_BUCKET', {value: 'bucket', version: '/banditsNotification/secrets.yaml:1'}],
+    ]));
+    expect(requests.map((params) => params.NextToken)).to.eql([undefined, 'next']);
+    expect(requests[0].Path).to.equal('/banditsNotification');
+    expect(requests[0].WithDecryption).to.equal(true);
+  });
+});
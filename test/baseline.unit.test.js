@@ -0,0 +1,56 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {serializeSchedule} = require('../lib/helper_functions');
+const {EntryDiffer} = require('../lib/differ');
+const {buildNetChanges, recordNetChanges, loadNetChanges} = require('../lib/baseline');
+
+describe('Baseline Unit Tests', function() {
+  let rootPath;
+  let store;
+  const now = new Date('2023-10-09T12:00:00Z');
+  const baselineSchedule = new Map([
+    ['SATURDAY, 10/7', {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Practice, Warren', timeBlock: '3:00-5:30'}],
+    ['SUNDAY, 10/8', {dayOfWeek: 'SUNDAY', dayOfMonth: '10/8', location: 'Game, Downes', timeBlock: '1:00-3:00'}],
+  ]);
+  // Changed back and forth during the week, which nets out to a single change
+  const schedule = new Map([
+    ['SATURDAY, 10/7', {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Practice, Warren', timeBlock: '3:00-5:30'}],
+    ['SUNDAY, 10/8', {dayOfWeek: 'SUNDAY', dayOfMonth: '10/8', location: 'Game, Larz', timeBlock: '1:00-3:00'}],
+  ]);
+
+  beforeEach(function() {
+    rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    store = new LocalStore(rootPath);
+  });
+
+  afterEach(function() {
+    fs.rmSync(rootPath, {recursive: true, force: true});
+  });
+
+  it(`builds the net changes against the baseline`, function() {
+    const netChanges = buildNetChanges({timestamp: new Date('2023-10-01T12:00:00Z'), schedule: baselineSchedule}, schedule, now, 7, new EntryDiffer());
+    expect(netChanges.baselineAt).to.equal('2023-10-01T12:00:00.000Z');
+    expect(netChanges.summary).to.equal('1 modified');
+    expect(netChanges.added).to.eql([]);
+    expect(netChanges.modified).to.eql([{key: 'SUNDAY, 10/8', previous: {location: 'Game, Downes', timeBlock: '1:00-3:00'}, current: {location: 'Game, Larz', timeBlock: '1:00-3:00'}}]);
+  });
+
+  it(`records the net changes since the schedule as of N days ago`, async function() {
+    await serializeSchedule(baselineSchedule, `team/archive/schedule-${new Date('2023-10-01T12:00:00Z').getTime()}.json`, store);
+    await serializeSchedule(new Map(), `team/archive/schedule-${new Date('2023-10-05T12:00:00Z').getTime()}.json`, store);
+    const netChanges = await recordNetChanges('team', schedule, store, now, 7);
+    expect(netChanges.baselineAt).to.equal('2023-10-01T12:00:00.000Z');
+    expect(await loadNetChanges('team', store)).to.eql(netChanges);
+  });
+
+  it(`skips the net changes without a baseline`, async function() {
+    await serializeSchedule(baselineSchedule, `team/archive/schedule-${new Date('2023-10-05T12:00:00Z').getTime()}.json`, store);
+    expect(await recordNetChanges('team', schedule, store, now, 7)).to.equal(null);
+    expect(await recordNetChanges('team', schedule, store, now, null)).to.equal(null);
+    expect(await loadNetChanges('team', store)).to.equal(null);
+  });
+});
@@ -0,0 +1,76 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {getBlueskySettings, detectLinkFacets, checkBluesky} = require('../lib/bluesky');
+
+describe('Bluesky Unit Tests', function() {
+  const names = ['BLUESKY_HANDLE', 'BLUESKY_APP_PASSWORD', 'BLUESKY_SERVICE'];
+  const originals = {};
+
+  beforeEach(function() {
+    names.forEach((name) => {
+      originals[name] = process.env[name];
+      delete process.env[name];
+    });
+  });
+
+  afterEach(function() {
+    for (const name of names) {
+      if (originals[name] === undefined) {
+        delete process.env[name];
+      } else {
+        process.env[name] = originals[name];
+      }
+    }
+  });
+
+  it(`configures the account per team`, function() {
+    expect(getBlueskySettings({id: 'team'})).to.equal(null);
+    const own = {handle: 'bandits10u.bsky.social', appPassword: 'own-password', service: 'https://pds.example.com'};
+    expect(getBlueskySettings({id: 'team', bluesky: own})).to.eql(own);
+    process.env.BLUESKY_HANDLE = 'banditsbot.bsky.social';
+    process.env.BLUESKY_APP_PASSWORD = 'default-password';
+    expect(getBlueskySettings({id: 'team'})).to.eql({handle: 'banditsbot.bsky.social', appPassword: 'default-password', service: 'https://bsky.social'});
+    expect(getBlueskySettings({id: 'team', bluesky: {handle: 'bandits10u.bsky.social', appPassword: 'own-password'}})).to.eql({handle: 'bandits10u.bsky.social', appPassword: 'own-password', service: 'https://bsky.social'});
+  });
+
+  it(`checks that each account can sign in`, async function() {
+    process.env.BLUESKY_HANDLE = 'banditsbot.bsky.social';
+    process.env.BLUESKY_APP_PASSWORD = 'default-password';
+    const teams = [{id: 'team'}, {id: 'other', bluesky: {handle: 'bandits10u.bsky.social', appPassword: 'own-password'}}];
+    const signedIn = [];
+    const signIn = async (handle, appPassword) => {
+      signedIn.push(handle);
+      return appPassword === 'wrong' ? null : {accessJwt: 'jwt', did: 'did:plc:bandits'};
+    };
+    expect(await checkBluesky(teams, signIn)).to.equal('banditsbot.bsky.social, bandits10u.bsky.social');
+    expect(signedIn).to.eql(['banditsbot.bsky.social', 'bandits10u.bsky.social']);
+
+    let error = null;
+    try {
+      await checkBluesky([{id: 'team', bluesky: {handle: 'bandits10u.bsky.social', appPassword: 'wrong'}}], signIn);
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('Unable to create a session for bandits10u.bsky.social');
+  });
+
+  it(`detects the link in the post text as a facet`, function() {
+    const text = 'Latest Bandits 12U Schedule. https://www.brooklinebaseball.net/bandits12u #bandits12u';
+    const facets = detectLinkFacets(text);
+    expect(facets.length).to.equal(1);
+    expect(facets[0].index.byteStart).to.equal(29);
+    expect(facets[0].index.byteEnd).to.equal(73);
+    expect(facets[0].features[0].uri).to.equal('https://www.brooklinebaseball.net/bandits12u');
+  });
+
+  it(`uses UTF-8 byte offsets rather than character offsets`, function() {
+    const text = '⚾ Update: https://example.com';
+    const facets = detectLinkFacets(text);
+    expect(facets[0].index.byteStart).to.equal(12); // ⚾ is 3 bytes in UTF-8
+    expect(facets[0].index.byteEnd).to.equal(31);
+  });
+
+  it(`returns no facets when there are no links`, function() {
+    expect(detectLinkFacets('No links here #bandits12u').length).to.equal(0);
+  });
+});
@@ -0,0 +1,58 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {checkWebhooks, checkEmail, checkTwilio, checkChannels, formatChannelMatrix} = require('../lib/channel_health');
+
+describe('Channel Health Unit Tests', function() {
+  it(`checks that the webhooks still exist`, async function() {
+    const statuses = {'https://discord.com/api/webhooks/1/abc': 404, 'https://example.com/hook': 405, 'https://hooks.example.com/ok': 200};
+    const http = {head: async (url) => ({status: statuses[url]})};
+    expect(await checkWebhooks([{url: 'https://example.com/hook'}, {url: 'https://hooks.example.com/ok'}], http)).to.equal('2 reachable');
+    let error = null;
+    try {
+      await checkWebhooks([{url: 'https://discord.com/api/webhooks/1/abc'}, {url: 'https://example.com/hook'}], http);
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('1 of 2 webhooks unreachable: discord.com responded 404');
+  });
+
+  it(`checks whether SES can send and is in the sandbox`, async function() {
+    const ses = (account) => ({getAccount: () => ({promise: async () => account})});
+    expect(await checkEmail(ses({SendingEnabled: true, ProductionAccessEnabled: true}))).to.equal('production');
+    expect(await checkEmail(ses({SendingEnabled: true, ProductionAccessEnabled: false}))).to.match(/^sandbox/);
+    let error = null;
+    try {
+      await checkEmail(ses({SendingEnabled: false}));
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('Sending is disabled for the account');
+  });
+
+  it(`checks that the Twilio account is active`, async function() {
+    expect(await checkTwilio({get: async () => ({data: {status: 'active'}})})).to.equal('account active');
+    let error = null;
+    try {
+      await checkTwilio({get: async () => ({data: {status: 'suspended'}})});
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('The account is suspended');
+  });
+
+  it(`reports the readiness of each channel`, async function() {
+    const results = await checkChannels({
+      twitter: {configured: () => true, check: async () => '@BlineBanditsBot'},
+      webhook: {configured: () => true, check: async () => {
+        throw new Error('1 of 1 webhooks unreachable');
+      }},
+      sms: {configured: () => false, check: async () => 'unused'},
+    });
+    expect(results).to.eql([
+      {name: 'twitter', status: 'ready', detail: '@BlineBanditsBot'},
+      {name: 'webhook', status: 'failed', detail: '1 of 1 webhooks unreachable'},
+      {name: 'sms', status: 'not configured', detail: null},
+    ]);
+    expect(formatChannelMatrix(results)).to.equal('twitter  ready (@BlineBanditsBot)\nwebhook  failed (1 of 1 webhooks unreachable)\nsms      not configured');
+  });
+});
@@ -0,0 +1,118 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const crypto = require('crypto');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {serializeSchedule} = require('../lib/helper_functions');
+const {signArchivedFiles} = require('../lib/signing');
+const {COMMANDS, parseArgs, resolveTeam, selectTeams, formatUsage} = require('../lib/cli');
+
+describe('CLI Unit Tests', function() {
+  const teams = [{id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u'}];
+  const key = 'SATURDAY, 10/7';
+  const practice = {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Practice, Warren', timeBlock: '3:00–5:30'};
+  const originalTeams = process.env.TEAMS;
+  let rootPath;
+  let store;
+  let lines;
+  const output = (line) => lines.push(line);
+
+  beforeEach(async function() {
+    rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    store = new LocalStore(rootPath);
+    lines = [];
+    process.env.TEAMS = JSON.stringify(teams);
+    await serializeSchedule(new Map([[key, practice]]), 'BlineBanditsBot/archive/schedule-2023-10-1-1696190000000.json', store);
+    await serializeSchedule(new Map([[key, {...practice, timeBlock: '3:30–5:30'}]]), 'BlineBanditsBot/archive/schedule-2023-10-3-1696360000000.json', store);
+  });
+
+  afterEach(function() {
+    if (originalTeams === undefined) {
+      delete process.env.TEAMS;
+    } else {
+      process.env.TEAMS = originalTeams;
+    }
+    fs.rmSync(rootPath, {recursive: true, force: true});
+  });
+
+  it(`parses the flags and positional arguments`, function() {
+    expect(parseArgs(['--url', 'team', 'SATURDAY,', '9/6', '--once', '--at=2023-10-06'], ['once'])).to.eql({
+      flags: {url: 'team', once: true, at: '2023-10-06'},
+      positionals: ['SATURDAY,', '9/6'],
+    });
+  });
+
+  it(`resolves the team by id or URL`, function() {
+    expect(resolveTeam(undefined, teams)).to.equal(teams[0]);
+    expect(resolveTeam('https://www.brooklinebaseball.net/bandits12u', teams)).to.equal(teams[0]);
+    expect(resolveTeam('https://example.com/schedule', teams)).to.eql({id: 'preview', url: 'https://example.com/schedule'});
+    expect(resolveTeam('OtherTeamBot', teams)).to.equal(null);
+  });
+
+  it(`selects only the given teams`, function() {
+    const more = [...teams, {id: 'OtherTeamBot', url: 'https://example.com/schedule'}];
+    expect(selectTeams(more, undefined)).to.equal(more);
+    expect(selectTeams(more, 'OtherTeamBot')).to.eql([more[1]]);
+    expect(selectTeams(more, 'https://www.brooklinebaseball.net/bandits12u, OtherTeamBot')).to.eql(more);
+    expect(selectTeams(more, 'MissingBot')).to.eql([]);
+  });
+
+  it(`lists the subcommands`, function() {
+    const usage = formatUsage();
+    for (const name of ['check', 'diff', 'history', 'restore', 'preview', 'post']) {
+      expect(usage).to.contain(`  ${name}`);
+    }
+    expect(formatUsage('diff')).to.equal('Usage: node cli.js diff [--url <team id>] <from> <to>');
+  });
+
+  it(`compares the archived schedules as of two dates`, async function() {
+    expect(await COMMANDS.diff.run(parseArgs(['--url', 'BlineBanditsBot', '2023-10-02T00:00:00Z', '2023-10-04T00:00:00Z']), store, output)).to.equal(0);
+    expect(lines[1]).to.match(/^1 modified/);
+    expect(await COMMANDS.diff.run(parseArgs(['--url', 'BlineBanditsBot', '2023-10-02']), store, output)).to.equal(2);
+  });
+
+  it(`lists the archived schedules and screenshots`, async function() {
+    await store.upload('BlineBanditsBot/archive/schedule-screenshot-2023-10-1-1696190000000.png', Buffer.from('png'));
+    await store.upload('BlineBanditsBot/archive/schedule-screenshot-2023-10-3-1696360000000.png.pointer', JSON.stringify({target: 'BlineBanditsBot/archive/schedule-screenshot-2023-10-1-1696190000000.png'}));
+    expect(await COMMANDS.history.run(parseArgs(['--url', 'BlineBanditsBot']), store, output)).to.equal(0);
+    expect(lines).to.have.lengthOf(2);
+    expect(lines[0]).to.match(/^#1 .* - 1 entries, 1 added, screenshot BlineBanditsBot\/archive\/schedule-screenshot-2023-10-1-1696190000000.png$/);
+    expect(lines[1]).to.match(/^#2 .* - 1 entries, 1 modified, screenshot same as #1$/);
+  });
+
+  it(`compares two of the archived schedules`, async function() {
+    expect(await COMMANDS.history.run(parseArgs(['--url', 'BlineBanditsBot', '--from', '1', '--to', '2']), store, output)).to.equal(0);
+    expect(lines[0]).to.match(/^BlineBanditsBot: #1 .* → #2 /);
+    expect(lines[1]).to.match(/^1 modified/);
+    expect(await COMMANDS.history.run(parseArgs(['--url', 'BlineBanditsBot', '--from', '1', '--to', '3']), store, output)).to.equal(2);
+  });
+
+  it(`shows how an event changed, whichever way its date is typed`, async function() {
+    await serializeSchedule(new Map([['SATURDAY, 09/06/2025', {...practice, dayOfMonth: '9/6'}]]), 'BlineBanditsBot/archive/schedule-2025-9-1-1756700000000.json', store);
+    expect(await COMMANDS.history.run(parseArgs(['--url', 'BlineBanditsBot', 'saturday,', '9/6']), store, output)).to.equal(0);
+    expect(lines[0]).to.not.contain('No history found');
+    expect(lines.join('\n')).to.contain('Practice, Warren');
+  });
+
+  it(`prunes the archive past the retention policy`, async function() {
+    expect(await COMMANDS.prune.run(parseArgs(['--url', 'BlineBanditsBot', '--max-versions', '1', '--dry-run'], ['dry-run']), store, output)).to.equal(0);
+    expect(lines).to.eql(['Would delete BlineBanditsBot/archive/schedule-2023-10-1-1696190000000.json', 'Would prune 1 files of the 2 archived versions of BlineBanditsBot.']);
+    expect(await COMMANDS.prune.run(parseArgs(['--url', 'BlineBanditsBot', '--max-versions', '1'], ['dry-run']), store, output)).to.equal(0);
+    expect(await store.exists('BlineBanditsBot/archive/schedule-2023-10-1-1696190000000.json')).to.equal(false);
+  });
+
+  it(`verifies the archive against its signatures`, async function() {
+    const {privateKey, publicKey} = crypto.generateKeyPairSync('ed25519');
+    const keyPath = path.join(rootPath, 'archive.pub');
+    fs.writeFileSync(keyPath, publicKey.export({type: 'spki', format: 'pem'}));
+    await signArchivedFiles(['BlineBanditsBot/archive/schedule-2023-10-1-1696190000000.json', 'BlineBanditsBot/archive/schedule-2023-10-3-1696360000000.json'], store, privateKey);
+    expect(await COMMANDS['verify-archive'].run(parseArgs(['--url', 'BlineBanditsBot', '--key', keyPath]), store, output)).to.equal(0);
+    expect(lines).to.eql(['BlineBanditsBot: 2 verified, 0 tampered, 0 unsigned.']);
+    lines = [];
+    await store.upload('BlineBanditsBot/archive/schedule-2023-10-1-1696190000000.json', '{}');
+    expect(await COMMANDS['verify-archive'].run(parseArgs(['--url', 'BlineBanditsBot', '--key', keyPath]), store, output)).to.equal(1);
+    expect(lines).to.eql(['TAMPERED BlineBanditsBot/archive/schedule-2023-10-1-1696190000000.json (the contents changed since they were signed)', 'BlineBanditsBot: 1 verified, 1 tampered, 0 unsigned.']);
+  });
+});
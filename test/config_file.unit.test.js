@@ -0,0 +1,89 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {interpolate, parseYaml, flattenConfig, loadConfigFile} = require('../lib/config_file');
+
+describe('Config File Unit Tests', function() {
+  const yaml = `# Local development config
+twitter:
+  user_handle: BlineBanditsBot  # the bot
+  access_token_secret: \${TOKEN_SECRET}
+aws:
+  s3_bucket: \${S3_BUCKET:-bandits-notification}
+run_interval: 5m
+watermark_enabled: true
+teams:
+  - id: BlineBanditsBot
+    url: https://www.brooklinebaseball.net/bandits12u#schedule
+    watermark: false
+    scrape: {"parser": "text"}
+  - id: OtherTeamBot
+    url: "https://example.com/schedule"
+sms_phone_numbers:
+  - '+15555550100'
+  - '+15555550101'
+`;
+
+  it(`interpolates the environment variables`, function() {
+    expect(interpolate('${A}/${B:-b}/${C}', {A: 'a', C: ''})).to.equal('a/b/');
+  });
+
+  it(`parses the YAML config`, function() {
+    expect(parseYaml(yaml, {TOKEN_SECRET: 'secret'})).to.eql({
+      twitter: {user_handle: 'BlineBanditsBot', access_token_secret: 'secret'},
+      aws: {s3_bucket: 'bandits-notification'},
+      run_interval: '5m',
+      watermark_enabled: true,
+      teams: [
+        {id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u#schedule', watermark: false, scrape: {parser: 'text'}},
+        {id: 'OtherTeamBot', url: 'https://example.com/schedule'},
+      ],
+      sms_phone_numbers: ['+15555550100', '+15555550101'],
+    });
+    expect(() => parseYaml('aws:\n  s3_bucket: a\n    region: b', {})).to.throw('Invalid YAML indentation at line 3');
+  });
+
+  it(`rejects the YAML that it doesn't support, rather than misreading it`, function() {
+    expect(() => parseYaml('sms_phone_numbers: [+15555550100, +15555550101]', {})).to.throw('Invalid YAML at line 1: flow collections must be JSON');
+    expect(parseYaml('sms_phone_numbers: ["+15555550100", "+15555550101"]', {})).to.eql({sms_phone_numbers: ['+15555550100', '+15555550101']});
+    expect(() => parseYaml('"aws": {}', {})).to.throw('Unsupported YAML at line 1 (quoted and complex keys aren\'t supported)');
+    expect(() => parseYaml('defaults: &defaults\n  watermark: false', {})).to.throw('anchors and aliases aren\'t supported');
+    expect(() => parseYaml('teams:\n  - *defaults', {})).to.throw('Unsupported YAML at line 2 (anchors and aliases aren\'t supported)');
+    expect(() => parseYaml('message: |\n  Line one\n  Line two', {})).to.throw('multi-line strings aren\'t supported');
+    expect(() => parseYaml('message: "Line one\n  Line two"', {})).to.throw('quoted strings must be on a single line');
+    expect(() => parseYaml('message: Line one\n  Line two', {})).to.throw('Invalid YAML indentation at line 2');
+    expect(() => parseYaml('secret: !vault token', {})).to.throw('tags aren\'t supported');
+  });
+
+  it(`flattens the config into environment variables`, function() {
+    expect(flattenConfig(parseYaml(yaml, {}))).to.eql({
+      TWITTER_USER_HANDLE: 'BlineBanditsBot',
+      AWS_S3_BUCKET: 'bandits-notification',
+      RUN_INTERVAL: '5m',
+      WATERMARK_ENABLED: 'true',
+      TEAMS: JSON.stringify([
+        {id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u#schedule', watermark: false, scrape: {parser: 'text'}},
+        {id: 'OtherTeamBot', url: 'https://example.com/schedule'},
+      ]),
+      SMS_PHONE_NUMBERS: '+15555550100,+15555550101',
+    });
+  });
+
+  it(`loads the file without overriding the environment`, function() {
+    const rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    try {
+      const filepath = path.join(rootPath, 'config.yaml');
+      fs.writeFileSync(filepath, yaml);
+      const env = {RUN_INTERVAL: '600', BANDITS_AWS__S3_BUCKET: 'other-bucket'};
+      loadConfigFile(filepath, env);
+      expect(env.RUN_INTERVAL).to.equal('600');
+      expect(env.TWITTER_USER_HANDLE).to.equal('BlineBanditsBot');
+      expect(env.AWS_S3_BUCKET).to.equal('other-bucket');
+      expect(loadConfigFile(path.join(rootPath, 'missing.yaml'), {})).to.eql({});
+    } finally {
+      fs.rmSync(rootPath, {recursive: true, force: true});
+    }
+  });
+});
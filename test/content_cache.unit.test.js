@@ -0,0 +1,61 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {hashScheduleContent, hashTeamState, loadContentCache, saveContentCache, precheckPage, isPageUnchanged} = require('../lib/content_cache');
+const {getScrapeSettings} = require('../lib/scrape');
+
+describe('Content Cache Unit Tests', function() {
+  const team = {id: 'team', url: 'https://example.com/schedule', scrape: {parser: 'text'}};
+
+  it(`hashes the schedule section with the scrape settings`, function() {
+    const settings = getScrapeSettings(team);
+    const hash = hashScheduleContent({html: '', text: 'SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\nSpring Season'}, settings);
+    expect(hashScheduleContent({html: '', text: 'SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\nSpring Season and more'}, settings)).to.equal(hash);
+    expect(hashScheduleContent({html: '', text: 'SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\n'}, settings)).to.not.equal(hash);
+    expect(hashScheduleContent({html: '', text: 'SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\nSpring Season'}, getScrapeSettings({...team, scrape: {parser: 'text', endMarkers: []}}))).to.not.equal(hash);
+  });
+
+  it(`changes the state hash when the previous schedule or the overrides change`, async function() {
+    const store = new MemoryStore({'team/previousSchedule.json': '{}'});
+    const hash = await hashTeamState('team', store);
+    await store.upload('team/overrides.json', '{}');
+    expect(await hashTeamState('team', store)).to.not.equal(hash);
+  });
+
+  it(`saves and loads the cache`, async function() {
+    const store = new MemoryStore();
+    expect(await loadContentCache('team', store)).to.eql({});
+    await saveContentCache('team', {contentHash: 'abc', etag: '"1"'}, store, new Date('2023-10-06T12:00:00Z'));
+    expect(await loadContentCache('team', store)).to.eql({contentHash: 'abc', etag: '"1"', checkedAt: '2023-10-06T12:00:00.000Z'});
+  });
+
+  it(`prechecks the page by its validators, or else its hash`, async function() {
+    const requests = [];
+    const http = {
+      head: async (url) => {
+        requests.push(`HEAD ${url}`);
+        return {status: 200, headers: {}};
+      },
+      get: async (url) => {
+        requests.push(`GET ${url}`);
+        return {status: 200, headers: {}, data: '<html>schedule</html>'};
+      },
+    };
+    const validators = await precheckPage(team, undefined, http);
+    expect(requests).to.eql(['HEAD https://example.com/schedule', 'GET https://example.com/schedule']);
+    expect(validators.pageHash).to.be.a('string');
+    expect(isPageUnchanged({pageHash: validators.pageHash}, validators)).to.equal(true);
+
+    http.head = async () => ({status: 200, headers: {'etag': '"2"', 'last-modified': 'Fri, 06 Oct 2023 12:00:00 GMT'}});
+    expect(await precheckPage(team, undefined, http)).to.eql({etag: '"2"', lastModified: 'Fri, 06 Oct 2023 12:00:00 GMT', pageHash: null});
+    expect(isPageUnchanged({etag: '"1"', lastModified: 'Fri, 06 Oct 2023 12:00:00 GMT'}, {etag: '"2"', lastModified: 'Fri, 06 Oct 2023 12:00:00 GMT'})).to.equal(false);
+    expect(isPageUnchanged({lastModified: 'Fri, 06 Oct 2023 12:00:00 GMT'}, {etag: '"2"', lastModified: 'Fri, 06 Oct 2023 12:00:00 GMT'})).to.equal(true);
+    expect(isPageUnchanged({}, {etag: '"2"'})).to.equal(false);
+
+    http.head = async () => {
+      throw new Error('timeout of 30000ms exceeded');
+    };
+    expect(await precheckPage(team, undefined, http)).to.equal(null);
+    expect(isPageUnchanged({etag: '"2"'}, null)).to.equal(false);
+  });
+});
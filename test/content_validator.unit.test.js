@@ -0,0 +1,43 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {getWeightedLength, shortenPost, validatePost} = require('../lib/content_validator');
+
+describe('Content Validator Unit Tests', function() {
+  const text = 'Latest Bandits 12U Schedule as of Friday, October 6th 2023, 4:00:00 pm. https://www.brooklinebaseball.net/bandits12u #bandits12u';
+  const options = {maxLength: 280, maxUrls: 2, bannedWords: [], recentPosts: [], duplicateWindowHours: 24, now: new Date('2023-10-06T20:00:00Z')};
+
+  it(`counts URLs as a fixed length`, function() {
+    expect(getWeightedLength('see https://www.brooklinebaseball.net/bandits12u')).to.equal(27);
+  });
+
+  it(`accepts a valid post without adjustments`, function() {
+    const result = validatePost(text, options);
+    expect(result.valid).to.be.true;
+    expect(result.text).to.equal(text);
+    expect(result.errors.length).to.equal(0);
+    expect(result.adjustments.length).to.equal(0);
+  });
+
+  it(`shortens a long post while keeping the URL and hashtags`, function() {
+    const result = validatePost(text, {...options, maxLength: 60});
+    expect(result.valid).to.be.true;
+    expect(result.adjustments.length).to.equal(1);
+    expect(getWeightedLength(result.text)).to.be.at.most(60);
+    expect(result.text.endsWith('… https://www.brooklinebaseball.net/bandits12u #bandits12u')).to.be.true;
+    expect(shortenPost('Hello world https://example.com', 20)).to.equal(null); // URL alone doesn't fit
+  });
+
+  it(`blocks posts with too many URLs or banned words`, function() {
+    const result = validatePost(`${text} https://a.com https://b.com`, {...options, bannedWords: ['Bandits']});
+    expect(result.valid).to.be.false;
+    expect(result.errors.length).to.equal(2);
+    expect(result.errors[0]).to.include('3 URLs');
+    expect(result.errors[1]).to.include('banned words: Bandits');
+  });
+
+  it(`blocks duplicate posts within the window`, function() {
+    const recentPosts = [{text: text.toUpperCase(), timestamp: '2023-10-06T10:00:00.000Z'}];
+    expect(validatePost(text, {...options, recentPosts}).valid).to.be.false;
+    expect(validatePost(text, {...options, recentPosts, duplicateWindowHours: 6}).valid).to.be.true;
+  });
+});
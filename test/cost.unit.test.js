@@ -0,0 +1,47 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {CostTracker, TrackedStore, estimateCost, recordMonthlyCosts} = require('../lib/cost');
+const {LocalStore} = require('../lib/storage');
+
+describe('Cost Unit Tests', function() {
+  const prices = {storageRead: 0.0000004, storageWrite: 0.000005, sms: 0.01, computeSecond: 0.001};
+
+  it(`estimates the cost of the recorded operations`, function() {
+    const result = estimateCost({storageRead: 1000, storageWrite: 1000, sms: 2, twitterCall: 2}, prices);
+    expect(result.breakdown.storageRead).to.be.closeTo(0.0004, 1e-9);
+    expect(result.breakdown.storageWrite).to.be.closeTo(0.005, 1e-9);
+    expect(result.breakdown.twitterCall).to.equal(0); // unpriced operations are free
+    expect(result.total).to.be.closeTo(0.0254, 1e-9);
+  });
+
+  it(`records the compute time when the run finishes`, function() {
+    const tracker = new CostTracker(new Date('2023-10-06T20:00:00Z'));
+    tracker.finish(new Date('2023-10-06T20:00:30Z'));
+    expect(tracker.counts.computeSecond).to.equal(30);
+    expect(tracker.estimate(prices).total).to.be.closeTo(0.03, 1e-9);
+  });
+
+  it(`counts storage requests and aggregates them monthly`, async function() {
+    const rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    try {
+      const store = new LocalStore(rootPath);
+      for (let run = 0; run < 2; run++) {
+        const tracker = new CostTracker(new Date('2023-10-06T20:00:00Z'));
+        const trackedStore = new TrackedStore(store, tracker);
+        await trackedStore.upload('team/previousSchedule.json', '{}');
+        await trackedStore.exists('team/previousSchedule.json');
+        await trackedStore.download('team/previousSchedule.json');
+        expect(tracker.counts).to.eql({storageWrite: 1, storageRead: 2});
+        const totals = await recordMonthlyCosts(store, 'team', tracker);
+        expect(totals.runs).to.equal(run + 1);
+      }
+      const totals = JSON.parse(await store.download('team/costs/2023-10.json'));
+      expect(totals.counts).to.eql({storageWrite: 2, storageRead: 4});
+    } finally {
+      fs.rmSync(rootPath, {recursive: true, force: true});
+    }
+  });
+});
@@ -0,0 +1,63 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {fingerprintCredentials, verifyCredentials, getCredentialAlerts, isCredentialCheckDue} = require('../lib/credentials');
+
+describe('Credentials Unit Tests', function() {
+  let rootPath;
+  let store;
+  let values;
+  let working;
+  const sets = {
+    twitter: {values: () => values, check: async () => {
+      if (!working) {
+        throw new Error('401 Unauthorized');
+      }
+    }},
+    bluesky: {values: () => [undefined], check: async () => {}},
+  };
+
+  beforeEach(function() {
+    rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    store = new LocalStore(rootPath);
+    values = ['key', 'secret'];
+    working = true;
+  });
+
+  afterEach(function() {
+    fs.rmSync(rootPath, {recursive: true, force: true});
+  });
+
+  it(`fingerprints the credentials without keeping them`, function() {
+    expect(fingerprintCredentials(['key', 'secret'])).to.have.lengthOf(12);
+    expect(fingerprintCredentials(['key', 'secret'])).to.not.equal(fingerprintCredentials(['key', 'rotated']));
+  });
+
+  it(`records the health of the configured credentials`, async function() {
+    await verifyCredentials(sets, store, new Date('2023-10-01T12:00:00Z'));
+    working = false;
+    const health = await verifyCredentials(sets, store, new Date('2023-10-02T12:00:00Z'));
+    expect(Object.keys(health)).to.eql(['twitter']);
+    expect(health.twitter).to.include({firstSeenAt: '2023-10-01T12:00:00.000Z', lastSuccessAt: '2023-10-01T12:00:00.000Z', lastFailureAt: '2023-10-02T12:00:00.000Z', lastError: '401 Unauthorized'});
+    expect(getCredentialAlerts(health, new Date('2023-10-02T12:00:00Z'), 0, {})).to.eql(['twitter failed verification at 2023-10-02T12:00:00.000Z: 401 Unauthorized (last worked 2023-10-01T12:00:00.000Z)']);
+  });
+
+  it(`restarts the age when the credentials are rotated`, async function() {
+    await verifyCredentials(sets, store, new Date('2023-01-01T12:00:00Z'));
+    let health = await verifyCredentials(sets, store, new Date('2023-10-01T12:00:00Z'));
+    expect(getCredentialAlerts(health, new Date('2023-10-01T12:00:00Z'), 180, {})).to.eql(['twitter is 273 days old, and is due for rotation']);
+    values = ['key', 'rotated'];
+    health = await verifyCredentials(sets, store, new Date('2023-10-02T12:00:00Z'));
+    expect(getCredentialAlerts(health, new Date('2023-10-02T12:00:00Z'), 180, {twitter: '2023-10-12'})).to.eql(['twitter expires in 9 days (2023-10-12)']);
+  });
+
+  it(`is due once the interval has passed since the last check`, async function() {
+    expect(isCredentialCheckDue({}, new Date('2023-10-01T12:00:00Z'), 86400)).to.equal(true);
+    const health = await verifyCredentials(sets, store, new Date('2023-10-01T12:00:00Z'));
+    expect(isCredentialCheckDue(health, new Date('2023-10-01T18:00:00Z'), 86400)).to.equal(false);
+    expect(isCredentialCheckDue(health, new Date('2023-10-02T12:00:00Z'), 86400)).to.equal(true);
+  });
+});
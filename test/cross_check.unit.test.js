@@ -0,0 +1,48 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseSchedule} = require('../lib/helper_functions');
+const {MemoryStore} = require('./fakes');
+const {findDisagreements, crossCheckSchedule, recordCrossCheck, alertCrossCheck} = require('../lib/cross_check');
+
+describe('Cross-Check Unit Tests', function() {
+  const team = {id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u'};
+  const now = new Date('2023-10-01T12:00:00Z');
+  const extracted = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\nTUESDAY, 10/10\n\nGame, Downes, 5:00\n\n', now);
+  const live = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\nTUESDAY, 10/10\n\nGame, Downes, 5:00\n\n', now);
+
+  it(`finds the entries that the extractions disagree on`, function() {
+    expect(findDisagreements(extracted, live)).to.eql(['SATURDAY, 10/07/2023']);
+    expect(findDisagreements(extracted, extracted)).to.eql([]);
+  });
+
+  it(`checks the extracted schedule against the page fetched directly`, async function() {
+    expect(await crossCheckSchedule(team, extracted, undefined, async () => live, 0)).to.eql({status: 'disagreed', disagreements: ['SATURDAY, 10/07/2023']});
+    expect((await crossCheckSchedule(team, extracted, undefined, async () => live, 1)).status).to.equal('agreed');
+    expect((await crossCheckSchedule(team, extracted, undefined, async () => extracted, 0)).status).to.equal('agreed');
+    expect((await crossCheckSchedule(team, extracted, undefined, async () => new Map(), 0)).status).to.equal('unavailable');
+    expect((await crossCheckSchedule(team, extracted, undefined, async () => {
+      throw new Error('Request failed with status code 503');
+    }, 0)).status).to.equal('unavailable');
+  });
+
+  it(`delays the post for up to the max # of runs`, async function() {
+    const store = new MemoryStore();
+    const disagreed = {status: 'disagreed', disagreements: ['SATURDAY, 10/07']};
+    expect(await recordCrossCheck(team.id, disagreed, store, 2)).to.eql({delayed: true, delays: 1});
+    expect(await recordCrossCheck(team.id, disagreed, store, 2)).to.eql({delayed: true, delays: 2});
+    expect(await recordCrossCheck(team.id, disagreed, store, 2)).to.eql({delayed: false, delays: 2});
+    expect(await store.exists(`${team.id}/crossCheck.json`)).to.equal(false);
+
+    expect(await recordCrossCheck(team.id, disagreed, store, 2)).to.eql({delayed: true, delays: 1});
+    expect(await recordCrossCheck(team.id, {status: 'agreed', disagreements: []}, store, 2)).to.eql({delayed: false, delays: 0});
+    expect(await store.exists(`${team.id}/crossCheck.json`)).to.equal(false);
+  });
+
+  it(`alerts when the post is first delayed, and when it's posted regardless`, async function() {
+    const disagreed = {status: 'disagreed', disagreements: ['SATURDAY, 10/07']};
+    expect(await alertCrossCheck(team, disagreed, {delayed: true, delays: 1})).to.contain('The post is delayed until they agree');
+    expect(await alertCrossCheck(team, disagreed, {delayed: true, delays: 2})).to.equal(null);
+    expect(await alertCrossCheck(team, disagreed, {delayed: false, delays: 3})).to.contain('Posting anyway after 3 delayed runs');
+    expect(await alertCrossCheck(team, {status: 'agreed', disagreements: []}, {delayed: false, delays: 0})).to.equal(null);
+  });
+});
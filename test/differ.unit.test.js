@@ -0,0 +1,46 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseSchedule} = require('../lib/helper_functions');
+const {EntryDiffer, SemanticDiffer, getDiffer} = require('../lib/differ');
+
+describe('Differ Unit Tests', function() {
+  const now = new Date('2023-10-02T12:00:00Z');
+  const previous = parseSchedule('Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 1:00\n\nSUNDAY, 10/8\n\nGame, Eliot, 3:00\n\nSchedule by Season\n\n', now);
+
+  it(`selects the configured differ`, function() {
+    expect(getDiffer('semantic')).to.be.instanceOf(SemanticDiffer);
+    expect(getDiffer('entry')).to.be.instanceOf(EntryDiffer);
+    expect(getDiffer(undefined)).to.be.instanceOf(EntryDiffer);
+  });
+
+  it(`recognizes a series of location changes`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Downes, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Downes, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 1:00\n\nSUNDAY, 10/8\n\nGame, Eliot, 3:00\n\nMONDAY, 10/9\n\nPractice, Downes, 4:45–6:45\n\nSchedule by Season\n\n', now);
+    const differ = new SemanticDiffer();
+    const scheduleDiff = differ.diff(previous, schedule);
+    expect(scheduleDiff.modified.size).to.equal(2);
+    expect(scheduleDiff.semanticChanges).to.have.lengthOf(1);
+    expect(differ.summarize(scheduleDiff)).to.equal('All practices moved from Warren to Downes; 1 added');
+    expect(new EntryDiffer().summarize(scheduleDiff)).to.equal('1 added, 2 modified');
+  });
+
+  it(`recognizes a series of time changes`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:30–6:30\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:30–6:30\n\nSATURDAY, 10/7\n\nGame, Downes, 1:00\n\nSUNDAY, 10/8\n\nGame, Eliot, 3:00\n\nSchedule by Season\n\n', now);
+    const differ = new SemanticDiffer();
+    expect(differ.summarize(differ.diff(previous, schedule))).to.equal('All practices moved from 4:45–6:45 to 4:30–6:30');
+  });
+
+  it(`recognizes reschedules and swaps`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nWEDNESDAY, 10/4\n\nPractice, Warren, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Eliot, 3:00\n\nSUNDAY, 10/8\n\nGame, Downes, 1:00\n\nSchedule by Season\n\n', now);
+    const differ = new SemanticDiffer();
+    const scheduleDiff = differ.diff(previous, schedule);
+    expect(scheduleDiff.semanticChanges.map((change) => change.type)).to.eql(['reschedule', 'swap']);
+    expect(differ.summarize(scheduleDiff)).to.equal('Practice, Warren moved from TUESDAY, 10/3 to WEDNESDAY, 10/4; SATURDAY, 10/7 and SUNDAY, 10/8 swapped');
+  });
+
+  it(`falls back to the entry summary when there aren't any semantic changes`, function() {
+    const schedule = new Map(previous);
+    schedule.delete('SUNDAY, 10/8/2023');
+    const differ = new SemanticDiffer();
+    expect(differ.summarize(differ.diff(previous, schedule))).to.equal('1 removed');
+  });
+});
@@ -0,0 +1,59 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {recordRunSummary, loadRunSummaries, getExpiringCredentials, buildDigest, isDigestDue, sendDigest} = require('../lib/digest');
+
+describe('Digest Unit Tests', function() {
+  let rootPath;
+  let store;
+  const now = new Date('2023-10-09T12:00:00Z');
+  const teams = [{id: 'BlineBanditsBot'}, {id: 'QuietTeamBot'}];
+
+  beforeEach(async function() {
+    rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    store = new LocalStore(rootPath);
+    await recordRunSummary('BlineBanditsBot', {startedAt: '2023-10-01T12:00:00.000Z', durationMs: 9000, outcome: 'failed', error: 'too old'}, store);
+    await recordRunSummary('BlineBanditsBot', {startedAt: '2023-10-06T12:00:00.000Z', durationMs: 4000, outcome: 'unchanged', error: null}, store);
+    await recordRunSummary('BlineBanditsBot', {startedAt: '2023-10-06T12:30:00.000Z', durationMs: 6000, outcome: 'failed', error: 'Navigation timeout'}, store);
+    await recordRunSummary('BlineBanditsBot', {startedAt: '2023-10-08T12:00:00.000Z', durationMs: 5000, outcome: 'changed', error: null}, store);
+    await store.upload('BlineBanditsBot/costs/2023-10.json', JSON.stringify({month: '2023-10', runs: 4, counts: {twitterCall: 3, computeSecond: 24}}));
+    await store.upload('BlineBanditsBot/netChanges.json', JSON.stringify({generatedAt: '2023-10-08T12:00:00.000Z', summary: '1 modified', changes: 'Sun 10/8 moved to Larz'}));
+  });
+
+  afterEach(function() {
+    fs.rmSync(rootPath, {recursive: true, force: true});
+  });
+
+  it(`loads the runs since the start of the period`, async function() {
+    const runs = await loadRunSummaries('BlineBanditsBot', new Date('2023-10-02T12:00:00Z'), store);
+    expect(runs.map((run) => run.outcome)).to.eql(['unchanged', 'failed', 'changed']);
+  });
+
+  it(`finds the credentials that expire soon`, function() {
+    const expiring = getExpiringCredentials({twilio: '2023-10-20', twitter: '2023-10-01', vault: '2024-06-30', broken: 'someday'}, now);
+    expect(expiring.map((credential) => `${credential.name} ${credential.days}`)).to.eql(['twitter -9', 'twilio 10']);
+  });
+
+  it(`summarizes the week's runs, failures, and quota usage`, async function() {
+    const digest = await buildDigest(teams, store, now);
+    expect(digest.subject).to.equal('Bandits notification weekly digest: 2 item(s) need attention');
+    expect(digest.text).to.include('- BlineBanditsBot: 3 run(s), 1 with changes, 1 failed, 5.0s on average');
+    expect(digest.text).to.include('  Last failure at 2023-10-06T12:30:00.000Z: Navigation timeout');
+    expect(digest.text).to.include('- QuietTeamBot: 0 run(s)');
+    expect(digest.text).to.include('- twitterCall: 3');
+    expect(digest.text).to.include('Net schedule changes:\n- BlineBanditsBot: 1 modified (Sun 10/8 moved to Larz)');
+    expect(digest.text).to.not.include('computeSecond');
+  });
+
+  it(`is due once the interval has passed since it was sent`, async function() {
+    expect(await isDigestDue(store, now)).to.equal(true);
+    const sent = [];
+    expect(await sendDigest(store, now, async (to, subject, text) => sent.push(subject))).to.equal(true);
+    expect(sent.length).to.equal(1);
+    expect(await isDigestDue(store, new Date('2023-10-12T12:00:00Z'))).to.equal(false);
+    expect(await isDigestDue(store, new Date('2023-10-16T12:00:00Z'))).to.equal(true);
+  });
+});
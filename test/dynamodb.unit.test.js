@@ -0,0 +1,116 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {DynamoStore} = require('../lib/dynamodb');
+
+/**
+ * Minimal in-memory stand-in for the DynamoDB DocumentClient, supporting the
+ * condition expressions used by DynamoStore.
+ */
+class FakeDocumentClient {
+  constructor() {
+    this.items = new Map();
+  }
+
+  get(params) {
+    const item = this.items.get(`${params.Key.pk}|${params.Key.sk}`);
+    return {promise: async () => ({Item: item ? {...item} : undefined})};
+  }
+
+  put(params) {
+    return {promise: async () => {
+      const id = `${params.Item.pk}|${params.Item.sk}`;
+      const existing = this.items.get(id);
+      if ((params.ConditionExpression === 'attribute_not_exists(sk)' && existing) ||
+          (params.ConditionExpression === 'version = :expectedVersion' && (!existing || existing.version !== params.ExpressionAttributeValues[':expectedVersion']))) {
+        const error = new Error('The conditional request failed');
+        error.code = 'ConditionalCheckFailedException';
+        throw error;
+      }
+      this.items.set(id, {...params.Item});
+      return {};
+    }};
+  }
+
+  delete(params) {
+    this.items.delete(`${params.Key.pk}|${params.Key.sk}`);
+    return {promise: async () => ({})};
+  }
+
+  query(params) {
+    const {':pk': pk, ':prefix': prefix} = params.ExpressionAttributeValues;
+    const items = [...this.items.values()].filter((item) => item.pk === pk && item.sk.startsWith(prefix));
+    return {promise: async () => ({Items: items})};
+  }
+}
+
+/**
+ * Minimal in-memory blob store.
+ */
+class FakeBlobStore {
+  constructor() {
+    this.files = new Map();
+  }
+  async upload(key, contents) {
+    this.files.set(key, Buffer.from(contents));
+    return true;
+  }
+  async download(key) {
+    return this.files.get(key) || null;
+  }
+  async delete(key) {
+    return this.files.delete(key);
+  }
+}
+
+describe('DynamoDB Store Unit Tests', function() {
+  let client;
+  let blobStore;
+
+  beforeEach(function() {
+    client = new FakeDocumentClient();
+    blobStore = new FakeBlobStore();
+  });
+
+  it(`keeps state in the table and archived files in the blob store`, async function() {
+    const store = new DynamoStore('table', blobStore, client);
+    expect(await store.upload('team/previousSchedule.json', '{}')).to.be.true;
+    expect(await store.upload('team/archive/schedule-1.png', Buffer.from('png'))).to.be.true;
+    expect((await store.download('team/previousSchedule.json')).toString()).to.equal('{}');
+    expect((await store.download('team/archive/schedule-1.png')).toString()).to.equal('png');
+    expect(blobStore.files.has('team/previousSchedule.json')).to.be.false;
+    expect(blobStore.files.has('team/archive/schedule-1.png')).to.be.true;
+    const files = await store.list('team/archive/schedule-');
+    expect(files.map((file) => file.key)).to.eql(['team/archive/schedule-1.png']);
+    expect(files[0].size).to.equal(3);
+  });
+
+  it(`rejects a write when another run wrote in between`, async function() {
+    const first = new DynamoStore('table', blobStore, client);
+    const second = new DynamoStore('table', blobStore, client);
+    await first.upload('team/previousSchedule.json', 'a');
+
+    // Both runs read the same version of the state
+    await first.download('team/previousSchedule.json');
+    await second.download('team/previousSchedule.json');
+    expect(await first.upload('team/previousSchedule.json', 'b')).to.be.true;
+    expect(await second.upload('team/previousSchedule.json', 'c')).to.be.false;
+    expect((await first.download('team/previousSchedule.json')).toString()).to.equal('b');
+  });
+
+  it(`rejects creating state that another run created first`, async function() {
+    const first = new DynamoStore('table', blobStore, client);
+    const second = new DynamoStore('table', blobStore, client);
+    expect(await first.exists('team/previousSchedule.json')).to.be.false;
+    expect(await second.exists('team/previousSchedule.json')).to.be.false;
+    expect(await first.upload('team/previousSchedule.json', 'a')).to.be.true;
+    expect(await second.upload('team/previousSchedule.json', 'b')).to.be.false;
+  });
+
+  it(`only creates a key that doesn't exist`, async function() {
+    const first = new DynamoStore('table', blobStore, client);
+    const second = new DynamoStore('table', blobStore, client);
+    expect(await first.create('team/run.lock', 'a')).to.be.true;
+    expect(await second.create('team/run.lock', 'b')).to.be.false;
+    expect((await second.download('team/run.lock')).toString()).to.equal('a');
+  });
+});
@@ -0,0 +1,33 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {applyRunMode, parseEventDetail} = require('../lib/event_detail');
+
+describe('Event Detail Unit Tests', function() {
+  const teams = [
+    {id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u'},
+    {id: 'OtherTeamBot', url: 'https://example.com/schedule'},
+  ];
+
+  it(`checks every team without a detail`, function() {
+    expect(parseEventDetail({}, teams)).to.eql({teams});
+  });
+
+  it(`selects the teams by id or URL, in the given mode`, function() {
+    const {teams: selected} = parseEventDetail({urls: ['https://example.com/schedule'], mode: 'no-tweet'}, teams);
+    expect(selected).to.eql([{id: 'OtherTeamBot', url: 'https://example.com/schedule', mode: 'no-tweet'}]);
+    expect(parseEventDetail({urls: ['BlineBanditsBot']}, teams).teams).to.eql([teams[0]]);
+  });
+
+  it(`rejects an invalid detail`, function() {
+    expect(parseEventDetail({urls: 'BlineBanditsBot'}, teams).error).to.match(/`urls`/);
+    expect(parseEventDetail({mode: 'loud'}, teams).error).to.match(/`mode`/);
+    expect(parseEventDetail({urls: ['BlineBanditsBot', 'NoSuchBot']}, teams).error).to.equal('No configured team matches NoSuchBot');
+  });
+
+  it(`leaves out the channels that the mode skips`, function() {
+    const channels = ['webhook', 'social', 'sms', 'email'];
+    expect(applyRunMode(channels)).to.eql(channels);
+    expect(applyRunMode(channels, 'no-tweet')).to.eql(['webhook', 'sms', 'email']);
+    expect(applyRunMode(channels, 'silent')).to.eql([]);
+  });
+});
@@ -0,0 +1,54 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {buildScheduleChangedEvent, publishScheduleChanged} = require('../lib/events');
+
+/**
+ * Records the requests, like the SNS and SQS clients would send them.
+ */
+class FakeClient {
+  constructor(fail = false) {
+    this.requests = [];
+    this.fail = fail;
+  }
+
+  publish(params) {
+    return this.request(params);
+  }
+
+  sendMessage(params) {
+    return this.request(params);
+  }
+
+  request(params) {
+    this.requests.push(params);
+    return {promise: async () => {
+      if (this.fail) {
+        throw new Error('AccessDenied');
+      }
+      return {MessageId: '1'};
+    }};
+  }
+}
+
+describe('Events Unit Tests', function() {
+  const event = buildScheduleChangedEvent({type: 'schedule.changed', team: 'BlineBanditsBot', severity: 'critical', changes: []}, 'BlineBanditsBot/archive/schedule-screenshot.png', 'bucket');
+
+  it(`includes where the screenshot was archived`, function() {
+    expect(event.screenshot).to.eql({bucket: 'bucket', key: 'BlineBanditsBot/archive/schedule-screenshot.png'});
+  });
+
+  it(`publishes to the topic and queue, with filterable attributes`, async function() {
+    const sns = new FakeClient();
+    const sqs = new FakeClient();
+    const published = await publishScheduleChanged(event, 'arn:aws:sns:us-east-1:1:topic', 'https://sqs/queue', {sns, sqs});
+    expect(published).to.eql(['arn:aws:sns:us-east-1:1:topic', 'https://sqs/queue']);
+    expect(JSON.parse(sns.requests[0].Message).team).to.equal('BlineBanditsBot');
+    expect(sns.requests[0].MessageAttributes.severity.StringValue).to.equal('critical');
+    expect(sqs.requests[0].MessageAttributes.eventType.StringValue).to.equal('ScheduleChanged');
+  });
+
+  it(`keeps publishing when a target fails`, async function() {
+    const published = await publishScheduleChanged(event, 'arn:aws:sns:us-east-1:1:topic', 'https://sqs/queue', {sns: new FakeClient(true), sqs: new FakeClient()});
+    expect(published).to.eql(['https://sqs/queue']);
+  });
+});
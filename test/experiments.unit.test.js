@@ -0,0 +1,42 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {getExperiment, assignVariant, getExperimentReport, formatExperimentReport} = require('../lib/experiments');
+
+describe('Experiments Unit Tests', function() {
+  it(`reads the team's experiment, ignoring invalid ones`, function() {
+    expect(getExperiment({id: 'team'})).to.equal(null);
+    expect(getExperiment({id: 'team', experiment: {name: 'lead', variants: ['Sentence', 'none']}})).to.eql({name: 'lead', variants: ['sentence', 'none']});
+    expect(getExperiment({id: 'team', experiment: {name: 'lead', variants: ['sentence']}})).to.equal(null);
+    expect(getExperiment({id: 'team', experiment: {name: 'lead', variants: ['sentence', 'emoji']}})).to.equal(null);
+    expect(getExperiment({id: 'team', experiment: {variants: ['sentence', 'none']}})).to.equal(null);
+  });
+
+  it(`splits the posts evenly, starting over when the experiment is renamed`, async function() {
+    const store = new MemoryStore();
+    const experiment = {name: 'lead', variants: ['sentence', 'none', 'list']};
+    const assigned = [];
+    for (let i = 0; i < 4; i++) {
+      assigned.push(await assignVariant('team', experiment, store));
+    }
+    expect(assigned).to.eql(['sentence', 'none', 'list', 'sentence']);
+    expect(await assignVariant('team', {name: 'lead-2', variants: ['none', 'sentence']}, store)).to.equal('none');
+    expect(JSON.parse(await store.download('team/experiment.json'))).to.eql({name: 'lead-2', assignments: {none: 1}});
+  });
+
+  it(`reports the clicks per variant from the tracked links`, async function() {
+    const link = (id, clicks, experiment) => [`team/links/${id}.json`, JSON.stringify({id, url: 'https://example.com', channel: 'social', createdAt: `2023-10-0${id}T12:00:00.000Z`, clicks, lastClickedAt: null, experiment})];
+    const store = new MemoryStore(Object.fromEntries([
+      link(1, 4, {name: 'lead', variant: 'sentence'}),
+      link(2, 1, {name: 'lead', variant: 'none'}),
+      link(3, 2, {name: 'lead', variant: 'sentence'}),
+      link(4, 9, undefined),
+    ]));
+    const report = await getExperimentReport('team', store);
+    expect(report).to.eql([{name: 'lead', variants: [
+      {variant: 'sentence', notifications: 2, clicks: 6, clicksPerNotification: 3},
+      {variant: 'none', notifications: 1, clicks: 1, clicksPerNotification: 1},
+    ]}]);
+    expect(formatExperimentReport(report)).to.equal('Experiment lead:\n  sentence: 6 click(s) across 2 notification(s), 3.00 per notification\n  none: 1 click(s) across 1 notification(s), 1.00 per notification');
+  });
+});
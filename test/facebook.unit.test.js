@@ -0,0 +1,65 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {PNG} = require('./fakes');
+const {getFacebookSettings, postPhotoToFacebook, checkFacebook} = require('../lib/facebook');
+
+describe('Facebook Unit Tests', function() {
+  const names = ['FACEBOOK_PAGE_ID', 'FACEBOOK_PAGE_ACCESS_TOKEN'];
+  const originals = {};
+
+  beforeEach(function() {
+    names.forEach((name) => {
+      originals[name] = process.env[name];
+      delete process.env[name];
+    });
+  });
+
+  afterEach(function() {
+    for (const name of names) {
+      if (originals[name] === undefined) {
+        delete process.env[name];
+      } else {
+        process.env[name] = originals[name];
+      }
+    }
+  });
+
+  it(`configures the Page per team`, function() {
+    expect(getFacebookSettings({id: 'team'})).to.equal(null);
+    expect(getFacebookSettings({id: 'team', facebook: {pageId: 111, accessToken: 'own-token'}})).to.eql({pageId: '111', accessToken: 'own-token'});
+    process.env.FACEBOOK_PAGE_ID = '222';
+    process.env.FACEBOOK_PAGE_ACCESS_TOKEN = 'default-token';
+    expect(getFacebookSettings({id: 'team'})).to.eql({pageId: '222', accessToken: 'default-token'});
+  });
+
+  it(`posts the image with the caption to the team's Page`, async function() {
+    const requests = [];
+    const http = {post: async (url, form) => {
+      requests.push({url, caption: form.get('caption'), token: form.get('access_token'), source: form.get('source')});
+      return {status: 200, data: {id: 'photo-1', post_id: '111_post-1'}};
+    }};
+    const team = {id: 'team', facebook: {pageId: '111', accessToken: 'own-token'}};
+    expect(await postPhotoToFacebook(PNG, 'Schedule update', team, undefined, http)).to.eql({id: 'photo-1', post_id: '111_post-1'});
+    expect(requests[0]).to.include({url: 'https://graph.facebook.com/v18.0/111/photos', caption: 'Schedule update', token: 'own-token'});
+    expect(requests[0].source.size).to.equal(PNG.length);
+
+    expect(await postPhotoToFacebook(PNG, 'Schedule update', {id: 'other'}, undefined, http)).to.equal(null);
+    expect(requests).to.have.lengthOf(1); // not configured for the team
+
+    const rejected = {post: async () => ({status: 400, data: {error: {message: 'Invalid OAuth access token.'}}})};
+    expect(await postPhotoToFacebook(PNG, 'Schedule update', team, undefined, rejected)).to.equal(null);
+  });
+
+  it(`checks that the Pages can be reached`, async function() {
+    const teams = [{id: 'team', facebook: {pageId: '111', accessToken: 'own-token'}}];
+    expect(await checkFacebook(teams, {get: async () => ({status: 200, data: {name: 'Bandits 12U', id: '111'}})})).to.equal('Bandits 12U');
+
+    let error = null;
+    try {
+      await checkFacebook(teams, {get: async () => ({status: 400, data: {error: {message: 'Invalid OAuth access token.'}}})});
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('Page 111 was rejected: Invalid OAuth access token.');
+  });
+});
@@ -0,0 +1,229 @@
+/* eslint-disable max-len */
+/**
+ * Fakes of the scraper, storage, Twitter client, and browser, so that the
+ * processing of a team can be tested without Chrome, AWS, or Twitter.
+ */
+const zlib = require('zlib');
+
+// A 1x1 transparent PNG, for the screenshots
+const PNG = Buffer.from('iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg==', 'base64');
+
+/**
+ * Keeps the files in memory, with the same interface as the stores in
+ * `lib/storage.js`.
+ */
+class MemoryStore {
+  constructor(files = {}) {
+    this.files = new Map(Object.entries(files).map(([key, contents]) => [key, {contents: Buffer.from(contents), lastModified: new Date()}]));
+  }
+
+  async upload(key, contents) {
+    this.files.set(key, {contents: Buffer.from(contents), lastModified: new Date()});
+    return true;
+  }
+
+  async download(key) {
+    return this.files.has(key) ? this.files.get(key).contents : null;
+  }
+
+  async exists(key) {
+    return this.files.has(key);
+  }
+
+  async delete(key) {
+    return this.files.delete(key);
+  }
+
+  async create(key, contents) {
+    if (this.files.has(key)) {
+      return false;
+    }
+    return await this.upload(key, contents);
+  }
+
+  async list(prefix) {
+    return [...this.files.entries()]
+        .filter(([key]) => key.startsWith(prefix))
+        .map(([key, file]) => ({key, lastModified: file.lastModified, size: file.contents.length}));
+  }
+}
+
+/**
+ * Returns the given schedules (one per scrape, repeating the last one)
+ * instead of loading the page. Fails the scrape when the schedule is an Error.
+ */
+class FakeScraper {
+  constructor(schedules, screenshot = PNG) {
+    this.schedules = schedules;
+    this.scrapes = 0;
+    this.screenshots = [];
+    this.screenshotBuffer = screenshot;
+    this.content = null;
+    this.closed = false;
+  }
+
+  async scrape(team, signal = undefined) {
+    const schedule = this.schedules[Math.min(this.scrapes++, this.schedules.length - 1)];
+    if (schedule instanceof Error) {
+      throw schedule;
+    }
+    return new Map(schedule);
+  }
+
+  async screenshot(team, signal = undefined, highlights = []) {
+    this.screenshots.push(highlights);
+    return this.screenshotBuffer;
+  }
+
+  async close() {
+    this.closed = true;
+  }
+}
+
+/**
+ * Records the tweets, uploads (v1.1 and the commands of the v2 chunked
+ * upload), alt texts, and deletions, like the `twitter-api-v2` client would send them.
+ * Tweeting fails with the given error, e.g. one shaped like an
+ * `ApiResponseError` (see `twitterError()`).
+ */
+class FakeTwitterClient {
+  constructor(error = null) {
+    this.uploads = [];
+    this.mediaCommands = [];
+    this.altTexts = [];
+    this.tweets = [];
+    this.deleted = [];
+    this.error = error;
+    this.v1 = {
+      uploadMedia: async (buffer, options) => {
+        this.uploads.push(options);
+        return `media-${this.uploads.length}`;
+      },
+      createMediaMetadata: async (mediaId, metadata) => {
+        this.altTexts.push({mediaId, text: metadata.alt_text.text});
+      },
+      deleteTweet: async (id) => {
+        this.deleted.push(id);
+        return {id_str: id};
+      },
+    };
+    this.v2 = {
+      tweet: async (params) => {
+        if (this.error) {
+          throw this.error;
+        }
+        this.tweets.push(params);
+        return {data: {id: `${1000 + this.tweets.length}`, text: params.text}};
+      },
+      post: async (endpoint, params) => {
+        if (endpoint === 'media/metadata') {
+          this.altTexts.push({mediaId: params.id, text: params.metadata.alt_text.text});
+          return {};
+        }
+        this.mediaCommands.push(params);
+        return params.command === 'INIT' ? {data: {id: 'media-v2'}} : {data: {}};
+      },
+      get: async (endpoint, params) => {
+        this.mediaCommands.push(params);
+        return {data: {processing_info: {state: 'succeeded'}}};
+      },
+      deleteTweet: async (id) => {
+        this.deleted.push(id);
+        return {data: {deleted: true}};
+      },
+    };
+  }
+}
+
+/**
+ * Builds an error like the `ApiResponseError` of `twitter-api-v2`.
+ *
+ * @param {Integer} code the HTTP status
+ * @param {Object} data the body of the response
+ * @param {Object} rateLimit the rate limit, i.e. `{limit, remaining, reset}`
+ * @return {Error} the error
+ */
+function twitterError(code, data = {}, rateLimit = undefined) {
+  return Object.assign(new Error(`Request failed with code ${code}`), {code, data, rateLimit, rateLimitError: code === 429});
+}
+
+/**
+ * Stands in for the lazily launched browser (see `createLazyBrowser()`),
+ * with pages that screenshot as a blank PNG, for the preview and watermark
+ * images.
+ */
+class FakeBrowser {
+  constructor() {
+    this.pages = [];
+    this.closed = false;
+    this.get = async () => this;
+  }
+
+  async newPage() {
+    const page = {
+      content: null,
+      setViewport: async () => {},
+      setContent: async (html) => {
+        page.content = html;
+      },
+      $: async () => ({screenshot: async () => PNG}),
+      close: async () => {},
+      isClosed: () => false,
+    };
+    this.pages.push(page);
+    return page;
+  }
+
+  async close() {
+    this.closed = true;
+  }
+}
+
+/**
+ * Encodes an RGB PNG (without checksums, which aren't verified) from a
+ * function of the pixel coordinates to their gray level.
+ *
+ * @param {Integer} width the width
+ * @param {Integer} height the height
+ * @param {Function} shade returns the gray level of the pixel at (x, y)
+ * @param {Integer} filter the filter of the rows
+ * @return {Buffer} the PNG
+ */
+function encodePng(width, height, shade, filter = 0) {
+  const chunk = (type, data) => {
+    const length = Buffer.alloc(4);
+    length.writeUInt32BE(data.length);
+    return Buffer.concat([length, Buffer.from(type, 'ascii'), data, Buffer.alloc(4)]);
+  };
+  const header = Buffer.alloc(13);
+  header.writeUInt32BE(width, 0);
+  header.writeUInt32BE(height, 4);
+  header[8] = 8;
+  header[9] = 2;
+  const rows = [];
+  for (let y = 0; y < height; y++) {
+    const row = [];
+    for (let x = 0; x < width; x++) {
+      const level = shade(x, y);
+      row.push(level, level, level);
+    }
+    // Sub filter: each byte is stored as the difference from the pixel to its left
+    rows.push(Buffer.from([filter, ...row.map((value, i) => filter === 1 && i >= 3 ? (value - row[i - 3]) & 0xff : value)]));
+  }
+  return Buffer.concat([
+    Buffer.from([0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a]),
+    chunk('IHDR', header),
+    chunk('IDAT', zlib.deflateSync(Buffer.concat(rows))),
+    chunk('IEND', Buffer.alloc(0)),
+  ]);
+}
+
+module.exports = {
+  PNG,
+  encodePng,
+  MemoryStore,
+  FakeScraper,
+  FakeTwitterClient,
+  twitterError,
+  FakeBrowser,
+};
@@ -0,0 +1,49 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseSchedule, compareSchedules} = require('../lib/helper_functions');
+const {DEFAULT_TWEET_TEMPLATE, getTeamName, formatHashtags, renderTemplate, getTweetTemplate, getTweetText} = require('../lib/format');
+
+describe('Format Unit Tests', function() {
+  const original = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\n');
+  const updated = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\n');
+  const scheduleDiff = {...compareSchedules(original, updated), previousSchedule: original};
+
+  it(`uses the team's name and hashtags, or the defaults`, function() {
+    expect(getTeamName({id: 'team'})).to.equal('Bandits 12U');
+    expect(getTeamName({id: 'team', name: 'Eagles 10U'})).to.equal('Eagles 10U');
+    expect(formatHashtags({id: 'team'})).to.equal('#bandits12u');
+    expect(formatHashtags({id: 'team', hashtags: ['eagles10u', '#brookline']})).to.equal('#eagles10u #brookline');
+    expect(formatHashtags({id: 'team', hashtags: '#eagles10u  brookline'})).to.equal('#eagles10u #brookline');
+    expect(formatHashtags({id: 'team', hashtags: []})).to.equal('');
+  });
+
+  it(`fills in the placeholders, leaving the unknown ones`, function() {
+    expect(renderTemplate('{name} at {link} {unknown}', {name: 'Bandits 12U', link: 'https://example.com'})).to.equal('Bandits 12U at https://example.com {unknown}');
+  });
+
+  it(`prefers the team's template over the default`, function() {
+    const original = process.env.TWEET_TEMPLATE;
+    delete process.env.TWEET_TEMPLATE;
+    try {
+      expect(getTweetTemplate({id: 'team'})).to.equal(DEFAULT_TWEET_TEMPLATE);
+      process.env.TWEET_TEMPLATE = '{name}: {link}';
+      expect(getTweetTemplate({id: 'team'})).to.equal('{name}: {link}');
+      expect(getTweetTemplate({id: 'team', tweetTemplate: '{link}'})).to.equal('{link}');
+    } finally {
+      if (original === undefined) {
+        delete process.env.TWEET_TEMPLATE;
+      } else {
+        process.env.TWEET_TEMPLATE = original;
+      }
+    }
+  });
+
+  it(`leads the team's template with the summary of the changes`, function() {
+    const team = {id: 'team', url: 'https://example.com/schedule', name: 'Eagles 10U', tweetTemplate: '{name} update: {link}'};
+    const {text, replies} = getTweetText(scheduleDiff, 'https://example.com/l/1', team, 'sentence');
+    expect(text).to.contain('moved to 3:30pm');
+    expect(text).to.match(/ Eagles 10U update: https:\/\/example\.com\/l\/1$/);
+    expect(replies).to.eql([]);
+    expect(getTweetText(scheduleDiff, 'https://example.com/l/1', {...team, tweetTemplate: undefined, hashtags: ['eagles10u']}, 'none').text).to.match(/^Latest Eagles 10U Schedule as of .*\. https:\/\/example\.com\/l\/1 #eagles10u$/);
+  });
+});
@@ -0,0 +1,74 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {pingHealthcheck, recordTeamHealth, reportRunHealth} = require('../lib/healthcheck');
+
+describe('Healthcheck Unit Tests', function() {
+  const names = ['ADMIN_EMAIL', 'ADMIN_SLACK_WEBHOOK_URL', 'HEALTHCHECK_URL', 'HEALTHCHECK_FAIL_URL', 'ALERT_FAILURE_THRESHOLD'];
+  const originals = {};
+  const ok = {team: 'team', url: 'https://example.com', outcome: 'unchanged', changes: 0, postedId: null, error: null, errorType: null};
+  const failed = {...ok, outcome: 'failed', error: 'net::ERR_NAME_NOT_RESOLVED'};
+
+  beforeEach(function() {
+    names.forEach((name) => {
+      originals[name] = process.env[name];
+      delete process.env[name];
+    });
+  });
+
+  afterEach(function() {
+    for (const name of names) {
+      if (originals[name] === undefined) {
+        delete process.env[name];
+      } else {
+        process.env[name] = originals[name];
+      }
+    }
+  });
+
+  it(`pings the success or failure URL with the results`, async function() {
+    const requests = [];
+    const http = {post: async (url, body) => requests.push({url, body})};
+    expect(await pingHealthcheck([ok], undefined, undefined, http)).to.equal(null);
+    expect(await pingHealthcheck([ok], 'https://hc-ping.com/abc', undefined, http)).to.equal(true);
+    expect(await pingHealthcheck([ok, failed], 'https://hc-ping.com/abc/', undefined, http)).to.equal(true);
+    expect(await pingHealthcheck([failed], 'https://cronitor.link/p/key/run', 'https://cronitor.link/p/key/run?state=fail', http)).to.equal(true);
+    expect(requests.map((request) => request.url)).to.eql(['https://hc-ping.com/abc', 'https://hc-ping.com/abc/fail', 'https://cronitor.link/p/key/run?state=fail']);
+    expect(requests[1].body).to.contain('net::ERR_NAME_NOT_RESOLVED');
+
+    const failing = {post: async () => {
+      throw new Error('timeout of 10000ms exceeded');
+    }};
+    expect(await pingHealthcheck([ok], 'https://hc-ping.com/abc', undefined, failing)).to.equal(false);
+  });
+
+  it(`alerts once when the failures reach the threshold, and once on recovery`, async function() {
+    const store = new MemoryStore();
+    const now = new Date('2023-10-06T12:00:00Z');
+    expect((await recordTeamHealth(failed, store, 2, now)).transition).to.equal(null);
+    expect(await recordTeamHealth(failed, store, 2, now)).to.eql({failures: 2, since: now.toISOString(), lastError: 'net::ERR_NAME_NOT_RESOLVED', alerted: true, transition: 'failing'});
+    expect((await recordTeamHealth(failed, store, 2, now)).transition).to.equal(null);
+    expect((await recordTeamHealth(ok, store, 2, now)).transition).to.equal('recovered');
+    expect((await recordTeamHealth(ok, store, 2, now)).transition).to.equal(null);
+
+    // A single failure that recovers isn't alerted about
+    await recordTeamHealth(failed, store, 2, now);
+    expect((await recordTeamHealth(ok, store, 2, now)).transition).to.equal(null);
+  });
+
+  it(`alerts the admins by email and in Slack`, async function() {
+    process.env.ADMIN_EMAIL = 'admin@example.com';
+    process.env.ADMIN_SLACK_WEBHOOK_URL = 'https://hooks.slack.com/services/T/B/x';
+    process.env.ALERT_FAILURE_THRESHOLD = '1';
+    const emails = [];
+    const send = async (to, subject, text) => emails.push({to, subject, text}) && 'message-id';
+    const posts = [];
+    const http = {post: async (url, body) => posts.push({url, body})};
+    const store = new MemoryStore();
+    expect(await reportRunHealth([failed], store, send, http)).to.eql([{team: 'team', transition: 'failing', sent: ['email', 'slack']}]);
+    expect(emails[0]).to.include({to: 'admin@example.com', subject: 'Bandits notification: team keeps failing'});
+    expect(emails[0].text).to.contain('Last error: net::ERR_NAME_NOT_RESOLVED');
+    expect(posts[0].url).to.equal('https://hooks.slack.com/services/T/B/x');
+    expect(await reportRunHealth([ok], store, send, http)).to.eql([{team: 'team', transition: 'recovered', sent: ['email', 'slack']}]);
+  });
+});
@@ -3,9 +3,11 @@ const expect = require('chai').expect;
 const unroll = require('unroll');
 unroll.use(it);
 const moment = require('moment-timezone');
-const {parseSchedule, compareSchedules} = require('../lib/helper_functions');
+const {parseTime, parseEventText, getEventDetails, parseSchedule, normalizeEntryText, getComparableText, compareSchedules, summarizeChanges, getScheduledDate, canonicalizeScheduleKey, canonicalizeEntryValue, canonicalizeSchedule} = require('../lib/helper_functions');
 
 describe('Helper Functions Unit Tests', function() {
+  const now = new Date('2023-10-02T12:00:00Z');
+  const timeZone = 'America/New_York';
   const input = [
     'Upcoming Schedule\n\nWear baseball pants or sweatpants to every practice, and bring all of your baseball gear.\n\n​\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nLate: Aiden, Sam, Zach\n\nOut: Matty\n\n​\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:45–6:45\n\nLate: —\n\nOut: Matty\n\n​\n\nSATURDAY, 10/7\n\nPractice, Warren, 3:00–5:30\n\nLate: —\n\nOut: Connor\n\n​\n\nSUNDAY, 10/8\n\nPractice, Warren, 3:00–5:30\n\nLate: —\n\nOut: Connor\n\n  \n\nSchedule by Season\n\nOur tentative plan for the months ahead. More details to come. \n\n \n\nFALL 20…Th/Sa/Su), September–November, at Warren Field (starting 9/5).\n\n \n\nWINTER 2024\n\nIndoor practices on Saturday or Sunday evenings, January–March, at Brookline HS Tappan Pavilion.\n\n \n\nSPRING 2024\n\n​Doubleheaders on Saturdays, April–June, in the 12U Division of the Select League.\n\n​\n\n\n\nPractices once or twice per week (TBD).\n\n\nPlayoffs in July, if we qualify.\n\n\nSchedule will not conflict with BYB Majors.\n\n\nPlaying time will depend on baseball skills, commitment, focus, work ethic, and attitude.​\n\n',
     'Upcoming Schedule\n\nWear baseball pants or sweatpants to every practice, and bring all of your baseball gear.\n\n​\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:30–6:30\n\nLate: —\n\nOut: Alek, Matty\n\n​\n\nSATURDAY, 10/7\n\nPractice, Warren, 3:00–5:30\n\nLate: —\n\nOut: Connor\n\n​\n\nSUNDAY, 10/8\n\nPractice, Warren, 3:00–5:30\n\nLate: —\n\nOut: Connor\n\n​\n\nTUESDAY, 10/10\n\nPractice, Warren, 4:30–6:30\n\nLate: Aiden, Sam, Zach\n\nOut: Matty\n\n​\n\nTUESDAY, 10/12\n\nPractice, Warren, 4:30–6:30\n\nLate: —\n\nOut: Matty\n\n  \n\nSchedule by Season\n…Th/Sa/Su), September–November, at Warren Field (starting 9/5).\n\n \n\nWINTER 2024\n\nIndoor practices on Saturday or Sunday evenings, January–March, at Brookline HS Tappan Pavilion.\n\n \n\nSPRING 2024\n\n​Doubleheaders on Saturdays, April–June, in the 12U Division of the Select League.\n\n​\n\n\n\nPractices once or twice per week (TBD).\n\n\nPlayoffs in July, if we qualify.\n\n\nSchedule will not conflict with BYB Majors.\n\n\nPlaying time will depend on baseball skills, commitment, focus, work ethic, and attitude.​\n\n',
@@ -14,7 +16,7 @@ describe('Helper Functions Unit Tests', function() {
   ];
   unroll(`should be able to parse (#key) on the upcoming schedule`, 
       function(done, testArgs) {
-        const result = parseSchedule(input[0]);
+        const result = parseSchedule(input[0], now);
         expect(result.size !== 0);
         expect(result.has(testArgs['key']));
         const entry = result.get(testArgs['key']);
@@ -22,45 +24,241 @@ describe('Helper Functions Unit Tests', function() {
         expect(entry['dayOfMonth']).to.equal(testArgs['dayOfMonth']);
         expect(entry['location']).to.equal(testArgs['location']);
         expect(entry['timeBlock']).to.equal(testArgs['timeBlock']);
-        expect(entry['parsed'][0].start.date()).to.eql(testArgs['parsedStartDate'].toDate());
-        expect(entry['parsed'][0].end.date()).to.eql(testArgs['parsedEndDate'].toDate());
+        expect(entry['parsed'].start).to.eql(testArgs['parsedStartDate'].toDate());
+        expect(entry['parsed'].end).to.eql(testArgs['parsedEndDate'].toDate());
         done();
       },
       [
         ['key', 'dayOfWeek', 'dayOfMonth', 'location', 'timeBlock', 'parsedStartDate', 'parsedEndDate'],
-        ['TUESDAY, 10/3', 'TUESDAY', '10/3', 'Practice, Warren', '4:45–6:45', moment('2023-10-03 16:45:00'), moment('2023-10-03 18:45:00')],
-        ['THURSDAY, 10/5', 'THURSDAY', '10/5', 'Practice, Warren', '4:45–6:45', moment('2023-10-05 16:45:00'), moment('2023-10-05 18:45:00')],
-        ['SATURDAY, 10/7', 'SATURDAY', '10/7', 'Practice, Warren', '3:00–5:30', moment('2023-10-07 15:00:00'), moment('2023-10-07 17:30:00')],
-        ['SUNDAY, 10/8', 'SUNDAY', '10/8', 'Practice, Warren', '3:00–5:30', moment('2023-10-08 15:00:00'), moment('2023-10-08 17:30:00')],
+        ['TUESDAY, 10/3/2023', 'TUESDAY', '10/3', 'Practice, Warren', '4:45–6:45', moment.tz([2023, 9, 3, 16, 45], timeZone), moment.tz([2023, 9, 3, 18, 45], timeZone)],
+        ['THURSDAY, 10/5/2023', 'THURSDAY', '10/5', 'Practice, Warren', '4:45–6:45', moment.tz([2023, 9, 5, 16, 45], timeZone), moment.tz([2023, 9, 5, 18, 45], timeZone)],
+        ['SATURDAY, 10/7/2023', 'SATURDAY', '10/7', 'Practice, Warren', '3:00–5:30', moment.tz([2023, 9, 7, 15, 0], timeZone), moment.tz([2023, 9, 7, 17, 30], timeZone)],
+        ['SUNDAY, 10/8/2023', 'SUNDAY', '10/8', 'Practice, Warren', '3:00–5:30', moment.tz([2023, 9, 8, 15, 0], timeZone), moment.tz([2023, 9, 8, 17, 30], timeZone)],
       ],
   );
 
   it(`can parse a schedule entry that doesn't have a time block`, function() {
-    const result = parseSchedule(input[2]);
+    const result = parseSchedule(input[2], now);
     expect(result.size).to.equal(4);
-    expect(result.get('SATURDAY, 10/7')['timeBlock']).to.equal(null);
-    expect(result.get('SATURDAY, 10/7')['parsed']).to.equal(null);
-    expect(result.get('SATURDAY, 10/7')['location']).to.equal('Practice is canceled');
+    expect(result.get('SATURDAY, 10/7/2023')['timeBlock']).to.equal(null);
+    expect(result.get('SATURDAY, 10/7/2023')['parsed']).to.equal(null);
+    expect(result.get('SATURDAY, 10/7/2023')['location']).to.equal('Practice is canceled');
+  });
+
+  unroll(`picks out the event of #text`,
+      function(done, testArgs) {
+        expect(parseEventText(testArgs['text'])).to.eql({eventType: testArgs['eventType'], opponent: testArgs['opponent'], homeAway: testArgs['homeAway']});
+        done();
+      },
+      [
+        ['text', 'eventType', 'opponent', 'homeAway'],
+        ['Practice, Warren', 'practice', null, null],
+        ['Game vs Tigers, Downes', 'game', 'Tigers', 'home'],
+        ['Game @ Lions, Larz Anderson', 'game', 'Lions', 'away'],
+        ['Scrimmage vs. Newton (away), Eliot', 'game', 'Newton', 'away'],
+        ['Tournament, Cooperstown', 'tournament', null, null],
+        ['Practice is canceled', 'practice', null, null],
+        ['TBD', null, null, null],
+      ],
+  );
+
+  it(`keeps the event of each entry, and parses it for stored entries without one`, function() {
+    const result = parseSchedule(input[3], now);
+    expect(result.get('FRIDAY, 10/13/2023')['eventType']).to.equal('game');
+    expect(result.get('THURSDAY, 10/12/2023')['eventType']).to.equal('practice');
+    expect(getEventDetails({location: 'Game vs Tigers, Downes'})).to.eql({eventType: 'game', opponent: 'Tigers', homeAway: 'home'});
+    expect(getEventDetails({location: 'Game vs Tigers, Downes', eventType: 'game', opponent: 'Lions', homeAway: null})).to.eql({eventType: 'game', opponent: 'Lions', homeAway: null});
   });
 
   it(`can parse a schedule entry that doesn't have a range for its time block`, function() {
-    const result = parseSchedule(input[3]);
+    const result = parseSchedule(input[3], now);
     expect(result.size).to.equal(5);
-    expect(result.get('FRIDAY, 10/13')['timeBlock']).to.equal('4:15');
-    expect(result.get('FRIDAY, 10/13')['parsed']).to.not.equal(null);
-    expect(result.get('FRIDAY, 10/13')['parsed'][0].start.date()).to.eql(moment('2023-10-13 16:15:00').toDate());
-    expect(result.get('FRIDAY, 10/13')['parsed'][0].end).to.equal(null);
-    expect(result.get('FRIDAY, 10/13')['location']).to.equal('Scrimmage, Eliot');
+    expect(result.get('FRIDAY, 10/13/2023')['timeBlock']).to.equal('4:15');
+    expect(result.get('FRIDAY, 10/13/2023')['parsed']).to.not.equal(null);
+    expect(result.get('FRIDAY, 10/13/2023')['parsed'].start).to.eql(moment.tz([2023, 9, 13, 16, 15], timeZone).toDate());
+    expect(result.get('FRIDAY, 10/13/2023')['parsed'].end).to.equal(null);
+    expect(result.get('FRIDAY, 10/13/2023')['location']).to.equal('Scrimmage, Eliot');
+  });
+
+  unroll(`resolves the time block #details into actual times`,
+      function(done, testArgs) {
+        const parsed = parseTime(testArgs['dayOfMonth'], testArgs['details'], now, timeZone);
+        expect(parsed.start).to.eql(moment.tz(testArgs['start'], timeZone).toDate());
+        expect(parsed.end).to.eql(testArgs['end'] ? moment.tz(testArgs['end'], timeZone).toDate() : null);
+        done();
+      },
+      [
+        ['dayOfMonth', 'details', 'start', 'end'],
+        ['10/7', 'Game, Downes, 10:30am', [2023, 9, 7, 10, 30], null],
+        ['10/7', 'Game, Downes, 10:30', [2023, 9, 7, 10, 30], null],
+        ['10/7', 'Practice, Warren, 4:30–6:30pm', [2023, 9, 7, 16, 30], [2023, 9, 7, 18, 30]],
+        ['10/7', 'Game, Downes, 11:00–1:00', [2023, 9, 7, 11, 0], [2023, 9, 7, 13, 0]],
+        ['10/7', 'Game, Downes, 11:00–1:00pm', [2023, 9, 7, 11, 0], [2023, 9, 7, 13, 0]],
+        ['1/13', 'Practice, Tappan Pavilion, 7:00–9:00', [2024, 0, 13, 19, 0], [2024, 0, 13, 21, 0]],
+        ['9/6', 'Practice, Warren, 3:00 p.m.', [2023, 8, 6, 15, 0], null],
+      ],
+  );
+
+  it(`doesn't resolve a time when there isn't one`, function() {
+    expect(parseTime('10/7', 'Practice is canceled', now, timeZone)).to.equal(null);
   });
 
   it(`compares two schedules`, function() {
-    const a = parseSchedule(input[0]);
-    const b = parseSchedule(input[1]);
+    const a = parseSchedule(input[0], now);
+    const b = parseSchedule(input[1], now);
     const result = compareSchedules(a, b);
     expect(result['added'].size).to.equal(2); // added 10/10 and 10/12
     expect(result['deleted'].size).to.equal(1); // removed 10/3
     expect(result['modified'].size).to.equal(1); // modified 10/5 from 4:45pm start to 4:30pm start.
-    expect(result['modified'].get('THURSDAY, 10/5')['timeBlock']).to.equal('4:30–6:30');
+    expect(result['modified'].get('THURSDAY, 10/5/2023')['timeBlock']).to.equal('4:30–6:30');
     expect(result['unchanged'].size).to.equal(2); // 10/7 and 10/8 remain unchanged
   });
+
+  it(`keeps every entry of a day`, function() {
+    const result = parseSchedule('Upcoming Schedule\n\nSATURDAY, 10/7\n\nGame vs Tigers, Downes, 10:00\n\nSATURDAY, 10/7\n\nGame vs Lions, Downes, 1:00\n\nSchedule by Season\n\n', now);
+    expect([...result.keys()]).to.eql(['SATURDAY, 10/7/2023', 'SATURDAY, 10/7/2023 @ 1:00']);
+    expect(result.get('SATURDAY, 10/7/2023 @ 1:00')['opponent']).to.equal('Lions');
+    const unscheduled = parseSchedule('Upcoming Schedule\n\nSATURDAY, 10/7\n\nGame vs Tigers\n\nSATURDAY, 10/7\n\nGame vs Lions\n\nSchedule by Season\n\n', now);
+    expect([...unscheduled.keys()]).to.eql(['SATURDAY, 10/7/2023', 'SATURDAY, 10/7/2023 #2']);
+  });
+
+  it(`only reports the entry that was dropped from a day with several entries`, function() {
+    const doubleheader = 'Upcoming Schedule\n\nSATURDAY, 10/7\n\nGame vs Tigers, Downes, 10:00\n\nSATURDAY, 10/7\n\nGame vs Lions, Downes, 1:00\n\nSchedule by Season\n\n';
+    const previous = parseSchedule(doubleheader, now);
+    const result = compareSchedules(previous, parseSchedule(doubleheader.replace('SATURDAY, 10/7\n\nGame vs Tigers, Downes, 10:00\n\n', ''), now));
+    expect([...result.deleted.keys()]).to.eql(['SATURDAY, 10/7/2023 @ 10:00']);
+    expect(result.deleted.get('SATURDAY, 10/7/2023 @ 10:00')['opponent']).to.equal('Tigers');
+    expect(result.modified.size).to.equal(0);
+    expect([...result.unchanged.keys()]).to.eql(['SATURDAY, 10/7/2023']);
+    const added = compareSchedules(parseSchedule(doubleheader.replace('SATURDAY, 10/7\n\nGame vs Tigers, Downes, 10:00\n\n', ''), now), previous);
+    expect([...added.added.keys()]).to.eql(['SATURDAY, 10/7/2023']);
+    expect(added.added.get('SATURDAY, 10/7/2023')['opponent']).to.equal('Tigers');
+    expect(added.modified.size).to.equal(0);
+  });
+
+  it(`keeps the year of each entry across the turn of the year`, function() {
+    const december = new Date('2023-12-20T12:00:00Z');
+    const result = parseSchedule('Upcoming Schedule\n\nSATURDAY, 12/30\n\nPractice, Warren, 3:00\n\nWEDNESDAY, 1/3\n\nPractice, Warren, 3:00\n\nSchedule by Season\n\n', december);
+    expect(result.get('SATURDAY, 12/30/2023')['date']).to.equal('2023-12-30');
+    expect(result.get('WEDNESDAY, 1/3/2024')['date']).to.equal('2024-01-03');
+    expect(getScheduledDate(result.get('WEDNESDAY, 1/3/2024'), new Date('2024-08-01T12:00:00Z'))).to.eql(new Date(2024, 0, 3));
+    expect(getScheduledDate({dayOfMonth: '1/3'}, december)).to.eql(new Date(2024, 0, 3));
+  });
+
+  it(`treats the same day of another year as a different entry`, function() {
+    const page = 'Upcoming Schedule\n\nTUESDAY, 12/5\n\nPractice, Warren, 3:00\n\nSchedule by Season\n\n';
+    const lastSeason = parseSchedule(page, new Date('2023-12-01T12:00:00Z'));
+    const thisSeason = parseSchedule(page.replace('Warren', 'Eliot'), new Date('2028-12-01T12:00:00Z'));
+    const result = compareSchedules(lastSeason, thisSeason);
+    expect([...result.deleted.keys()]).to.eql(['TUESDAY, 12/5/2023']);
+    expect([...result.added.keys()]).to.eql(['TUESDAY, 12/5/2028']);
+    expect(result.modified.size).to.equal(0);
+    expect(result.unchanged.size).to.equal(0);
+  });
+
+  it(`summarizes the changes between two schedules`, function() {
+    const a = parseSchedule(input[0]);
+    const b = parseSchedule(input[1]);
+    expect(summarizeChanges(compareSchedules(a, b))).to.equal('2 added, 1 modified, 1 removed');
+    expect(summarizeChanges(compareSchedules(a, a))).to.equal('No changes');
+  });
+
+  describe('Republished Page', function() {
+    // Captured after the page was republished as is: the regenerated markup
+    // changed the whitespace, dashes, and invisible characters, but not the text
+    const republished = [
+      'Upcoming Schedule\n\nWear baseball pants or sweatpants to every practice, and bring all of your baseball gear.\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nLate: Aiden, Sam, Zach\n\nOut: Matty\n\nTHURSDAY, 10/5\n\n​Practice, Warren,  4:45 - 6:45\n\nLate: —\n\nOut: Matty\n\nSATURDAY,  10/7\nPractice ,Warren, 3:00‑5:30\nLate: —\nOut: Connor\n\nSUNDAY, 10/8\n\nPractice, Warren, 3:00–5:30\n\nSchedule by Season\n\n',
+      'Upcoming ScheduleWear baseball pants or sweatpants to every practice, and bring all of your baseball gear.TUESDAY, 10/3Practice, Warren, 4:45–6:45Late: Aiden, Sam, ZachOut: MattyTHURSDAY, 10/5Practice, Warren, 4:45–6:45Late: —Out: MattySATURDAY, 10/7Practice, Warren, 3:00–5:30Late: —Out: ConnorSUNDAY, 10/8Practice, Warren, 3:00–5:30Late: —Out: ConnorSchedule by Season',
+    ];
+
+    unroll(`reports no changes for republished capture ##index`,
+        function(done, testArgs) {
+          const result = compareSchedules(parseSchedule(input[0], now), parseSchedule(republished[testArgs['index']], now));
+          expect(summarizeChanges(result)).to.equal('No changes');
+          expect(result['unchanged'].size).to.equal(4);
+          done();
+        },
+        [
+          ['index'],
+          [0],
+          [1],
+        ],
+    );
+
+    it(`still reports changes to the text itself`, function() {
+      const edited = parseSchedule(input[0].replace('Practice, Warren, 4:45–6:45', 'Practice, Eliot, 4:45–6:45'), now);
+      expect(summarizeChanges(compareSchedules(parseSchedule(input[0], now), edited))).to.equal('1 modified');
+    });
+
+    it(`normalizes the whitespace, dashes, and invisible characters`, function() {
+      expect(normalizeEntryText('​Practice , Warren')).to.equal('Practice, Warren');
+      expect(normalizeEntryText('4:45 – 6:45')).to.equal('4:45-6:45');
+      expect(normalizeEntryText('Practice, warren')).to.not.equal(normalizeEntryText('Practice, Warren'));
+    });
+  });
+
+  describe('Change suppression rules', function() {
+    const now = new Date(2023, 9, 1);
+    const noRules = {patterns: [], timeFormatting: false, whitespace: false};
+    const page = 'SATURDAY, 10/7 Practice, Warren, 3:00–5:30 SUNDAY, 10/8 Game, Downes, 1:00–3:00 Schedule by Season';
+
+    it(`ignores the text matching the patterns`, function() {
+      const rules = {...noRules, patterns: ['\\s*\\(updated\\)', '\\*']};
+      expect(getComparableText('Practice, Warren (updated)*', rules)).to.equal('Practice, Warren');
+      const edited = parseSchedule(page.replace('Game, Downes', 'Game, Downes (updated)'), now);
+      expect(summarizeChanges(compareSchedules(parseSchedule(page, now), edited, rules))).to.equal('No changes');
+      expect(summarizeChanges(compareSchedules(parseSchedule(page, now), edited, noRules))).to.equal('1 modified');
+    });
+
+    it(`ignores the changes to how the time is written`, function() {
+      const edited = parseSchedule(page.replace('3:00–5:30', '3:00pm–5:30pm'), now);
+      expect(summarizeChanges(compareSchedules(parseSchedule(page, now), edited, {...noRules, timeFormatting: true}))).to.equal('No changes');
+      expect(summarizeChanges(compareSchedules(parseSchedule(page, now), edited, noRules))).to.equal('1 modified');
+      const moved = parseSchedule(page.replace('3:00–5:30', '3:30–5:30'), now);
+      expect(summarizeChanges(compareSchedules(parseSchedule(page, now), moved, {...noRules, timeFormatting: true}))).to.equal('1 modified');
+    });
+
+    it(`ignores the whitespace entirely`, function() {
+      const edited = parseSchedule(page.replace('Game, Downes', 'Game,Down es'), now);
+      expect(summarizeChanges(compareSchedules(parseSchedule(page, now), edited, {...noRules, whitespace: true}))).to.equal('No changes');
+      expect(summarizeChanges(compareSchedules(parseSchedule(page, now), edited, noRules))).to.equal('1 modified');
+    });
+  });
+
+  describe('canonicalization', function() {
+    it(`canonicalizes the keys`, function() {
+      expect(canonicalizeScheduleKey('Saturday,10/7')).to.equal('SATURDAY, 10/07');
+      expect(canonicalizeScheduleKey(' SUNDAY, 9/3 ')).to.equal('SUNDAY, 09/03');
+      expect(canonicalizeScheduleKey('Winter Practices ')).to.equal('Winter Practices');
+      expect(canonicalizeScheduleKey('saturday, 10/7  #2')).to.equal('SATURDAY, 10/07 #2');
+      expect(canonicalizeScheduleKey('saturday, 10/7/2023 @1:00')).to.equal('SATURDAY, 10/07/2023 @ 1:00');
+      expect(canonicalizeScheduleKey('SATURDAY, 10/7', {date: '2023-10-07'})).to.equal('SATURDAY, 10/07/2023');
+    });
+
+    it(`canonicalizes the values`, function() {
+      expect(canonicalizeEntryValue('Practice,  Warren\u200B.')).to.equal('Practice, Warren');
+      expect(canonicalizeEntryValue('4:45\u20136:45;')).to.equal('4:45-6:45');
+      expect(canonicalizeEntryValue(null)).to.equal(null);
+    });
+
+    it(`doesn't register cosmetic changes as changes`, function() {
+      const now = new Date('2023-10-01T12:00:00Z');
+      const before = canonicalizeSchedule(parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\n', now));
+      const after = canonicalizeSchedule(new Map([['Saturday, 10/07', {...parseSchedule('SATURDAY, 10/7\n\nPractice, Warren., 3:30\u20135:30\n\n', now).get('SATURDAY, 10/7/2023'), dayOfMonth: '10/07'}]]));
+      expect([...after.keys()]).to.eql(['SATURDAY, 10/07/2023']);
+      expect(before.get('SATURDAY, 10/07/2023').dayOfMonth).to.equal('10/7');
+      expect(summarizeChanges(compareSchedules(before, after))).to.equal('No changes');
+    });
+
+    it(`lets the later entry win when keys collide`, function() {
+      const schedule = canonicalizeSchedule(new Map([['SATURDAY, 10/7', {location: 'Warren'}], ['SATURDAY, 10/07/2023', {location: 'Larz', manuallyCorrected: true}]]), now);
+      expect(schedule.size).to.equal(1);
+      expect(schedule.get('SATURDAY, 10/07/2023').location).to.equal('Larz');
+    });
+
+    it(`infers the year of the keys stored without one`, function() {
+      const schedule = canonicalizeSchedule(new Map([['SATURDAY, 10/7', {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Warren'}], ['WEDNESDAY, 1/3', {dayOfWeek: 'WEDNESDAY', dayOfMonth: '1/3', location: 'Tappan'}]]), new Date('2023-12-20T12:00:00Z'));
+      expect([...schedule.keys()]).to.eql(['SATURDAY, 10/07/2023', 'WEDNESDAY, 01/03/2024']);
+    });
+  });
 });
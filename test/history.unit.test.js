@@ -0,0 +1,83 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {serializeSchedule} = require('../lib/helper_functions');
+const {parseAsOf, getSnapshotScreenshotKey, getScheduleAsOf, buildHistoryHtml} = require('../lib/history');
+const {recordSnapshotMetadata} = require('../lib/season');
+
+describe('History Unit Tests', function() {
+  const team = {id: 'BlineBanditsBot', name: 'Bandits 12U'};
+  const key = 'SATURDAY, 10/07';
+  const canonicalKey = 'SATURDAY, 10/07/2023'; // the year is inferred as of the snapshot
+  const practice = {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Practice, Warren', timeBlock: '3:00–5:30'};
+  let rootPath;
+  let store;
+
+  beforeEach(async function() {
+    rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    store = new LocalStore(rootPath);
+    await serializeSchedule(new Map([[key, practice]]), `${team.id}/archive/schedule-2023-10-1-1696190000000.json`, store);
+    await serializeSchedule(new Map([[key, {...practice, timeBlock: '3:30–5:30'}]]), `${team.id}/archive/schedule-2023-10-3-1696360000000.json`, store);
+    await store.upload(`${team.id}/archive/schedule-screenshot-2023-10-3-1696360000000.png`, Buffer.from('png'));
+  });
+
+  afterEach(function() {
+    fs.rmSync(rootPath, {recursive: true, force: true});
+  });
+
+  it(`parses the date to view the schedule as of`, function() {
+    expect(parseAsOf('2023-10-03', 'America/New_York').toISOString()).to.equal('2023-10-04T03:59:59.000Z');
+    expect(parseAsOf('2023-10-03T18:00:00Z').toISOString()).to.equal('2023-10-03T18:00:00.000Z');
+    expect(parseAsOf('last tuesday')).to.equal(null);
+  });
+
+  it(`finds the screenshot archived with the snapshot`, function() {
+    expect(getSnapshotScreenshotKey('team/archive/schedule-2023-10-3-1696360000000.json')).to.equal('team/archive/schedule-screenshot-2023-10-3-1696360000000.png');
+  });
+
+  it(`retrieves the schedule as of a past date`, async function() {
+    expect(await getScheduleAsOf(team.id, new Date(1696100000000), store)).to.equal(null);
+
+    const first = await getScheduleAsOf(team.id, new Date(1696300000000), store);
+    expect(first.timestamp.getTime()).to.equal(1696190000000);
+    expect(first.schedule.get(canonicalKey).timeBlock).to.equal('3:00-5:30');
+    expect(first.screenshotKey).to.equal(null);
+    expect(first.previous).to.equal(null);
+    expect(first.next.getTime()).to.equal(1696360000000);
+
+    const second = await getScheduleAsOf(team.id, new Date(1696400000000), store);
+    expect(second.schedule.get(canonicalKey).timeBlock).to.equal('3:30-5:30');
+    expect([...second.scheduleDiff.modified.keys()]).to.eql([canonicalKey]);
+    expect(second.screenshotKey).to.equal(`${team.id}/archive/schedule-screenshot-2023-10-3-1696360000000.png`);
+    expect(second.previous.getTime()).to.equal(1696190000000);
+    expect(second.next).to.equal(null);
+  });
+
+  it(`builds the page with navigation between the versions`, async function() {
+    const asOf = new Date(1696400000000);
+    const html = buildHistoryHtml(team, await getScheduleAsOf(team.id, asOf, store), asOf);
+    expect(html).to.contain('<tr class="modified"><td class="day">SATURDAY 10/7</td><td>Practice, Warren</td><td class="time">3:30-5:30</td></tr>');
+    expect(html).to.contain('<a href="/history/BlineBanditsBot?at=2023-10-01T19%3A53%3A20.000Z">&larr; Previous version</a>');
+    expect(html).to.contain('<span>Next version &rarr;</span>');
+    expect(html).to.contain('<img src="/history/BlineBanditsBot/screenshot/1696360000000.png"');
+    expect(buildHistoryHtml(team, null, asOf)).to.contain('No schedule was archived by');
+  });
+
+  it(`limits the history to a season`, async function() {
+    await recordSnapshotMetadata(`${team.id}/archive/schedule-2023-10-1-1696190000000.json`, {season: '2023 Fall', ageGroup: '12U'}, store);
+    await recordSnapshotMetadata(`${team.id}/archive/schedule-2023-10-3-1696360000000.json`, {season: '2024 Spring', ageGroup: '12U'}, store);
+    const asOf = new Date(1696400000000);
+    const view = await getScheduleAsOf(team.id, asOf, store, '2023 fall');
+    expect(view.timestamp.getTime()).to.equal(1696190000000);
+    expect(view.metadata).to.eql({season: '2023 Fall', ageGroup: '12U'});
+    expect(view.next).to.equal(null);
+    expect(await getScheduleAsOf(team.id, asOf, store, '2022 Fall')).to.equal(null);
+
+    const html = buildHistoryHtml(team, await getScheduleAsOf(team.id, asOf, store, '2024 Spring'), asOf);
+    expect(html).to.contain('<title>Bandits 12U schedule (2024 Spring)</title>');
+    expect(html).to.contain('<span>&larr; Previous version</span>');
+  });
+});
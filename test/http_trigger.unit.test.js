@@ -0,0 +1,81 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {recordRunResults} = require('../lib/run_results');
+const {isTokenAuthorized, isHttpEvent, handleHttpEvent} = require('../lib/http_trigger');
+
+describe('HTTP Trigger Unit Tests', function() {
+  const team = {id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u'};
+  const token = 'secret-token';
+  const original = process.env.TEAMS;
+  let store;
+  let checked;
+  const runTeams = async (teams) => {
+    checked.push(...teams.map((team) => team.id));
+    return teams.map((team) => ({team: team.id, url: team.url, outcome: 'unchanged', changes: 0, postedId: null, error: null, errorType: null}));
+  };
+
+  /**
+   * Builds a function URL (or HTTP API) event.
+   *
+   * @param {String} method the HTTP method
+   * @param {String} path the path
+   * @param {String} query the query string
+   * @param {Object} headers the headers
+   * @return {Object} the event
+   */
+  function httpEvent(method, path, query = '', headers = {authorization: `Bearer ${token}`}) {
+    return {rawPath: path, rawQueryString: query, headers, requestContext: {http: {method, path}}};
+  }
+
+  before(function() {
+    process.env.TEAMS = JSON.stringify([team, {id: 'OtherTeamBot', url: 'https://example.com/schedule'}]);
+  });
+
+  after(function() {
+    if (original === undefined) {
+      delete process.env.TEAMS;
+    } else {
+      process.env.TEAMS = original;
+    }
+  });
+
+  beforeEach(function() {
+    store = new MemoryStore();
+    checked = [];
+  });
+
+  it(`recognizes HTTP events and checks the token`, function() {
+    expect(isHttpEvent(httpEvent('GET', '/status'))).to.equal(true);
+    expect(isHttpEvent({httpMethod: 'GET', path: '/status'})).to.equal(true);
+    expect(isHttpEvent({url: 'https://example.com/schedule'})).to.equal(false);
+    expect(isTokenAuthorized(`Bearer ${token}`, token)).to.equal(true);
+    expect(isTokenAuthorized('Bearer wrong', token)).to.equal(false);
+    expect(isTokenAuthorized(token, token)).to.equal(false);
+    expect(isTokenAuthorized(`Bearer ${token}`, null)).to.equal(false);
+  });
+
+  it(`checks only the given team`, async function() {
+    const response = await handleHttpEvent(httpEvent('POST', '/check', `url=${team.id}`), runTeams, store, token);
+    expect(response.statusCode).to.equal(200);
+    expect(JSON.parse(response.body).results).to.have.lengthOf(1);
+    expect(checked).to.eql([team.id]);
+    expect((await handleHttpEvent(httpEvent('POST', '/check', 'url=NoSuchBot'), runTeams, store, token)).statusCode).to.equal(404);
+  });
+
+  it(`reports the results of the last run`, async function() {
+    expect(JSON.parse((await handleHttpEvent(httpEvent('GET', '/status'), runTeams, store, token)).body)).to.equal(null);
+    await recordRunResults([{team: team.id, outcome: 'changed', changes: 1}], store, new Date('2023-10-06T12:00:00Z'));
+    await recordRunResults([{team: team.id, outcome: 'unchanged', changes: 0}], store, new Date('2023-10-07T12:00:00Z'));
+    const status = JSON.parse((await handleHttpEvent({httpMethod: 'GET', path: '/status', headers: {Authorization: `Bearer ${token}`}}, runTeams, store, token)).body);
+    expect(status.finishedAt).to.equal('2023-10-07T12:00:00.000Z');
+    expect(status.results[0].outcome).to.equal('unchanged');
+  });
+
+  it(`rejects requests without the token, and is disabled without one`, async function() {
+    expect((await handleHttpEvent(httpEvent('POST', '/check', `url=${team.id}`, {}), runTeams, store, token)).statusCode).to.equal(401);
+    expect((await handleHttpEvent(httpEvent('POST', '/check', `url=${team.id}`), runTeams, store, null)).statusCode).to.equal(404);
+    expect((await handleHttpEvent(httpEvent('DELETE', '/check'), runTeams, store, token)).statusCode).to.equal(404);
+    expect(checked).to.eql([]);
+  });
+});
@@ -0,0 +1,54 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {PNG, FakeBrowser, MemoryStore} = require('./fakes');
+const {getPngSize, parseAspectRatio, getFittedSize, buildFittedHtml, formatImageForChannel, getDefaultBranding, loadTeamBranding} = require('../lib/image');
+
+describe('Image Unit Tests', function() {
+  it(`reads the size of the PNG`, function() {
+    expect(getPngSize(PNG)).to.eql({width: 1, height: 1});
+    expect(getPngSize(Buffer.from('not a png'))).to.equal(null);
+  });
+
+  it(`parses the aspect ratio`, function() {
+    expect(parseAspectRatio('16:9')).to.equal(16 / 9);
+    expect(parseAspectRatio('1:1')).to.equal(1);
+    expect(parseAspectRatio('wide')).to.equal(null);
+    expect(parseAspectRatio('1:0')).to.equal(null);
+  });
+
+  it(`pads or crops the image to the aspect ratio`, function() {
+    const screenshot = {width: 680, height: 940};
+    expect(getFittedSize(screenshot, 16 / 9, 'pad')).to.eql({width: 1671, height: 940});
+    expect(getFittedSize(screenshot, 16 / 9, 'crop')).to.eql({width: 680, height: 383});
+    expect(getFittedSize(screenshot, 1, 'pad')).to.eql({width: 940, height: 940});
+    expect(getFittedSize(screenshot, 1, 'crop')).to.eql({width: 680, height: 680});
+    expect(getFittedSize({width: 1600, height: 400}, 1, 'crop')).to.eql({width: 400, height: 400});
+  });
+
+  it(`keeps the top of the screenshot when cropped`, function() {
+    const html = buildFittedHtml(PNG, {width: 680, height: 680}, 'crop', '#ffffff');
+    expect(html).to.contain('width: 680px; height: 680px;');
+    expect(html).to.contain('object-fit: cover; object-position: top;');
+    expect(buildFittedHtml(PNG, {width: 940, height: 940}, 'pad', '#003366')).to.contain('object-fit: contain');
+  });
+
+  it(`formats the image for the channel`, async function() {
+    const browser = new FakeBrowser();
+    const formats = {twitter: {aspect: '16:9', fit: 'pad', background: '#003366'}, mastodon: {aspect: '1:1', fit: 'crop'}};
+    expect(await formatImageForChannel(browser, PNG, 'bluesky', formats)).to.equal(PNG);
+    expect(await formatImageForChannel(browser, PNG, 'mastodon', formats)).to.equal(PNG); // already square
+    expect(browser.pages).to.have.lengthOf(0);
+    await formatImageForChannel(browser, PNG, 'twitter', formats);
+    expect(browser.pages).to.have.lengthOf(1);
+    expect(browser.pages[0].content).to.contain('background: #003366');
+  });
+
+  it(`brands the images with the team's color and logo`, async function() {
+    const store = new MemoryStore();
+    await store.upload('team/logo.png', PNG);
+    const branding = await loadTeamBranding({id: 'team', color: '#0b3d91', logoKey: 'team/logo.png'}, store);
+    expect(branding.primaryColor).to.equal('#0b3d91');
+    expect(branding.logoUrl).to.equal(`data:image/png;base64,${PNG.toString('base64')}`);
+    expect(await loadTeamBranding({id: 'team', logoKey: 'team/missing.png'}, store)).to.eql(getDefaultBranding());
+  });
+});
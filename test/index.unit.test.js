@@ -0,0 +1,399 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const moment = require('moment-timezone');
+const config = require('../config');
+const {parseSchedule} = require('../lib/helper_functions');
+const {processTeam} = require('../index');
+const {AWS} = require('../lib/aws');
+const {PNG, MemoryStore, FakeScraper, FakeTwitterClient, FakeBrowser, twitterError, encodePng} = require('./fakes');
+
+describe('Processing Unit Tests', function() {
+  const team = {id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u', name: 'Bandits 12U'};
+  const original = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\n');
+  const updated = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\n');
+  const saturday = `SATURDAY, 10/07/${[...original.values()][0].date.slice(0, 4)}`; // the year is inferred from today
+  const env = {};
+  let store;
+  let browser;
+  let client;
+
+  before(function() {
+    // Post every change, without texting or emailing anyone
+    env.SEVERITY_ROUTES = process.env.SEVERITY_ROUTES;
+    process.env.SEVERITY_ROUTES = JSON.stringify({minor: ['social'], moderate: ['social'], critical: ['social']});
+  });
+
+  after(function() {
+    if (env.SEVERITY_ROUTES === undefined) {
+      delete process.env.SEVERITY_ROUTES;
+    } else {
+      process.env.SEVERITY_ROUTES = env.SEVERITY_ROUTES;
+    }
+  });
+
+  beforeEach(function() {
+    store = new MemoryStore();
+    browser = new FakeBrowser();
+    client = new FakeTwitterClient();
+  });
+
+  it(`seeds the schedule on the first run without posting`, async function() {
+    const scraper = new FakeScraper([original]);
+    const result = await processTeam(browser, store, team, undefined, () => scraper, client);
+    expect(result).to.eql({team: team.id, url: team.url, outcome: 'unchanged', changes: 0, postedId: null, error: null, errorType: null});
+    expect(await store.exists(`${team.id}/previousSchedule.json`)).to.equal(true);
+    expect(client.tweets).to.have.lengthOf(0);
+    expect(scraper.closed).to.equal(true);
+    expect(await store.exists(`${team.id}/run.lock`)).to.equal(false);
+  });
+
+  it(`skips the team while another run holds its lock`, async function() {
+    await store.upload(`${team.id}/run.lock`, JSON.stringify({owner: 'other', expiresAt: new Date(Date.now() + 60000).toISOString()}));
+    const scraper = new FakeScraper([original]);
+    const result = await processTeam(browser, store, team, undefined, () => scraper, client);
+    expect(result.outcome).to.equal('locked');
+    expect(scraper.scrapes).to.equal(0);
+    expect(await store.exists(`${team.id}/previousSchedule.json`)).to.equal(false);
+    expect(await store.exists(`${team.id}/run.lock`)).to.equal(true);
+  });
+
+  it(`archives and posts the changes with the page's screenshot`, async function() {
+    const scraper = new FakeScraper([original, updated]);
+    await processTeam(browser, store, team, undefined, () => scraper, client);
+    const result = await processTeam(browser, store, team, undefined, () => scraper, client);
+    expect(result.outcome).to.equal('changed');
+    expect(result.changes).to.equal(1);
+    expect(result.postedId).to.equal('1001');
+    expect(scraper.screenshots).to.have.lengthOf(1);
+    expect(client.uploads).to.have.lengthOf(1);
+    expect(client.tweets[0].text).to.contain('moved to 3:30pm');
+    expect(client.tweets[0].media).to.eql({media_ids: ['media-1']});
+    expect(client.altTexts).to.eql([{mediaId: 'media-1', text: 'Bandits 12U schedule: Practice Sat 10/7 3:30-5:30 at Warren'}]);
+    const archived = (await store.list(`${team.id}/archive/`)).map((file) => file.key);
+    expect(archived.filter((key) => /schedule-screenshot-.*\.png$/.test(key))).to.have.lengthOf(1);
+    expect(archived.filter((key) => /schedule-preview-.*\.png$/.test(key))).to.have.lengthOf(1);
+    expect(archived.filter((key) => /schedule-.*\.json$/.test(key))).to.have.lengthOf(1);
+    expect(JSON.parse(await store.download(`${team.id}/previousSchedule.json`))[saturday].timeBlock).to.equal('3:30-5:30');
+  });
+
+  it(`sends the preview image, rather than the screenshot, by email and to Facebook`, async function() {
+    const names = ['ADMIN_EMAIL', 'FACEBOOK_PAGE_ID', 'FACEBOOK_PAGE_ACCESS_TOKEN', 'SEVERITY_ROUTES'];
+    const originals = {};
+    names.forEach((name) => {
+      originals[name] = process.env[name];
+    });
+    process.env.ADMIN_EMAIL = 'coach@example.com';
+    process.env.FACEBOOK_PAGE_ID = '1234567890';
+    process.env.FACEBOOK_PAGE_ACCESS_TOKEN = 'page-token';
+    process.env.SEVERITY_ROUTES = JSON.stringify({minor: ['social', 'email'], moderate: ['social', 'email'], critical: ['social', 'email']});
+    // The composited preview is told apart from the screenshot by its contents
+    const preview = encodePng(4, 4, () => 128);
+    const newPage = browser.newPage.bind(browser);
+    browser.newPage = async () => {
+      const page = await newPage();
+      page.$ = async (selector) => ({screenshot: async () => selector === '#preview' ? preview : PNG});
+      return page;
+    };
+    const axios = require('axios');
+    const post = axios.post;
+    const photos = [];
+    axios.post = async (url, form) => {
+      photos.push({url, source: Buffer.from(await form.get('source').arrayBuffer())});
+      return {status: 200, data: {id: 'photo-1', post_id: 'post-1'}};
+    };
+    const SES = AWS.SES;
+    const emails = [];
+    AWS.SES = class {
+      // eslint-disable-next-line require-jsdoc
+      sendRawEmail(params) {
+        emails.push(params.RawMessage.Data);
+        return {promise: async () => ({MessageId: 'message-1'})};
+      }
+    };
+    try {
+      const scraper = new FakeScraper([original, updated]);
+      await processTeam(browser, store, team, undefined, () => scraper, client);
+      const result = await processTeam(browser, store, team, undefined, () => scraper, client);
+      expect(result.outcome).to.equal('changed');
+      const archivedPreview = (await store.list(`${team.id}/archive/`)).find((file) => /schedule-preview-.*\.png$/.test(file.key));
+      expect(Buffer.compare(await store.download(archivedPreview.key), preview)).to.equal(0);
+      expect(photos).to.have.lengthOf(1);
+      expect(photos[0].url).to.equal('https://graph.facebook.com/v18.0/1234567890/photos');
+      expect(Buffer.compare(photos[0].source, preview)).to.equal(0);
+      expect(emails).to.have.lengthOf(1);
+      expect(emails[0]).to.contain('Content-ID: <preview.png>');
+      expect(emails[0].replace(/\r\n/g, '')).to.contain(preview.toString('base64'));
+    } finally {
+      axios.post = post;
+      AWS.SES = SES;
+      for (const name of names) {
+        if (originals[name] === undefined) {
+          delete process.env[name];
+        } else {
+          process.env[name] = originals[name];
+        }
+      }
+    }
+  });
+
+  it(`archives a minor change without notifying any channel by default`, async function() {
+    const names = ['SEVERITY_ROUTES', 'WEBHOOKS'];
+    const originals = {};
+    names.forEach((name) => {
+      originals[name] = process.env[name];
+    });
+    delete process.env.SEVERITY_ROUTES;
+    process.env.WEBHOOKS = JSON.stringify([{url: 'https://example.com/hooks/schedule'}]);
+    const axios = require('axios');
+    const post = axios.post;
+    const posts = [];
+    axios.post = async (url) => {
+      posts.push(url);
+      return {status: 200, data: {}};
+    };
+    try {
+      // Only the casing of the location changed, i.e. a text fix
+      const scraper = new FakeScraper([original, parseSchedule('SATURDAY, 10/7\n\nPractice, warren, 3:00-5:30\n\n')]);
+      await processTeam(browser, store, team, undefined, () => scraper, client);
+      const result = await processTeam(browser, store, team, undefined, () => scraper, client);
+      expect(result).to.include({outcome: 'changed', changes: 1, postedId: null});
+      expect(client.tweets).to.have.lengthOf(0);
+      expect(posts).to.eql([]);
+      expect((await store.list(`${team.id}/archive/`)).filter((file) => /schedule-.*\.json$/.test(file.key))).to.have.lengthOf(1);
+    } finally {
+      axios.post = post;
+      for (const name of names) {
+        if (originals[name] === undefined) {
+          delete process.env[name];
+        } else {
+          process.env[name] = originals[name];
+        }
+      }
+    }
+  });
+
+  it(`archives the changes without tweeting in the no-tweet mode`, async function() {
+    const scraper = new FakeScraper([original, updated]);
+    await processTeam(browser, store, {...team, mode: 'no-tweet'}, undefined, () => scraper, client);
+    const result = await processTeam(browser, store, {...team, mode: 'no-tweet'}, undefined, () => scraper, client);
+    expect(result).to.include({outcome: 'changed', changes: 1, postedId: null});
+    expect(client.tweets).to.have.lengthOf(0);
+    expect((await store.list(`${team.id}/archive/`)).length).to.be.above(0);
+  });
+
+  it(`writes the artifacts of a dry run instead of archiving and posting`, async function() {
+    const scraper = new FakeScraper([original, updated]);
+    await processTeam(browser, store, team, undefined, () => scraper, client);
+    const previous = await store.download(`${team.id}/previousSchedule.json`);
+    const written = new Map();
+    const artifacts = {write: async (name, contents) => written.set(name, contents) && name};
+    const result = await processTeam(browser, store, team, undefined, () => scraper, client, artifacts);
+    expect(result).to.include({outcome: 'dry-run', changes: 1, postedId: null});
+    expect([...written.keys()].sort()).to.eql(['changes.txt', 'preview.png', 'report.html', 'schedule.json', 'screenshot.png'].map((name) => `${team.id}/${name}`));
+    expect(written.get(`${team.id}/changes.txt`)).to.contain('3:30');
+    expect(client.tweets).to.have.lengthOf(0);
+    expect(await store.list(`${team.id}/archive/`)).to.have.lengthOf(0);
+    expect((await store.download(`${team.id}/previousSchedule.json`)).toString()).to.equal(previous.toString());
+    expect(await store.exists(`${team.id}/run.lock`)).to.equal(false);
+  });
+
+  it(`queues the changes outside of the posting window, and posts them inside of it`, async function() {
+    const local = moment(new Date()).tz(config.display_time_zone);
+    const hours = (local.hours() + 2) % 24;
+    const closed = {...team, postingWindow: `${hours}:00-${hours}:30`};
+    const scraper = new FakeScraper([original, updated]);
+    await processTeam(browser, store, closed, undefined, () => scraper, client);
+    const queued = await processTeam(browser, store, closed, undefined, () => scraper, client);
+    expect(queued).to.include({outcome: 'queued', changes: 1, postedId: null});
+    expect(client.tweets).to.have.lengthOf(0);
+    expect(JSON.parse(await store.download(`${team.id}/pendingPost.json`))).to.include({attempts: 0});
+
+    const posted = await processTeam(browser, store, {...team, postingWindow: '00:00-24:00'}, undefined, () => scraper, client);
+    expect(posted).to.include({outcome: 'changed', changes: 1, postedId: '1001'});
+    expect(client.tweets).to.have.lengthOf(1);
+  });
+
+  it(`waits for the page to settle before posting the changes`, async function() {
+    const debounced = {...team, debounceMinutes: 20};
+    const scraper = new FakeScraper([original, updated]);
+    await processTeam(browser, store, debounced, undefined, () => scraper, client);
+    expect(await processTeam(browser, store, debounced, undefined, () => scraper, client)).to.include({outcome: 'queued', postedId: null});
+    expect(client.tweets).to.have.lengthOf(0);
+
+    // The page hasn't changed since 30 minutes ago
+    const pending = JSON.parse(await store.download(`${team.id}/pendingPost.json`));
+    await store.upload(`${team.id}/pendingPost.json`, JSON.stringify({...pending, startedAt: new Date(Date.now() - 30 * 60 * 1000).toISOString()}));
+    expect(await processTeam(browser, store, debounced, undefined, () => scraper, client)).to.include({outcome: 'changed', postedId: '1001'});
+    expect(client.tweets).to.have.lengthOf(1);
+  });
+
+  it(`stores the team's season with the archived schedule`, async function() {
+    const scraper = new FakeScraper([original, updated]);
+    const seasonal = {...team, season: '2023 Fall', ageGroup: '12U'};
+    await processTeam(browser, store, seasonal, undefined, () => scraper, client);
+    await processTeam(browser, store, seasonal, undefined, () => scraper, client);
+    const metadataKeys = (await store.list(`${team.id}/archive/`)).map((file) => file.key).filter((key) => key.endsWith('.json.meta'));
+    expect(metadataKeys).to.have.lengthOf(1);
+    expect(JSON.parse(await store.download(metadataKeys[0]))).to.eql({season: '2023 Fall', ageGroup: '12U'});
+  });
+
+  it(`alternates the format of the posts between the variants of the team's experiment`, async function() {
+    const scraper = new FakeScraper([original, updated, original]);
+    const experimenting = {...team, experiment: {name: 'lead', variants: ['none', 'sentence']}};
+    for (let run = 0; run < 3; run++) {
+      await processTeam(browser, store, experimenting, undefined, () => scraper, client);
+    }
+    expect(client.tweets).to.have.lengthOf(2);
+    expect(client.tweets[0].text).to.match(/^Latest Bandits 12U Schedule/);
+    expect(client.tweets[1].text).to.match(/^Saturday's practice moved to 3pm\. Latest/);
+    expect(JSON.parse(await store.download(`${team.id}/experiment.json`))).to.eql({name: 'lead', assignments: {none: 1, sentence: 1}});
+  });
+
+  it(`delays the post when the page fetched directly disagrees with the extraction`, async function() {
+    const axios = require('axios');
+    const get = axios.get;
+    axios.get = async () => ({status: 200, headers: {'content-type': 'text/plain'}, data: 'SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\n'});
+    process.env.CROSS_CHECK = 'true';
+    try {
+      const scraper = new FakeScraper([original, updated]);
+      const checked = {...team, scrape: {parser: 'text'}};
+      await processTeam(browser, store, checked, undefined, () => scraper, client);
+      const result = await processTeam(browser, store, checked, undefined, () => scraper, client);
+      expect(result.outcome).to.equal('delayed');
+      expect(client.tweets).to.have.lengthOf(0);
+      expect(JSON.parse(await store.download(`${team.id}/crossCheck.json`))).to.include({delays: 1});
+      expect(JSON.parse(await store.download(`${team.id}/previousSchedule.json`))[saturday].timeBlock).to.equal('3:00-5:30');
+    } finally {
+      axios.get = get;
+      delete process.env.CROSS_CHECK;
+    }
+  });
+
+  it(`skips the diff while the schedule section hashes the same`, async function() {
+    process.env.CONTENT_CACHE = 'true';
+    try {
+      // The second scrape parses differently, but the page's text is the same, so it's skipped
+      const texts = ['SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\n', 'SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\n', 'SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\n'];
+      const scraper = new FakeScraper([original, updated, updated]);
+      const scrape = scraper.scrape.bind(scraper);
+      scraper.scrape = async (scraped, signal) => {
+        scraper.content = {html: '', text: texts[scraper.scrapes]};
+        return scrape(scraped, signal);
+      };
+      const cached = {...team, scrape: {parser: 'text'}};
+      await processTeam(browser, store, cached, undefined, () => scraper, client);
+      expect(await store.exists(`${team.id}/contentCache.json`)).to.equal(true);
+      expect((await processTeam(browser, store, cached, undefined, () => scraper, client)).outcome).to.equal('unchanged');
+      expect((await processTeam(browser, store, cached, undefined, () => scraper, client)).outcome).to.equal('changed');
+      expect(client.tweets).to.have.lengthOf(1);
+    } finally {
+      delete process.env.CONTENT_CACHE;
+    }
+  });
+
+  it(`draws the schedule instead of screenshotting the page when rendered`, async function() {
+    const scraper = new FakeScraper([original, updated]);
+    const rendered = {...team, screenshot: 'rendered'};
+    await processTeam(browser, store, rendered, undefined, () => scraper, client);
+    const result = await processTeam(browser, store, rendered, undefined, () => scraper, client);
+    expect(result.outcome).to.equal('changed');
+    expect(scraper.screenshots).to.have.lengthOf(0);
+    expect(browser.pages.some((page) => `${page.content}`.includes('3:30-5:30'))).to.equal(true);
+    expect(client.tweets).to.have.lengthOf(1);
+  });
+
+  it(`records the failures without posting`, async function() {
+    const scraper = new FakeScraper([new Error('net::ERR_NAME_NOT_RESOLVED')]);
+    const result = await processTeam(browser, store, team, undefined, () => scraper, client);
+    expect(result).to.eql({team: team.id, url: team.url, outcome: 'failed', changes: 0, postedId: null, error: 'net::ERR_NAME_NOT_RESOLVED', errorType: null});
+    expect(scraper.closed).to.equal(true);
+    expect(client.tweets).to.have.lengthOf(0);
+
+  });
+
+  it(`fails rather than posting when the page parses to no entries`, async function() {
+    const scraper = new FakeScraper([original, new Map()]);
+    await processTeam(browser, store, team, undefined, () => scraper, client);
+    const result = await processTeam(browser, store, team, undefined, () => scraper, client);
+    expect(result.outcome).to.equal('failed');
+    expect(result.error).to.equal('The page parsed to no entries, while the previous schedule had 1');
+    expect(client.tweets).to.have.lengthOf(0);
+    expect(JSON.parse(await store.download(`${team.id}/previousSchedule.json`))[saturday].timeBlock).to.equal('3:00-5:30');
+  });
+
+  it(`alerts instead of posting when too many entries vanish at once`, async function() {
+    const names = ['SANITY_MAX_VANISHED_PERCENT', 'ADMIN_EMAIL'];
+    names.forEach((name) => {
+      env[name] = process.env[name];
+    });
+    process.env.SANITY_MAX_VANISHED_PERCENT = '40';
+    delete process.env.ADMIN_EMAIL;
+    try {
+      const full = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\nSUNDAY, 10/8\n\nGame, Downes, 1:00\n\n');
+      const scraper = new FakeScraper([full, updated]);
+      await processTeam(browser, store, team, undefined, () => scraper, client);
+      const result = await processTeam(browser, store, team, undefined, () => scraper, client);
+      expect(result.outcome).to.equal('failed');
+      expect(result.error).to.equal('1 of the 2 entries (50%) vanished at once, more than the 40% allowed');
+      expect(client.tweets).to.have.lengthOf(0);
+      expect(JSON.parse(await store.download(`${team.id}/failureAlert.json`))).to.include({kind: 'sanity'});
+    } finally {
+      for (const name of names) {
+        if (env[name] === undefined) {
+          delete process.env[name];
+        } else {
+          process.env[name] = env[name];
+        }
+      }
+    }
+  });
+
+  it(`posts the changes on the next run when tweeting fails temporarily`, async function() {
+    const scraper = new FakeScraper([original, updated]);
+    await processTeam(browser, store, team, undefined, () => scraper, client);
+    const failed = await processTeam(browser, store, team, undefined, () => scraper, new FakeTwitterClient(twitterError(503, {title: 'Service Unavailable'})));
+    expect(failed.outcome).to.equal('failed');
+    expect(failed.changes).to.equal(1);
+    expect(failed.errorType).to.equal('server');
+    expect(JSON.parse(await store.download(`${team.id}/previousSchedule.json`))[saturday].timeBlock).to.equal('3:00-5:30');
+    const retried = await processTeam(browser, store, team, undefined, () => scraper, client);
+    expect(retried.outcome).to.equal('changed');
+    expect(retried.postedId).to.equal('1001');
+    // The retry reused what the failed run archived, and committed the schedule once posted
+    const archived = (await store.list(`${team.id}/archive/`)).map((file) => file.key);
+    expect(archived.filter((key) => /schedule-\d.*\.json$/.test(key))).to.have.lengthOf(1);
+    expect(await store.exists(`${team.id}/pendingPost.json`)).to.equal(false);
+    expect(JSON.parse(await store.download(`${team.id}/previousSchedule.json`))[saturday].timeBlock).to.equal('3:30-5:30');
+  });
+
+  it(`gives up on the changes once a post fails for good on every attempt`, async function() {
+    env.POST_MAX_ATTEMPTS = process.env.POST_MAX_ATTEMPTS;
+    process.env.POST_MAX_ATTEMPTS = '2';
+    try {
+      const scraper = new FakeScraper([original, updated]);
+      const rejecting = new FakeTwitterClient(twitterError(401, {title: 'Unauthorized'}));
+      await processTeam(browser, store, team, undefined, () => scraper, client);
+      expect((await processTeam(browser, store, team, undefined, () => scraper, rejecting)).errorType).to.equal('unauthorized');
+      expect(JSON.parse(await store.download(`${team.id}/pendingPost.json`))).to.include({attempts: 1});
+      expect(JSON.parse(await store.download(`${team.id}/previousSchedule.json`))[saturday].timeBlock).to.equal('3:00-5:30');
+      expect((await processTeam(browser, store, team, undefined, () => scraper, rejecting)).outcome).to.equal('failed');
+      expect(await store.exists(`${team.id}/pendingPost.json`)).to.equal(false);
+      expect(JSON.parse(await store.download(`${team.id}/previousSchedule.json`))[saturday].timeBlock).to.equal('3:30-5:30');
+    } finally {
+      if (env.POST_MAX_ATTEMPTS === undefined) {
+        delete process.env.POST_MAX_ATTEMPTS;
+      } else {
+        process.env.POST_MAX_ATTEMPTS = env.POST_MAX_ATTEMPTS;
+      }
+    }
+  });
+
+  it(`skips a duplicate tweet without failing`, async function() {
+    const scraper = new FakeScraper([original, updated]);
+    await processTeam(browser, store, team, undefined, () => scraper, client);
+    const result = await processTeam(browser, store, team, undefined, () => scraper, new FakeTwitterClient(twitterError(403, {detail: 'You are not allowed to create a Tweet with duplicate content.'})));
+    expect(result.outcome).to.equal('changed');
+    expect(result.postedId).to.equal(null);
+    expect(JSON.parse(await store.download(`${team.id}/previousSchedule.json`))[saturday].timeBlock).to.equal('3:30-5:30');
+  });
+});
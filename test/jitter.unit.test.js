@@ -0,0 +1,14 @@
+const expect = require('chai').expect;
+const {getJitteredDelay} = require('../lib/jitter');
+
+describe('Jitter Unit Tests', function() {
+  it(`adds random jitter on top of the base delay`, function() {
+    expect(getJitteredDelay(300, 60, () => 0)).to.equal(300000);
+    expect(getJitteredDelay(300, 60, () => 0.5)).to.equal(330000);
+    expect(getJitteredDelay(300, 0, () => 0.5)).to.equal(300000);
+  });
+
+  it(`never returns a negative delay`, function() {
+    expect(getJitteredDelay(-10, -5, () => 0.5)).to.equal(0);
+  });
+});
@@ -0,0 +1,52 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {createTrackedLink, recordClick, getEngagementReport} = require('../lib/link_tracking');
+
+describe('Link Tracking Unit Tests', function() {
+  let rootPath;
+  let store;
+  const originalBaseUrl = process.env.LINK_TRACKING_BASE_URL;
+
+  beforeEach(function() {
+    rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    store = new LocalStore(rootPath);
+  });
+
+  afterEach(function() {
+    fs.rmSync(rootPath, {recursive: true, force: true});
+    if (originalBaseUrl === undefined) {
+      delete process.env.LINK_TRACKING_BASE_URL;
+    } else {
+      process.env.LINK_TRACKING_BASE_URL = originalBaseUrl;
+    }
+  });
+
+  it(`returns the URL as is when link tracking isn't configured`, async function() {
+    delete process.env.LINK_TRACKING_BASE_URL;
+    expect(await createTrackedLink('team', 'https://example.com', 'sms', store)).to.equal('https://example.com');
+  });
+
+  it(`counts the clicks on tracked links per channel`, async function() {
+    process.env.LINK_TRACKING_BASE_URL = 'https://bandits.example.com/';
+    const smsLink = await createTrackedLink('team', 'https://example.com', 'sms', store);
+    const socialLink = await createTrackedLink('team', 'https://example.com', 'social', store);
+    expect(smsLink).to.match(/^https:\/\/bandits\.example\.com\/r\/team\/[A-Za-z0-9_-]+$/);
+
+    const smsId = smsLink.split('/').pop();
+    await recordClick('team', smsId, store);
+    const link = await recordClick('team', smsId, store);
+    expect(link.clicks).to.equal(2);
+    expect(link.url).to.equal('https://example.com');
+    expect(await recordClick('team', 'missing', store)).to.equal(null);
+
+    const report = await getEngagementReport('team', store);
+    expect(report.notifications).to.equal(2);
+    expect(report.clicks).to.equal(2);
+    expect(report.clicksByChannel).to.eql({sms: 2, social: 0});
+    expect(socialLink).to.not.equal(smsLink);
+  });
+});
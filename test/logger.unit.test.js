@@ -0,0 +1,48 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {Logger} = require('../lib/logger');
+
+describe('Logger Unit Tests', function() {
+  const originalLevel = process.env.LOG_LEVEL;
+  const originalFormat = process.env.LOG_FORMAT;
+  let lines;
+  let logger;
+
+  beforeEach(function() {
+    lines = [];
+    logger = new Logger({}, {out: (line) => lines.push(['out', line]), err: (line) => lines.push(['err', line])});
+  });
+
+  afterEach(function() {
+    for (const [name, value] of [['LOG_LEVEL', originalLevel], ['LOG_FORMAT', originalFormat]]) {
+      if (value === undefined) {
+        delete process.env[name];
+      } else {
+        process.env[name] = value;
+      }
+    }
+  });
+
+  it(`skips the levels below the configured level`, function() {
+    process.env.LOG_LEVEL = 'warn';
+    logger.info('hidden');
+    logger.warn('shown');
+    expect(lines.length).to.equal(1);
+    expect(lines[0][0]).to.equal('err');
+  });
+
+  it(`writes one JSON object per line, with the fields`, function() {
+    process.env.LOG_LEVEL = 'debug';
+    process.env.LOG_FORMAT = 'json';
+    logger.with({team: 'BlineBanditsBot', mode: 'browser'}).info('No differences detected', {durationMs: 1200});
+    const line = JSON.parse(lines[0][1]);
+    expect(line).to.include({level: 'info', msg: 'No differences detected', team: 'BlineBanditsBot', mode: 'browser', durationMs: 1200});
+  });
+
+  it(`writes the fields and the error's stack in the text format`, function() {
+    delete process.env.LOG_LEVEL;
+    delete process.env.LOG_FORMAT;
+    logger.with({team: 'BlineBanditsBot'}).error(new Error('Navigation timeout'), {reason: 'took too long'});
+    expect(lines[0][1]).to.match(/^ERROR: .* - Navigation timeout team=BlineBanditsBot reason="took too long"\nError: Navigation timeout/);
+  });
+});
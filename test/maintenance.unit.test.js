@@ -0,0 +1,46 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {getMaintenanceStatus, pauseNotifications, resumeNotifications, formatMaintenanceStatus} = require('../lib/maintenance');
+
+describe('Maintenance Unit Tests', function() {
+  let store;
+
+  beforeEach(function() {
+    store = new LocalStore(fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-')));
+  });
+
+  it(`is active when posting hasn't been paused`, async function() {
+    const status = await getMaintenanceStatus(store);
+    expect(status.paused).to.equal(false);
+    expect(formatMaintenanceStatus(status)).to.equal('Active');
+  });
+
+  it(`pauses and resumes posting`, async function() {
+    await pauseNotifications('harvard', 'site migration', store, new Date('2023-10-06T16:00:00Z'));
+    const status = await getMaintenanceStatus(store);
+    expect(status).to.eql({paused: true, since: '2023-10-06T16:00:00.000Z', by: 'harvard', reason: 'site migration', source: 'store'});
+    expect(formatMaintenanceStatus(status)).to.match(/^Paused since .* by harvard \(site migration\)$/);
+
+    expect(await resumeNotifications(store)).to.equal(true);
+    expect((await getMaintenanceStatus(store)).paused).to.equal(false);
+    expect(await resumeNotifications(store)).to.equal(false);
+  });
+
+  it(`pauses posting through the config`, async function() {
+    process.env.MAINTENANCE_MODE = 'true';
+    process.env.MAINTENANCE_BY = 'harvard';
+    try {
+      const status = await getMaintenanceStatus(store);
+      expect(status.paused).to.equal(true);
+      expect(status.source).to.equal('config');
+      expect(formatMaintenanceStatus(status)).to.equal('Paused by harvard [MAINTENANCE_MODE]');
+    } finally {
+      delete process.env.MAINTENANCE_MODE;
+      delete process.env.MAINTENANCE_BY;
+    }
+  });
+});
@@ -0,0 +1,98 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {PNG} = require('./fakes');
+const {getMastodonSettings, uploadMedia, postStatus, postScreenshotToMastodon, checkMastodon} = require('../lib/mastodon');
+
+describe('Mastodon Unit Tests', function() {
+  const names = ['MASTODON_INSTANCE_URL', 'MASTODON_ACCESS_TOKEN', 'MASTODON_VISIBILITY'];
+  const originals = {};
+  const settings = {instanceUrl: 'https://mastodon.example', accessToken: 'own-token', visibility: 'unlisted'};
+
+  beforeEach(function() {
+    names.forEach((name) => {
+      originals[name] = process.env[name];
+      delete process.env[name];
+    });
+  });
+
+  afterEach(function() {
+    for (const name of names) {
+      if (originals[name] === undefined) {
+        delete process.env[name];
+      } else {
+        process.env[name] = originals[name];
+      }
+    }
+  });
+
+  it(`configures the account per team`, function() {
+    expect(getMastodonSettings({id: 'team'})).to.equal(null);
+    expect(getMastodonSettings({id: 'team', mastodon: settings})).to.eql(settings);
+    process.env.MASTODON_INSTANCE_URL = 'https://mastodon.social';
+    process.env.MASTODON_ACCESS_TOKEN = 'default-token';
+    expect(getMastodonSettings({id: 'team'})).to.eql({instanceUrl: 'https://mastodon.social', accessToken: 'default-token', visibility: 'public'});
+    expect(getMastodonSettings({id: 'team', mastodon: {accessToken: 'own-token'}})).to.eql({instanceUrl: 'https://mastodon.social', accessToken: 'own-token', visibility: 'public'});
+  });
+
+  it(`uploads the image with its description`, async function() {
+    const requests = [];
+    const http = {post: async (url, form, options) => {
+      requests.push({url, baseURL: options.baseURL, authorization: options.headers.Authorization, file: form.get('file'), description: form.get('description')});
+      return {status: 200, data: {id: 'media-1', url: 'https://mastodon.example/media/1.png'}};
+    }};
+    expect(await uploadMedia(PNG, 'Bandits 12U schedule: nothing scheduled', undefined, settings, http)).to.equal('media-1');
+    expect(requests).to.have.lengthOf(1);
+    expect(requests[0]).to.include({url: '/api/v2/media', baseURL: 'https://mastodon.example', authorization: 'Bearer own-token', description: 'Bandits 12U schedule: nothing scheduled'});
+    expect(requests[0].file.size).to.equal(PNG.length);
+
+    const failed = {post: async () => ({status: 422, data: {error: 'Validation failed'}})};
+    expect(await uploadMedia(PNG, '', undefined, settings, failed)).to.equal(null);
+  });
+
+  it(`waits for the media that's processed asynchronously`, async function() {
+    const http = {
+      post: async () => ({status: 202, data: {id: 'media-2', url: null}}),
+      get: async (url) => {
+        expect(url).to.equal('/api/v1/media/media-2');
+        return {status: 200, data: {id: 'media-2', url: 'https://mastodon.example/media/2.png'}};
+      },
+    };
+    expect(await uploadMedia(PNG, '', undefined, settings, http)).to.equal('media-2');
+  });
+
+  it(`posts the status with the media and visibility`, async function() {
+    const requests = [];
+    const http = {post: async (url, body, options) => {
+      requests.push({url, body, baseURL: options.baseURL, authorization: options.headers.Authorization});
+      return {status: 200, data: {id: '1', url: 'https://mastodon.example/@bandits/1'}};
+    }};
+    expect(await postStatus('Schedule update', ['media-1'], 'unlisted', undefined, settings, http)).to.eql({id: '1', url: 'https://mastodon.example/@bandits/1'});
+    expect(requests[0]).to.eql({url: '/api/v1/statuses', body: {status: 'Schedule update', media_ids: ['media-1'], visibility: 'unlisted'}, baseURL: 'https://mastodon.example', authorization: 'Bearer own-token'});
+
+    expect(await postStatus('Schedule update', ['media-1'], 'everyone', undefined, settings, http)).to.equal(null);
+    expect(requests).to.have.lengthOf(1);
+  });
+
+  it(`posts the screenshot from the team's account`, async function() {
+    const requests = [];
+    const http = {post: async (url, body, options) => {
+      requests.push({url, baseURL: options.baseURL, visibility: body.visibility});
+      return url === '/api/v2/media' ?
+        {status: 200, data: {id: 'media-1', url: 'https://mastodon.example/media/1.png'}} :
+        {status: 200, data: {id: '1', url: 'https://mastodon.example/@bandits/1'}};
+    }};
+    expect(await postScreenshotToMastodon(PNG, 'Schedule update', undefined, '', {id: 'team', mastodon: settings}, http)).to.include({id: '1'});
+    expect(requests.map((request) => request.url)).to.eql(['/api/v2/media', '/api/v1/statuses']);
+    expect(requests[1]).to.include({baseURL: 'https://mastodon.example', visibility: 'unlisted'});
+
+    expect(await postScreenshotToMastodon(PNG, 'Schedule update', undefined, '', {id: 'other'}, http)).to.equal(null);
+    expect(requests).to.have.lengthOf(2); // not configured for the team
+  });
+
+  it(`checks that the access tokens work`, async function() {
+    process.env.MASTODON_INSTANCE_URL = 'https://mastodon.social';
+    process.env.MASTODON_ACCESS_TOKEN = 'default-token';
+    const http = {get: async (url, options) => ({status: 200, data: {acct: options.headers.Authorization === 'Bearer own-token' ? 'bandits10u' : 'banditsbot'}})};
+    expect(await checkMastodon([{id: 'team'}, {id: 'other', mastodon: settings}], http)).to.equal('@banditsbot, @bandits10u');
+  });
+});
@@ -0,0 +1,54 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {Metrics} = require('../lib/metrics');
+
+describe('Metrics Unit Tests', function() {
+  const originalEmf = process.env.METRICS_EMF;
+  let metrics;
+
+  beforeEach(function() {
+    metrics = new Metrics();
+    metrics.observe('scrape_duration_seconds', {team: 'BlineBanditsBot'}, 2.5);
+    metrics.observe('scrape_duration_seconds', {team: 'BlineBanditsBot'}, 1.5);
+    metrics.set('schedule_entries', {team: 'BlineBanditsBot'}, 4);
+    metrics.increment('posts_total', {team: 'BlineBanditsBot', channel: 'twitter', result: 'success'});
+  });
+
+  afterEach(function() {
+    if (originalEmf === undefined) {
+      delete process.env.METRICS_EMF;
+    } else {
+      process.env.METRICS_EMF = originalEmf;
+    }
+  });
+
+  it(`formats the totals for Prometheus`, function() {
+    const text = metrics.formatPrometheus();
+    expect(text).to.include('# TYPE scrape_duration_seconds summary\n');
+    expect(text).to.include('scrape_duration_seconds_sum{team="BlineBanditsBot"} 4\n');
+    expect(text).to.include('scrape_duration_seconds_count{team="BlineBanditsBot"} 2\n');
+    expect(text).to.include('schedule_entries{team="BlineBanditsBot"} 4\n');
+    expect(text).to.include('posts_total{team="BlineBanditsBot",channel="twitter",result="success"} 1\n');
+    expect(text).to.not.include('storage_errors_total');
+  });
+
+  it(`builds the EMF document of the values since the last flush`, function() {
+    const document = metrics.buildEmf({team: 'BlineBanditsBot'}, 'BanditsNotification', new Date('2023-10-06T12:00:00Z'));
+    expect(document).to.include({team: 'BlineBanditsBot', scrape_duration_seconds: 4, schedule_entries: 4, posts_total_twitter_success: 1});
+    expect(document._aws.CloudWatchMetrics[0].Dimensions).to.eql([['team']]);
+    expect(document._aws.CloudWatchMetrics[0].Metrics[0]).to.eql({Name: 'scrape_duration_seconds', Unit: 'Seconds'});
+    expect(metrics.buildEmf({team: 'BlineBanditsBot'})).to.equal(null);
+    expect(metrics.formatPrometheus()).to.include('schedule_entries');
+  });
+
+  it(`only writes the EMF log line when enabled`, function() {
+    const lines = [];
+    delete process.env.METRICS_EMF;
+    metrics.flushEmf({team: 'BlineBanditsBot'}, (line) => lines.push(line));
+    expect(lines.length).to.equal(0);
+    process.env.METRICS_EMF = 'true';
+    metrics.increment('runs_total', {team: 'BlineBanditsBot', outcome: 'unchanged'});
+    metrics.flushEmf({team: 'BlineBanditsBot'}, (line) => lines.push(line));
+    expect(JSON.parse(lines[0]).runs_total_unchanged).to.equal(1);
+  });
+});
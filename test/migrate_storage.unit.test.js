@@ -0,0 +1,87 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {getEntryDate} = require('../lib/helper_functions');
+const {PROGRESS_FILENAME, listMigrationKeys, migrateStorage, verifyMigration} = require('../lib/migrate_storage');
+
+describe('Storage Migration Unit Tests', function() {
+  const teams = [{id: 'team'}];
+  const legacySchedule = JSON.stringify({'saturday, 10/7': {dayOfWeek: 'Saturday', dayOfMonth: '10/7', location: 'Warren ', timeBlock: '3:00-5:30'}});
+
+  /**
+   * Builds a source store with the state and archive of a team.
+   *
+   * @return {MemoryStore} the store
+   */
+  function createSource() {
+    return new MemoryStore({
+      'team/previousSchedule.json': legacySchedule,
+      'team/previousScreenshot.png': 'png',
+      'team/archive/schedule-2023-10-6-1600.json': legacySchedule,
+      'team/archive/schedule-2023-10-6-1600.json.sig': 'signature',
+      'team/links/abc.json': '{"url":"https://example.com"}',
+      'twitter/tokens.json': '{}',
+    });
+  }
+
+  it(`lists the keys of the configured teams and the shared state`, async function() {
+    expect(await listMigrationKeys(createSource(), teams)).to.eql([
+      'team/archive/schedule-2023-10-6-1600.json',
+      'team/archive/schedule-2023-10-6-1600.json.sig',
+      'team/links/abc.json',
+      'team/previousSchedule.json',
+      'team/previousScreenshot.png',
+      'twitter/tokens.json',
+    ]);
+  });
+
+  it(`copies and verifies every key`, async function() {
+    const source = createSource();
+    const target = new MemoryStore();
+    const progress = [];
+    const result = await migrateStorage(source, target, {teams, onProgress: (done, total) => progress.push(`${done}/${total}`)});
+    expect(result).to.eql({total: 6, migrated: 6, transformed: 0, resumed: 0, failed: []});
+    expect(progress[5]).to.equal('6/6');
+    expect((await target.download('team/previousSchedule.json')).toString()).to.equal(legacySchedule);
+    expect(await target.exists(PROGRESS_FILENAME)).to.equal(false);
+    expect(await verifyMigration(source, target, {teams})).to.eql([]);
+
+    await target.delete('team/links/abc.json');
+    await target.upload('twitter/tokens.json', '{"changed":true}');
+    expect(await verifyMigration(source, target, {teams})).to.eql([{key: 'team/links/abc.json', problem: 'missing'}, {key: 'twitter/tokens.json', problem: 'different'}]);
+  });
+
+  it(`changes nothing in a dry run`, async function() {
+    const target = new MemoryStore();
+    const result = await migrateStorage(createSource(), target, {teams, canonicalize: true, dryRun: true});
+    expect(result).to.eql({total: 6, migrated: 6, transformed: 1, resumed: 0, failed: []});
+    expect(target.files.size).to.equal(0);
+  });
+
+  it(`resumes an interrupted migration`, async function() {
+    const target = new MemoryStore({[PROGRESS_FILENAME]: JSON.stringify({lastKey: 'team/links/abc.json', migrated: 3})});
+    const result = await migrateStorage(createSource(), target, {teams});
+    expect(result).to.eql({total: 6, migrated: 3, transformed: 0, resumed: 3, failed: []});
+    expect([...target.files.keys()].sort()).to.eql(['team/previousSchedule.json', 'team/previousScreenshot.png', 'twitter/tokens.json']);
+  });
+
+  it(`records the progress and reports the keys that fail to copy`, async function() {
+    const target = new MemoryStore();
+    const upload = target.upload.bind(target);
+    target.upload = async (key, contents) => key === 'twitter/tokens.json' ? false : upload(key, contents);
+    const result = await migrateStorage(createSource(), target, {teams});
+    expect(result.failed).to.eql(['twitter/tokens.json']);
+    expect(result.migrated).to.equal(5);
+  });
+
+  it(`canonicalizes the unsigned schedules`, async function() {
+    const source = createSource();
+    const result = await migrateStorage(source, source, {teams, canonicalize: true});
+    expect(result.transformed).to.equal(1);
+    const upgraded = JSON.parse((await source.download('team/previousSchedule.json')).toString());
+    const key = `SATURDAY, 10/07/${getEntryDate('10/7').getFullYear()}`; // the year is inferred from today
+    expect(Object.keys(upgraded)).to.eql([key]);
+    expect(upgraded[key].dayOfMonth).to.equal('10/7');
+    expect((await source.download('team/archive/schedule-2023-10-6-1600.json')).toString()).to.equal(legacySchedule);
+  });
+});
@@ -0,0 +1,146 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const crypto = require('crypto');
+const {SESSION_COOKIE, LOGIN_COOKIE, signValue, verifyValue, parseCookies, mapRole, isRoleAuthorized, getSession, startLogin, completeLogin} = require('../lib/oidc');
+
+const ISSUER = 'https://idp.example.com';
+
+/**
+ * Stands in for the issuer: serves its discovery document and keys, and
+ * exchanges the code for an ID token signed with its key.
+ */
+class FakeIssuer {
+  constructor(claims) {
+    const {privateKey, publicKey} = crypto.generateKeyPairSync('rsa', {modulusLength: 2048});
+    this.privateKey = privateKey;
+    this.kid = crypto.randomBytes(4).toString('hex'); // a new key, as if the issuer rotated its keys
+    this.jwk = {...publicKey.export({format: 'jwk'}), kid: this.kid, alg: 'RS256'};
+    this.claims = claims;
+    this.exchanges = [];
+  }
+
+  signIdToken(claims) {
+    const encode = (value) => Buffer.from(JSON.stringify(value)).toString('base64url');
+    const data = `${encode({alg: 'RS256', kid: this.kid})}.${encode(claims)}`;
+    return `${data}.${crypto.sign('sha256', Buffer.from(data), this.privateKey).toString('base64url')}`;
+  }
+
+  async get(url) {
+    if (url === `${ISSUER}/.well-known/openid-configuration`) {
+      return {data: {issuer: ISSUER, authorization_endpoint: `${ISSUER}/authorize`, token_endpoint: `${ISSUER}/token`, jwks_uri: `${ISSUER}/keys`}};
+    }
+    return {data: {keys: [this.jwk]}};
+  }
+
+  async post(url, body) {
+    const params = new URLSearchParams(body);
+    this.exchanges.push(Object.fromEntries(params));
+    return {data: {id_token: this.signIdToken({...this.claims, nonce: this.nonce})}};
+  }
+}
+
+describe('OIDC Unit Tests', function() {
+  const now = new Date('2023-10-06T14:00:00Z');
+  const originals = {};
+  const names = ['OIDC_ISSUER', 'OIDC_CLIENT_ID', 'OIDC_REDIRECT_URI', 'OIDC_ROLES', 'OIDC_SESSION_SECRET'];
+
+  beforeEach(function() {
+    names.forEach((name) => originals[name] = process.env[name]);
+    process.env.OIDC_ISSUER = ISSUER;
+    process.env.OIDC_CLIENT_ID = 'bandits';
+    process.env.OIDC_REDIRECT_URI = 'https://bandits.example.com/auth/callback';
+    process.env.OIDC_ROLES = JSON.stringify({admin: ['ops@league.org'], viewer: ['@league.org', 'group:managers']});
+    process.env.OIDC_SESSION_SECRET = 'secret';
+  });
+
+  afterEach(function() {
+    for (const name of names) {
+      if (originals[name] === undefined) {
+        delete process.env[name];
+      } else {
+        process.env[name] = originals[name];
+      }
+    }
+  });
+
+  it(`rejects signed values that were tampered with or expired`, function() {
+    const signed = signValue({role: 'viewer', expiresAt: '2023-10-06T15:00:00Z'}, 'secret');
+    expect(verifyValue(signed, 'secret', now)).to.eql({role: 'viewer', expiresAt: '2023-10-06T15:00:00Z'});
+    expect(verifyValue(signed, 'other', now)).to.equal(null);
+    expect(verifyValue(`${signValue({role: 'admin'}, 'secret').split('.')[0]}.${signed.split('.')[1]}`, 'secret', now)).to.equal(null);
+    expect(verifyValue(signed, 'secret', new Date('2023-10-06T16:00:00Z'))).to.equal(null);
+    expect(parseCookies('a=1; b=x%3Dy')).to.eql({a: '1', b: 'x=y'});
+  });
+
+  it(`maps the users to their roles`, function() {
+    const roles = {admin: ['ops@league.org'], viewer: ['@league.org', 'group:managers']};
+    expect(mapRole({email: 'OPS@league.org'}, roles)).to.equal('admin');
+    expect(mapRole({email: 'coach@league.org'}, roles)).to.equal('viewer');
+    expect(mapRole({email: 'coach@league.org', email_verified: false}, roles)).to.equal(null);
+    expect(mapRole({email: 'parent@gmail.com', groups: ['Managers']}, roles)).to.equal('viewer');
+    expect(mapRole({email: 'parent@gmail.com'}, roles)).to.equal(null);
+    expect(mapRole({email: 'parent@gmail.com'}, {viewer: ['*']})).to.equal('viewer');
+    expect(isRoleAuthorized({viewer: true}, 'viewer')).to.equal(true);
+    expect(isRoleAuthorized({admin: true}, 'viewer')).to.equal(false);
+    expect(isRoleAuthorized({admin: true}, 'admin')).to.equal(true);
+  });
+
+  it(`logs in at the issuer and starts the session with the role`, async function() {
+    const issuer = new FakeIssuer({iss: ISSUER, aud: 'bandits', sub: '1', email: 'coach@league.org', exp: now.getTime() / 1000 + 3600});
+    const login = await startLogin('/history/team', issuer, now);
+    expect(login.status).to.equal(302);
+    const location = new URL(login.headers.Location);
+    expect(location.origin + location.pathname).to.equal(`${ISSUER}/authorize`);
+    expect(location.searchParams.get('redirect_uri')).to.equal('https://bandits.example.com/auth/callback');
+    expect(login.headers['Set-Cookie']).to.contain('HttpOnly').and.contain('Secure');
+    issuer.nonce = location.searchParams.get('nonce');
+    const cookie = `${LOGIN_COOKIE}=${login.headers['Set-Cookie'].split(';')[0].split('=')[1]}`;
+
+    const mismatched = await completeLogin('code-1', 'other-state', {headers: {cookie}}, issuer, now);
+    expect(mismatched.status).to.equal(400);
+
+    const completed = await completeLogin('code-1', location.searchParams.get('state'), {headers: {cookie}}, issuer, now);
+    expect(completed.status).to.equal(302);
+    expect(completed.headers.Location).to.equal('/history/team');
+    expect(issuer.exchanges[0]).to.include({grant_type: 'authorization_code', code: 'code-1', client_id: 'bandits'});
+    const sessionCookie = completed.headers['Set-Cookie'].find((header) => header.startsWith(`${SESSION_COOKIE}=`)).split(';')[0];
+    expect(getSession({headers: {cookie: sessionCookie}}, now)).to.include({email: 'coach@league.org', role: 'viewer'});
+  });
+
+  it(`turns away users without a role, and ID tokens for another client or login`, async function() {
+    const issuer = new FakeIssuer({iss: ISSUER, aud: 'bandits', sub: '1', email: 'parent@gmail.com', exp: now.getTime() / 1000 + 3600});
+    const login = async () => {
+      const response = await startLogin('//evil.example.com', issuer, now);
+      const location = new URL(response.headers.Location);
+      issuer.nonce = location.searchParams.get('nonce');
+      return {state: location.searchParams.get('state'), req: {headers: {cookie: response.headers['Set-Cookie'].split(';')[0]}}};
+    };
+    let {state, req} = await login();
+    expect((await completeLogin('code-1', state, req, issuer, now)).status).to.equal(403);
+
+    issuer.claims = {...issuer.claims, email: 'coach@league.org', aud: 'another-app'};
+    ({state, req} = await login());
+    let error = null;
+    try {
+      await completeLogin('code-2', state, req, issuer, now);
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('The ID token is for another issuer or client');
+
+    issuer.claims = {...issuer.claims, aud: 'bandits'};
+    ({state, req} = await login());
+    issuer.nonce = 'replayed';
+    error = null;
+    try {
+      await completeLogin('code-3', state, req, issuer, now);
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('The ID token is for another login');
+
+    ({state, req} = await login());
+    const completed = await completeLogin('code-4', state, req, issuer, now);
+    expect(completed.headers.Location).to.equal('/'); // not another site
+  });
+});
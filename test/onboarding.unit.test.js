@@ -0,0 +1,60 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseCsv, buildTeamConfig, validateTeams, formatOnboardingReport} = require('../lib/onboarding');
+
+describe('Onboarding Unit Tests', function() {
+  const practice = {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Practice, Warren', timeBlock: '3:00–5:30'};
+
+  it(`parses the CSV by its header`, function() {
+    const rows = parseCsv('Name,URL,Handle\r\n"Bandits, 12U",https://example.com/12u,Bandits12U\n\n"The ""Real"" Bandits",https://example.com/10u,Bandits10U');
+    expect(rows).to.eql([
+      {name: 'Bandits, 12U', url: 'https://example.com/12u', handle: 'Bandits12U'},
+      {name: 'The "Real" Bandits', url: 'https://example.com/10u', handle: 'Bandits10U'},
+    ]);
+    expect(parseCsv('')).to.eql([]);
+  });
+
+  it(`builds the team's config from the row`, function() {
+    expect(buildTeamConfig({name: 'Bandits 12U', url: 'https://example.com/12u', handle: 'Bandits12U', schedule: '*/15 7-22 * * *', screenshot: 'rendered', watermark: 'TRUE', hashtags: '#bandits12u brookline', color: '#0b3d91', parser: 'text', scraper: 'http'})).to.eql({
+      team: {id: 'Bandits12U', url: 'https://example.com/12u', name: 'Bandits 12U', schedule: '*/15 7-22 * * *', screenshot: 'rendered', watermark: true, hashtags: ['#bandits12u', 'brookline'], color: '#0b3d91', scrape: {parser: 'text', scraper: 'http'}},
+      errors: [],
+    });
+    expect(buildTeamConfig({url: 'example.com', handle: 'Bandits 12U', schedule: 'often', color: 'blue', parser: 'xml', sms: '555-1234'}).errors).to.eql([
+      'handle Bandits 12U can only have letters, numbers, dashes, and underscores',
+      'url example.com isn\'t an http(s) URL',
+      'schedule often isn\'t a duration or cron expression',
+      'color blue isn\'t a hex color, e.g. #0b3d91',
+      'parser xml isn\'t one of wix, text, table, json',
+      'unknown columns: sms',
+    ]);
+  });
+
+  it(`validates the teams by scraping their pages`, async function() {
+    const rows = [
+      {name: 'Bandits 12U', url: 'https://example.com/12u', handle: 'Bandits12U'},
+      {name: 'Bandits 10U', url: 'https://example.com/10u', handle: 'Bandits10U'},
+      {name: 'Bandits 8U', url: 'https://example.com/8u', handle: 'Bandits8U'},
+      {name: 'Existing', url: 'https://example.com/existing', handle: 'BlineBanditsBot'},
+    ];
+    const scrape = async (team) => {
+      if (team.id === 'Bandits10U') {
+        throw new Error('net::ERR_NAME_NOT_RESOLVED');
+      }
+      return team.id === 'Bandits12U' ? new Map([['SATURDAY, 10/7', practice]]) : new Map();
+    };
+    const existingTeams = [{id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u'}];
+    const results = await validateTeams(rows, scrape, existingTeams);
+    expect(results.map((result) => result.errors)).to.eql([
+      [],
+      ['unable to scrape the page: net::ERR_NAME_NOT_RESOLVED'],
+      ['no schedule entries were found on the page, check the parser and scrape settings'],
+      ['handle BlineBanditsBot is already used by another team'],
+    ]);
+
+    const report = formatOnboardingReport(results, existingTeams);
+    expect(report).to.contain('✓ Bandits 12U (https://example.com/12u): 1 entries\n    SATURDAY, 10/7: Practice, Warren 3:00–5:30');
+    expect(report).to.contain('✗ Bandits 10U (https://example.com/10u)\n    unable to scrape the page');
+    expect(report).to.contain('1 of 4 teams are ready.');
+    expect(report.split('\n').pop()).to.equal(`TEAMS=${JSON.stringify([...existingTeams, results[0].team])}`);
+  });
+});
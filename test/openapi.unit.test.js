@@ -0,0 +1,65 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {compileRoutePath, matchRoute, buildOpenApiSpec, generateClient} = require('../lib/openapi');
+
+describe('OpenAPI Unit Tests', function() {
+  const routes = [
+    {
+      method: 'GET',
+      path: '/r/{teamId}/{linkId}',
+      operationId: 'followLink',
+      summary: 'Follows a link',
+      parameters: [{name: 'teamId', in: 'path'}, {name: 'linkId', in: 'path', pattern: '[A-Za-z0-9_-]+'}],
+      responses: {302: {description: 'Redirects'}},
+    },
+    {
+      method: 'GET',
+      path: '/history/{teamId}/screenshot/{timestamp}.png',
+      operationId: 'getScreenshot',
+      summary: 'Serves a screenshot',
+      viewer: true,
+      parameters: [{name: 'teamId', in: 'path'}, {name: 'timestamp', in: 'path', pattern: '\\d+'}],
+      responses: {200: {description: 'The screenshot', contentType: 'image/png'}},
+    },
+    {
+      method: 'GET',
+      path: '/status',
+      operationId: 'getStatus',
+      summary: 'Reports the status',
+      admin: true,
+      enabled: () => false,
+      parameters: [{name: 'verbose', in: 'query'}],
+      responses: {200: {description: 'The status', contentType: 'application/json', schema: {type: 'object'}}},
+    },
+  ];
+
+  it(`compiles the route paths`, function() {
+    expect(compileRoutePath(routes[1]).source).to.equal('^\\/history\\/([^/]+)\\/screenshot\\/(\\d+)\\.png$');
+  });
+
+  it(`matches the requests to the routes`, function() {
+    expect(matchRoute(routes, 'GET', '/r/Bline%20Bandits/abc_1')).to.eql({route: routes[0], params: {teamId: 'Bline Bandits', linkId: 'abc_1'}});
+    expect(matchRoute(routes, 'GET', '/r/team/abc.1')).to.equal(null);
+    expect(matchRoute(routes, 'GET', '/history/team/screenshot/1696360000000.png').params).to.eql({teamId: 'team', timestamp: '1696360000000'});
+    expect(matchRoute(routes, 'POST', '/r/team/abc')).to.equal(null);
+    expect(matchRoute(routes, 'GET', '/status?verbose=1')).to.equal(null); // not enabled
+  });
+
+  it(`describes the routes in the OpenAPI document`, function() {
+    const spec = buildOpenApiSpec(routes, '1.2.3', 'https://bandits.example.com/');
+    expect(spec.info.version).to.equal('1.2.3');
+    expect(spec.servers).to.eql([{url: 'https://bandits.example.com'}]);
+    expect(spec.paths['/r/{teamId}/{linkId}'].get.parameters[1]).to.eql({name: 'linkId', in: 'path', required: true, description: undefined, schema: {type: 'string', pattern: '^[A-Za-z0-9_-]+$'}});
+    expect(spec.paths['/history/{teamId}/screenshot/{timestamp}.png'].get.responses['200'].content).to.eql({'image/png': {schema: {type: 'string', format: 'binary'}}});
+    expect(spec.paths['/status'].get.tags).to.eql(['admin']);
+    expect(spec.paths['/history/{teamId}/screenshot/{timestamp}.png'].get.tags).to.eql(['viewer']);
+    expect(Object.keys(spec.paths['/status'].get.responses)).to.eql(['200', '302', '403']);
+  });
+
+  it(`generates a client with a method per operation`, function() {
+    const client = generateClient(buildOpenApiSpec(routes));
+    expect(client).to.contain('followLink(teamId: string, linkId: string): Promise<Response> {');
+    expect(client).to.contain('return this.request(\'GET\', `/r/${encodeURIComponent(teamId)}/${encodeURIComponent(linkId)}`);');
+    expect(client).to.contain('getStatus(query: {verbose?: string} = {}): Promise<Response> {');
+  });
+});
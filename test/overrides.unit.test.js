@@ -0,0 +1,102 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {parseSchedule} = require('../lib/helper_functions');
+const {parseScheduleKey, loadOverrides, loadAllOverrides, setOverride, clearOverrides, applyOverrides, hasManualCorrections} = require('../lib/overrides');
+
+describe('Overrides Unit Tests', function() {
+  const input = 'Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:45–6:45\n\nSchedule by Season\n\n';
+
+  it(`parses and normalizes the schedule key`, function() {
+    expect(parseScheduleKey('saturday 9/6')).to.eql({key: 'SATURDAY, 9/6', dayOfWeek: 'SATURDAY', dayOfMonth: '9/6'});
+    expect(parseScheduleKey('saturday, 9/6 #2')).to.eql({key: 'SATURDAY, 9/6 #2', dayOfWeek: 'SATURDAY', dayOfMonth: '9/6'});
+    expect(parseScheduleKey('saturday, 9/6/2025 @1:00')).to.eql({key: 'SATURDAY, 9/6/2025 @ 1:00', dayOfWeek: 'SATURDAY', dayOfMonth: '9/6'});
+    expect(parseScheduleKey('Someday, 9/6')).to.equal(null);
+  });
+
+  it(`merges the overrides over the parsed schedule`, function() {
+    const schedule = parseSchedule(input, new Date('2023-10-01T12:00:00Z'));
+    const overrides = new Map([
+      ['THURSDAY, 10/5', {dayOfWeek: 'THURSDAY', dayOfMonth: '10/5', date: '2023-10-05', location: 'Practice, Eliot', timeBlock: '4:30–6:30'}],
+      ['SATURDAY, 10/7', {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', date: '2023-10-07', location: 'Game, Downes', timeBlock: '1:00'}],
+    ]);
+    const result = applyOverrides(schedule, overrides);
+    expect(result.size).to.equal(3);
+    expect(result.get('TUESDAY, 10/3/2023')['location']).to.equal('Practice, Warren');
+    expect(result.get('THURSDAY, 10/5/2023')['location']).to.equal('Practice, Eliot');
+    expect(result.get('SATURDAY, 10/7/2023')['location']).to.equal('Game, Downes');
+    expect(schedule.get('THURSDAY, 10/5/2023')['location']).to.equal('Practice, Warren'); // original is untouched
+  });
+
+  it(`persists the overrides in storage`, async function() {
+    const rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    try {
+      const store = new LocalStore(rootPath);
+      const now = new Date(2023, 9, 6);
+      const entry = await setOverride('team', 'saturday, 10/7', 'Game, Downes, 1:00–3:00', store, null, now);
+      expect(entry['location']).to.equal('Game, Downes');
+      expect(entry['timeBlock']).to.equal('1:00–3:00');
+      expect(entry['manuallyCorrected']).to.be.true;
+      expect(new Date(entry['expiresAt']).getTime()).to.equal(new Date(2023, 9, 8).getTime()); // the day after the entry
+      const overrides = await loadOverrides('team', store, now);
+      expect(overrides.get('SATURDAY, 10/7')['location']).to.equal('Game, Downes');
+    } finally {
+      fs.rmSync(rootPath, {recursive: true, force: true});
+    }
+  });
+
+  it(`excludes expired overrides and clears overrides`, async function() {
+    const rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    try {
+      const store = new LocalStore(rootPath);
+      const now = new Date(2023, 9, 6);
+      await setOverride('team', 'SATURDAY, 10/7', 'Game, Downes, 1:00', store, null, now);
+      await setOverride('team', 'SUNDAY, 10/8', 'Practice, Warren, 3:00–5:30', store, null, now);
+      expect((await loadOverrides('team', store, new Date(2023, 9, 8, 12))).size).to.equal(1); // 10/7 expired
+      expect((await loadAllOverrides('team', store)).size).to.equal(2);
+      expect(await clearOverrides('team', 'sunday, 10/8', store)).to.equal(1);
+      expect(await clearOverrides('team', null, store)).to.equal(1);
+      expect((await loadAllOverrides('team', store)).size).to.equal(0);
+    } finally {
+      fs.rmSync(rootPath, {recursive: true, force: true});
+    }
+  });
+
+  it(`doesn't write the overrides while a run holds the team's lock`, async function() {
+    const rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    try {
+      const store = new LocalStore(rootPath);
+      const now = new Date(2023, 9, 6);
+      await setOverride('team', 'SATURDAY, 10/7', 'Game, Downes, 1:00', store, null, now);
+      await store.upload('team/run.lock', JSON.stringify({owner: 'run', expiresAt: new Date(Date.now() + 60000).toISOString()}));
+      let error = null;
+      try {
+        await setOverride('team', 'SUNDAY, 10/8', 'Practice, Warren, 3:00–5:30', store, null, now);
+      } catch (e) {
+        error = e;
+      }
+      expect(error.message).to.contain('locked by another run');
+      error = null;
+      try {
+        await clearOverrides('team', null, store);
+      } catch (e) {
+        error = e;
+      }
+      expect(error.message).to.contain('locked by another run');
+      expect((await loadAllOverrides('team', store)).size).to.equal(1);
+      expect(await store.exists('team/run.lock')).to.equal(true);
+    } finally {
+      fs.rmSync(rootPath, {recursive: true, force: true});
+    }
+  });
+
+  it(`detects manual corrections in the changes`, function() {
+    const scheduleDiff = {added: new Map(), deleted: new Map(), modified: new Map([['SATURDAY, 10/7', {location: 'Game, Downes', manuallyCorrected: true}]])};
+    expect(hasManualCorrections(scheduleDiff)).to.be.true;
+    scheduleDiff.modified.clear();
+    expect(hasManualCorrections(scheduleDiff)).to.be.false;
+  });
+});
@@ -0,0 +1,59 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {parseSchedule} = require('../lib/helper_functions');
+const {getLowConfidenceReasons, findUnmatchedLines, buildParseQualityReport, formatParseQualitySummary, hasParseQualityIssues, recordParseQualityReport} = require('../lib/parse_quality');
+
+describe('Parse Quality Unit Tests', function() {
+  const now = new Date(2023, 9, 1);
+  const text = 'Winter Practices SATURDAY, 10/7 Practice, Warren 3:00-5:30 Sat 10/14 Practice, Warren 3:00-5:30 SUNDAY, 10/15 No practice\nSaturday, 10/21 Game';
+
+  it(`flags the low-confidence entries`, function() {
+    expect(getLowConfidenceReasons({dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Practice, Warren', timeBlock: '3:00-5:30', parsed: {}}, now)).to.eql([]);
+    expect(getLowConfidenceReasons({dayOfWeek: 'FRIDAY', dayOfMonth: '10/7', location: 'Practice, Warren Sat 10/14 Practice', timeBlock: '3:00-5:30', parsed: null}, now)).to.eql([
+      '10/7 isn\'t a friday',
+      'time 3:00-5:30 couldn\'t be parsed',
+      'location contains another date',
+    ]);
+  });
+
+  it(`finds the text that looks like an entry but wasn't recognized`, function() {
+    expect(findUnmatchedLines(text)).to.eql(['Sat 10/14 Practice, Warren 3:00-5:30', 'Saturday, 10/21 Game']);
+  });
+
+  it(`builds the report of the parse`, function() {
+    const report = buildParseQualityReport(parseSchedule(text, now), text, now);
+    expect(report.entries).to.equal(2);
+    expect(report.missingFields).to.eql({location: 0, timeBlock: 1});
+    expect(report.lowConfidence.map((entry) => entry.key)).to.eql(['SUNDAY, 10/15/2023']);
+    expect(formatParseQualitySummary(report)).to.equal('2 entries, 0 missing location, 1 missing time, 1 low-confidence, 2 unmatched lines');
+    expect(hasParseQualityIssues(report)).to.equal(true);
+    expect(hasParseQualityIssues(buildParseQualityReport(new Map(), null, now))).to.equal(true);
+  });
+
+  it(`flags the fallback extractions`, function() {
+    const schedule = parseSchedule('TUESDAY, 10/3\n\nPractice, Warren, 4:45-6:45\n\n', now);
+    expect(hasParseQualityIssues(buildParseQualityReport(schedule, null, now, 'anchor'))).to.equal(false);
+    const report = buildParseQualityReport(schedule, null, now, 'page');
+    expect(report.extraction).to.equal('page');
+    expect(formatParseQualitySummary(report)).to.equal('1 entries, 0 missing location, 0 missing time, 0 low-confidence, page fallback extraction');
+    expect(hasParseQualityIssues(report)).to.equal(true);
+  });
+
+  it(`appends the reports for the day`, async function() {
+    const rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    try {
+      const store = new LocalStore(rootPath);
+      const report = buildParseQualityReport(new Map(), null, new Date('2023-10-01T12:00:00Z'));
+      await recordParseQualityReport('team', report, store);
+      const reports = await recordParseQualityReport('team', report, store);
+      expect(reports).to.have.lengthOf(2);
+      expect(JSON.parse(await store.download('team/parse-quality/2023-10-01.json'))).to.eql(reports);
+    } finally {
+      fs.rmSync(rootPath, {recursive: true, force: true});
+    }
+  });
+});
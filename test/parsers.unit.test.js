@@ -0,0 +1,63 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {getScrapeSettings} = require('../lib/scrape');
+const {extractScheduleText, extractScheduleSection, isFallbackExtraction, parseDateKey, registerParser, parseSchedulePage} = require('../lib/parsers');
+
+describe('Parsers Unit Tests', function() {
+  const now = new Date('2023-10-01T12:00:00Z');
+
+  it(`extracts the text of the schedule section`, function() {
+    const html = '<div><h5>Announcements</h5><p>Picture day</p></div><div><h5>Upcoming Schedule</h5><p>TUESDAY, 10/3</p><p>Practice, Warren, 4:45–6:45</p></div>';
+    const text = extractScheduleText(html, getScrapeSettings({scrape: {anchorText: 'Upcoming Schedule'}}));
+    expect(text).to.equal('Upcoming ScheduleTUESDAY, 10/3Practice, Warren, 4:45–6:45');
+  });
+
+  it(`retries with relaxed matching and the alternate anchors before falling back to the page`, function() {
+    const html = '<div><h5>Announcements</h5><p>Picture day</p></div><div><h4>Upcoming  schedule</h4><p>TUESDAY, 10/3</p></div>';
+    expect(extractScheduleSection(html, getScrapeSettings({scrape: {anchorText: 'Upcoming Schedule'}}))).to.eql({text: 'Upcoming  scheduleTUESDAY, 10/3', strategy: 'relaxed'});
+    expect(extractScheduleSection(html, getScrapeSettings({scrape: {anchorText: 'Winter Practices'}})).strategy).to.equal('alternate');
+    const page = extractScheduleSection(html, getScrapeSettings({scrape: {anchorText: 'Winter Practices', alternateAnchors: []}}));
+    expect(page).to.eql({text: 'AnnouncementsPicture dayUpcoming  scheduleTUESDAY, 10/3', strategy: 'page'});
+    expect(isFallbackExtraction(page.strategy)).to.equal(true);
+    expect(isFallbackExtraction('anchor')).to.equal(false);
+    expect(isFallbackExtraction(null)).to.equal(false);
+  });
+
+  it(`parses the dates of the different pages`, function() {
+    expect(parseDateKey('10/7', now)).to.eql({dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', date: '2023-10-07'});
+    expect(parseDateKey('Sat 10/7/2023', now)).to.eql({dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', date: '2023-10-07'});
+    expect(parseDateKey('2023-10-07T13:00:00', now)).to.eql({dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', date: '2023-10-07'});
+    expect(parseDateKey('TBD', now)).to.equal(null);
+  });
+
+  it(`parses the text of the entire page`, function() {
+    const content = {text: 'Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nSchedule by Season\n\n'};
+    const schedule = parseSchedulePage(content, getScrapeSettings({scrape: {parser: 'text'}}), now);
+    expect([...schedule.keys()]).to.eql(['TUESDAY, 10/3/2023']);
+    expect(schedule.get('TUESDAY, 10/3/2023')).to.include({location: 'Practice, Warren', timeBlock: '4:45–6:45'});
+  });
+
+  it(`parses a JSON API`, function() {
+    const content = {text: JSON.stringify({data: {events: [
+      {date: '2023-10-07', title: 'Game', location: 'Downes', time: '1:00'},
+      {date: 'TBD', title: 'Game', location: 'Eliot', time: '3:00'},
+    ]}})};
+    const settings = getScrapeSettings({scrape: {parser: 'json', itemsPath: 'data.events', detailsFields: ['title', 'location', 'time']}});
+    const schedule = parseSchedulePage(content, settings, now);
+    expect([...schedule.keys()]).to.eql(['SATURDAY, 10/7/2023']);
+    expect(schedule.get('SATURDAY, 10/7/2023')).to.include({location: 'Game, Downes', timeBlock: '1:00'});
+  });
+
+  it(`parses an HTML table`, function() {
+    const content = {html: '<table><tr><th>Date</th><th>Event</th></tr><tr><td>10/3</td><td>Practice</td><td>Warren</td><td>4:45–6:45</td></tr></table>'};
+    const schedule = parseSchedulePage(content, getScrapeSettings({scrape: {parser: 'table'}}), now);
+    expect([...schedule.keys()]).to.eql(['TUESDAY, 10/3/2023']);
+    expect(schedule.get('TUESDAY, 10/3/2023')).to.include({location: 'Practice, Warren', timeBlock: '4:45–6:45'});
+  });
+
+  it(`uses the registered parsers`, function() {
+    registerParser('empty', () => new Map());
+    expect(parseSchedulePage({}, getScrapeSettings({scrape: {parser: 'empty'}}), now).size).to.equal(0);
+    expect(() => parseSchedulePage({}, getScrapeSettings({scrape: {parser: 'unknown'}}), now)).to.throw('Unknown parser');
+  });
+});
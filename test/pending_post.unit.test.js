@@ -0,0 +1,40 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {parseSchedule} = require('../lib/helper_functions');
+const {PENDING_POST_FILENAME, beginPendingPost, completePendingStep, getMinutesUntilSettled, commitPendingPost} = require('../lib/pending_post');
+
+describe('Pending Post Unit Tests', function() {
+  const schedule = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\n');
+  const now = new Date('2023-10-06T12:00:00Z');
+
+  it(`resumes the post of the same changes, and starts over when they change`, async function() {
+    const store = new MemoryStore();
+    const pending = await beginPendingPost('team', schedule, store, now);
+    expect(pending).to.include({startedAt: now.toISOString(), attempts: 1, archived: null});
+    await completePendingStep('team', pending, 'social', '1001', store);
+
+    const resumed = await beginPendingPost('team', schedule, store, new Date('2023-10-06T12:15:00Z'));
+    expect(resumed).to.include({startedAt: now.toISOString(), attempts: 2});
+    expect(resumed.completed).to.eql({social: '1001'});
+
+    const changed = await beginPendingPost('team', parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 4:00-6:00\n\n'), store, new Date('2023-10-06T12:30:00Z'));
+    expect(changed).to.include({attempts: 1});
+    expect(changed.completed).to.eql({});
+  });
+
+  it(`replaces the previous schedule and clears the token on commit`, async function() {
+    const store = new MemoryStore({'team/previousSchedule.json': '{}'});
+    await beginPendingPost('team', schedule, store, now);
+    await commitPendingPost('team', schedule, store);
+    expect(await store.exists(`team/${PENDING_POST_FILENAME}`)).to.equal(false);
+    expect(Object.keys(JSON.parse(await store.download('team/previousSchedule.json')))).to.eql([...schedule.keys()]);
+  });
+
+  it(`waits for the changes to stay the same for the debounce`, function() {
+    const pending = {startedAt: now.toISOString()};
+    expect(getMinutesUntilSettled(pending, 0, now)).to.equal(0);
+    expect(getMinutesUntilSettled(pending, 20, new Date('2023-10-06T12:05:30Z'))).to.equal(15);
+    expect(getMinutesUntilSettled(pending, 20, new Date('2023-10-06T12:20:00Z'))).to.equal(0);
+  });
+});
@@ -0,0 +1,100 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseSchedule} = require('../lib/helper_functions');
+const {processTeam} = require('../index');
+const {runPipelineStage, buildStateMachineDefinition} = require('../lib/pipeline');
+const {MemoryStore, FakeScraper, FakeTwitterClient, FakeBrowser} = require('./fakes');
+
+describe('Pipeline Unit Tests', function() {
+  const team = {id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u', name: 'Bandits 12U'};
+  const original = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\n');
+  const updated = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\n');
+  const names = ['TEAMS', 'SEVERITY_ROUTES'];
+  const originals = {};
+  let store;
+  let client;
+
+  before(function() {
+    names.forEach((name) => originals[name] = process.env[name]);
+    process.env.TEAMS = JSON.stringify([team]);
+    // Post every change, without texting or emailing anyone
+    process.env.SEVERITY_ROUTES = JSON.stringify({minor: ['social'], moderate: ['social'], critical: ['social']});
+  });
+
+  after(function() {
+    for (const name of names) {
+      if (originals[name] === undefined) {
+        delete process.env[name];
+      } else {
+        process.env[name] = originals[name];
+      }
+    }
+  });
+
+  beforeEach(function() {
+    store = new MemoryStore();
+    client = new FakeTwitterClient();
+  });
+
+  /**
+   * Runs the team through the stages, like the state machine does.
+   *
+   * @param {FakeScraper} scraper the scraper
+   * @return {Array} the output of each stage
+   */
+  async function runStages(scraper) {
+    const run = (browser, store, team, signal, createScraper) => processTeam(browser, store, team, signal, createScraper, client);
+    const outputs = [await runPipelineStage('scrape', {team: team.id}, run, store, undefined, new FakeBrowser(), () => scraper)];
+    outputs.push(await runPipelineStage('diff', outputs[0], run, store, undefined, new FakeBrowser(), () => scraper));
+    if (!outputs[1].result) {
+      outputs.push(await runPipelineStage('notify', outputs[1], run, store, undefined, new FakeBrowser(), () => scraper));
+    }
+    return outputs;
+  }
+
+  it(`lists the teams`, async function() {
+    expect(await runPipelineStage('teams', {}, processTeam, store)).to.eql({teams: [team.id]});
+  });
+
+  it(`finishes an unchanged team in the diff stage`, async function() {
+    const scraper = new FakeScraper([original]);
+    const [scraped, diffed] = await runStages(scraper);
+    expect(scraped.stagedKey).to.match(new RegExp(`^${team.id}/pipeline/`));
+    expect(diffed.result).to.include({team: team.id, outcome: 'unchanged'});
+    expect(scraper.scrapes).to.equal(1);
+    expect(await store.exists(scraped.stagedKey)).to.equal(false);
+    expect(await store.exists(`${team.id}/previousSchedule.json`)).to.equal(true);
+  });
+
+  it(`notifies of the changes in the notify stage, loading the page again for the screenshot`, async function() {
+    await runStages(new FakeScraper([original]));
+    const scraper = new FakeScraper([updated]);
+    const [, diffed, notified] = await runStages(scraper);
+    expect(diffed).to.include({changes: 1});
+    expect(notified.result).to.include({outcome: 'changed', changes: 1, postedId: '1001'});
+    expect(scraper.scrapes).to.equal(2);
+    expect(scraper.screenshots).to.have.lengthOf(1);
+    expect(client.tweets[0].text).to.contain('moved to 3:30pm');
+  });
+
+  it(`rejects an unknown stage or team`, async function() {
+    for (const [stage, input, message] of [['publish', {team: team.id}, /Unknown stage/], ['scrape', {team: 'OtherTeamBot'}, /No configured team/]]) {
+      let error = null;
+      try {
+        await runPipelineStage(stage, input, processTeam, store, undefined, new FakeBrowser());
+      } catch (e) {
+        error = e;
+      }
+      expect(error.message).to.match(message);
+    }
+  });
+
+  it(`builds a state machine that retries each stage on its own`, function() {
+    const definition = buildStateMachineDefinition('arn:aws:lambda:us-east-1:123456789012:function:bandits');
+    const states = definition.States.CheckTeams.ItemProcessor.States;
+    expect(Object.keys(definition.States)).to.eql(['Teams', 'CheckTeams', 'Report']);
+    expect(states.Scrape.Parameters.Payload).to.eql({'stage': 'scrape', 'input.$': '$'});
+    expect(states.Scrape.Retry[0].IntervalSeconds).to.not.equal(states.Notify.Retry[0].IntervalSeconds);
+    expect(states.Notify.Catch[0].Next).to.equal('Failed');
+  });
+});
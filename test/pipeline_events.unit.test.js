@@ -0,0 +1,44 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {StageTracker, INSIGHTS_QUERIES, formatInsightsQueries} = require('../lib/pipeline_events');
+
+describe('Pipeline Events Unit Tests', function() {
+  let events;
+  let time;
+  const log = {log: (level, message, fields) => events.push({level, message, ...fields})};
+  const now = () => time;
+
+  beforeEach(function() {
+    events = [];
+    time = 1000;
+  });
+
+  it(`logs an event per stage transition`, function() {
+    const stages = new StageTracker(log, 'BlineBanditsBot', 'run-1', now);
+    stages.enter('scrape');
+    time += 2500;
+    stages.enter('parse');
+    time += 10;
+    stages.finish('unchanged');
+    expect(events).to.eql([
+      {level: 'info', message: 'Stage scrape ok', event: 'stage', url_id: 'BlineBanditsBot', run_id: 'run-1', stage: 'scrape', duration_ms: 2500, outcome: 'ok'},
+      {level: 'info', message: 'Stage parse ok', event: 'stage', url_id: 'BlineBanditsBot', run_id: 'run-1', stage: 'parse', duration_ms: 10, outcome: 'ok'},
+      {level: 'info', message: 'Stage run unchanged', event: 'stage', url_id: 'BlineBanditsBot', run_id: 'run-1', stage: 'run', duration_ms: 2510, outcome: 'unchanged'},
+    ]);
+  });
+
+  it(`attributes the failure to the current stage`, function() {
+    const stages = new StageTracker(log, 'BlineBanditsBot', 'run-1', now);
+    stages.enter('scrape');
+    time += 30000;
+    stages.finish('failed', 'Navigation timeout');
+    expect(events[0]).to.include({level: 'warn', stage: 'scrape', outcome: 'failed', error_message: 'Navigation timeout'});
+    expect(events[1]).to.include({stage: 'run', outcome: 'failed', duration_ms: 30000});
+  });
+
+  it(`formats the canned queries`, function() {
+    expect(formatInsightsQueries().split('\n\n')).to.have.lengthOf(Object.keys(INSIGHTS_QUERIES).length);
+    expect(formatInsightsQueries('run-trace', 'run-1')).to.contain('filter run_id = "run-1"');
+    expect(formatInsightsQueries('missing')).to.equal(null);
+  });
+});
@@ -0,0 +1,117 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MIGRATIONS, migrate, PostgresStore} = require('../lib/postgres');
+
+/**
+ * Minimal in-memory stand-in for the `pg` Pool, supporting the statements
+ * used by PostgresStore.
+ */
+class FakePool {
+  constructor() {
+    this.migrations = new Set();
+    this.objects = new Map();
+    this.changelog = [];
+    this.auditLog = [];
+    this.statements = [];
+  }
+
+  async connect() {
+    return {query: (text, values) => this.query(text, values), release: () => {}};
+  }
+
+  async query(text, values = []) {
+    this.statements.push(text);
+    if (text.startsWith('SELECT version FROM schema_migrations')) {
+      return {rows: [...this.migrations].map((version) => ({version}))};
+    }
+    if (text.startsWith('INSERT INTO schema_migrations')) {
+      this.migrations.add(values[0]);
+      return {rows: []};
+    }
+    if (text.startsWith('INSERT INTO objects')) {
+      const [key, contents, size] = values;
+      const existing = this.objects.get(key);
+      if (existing && text.includes('DO NOTHING')) {
+        return {rows: []};
+      }
+      const version = existing ? existing.version + 1 : 1;
+      this.objects.set(key, {contents, size, version, updated_at: new Date()});
+      return {rows: [{version}]};
+    }
+    if (text.startsWith('UPDATE objects')) {
+      const [key, contents, size, expectedVersion] = values;
+      const existing = this.objects.get(key);
+      if (!existing || existing.version !== expectedVersion) {
+        return {rows: []};
+      }
+      this.objects.set(key, {contents, size, version: expectedVersion + 1, updated_at: new Date()});
+      return {rows: [{version: expectedVersion + 1}]};
+    }
+    if (text.startsWith('SELECT contents, version FROM objects')) {
+      const object = this.objects.get(values[0]);
+      return {rows: object ? [object] : []};
+    }
+    if (text.startsWith('INSERT INTO changelog')) {
+      this.changelog.push({key: values[0], version: values[1], contents: values[2], changed_at: new Date()});
+      return {rows: []};
+    }
+    if (text.startsWith('SELECT version, changed_at FROM changelog')) {
+      return {rows: this.changelog.filter((entry) => entry.key === values[0]).reverse()};
+    }
+    if (text.startsWith('SELECT contents FROM changelog')) {
+      return {rows: this.changelog.filter((entry) => entry.key === values[0] && entry.version === values[1])};
+    }
+    if (text.startsWith('INSERT INTO audit_log')) {
+      this.auditLog.push({key: values[0], action: values[1], version: values[2], actor: values[3]});
+      return {rows: []};
+    }
+    if (text.startsWith('DELETE FROM objects')) {
+      const object = this.objects.get(values[0]);
+      this.objects.delete(values[0]);
+      return {rows: object ? [{version: object.version}] : []};
+    }
+    return {rows: []};
+  }
+}
+
+describe('PostgreSQL Unit Tests', function() {
+  let pool;
+
+  beforeEach(function() {
+    pool = new FakePool();
+  });
+
+  it(`applies each migration once`, async function() {
+    expect(await migrate(pool)).to.equal(MIGRATIONS.length);
+    expect(await migrate(pool)).to.equal(0);
+  });
+
+  it(`uploads and downloads, recording the changelog and audit log`, async function() {
+    const store = new PostgresStore(pool, 'test');
+    expect(await store.upload('team/previousSchedule.json', 'one')).to.equal(true);
+    expect(await store.upload('team/previousSchedule.json', 'two')).to.equal(true);
+    expect((await store.download('team/previousSchedule.json')).toString()).to.equal('two');
+    expect((await store.listVersions('team/previousSchedule.json')).map((version) => version.versionId)).to.eql(['2', '1']);
+    expect((await store.downloadVersion('team/previousSchedule.json', '1')).toString()).to.equal('one');
+    expect(pool.auditLog.map((entry) => `${entry.action} ${entry.version} ${entry.actor}`)).to.eql(['upload 1 test', 'upload 2 test']);
+  });
+
+  it(`skips the write when another run wrote in between`, async function() {
+    const first = new PostgresStore(pool);
+    const second = new PostgresStore(pool);
+    await first.upload('team/previousSchedule.json', 'one');
+    await first.download('team/previousSchedule.json');
+    await second.download('team/previousSchedule.json');
+    expect(await first.upload('team/previousSchedule.json', 'two')).to.equal(true);
+    expect(await second.upload('team/previousSchedule.json', 'three')).to.equal(false);
+    expect((await first.download('team/previousSchedule.json')).toString()).to.equal('two');
+  });
+
+  it(`records deletes in the audit log`, async function() {
+    const store = new PostgresStore(pool);
+    await store.upload('team/runState.json', '{}');
+    expect(await store.delete('team/runState.json')).to.equal(true);
+    expect(await store.delete('team/runState.json')).to.equal(false);
+    expect(pool.auditLog.map((entry) => entry.action)).to.eql(['upload', 'delete']);
+  });
+});
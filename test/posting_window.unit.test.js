@@ -0,0 +1,44 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parsePostingWindow, getPostingWindow, getMinutesUntilPostingWindow} = require('../lib/posting_window');
+
+describe('Posting Window Unit Tests', function() {
+  const original = process.env.POSTING_WINDOW;
+
+  afterEach(function() {
+    if (original === undefined) {
+      delete process.env.POSTING_WINDOW;
+    } else {
+      process.env.POSTING_WINDOW = original;
+    }
+  });
+
+  it(`parses the window`, function() {
+    expect(parsePostingWindow('07:00-22:00')).to.eql({start: 420, end: 1320});
+    expect(parsePostingWindow(' 18:30 - 2:00 ')).to.eql({start: 1110, end: 120});
+    expect(parsePostingWindow('7am-10pm')).to.equal(null);
+    expect(parsePostingWindow('07:00-22:75')).to.equal(null);
+  });
+
+  it(`prefers the team's window`, function() {
+    process.env.POSTING_WINDOW = '07:00-22:00';
+    expect(getPostingWindow({id: 'team'})).to.eql({start: 420, end: 1320});
+    expect(getPostingWindow({id: 'team', postingWindow: '08:00-20:00'})).to.eql({start: 480, end: 1200});
+    delete process.env.POSTING_WINDOW;
+    expect(getPostingWindow({id: 'team'})).to.equal(null);
+  });
+
+  it(`determines the minutes until the window opens`, function() {
+    const window = {start: 420, end: 1320};
+    // 11pm and 6:30am in New York
+    expect(getMinutesUntilPostingWindow(window, new Date('2023-10-07T03:00:00Z'), 'America/New_York')).to.equal(480);
+    expect(getMinutesUntilPostingWindow(window, new Date('2023-10-07T10:30:00Z'), 'America/New_York')).to.equal(30);
+    expect(getMinutesUntilPostingWindow(window, new Date('2023-10-07T16:00:00Z'), 'America/New_York')).to.equal(0);
+  });
+
+  it(`handles the windows that span midnight`, function() {
+    const window = {start: 1080, end: 120};
+    expect(getMinutesUntilPostingWindow(window, new Date('2023-10-07T03:00:00Z'), 'America/New_York')).to.equal(0);
+    expect(getMinutesUntilPostingWindow(window, new Date('2023-10-07T16:00:00Z'), 'America/New_York')).to.equal(360);
+  });
+});
@@ -0,0 +1,30 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseSchedule, compareSchedules} = require('../lib/helper_functions');
+const {buildSideBySideRows, buildPreviewHtml, toDataUrl} = require('../lib/preview');
+const {PNG} = require('./fakes');
+
+describe('Preview Unit Tests', function() {
+  const team = {id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u', name: 'Bandits 12U'};
+  const now = new Date('2023-10-01T12:00:00Z');
+  const previousSchedule = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\nSUNDAY, 10/8\n\nGame, Larz, 1:00-3:00\n\n', now);
+  const schedule = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\nMONDAY, 10/9\n\nPractice, Downes, 5:00-6:30\n\n', now);
+  const scheduleDiff = {...compareSchedules(previousSchedule, schedule), previousSchedule};
+
+  it(`lines up the schedules by date`, function() {
+    const rows = buildSideBySideRows(schedule, scheduleDiff);
+    expect(rows.map((row) => [row.key, row.change])).to.eql([['SATURDAY, 10/7/2023', 'modified'], ['SUNDAY, 10/8/2023', 'deleted'], ['MONDAY, 10/9/2023', 'added']]);
+    expect(rows[0].before.timeBlock).to.equal('3:00-5:30');
+    expect(rows[0].after.timeBlock).to.equal('3:30-5:30');
+    expect(rows[1].after).to.equal(null);
+  });
+
+  it(`builds a self-contained report`, function() {
+    const html = buildPreviewHtml(team, schedule, scheduleDiff, toDataUrl(PNG), new Date('2023-10-06T12:00:00Z'), 'America/New_York');
+    expect(html).to.contain('<title>Bandits 12U schedule changes</title>');
+    expect(html).to.contain(`<img src="data:image/png;base64,${PNG.toString('base64')}"`);
+    expect(html).to.contain('<tr class="modified"><td class="day">SATURDAY 10/7</td><td>Practice, Warren</td><td class="time">3:00-5:30</td><td>Practice, Warren</td><td class="time">3:30-5:30</td></tr>');
+    expect(html).to.contain('<tr class="deleted">');
+    expect(buildPreviewHtml(team, schedule, scheduleDiff, 'cid:screenshot.png')).to.contain('<img src="cid:screenshot.png"');
+  });
+});
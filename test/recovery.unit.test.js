@@ -0,0 +1,43 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {parseSchedule} = require('../lib/helper_functions');
+const {loadRunState, recordRun, recordPost, detectOutage, getCatchUpDiff} = require('../lib/recovery');
+
+describe('Recovery Unit Tests', function() {
+  const posted = 'Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:45–6:45\n\nSchedule by Season\n\n';
+  const current = 'Upcoming Schedule\n\nTHURSDAY, 10/5\n\nPractice, Eliot, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 1:00\n\nSchedule by Season\n\n';
+  const now = new Date('2023-10-01T12:00:00Z');
+  let store;
+
+  beforeEach(function() {
+    store = new LocalStore(fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-')));
+  });
+
+  it(`detects an outage when the last run is too long ago`, function() {
+    const now = new Date('2023-10-06T16:00:00Z');
+    expect(detectOutage({lastRunAt: null}, now, 900)).to.equal(false);
+    expect(detectOutage({lastRunAt: '2023-10-06T15:50:00Z'}, now, 900)).to.equal(false);
+    expect(detectOutage({lastRunAt: '2023-10-06T12:00:00Z'}, now, 900)).to.equal(true);
+  });
+
+  it(`records the runs and posts`, async function() {
+    await recordRun('team', store, new Date('2023-10-06T12:00:00Z'));
+    await recordPost(parseSchedule(posted, now), 'team', store, new Date('2023-10-06T11:00:00Z'));
+    expect(await loadRunState('team', store)).to.eql({lastRunAt: '2023-10-06T12:00:00.000Z', lastPostedAt: '2023-10-06T11:00:00.000Z'});
+  });
+
+  it(`compares against the schedule as of the last post`, async function() {
+    expect(await getCatchUpDiff(parseSchedule(current, now), await loadRunState('team', store), 'team', store)).to.equal(null);
+
+    await recordPost(parseSchedule(posted, now), 'team', store, new Date('2023-10-06T11:00:00Z'));
+    const scheduleDiff = await getCatchUpDiff(parseSchedule(current, now), await loadRunState('team', store), 'team', store);
+    expect(scheduleDiff.catchUpSince).to.equal('2023-10-06T11:00:00.000Z');
+    expect([...scheduleDiff.added.keys()]).to.eql(['SATURDAY, 10/07/2023']);
+    expect([...scheduleDiff.modified.keys()]).to.eql(['THURSDAY, 10/05/2023']);
+    expect([...scheduleDiff.deleted.keys()]).to.eql(['TUESDAY, 10/03/2023']);
+  });
+});
@@ -0,0 +1,49 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {findVersionAt, restorePreviousSchedule} = require('../lib/restore');
+
+describe('Restore Unit Tests', function() {
+  it(`finds the latest version at or before the point in time`, function() {
+    const versions = [
+      {versionId: 'c', lastModified: new Date('2023-10-06T12:00:00Z')},
+      {versionId: 'b', lastModified: new Date('2023-10-05T12:00:00Z')},
+      {versionId: 'a', lastModified: new Date('2023-10-04T12:00:00Z')},
+    ];
+    expect(findVersionAt(versions, new Date('2023-10-05T18:00:00Z')).versionId).to.equal('b');
+    expect(findVersionAt(versions, new Date('2023-10-06T12:00:00Z')).versionId).to.equal('c');
+    expect(findVersionAt(versions, new Date('2023-10-01T00:00:00Z'))).to.equal(null);
+  });
+
+  it(`restores from versions when the storage supports them`, async function() {
+    const uploads = new Map();
+    const store = {
+      listVersions: async () => [{versionId: 'v1', lastModified: new Date('2023-10-04T12:00:00Z')}, {versionId: 'v2', lastModified: new Date('2023-10-06T12:00:00Z')}],
+      downloadVersion: async (key, versionId) => Buffer.from(`contents of ${versionId}`),
+      upload: async (key, contents) => uploads.set(key, contents.toString()) && true,
+    };
+    const result = await restorePreviousSchedule('team', new Date('2023-10-05T00:00:00Z'), store);
+    expect(result.source).to.equal('version');
+    expect(result.id).to.equal('v1');
+    expect(uploads.get('team/previousSchedule.json')).to.equal('contents of v1');
+  });
+
+  it(`restores from the archived snapshots otherwise`, async function() {
+    const rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    try {
+      const store = new LocalStore(rootPath);
+      await store.upload(`team/archive/schedule-2023-10-4-${new Date('2023-10-04T12:00:00Z').getTime()}.json`, '{"a": 1}');
+      await store.upload(`team/archive/schedule-2023-10-6-${new Date('2023-10-06T12:00:00Z').getTime()}.json`, '{"b": 2}');
+      await store.upload('team/previousSchedule.json', '{"bad": true}');
+      const result = await restorePreviousSchedule('team', new Date('2023-10-05T00:00:00Z'), store);
+      expect(result.source).to.equal('archive');
+      expect((await store.download('team/previousSchedule.json')).toString()).to.equal('{"a": 1}');
+      expect(await restorePreviousSchedule('team', new Date('2023-10-01T00:00:00Z'), store)).to.equal(null);
+    } finally {
+      fs.rmSync(rootPath, {recursive: true, force: true});
+    }
+  });
+});
@@ -0,0 +1,66 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {groupArchiveVersions, selectVersionsToPrune, pruneArchive} = require('../lib/retention');
+
+describe('Retention Unit Tests', function() {
+  const now = new Date('2023-10-09T12:00:00Z');
+  const day = 24 * 60 * 60 * 1000;
+  const timestamps = [now - 40 * day, now - 20 * day, now - 10 * day, now - day];
+  let rootPath;
+  let store;
+
+  beforeEach(async function() {
+    rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    store = new LocalStore(rootPath);
+    for (const timestamp of timestamps) {
+      await store.upload(`team/archive/schedule-${timestamp}.json`, '{}');
+      await store.upload(`team/archive/schedule-preview-${timestamp}.png`, 'png');
+    }
+    await store.upload(`team/archive/schedule-screenshot-${timestamps[0]}.png`, 'png');
+    await store.upload(`team/archive/schedule-screenshot-${timestamps[1]}.png`, 'png');
+    // The later screenshots looked the same as the first one
+    for (const timestamp of timestamps.slice(2)) {
+      await store.upload(`team/archive/schedule-screenshot-${timestamp}.png.pointer`, JSON.stringify({target: `team/archive/schedule-screenshot-${timestamps[0]}.png`}));
+    }
+  });
+
+  afterEach(function() {
+    fs.rmSync(rootPath, {recursive: true, force: true});
+  });
+
+  it(`groups the archived files into versions`, async function() {
+    const versions = groupArchiveVersions(await store.list('team/archive/'));
+    expect(versions.map((version) => version.timestamp.getTime())).to.eql([...timestamps].reverse());
+    expect(versions[0].keys).to.have.lengthOf(3);
+  });
+
+  it(`selects the versions past the max age or count`, function() {
+    const versions = timestamps.map((timestamp) => ({timestamp: new Date(timestamp), keys: []})).reverse();
+    expect(selectVersionsToPrune(versions, now, 15, null).map((version) => version.timestamp.getTime())).to.eql([timestamps[1], timestamps[0]]);
+    expect(selectVersionsToPrune(versions, now, null, 3).map((version) => version.timestamp.getTime())).to.eql([timestamps[0]]);
+    expect(selectVersionsToPrune(versions, now, null, null)).to.eql([]);
+    expect(selectVersionsToPrune(versions.slice(3), now, 15, 1)).to.eql([]);
+  });
+
+  it(`prunes the archive, keeping the screenshots that are pointed to`, async function() {
+    const dryRun = await pruneArchive('team', store, now, 15, null, true);
+    expect(dryRun.versions).to.equal(4);
+    expect(await store.exists(`team/archive/schedule-${timestamps[0]}.json`)).to.equal(true);
+
+    const {pruned} = await pruneArchive('team', store, now, 15, null);
+    expect(pruned).to.eql(dryRun.pruned);
+    expect(pruned.sort()).to.eql([
+      `team/archive/schedule-${timestamps[0]}.json`,
+      `team/archive/schedule-${timestamps[1]}.json`,
+      `team/archive/schedule-preview-${timestamps[0]}.png`,
+      `team/archive/schedule-preview-${timestamps[1]}.png`,
+      `team/archive/schedule-screenshot-${timestamps[1]}.png`,
+    ]);
+    expect(await store.exists(`team/archive/schedule-screenshot-${timestamps[0]}.png`)).to.equal(true);
+    expect((await store.list('team/archive/')).length).to.equal(7);
+  });
+});
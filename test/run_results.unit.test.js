@@ -0,0 +1,36 @@
+const {expect} = require('chai');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {formatRunResultsTable, recordRunResults, hasFailedResults} = require('../lib/run_results');
+
+const results = [
+  {team: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u', outcome: 'changed', changes: 2, postedId: '1712345678901234567', error: null},
+  {team: 'OtherTeamBot', url: 'https://example.com/schedule', outcome: 'failed', changes: 0, postedId: null, error: 'Timed out'},
+];
+
+describe('Run Results Unit Tests', function() {
+  it('formats a row per team under the header', function() {
+    const lines = formatRunResultsTable(results).split('\n');
+    expect(lines).to.have.lengthOf(3);
+    expect(lines[0]).to.match(/^URL\s+Outcome\s+Changes\s+Posted ID\s+Error$/);
+    expect(lines[1]).to.match(/^https:\/\/www\.brooklinebaseball\.net\/bandits12u\s+changed\s+2\s+1712345678901234567\s+-$/);
+    expect(lines[2]).to.match(/^https:\/\/example\.com\/schedule\s+failed\s+0\s+-\s+Timed out$/);
+    expect(lines[1].indexOf('changed')).to.equal(lines[2].indexOf('failed'));
+  });
+
+  it('detects failed teams', function() {
+    expect(hasFailedResults(results)).to.equal(true);
+    expect(hasFailedResults(results.slice(0, 1))).to.equal(false);
+  });
+
+  it('appends the results to the day\'s artifact', async function() {
+    const store = new LocalStore(fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-')));
+    await recordRunResults(results.slice(0, 1), store, new Date('2026-10-16T12:00:00Z'));
+    const runs = await recordRunResults(results.slice(1), store, new Date('2026-10-16T12:05:00Z'));
+    expect(runs).to.have.lengthOf(2);
+    expect(runs[1].finishedAt).to.equal('2026-10-16T12:05:00.000Z');
+    expect(JSON.parse(await store.download('run-results/2026-10-16.json'))[0].results[0].postedId).to.equal('1712345678901234567');
+  });
+});
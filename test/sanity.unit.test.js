@@ -0,0 +1,25 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseSchedule, compareSchedules} = require('../lib/helper_functions');
+const {checkScheduleSanity} = require('../lib/sanity');
+
+describe('Sanity Check Unit Tests', function() {
+  const previousSchedule = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\nSUNDAY, 10/8\n\nGame, Downes, 1:00\n\nTUESDAY, 10/10\n\nPractice, Warren, 5:00-7:00\n\nSATURDAY, 10/14\n\nPractice, Warren, 3:00-5:30\n\n');
+  const diff = (schedule) => ({...compareSchedules(previousSchedule, schedule), previousSchedule});
+
+  it(`fails a schedule with no entries`, function() {
+    expect(checkScheduleSanity(new Map(), diff(new Map()), 1, null, true)).to.equal('The page parsed to no entries, while the previous schedule had 4');
+    expect(checkScheduleSanity(new Map(), diff(new Map()), 5, null, true)).to.equal(null);
+    expect(checkScheduleSanity(new Map(), diff(new Map()), 1, null, false)).to.equal(null);
+    expect(checkScheduleSanity(new Map(), {...compareSchedules(new Map(), new Map()), previousSchedule: new Map()}, 1, null, true)).to.equal(null);
+  });
+
+  it(`fails a schedule that lost too many entries at once`, function() {
+    const schedule = new Map([...previousSchedule].slice(3));
+    expect(checkScheduleSanity(schedule, diff(schedule), 1, 50, true)).to.equal('3 of the 4 entries (75%) vanished at once, more than the 50% allowed');
+    expect(checkScheduleSanity(schedule, diff(schedule), 1, 80, true)).to.equal(null);
+    expect(checkScheduleSanity(schedule, diff(schedule), 1, null, true)).to.equal(null);
+    const rolledOver = new Map([...previousSchedule].slice(1));
+    expect(checkScheduleSanity(rolledOver, diff(rolledOver), 1, 50, true)).to.equal(null);
+  });
+});
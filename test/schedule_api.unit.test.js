@@ -0,0 +1,50 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {buildScheduleSnapshot, publishScheduleSnapshot, LAST_CHANGE_FILENAME} = require('../lib/schedule_api');
+
+describe('Schedule API Unit Tests', function() {
+  const team = {id: 'BlineBanditsBot', name: 'Bandits 12U', url: 'https://www.brooklinebaseball.net/bandits12u'};
+  const schedule = new Map([
+    ['TUESDAY, 10/10', {dayOfWeek: 'TUESDAY', dayOfMonth: '10/10', location: 'Practice, Warren', timeBlock: '5:00-7:00'}],
+    ['SATURDAY, 10/07', {dayOfWeek: 'SATURDAY', dayOfMonth: '10/07', location: 'Practice, Warren', timeBlock: '3:30-5:30'}],
+  ]);
+  const now = new Date(2023, 9, 6, 12);
+  const changeEvent = {type: 'schedule.changed', team: team.id, url: team.url, detectedAt: now.toISOString(), severity: 'minor', summary: 'Saturday\'s practice moved to 3:30pm', changes: [{key: 'SATURDAY, 10/07', type: 'modified'}]};
+  const originalPrefix = process.env.SCHEDULE_API_PREFIX;
+
+  beforeEach(function() {
+    process.env.SCHEDULE_API_PREFIX = 'api';
+  });
+
+  afterEach(function() {
+    if (originalPrefix === undefined) {
+      delete process.env.SCHEDULE_API_PREFIX;
+    } else {
+      process.env.SCHEDULE_API_PREFIX = originalPrefix;
+    }
+  });
+
+  it(`builds the snapshot with the entries sorted by date`, function() {
+    const snapshot = buildScheduleSnapshot(team, schedule, null, now);
+    expect(snapshot).to.include({version: 1, team: team.id, name: 'Bandits 12U', url: team.url, scrapedAt: now.toISOString(), lastChange: null});
+    expect(snapshot.entries.map((entry) => [entry.key, entry.date])).to.eql([['SATURDAY, 10/07', '2023-10-07'], ['TUESDAY, 10/10', '2023-10-10']]);
+    expect(snapshot.entries[0].timeBlock).to.equal('3:30-5:30');
+  });
+
+  it(`publishes the last change until the next one`, async function() {
+    const store = new MemoryStore();
+    const uploads = [];
+    const upload = async (key, contents) => {
+      uploads.push({key, snapshot: JSON.parse(contents)});
+      return true;
+    };
+    expect(await publishScheduleSnapshot(team, schedule, changeEvent, store, upload, now)).to.equal(`api/${team.id}/latest.json`);
+    expect(await store.exists(`${team.id}/${LAST_CHANGE_FILENAME}`)).to.equal(true);
+    await publishScheduleSnapshot(team, schedule, null, store, upload, new Date(2023, 9, 6, 13));
+    expect(uploads[1].snapshot.lastChange).to.eql({detectedAt: now.toISOString(), severity: 'minor', summary: 'Saturday\'s practice moved to 3:30pm', changes: [{key: 'SATURDAY, 10/07', type: 'modified'}]});
+    expect(uploads[1].snapshot.scrapedAt).to.equal(new Date(2023, 9, 6, 13).toISOString());
+
+    expect(await publishScheduleSnapshot(team, schedule, null, store, async () => false, now)).to.equal(null);
+  });
+});
@@ -0,0 +1,63 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseDuration, parseCronExpression, getNextCronTime, getNextRunTime, TeamScheduler} = require('../lib/scheduler');
+
+describe('Scheduler Unit Tests', function() {
+  it(`parses durations`, function() {
+    expect(parseDuration('300')).to.equal(300);
+    expect(parseDuration('30m')).to.equal(1800);
+    expect(parseDuration('2h')).to.equal(7200);
+    expect(parseDuration('1d')).to.equal(86400);
+    expect(parseDuration('1.5m')).to.equal(90);
+    expect(parseDuration('soon')).to.be.NaN;
+    expect(parseDuration(undefined)).to.be.NaN;
+  });
+
+  it(`parses cron expressions`, function() {
+    const cron = parseCronExpression('*/15 7-9 * * 1-5');
+    expect([...cron.minutes]).to.eql([0, 15, 30, 45]);
+    expect([...cron.hours]).to.eql([7, 8, 9]);
+    expect([...cron.daysOfWeek]).to.eql([1, 2, 3, 4, 5]);
+    expect(() => parseCronExpression('* * *')).to.throw('expected 5 fields');
+    expect(() => parseCronExpression('60 * * * *')).to.throw('Invalid cron field');
+  });
+
+  it(`finds the next matching time in the time zone`, function() {
+    // 2023-10-06 is a Friday, 8:10am in New York
+    const after = new Date('2023-10-06T12:10:00Z');
+    expect(getNextCronTime('*/15 * * * *', after, 'America/New_York').toISOString()).to.equal('2023-10-06T12:15:00.000Z');
+    expect(getNextCronTime('0 7 * * *', after, 'America/New_York').toISOString()).to.equal('2023-10-07T11:00:00.000Z');
+    expect(getNextCronTime('0 9 * * 1-5', after, 'America/New_York').toISOString()).to.equal('2023-10-06T13:00:00.000Z');
+    expect(getNextCronTime('30 6 * * 0', after, 'America/New_York').toISOString()).to.equal('2023-10-08T10:30:00.000Z');
+    expect(getNextCronTime('0 0 1 1 *', after, 'UTC').toISOString()).to.equal('2024-01-01T00:00:00.000Z');
+    expect(getNextCronTime('0 0 31 2 *', after, 'UTC')).to.be.null;
+  });
+
+  it(`matches both day fields when one of them is a step over every day`, function() {
+    // Mondays that fall on an odd day of the month, not every odd day and every Monday
+    const after = new Date('2023-10-06T12:10:00Z');
+    expect(parseCronExpression('0 9 */2 * 1').restrictsDayOfMonth).to.equal(false);
+    expect(getNextCronTime('0 9 */2 * 1', after, 'America/New_York').toISOString()).to.equal('2023-10-09T13:00:00.000Z');
+    expect(getNextCronTime('0 9 */2 * 1', new Date('2023-10-09T14:00:00Z'), 'America/New_York').toISOString()).to.equal('2023-10-23T13:00:00.000Z');
+  });
+
+  it(`runs intervals from the last run`, function() {
+    const lastRun = new Date('2023-10-06T12:10:00Z');
+    expect(getNextRunTime('30m', null).getTime()).to.equal(0);
+    expect(getNextRunTime('30m', lastRun).toISOString()).to.equal('2023-10-06T12:40:00.000Z');
+    expect(getNextRunTime('300', lastRun).toISOString()).to.equal('2023-10-06T12:15:00.000Z');
+    expect(getNextRunTime('0 * * * *', lastRun).toISOString()).to.equal('2023-10-06T13:00:00.000Z');
+  });
+
+  it(`runs each team on its own schedule`, function() {
+    const teams = [{id: 'a'}, {id: 'b', schedule: '10m'}];
+    const scheduler = new TeamScheduler('1h');
+    const start = new Date('2023-10-06T12:00:00Z');
+    expect(scheduler.getDueTeams(teams, start)).to.eql(teams);
+    scheduler.markRun(teams, start);
+    expect(scheduler.getDueTeams(teams, start)).to.eql([]);
+    expect(scheduler.getDelayUntilNextRun(teams, start)).to.equal(600000);
+    expect(scheduler.getDueTeams(teams, new Date('2023-10-06T12:10:00Z'))).to.eql([teams[1]]);
+    expect(scheduler.getDueTeams(teams, new Date('2023-10-06T13:00:00Z'))).to.eql(teams);
+  });
+});
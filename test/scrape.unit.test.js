@@ -0,0 +1,166 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {DEFAULT_SCRAPE_SETTINGS, getScrapeSettings, createLazyBrowser, createSharedBrowser, BrowserScraper, HttpScraper, getPageContent, createPageScraper, getHighlights, highlightEntries, findChromeExecutable, getPaddedClip, getPageTimeoutMs} = require('../lib/scrape');
+
+describe('Scrape Unit Tests', function() {
+  it(`uses the default settings when the team doesn't have any`, function() {
+    expect(getScrapeSettings({id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u'})).to.eql(DEFAULT_SCRAPE_SETTINGS);
+  });
+
+  it(`layers the team's settings over the defaults`, function() {
+    const settings = getScrapeSettings({id: 'team', url: 'https://example.com', scrape: {anchorText: 'Upcoming Schedule', waitSelector: '#schedule', clip: {y: 400}}});
+    expect(settings.anchorSelector).to.equal('h5');
+    expect(settings.anchorText).to.equal('Upcoming Schedule');
+    expect(settings.waitSelector).to.equal('#schedule');
+    expect(settings.clip).to.eql({x: 150, y: 400, width: 340, height: 470});
+    expect(settings.viewport).to.eql(DEFAULT_SCRAPE_SETTINGS.viewport);
+    expect(settings.clipMode).to.equal('fixed');
+    expect(getScrapeSettings({id: 'team', url: 'https://example.com', scrape: {clip: {y: 400}, clipMode: 'element'}}).clipMode).to.equal('element');
+  });
+
+  it(`layers the deployment's settings between the defaults and the team's`, function() {
+    const names = ['SCRAPE_WAIT_UNTIL', 'SCRAPE_SETTLE_MS', 'SCRAPE_TIMEOUT_SECONDS', 'SCRAPE_VIEWPORT'];
+    const originals = {};
+    names.forEach((name) => {
+      originals[name] = process.env[name];
+    });
+    try {
+      Object.assign(process.env, {SCRAPE_WAIT_UNTIL: 'networkidle2', SCRAPE_SETTLE_MS: '500', SCRAPE_TIMEOUT_SECONDS: '45', SCRAPE_VIEWPORT: '1280x900'});
+      const settings = getScrapeSettings({id: 'team', url: 'https://example.com', scrape: {waitUntil: 'networkidle0', viewport: {deviceScaleFactor: 1}}});
+      expect(settings).to.include({waitUntil: 'networkidle0', settleMs: 500, timeoutSeconds: 45});
+      expect(settings.viewport).to.eql({width: 1280, height: 900, deviceScaleFactor: 1});
+      expect(getPageTimeoutMs(settings)).to.equal(45000);
+      process.env.SCRAPE_WAIT_UNTIL = 'whenever';
+      expect(getScrapeSettings({id: 'team', url: 'https://example.com'}).waitUntil).to.equal('load');
+    } finally {
+      for (const name of names) {
+        if (originals[name] === undefined) {
+          delete process.env[name];
+        } else {
+          process.env[name] = originals[name];
+        }
+      }
+    }
+  });
+
+  it(`pads the bounds of the schedule section into the clip`, function() {
+    expect(getPaddedClip({left: 150.5, top: 210.2, right: 480.4, bottom: 1310.8}, 16)).to.eql({x: 134, y: 194, width: 363, height: 1133});
+    expect(getPaddedClip({left: 4, top: 0, right: 300, bottom: 200}, 16)).to.eql({x: 0, y: 0, width: 316, height: 216});
+  });
+
+
+  it(`creates the scraper selected for the team`, function() {
+    expect(createPageScraper({scrape: {}}, null)).to.be.instanceOf(BrowserScraper);
+    expect(createPageScraper({scrape: {scraper: 'http'}}, null)).to.be.instanceOf(HttpScraper);
+    expect(() => createPageScraper({scrape: {scraper: 'curl'}}, null)).to.throw('Unknown scraper');
+  });
+
+  it(`only launches the browser when it's needed`, async function() {
+    let launches = 0;
+    let closes = 0;
+    const browser = createLazyBrowser(async () => {
+      launches++;
+      return {close: async () => closes++};
+    });
+    await browser.close();
+    expect(launches).to.equal(0);
+    await browser.get();
+    await browser.get();
+    expect(launches).to.equal(1);
+    await browser.close();
+    expect(closes).to.equal(1);
+  });
+
+  it(`shares the browser and its pages across runs, relaunching it after a crash`, async function() {
+    const launched = [];
+    const launch = async () => {
+      const chrome = {connected: true, pages: 0, closed: false};
+      Object.assign(chrome, {
+        isConnected: () => chrome.connected,
+        on: () => {},
+        newPage: async () => {
+          chrome.pages++;
+          return {goto: async () => {}, close: async () => {}, isClosed: () => false};
+        },
+        close: async () => {
+          chrome.closed = true;
+        },
+      });
+      launched.push(chrome);
+      return chrome;
+    };
+    const browser = createSharedBrowser(launch, 1);
+    const page = await (await browser.get()).newPage();
+    await page.close();
+    expect(page.isClosed()).to.equal(true);
+    await browser.close();
+    expect(await (await browser.get()).newPage()).to.equal(page);
+    expect(launched).to.have.lengthOf(1);
+    expect(launched[0].pages).to.equal(1);
+    launched[0].connected = false;
+    await (await browser.get()).newPage();
+    expect(launched).to.have.lengthOf(2);
+    await browser.shutdown();
+    expect(launched[1].closed).to.equal(true);
+  });
+
+  it(`uses the text of responses that aren't HTML as is`, function() {
+    expect(getPageContent('{"events": []}', 'application/json; charset=utf-8')).to.eql({html: '', text: '{"events": []}'});
+  });
+
+  it(`highlights the added and modified entries`, function() {
+    const scheduleDiff = {
+      added: new Map([['SATURDAY, 10/07/2023', {dayOfWeek: 'SATURDAY', dayOfMonth: '10/07'}]]),
+      deleted: new Map([['TUESDAY, 10/03/2023', {dayOfWeek: 'TUESDAY', dayOfMonth: '10/03'}]]),
+      modified: new Map([['THURSDAY, 10/05/2023', {dayOfWeek: 'THURSDAY', dayOfMonth: '10/5'}]]),
+    };
+    expect(getHighlights(scheduleDiff)).to.eql([
+      {key: 'SATURDAY, 10/07/2023', text: 'SATURDAY, 10/7', label: 'NEW'},
+      {key: 'THURSDAY, 10/05/2023', text: 'THURSDAY, 10/5', label: 'CHANGED'},
+    ]);
+  });
+
+  it(`finds the highlighted entries by their date as the page shows it`, async function() {
+    /**
+     * Builds a fake element of the page.
+     *
+     * @param {String} textContent the text of the element
+     * @param {Array} children the child elements
+     * @return {Object} the element
+     */
+    function createElement(textContent, children = []) {
+      return {textContent, children, style: {}, getBoundingClientRect: () => ({left: 0, top: 0, right: 100, bottom: 20, height: 20}), appendChild() {}};
+    }
+    const dates = ['SUNDAY, 10/1', 'SATURDAY,  10/7', 'SUNDAY, 10/15'].map((text) => createElement(text));
+    const overlays = [];
+    const body = {...createElement(dates.map((date) => date.textContent).join(' Practice, Warren, 3:00-5:30 '), dates), querySelectorAll: () => [body, ...dates], appendChild: (element) => overlays.push(element)};
+    global.document = {body, createElement: () => createElement('')};
+    global.window = {scrollX: 0, scrollY: 0};
+    try {
+      const page = {evaluate: async (fn, arg) => fn(arg)};
+      const scheduleDiff = {
+        added: new Map([['SATURDAY, 10/07/2023', {dayOfWeek: 'SATURDAY', dayOfMonth: '10/07'}]]),
+        deleted: new Map(),
+        modified: new Map([['SUNDAY, 10/15/2023', {dayOfWeek: 'SUNDAY', dayOfMonth: '10/15'}], ['SUNDAY, 10/22/2023', {dayOfWeek: 'SUNDAY', dayOfMonth: '10/22'}]]),
+      };
+      expect(await highlightEntries(page, getHighlights(scheduleDiff))).to.equal(2);
+      expect(overlays).to.have.lengthOf(2);
+    } finally {
+      delete global.document;
+      delete global.window;
+    }
+  });
+
+  it(`finds Chrome in a layer or mount`, function() {
+    const files = new Map([['/opt', true], ['/opt/chromium', true], ['/opt/chromium/chrome-linux64/chrome', false], ['/mnt/efs/chrome', false]]);
+    const fileSystem = {
+      existsSync: (file) => files.has(file),
+      statSync: (file) => ({isDirectory: () => files.get(file)}),
+    };
+    expect(findChromeExecutable(undefined, fileSystem)).to.equal(null);
+    expect(findChromeExecutable('/mnt/efs/chrome', fileSystem)).to.equal('/mnt/efs/chrome');
+    expect(findChromeExecutable('/opt/chromium', fileSystem)).to.equal('/opt/chromium/chrome-linux64/chrome');
+    expect(() => findChromeExecutable('/opt', fileSystem)).to.throw('Chrome wasn\'t found in /opt');
+    expect(() => findChromeExecutable('/missing', fileSystem)).to.throw('Chrome wasn\'t found at /missing');
+  });
+});
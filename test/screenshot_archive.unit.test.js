@@ -0,0 +1,59 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const {LocalStore} = require('../lib/storage');
+const {encodePng} = require('./fakes');
+const {decodePng, getPerceptualHash, getHammingDistance, archiveScreenshot, resolveScreenshotKey} = require('../lib/screenshot_archive');
+
+describe('Screenshot Archive Unit Tests', function() {
+  const gradient = (x) => x * 8;
+  const stripes = (x) => (Math.floor(x / 4) % 2) * 255;
+  let rootPath;
+  let store;
+
+  beforeEach(function() {
+    rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    store = new LocalStore(rootPath);
+  });
+
+  afterEach(function() {
+    fs.rmSync(rootPath, {recursive: true, force: true});
+  });
+
+  it(`decodes the pixels of the PNG`, function() {
+    expect(Array.from(decodePng(encodePng(3, 2, gradient)).pixels)).to.eql([0, 8, 16, 0, 8, 16]);
+    expect(Array.from(decodePng(encodePng(3, 2, gradient, 1)).pixels)).to.eql([0, 8, 16, 0, 8, 16]);
+    expect(() => decodePng(Buffer.from('not a png'))).to.throw('Not a PNG');
+  });
+
+  it(`hashes images that look the same alike`, function() {
+    const hash = getPerceptualHash(encodePng(27, 16, gradient));
+    expect(hash).to.equal('ffffffffffffffff');
+    expect(getPerceptualHash(encodePng(27, 16, gradient, 1))).to.equal(hash);
+    expect(getHammingDistance(hash, getPerceptualHash(encodePng(27, 16, stripes)))).to.be.greaterThan(8);
+    expect(getPerceptualHash(Buffer.from('not a png'))).to.equal(null);
+  });
+
+  it(`stores a pointer instead of a screenshot that looks the same`, async function() {
+    const first = await archiveScreenshot('team', 'team/archive/schedule-screenshot-1.png', encodePng(27, 16, gradient), store, 0);
+    expect(first).to.eql({key: 'team/archive/schedule-screenshot-1.png', deduplicated: false});
+    const second = await archiveScreenshot('team', 'team/archive/schedule-screenshot-2.png', encodePng(27, 16, gradient, 1), store, 0);
+    expect(second).to.eql({key: 'team/archive/schedule-screenshot-1.png', deduplicated: true});
+    expect(await store.exists('team/archive/schedule-screenshot-2.png')).to.equal(false);
+    expect(await resolveScreenshotKey('team/archive/schedule-screenshot-2.png', store)).to.equal('team/archive/schedule-screenshot-1.png');
+
+    const third = await archiveScreenshot('team', 'team/archive/schedule-screenshot-3.png', encodePng(27, 16, stripes), store, 0);
+    expect(third).to.eql({key: 'team/archive/schedule-screenshot-3.png', deduplicated: false});
+    expect(await resolveScreenshotKey('team/archive/schedule-screenshot-3.png', store)).to.equal('team/archive/schedule-screenshot-3.png');
+    expect(await resolveScreenshotKey('team/archive/schedule-screenshot-4.png', store)).to.equal(null);
+  });
+
+  it(`always archives the screenshot when the deduplication is off`, async function() {
+    await archiveScreenshot('team', 'team/archive/schedule-screenshot-1.png', encodePng(27, 16, gradient), store, null);
+    const second = await archiveScreenshot('team', 'team/archive/schedule-screenshot-2.png', encodePng(27, 16, gradient), store, null);
+    expect(second.deduplicated).to.equal(false);
+    expect(await store.exists('team/archive/schedule-screenshot-2.png')).to.equal(true);
+  });
+});
@@ -0,0 +1,43 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {getSeasonMetadata, getTeamSeasonMetadata, getSnapshotMetadataKey, recordSnapshotMetadata, loadSnapshotMetadata, matchesSeason} = require('../lib/season');
+const {listScheduleSnapshots} = require('../lib/timeline');
+
+describe('Season Unit Tests', function() {
+  const teams = [{id: 'BlineBanditsBot', url: 'https://www.brooklinebaseball.net/bandits12u', season: '2024 Spring', ageGroup: '12U'}, {id: 'OtherTeamBot', url: 'https://example.com/schedule'}];
+
+  it(`retrieves the season and age group of the team`, function() {
+    expect(getSeasonMetadata(teams[0])).to.eql({season: '2024 Spring', ageGroup: '12U'});
+    expect(getSeasonMetadata({id: 'team', season: 2024})).to.eql({season: '2024', ageGroup: null});
+    expect(getSeasonMetadata(teams[1])).to.equal(null);
+    expect(getTeamSeasonMetadata('BlineBanditsBot', teams)).to.eql({season: '2024 Spring', ageGroup: '12U'});
+    expect(getTeamSeasonMetadata('MissingBot', teams)).to.equal(null);
+  });
+
+  it(`stores the metadata alongside the snapshot`, async function() {
+    const store = new MemoryStore();
+    const snapshotKey = 'BlineBanditsBot/archive/schedule-2024-4-6-1712400000000.json';
+    expect(getSnapshotMetadataKey(snapshotKey)).to.equal(`${snapshotKey}.meta`);
+    expect(await recordSnapshotMetadata(snapshotKey, null, store)).to.equal(null);
+    expect(await loadSnapshotMetadata(snapshotKey, store)).to.equal(null);
+    expect(await recordSnapshotMetadata(snapshotKey, {season: '2024 Spring', ageGroup: '12U'}, store)).to.equal(`${snapshotKey}.meta`);
+    expect(await loadSnapshotMetadata(snapshotKey, store)).to.eql({season: '2024 Spring', ageGroup: '12U'});
+  });
+
+  it(`matches the season regardless of case`, function() {
+    expect(matchesSeason({season: '2024 Spring', ageGroup: '12U'}, ' 2024 spring')).to.equal(true);
+    expect(matchesSeason({season: '2024 Spring', ageGroup: '12U'}, '2023 Fall')).to.equal(false);
+    expect(matchesSeason(null, '2024 Spring')).to.equal(false);
+  });
+
+  it(`lists the snapshots of a season`, async function() {
+    const store = new MemoryStore({
+      'team/archive/schedule-2023-10-1-1696190000000.json': '{}',
+      'team/archive/schedule-2024-4-6-1712400000000.json': '{}',
+      'team/archive/schedule-2024-4-6-1712400000000.json.meta': JSON.stringify({season: '2024 Spring', ageGroup: '12U'}),
+    });
+    expect((await listScheduleSnapshots('team', store)).map((snapshot) => snapshot.key)).to.eql(['team/archive/schedule-2023-10-1-1696190000000.json', 'team/archive/schedule-2024-4-6-1712400000000.json']);
+    expect((await listScheduleSnapshots('team', store, '2024 Spring')).map((snapshot) => snapshot.key)).to.eql(['team/archive/schedule-2024-4-6-1712400000000.json']);
+  });
+});
@@ -0,0 +1,46 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {SecretCache} = require('../lib/secret_cache');
+
+describe('Secret Cache Unit Tests', function() {
+  let calls;
+  let versions;
+  const client = {
+    retrieveApiToken: async () => 'token',
+    retrieveSecrets: async () => {
+      calls.push('open');
+      return new Map([...versions].map(([name, version]) => [name, {value: `${name}-v${version}`, version}]));
+    },
+    retrieveSecretVersions: async () => {
+      calls.push('versions');
+      return new Map(versions);
+    },
+  };
+
+  beforeEach(function() {
+    calls = [];
+    versions = new Map([['AWS_S3_BUCKET', 1], ['TWITTER_USER_HANDLE', 1]]);
+  });
+
+  it(`fetches the secrets once`, async function() {
+    const cache = new SecretCache(3600, client);
+    await cache.refresh(new Date('2023-10-06T12:00:00Z'));
+    expect(cache.get('AWS_S3_BUCKET')).to.equal('AWS_S3_BUCKET-v1');
+    expect(cache.get('MISSING')).to.equal(null);
+    expect(await cache.refresh(new Date('2023-10-06T12:30:00Z'))).to.equal(false);
+    expect(calls).to.eql(['open']);
+  });
+
+  it(`only fetches the secrets again when they were rotated`, async function() {
+    const cache = new SecretCache(3600, client);
+    await cache.load(new Date('2023-10-06T12:00:00Z'));
+    expect(await cache.refresh(new Date('2023-10-06T13:30:00Z'))).to.equal(false);
+    expect(calls).to.eql(['open', 'versions']);
+
+    versions.set('AWS_S3_BUCKET', 2);
+    expect(await cache.refresh(new Date('2023-10-06T14:00:00Z'))).to.equal(false); // checked recently
+    expect(await cache.refresh(new Date('2023-10-06T15:00:00Z'))).to.equal(true);
+    expect(cache.get('AWS_S3_BUCKET')).to.equal('AWS_S3_BUCKET-v2');
+    expect(calls).to.eql(['open', 'versions', 'versions', 'open']);
+  });
+});
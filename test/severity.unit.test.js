@@ -0,0 +1,73 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const config = require('../config');
+const {isPastEntry, categorizeChange, classifyChanges, getChannelsForSeverity, capSeverity} = require('../lib/severity');
+
+describe('Severity Unit Tests', function() {
+  const now = new Date(2023, 9, 6); // October 6th, 2023
+  const practice = {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Practice, Warren', timeBlock: '3:00–5:30'};
+
+  it(`determines whether an entry is in the past`, function() {
+    expect(isPastEntry({dayOfMonth: '10/5'}, now)).to.be.true;
+    expect(isPastEntry({dayOfMonth: '10/7'}, now)).to.be.false;
+    expect(isPastEntry({dayOfMonth: '12/30'}, new Date(2024, 0, 2))).to.be.true; // previous year
+  });
+
+  it(`categorizes each type of change`, function() {
+    expect(categorizeChange('added', null, practice, now)).to.equal('newGame');
+    expect(categorizeChange('deleted', practice, null, now)).to.equal('cancellation');
+    expect(categorizeChange('deleted', {...practice, dayOfMonth: '10/3'}, null, now)).to.equal('expired');
+    expect(categorizeChange('modified', practice, {...practice, location: 'Practice is canceled', timeBlock: null}, now)).to.equal('cancellation');
+    expect(categorizeChange('modified', practice, {...practice, timeBlock: '3:30–5:30'}, now)).to.equal('timeChange');
+    expect(categorizeChange('modified', practice, {...practice, location: 'Practice, Eliot'}, now)).to.equal('locationChange');
+    expect(categorizeChange('modified', practice, {...practice, location: 'practice,  Warren'}, now)).to.equal('textFix');
+  });
+
+  it(`uses the most severe change as the overall severity`, function() {
+    const previous = new Map([['SATURDAY, 10/7', practice]]);
+    const scheduleDiff = {
+      added: new Map([['SUNDAY, 10/8', {...practice, dayOfWeek: 'SUNDAY', dayOfMonth: '10/8'}]]),
+      deleted: new Map(),
+      modified: new Map([['SATURDAY, 10/7', {...practice, location: 'Practice is canceled', timeBlock: null}]]),
+    };
+    const rules = {newGame: 'moderate', cancellation: 'critical'};
+    const result = classifyChanges(previous, scheduleDiff, rules, now);
+    expect(result.severity).to.equal('critical');
+    expect(result.changes.length).to.equal(2);
+  });
+
+  it(`routes severities to the configured channels`, function() {
+    const routes = {minor: ['webhook'], moderate: ['webhook', 'social']};
+    expect(getChannelsForSeverity('minor', routes)).to.eql(['webhook']);
+    expect(getChannelsForSeverity('moderate', routes)).to.eql(['webhook', 'social']);
+    expect(getChannelsForSeverity('critical', routes)).to.eql([]);
+  });
+
+  it(`rejects the routes that name an unknown channel`, function() {
+    const original = process.env.SEVERITY_ROUTES;
+    const originalError = console.error;
+    const errors = [];
+    console.error = (message) => errors.push(message);
+    try {
+      process.env.SEVERITY_ROUTES = JSON.stringify({minor: ['changelog', 'social'], moderate: ['social'], critical: 'email'});
+      expect(config.severity_routes).to.eql({minor: [], moderate: ['social'], critical: ['webhook', 'social', 'sms', 'email']});
+      expect(errors).to.eql([
+        'Ignoring the SEVERITY_ROUTES for minor, unknown channels: changelog',
+        'Ignoring the SEVERITY_ROUTES for critical, which isn\'t a list of channels',
+      ]);
+    } finally {
+      console.error = originalError;
+      if (original === undefined) {
+        delete process.env.SEVERITY_ROUTES;
+      } else {
+        process.env.SEVERITY_ROUTES = original;
+      }
+    }
+  });
+
+  it(`caps the severity`, function() {
+    expect(capSeverity('critical', 'minor')).to.equal('minor');
+    expect(capSeverity('moderate', 'critical')).to.equal('moderate');
+    expect(capSeverity('minor', 'moderate')).to.equal('minor');
+  });
+});
@@ -0,0 +1,48 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const crypto = require('crypto');
+const {MemoryStore} = require('./fakes');
+const {loadSigningKey, loadVerifyKey, getKeyId, signContents, verifyContents, signArchivedFiles, verifyArchive} = require('../lib/signing');
+
+describe('Signing Unit Tests', function() {
+  const {privateKey, publicKey} = crypto.generateKeyPairSync('ed25519');
+  const privatePem = privateKey.export({type: 'pkcs8', format: 'pem'});
+  const publicPem = publicKey.export({type: 'spki', format: 'pem'});
+  const snapshotKey = 'BlineBanditsBot/archive/schedule-2023-10-6-1696600000000.json';
+  const screenshotKey = 'BlineBanditsBot/archive/schedule-screenshot-2023-10-6-1696600000000.png';
+
+  it(`loads the ed25519 keys`, function() {
+    expect(loadSigningKey('')).to.equal(null);
+    expect(getKeyId(loadSigningKey(privatePem))).to.equal(getKeyId(publicKey));
+    expect(getKeyId(loadVerifyKey('', loadSigningKey(privatePem)))).to.equal(getKeyId(publicKey));
+    expect(getKeyId(loadVerifyKey(publicPem, null))).to.equal(getKeyId(publicKey));
+    const rsa = crypto.generateKeyPairSync('rsa', {modulusLength: 1024}).privateKey.export({type: 'pkcs8', format: 'pem'});
+    expect(loadSigningKey(rsa)).to.equal(null);
+  });
+
+  it(`verifies the signed contents`, function() {
+    const signature = signContents(snapshotKey, '{"SATURDAY, 10/07":{}}', privateKey, new Date('2023-10-06T14:00:00Z'));
+    expect(signature.algorithm).to.equal('ed25519');
+    expect(signature.signedAt).to.equal('2023-10-06T14:00:00.000Z');
+    expect(verifyContents(snapshotKey, '{"SATURDAY, 10/07":{}}', signature, publicKey)).to.equal(null);
+    expect(verifyContents(snapshotKey, '{"SUNDAY, 10/08":{}}', signature, publicKey)).to.equal('the contents changed since they were signed');
+    expect(verifyContents(screenshotKey, '{"SATURDAY, 10/07":{}}', signature, publicKey)).to.equal('the signature doesn\'t match');
+    expect(verifyContents(snapshotKey, '{"SATURDAY, 10/07":{}}', signature, crypto.generateKeyPairSync('ed25519').publicKey)).to.match(/^signed with another key/);
+  });
+
+  it(`signs the archived files and finds the altered ones`, async function() {
+    const store = new MemoryStore({[snapshotKey]: '{"SATURDAY, 10/07":{}}', [screenshotKey]: 'PNG'});
+    expect(await signArchivedFiles([snapshotKey, screenshotKey, 'BlineBanditsBot/archive/missing.png'], store, null)).to.eql([]);
+    expect(await signArchivedFiles([snapshotKey, screenshotKey, 'BlineBanditsBot/archive/missing.png'], store, privateKey)).to.eql([snapshotKey, screenshotKey]);
+    expect((await verifyArchive('BlineBanditsBot', store, publicKey)).map((result) => result.status)).to.eql(['verified', 'verified']);
+
+    await store.upload(snapshotKey, '{"SATURDAY, 10/07":{"location":"Larz"}}');
+    await store.upload('BlineBanditsBot/archive/schedule-2023-10-7-1696700000000.json', '{}');
+    await store.delete(screenshotKey);
+    expect(await verifyArchive('BlineBanditsBot', store, publicKey)).to.eql([
+      {key: snapshotKey, status: 'tampered', detail: 'the contents changed since they were signed'},
+      {key: 'BlineBanditsBot/archive/schedule-2023-10-7-1696700000000.json', status: 'unsigned', detail: null},
+      {key: screenshotKey, status: 'tampered', detail: 'the file was deleted'},
+    ]);
+  });
+});
@@ -0,0 +1,101 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {PNG} = require('./fakes');
+const {parseSchedule} = require('../lib/helper_functions');
+const {getSlackSettings, buildSectionText, buildSlackMessage, postToSlackChannel, checkSlack} = require('../lib/slack');
+
+describe('Slack Unit Tests', function() {
+  const names = ['SLACK_BOT_TOKEN', 'SLACK_CHANNEL', 'SLACK_WEBHOOK_URL'];
+  const originals = {};
+  const previousSchedule = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:00-5:30\n\nSUNDAY, 10/8\n\nGame, Downes, 1:00\n\n');
+  const current = parseSchedule('SATURDAY, 10/7\n\nPractice, Warren, 3:30-5:30\n\nTUESDAY, 10/10\n\nPractice, Warren <Field 2>, 5:00-7:00\n\n');
+  const scheduleDiff = {
+    added: new Map([...current].filter(([key]) => key.startsWith('TUESDAY'))),
+    modified: new Map([...current].filter(([key]) => key.startsWith('SATURDAY'))),
+    deleted: new Map([...previousSchedule].filter(([key]) => key.startsWith('SUNDAY'))),
+    previousSchedule,
+  };
+
+  beforeEach(function() {
+    names.forEach((name) => {
+      originals[name] = process.env[name];
+      delete process.env[name];
+    });
+  });
+
+  afterEach(function() {
+    for (const name of names) {
+      if (originals[name] === undefined) {
+        delete process.env[name];
+      } else {
+        process.env[name] = originals[name];
+      }
+    }
+  });
+
+  it(`configures the bot or webhook per team`, function() {
+    expect(getSlackSettings({id: 'team'})).to.equal(null);
+    process.env.SLACK_BOT_TOKEN = 'xoxb-default';
+    process.env.SLACK_CHANNEL = 'C001';
+    expect(getSlackSettings({id: 'team'})).to.eql({botToken: 'xoxb-default', channel: 'C001'});
+    expect(getSlackSettings({id: 'team', slack: {channel: 'C002'}})).to.eql({botToken: 'xoxb-default', channel: 'C002'});
+    expect(getSlackSettings({id: 'team', slack: {webhookUrl: 'https://hooks.slack.com/services/T/B/x'}})).to.eql({webhookUrl: 'https://hooks.slack.com/services/T/B/x'});
+  });
+
+  it(`renders the changes as Block Kit sections`, function() {
+    expect(buildSectionText('added', scheduleDiff)).to.equal('*Added*\n• Practice Tue 10/10 5:00-7:00 at Warren &lt;Field 2&gt;');
+    expect(buildSectionText('modified', scheduleDiff)).to.equal('*Modified*\n• ~Practice Sat 10/7 3:00-5:30 at Warren~ → Practice Sat 10/7 3:30-5:30 at Warren');
+    expect(buildSectionText('deleted', scheduleDiff)).to.equal('*Removed*\n• ~Game Sun 10/8 1:00 at Downes~');
+    expect(buildSectionText('added', {...scheduleDiff, added: new Map()})).to.equal(null);
+
+    const message = buildSlackMessage('Bandits 12U schedule update', 'Saturday\'s practice moved to 3:30pm.', scheduleDiff, 'https://example.com/r/team/abc', 'https://example.com/screenshot.png', 'Bandits 12U schedule');
+    expect(message.text).to.equal('Bandits 12U schedule update: Saturday\'s practice moved to 3:30pm.');
+    expect(message.blocks.map((block) => block.type)).to.eql(['header', 'section', 'section', 'section', 'section', 'image', 'context']);
+    expect(message.blocks[6].elements[0].text).to.equal('<https://example.com/r/team/abc|View the schedule>');
+  });
+
+  it(`posts the message and uploads the screenshot with a bot`, async function() {
+    const requests = [];
+    const http = {post: async (url, body) => {
+      requests.push({url, body});
+      if (url.endsWith('chat.postMessage')) {
+        return {status: 200, data: {ok: true, channel: 'C001', ts: '1696600000.000100'}};
+      }
+      if (url.endsWith('files.getUploadURLExternal')) {
+        return {status: 200, data: {ok: true, upload_url: 'https://files.slack.com/upload/v1/abc', file_id: 'F001'}};
+      }
+      return {status: 200, data: {ok: true}};
+    }};
+    const message = buildSlackMessage('Update', 'Changed.', scheduleDiff, 'https://example.com');
+    const result = await postToSlackChannel(PNG, message, {botToken: 'xoxb-1', channel: 'bandits'}, 'Update', 'Alt', undefined, http);
+    expect(result).to.eql({channel: 'C001', ts: '1696600000.000100'});
+    expect(requests.map((request) => request.url)).to.eql([
+      'https://slack.com/api/chat.postMessage',
+      'https://slack.com/api/files.getUploadURLExternal',
+      'https://files.slack.com/upload/v1/abc',
+      'https://slack.com/api/files.completeUploadExternal',
+    ]);
+    expect(JSON.parse(new URLSearchParams(requests[0].body).get('blocks'))).to.eql(message.blocks);
+    expect(new URLSearchParams(requests[3].body).get('channel_id')).to.equal('C001');
+
+    const failing = {post: async () => ({status: 200, data: {ok: false, error: 'channel_not_found'}})};
+    expect(await postToSlackChannel(PNG, message, {botToken: 'xoxb-1', channel: 'bandits'}, 'Update', 'Alt', undefined, failing)).to.equal(null);
+  });
+
+  it(`posts only the message with an incoming webhook`, async function() {
+    const requests = [];
+    const http = {post: async (url, body) => {
+      requests.push({url, body});
+      return {status: 200, data: 'ok'};
+    }};
+    const message = buildSlackMessage('Update', 'Changed.', scheduleDiff, 'https://example.com');
+    expect(await postToSlackChannel(null, message, {webhookUrl: 'https://hooks.slack.com/services/T/B/x'}, 'Update', 'Alt', undefined, http)).to.eql({});
+    expect(requests).to.eql([{url: 'https://hooks.slack.com/services/T/B/x', body: message}]);
+  });
+
+  it(`checks the bots and counts the webhooks`, async function() {
+    const teams = [{id: 'team', slack: {botToken: 'xoxb-1', channel: 'C001'}}, {id: 'other', slack: {webhookUrl: 'https://hooks.slack.com/services/T/B/x'}}];
+    const http = {post: async () => ({status: 200, data: {ok: true, user: 'banditsbot', team: 'Bandits'}})};
+    expect(await checkSlack(teams, http)).to.equal('banditsbot in Bandits, 1 webhook');
+  });
+});
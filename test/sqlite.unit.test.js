@@ -0,0 +1,27 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseSchedule, compareSchedules} = require('../lib/helper_functions');
+const {getScheduleRows, getDiffRows} = require('../lib/sqlite');
+
+describe('SQLite Unit Tests', function() {
+  const now = new Date('2023-10-01T12:00:00Z');
+  const previous = parseSchedule('Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:45–6:45\n\nSchedule by Season\n\n', now);
+  const schedule = parseSchedule('Upcoming Schedule\n\nTHURSDAY, 10/5\n\nPractice, Eliot, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 1:00\n\nSchedule by Season\n\n', now);
+
+  it(`converts the schedule into rows`, function() {
+    const rows = getScheduleRows('team', schedule, now);
+    expect(rows.length).to.equal(2);
+    expect(rows[0]).to.include({team_id: 'team', captured_at: '2023-10-01T12:00:00.000Z', key: 'THURSDAY, 10/5/2023', location: 'Practice, Eliot', time_block: '4:45–6:45', season: null, age_group: null});
+    expect(getScheduleRows('team', schedule, now, {season: '2023 Fall', ageGroup: '12U'})[0]).to.include({season: '2023 Fall', age_group: '12U'});
+  });
+
+  it(`converts the differences into rows, with the previous and current entries`, function() {
+    const scheduleDiff = {...compareSchedules(previous, schedule), previousSchedule: previous};
+    const classification = {changes: [{key: 'THURSDAY, 10/5/2023', category: 'locationChange', severity: 'critical'}]};
+    const rows = getDiffRows('team', scheduleDiff, classification, now);
+    expect(rows.map((row) => `${row.change} ${row.key}`)).to.eql(['added SATURDAY, 10/7/2023', 'deleted TUESDAY, 10/3/2023', 'modified THURSDAY, 10/5/2023']);
+    expect(rows[0]).to.include({previous_location: null, location: 'Game, Downes', category: null});
+    expect(rows[1]).to.include({previous_location: 'Practice, Warren', location: null});
+    expect(rows[2]).to.include({previous_location: 'Practice, Warren', location: 'Practice, Eliot', category: 'locationChange', severity: 'critical'});
+  });
+});
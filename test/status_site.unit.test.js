@@ -0,0 +1,61 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {serializeSchedule} = require('../lib/helper_functions');
+const {getChangeLog, buildStatusPageHtml, publishStatusSite} = require('../lib/status_site');
+
+describe('Status Site Unit Tests', function() {
+  const team = {id: 'BlineBanditsBot', name: 'Bandits 12U', url: 'https://www.brooklinebaseball.net/bandits12u'};
+  const key = 'SATURDAY, 10/07';
+  const practice = {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Practice, Warren', timeBlock: '3:00–5:30'};
+  const now = new Date('2023-10-04T12:00:00Z');
+  const originalPrefix = process.env.STATUS_SITE_PREFIX;
+  let store;
+
+  beforeEach(async function() {
+    process.env.STATUS_SITE_PREFIX = 'status';
+    store = new MemoryStore();
+    await serializeSchedule(new Map([[key, practice]]), `${team.id}/archive/schedule-2023-10-1-1696190000000.json`, store);
+    await serializeSchedule(new Map([[key, {...practice, timeBlock: '3:30–5:30'}]]), `${team.id}/archive/schedule-2023-10-3-1696360000000.json`, store);
+    await store.upload(`${team.id}/archive/schedule-screenshot-2023-10-3-1696360000000.png`, Buffer.from('png'));
+  });
+
+  afterEach(function() {
+    if (originalPrefix === undefined) {
+      delete process.env.STATUS_SITE_PREFIX;
+    } else {
+      process.env.STATUS_SITE_PREFIX = originalPrefix;
+    }
+  });
+
+  it(`lists the changes between the archived schedules, newest first`, async function() {
+    const changeLog = await getChangeLog(team.id, store, 10);
+    expect(changeLog).to.eql([{timestamp: new Date(1696360000000), items: ['✏️ Sat 10/7 time changed to 3:30-5:30']}]);
+    expect(await getChangeLog('other', store, 10)).to.eql([]);
+  });
+
+  it(`renders the current schedule, screenshot, and change log`, function() {
+    const html = buildStatusPageHtml(team, {timestamp: new Date(1696360000000), schedule: new Map([[key, {...practice, location: 'Practice, Warren <Field 2>'}]]), hasScreenshot: true}, [{timestamp: new Date(1696360000000), items: ['✏️ Sat 10/7 time changed to 3:30pm']}], now, 'America/New_York');
+    expect(html).to.contain('<title>Bandits 12U schedule</title>');
+    expect(html).to.contain('<p>Last changed ');
+    expect(html).to.contain('<td>Practice, Warren &lt;Field 2&gt;</td>');
+    expect(html).to.contain('<img src="screenshot.png"');
+    expect(html).to.contain('✏️ Sat 10/7 time changed to 3:30pm</li>');
+  });
+
+  it(`publishes the team's page, screenshot, and the index with their content types`, async function() {
+    const uploads = [];
+    const upload = async (uploadKey, contents, contentType) => {
+      uploads.push({key: uploadKey, contentType});
+      return uploadKey !== 'status/index.html';
+    };
+    const result = await publishStatusSite(team, store, [team], upload, now);
+    expect(uploads).to.eql([
+      {key: `status/${team.id}/screenshot.png`, contentType: 'image/png'},
+      {key: `status/${team.id}/index.html`, contentType: 'text/html; charset=utf-8'},
+      {key: 'status/index.html', contentType: 'text/html; charset=utf-8'},
+    ]);
+    expect(result).to.eql({published: [`status/${team.id}/screenshot.png`, `status/${team.id}/index.html`], failed: ['status/index.html']});
+    expect(await publishStatusSite({id: 'other', url: 'https://example.com'}, store, [team], upload, now)).to.equal(null);
+  });
+});
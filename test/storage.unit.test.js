@@ -0,0 +1,148 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const fs = require('fs');
+const http = require('http');
+const os = require('os');
+const path = require('path');
+const {S3Store, LocalStore, getShareUrl} = require('../lib/storage');
+const {AWS} = require('../lib/aws');
+const {parseSchedule, serializeSchedule, deserializeSchedule, compareSchedules, diffSchedule, canonicalizeSchedule, summarizeChanges} = require('../lib/helper_functions');
+
+describe('Storage Unit Tests', function() {
+  let rootPath;
+  let store;
+
+  beforeEach(function() {
+    rootPath = fs.mkdtempSync(path.join(os.tmpdir(), 'banditsNotification-'));
+    store = new LocalStore(rootPath);
+  });
+
+  afterEach(function() {
+    fs.rmSync(rootPath, {recursive: true, force: true});
+  });
+
+  it(`can upload, download, check, and delete a file`, async function() {
+    expect(await store.exists('team/testfile.txt')).to.be.false;
+    expect(await store.download('team/testfile.txt')).to.equal(null);
+    expect(await store.upload('team/testfile.txt', 'Test Contents')).to.be.true;
+    expect(await store.exists('team/testfile.txt')).to.be.true;
+    expect((await store.download('team/testfile.txt')).toString('utf-8')).to.equal('Test Contents');
+    expect(await store.delete('team/testfile.txt')).to.be.true;
+    expect(await store.exists('team/testfile.txt')).to.be.false;
+  });
+
+  it(`only creates a file that doesn't exist`, async function() {
+    expect(await store.create('team/run.lock', 'first')).to.be.true;
+    expect(await store.create('team/run.lock', 'second')).to.be.false;
+    expect((await store.download('team/run.lock')).toString('utf-8')).to.equal('first');
+  });
+
+  it(`lists the files under a prefix`, async function() {
+    await store.upload('team/archive/schedule-1.json', '{}');
+    await store.upload('team/archive/schedule-2.json', '{}');
+    await store.upload('team/previousSchedule.json', '{}');
+    const files = await store.list('team/archive/');
+    expect(files.map((file) => file.key)).to.eql(['team/archive/schedule-1.json', 'team/archive/schedule-2.json']);
+    expect(files[0].size).to.equal(2);
+  });
+
+  it(`rejects keys outside of the storage root`, function() {
+    expect(() => store.resolve('../outside.txt')).to.throw('outside of the storage root');
+  });
+
+  it(`can serialize and deserialize the schedule`, async function() {
+    const input = 'Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:45–6:45\n\nSchedule by Season\n\n';
+    const a = canonicalizeSchedule(parseSchedule(input));
+    await serializeSchedule(a, 'team/serializedTestSchedule.json', store);
+    const b = await deserializeSchedule('team/serializedTestSchedule.json', store);
+    const result = compareSchedules(a, b);
+    expect(result['unchanged'].size).to.equal(2);
+    expect(result['modified'].size).to.equal(0);
+  });
+
+  it(`doesn't report any changes against a schedule stored before the keys had a year`, async function() {
+    const page = 'Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame vs Tigers, Downes, 1:00\n\nSchedule by Season\n\n';
+    const schedule = parseSchedule(page);
+    // The format of previousSchedule.json before the canonicalization, without a year or `date`
+    const stored = Object.fromEntries([...schedule.values()].map((entry) => [`${entry.dayOfWeek}, ${entry.dayOfMonth}`, {dayOfWeek: entry.dayOfWeek, dayOfMonth: entry.dayOfMonth, location: entry.location, timeBlock: entry.timeBlock, parsed: entry.parsed}]));
+    await store.upload('team/previousSchedule.json', JSON.stringify(stored));
+    const result = await diffSchedule(schedule, 'team', store);
+    expect(summarizeChanges(result)).to.equal('No changes');
+    expect(result.unchanged.size).to.equal(2);
+  });
+
+  it(`diffs against the previous schedule, seeding it on the first run`, async function() {
+    const now = new Date('2023-10-01T12:00:00Z');
+    const first = parseSchedule('Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nSchedule by Season\n\n', now);
+    const second = parseSchedule('Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:30–6:30\n\nSchedule by Season\n\n', now);
+    const initial = await diffSchedule(first, 'team', store);
+    expect(initial['unchanged'].size).to.equal(1);
+    const result = await diffSchedule(second, 'team', store);
+    expect(result['modified'].size).to.equal(1);
+    expect(result.previousSchedule.get('TUESDAY, 10/03/2023')['timeBlock']).to.equal('4:45-6:45');
+  });
+
+  it(`only generates share links for storage that supports them`, async function() {
+    expect(await getShareUrl(store, 'team/archive/schedule-screenshot.png', 60)).to.equal(null);
+    const sharingStore = {getShareUrl: async (key, expiresInSeconds) => `https://example.com/${key}?expires=${expiresInSeconds}`};
+    expect(await getShareUrl(sharingStore, 'team/archive/schedule-screenshot.png', 60)).to.equal('https://example.com/team/archive/schedule-screenshot.png?expires=60');
+  });
+
+  describe('S3Store', function() {
+    let server;
+    let requests;
+    let existing;
+    const originals = {};
+
+    before(async function() {
+      // A local S3 endpoint, so that the real SDK builds (and validates) the requests
+      server = http.createServer((request, response) => {
+        requests.push({method: request.method, url: request.url, headers: request.headers});
+        request.resume();
+        request.on('end', () => {
+          if (request.headers['if-none-match'] === '*' && existing.has(request.url)) {
+            response.writeHead(412, {'Content-Type': 'application/xml'});
+            response.end('<?xml version="1.0" encoding="UTF-8"?><Error><Code>PreconditionFailed</Code><Message>At least one of the pre-conditions you specified did not hold</Message></Error>');
+            return;
+          }
+          existing.add(request.url);
+          response.writeHead(200, {ETag: '"etag"'});
+          response.end();
+        });
+      });
+      await new Promise((resolve) => server.listen(0, '127.0.0.1', resolve));
+      originals.s3 = AWS.config.s3;
+      originals.credentials = AWS.config.credentials;
+      originals.bucket = process.env.AWS_S3_BUCKET;
+      AWS.config.s3 = {endpoint: `http://127.0.0.1:${server.address().port}`, s3ForcePathStyle: true, maxRetries: 0};
+      AWS.config.credentials = new AWS.Credentials('test', 'test');
+      process.env.AWS_S3_BUCKET = 'bucket';
+    });
+
+    beforeEach(function() {
+      requests = [];
+      existing = new Set();
+    });
+
+    after(async function() {
+      AWS.config.s3 = originals.s3;
+      AWS.config.credentials = originals.credentials;
+      if (originals.bucket === undefined) {
+        delete process.env.AWS_S3_BUCKET;
+      } else {
+        process.env.AWS_S3_BUCKET = originals.bucket;
+      }
+      await new Promise((resolve) => server.close(resolve));
+    });
+
+    it(`creates a key with a conditional put, which fails once the key exists`, async function() {
+      const s3Store = new S3Store();
+      expect(await s3Store.create('team/run.lock', '{}')).to.equal(true);
+      expect(requests.length).to.equal(1);
+      expect(requests[0]).to.include({method: 'PUT', url: '/bucket/team/run.lock'});
+      expect(requests[0].headers['if-none-match']).to.equal('*');
+      expect(await s3Store.create('team/run.lock', '{}')).to.equal(false);
+      expect(requests.length).to.equal(2);
+    });
+  });
+});
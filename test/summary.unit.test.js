@@ -0,0 +1,83 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {parseSchedule, compareSchedules} = require('../lib/helper_functions');
+const {SemanticDiffer} = require('../lib/differ');
+const {describeKind, summarizeInSentences, splitChangeList, formatChangeList, buildAltText} = require('../lib/summary');
+
+describe('Summary Unit Tests', function() {
+  const now = new Date('2023-10-02T12:00:00Z');
+  const previous = parseSchedule('Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 3:00\n\nSchedule by Season\n\n', now);
+  const diff = (schedule) => ({...compareSchedules(previous, schedule), previousSchedule: previous});
+
+  it(`describes the changes in a sentence`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 1:00\n\nSchedule by Season\n\n', now);
+    expect(summarizeInSentences(diff(schedule), 3, now)).to.equal('Tuesday practice cancelled; Saturday\'s game moved to 1pm.');
+  });
+
+  it(`describes new games and location changes`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Warren, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Eliot, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 3:00\n\nSUNDAY, 10/8\n\nGame, Larz Anderson, 10:30am\n\nSchedule by Season\n\n', now);
+    expect(summarizeInSentences(diff(schedule), 3, now)).to.equal('Thursday\'s practice moved to Eliot; Sunday game added at Larz Anderson, 10:30am.');
+  });
+
+  it(`names the opponents of games`, function() {
+    const withOpponent = parseSchedule('Upcoming Schedule\n\nSATURDAY, 10/7\n\nGame vs Tigers, Downes, 3:00\n\nSchedule by Season\n\n', now);
+    const opponentDiff = (schedule) => ({...compareSchedules(withOpponent, schedule), previousSchedule: withOpponent});
+    const moved = parseSchedule('Upcoming Schedule\n\nSATURDAY, 10/7\n\nGame vs Tigers, Downes, 6:30\n\nSUNDAY, 10/8\n\nGame @ Lions, Larz Anderson, 10:30am\n\nSchedule by Season\n\n', now);
+    expect(summarizeInSentences(opponentDiff(moved), 3, now)).to.equal('Saturday\'s game vs Tigers moved to 6:30pm; Sunday game at Lions added at Larz Anderson, 10:30am.');
+    const swapped = parseSchedule('Upcoming Schedule\n\nSATURDAY, 10/7\n\nGame vs Newton, Downes, 3:00\n\nSchedule by Season\n\n', now);
+    expect(summarizeInSentences(opponentDiff(swapped), 3, now)).to.equal('Saturday\'s game vs Newton (was game vs Tigers).');
+    expect(formatChangeList(opponentDiff(new Map()), Infinity, now)).to.equal('❌ Sat 10/7 game vs Tigers cancelled');
+  });
+
+  it(`describes the kind of event by the entry's event type`, function() {
+    expect(describeKind({location: 'Scrimmage, Downes', eventType: 'game'})).to.equal('game');
+    expect(describeKind({location: 'Team session, Warren', eventType: 'practice'})).to.equal('practice');
+    expect(describeKind({location: 'Picture day, Warren', eventType: null})).to.equal('event');
+    expect(describeKind({location: 'Tournament, Larz'})).to.equal('tournament'); // stored before the event type was kept
+  });
+
+  it(`counts the changes beyond the maximum`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nTHURSDAY, 10/5\n\nPractice, Warren, 4:30–6:30\n\nSATURDAY, 10/7\n\nGame is canceled\n\nSUNDAY, 10/8\n\nGame, Eliot, 3:00\n\nSchedule by Season\n\n', now);
+    expect(summarizeInSentences(diff(schedule), 2, now)).to.equal('Tuesday practice cancelled; Thursday\'s practice moved to 4:30pm. Plus 2 more changes.');
+  });
+
+  it(`leads with the semantic changes`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nTUESDAY, 10/3\n\nPractice, Downes, 4:45–6:45\n\nTHURSDAY, 10/5\n\nPractice, Downes, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 3:00\n\nSchedule by Season\n\n', now);
+    const scheduleDiff = new SemanticDiffer().diff(previous, schedule);
+    scheduleDiff.previousSchedule = previous;
+    expect(summarizeInSentences(scheduleDiff, 3, now)).to.equal('All practices moved from Warren to Downes.');
+  });
+
+  it(`skips changes that aren't newsworthy`, function() {
+    const schedule = new Map(previous);
+    schedule.delete('TUESDAY, 10/3');
+    expect(summarizeInSentences(diff(schedule), 3, new Date('2023-10-04T12:00:00Z'))).to.equal(null);
+  });
+
+  it(`formats the changes as a list`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nTHURSDAY, 10/5\n\nPractice, Eliot, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 1:00\n\nSUNDAY, 10/8\n\nPractice, Warren, 3:00–5:30\n\nSchedule by Season\n\n', now);
+    expect(formatChangeList(diff(schedule), Infinity, now)).to.equal('❌ Tue 10/3 practice cancelled, ✏️ Thu 10/5 moved to Eliot, ✏️ Sat 10/7 time changed to 1pm, ➕ Sun 10/8 practice added');
+  });
+
+  it(`cuts the list short to fit`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nTHURSDAY, 10/5\n\nPractice, Eliot, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 1:00\n\nSchedule by Season\n\n', now);
+    expect(formatChangeList(diff(schedule), 50, now)).to.equal('❌ Tue 10/3 practice cancelled, +2 more');
+    expect(formatChangeList(diff(schedule), 5, now)).to.equal(null);
+  });
+
+  it(`splits the changes that were left out into replies`, function() {
+    const schedule = parseSchedule('Upcoming Schedule\n\nTHURSDAY, 10/5\n\nPractice, Eliot, 4:45–6:45\n\nSATURDAY, 10/7\n\nGame, Downes, 1:00\n\nSchedule by Season\n\n', now);
+    expect(splitChangeList(diff(schedule), 50, 280, now)).to.eql({
+      list: '❌ Tue 10/3 practice cancelled, +2 more',
+      remainder: ['✏️ Thu 10/5 moved to Eliot\n✏️ Sat 10/7 time changed to 1pm'],
+    });
+    expect(splitChangeList(diff(schedule), 50, 30, now).remainder).to.eql(['✏️ Thu 10/5 moved to Eliot', '✏️ Sat 10/7 time changed to 1pm']);
+    expect(splitChangeList(diff(schedule), Infinity, 280, now).remainder).to.eql([]);
+  });
+
+  it(`describes the schedule for the alt text`, function() {
+    expect(buildAltText(previous, 'Bandits 12U schedule')).to.equal('Bandits 12U schedule: Practice Tue 10/3 4:45–6:45 at Warren, Practice Thu 10/5 4:45–6:45 at Warren, Game Sat 10/7 3:00 at Downes');
+    expect(buildAltText(previous, 'Bandits 12U schedule', 90)).to.equal('Bandits 12U schedule: Practice Tue 10/3 4:45–6:45 at Warren, +2 more');
+    expect(buildAltText(new Map(), 'Bandits 12U schedule')).to.equal('Bandits 12U schedule: nothing scheduled');
+  });
+});
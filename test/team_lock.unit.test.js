@@ -0,0 +1,61 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {LOCK_FILENAME, loadTeamLock, acquireTeamLock, releaseTeamLock, withTeamLock} = require('../lib/team_lock');
+
+describe('Team Lock Unit Tests', function() {
+  const now = new Date('2023-10-06T12:00:00Z');
+
+  it(`only lets one run hold the lock until it's released`, async function() {
+    const store = new MemoryStore();
+    const lock = await acquireTeamLock('team', store, 900, now);
+    expect(lock).to.include({acquiredAt: now.toISOString(), expiresAt: '2023-10-06T12:15:00.000Z'});
+    expect(await acquireTeamLock('team', store, 900, new Date('2023-10-06T12:05:00Z'))).to.equal(null);
+    expect(await releaseTeamLock('team', lock, store)).to.equal(true);
+    expect(await store.exists(`team/${LOCK_FILENAME}`)).to.equal(false);
+    expect(await acquireTeamLock('team', store, 900, new Date('2023-10-06T12:05:00Z'))).to.not.equal(null);
+  });
+
+  it(`takes over an expired lock, which the crashed run can no longer release`, async function() {
+    const store = new MemoryStore();
+    const stale = await acquireTeamLock('team', store, 900, now);
+    const lock = await acquireTeamLock('team', store, 900, new Date('2023-10-06T12:20:00Z'));
+    expect(lock.owner).to.not.equal(stale.owner);
+    expect(await releaseTeamLock('team', stale, store)).to.equal(false);
+    expect((await loadTeamLock('team', store)).owner).to.equal(lock.owner);
+  });
+
+  it(`doesn't take over a lock that isn't there when the create fails`, async function() {
+    const store = new MemoryStore();
+    store.create = async () => false; // e.g. the store rejected the conditional write
+    let deleted = false;
+    store.delete = async () => {
+      deleted = true;
+      return true;
+    };
+    expect(await acquireTeamLock('team', store, 900, now)).to.equal(null);
+    expect(deleted).to.equal(false);
+  });
+
+  it(`falls back to checking first for stores without conditional writes`, async function() {
+    const store = new MemoryStore();
+    store.create = undefined;
+    expect(await acquireTeamLock('team', store, 900, now)).to.not.equal(null);
+    expect(await acquireTeamLock('team', store, 900, now)).to.equal(null);
+  });
+
+  it(`runs the function while holding the lock`, async function() {
+    const store = new MemoryStore();
+    expect(await withTeamLock('team', async () => await store.exists(`team/${LOCK_FILENAME}`), store)).to.equal(true);
+    expect(await store.exists(`team/${LOCK_FILENAME}`)).to.equal(false);
+
+    await acquireTeamLock('team', store);
+    let error = null;
+    try {
+      await withTeamLock('team', async () => 'ran', store);
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.match(/locked by another run/);
+  });
+});
@@ -0,0 +1,71 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {PNG} = require('./fakes');
+const {CAPTION_MAX_LENGTH, getTelegramSettings, buildCaption, postScreenshotToTelegram, checkTelegram} = require('../lib/telegram');
+
+describe('Telegram Unit Tests', function() {
+  const originalToken = process.env.TELEGRAM_BOT_TOKEN;
+  const originalChatId = process.env.TELEGRAM_CHAT_ID;
+
+  beforeEach(function() {
+    process.env.TELEGRAM_BOT_TOKEN = '123:default';
+    delete process.env.TELEGRAM_CHAT_ID;
+  });
+
+  afterEach(function() {
+    if (originalToken === undefined) {
+      delete process.env.TELEGRAM_BOT_TOKEN;
+    } else {
+      process.env.TELEGRAM_BOT_TOKEN = originalToken;
+    }
+    if (originalChatId === undefined) {
+      delete process.env.TELEGRAM_CHAT_ID;
+    } else {
+      process.env.TELEGRAM_CHAT_ID = originalChatId;
+    }
+  });
+
+  it(`configures the bot and chat per team`, function() {
+    expect(getTelegramSettings({id: 'team'})).to.equal(null);
+    expect(getTelegramSettings({id: 'team', telegram: {chatId: -1001}})).to.eql({botToken: '123:default', chatId: '-1001'});
+    expect(getTelegramSettings({id: 'team', telegram: {chatId: '-1002', botToken: '456:own'}})).to.eql({botToken: '456:own', chatId: '-1002'});
+    process.env.TELEGRAM_CHAT_ID = '-1003';
+    expect(getTelegramSettings({id: 'team'})).to.eql({botToken: '123:default', chatId: '-1003'});
+    expect(buildCaption('x'.repeat(2000))).to.have.lengthOf(CAPTION_MAX_LENGTH);
+  });
+
+  it(`sends the screenshot with the caption to the team's chat`, async function() {
+    const requests = [];
+    const http = {post: async (url, form) => {
+      requests.push({url, chatId: form.get('chat_id'), caption: form.get('caption'), photo: form.get('photo')});
+      return {status: 200, data: {ok: true, result: {message_id: 42}}};
+    }};
+    const message = await postScreenshotToTelegram(PNG, 'Schedule update', {id: 'team', telegram: {chatId: '-1001'}}, undefined, http);
+    expect(message).to.eql({message_id: 42});
+    expect(requests).to.have.lengthOf(1);
+    expect(requests[0]).to.include({url: 'https://api.telegram.org/bot123:default/sendPhoto', chatId: '-1001', caption: 'Schedule update'});
+    expect(requests[0].photo.size).to.equal(PNG.length);
+
+    expect(await postScreenshotToTelegram(PNG, 'Schedule update', {id: 'other'}, undefined, http)).to.equal(null);
+    expect(requests).to.have.lengthOf(1); // not configured for the team
+
+    const rejected = {post: async () => ({status: 200, data: {ok: false, description: 'Bad Request: chat not found'}})};
+    expect(await postScreenshotToTelegram(PNG, 'Schedule update', {id: 'team', telegram: {chatId: '-1001'}}, undefined, rejected)).to.equal(null);
+  });
+
+  it(`checks that the bots still exist`, async function() {
+    const teams = [{id: 'team', telegram: {chatId: '-1001'}}, {id: 'other', telegram: {chatId: '-1002', botToken: '456:own'}}];
+    const http = {get: async (url) => url.includes('456:own') ?
+      {status: 200, data: {ok: true, result: {username: 'OwnBot'}}} :
+      {status: 200, data: {ok: true, result: {username: 'BanditsBot'}}}};
+    expect(await checkTelegram(teams, http)).to.equal('@BanditsBot, @OwnBot');
+
+    let error = null;
+    try {
+      await checkTelegram(teams, {get: async () => ({status: 401, data: {ok: false, description: 'Unauthorized'}})});
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.equal('A bot token was rejected: Unauthorized');
+  });
+});
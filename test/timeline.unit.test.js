@@ -0,0 +1,32 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {getSnapshotTimestamp, buildEventTimeline} = require('../lib/timeline');
+
+describe('Timeline Unit Tests', function() {
+  const key = 'SATURDAY, 10/7';
+  const practice = {dayOfWeek: 'SATURDAY', dayOfMonth: '10/7', location: 'Practice, Warren', timeBlock: '3:00–5:30'};
+  const snapshot = (day, entry) => ({
+    timestamp: new Date(2023, 9, day),
+    schedule: entry ? new Map([[key, entry]]) : new Map(),
+  });
+
+  it(`extracts the timestamp from the archived filename`, function() {
+    expect(getSnapshotTimestamp('BlineBanditsBot/archive/schedule-2023-10-6-1696600000000.json').getTime()).to.equal(1696600000000);
+    expect(getSnapshotTimestamp('BlineBanditsBot/previousSchedule.json')).to.equal(null);
+  });
+
+  it(`builds the timeline of changes for an entry`, function() {
+    const snapshots = [
+      snapshot(1, null),
+      snapshot(2, practice),
+      snapshot(3, practice),
+      snapshot(4, {...practice, timeBlock: '3:30–5:30'}),
+      snapshot(5, {...practice, location: 'Practice is canceled', timeBlock: null}),
+      snapshot(8, null),
+    ];
+    const events = buildEventTimeline(snapshots, key);
+    expect(events.map((event) => event.category)).to.eql(['newGame', 'timeChange', 'cancellation', 'expired']);
+    expect(events[1].previous.timeBlock).to.equal('3:00–5:30');
+    expect(events[1].current.timeBlock).to.equal('3:30–5:30');
+  });
+});
@@ -0,0 +1,113 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {TwitterError, classifyTwitterError, callWithRateLimit, getTwitterCredentials, uploadMediaChunked, setMediaAltText, uploadMedia, postTweet, deleteTweet} = require('../lib/twitter');
+const {FakeTwitterClient, twitterError} = require('./fakes');
+
+describe('Twitter Unit Tests', function() {
+  const now = new Date('2023-10-06T14:00:00Z');
+
+  it(`classifies the errors of the Twitter API`, function() {
+    const rateLimited = classifyTwitterError(twitterError(429, {title: 'Too Many Requests'}, {limit: 50, remaining: 0, reset: now.getTime() / 1000 + 30}), now);
+    expect(rateLimited).to.be.instanceOf(TwitterError);
+    expect([rateLimited.type, rateLimited.status, rateLimited.retryAfterMs, rateLimited.retryable]).to.eql(['rate_limited', 429, 30000, true]);
+    expect(rateLimited.message).to.equal('Rate limited by Twitter, resets in 30s');
+    expect(classifyTwitterError(twitterError(403, {detail: 'You are not allowed to create a Tweet with duplicate content.'})).type).to.equal('duplicate');
+    expect(classifyTwitterError(twitterError(403, {errors: [{code: 187, message: 'Status is a duplicate.'}]})).type).to.equal('duplicate');
+    expect(classifyTwitterError(twitterError(400, {errors: [{code: 324, message: 'File size exceeds 5242880 bytes.'}]})).type).to.equal('media_too_large');
+    expect(classifyTwitterError(twitterError(401, {title: 'Unauthorized'})).retryable).to.equal(false);
+    expect(classifyTwitterError(twitterError(503, {title: 'Service Unavailable'})).type).to.equal('server');
+    expect(classifyTwitterError(new Error('socket hang up')).type).to.equal('network');
+  });
+
+  it(`waits for the rate limit to reset and retries once`, async function() {
+    const waits = [];
+    const wait = async (ms) => waits.push(ms);
+    let calls = 0;
+    const call = async () => {
+      if (calls++ === 0) {
+        throw twitterError(429, {}, {reset: Date.now() / 1000 + 5});
+      }
+      return 'ok';
+    };
+    expect(await callWithRateLimit(call, undefined, 60000, wait)).to.equal('ok');
+    expect(waits).to.have.lengthOf(1);
+    expect(waits[0]).to.be.greaterThan(4000);
+
+    calls = 0;
+    let error = null;
+    try {
+      await callWithRateLimit(call, undefined, 1000, wait);
+    } catch (e) {
+      error = e;
+    }
+    expect(error.type).to.equal('rate_limited');
+    expect(calls).to.equal(1);
+  });
+
+  it(`posts a tweet with classified errors`, async function() {
+    const client = new FakeTwitterClient();
+    expect(await postTweet('Practice is moved to Warren tonight', null, client)).to.equal('1001');
+    let error = null;
+    try {
+      await postTweet('Practice is moved to Warren tonight', null, new FakeTwitterClient(twitterError(403, {detail: 'duplicate content'})));
+    } catch (e) {
+      error = e;
+    }
+    expect(error.type).to.equal('duplicate');
+  });
+
+  it(`uploads the media in chunks with v2`, async function() {
+    const client = new FakeTwitterClient();
+    const waits = [];
+    client.v2.post = async (endpoint, params) => {
+      client.mediaCommands.push(params);
+      return params.command === 'INIT' ? {data: {id: 'media-v2'}} : {data: params.command === 'FINALIZE' ? {processing_info: {state: 'pending', check_after_secs: 2}} : {}};
+    };
+    const buffer = Buffer.alloc(1024 * 1024 + 10);
+    expect(await uploadMediaChunked(buffer, client, 'image/png', undefined, async (ms) => waits.push(ms))).to.equal('media-v2');
+    expect(client.mediaCommands.map((params) => params.command)).to.eql(['INIT', 'APPEND', 'APPEND', 'FINALIZE', 'STATUS']);
+    expect(client.mediaCommands[0]).to.include({media_type: 'image/png', total_bytes: `${buffer.length}`});
+    expect(client.mediaCommands[2].segment_index).to.equal('1');
+    expect(client.mediaCommands[2].media.length).to.equal(10);
+    expect(waits).to.eql([2000]);
+  });
+
+  it(`uploads the media and deletes tweets with the configured API version`, async function() {
+    const client = new FakeTwitterClient();
+    expect(await uploadMedia(Buffer.from('png'), client, undefined, '', 'v1')).to.equal('media-1');
+    expect(await uploadMedia(Buffer.from('png'), client, undefined, '', 'v2')).to.equal('media-v2');
+    expect(client.uploads).to.have.lengthOf(1);
+    expect(await deleteTweet('1001', client, 'v2')).to.equal(true);
+    expect(await deleteTweet('1002', client, 'v1')).to.equal(true);
+    expect(client.deleted).to.eql(['1001', '1002']);
+  });
+
+  it(`sets the alt text of the uploaded media`, async function() {
+    const client = new FakeTwitterClient();
+    await uploadMedia(Buffer.from('png'), client, undefined, 'Bandits 12U schedule: Practice Sat 10/7 3:00-5:30 at Warren', 'v1');
+    await uploadMedia(Buffer.from('png'), client, undefined, 'Bandits 12U schedule: nothing scheduled', 'v2');
+    await uploadMedia(Buffer.from('png'), client, undefined, '', 'v1');
+    expect(client.altTexts).to.eql([
+      {mediaId: 'media-1', text: 'Bandits 12U schedule: Practice Sat 10/7 3:00-5:30 at Warren'},
+      {mediaId: 'media-v2', text: 'Bandits 12U schedule: nothing scheduled'},
+    ]);
+
+    client.v1.createMediaMetadata = async () => {
+      throw twitterError(400, {errors: [{code: 44, message: 'alt_text is too long'}]});
+    };
+    expect(await setMediaAltText('media-1', 'too long', client, undefined, 'v1')).to.equal(false);
+  });
+
+  it(`retrieves the credentials of the configured authentication`, function() {
+    const values = {TWITTER_CONSUMER_KEY: 'key', TWITTER_CONSUMER_SECRET: 'secret', TWITTER_ACCESS_TOKEN_KEY: 'token', TWITTER_ACCESS_TOKEN_SECRET: 'token secret', TWITTER_CLIENT_ID: 'client', TWITTER_CLIENT_SECRET: undefined};
+    const original = Object.fromEntries(Object.keys(values).map((name) => [name, process.env[name]]));
+    const setEnv = (env) => Object.entries(env).forEach(([name, value]) => value === undefined ? delete process.env[name] : process.env[name] = value);
+    setEnv(values);
+    try {
+      expect(getTwitterCredentials('oauth1')).to.eql(['key', 'secret', 'token', 'token secret']);
+      expect(getTwitterCredentials('oauth2')).to.eql(['client']);
+    } finally {
+      setEnv(original);
+    }
+  });
+});
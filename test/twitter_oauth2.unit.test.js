@@ -0,0 +1,77 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore} = require('./fakes');
+const {OAUTH2_SCOPES, loadOAuth2Token, saveOAuth2Token, startOAuth2Login, completeOAuth2Login, getOAuth2Client} = require('../lib/twitter_oauth2');
+
+/**
+ * Stands in for the client of the app's OAuth2 credentials, with the calls
+ * of `twitter-api-v2` that the login and refresh make.
+ */
+class FakeAppClient {
+  constructor() {
+    this.logins = [];
+    this.refreshes = [];
+  }
+
+  generateOAuth2AuthLink(redirectUri, options) {
+    return {url: `https://twitter.com/i/oauth2/authorize?redirect_uri=${encodeURIComponent(redirectUri)}&scope=${options.scope.join('%20')}`, codeVerifier: 'verifier', state: 'state-1'};
+  }
+
+  async loginWithOAuth2(params) {
+    this.logins.push(params);
+    return {accessToken: 'access-1', refreshToken: 'refresh-1', expiresIn: 7200, scope: OAUTH2_SCOPES};
+  }
+
+  async refreshOAuth2Token(refreshToken) {
+    this.refreshes.push(refreshToken);
+    return {accessToken: `access-${this.refreshes.length + 1}`, refreshToken: `refresh-${this.refreshes.length + 1}`, expiresIn: 7200, scope: OAUTH2_SCOPES};
+  }
+}
+
+describe('Twitter OAuth2 Unit Tests', function() {
+  const now = new Date('2023-10-06T14:00:00Z');
+
+  it(`logs in with PKCE and persists the token`, async function() {
+    const store = new MemoryStore();
+    const appClient = new FakeAppClient();
+    const url = await startOAuth2Login(store, appClient, 'http://127.0.0.1:8080/callback', now);
+    expect(url).to.contain('offline.access');
+
+    let error = null;
+    try {
+      await completeOAuth2Login('code-1', 'forged', store, appClient, now);
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.contain('state doesn\'t match');
+
+    const token = await completeOAuth2Login('code-1', 'state-1', store, appClient, now);
+    expect(appClient.logins).to.eql([{code: 'code-1', codeVerifier: 'verifier', redirectUri: 'http://127.0.0.1:8080/callback'}]);
+    expect(token).to.include({accessToken: 'access-1', refreshToken: 'refresh-1', expiresAt: '2023-10-06T16:00:00.000Z'});
+    expect(await loadOAuth2Token(store)).to.eql(token);
+    expect(await store.exists('twitter/oauth2-login.json')).to.equal(false);
+  });
+
+  it(`refreshes the token when it's about to expire`, async function() {
+    const store = new MemoryStore();
+    const appClient = new FakeAppClient();
+    const createClient = (accessToken) => ({accessToken});
+
+    let error = null;
+    try {
+      await getOAuth2Client(store, appClient, createClient, now);
+    } catch (e) {
+      error = e;
+    }
+    expect(error.message).to.contain('twitter-login');
+
+    await saveOAuth2Token({accessToken: 'access-1', refreshToken: 'refresh-1', expiresAt: '2023-10-06T15:00:00.000Z', scope: OAUTH2_SCOPES}, store);
+    expect(await getOAuth2Client(store, appClient, createClient, now)).to.eql({accessToken: 'access-1'});
+    expect(appClient.refreshes).to.have.lengthOf(0);
+
+    const later = new Date('2023-10-06T14:58:00Z');
+    expect(await getOAuth2Client(store, appClient, createClient, later)).to.eql({accessToken: 'access-2'});
+    expect(appClient.refreshes).to.eql(['refresh-1']);
+    expect(await loadOAuth2Token(store)).to.include({refreshToken: 'refresh-2', expiresAt: '2023-10-06T16:58:00.000Z'});
+  });
+});
@@ -0,0 +1,31 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {MemoryStore, encodePng} = require('./fakes');
+const {VISUAL_DRIFT_FILENAME, checkVisualDrift, resetVisualBaseline, alertVisualDrift} = require('../lib/visual_drift');
+
+describe('Visual Drift Unit Tests', function() {
+  const page = encodePng(90, 80, (x) => x * 2);
+  const recompressed = encodePng(90, 80, (x) => x * 2 + (x % 9 === 0 ? 1 : 0));
+  const withNote = encodePng(90, 80, (x, y) => y < 40 ? 255 - x * 2 : x * 2);
+
+  it(`reports the page once when it looks different, while the schedule is the same`, async function() {
+    const store = new MemoryStore();
+    expect(await checkVisualDrift('team', page, store, 10)).to.eql({status: 'seeded', distance: null});
+    expect((await checkVisualDrift('team', recompressed, store, 10)).status).to.equal('same');
+    const drift = await checkVisualDrift('team', withNote, store, 10);
+    expect(drift.status).to.equal('drifted');
+    expect(drift.distance).to.be.above(10);
+    expect((await checkVisualDrift('team', withNote, store, 10)).status).to.equal('same');
+    await resetVisualBaseline('team', store);
+    expect(await store.exists(`team/${VISUAL_DRIFT_FILENAME}`)).to.equal(false);
+  });
+
+  it(`alerts the admins with the screenshot`, async function() {
+    const alerts = [];
+    const notify = async (subject, text, screenshot) => alerts.push({subject, text, screenshot}) && ['email'];
+    expect(await alertVisualDrift({id: 'team', url: 'https://example.com'}, {status: 'drifted', distance: 32}, withNote, notify)).to.eql(['email']);
+    expect(alerts[0].subject).to.contain('team page looks different');
+    expect(alerts[0].text).to.contain('32 of 64 bits');
+    expect(alerts[0].screenshot).to.eql({content: withNote});
+  });
+});
@@ -0,0 +1,42 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const {checkBrowser, runWarmupChecks, formatWarmupResults} = require('../lib/warmup');
+const {createLazyBrowser, createSharedBrowser} = require('../lib/scrape');
+
+describe('Warmup Unit Tests', function() {
+  it(`closes the browser after checking it`, async function() {
+    let closed = false;
+    const browser = {version: async () => 'HeadlessChrome/117.0', close: async () => {
+      closed = true;
+    }};
+    expect(await checkBrowser(createLazyBrowser(async () => browser))).to.equal('HeadlessChrome/117.0');
+    expect(closed).to.equal(true);
+  });
+
+  it(`leaves a shared browser running for the next runs`, async function() {
+    let launches = 0;
+    let closed = false;
+    const shared = createSharedBrowser(async () => {
+      launches++;
+      return {version: async () => 'HeadlessChrome/117.0', newPage: async () => ({}), close: async () => {
+        closed = true;
+      }};
+    });
+    expect(await checkBrowser(shared)).to.equal('HeadlessChrome/117.0');
+    await shared.get();
+    expect(launches).to.equal(1);
+    expect(closed).to.equal(false);
+  });
+
+  it(`reports the failed checks without stopping the others`, async function() {
+    const results = await runWarmupChecks({
+      storage: async () => '3 files under BlineBanditsBot/',
+      twitter: async () => {
+        throw new Error('401 Unauthorized');
+      },
+      browser: async () => 'HeadlessChrome/117.0',
+    });
+    expect(results.map((result) => [result.name, result.ok])).to.eql([['storage', true], ['twitter', false], ['browser', true]]);
+    expect(formatWarmupResults(results)).to.match(/^storage: ok \(3 files under BlineBanditsBot\/, \d+ms\), twitter: FAILED \(401 Unauthorized, \d+ms\), browser: ok/);
+  });
+});
@@ -0,0 +1,36 @@
+/* eslint-disable max-len */
+const expect = require('chai').expect;
+const crypto = require('crypto');
+const {signPayload, encryptPayload, decryptPayload, buildWebhookRequest} = require('../lib/webhook');
+
+describe('Webhook Unit Tests', function() {
+  const {privateKey} = crypto.generateKeyPairSync('x25519');
+  const jwk = privateKey.export({format: 'jwk'});
+  const event = {type: 'schedule.changed', team: 'BlineBanditsBot', severity: 'moderate', changes: []};
+
+  it(`signs the payload`, function() {
+    expect(signPayload('{}', 'secret')).to.equal(`sha256=${crypto.createHmac('sha256', 'secret').update('{}').digest('hex')}`);
+  });
+
+  it(`encrypts the payload for the recipient`, function() {
+    const envelope = encryptPayload(JSON.stringify(event), jwk.x);
+    expect(envelope.ciphertext).to.not.include('BlineBanditsBot');
+    expect(JSON.parse(decryptPayload(envelope, jwk.d, jwk.x))).to.eql(event);
+  });
+
+  it(`can't be decrypted with another key`, function() {
+    const other = crypto.generateKeyPairSync('x25519').privateKey.export({format: 'jwk'});
+    const envelope = encryptPayload(JSON.stringify(event), jwk.x);
+    expect(() => decryptPayload(envelope, other.d, other.x)).to.throw();
+  });
+
+  it(`signs the encrypted envelope`, function() {
+    const {body, headers} = buildWebhookRequest({url: 'https://example.com', secret: 'secret', publicKey: jwk.x}, event);
+    expect(headers['x-bandits-signature']).to.equal(signPayload(body, 'secret'));
+    expect(JSON.parse(decryptPayload(JSON.parse(body), jwk.d, jwk.x))).to.eql(event);
+
+    const plain = buildWebhookRequest({url: 'https://example.com'}, event);
+    expect(plain.body).to.equal(JSON.stringify(event));
+    expect(plain.headers['x-bandits-signature']).to.equal(undefined);
+  });
+});
@@ -0,0 +1,16 @@
+/* eslint-disable max-len */
+'use strict';
+const {runWarmupChecks, formatWarmupResults} = require('./lib/warmup');
+const {init} = require('./setup');
+
+/**
+ * Initializes the browser and verifies the connectivity to storage and
+ * Twitter, without processing any teams. Exits with a non-zero status when
+ * any of the checks fail, so that it can be used as a deploy or health check.
+ */
+(async () => {
+  await init(); // connect to HCP Vault Secrets and populate environment variables
+  const results = await runWarmupChecks();
+  console.log(formatWarmupResults(results));
+  process.exit(results.every((result) => result.ok) ? 0 : 1);
+})();